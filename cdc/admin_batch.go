@@ -0,0 +1,125 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+// status of an admin job in a batch
+const (
+	// the job is accepted by the owner
+	AdminJobQueued = "queued"
+	// the job is rejected by the owner
+	AdminJobFailed = "failed"
+	// the job is valid, but not enqueued because another job of the batch failed
+	AdminJobAborted = "aborted"
+)
+
+// AdminJobResult is the result of the admin job of a changefeed in a batch.
+type AdminJobResult struct {
+	CfID    string `json:"changefeed-id"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ParseAdminJobType parses the type of an admin job, it's one of stop, resume
+// and remove, or the number of the type.
+func ParseAdminJobType(s string) (model.AdminJobType, error) {
+	switch s {
+	case "stop", "pause":
+		return model.AdminStop, nil
+	case "resume":
+		return model.AdminResume, nil
+	case "remove":
+		return model.AdminRemove, nil
+	}
+	typ, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return model.AdminNone, errors.Errorf("invalid admin job type: %s", s)
+	}
+	return model.AdminJobType(typ), nil
+}
+
+// MatchChangeFeeds returns the sorted IDs of the changefeeds matching the
+// pattern, the syntax of the pattern is the same as path.Match.
+func MatchChangeFeeds(ctx context.Context, cli kv.CDCEtcdClient, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.Annotatef(err, "invalid changefeed filter: %s", pattern)
+	}
+	_, changefeeds, err := cli.GetChangeFeeds(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var ids []string
+	for id := range changefeeds {
+		if matched, _ := path.Match(pattern, id); matched {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// EnqueueJobs checks the admin jobs of many changefeeds and enqueues the valid
+// ones together. If abortOnFailure is set, none of the jobs is enqueued once a
+// job is invalid. The result of each job is returned in order of the jobs.
+func (o *ownerImpl) EnqueueJobs(jobs []model.AdminJob, abortOnFailure bool) ([]*AdminJobResult, error) {
+	if !o.manager.IsOwner() {
+		return nil, errors.Trace(concurrency.ErrElectionNotLeader)
+	}
+	// the jobs are checked against the state of the owner
+	o.l.RLock()
+	defer o.l.RUnlock()
+	results := make([]*AdminJobResult, 0, len(jobs))
+	valid := make([]model.AdminJob, 0, len(jobs))
+	seen := make(map[string]struct{}, len(jobs))
+	failed := false
+	for _, job := range jobs {
+		result := &AdminJobResult{CfID: job.CfID, Status: AdminJobQueued}
+		results = append(results, result)
+		err := o.checkAdminJob(job)
+		if _, ok := seen[job.CfID]; ok && err == nil {
+			err = errors.Errorf("changefeed [%s] is duplicated in the batch", job.CfID)
+		}
+		seen[job.CfID] = struct{}{}
+		if err != nil {
+			result.Status = AdminJobFailed
+			result.Message = err.Error()
+			failed = true
+			continue
+		}
+		valid = append(valid, job)
+	}
+	if failed && abortOnFailure {
+		for _, result := range results {
+			if result.Status == AdminJobQueued {
+				result.Status = AdminJobAborted
+			}
+		}
+		return results, nil
+	}
+	o.adminJobsLock.Lock()
+	o.adminJobs = append(o.adminJobs, valid...)
+	o.adminJobsLock.Unlock()
+	return results, nil
+}
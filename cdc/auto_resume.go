@@ -0,0 +1,224 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"go.uber.org/zap"
+)
+
+const autoResumeProbeTimeout = 5 * time.Second
+
+// AutoResumeConfig is the config of resuming the changefeeds which are paused
+// because the downstream is unavailable.
+type AutoResumeConfig struct {
+	// Window is how long the downstream is probed after the changefeed is
+	// paused, the changefeed is left paused if the downstream doesn't recover
+	// within the window. Zero disables the auto resume.
+	Window time.Duration
+	// ProbeInterval is the interval between two probes of the downstream.
+	ProbeInterval time.Duration
+}
+
+// DefaultAutoResumeConfig is the default config of the auto resume.
+var DefaultAutoResumeConfig = AutoResumeConfig{
+	Window:        30 * time.Minute,
+	ProbeInterval: 30 * time.Second,
+}
+
+var (
+	autoResumeConfigMu sync.Mutex
+	autoResumeConfig   = DefaultAutoResumeConfig
+)
+
+// setAutoResumeConfig sets the auto resume config of the owner, it may be
+// reloaded while the owner is running.
+func setAutoResumeConfig(cfg AutoResumeConfig) {
+	autoResumeConfigMu.Lock()
+	defer autoResumeConfigMu.Unlock()
+	autoResumeConfig = cfg
+}
+
+func getAutoResumeConfig() AutoResumeConfig {
+	autoResumeConfigMu.Lock()
+	defer autoResumeConfigMu.Unlock()
+	return autoResumeConfig
+}
+
+// the result labels of the auto resume metric
+const (
+	autoResumeResumed = "resumed"
+	autoResumeGiveUp  = "give-up"
+)
+
+type pausedChangeFeed struct {
+	sinkURI   string
+	pausedAt  time.Time
+	lastProbe time.Time
+	// probing is set while the downstream is probed, and probed is set once
+	// the result of the probe is ready, err is the result.
+	probing bool
+	probed  bool
+	err     error
+}
+
+// autoResumer probes the downstream of the paused changefeeds, and reports the
+// changefeeds to be resumed once their downstream recovers. The state is kept
+// in the memory of the owner, the changefeeds paused before an owner change
+// are not resumed automatically. The downstream is probed in the background,
+// so the owner isn't blocked by the unavailable downstream.
+type autoResumer struct {
+	probe func(ctx context.Context, sinkURI string) error
+
+	mu sync.Mutex
+	// cfg may be reloaded while the probes are running
+	cfg    AutoResumeConfig
+	paused map[model.ChangeFeedID]*pausedChangeFeed
+	// wg waits for the running probes
+	wg sync.WaitGroup
+}
+
+func newAutoResumer(cfg AutoResumeConfig) *autoResumer {
+	return &autoResumer{
+		cfg:    cfg,
+		probe:  sink.Probe,
+		paused: make(map[model.ChangeFeedID]*pausedChangeFeed),
+	}
+}
+
+// startProbe probes the downstream of a changefeed in the background, the
+// changefeed is untracked if the first probe tells the failure is not caused
+// by an outage. The probe outlives the owner tick starting it, so it's only
+// bounded by the timeout. It must be called with mu held.
+func (r *autoResumer) startProbe(id model.ChangeFeedID, cf *pausedChangeFeed, first bool) {
+	cf.probing = true
+	window := r.cfg.Window
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), autoResumeProbeTimeout)
+		err := r.probe(ctx, cf.sinkURI)
+		cancel()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		cf.probing = false
+		// the changefeed is untracked while it's probed
+		if r.paused[id] != cf {
+			return
+		}
+		if !first {
+			cf.probed, cf.err = true, err
+			return
+		}
+		switch errors.Cause(err) {
+		case nil:
+			log.Info("downstream is available, changefeed won't be resumed automatically", zap.String("changefeed", id))
+			delete(r.paused, id)
+		case sink.ErrProbeNotSupported:
+			log.Info("downstream can't be probed, changefeed won't be resumed automatically", zap.String("changefeed", id))
+			delete(r.paused, id)
+		default:
+			log.Warn("downstream is unavailable, probe it to resume the changefeed",
+				zap.String("changefeed", id), zap.Duration("window", window), zap.Error(err))
+		}
+	}()
+}
+
+// track starts probing the downstream of a changefeed paused by a failure. The
+// downstream is probed at once, the changefeed isn't tracked if the downstream
+// is available, since the failure is not caused by an outage.
+func (r *autoResumer) track(id model.ChangeFeedID, sinkURI string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cfg.Window <= 0 {
+		return
+	}
+	cf := &pausedChangeFeed{sinkURI: sinkURI, pausedAt: now, lastProbe: now}
+	r.paused[id] = cf
+	r.startProbe(id, cf, true)
+}
+
+// setConfig sets the config of the auto resume, it takes effect from the next
+// probes and checks.
+func (r *autoResumer) setConfig(cfg AutoResumeConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+}
+
+// untrack stops probing the downstream of a changefeed.
+func (r *autoResumer) untrack(id model.ChangeFeedID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.paused, id)
+}
+
+// reset untracks all the changefeeds.
+func (r *autoResumer) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = make(map[model.ChangeFeedID]*pausedChangeFeed)
+}
+
+// tracked returns the number of the tracked changefeeds.
+func (r *autoResumer) tracked() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.paused)
+}
+
+// check returns the tracked changefeeds whose downstream has recovered by the
+// results of the finished probes, and probes the others again after the
+// interval. The changefeeds which don't recover within the window are given
+// up. It never waits for the probes.
+func (r *autoResumer) check(now time.Time) []model.ChangeFeedID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var recovered []model.ChangeFeedID
+	for id, cf := range r.paused {
+		if cf.probed {
+			cf.probed = false
+			if cf.err == nil {
+				log.Info("downstream recovered, resume the changefeed", zap.String("changefeed", id),
+					zap.Duration("paused", now.Sub(cf.pausedAt)))
+				autoResumeCounter.WithLabelValues(id, autoResumeResumed).Inc()
+				recovered = append(recovered, id)
+				delete(r.paused, id)
+				continue
+			}
+			if now.Sub(cf.pausedAt) >= r.cfg.Window {
+				log.Error("downstream doesn't recover in the window, give up resuming the changefeed",
+					zap.String("changefeed", id), zap.Duration("window", r.cfg.Window), zap.Error(cf.err))
+				autoResumeCounter.WithLabelValues(id, autoResumeGiveUp).Inc()
+				delete(r.paused, id)
+				continue
+			}
+			log.Debug("downstream is still unavailable", zap.String("changefeed", id), zap.Error(cf.err))
+		}
+		if cf.probing || now.Sub(cf.lastProbe) < r.cfg.ProbeInterval {
+			continue
+		}
+		cf.lastProbe = now
+		r.startProbe(id, cf, false)
+	}
+	return recovered
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/sink"
+)
+
+type autoResumeSuite struct{}
+
+var _ = check.Suite(&autoResumeSuite{})
+
+func (s *autoResumeSuite) TestResumeAndGiveUp(c *check.C) {
+	r := newAutoResumer(AutoResumeConfig{Window: time.Minute, ProbeInterval: 10 * time.Second})
+	available := map[string]bool{"mysql-1": true}
+	var (
+		mu     sync.Mutex
+		probes int
+	)
+	r.probe = func(ctx context.Context, sinkURI string) error {
+		mu.Lock()
+		probes++
+		mu.Unlock()
+		switch {
+		case sinkURI == "kinesis://stream":
+			return sink.ErrProbeNotSupported
+		case available[sinkURI]:
+			return nil
+		}
+		return errors.New("connection refused")
+	}
+	now := time.Now()
+
+	// the failures not caused by outages are not tracked
+	r.track("cf-1", "mysql-1", now)
+	r.track("cf-2", "kinesis://stream", now)
+	r.wg.Wait()
+	c.Assert(r.tracked(), check.Equals, 0)
+
+	available["mysql-1"] = false
+	r.track("cf-1", "mysql-1", now)
+	r.track("cf-3", "mysql-3", now)
+	r.track("cf-4", "mysql-4", now)
+	r.wg.Wait()
+	c.Assert(r.tracked(), check.Equals, 3)
+	r.untrack("cf-4")
+
+	// not probed before the interval
+	probes = 0
+	c.Assert(r.check(now.Add(5*time.Second)), check.HasLen, 0)
+	r.wg.Wait()
+	c.Assert(probes, check.Equals, 0)
+	c.Assert(r.check(now.Add(10*time.Second)), check.HasLen, 0)
+	r.wg.Wait()
+	c.Assert(probes, check.Equals, 2)
+
+	// the changefeed is resumed by the result of the next probe
+	available["mysql-1"] = true
+	c.Assert(r.check(now.Add(20*time.Second)), check.HasLen, 0)
+	r.wg.Wait()
+	c.Assert(r.check(now.Add(25*time.Second)), check.DeepEquals, []string{"cf-1"})
+	c.Assert(r.tracked(), check.Equals, 1)
+
+	// cf-3 is given up by the first failed probe after the window
+	c.Assert(r.check(now.Add(time.Minute)), check.HasLen, 0)
+	c.Assert(r.tracked(), check.Equals, 1)
+	r.wg.Wait()
+	c.Assert(r.check(now.Add(time.Minute+time.Second)), check.HasLen, 0)
+	c.Assert(r.tracked(), check.Equals, 0)
+}
+
+func (s *autoResumeSuite) TestNotBlockedByProbes(c *check.C) {
+	r := newAutoResumer(AutoResumeConfig{Window: time.Minute, ProbeInterval: 10 * time.Second})
+	unblock := make(chan struct{})
+	r.probe = func(ctx context.Context, sinkURI string) error {
+		<-unblock
+		return errors.New("connection refused")
+	}
+	now := time.Now()
+	r.track("cf-1", "mysql-1", now)
+	c.Assert(r.tracked(), check.Equals, 1)
+	// the changefeed being probed isn't probed again
+	c.Assert(r.check(now.Add(time.Hour)), check.HasLen, 0)
+	c.Assert(r.tracked(), check.Equals, 1)
+	close(unblock)
+	r.wg.Wait()
+	c.Assert(r.tracked(), check.Equals, 1)
+}
+
+func (s *autoResumeSuite) TestDisabled(c *check.C) {
+	r := newAutoResumer(AutoResumeConfig{})
+	r.probe = func(ctx context.Context, sinkURI string) error {
+		c.Fatal("should not probe")
+		return nil
+	}
+	r.track("cf-1", "mysql-1", time.Now())
+	c.Assert(r.tracked(), check.Equals, 0)
+}
+
+func (s *autoResumeSuite) TestSetConfig(c *check.C) {
+	r := newAutoResumer(AutoResumeConfig{})
+	r.probe = func(ctx context.Context, sinkURI string) error {
+		return errors.New("connection refused")
+	}
+	// the config is reloaded by the owner while the probes are running
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.setConfig(AutoResumeConfig{Window: time.Minute, ProbeInterval: time.Second})
+	}()
+	r.track("cf-1", "mysql-1", time.Now())
+	<-done
+	r.track("cf-2", "mysql-2", time.Now())
+	r.wg.Wait()
+	c.Assert(r.tracked() >= 1, check.IsTrue)
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/pingcap/tidb/store"
 	"github.com/pingcap/tidb/store/tikv"
 	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.etcd.io/etcd/mvcc"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -42,6 +43,13 @@ import (
 const (
 	ownerRunInterval    = time.Millisecond * 500
 	cfWatcherRetryDelay = time.Millisecond * 500
+	// scanQuotaSyncInterval is the interval to load the quota of the
+	// incremental scans assigned by the owner
+	scanQuotaSyncInterval = time.Second * 5
+	// captureSessionTTL is the TTL in seconds of the lease of the capture
+	// info, the capture info is deleted if the capture dies, and the owner
+	// dispatches its tables to the other captures.
+	captureSessionTTL = 10
 )
 
 // Capture represents a Capture server, it monitors the changefeed information in etcd and schedules Task on it.
@@ -55,10 +63,12 @@ type Capture struct {
 	procLock   sync.Mutex
 
 	info *model.CaptureInfo
+	// session keeps the lease of the capture info alive.
+	session *concurrency.Session
 }
 
 // NewCapture returns a new Capture instance
-func NewCapture(pdEndpoints []string) (c *Capture, err error) {
+func NewCapture(pdEndpoints []string, cfg CaptureConfig) (c *Capture, err error) {
 	ectdCli, err := clientv3.New(clientv3.Config{
 		Endpoints:   pdEndpoints,
 		DialTimeout: 5 * time.Second,
@@ -80,12 +90,21 @@ func NewCapture(pdEndpoints []string) (c *Capture, err error) {
 	cli := kv.NewCDCEtcdClient(ectdCli)
 	id := uuid.New().String()
 	info := &model.CaptureInfo{
-		ID: id,
+		ID:        id,
+		Labels:    cfg.Labels,
+		MaxTables: cfg.MaxTables,
+		Dedicated: cfg.Dedicated,
 	}
 
 	log.Info("creating capture", zap.String("capture-id", id))
 
 	manager := roles.NewOwnerManager(cli, id, kv.CaptureOwnerKey)
+	cli.EnableAudit(func() string {
+		if manager.IsOwner() {
+			return "owner/" + id
+		}
+		return "capture/" + id
+	})
 
 	worker, err := NewOwner(pdEndpoints, cli, manager)
 	if err != nil {
@@ -108,6 +127,8 @@ var _ processorCallback = &Capture{}
 
 // OnRunProcessor implements processorCallback.
 func (c *Capture) OnRunProcessor(p *processor) {
+	c.procLock.Lock()
+	defer c.procLock.Unlock()
 	c.processors[p.changefeedID] = p
 }
 
@@ -156,9 +177,67 @@ func (c *Capture) Start(ctx context.Context) (err error) {
 		}
 	})
 
+	errg.Go(func() error {
+		return c.syncScanQuota(cctx)
+	})
+
+	// the owner takes the capture as dead after the lease expires, so the
+	// capture exits instead of replicating the tables dispatched to others
+	errg.Go(func() error {
+		select {
+		case <-cctx.Done():
+			return nil
+		case <-c.session.Done():
+			return errors.Trace(model.ErrCaptureSessionDone)
+		}
+	})
+
 	return errg.Wait()
 }
 
+// syncScanQuota loads the quota of the incremental scans of the capture
+// periodically, the errors are only logged so the scans keep the last quota.
+func (c *Capture) syncScanQuota(ctx context.Context) error {
+	ticker := time.NewTicker(scanQuotaSyncInterval)
+	defer ticker.Stop()
+	for {
+		quota, err := c.loadScanQuota(ctx)
+		if err != nil {
+			log.Warn("load the scan quota failed", zap.Error(err))
+		} else {
+			kv.SetScanQuota(quota)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Capture) loadScanQuota(ctx context.Context) (int, error) {
+	quotas, err := c.etcdClient.GetScanQuota(ctx)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if quotas == nil {
+		return 0, nil
+	}
+	if quota, ok := quotas[c.info.ID]; ok {
+		return quota, nil
+	}
+	// the owner hasn't assigned the quota to the new capture yet, it runs
+	// the least scans before the assignment
+	limit, err := c.etcdClient.GetScanLimit(ctx)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if limit.Global > 0 {
+		return 1, nil
+	}
+	return limit.PerCapture, nil
+}
+
 // Cleanup cleans all dynamic resources
 func (c *Capture) Cleanup() {
 	c.procLock.Lock()
@@ -171,12 +250,28 @@ func (c *Capture) Cleanup() {
 
 // Close closes the capture by unregistering it from etcd
 func (c *Capture) Close(ctx context.Context) error {
-	return errors.Trace(c.etcdClient.DeleteCaptureInfo(ctx, c.info.ID))
+	err := c.etcdClient.DeleteCaptureInfo(ctx, c.info.ID)
+	if c.session != nil {
+		if closeErr := c.session.Close(); closeErr != nil {
+			log.Warn("close capture session failed", zap.Error(closeErr))
+		}
+	}
+	return errors.Trace(err)
 }
 
-// register registers the capture information in etcd
+// register registers the capture information in etcd with the lease of the
+// session of the capture, the session is created at the first time. The
+// session outlives the context of the capture, so the lease can be revoked
+// in Close.
 func (c *Capture) register(ctx context.Context) error {
-	return errors.Trace(c.etcdClient.PutCaptureInfo(ctx, c.info))
+	if c.session == nil {
+		session, err := roles.NewSession(context.Background(), c.etcdClient, roles.NewSessionDefaultRetryCnt, captureSessionTTL)
+		if err != nil {
+			return errors.Annotate(err, "create capture session")
+		}
+		c.session = session
+	}
+	return errors.Trace(c.etcdClient.PutCaptureInfo(ctx, c.info, clientv3.WithLease(c.session.Lease())))
 }
 
 func createTiStore(urls string) (tidbkv.Storage, error) {
@@ -185,3 +185,26 @@ func (ci *captureInfoSuite) TestWatch(c *check.C) {
 	watchCancel()
 	mustClosed()
 }
+
+func (ci *captureInfoSuite) TestRegisterWithLease(c *check.C) {
+	ctx := context.Background()
+	capture := &Capture{etcdClient: ci.client, info: &model.CaptureInfo{ID: "leased"}}
+	c.Assert(capture.register(ctx), check.IsNil)
+	defer capture.Close(ctx)
+	resp, err := ci.client.Client.Get(ctx, kv.GetEtcdKeyCaptureInfo("leased"))
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Kvs, check.HasLen, 1)
+	c.Assert(clientv3.LeaseID(resp.Kvs[0].Lease), check.Equals, capture.session.Lease())
+
+	// the capture info is deleted after the lease expires, and the capture
+	// sees its session done
+	_, err = ci.client.Client.Revoke(ctx, capture.session.Lease())
+	c.Assert(err, check.IsNil)
+	_, err = ci.client.GetCaptureInfo(ctx, "leased")
+	c.Assert(err, check.Equals, model.ErrCaptureNotExist)
+	select {
+	case <-capture.session.Done():
+	case <-time.After(10 * time.Second):
+		c.Fatal("capture session is not done after the lease is revoked")
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// the eligibility of a table checked by CheckChangefeed
+const (
+	// the table is replicated by the changefeed
+	TableStatusEligible = "eligible"
+	// the table is filtered out by the filter rules
+	TableStatusFiltered = "filtered"
+	// the table can't be replicated correctly
+	TableStatusIneligible = "ineligible"
+)
+
+// ChangefeedDraft is the definition of a changefeed checked by CheckChangefeed,
+// the start ts is the current ts if it's zero.
+type ChangefeedDraft struct {
+	SinkURI  string               `json:"sink-uri"`
+	StartTs  uint64               `json:"start-ts"`
+	TargetTs uint64               `json:"target-ts"`
+	Config   *model.ReplicaConfig `json:"config"`
+}
+
+// Validate checks the definition without accessing the upstream cluster, and
+// returns the warnings of the sink uri.
+func (d *ChangefeedDraft) Validate() ([]string, error) {
+	if d.Config != nil {
+		if err := d.Config.Validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if d.TargetTs > 0 && d.StartTs > 0 && d.TargetTs <= d.StartTs {
+		return nil, errors.Errorf("target ts %d is not greater than start ts %d", d.TargetTs, d.StartTs)
+	}
+	warnings, err := sink.ValidateSinkURI(d.SinkURI)
+	return warnings, errors.Trace(err)
+}
+
+// TableCheckResult is the eligibility of an upstream table and the approximate
+// size of its data scanned when the changefeed starts.
+type TableCheckResult struct {
+	ID     int64  `json:"id"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+
+	Regions         int   `json:"regions,omitempty"`
+	ApproximateSize int64 `json:"approximate-size,omitempty"`
+	ApproximateKeys int64 `json:"approximate-keys,omitempty"`
+}
+
+// ChangefeedCheckResult is the result of checking a changefeed definition.
+// The config is the effective one with the defaults, and the scan size is the
+// sum of the approximate sizes in bytes of the eligible tables.
+type ChangefeedCheckResult struct {
+	SinkURI  string               `json:"sink-uri"`
+	StartTs  *TsCheckResult       `json:"start-ts"`
+	TargetTs uint64               `json:"target-ts,omitempty"`
+	Config   *model.ReplicaConfig `json:"config"`
+	Tables   []*TableCheckResult  `json:"tables"`
+
+	ScanRegions int   `json:"scan-regions"`
+	ScanSize    int64 `json:"scan-size"`
+	ScanKeys    int64 `json:"scan-keys"`
+
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CheckChangefeed checks the definition of a changefeed against the upstream
+// cluster, and reports the tables it would replicate at the start ts and the
+// approximate size of their data. No changefeed is created.
+func CheckChangefeed(ctx context.Context, pdEndpoints []string, pdCli pd.Client, draft *ChangefeedDraft) (*ChangefeedCheckResult, error) {
+	warnings, err := draft.Validate()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	startTs := draft.StartTs
+	if startTs == 0 {
+		physical, logical, err := pdCli.GetTS(ctx)
+		if err != nil {
+			return nil, errors.Annotate(err, "get current ts")
+		}
+		startTs = oracle.ComposeTS(physical, logical)
+	}
+	tsResult, err := CheckTs(ctx, pdCli, startTs, time.Local)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !tsResult.Valid {
+		warnings = append(warnings, fmt.Sprintf("start ts %d is earlier than the gc safepoint %d", startTs, tsResult.GCSafePoint.TSO))
+	}
+
+	schemaStorage, err := createSchemaStore(pdEndpoints, nil)
+	if err != nil {
+		return nil, errors.Annotate(err, "create schema store failed")
+	}
+	if err := schemaStorage.HandlePreviousDDLJobIfNeed(startTs); err != nil {
+		return nil, errors.Annotatef(err, "build schema at ts %d", startTs)
+	}
+
+	result := &ChangefeedCheckResult{
+		SinkURI:  model.RedactSinkURI(draft.SinkURI),
+		StartTs:  tsResult,
+		TargetTs: draft.TargetTs,
+		Config:   effectiveConfig(draft.Config),
+		Warnings: warnings,
+	}
+	pdAddr := pdEndpoints[0]
+	if !strings.Contains(pdAddr, "://") {
+		pdAddr = "http://" + pdAddr
+	}
+	estimate := func(ctx context.Context, span util.Span) (*regionStats, error) {
+		return getRegionStats(ctx, pdAddr, span)
+	}
+	if err := checkTables(ctx, result, schemaStorage, estimate); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return result, nil
+}
+
+// effectiveConfig returns a copy of the config with the defaults.
+func effectiveConfig(cfg *model.ReplicaConfig) *model.ReplicaConfig {
+	effective := &model.ReplicaConfig{}
+	if cfg != nil {
+		*effective = *cfg
+	}
+	if effective.DDL.OnError == "" {
+		effective.DDL.OnError = model.DDLOnErrorPause
+	}
+	return effective
+}
+
+// regionStats is the approximate size of the regions in a key range reported
+// by PD, the storage size is in MiB.
+type regionStats struct {
+	Count       int   `json:"count"`
+	StorageSize int64 `json:"storage_size"`
+	StorageKeys int64 `json:"storage_keys"`
+}
+
+type regionStatsGetter func(ctx context.Context, span util.Span) (*regionStats, error)
+
+// getRegionStats gets the stats of the regions in the span from the HTTP API
+// of PD, the keys of the span should be encoded.
+func getRegionStats(ctx context.Context, pdAddr string, span util.Span) (*regionStats, error) {
+	query := url.Values{}
+	query.Set("start_key", string(span.Start))
+	query.Set("end_key", string(span.End))
+	req, err := http.NewRequest(http.MethodGet, pdAddr+"/pd/api/v1/stats/region?"+query.Encode(), nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("pd responds %d: %s", resp.StatusCode, data)
+	}
+	stats := &regionStats{}
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, errors.Annotatef(err, "invalid region stats: %s", data)
+	}
+	return stats, nil
+}
+
+// checkTables fills the result with the tables in the schema storage sorted by
+// name, and sums up the sizes of the eligible ones. The views and sequences
+// are left out.
+func checkTables(ctx context.Context, result *ChangefeedCheckResult, schemaStorage *schema.Storage, estimate regionStatsGetter) error {
+	filter, err := newTxnFilter(result.Config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for id, name := range schemaStorage.CloneTables() {
+		if info, ok := schemaStorage.TableByID(int64(id)); ok && (info.IsView() || info.IsSequence()) {
+			continue
+		}
+		result.Tables = append(result.Tables, &TableCheckResult{
+			ID:     int64(id),
+			Schema: name.Schema,
+			Table:  name.Table,
+			Status: TableStatusEligible,
+		})
+	}
+	sort.Slice(result.Tables, func(i, j int) bool {
+		ti, tj := result.Tables[i], result.Tables[j]
+		if ti.Schema != tj.Schema {
+			return ti.Schema < tj.Schema
+		}
+		return ti.Table < tj.Table
+	})
+
+	for _, table := range result.Tables {
+		name := schema.TableName{Schema: table.Schema, Table: table.Table}
+		if filter.ShouldIgnoreTable(table.Schema, table.Table) {
+			table.Status = TableStatusFiltered
+			table.Reason = "table is filtered out by the filter rules"
+			continue
+		}
+		info, ok := schemaStorage.TableByID(table.ID)
+		if !ok {
+			return errors.NotFoundf("table %d", table.ID)
+		}
+		replicable, reason, err := schemaStorage.IsTableReplicable(table.ID)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !replicable {
+			switch result.Config.IneligibleTablePolicy() {
+			case model.IneligibleTableSkip:
+				table.Status = TableStatusIneligible
+				table.Reason = reason + ", the changes are skipped until it has one"
+				continue
+			case model.IneligibleTablePause:
+				table.Status = TableStatusIneligible
+				table.Reason = reason + ", it's paused when it has changes"
+				continue
+			default:
+				table.Reason = reason + ", the rows are identified by all the columns in the downstream"
+			}
+		}
+		// the partitions of a partitioned table are scanned separately
+		var estimateErr error
+		for _, id := range info.PhysicalIDs() {
+			stats, err := estimate(ctx, util.GetTableSpan(id, true))
+			if err != nil {
+				estimateErr = err
+				break
+			}
+			table.Regions += stats.Count
+			table.ApproximateSize += stats.StorageSize << 20
+			table.ApproximateKeys += stats.StorageKeys
+		}
+		if estimateErr != nil {
+			table.Regions, table.ApproximateSize, table.ApproximateKeys = 0, 0, 0
+			result.Warnings = append(result.Warnings, fmt.Sprintf("estimate the size of table %s: %s", name, estimateErr))
+			continue
+		}
+		result.ScanRegions += table.Regions
+		result.ScanSize += table.ApproximateSize
+		result.ScanKeys += table.ApproximateKeys
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb-tools/pkg/filter"
+	"github.com/pingcap/tidb/types"
+)
+
+type changefeedCheckSuite struct{}
+
+var _ = check.Suite(&changefeedCheckSuite{})
+
+func (s *changefeedCheckSuite) TestValidateDraft(c *check.C) {
+	draft := &ChangefeedDraft{SinkURI: "root:secret@tcp(127.0.0.1:3306)/", StartTs: 10, TargetTs: 20}
+	warnings, err := draft.Validate()
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.HasLen, 1)
+
+	for _, tc := range []struct {
+		draft *ChangefeedDraft
+		err   string
+	}{
+		{&ChangefeedDraft{SinkURI: "kafka://127.0.0.1:9092/"}, ".*unsupported sink scheme: kafka.*"},
+		{&ChangefeedDraft{SinkURI: "root@tcp(127.0.0.1:3306)/", StartTs: 20, TargetTs: 10}, "target ts 10 is not greater than start ts 20"},
+		{&ChangefeedDraft{SinkURI: "root@tcp(127.0.0.1:3306)/", Config: &model.ReplicaConfig{DDL: model.DDLConfig{OnError: "ignore"}}}, "invalid ddl on-error policy: ignore"},
+	} {
+		_, err := tc.draft.Validate()
+		c.Assert(err, check.ErrorMatches, tc.err)
+	}
+
+	c.Assert(effectiveConfig(nil).DDL.OnError, check.Equals, model.DDLOnErrorPause)
+	cfg := &model.ReplicaConfig{DDL: model.DDLConfig{OnError: model.DDLOnErrorSkip}}
+	c.Assert(effectiveConfig(cfg).DDL.OnError, check.Equals, model.DDLOnErrorSkip)
+}
+
+func (s *changefeedCheckSuite) TestCheckTables(c *check.C) {
+	testDB := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	logDB := &timodel.DBInfo{ID: 2, Name: timodel.NewCIStr("log")}
+	pkCol := &timodel.ColumnInfo{ID: 1, Name: timodel.NewCIStr("id"), Offset: 0, State: timodel.StatePublic,
+		FieldType: *types.NewFieldType(mysql.TypeLong)}
+	pkCol.Flag |= mysql.PriKeyFlag
+	t1 := &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("t1"), PKIsHandle: true, Columns: []*timodel.ColumnInfo{pkCol}}
+	t2 := &timodel.TableInfo{ID: 11, Name: timodel.NewCIStr("t2"), Partition: &timodel.PartitionInfo{
+		Enable:      true,
+		Definitions: []timodel.PartitionDefinition{{ID: 111}, {ID: 112}},
+	}}
+	t3 := &timodel.TableInfo{ID: 12, Name: timodel.NewCIStr("t3")}
+	t4 := &timodel.TableInfo{ID: 13, Name: timodel.NewCIStr("t0")}
+	jobs := []*timodel.Job{
+		{ID: 1, Type: timodel.ActionCreateSchema, SchemaID: 1, BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 1, FinishedTS: 100, DBInfo: testDB}},
+		{ID: 2, Type: timodel.ActionCreateSchema, SchemaID: 2, BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 2, FinishedTS: 101, DBInfo: logDB}},
+		{ID: 3, Type: timodel.ActionCreateTable, SchemaID: 1, TableID: 10, BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 3, FinishedTS: 102, TableInfo: t1}},
+		{ID: 4, Type: timodel.ActionCreateTable, SchemaID: 1, TableID: 11, BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 4, FinishedTS: 103, TableInfo: t2}},
+		{ID: 5, Type: timodel.ActionCreateTable, SchemaID: 2, TableID: 12, BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 5, FinishedTS: 104, TableInfo: t3}},
+		{ID: 6, Type: timodel.ActionCreateTable, SchemaID: 1, TableID: 13, BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 6, FinishedTS: 105, TableInfo: t4}},
+	}
+	for _, job := range jobs {
+		job.State = timodel.JobStateSynced
+		job.Query = "ddl"
+	}
+	schemaStorage, err := schema.NewStorage(jobs)
+	c.Assert(err, check.IsNil)
+	c.Assert(schemaStorage.HandlePreviousDDLJobIfNeed(105), check.IsNil)
+
+	result := &ChangefeedCheckResult{Config: effectiveConfig(&model.ReplicaConfig{
+		FilterRules: &filter.Rules{IgnoreDBs: []string{"log"}},
+	})}
+	estimate := func(ctx context.Context, span util.Span) (*regionStats, error) {
+		if string(span.Start) == string(util.GetTableSpan(13, true).Start) {
+			return nil, errors.New("pd is down")
+		}
+		return &regionStats{Count: 2, StorageSize: 3, StorageKeys: 100}, nil
+	}
+	err = checkTables(context.Background(), result, schemaStorage, estimate)
+	c.Assert(err, check.IsNil)
+
+	expected := []struct {
+		name   string
+		status string
+	}{
+		{"log.t3", TableStatusFiltered},
+		{"test.t0", TableStatusEligible},
+		{"test.t1", TableStatusEligible},
+		{"test.t2", TableStatusEligible},
+	}
+	c.Assert(result.Tables, check.HasLen, len(expected))
+	for i, e := range expected {
+		table := result.Tables[i]
+		c.Assert(table.Schema+"."+table.Table, check.Equals, e.name)
+		c.Assert(table.Status, check.Equals, e.status, check.Commentf("%s: %s", e.name, table.Reason))
+	}
+	c.Assert(result.Tables[1].Reason, check.Matches, "table has no unique key.*")
+	c.Assert(result.Tables[2].Reason, check.Equals, "")
+	c.Assert(result.Tables[2].ApproximateSize, check.Equals, int64(3<<20))
+	// the partitions are estimated separately
+	c.Assert(result.Tables[3].Regions, check.Equals, 4)
+	c.Assert(result.Tables[3].ApproximateSize, check.Equals, int64(6<<20))
+	// only the estimated eligible tables are summed up
+	c.Assert(result.ScanRegions, check.Equals, 6)
+	c.Assert(result.ScanSize, check.Equals, int64(9<<20))
+	c.Assert(result.ScanKeys, check.Equals, int64(300))
+	c.Assert(result.Warnings, check.DeepEquals, []string{"estimate the size of table test.t0: pd is down"})
+
+	// the tables without a unique key are ineligible if they are skipped
+	result = &ChangefeedCheckResult{Config: effectiveConfig(&model.ReplicaConfig{
+		FilterRules:      &filter.Rules{IgnoreDBs: []string{"log"}},
+		IneligibleTables: model.IneligibleTableSkip,
+	})}
+	err = checkTables(context.Background(), result, schemaStorage, estimate)
+	c.Assert(err, check.IsNil)
+	for i, status := range []string{TableStatusFiltered, TableStatusIneligible, TableStatusEligible, TableStatusIneligible} {
+		c.Assert(result.Tables[i].Status, check.Equals, status)
+	}
+	c.Assert(result.ScanRegions, check.Equals, 2)
+	c.Assert(result.Warnings, check.HasLen, 0)
+}
+
+func (s *changefeedCheckSuite) TestGetRegionStats(c *check.C) {
+	span := util.GetTableSpan(10, true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/pd/api/v1/stats/region" || req.URL.Query().Get("start_key") != string(span.Start) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("not found"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":3,"empty_count":1,"storage_size":64,"storage_keys":1000}`))
+	}))
+	defer server.Close()
+
+	stats, err := getRegionStats(context.Background(), server.URL, span)
+	c.Assert(err, check.IsNil)
+	c.Assert(stats, check.DeepEquals, &regionStats{Count: 3, StorageSize: 64, StorageKeys: 1000})
+	_, err = getRegionStats(context.Background(), server.URL, util.GetTableSpan(11, true))
+	c.Assert(err, check.ErrorMatches, "pd responds 404: not found")
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3"
+)
+
+// the states of the changefeeds in the positions
+const (
+	ChangefeedStateNormal   = "normal"
+	ChangefeedStateStopped  = "stopped"
+	ChangefeedStateRemoved  = "removed"
+	ChangefeedStateFinished = "finished"
+	ChangefeedStateFailed   = "failed"
+)
+
+// ChangefeedState returns the state of the changefeed after the admin job.
+func ChangefeedState(typ model.AdminJobType) string {
+	switch typ {
+	case model.AdminStop:
+		return ChangefeedStateStopped
+	case model.AdminRemove:
+		return ChangefeedStateRemoved
+	case model.AdminFinish:
+		return ChangefeedStateFinished
+	case model.AdminFail:
+		return ChangefeedStateFailed
+	}
+	return ChangefeedStateNormal
+}
+
+// ChangefeedPosition is how far a changefeed has replicated. The upstream data
+// committed at or before the checkpoint ts has been written downstream, and
+// the data committed at or before the resolved ts has been received from the
+// upstream. The checkpoint ts never goes backward while the changefeed exists.
+type ChangefeedPosition struct {
+	ID           string  `json:"id"`
+	State        string  `json:"state"`
+	CheckpointTs *TsInfo `json:"checkpoint-ts"`
+	ResolvedTs   *TsInfo `json:"resolved-ts"`
+	// Labels are the labels of the changefeed.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ChangefeedPositions is the positions of the changefeeds read at the etcd
+// revision, a response with a greater revision never has an earlier position
+// of the same changefeed.
+type ChangefeedPositions struct {
+	Revision    int64                 `json:"revision"`
+	Changefeeds []*ChangefeedPosition `json:"changefeeds"`
+}
+
+// GetChangefeedPositions reads the positions of the changefeeds, or the one
+// whose ID is id if it's not empty. The times are shown in the time zone.
+func GetChangefeedPositions(ctx context.Context, cli kv.CDCEtcdClient, id string, timeZone *time.Location) (*ChangefeedPositions, error) {
+	revision, raw, err := cli.GetChangeFeeds(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ids := make([]string, 0, len(raw))
+	for cfID := range raw {
+		if id == "" || cfID == id {
+			ids = append(ids, cfID)
+		}
+	}
+	if id != "" && len(ids) == 0 {
+		return nil, errors.Annotatef(model.ErrChangeFeedNotExists, "changefeed %s", id)
+	}
+	sort.Strings(ids)
+
+	positions := &ChangefeedPositions{Revision: revision, Changefeeds: make([]*ChangefeedPosition, 0, len(ids))}
+	for _, cfID := range ids {
+		info := &model.ChangeFeedInfo{}
+		if err := info.Unmarshal(raw[cfID].Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// the status is read at the same revision as the info
+		status, err := cli.GetChangeFeedStatus(ctx, cfID, clientv3.WithRev(revision))
+		if err != nil && errors.Cause(err) != model.ErrChangeFeedNotExists {
+			return nil, errors.Trace(err)
+		}
+		checkpointTs := info.GetCheckpointTs(status)
+		resolvedTs := checkpointTs
+		state := ChangefeedStateNormal
+		if status != nil {
+			if status.ResolvedTs > resolvedTs {
+				resolvedTs = status.ResolvedTs
+			}
+			state = ChangefeedState(status.AdminJobType)
+		}
+		positions.Changefeeds = append(positions.Changefeeds, &ChangefeedPosition{
+			ID:           cfID,
+			State:        state,
+			CheckpointTs: NewTsInfo(checkpointTs, timeZone),
+			ResolvedTs:   NewTsInfo(resolvedTs, timeZone),
+			Labels:       info.Labels,
+		})
+	}
+	return positions, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type changefeedPositionSuite struct{}
+
+var _ = check.Suite(&changefeedPositionSuite{})
+
+func (s *changefeedPositionSuite) TestGetChangefeedPositions(c *check.C) {
+	etcdURL, server, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	defer server.Close()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{etcdURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	defer client.Close()
+	cli := kv.NewCDCEtcdClient(client)
+	ctx := context.Background()
+
+	c.Assert(cli.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{StartTs: 5}, "cf1"), check.IsNil)
+	c.Assert(cli.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{StartTs: 5, Labels: map[string]string{"team": "dba"}}, "cf2"), check.IsNil)
+	c.Assert(cli.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{StartTs: 5}, "cf3"), check.IsNil)
+	c.Assert(cli.PutChangeFeedStatus(ctx, "cf2", &model.ChangeFeedStatus{CheckpointTs: 10, ResolvedTs: 20}), check.IsNil)
+	c.Assert(cli.PutChangeFeedStatus(ctx, "cf3", &model.ChangeFeedStatus{
+		CheckpointTs: 10, ResolvedTs: 8, AdminJobType: model.AdminStop,
+	}), check.IsNil)
+
+	positions, err := GetChangefeedPositions(ctx, cli, "", time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(positions.Revision, check.Greater, int64(0))
+	c.Assert(positions.Changefeeds, check.HasLen, 3)
+	for i, tc := range []struct {
+		id           string
+		state        string
+		checkpointTs uint64
+		resolvedTs   uint64
+	}{
+		// the changefeed not scheduled yet is at the start ts
+		{"cf1", ChangefeedStateNormal, 5, 5},
+		{"cf2", ChangefeedStateNormal, 10, 20},
+		// the resolved ts is never less than the checkpoint ts
+		{"cf3", ChangefeedStateStopped, 10, 10},
+	} {
+		position := positions.Changefeeds[i]
+		c.Assert(position.ID, check.Equals, tc.id)
+		c.Assert(position.State, check.Equals, tc.state)
+		c.Assert(position.CheckpointTs.TSO, check.Equals, tc.checkpointTs)
+		c.Assert(position.ResolvedTs.TSO, check.Equals, tc.resolvedTs)
+	}
+	c.Assert(positions.Changefeeds[0].Labels, check.IsNil)
+	c.Assert(positions.Changefeeds[1].Labels, check.DeepEquals, map[string]string{"team": "dba"})
+
+	// the positions read later are at a greater revision
+	c.Assert(cli.PutChangeFeedStatus(ctx, "cf2", &model.ChangeFeedStatus{CheckpointTs: 15, ResolvedTs: 20}), check.IsNil)
+	latest, err := GetChangefeedPositions(ctx, cli, "cf2", time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(latest.Revision, check.Greater, positions.Revision)
+	c.Assert(latest.Changefeeds, check.HasLen, 1)
+	c.Assert(latest.Changefeeds[0].CheckpointTs.TSO, check.Equals, uint64(15))
+
+	_, err = GetChangefeedPositions(ctx, cli, "cf4", time.UTC)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+const (
+	minCheckpointStep     = 50 * time.Millisecond
+	maxCheckpointStep     = 10 * time.Second
+	initialCheckpointStep = time.Second
+)
+
+// checkpointStepper splits the range between two global resolved ts into
+// steps, so the checkpoint advances with the batches flushed by the sink
+// instead of jumping to the global resolved ts. The length of a step adapts to
+// the throughput of the previous steps, so that a step holds about txns
+// transactions. The range isn't split if the stepper is nil.
+type checkpointStepper struct {
+	txns int
+	// step is the physical length of the next step.
+	step time.Duration
+}
+
+func newCheckpointStepper(txns int) *checkpointStepper {
+	if txns <= 0 {
+		return nil
+	}
+	return &checkpointStepper{txns: txns, step: initialCheckpointStep}
+}
+
+// next returns the end of the step started at from, it's never beyond to.
+func (s *checkpointStepper) next(from, to uint64) uint64 {
+	// the first global resolved ts is forwarded directly, since the range
+	// starts from the zero ts
+	if s == nil || from == 0 || from >= to {
+		return to
+	}
+	ts := oracle.ComposeTS(oracle.ExtractPhysical(from)+int64(s.step/time.Millisecond), 0)
+	if ts <= from || ts >= to {
+		return to
+	}
+	return ts
+}
+
+// observe adjusts the length of the next step by the number of the
+// transactions forwarded in the step between from and to.
+func (s *checkpointStepper) observe(txns int, from, to uint64) {
+	if s == nil || from == 0 || to <= from {
+		return
+	}
+	length := time.Duration(oracle.ExtractPhysical(to)-oracle.ExtractPhysical(from)) * time.Millisecond
+	if txns == 0 {
+		s.step *= 2
+	} else {
+		s.step = length * time.Duration(s.txns) / time.Duration(txns)
+	}
+	if s.step < minCheckpointStep {
+		s.step = minCheckpointStep
+	}
+	if s.step > maxCheckpointStep {
+		s.step = maxCheckpointStep
+	}
+}
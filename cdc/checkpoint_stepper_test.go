@@ -0,0 +1,82 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type checkpointStepperSuite struct{}
+
+var _ = check.Suite(&checkpointStepperSuite{})
+
+func stepperTs(ms int64) uint64 {
+	return oracle.ComposeTS(1000000+ms, 0)
+}
+
+func (s *checkpointStepperSuite) TestSteps(c *check.C) {
+	var disabled *checkpointStepper
+	c.Assert(newCheckpointStepper(0), check.IsNil)
+	c.Assert(disabled.next(stepperTs(0), stepperTs(5000)), check.Equals, stepperTs(5000))
+	disabled.observe(10, stepperTs(0), stepperTs(5000))
+
+	stepper := newCheckpointStepper(100)
+	// the first range starting from the zero ts isn't split
+	c.Assert(stepper.next(0, stepperTs(5000)), check.Equals, stepperTs(5000))
+	c.Assert(stepper.next(stepperTs(0), stepperTs(5000)), check.Equals, stepperTs(1000))
+	c.Assert(stepper.next(stepperTs(4500), stepperTs(5000)), check.Equals, stepperTs(5000))
+	c.Assert(stepper.next(stepperTs(5000), stepperTs(4000)), check.Equals, stepperTs(4000))
+
+	// 400 txns in a second, the next step holds about 100 txns
+	stepper.observe(400, stepperTs(0), stepperTs(1000))
+	c.Assert(stepper.step, check.Equals, 250*time.Millisecond)
+	c.Assert(stepper.next(stepperTs(1000), stepperTs(5000)), check.Equals, stepperTs(1250))
+	// the step doubles without txns
+	stepper.observe(0, stepperTs(1000), stepperTs(1250))
+	c.Assert(stepper.step, check.Equals, 500*time.Millisecond)
+
+	stepper.observe(100000, stepperTs(0), stepperTs(1000))
+	c.Assert(stepper.step, check.Equals, minCheckpointStep)
+	stepper.observe(1, stepperTs(0), stepperTs(1000))
+	c.Assert(stepper.step, check.Equals, maxCheckpointStep)
+}
+
+func (s *checkpointStepperSuite) TestForwardTables(c *check.C) {
+	input := make(chan model.RawTxn, 5)
+	tc := newTxnChannel(input, 5, func(ts uint64) {})
+	entries := []*model.RawKVEntry{{}}
+	input <- model.RawTxn{Ts: 1, Entries: entries}
+	input <- model.RawTxn{Ts: 2}
+	input <- model.RawTxn{Ts: 3, Entries: entries}
+	input <- model.RawTxn{Ts: 4, Entries: entries}
+	close(input)
+
+	p := &processor{
+		tables:       map[int64]*tableInfo{1: {id: 1, inputChan: tc}},
+		resolvedTxns: make(chan model.RawTxn, 5),
+	}
+	// the txns without entries aren't counted
+	n, err := p.forwardTables(context.Background(), 3)
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 2)
+	c.Assert(p.resolvedTxns, check.HasLen, 3)
+	n, err = p.forwardTables(context.Background(), 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
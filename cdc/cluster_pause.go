@@ -0,0 +1,122 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+// AdminJobSkipped is the status of a changefeed paused by pausing the cluster
+// but not resumed by resuming the cluster, since it's removed or resumed by
+// users in between.
+const AdminJobSkipped = "skipped"
+
+// ClusterAdminResult is the result of pausing or resuming the cluster.
+type ClusterAdminResult struct {
+	Pause       *model.ClusterPause `json:"pause"`
+	Changefeeds []*AdminJobResult   `json:"changefeeds"`
+}
+
+// PauseCluster stops all the running changefeeds of the cluster. They are
+// recorded in etcd before stopped, so ResumeCluster resumes exactly them even
+// if the owner changes in between, and the changefeeds stopped before are left
+// stopped. It fails with ErrClusterPaused if the cluster is already paused.
+func (o *ownerImpl) PauseCluster(ctx context.Context) (*ClusterAdminResult, error) {
+	if !o.manager.IsOwner() {
+		return nil, errors.Trace(concurrency.ErrElectionNotLeader)
+	}
+	_, details, err := o.etcdClient.GetChangeFeeds(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ids := make([]model.ChangeFeedID, 0, len(details))
+	for id, kv := range details {
+		info := &model.ChangeFeedInfo{}
+		if err := info.Unmarshal(kv.Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if info.AdminJobType.IsStopState() {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	pause := &model.ClusterPause{PausedAt: time.Now(), Changefeeds: ids}
+	if err := o.etcdClient.CreateClusterPause(ctx, pause); err != nil {
+		return nil, errors.Trace(err)
+	}
+	jobs := make([]model.AdminJob, 0, len(ids))
+	for _, id := range ids {
+		jobs = append(jobs, model.AdminJob{CfID: id, Type: model.AdminStop})
+	}
+	results, err := o.EnqueueJobs(jobs, false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &ClusterAdminResult{Pause: pause, Changefeeds: results}, nil
+}
+
+// ResumeCluster resumes the changefeeds stopped by PauseCluster, the ones
+// removed or resumed by users in between are skipped. It fails with
+// ErrClusterNotPaused if the cluster isn't paused.
+func (o *ownerImpl) ResumeCluster(ctx context.Context) (*ClusterAdminResult, error) {
+	if !o.manager.IsOwner() {
+		return nil, errors.Trace(concurrency.ErrElectionNotLeader)
+	}
+	pause, err := o.etcdClient.GetClusterPause(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if pause == nil {
+		return nil, errors.Trace(model.ErrClusterNotPaused)
+	}
+
+	results := make([]*AdminJobResult, 0, len(pause.Changefeeds))
+	jobs := make([]model.AdminJob, 0, len(pause.Changefeeds))
+	resumed := make([]int, 0, len(pause.Changefeeds))
+	for _, id := range pause.Changefeeds {
+		info, err := o.etcdClient.GetChangeFeedInfo(ctx, id)
+		if err != nil && errors.Cause(err) != model.ErrChangeFeedNotExists {
+			return nil, errors.Trace(err)
+		}
+		switch {
+		case err != nil:
+			results = append(results, &AdminJobResult{CfID: id, Status: AdminJobSkipped, Message: "changefeed is removed"})
+		case info.AdminJobType != model.AdminStop:
+			results = append(results, &AdminJobResult{CfID: id, Status: AdminJobSkipped, Message: "changefeed is not stopped"})
+		default:
+			resumed = append(resumed, len(results))
+			results = append(results, nil)
+			jobs = append(jobs, model.AdminJob{CfID: id, Type: model.AdminResume})
+		}
+	}
+	jobResults, err := o.EnqueueJobs(jobs, false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for i, idx := range resumed {
+		results[idx] = jobResults[i]
+	}
+	if err := o.etcdClient.DeleteClusterPause(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &ClusterAdminResult{Pause: pause, Changefeeds: results}, nil
+}
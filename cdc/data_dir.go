@@ -0,0 +1,166 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// dataDirProbeSize is the size of the file written to probe a data dir.
+	dataDirProbeSize = 4 << 20
+	// dataDirMinFreeBytes and dataDirMinFreeRatio are the thresholds of the
+	// free space of the data dir, a warning is logged below either of them.
+	dataDirMinFreeBytes = 10 << 30
+	dataDirMinFreeRatio = 0.1
+	// dataDirCheckInterval is the interval of checking the free space.
+	dataDirCheckInterval = time.Minute
+)
+
+var (
+	fProbeDataDir = probeDataDir
+	fDiskUsage    = diskUsage
+)
+
+// probeDataDir writes and syncs a file in the dir, and returns how long it
+// takes. The dir is created if it doesn't exist.
+func probeDataDir(dir string) (time.Duration, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, errors.Trace(err)
+	}
+	f, err := ioutil.TempFile(dir, "ticdc-probe-")
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	start := time.Now()
+	if _, err := f.Write(make([]byte, dataDirProbeSize)); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return time.Since(start), nil
+}
+
+// diskUsage returns the free and the total bytes of the file system of the dir.
+func diskUsage(dir string) (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
+
+func lowSpace(free, total uint64) bool {
+	return free < dataDirMinFreeBytes || float64(free) < float64(total)*dataDirMinFreeRatio
+}
+
+type dataDirCandidate struct {
+	dir     string
+	elapsed time.Duration
+	free    uint64
+	low     bool
+}
+
+// selectDataDir probes the candidate data dirs and returns the fastest one,
+// the dirs low on space are only used if all of them are. The dirs failing the
+// probe are skipped, it's an error if all of them fail. A single dir is used
+// as it is.
+func selectDataDir(dirs []string) (string, error) {
+	if len(dirs) <= 1 {
+		if len(dirs) == 0 {
+			return "", nil
+		}
+		return dirs[0], nil
+	}
+	candidates := make([]*dataDirCandidate, 0, len(dirs))
+	for _, dir := range dirs {
+		elapsed, err := fProbeDataDir(dir)
+		if err != nil {
+			log.Warn("skip the data dir failing the probe", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		free, total, err := fDiskUsage(dir)
+		if err != nil {
+			log.Warn("skip the data dir whose free space is unknown", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		candidates = append(candidates, &dataDirCandidate{
+			dir:     dir,
+			elapsed: elapsed,
+			free:    free,
+			low:     lowSpace(free, total),
+		})
+	}
+	if len(candidates) == 0 {
+		return "", errors.Errorf("no data dir is usable in %v", dirs)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].low != candidates[j].low {
+			return !candidates[i].low
+		}
+		return candidates[i].elapsed < candidates[j].elapsed
+	})
+	for i, c := range candidates {
+		log.Info("data dir probed", zap.Int("rank", i+1), zap.String("dir", c.dir),
+			zap.Duration("elapsed", c.elapsed), zap.Uint64("free", c.free), zap.Bool("low-space", c.low))
+	}
+	best := candidates[0]
+	if best.low {
+		log.Warn("all the data dirs are low on space", zap.String("dir", best.dir), zap.Uint64("free", best.free))
+	}
+	return best.dir, nil
+}
+
+// checkDataDirSpace logs a warning periodically while the free space of the
+// data dir is below the thresholds, until ctx is done.
+func checkDataDirSpace(ctx context.Context, dir string) {
+	ticker := time.NewTicker(dataDirCheckInterval)
+	defer ticker.Stop()
+	for {
+		free, total, err := fDiskUsage(dir)
+		if err != nil {
+			log.Warn("get the free space of the data dir failed", zap.String("dir", dir), zap.Error(err))
+		} else if lowSpace(free, total) {
+			log.Warn("the data dir is low on space, the sorters may fail to spill",
+				zap.String("dir", dir), zap.Uint64("free", free), zap.Uint64("total", total))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dataBaseDir returns the data dir, or the dir in the temporary directory of
+// the system if it's not set.
+func dataBaseDir() string {
+	if dataDir == "" {
+		return filepath.Join(os.TempDir(), "ticdc")
+	}
+	return dataDir
+}
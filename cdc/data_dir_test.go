@@ -0,0 +1,83 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type dataDirSuite struct{}
+
+var _ = check.Suite(&dataDirSuite{})
+
+func (s *dataDirSuite) TestProbeDataDir(c *check.C) {
+	dir := filepath.Join(c.MkDir(), "data")
+	_, err := probeDataDir(dir)
+	c.Assert(err, check.IsNil)
+	// the probe file is removed
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+
+	free, total, err := diskUsage(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(free <= total, check.IsTrue)
+}
+
+func (s *dataDirSuite) TestSelectDataDir(c *check.C) {
+	defer func() {
+		fProbeDataDir, fDiskUsage = probeDataDir, diskUsage
+	}()
+	type disk struct {
+		elapsed time.Duration
+		free    uint64
+		err     error
+	}
+	disks := map[string]disk{
+		"/hdd":    {elapsed: 100 * time.Millisecond, free: 500 << 30},
+		"/ssd":    {elapsed: 10 * time.Millisecond, free: 200 << 30},
+		"/nvme":   {elapsed: time.Millisecond, free: 1 << 30},
+		"/broken": {err: errors.New("read-only file system")},
+	}
+	fProbeDataDir = func(dir string) (time.Duration, error) {
+		return disks[dir].elapsed, disks[dir].err
+	}
+	fDiskUsage = func(dir string) (uint64, uint64, error) {
+		return disks[dir].free, 1 << 40, nil
+	}
+
+	dir, err := selectDataDir(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(dir, check.Equals, "")
+	// a single dir is used as it is
+	dir, err = selectDataDir([]string{"/broken"})
+	c.Assert(err, check.IsNil)
+	c.Assert(dir, check.Equals, "/broken")
+
+	// the fastest dir with enough free space wins
+	dir, err = selectDataDir([]string{"/hdd", "/broken", "/nvme", "/ssd"})
+	c.Assert(err, check.IsNil)
+	c.Assert(dir, check.Equals, "/ssd")
+	// the dirs low on space are used if all of them are
+	dir, err = selectDataDir([]string{"/broken", "/nvme"})
+	c.Assert(err, check.IsNil)
+	c.Assert(dir, check.Equals, "/nvme")
+	_, err = selectDataDir([]string{"/broken", "/broken"})
+	c.Assert(err, check.ErrorMatches, "no data dir is usable.*")
+}
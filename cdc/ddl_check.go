@@ -0,0 +1,166 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+)
+
+// the status of a DDL job checked by CheckDDL
+const (
+	// the DDL is replicated to the downstream
+	DDLStatusReplicated = "replicated"
+	// the DDL is ignored by the ignore-txn-commit-ts config
+	DDLStatusIgnored = "ignored"
+	// the DDL is filtered out by the filter rules
+	DDLStatusFiltered = "filtered"
+	// the DDL job is cancelled or rolled back, it's skipped by CDC
+	DDLStatusSkipped = "skipped"
+	// the DDL can't be replicated correctly
+	DDLStatusUnsupported = "unsupported"
+)
+
+// DDLCheckResult is the result of checking an upstream DDL job.
+type DDLCheckResult struct {
+	JobID  int64  `json:"job-id"`
+	Ts     uint64 `json:"ts"`
+	Type   string `json:"type"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Query  string `json:"query"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// CheckDDL replays the history DDL jobs of the upstream cluster finished after
+// sinceTs, and reports how each of them would be handled by a changefeed with
+// the config. No changefeed is created.
+func CheckDDL(pdAddr string, sinceTs uint64, cfg *model.ReplicaConfig) ([]*DDLCheckResult, error) {
+	tiStore, err := createTiStore(pdAddr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer tiStore.Close()
+	jobs, err := kv.LoadHistoryDDLJobs(tiStore)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return checkDDLJobs(jobs, sinceTs, cfg)
+}
+
+func checkDDLJobs(jobs []*timodel.Job, sinceTs uint64, cfg *model.ReplicaConfig) ([]*DDLCheckResult, error) {
+	filter, err := newTxnFilter(cfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// NewStorage sorts the jobs by the finished ts
+	schemaStorage, err := schema.NewStorage(jobs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	unsupportedPolicy := cfg.DDL.UnsupportedPolicy()
+	schemaStorage.SetSkipUnsupportedDDL(unsupportedPolicy == model.DDLUnsupportedSkip)
+	if err := schemaStorage.HandlePreviousDDLJobIfNeed(sinceTs); err != nil {
+		return nil, errors.Annotatef(err, "build schema at ts %d", sinceTs)
+	}
+
+	var results []*DDLCheckResult
+	for _, job := range jobs {
+		if job.BinlogInfo.FinishedTS <= sinceTs {
+			continue
+		}
+		result := &DDLCheckResult{
+			JobID: job.ID,
+			Ts:    job.BinlogInfo.FinishedTS,
+			Type:  job.Type.String(),
+			Query: job.Query,
+		}
+		results = append(results, result)
+
+		if !job.IsSynced() && !job.IsDone() {
+			result.Status = DDLStatusSkipped
+			result.Reason = "job is " + job.State.String()
+			continue
+		}
+		if !schema.IsDDLSupported(job.Type) {
+			if unsupportedPolicy == model.DDLUnsupportedSkip {
+				result.Status = DDLStatusIgnored
+			} else {
+				result.Status = DDLStatusUnsupported
+			}
+			result.Reason = fmt.Sprintf("type %d is unsupported, the ddl unsupported policy is %s", job.Type, unsupportedPolicy)
+			continue
+		}
+		result.Schema, result.Table, _, err = schemaStorage.HandleDDL(job)
+		if err != nil {
+			result.Status = DDLStatusUnsupported
+			result.Reason = errors.Cause(err).Error()
+			continue
+		}
+
+		txn := &model.Txn{Ts: job.BinlogInfo.FinishedTS}
+		switch {
+		case filter.ShouldIgnoreTxn(txn):
+			result.Status = DDLStatusIgnored
+			result.Reason = "commit ts is in ignore-txn-commit-ts"
+		case filter.ShouldIgnoreTable(result.Schema, result.Table):
+			result.Status = DDLStatusFiltered
+			result.Reason = "table is filtered out by the filter rules"
+		case schema.IsDDLInternal(job.Type):
+			result.Status = DDLStatusIgnored
+			result.Reason = "type is internal to the upstream"
+		case filter.ShouldSkipDDL(job.Type):
+			result.Status = DDLStatusIgnored
+			result.Reason = "type is in ddl skip-types"
+		default:
+			switch kind, policy := cfg.DDL.ObjectPolicy(job.Type); policy {
+			case model.DDLPolicySkip:
+				result.Status = DDLStatusIgnored
+				result.Reason = fmt.Sprintf("%s is skipped by the ddl %s policy", kind, kind)
+			case model.DDLPolicyError:
+				result.Status = DDLStatusUnsupported
+				result.Reason = fmt.Sprintf("%s stops the changefeed by the ddl %s policy", kind, kind)
+			default:
+				result.Status = DDLStatusReplicated
+			}
+		}
+	}
+	return results, nil
+}
+
+// SummarizeDDLCheck counts the results by status, e.g. "replicated: 3, unsupported: 1".
+func SummarizeDDLCheck(results []*DDLCheckResult) string {
+	statuses := []string{DDLStatusReplicated, DDLStatusIgnored, DDLStatusFiltered, DDLStatusSkipped, DDLStatusUnsupported}
+	counts := make(map[string]int, len(statuses))
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	parts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", status, counts[status]))
+		}
+	}
+	if len(parts) == 0 {
+		return "no DDL"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb-tools/pkg/filter"
+)
+
+type ddlCheckSuite struct{}
+
+var _ = check.Suite(&ddlCheckSuite{})
+
+func (s *ddlCheckSuite) TestCheckDDLJobs(c *check.C) {
+	testDB := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	logDB := &timodel.DBInfo{ID: 2, Name: timodel.NewCIStr("log")}
+	t1 := &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("t1")}
+	t2 := &timodel.TableInfo{ID: 11, Name: timodel.NewCIStr("t2"), Partition: &timodel.PartitionInfo{Enable: true}}
+	t3 := &timodel.TableInfo{ID: 12, Name: timodel.NewCIStr("t3")}
+	newJob := func(id int64, tp timodel.ActionType, schemaID int64, ts uint64, query string) *timodel.Job {
+		return &timodel.Job{
+			ID:         id,
+			State:      timodel.JobStateSynced,
+			SchemaID:   schemaID,
+			Type:       tp,
+			Query:      query,
+			BinlogInfo: &timodel.HistoryInfo{SchemaVersion: id, FinishedTS: ts},
+		}
+	}
+
+	jobs := []*timodel.Job{
+		newJob(1, timodel.ActionCreateSchema, 1, 100, "create database test"),
+		newJob(2, timodel.ActionCreateSchema, 2, 101, "create database log"),
+		newJob(3, timodel.ActionCreateTable, 1, 110, "create table t1"),
+		newJob(4, timodel.ActionCreateTable, 1, 111, "create table t2 partition by hash(id)"),
+		newJob(5, timodel.ActionAddColumn, 1, 112, "alter table t1 add column a int"),
+		newJob(6, timodel.ActionCreateTable, 2, 113, "create table log.t3"),
+		newJob(7, timodel.ActionAddColumn, 1, 114, "alter table t1 add column b int"),
+		newJob(8, timodel.ActionAddIndex, 1, 115, "alter table t1 add index i(b)"),
+		newJob(9, timodel.ActionDropColumn, 1, 116, ""),
+	}
+	jobs[0].BinlogInfo.DBInfo = testDB
+	jobs[1].BinlogInfo.DBInfo = logDB
+	jobs[2].TableID, jobs[2].BinlogInfo.TableInfo = t1.ID, t1
+	jobs[3].TableID, jobs[3].BinlogInfo.TableInfo = t2.ID, t2
+	jobs[4].TableID, jobs[4].BinlogInfo.TableInfo = t1.ID, t1
+	jobs[5].TableID, jobs[5].BinlogInfo.TableInfo = t3.ID, t3
+	jobs[6].TableID, jobs[6].BinlogInfo.TableInfo = t1.ID, t1
+	jobs[7].TableID, jobs[7].BinlogInfo.TableInfo = t1.ID, t1
+	jobs[7].State = timodel.JobStateRollbackDone
+	jobs[8].TableID, jobs[8].BinlogInfo.TableInfo = t1.ID, t1
+
+	results, err := checkDDLJobs(jobs, 101, &model.ReplicaConfig{
+		FilterRules:       &filter.Rules{IgnoreDBs: []string{"log"}},
+		IgnoreTxnCommitTs: []uint64{114},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 7)
+	expected := []struct {
+		jobID  int64
+		status string
+	}{
+		{3, DDLStatusReplicated},
+		{4, DDLStatusReplicated},
+		{5, DDLStatusReplicated},
+		{6, DDLStatusFiltered},
+		{7, DDLStatusIgnored},
+		{8, DDLStatusSkipped},
+		{9, DDLStatusUnsupported},
+	}
+	for i, e := range expected {
+		c.Assert(results[i].JobID, check.Equals, e.jobID)
+		c.Assert(results[i].Status, check.Equals, e.status, check.Commentf("job %d: %s", e.jobID, results[i].Reason))
+	}
+	c.Assert(results[0].Schema, check.Equals, "test")
+	c.Assert(results[0].Table, check.Equals, "t1")
+	c.Assert(results[1].Table, check.Equals, "t2")
+	c.Assert(results[5].Reason, check.Equals, "job is rollback done")
+	c.Assert(results[6].Reason, check.Matches, ".*ddl job sql miss.*")
+	c.Assert(SummarizeDDLCheck(results), check.Equals,
+		"replicated: 3, ignored: 1, filtered: 1, skipped: 1, unsupported: 1")
+	c.Assert(SummarizeDDLCheck(nil), check.Equals, "no DDL")
+}
+
+func (s *ddlCheckSuite) TestCheckObjectDDLJobs(c *check.C) {
+	testDB := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	view := &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("v"), View: &timodel.ViewInfo{}}
+	seq := &timodel.TableInfo{ID: 11, Name: timodel.NewCIStr("s"), Sequence: &timodel.SequenceInfo{}}
+	newJob := func(id int64, tp timodel.ActionType, table *timodel.TableInfo) *timodel.Job {
+		job := &timodel.Job{
+			ID:         id,
+			State:      timodel.JobStateSynced,
+			SchemaID:   1,
+			Type:       tp,
+			Query:      tp.String(),
+			BinlogInfo: &timodel.HistoryInfo{SchemaVersion: id, FinishedTS: uint64(100 + id), TableInfo: table},
+		}
+		if table != nil {
+			job.TableID = table.ID
+		}
+		return job
+	}
+	jobs := []*timodel.Job{
+		newJob(1, timodel.ActionCreateSchema, nil),
+		newJob(2, timodel.ActionCreateView, view),
+		newJob(3, timodel.ActionCreateSequence, seq),
+		newJob(4, timodel.ActionAlterSequence, seq),
+		newJob(5, timodel.ActionDropSequence, seq),
+		newJob(6, timodel.ActionDropView, view),
+	}
+	jobs[0].BinlogInfo.DBInfo = testDB
+
+	assertStatuses := func(cfg model.DDLConfig, statuses ...string) {
+		results, err := checkDDLJobs(jobs, 101, &model.ReplicaConfig{DDL: cfg})
+		c.Assert(err, check.IsNil)
+		c.Assert(results, check.HasLen, len(statuses))
+		for i, status := range statuses {
+			c.Assert(results[i].Status, check.Equals, status, check.Commentf("job %d: %s", results[i].JobID, results[i].Reason))
+		}
+	}
+	// the views are replicated and the sequences stop the changefeed by default
+	assertStatuses(model.DDLConfig{}, DDLStatusReplicated, DDLStatusUnsupported, DDLStatusUnsupported,
+		DDLStatusUnsupported, DDLStatusReplicated)
+	assertStatuses(model.DDLConfig{View: model.DDLPolicyError, Sequence: model.DDLPolicySkip}, DDLStatusUnsupported,
+		DDLStatusIgnored, DDLStatusIgnored, DDLStatusIgnored, DDLStatusUnsupported)
+}
+
+func (s *ddlCheckSuite) TestCheckUnsupportedDDLJobs(c *check.C) {
+	testDB := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	t1 := &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("t1")}
+	jobs := []*timodel.Job{
+		{ID: 1, Type: timodel.ActionCreateSchema, SchemaID: 1, Query: "create database test",
+			BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 1, FinishedTS: 100, DBInfo: testDB}},
+		{ID: 2, Type: timodel.ActionCreateTable, SchemaID: 1, TableID: 10, Query: "create table t1",
+			BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 2, FinishedTS: 101, TableInfo: t1}},
+		// a type introduced by the newer TiDB
+		{ID: 3, Type: timodel.ActionType(200), SchemaID: 1, TableID: 10, Query: "alter table t1 cache",
+			BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 3, FinishedTS: 110, TableInfo: t1}},
+	}
+	for _, job := range jobs {
+		job.State = timodel.JobStateSynced
+	}
+
+	results, err := checkDDLJobs(jobs, 101, &model.ReplicaConfig{})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 1)
+	c.Assert(results[0].Status, check.Equals, DDLStatusUnsupported)
+	c.Assert(results[0].Reason, check.Equals, "type 200 is unsupported, the ddl unsupported policy is pause")
+
+	results, err = checkDDLJobs(jobs, 101, &model.ReplicaConfig{DDL: model.DDLConfig{Unsupported: model.DDLUnsupportedSkip}})
+	c.Assert(err, check.IsNil)
+	c.Assert(results[0].Status, check.Equals, DDLStatusIgnored)
+
+	// the schema is built across the unsupported DDL only if it's skipped
+	_, err = checkDDLJobs(jobs, 110, &model.ReplicaConfig{})
+	c.Assert(err, check.ErrorMatches, ".*unsupported ddl type.*")
+	results, err = checkDDLJobs(jobs, 110, &model.ReplicaConfig{DDL: model.DDLConfig{Unsupported: model.DDLUnsupportedSkip}})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 0)
+}
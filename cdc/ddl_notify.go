@@ -0,0 +1,144 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"go.uber.org/zap"
+)
+
+const (
+	ddlNotifyTimeout    = 10 * time.Second
+	ddlNotifyMaxRetries = 3
+	// the notifications pending in a notifier, the new notifications are
+	// dropped if the webhook can't catch up.
+	ddlNotifyQueueSize = 128
+)
+
+// ddlNotification is the body POSTed to the webhook of a changefeed after a
+// DDL is replicated.
+type ddlNotification struct {
+	Changefeed string `json:"changefeed"`
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Type       string `json:"type"`
+	Query      string `json:"query"`
+	FinishedTs uint64 `json:"finished-ts"`
+}
+
+// ddlNotifier notifies the webhook of the replicated DDLs of a changefeed in
+// the background, so a slow webhook doesn't block the owner. The DDLs are
+// notified in order.
+type ddlNotifier struct {
+	changefeedID string
+	url          string
+	client       *http.Client
+
+	queue  chan *ddlNotification
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDDLNotifier(changefeedID, url string) *ddlNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &ddlNotifier{
+		changefeedID: changefeedID,
+		url:          url,
+		client:       &http.Client{Timeout: ddlNotifyTimeout},
+		queue:        make(chan *ddlNotification, ddlNotifyQueueSize),
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+	go n.run(ctx)
+	return n
+}
+
+// notify queues the notification of the DDL.
+func (n *ddlNotifier) notify(ddl *model.DDL) {
+	notification := &ddlNotification{
+		Changefeed: n.changefeedID,
+		Schema:     ddl.Database,
+		Table:      ddl.Table,
+		Type:       ddl.Job.Type.String(),
+		Query:      ddl.Job.Query,
+		FinishedTs: ddl.Job.BinlogInfo.FinishedTS,
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		log.Warn("too many pending DDL notifications, drop it",
+			zap.String("changefeed", n.changefeedID), zap.String("query", ddl.Job.Query))
+	}
+}
+
+func (n *ddlNotifier) run(ctx context.Context) {
+	defer close(n.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			if err := n.post(ctx, notification); err != nil {
+				log.Warn("notify DDL failed", zap.String("changefeed", n.changefeedID),
+					zap.String("url", n.url), zap.Uint64("finished-ts", notification.FinishedTs), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (n *ddlNotifier) post(ctx context.Context, notification *ddlNotification) error {
+	return postWebhook(ctx, n.client, n.url, notification)
+}
+
+// postWebhook POSTs the value in JSON to the webhook, it's retried on failures.
+func postWebhook(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return retry.Run(func() error {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			data, _ := ioutil.ReadAll(resp.Body)
+			return errors.Errorf("webhook responds %d: %s", resp.StatusCode, data)
+		}
+		return nil
+	}, ddlNotifyMaxRetries)
+}
+
+// close stops the notifier, the pending notifications are dropped.
+func (n *ddlNotifier) close() {
+	n.cancel()
+	<-n.done
+}
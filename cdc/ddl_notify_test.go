@@ -0,0 +1,75 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type ddlNotifySuite struct{}
+
+var _ = check.Suite(&ddlNotifySuite{})
+
+func (s *ddlNotifySuite) TestNotify(c *check.C) {
+	received := make(chan *ddlNotification, 2)
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.Method, check.Equals, http.MethodPost)
+		c.Assert(req.Header.Get("Content-Type"), check.Equals, "application/json")
+		// the first attempt fails and is retried
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		notification := new(ddlNotification)
+		c.Assert(json.NewDecoder(req.Body).Decode(notification), check.IsNil)
+		received <- notification
+	}))
+	defer server.Close()
+
+	notifier := newDDLNotifier("cf", server.URL)
+	defer notifier.close()
+	for i, query := range []string{"create table t1 (id int)", "alter table t1 add column a int"} {
+		notifier.notify(&model.DDL{
+			Database: "test",
+			Table:    "t1",
+			Job: &timodel.Job{
+				Type:       timodel.ActionCreateTable,
+				Query:      query,
+				BinlogInfo: &timodel.HistoryInfo{FinishedTS: uint64(100 + i)},
+			},
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case notification := <-received:
+			c.Assert(notification.Changefeed, check.Equals, "cf")
+			c.Assert(notification.Schema, check.Equals, "test")
+			c.Assert(notification.Table, check.Equals, "t1")
+			c.Assert(notification.Type, check.Equals, "create table")
+			c.Assert(notification.FinishedTs, check.Equals, uint64(100+i))
+		case <-time.After(10 * time.Second):
+			c.Fatal("notification not received")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// defaultDedupWindowSize is the max number of the recent row events remembered
+// by the dedup window of a table.
+const defaultDedupWindowSize = 64 * 1024
+
+type dedupKey struct {
+	ts  uint64
+	op  model.OpType
+	key string
+}
+
+// dedupWindow drops the row events redelivered by the puller. When a region
+// is retried, TiKV sends the events after the checkpoint of the region again,
+// so the same event may be collected twice in a resolved interval. An event is
+// identified by its commit ts, operation and key. Only the most recent events
+// are remembered to bound the memory, the older ones are evicted in the order
+// they are seen.
+type dedupWindow struct {
+	maxSize int
+	seen    map[dedupKey]struct{}
+	// the remembered events in the order they are seen, head is the oldest.
+	queue []dedupKey
+	head  int
+}
+
+func newDedupWindow(maxSize int) *dedupWindow {
+	return &dedupWindow{
+		maxSize: maxSize,
+		seen:    make(map[dedupKey]struct{}),
+	}
+}
+
+// filter removes the duplicated entries from the txn and returns the number of
+// the removed entries. The returned bool is false if all entries of a non-empty
+// txn are removed, in which case the txn should be dropped.
+func (w *dedupWindow) filter(txn model.RawTxn) (model.RawTxn, int, bool) {
+	if len(txn.Entries) == 0 {
+		return txn, 0, true
+	}
+	entries := txn.Entries[:0:0]
+	dups := 0
+	for _, entry := range txn.Entries {
+		k := dedupKey{ts: entry.Ts, op: entry.OpType, key: string(entry.Key)}
+		if _, ok := w.seen[k]; ok {
+			dups++
+			continue
+		}
+		w.add(k)
+		entries = append(entries, entry)
+	}
+	if dups == 0 {
+		return txn, 0, true
+	}
+	txn.Entries = entries
+	return txn, dups, len(entries) > 0
+}
+
+func (w *dedupWindow) add(k dedupKey) {
+	w.seen[k] = struct{}{}
+	w.queue = append(w.queue, k)
+	for len(w.queue)-w.head > w.maxSize {
+		delete(w.seen, w.queue[w.head])
+		w.queue[w.head] = dedupKey{}
+		w.head++
+	}
+	// compact the queue once the evicted half dominates it
+	if w.head > w.maxSize {
+		w.queue = append(w.queue[:0:0], w.queue[w.head:]...)
+		w.head = 0
+	}
+}
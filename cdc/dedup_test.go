@@ -0,0 +1,81 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type dedupSuite struct{}
+
+var _ = check.Suite(&dedupSuite{})
+
+func newRawTxn(ts uint64, keys ...string) model.RawTxn {
+	txn := model.RawTxn{Ts: ts}
+	for _, key := range keys {
+		txn.Entries = append(txn.Entries, &model.RawKVEntry{
+			OpType: model.OpTypePut,
+			Key:    []byte(key),
+			Value:  []byte("v"),
+			Ts:     ts,
+		})
+	}
+	return txn
+}
+
+func (s *dedupSuite) TestFilter(c *check.C) {
+	w := newDedupWindow(3)
+
+	txn, dups, ok := w.filter(newRawTxn(1, "a", "b", "a"))
+	c.Assert(ok, check.IsTrue)
+	c.Assert(dups, check.Equals, 1)
+	c.Assert(txn.Entries, check.HasLen, 2)
+
+	// a redelivered txn is dropped
+	_, dups, ok = w.filter(newRawTxn(1, "a", "b"))
+	c.Assert(ok, check.IsFalse)
+	c.Assert(dups, check.Equals, 2)
+
+	// the same key with another commit ts or operation is not a duplicate
+	txn, dups, ok = w.filter(newRawTxn(2, "a"))
+	c.Assert(ok, check.IsTrue)
+	c.Assert(dups, check.Equals, 0)
+	c.Assert(txn.Entries, check.HasLen, 1)
+	del := newRawTxn(2, "a")
+	del.Entries[0].OpType = model.OpTypeDelete
+	_, dups, ok = w.filter(del)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(dups, check.Equals, 0)
+
+	// resolved txns pass through
+	_, dups, ok = w.filter(model.RawTxn{Ts: 3})
+	c.Assert(ok, check.IsTrue)
+	c.Assert(dups, check.Equals, 0)
+}
+
+func (s *dedupSuite) TestEvict(c *check.C) {
+	w := newDedupWindow(2)
+	for i := 0; i < 10; i++ {
+		_, _, ok := w.filter(newRawTxn(uint64(i), "a"))
+		c.Assert(ok, check.IsTrue)
+		c.Assert(len(w.seen), check.LessEqual, 2)
+		c.Assert(len(w.queue), check.LessEqual, 5)
+	}
+	// the oldest events are evicted
+	_, dups, _ := w.filter(newRawTxn(0, "a"))
+	c.Assert(dups, check.Equals, 0)
+	_, dups, _ = w.filter(newRawTxn(9, "a"))
+	c.Assert(dups, check.Equals, 1)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// drainCheckInterval is the interval a draining capture checks whether its
+// tables have been handed off.
+const drainCheckInterval = time.Second
+
+// schedulableCaptures returns the captures the tables can be dispatched to,
+// and the IDs of the draining captures. It's called in run with the lock held.
+func (o *ownerImpl) schedulableCaptures() (map[string]*model.CaptureInfo, map[string]struct{}) {
+	captures := make(map[string]*model.CaptureInfo, len(o.captures))
+	draining := make(map[string]struct{})
+	for id, info := range o.captures {
+		if info.Draining {
+			draining[id] = struct{}{}
+			continue
+		}
+		captures[id] = info
+	}
+	return captures, draining
+}
+
+// drainTables plans the moves of the tables in the draining captures, each
+// table is moved to the schedulable capture with the least tables and room
+// for it. The moves are started with the planned moves of a rebalance, the
+// moves planned by the call are returned for the caller to log, as a dry run
+// plans them too.
+func (c *changeFeed) drainTables(draining map[string]struct{}, captures map[string]*model.CaptureInfo) []*plannedMove {
+	if len(draining) == 0 || len(captures) == 0 {
+		return nil
+	}
+	planned := make(map[uint64]struct{}, len(c.plannedMoves))
+	for _, move := range c.plannedMoves {
+		planned[move.tableID] = struct{}{}
+	}
+	counts := make(map[string]int, len(captures))
+	ids := make([]string, 0, len(captures))
+	for id := range captures {
+		ids = append(ids, id)
+		if status, ok := c.processorInfos[id]; ok {
+			counts[id] = len(status.TableInfos)
+		}
+	}
+	sort.Strings(ids)
+
+	var moves []*plannedMove
+	for source := range draining {
+		status, ok := c.processorInfos[source]
+		if !ok {
+			continue
+		}
+		for _, table := range status.TableInfos {
+			if _, ok := planned[table.ID]; ok {
+				continue
+			}
+			if _, ok := c.movingTables[table.ID]; ok {
+				continue
+			}
+			target := ""
+			for _, id := range ids {
+				if c.hasRoom(id) && (target == "" || counts[id] < counts[target]) {
+					target = id
+				}
+			}
+			if target == "" {
+				return moves
+			}
+			counts[target]++
+			c.takeRoom(target)
+			planned[table.ID] = struct{}{}
+			move := &plannedMove{tableID: table.ID, source: source, target: target}
+			c.plannedMoves = append(c.plannedMoves, move)
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// Drain hands off the tables of the capture to the other captures before it
+// shuts down. The capture is marked draining in etcd, so the owner dispatches
+// no table to it and moves its tables away. Drain returns after the tables
+// are removed from all the tasks of the capture and the processors confirm
+// the removals with the checkpoints flushed by the sinks.
+func (c *Capture) Drain(ctx context.Context) error {
+	c.info.Draining = true
+	if err := c.register(ctx); err != nil {
+		return errors.Annotate(err, "mark capture draining")
+	}
+	log.Info("capture is draining", zap.String("capture-id", c.info.ID))
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for {
+		drained, err := c.drained(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if drained {
+			log.Info("capture is drained", zap.String("capture-id", c.info.ID))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(ctx.Err(), "drain capture")
+		case <-ticker.C:
+		}
+	}
+}
+
+// drained returns whether no table is replicated by the running tasks of the
+// capture and the removals of the tables are confirmed.
+func (c *Capture) drained(ctx context.Context) (bool, error) {
+	_, tasks, err := c.etcdClient.GetAllTaskStatuses(ctx)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	for _, infos := range tasks {
+		status, ok := infos[c.info.ID]
+		if !ok || status.AdminJobType.IsStopState() {
+			continue
+		}
+		if len(status.TableInfos) > 0 || (status.TablePLock != nil && status.TableCLock == nil) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
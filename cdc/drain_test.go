@@ -0,0 +1,91 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+func (s *ownerSuite) TestDrainTables(c *check.C) {
+	owner := &ownerImpl{captures: map[model.CaptureID]*model.CaptureInfo{
+		"capture-1": {ID: "capture-1"},
+		"capture-2": {ID: "capture-2"},
+		"capture-3": {ID: "capture-3", Draining: true},
+	}}
+	captures, draining := owner.schedulableCaptures()
+	c.Assert(captures, check.HasLen, 2)
+	c.Assert(draining, check.DeepEquals, map[string]struct{}{"capture-3": {}})
+
+	cf := &changeFeed{
+		processorInfos: model.ProcessorsInfos{
+			"capture-1": {TableInfos: rebalanceTables(1, 2)},
+			"capture-2": {TableInfos: rebalanceTables(3)},
+			"capture-3": {TableInfos: rebalanceTables(4, 5, 6, 7)},
+		},
+		movingTables: map[uint64]*movingTable{7: {source: "capture-3", target: "capture-1"}},
+	}
+	// the draining capture isn't selected though it has the least tables
+	cf.processorInfos["capture-3"].TableInfos = nil
+	c.Assert(cf.selectCapture(captures), check.Equals, "capture-2")
+	cf.processorInfos["capture-3"].TableInfos = rebalanceTables(4, 5, 6, 7)
+
+	c.Assert(cf.drainTables(draining, captures), check.HasLen, 3)
+	c.Assert(cf.plannedMoves, check.DeepEquals, []*plannedMove{
+		{tableID: 4, source: "capture-3", target: "capture-2"},
+		{tableID: 5, source: "capture-3", target: "capture-1"},
+		{tableID: 6, source: "capture-3", target: "capture-2"},
+	})
+	// the planned tables aren't planned again
+	c.Assert(cf.drainTables(draining, captures), check.HasLen, 0)
+	c.Assert(cf.plannedMoves, check.HasLen, 3)
+}
+
+func (s *ownerSuite) TestCaptureDrain(c *check.C) {
+	ctx := context.Background()
+	capture := &Capture{etcdClient: s.client, info: &model.CaptureInfo{ID: "draining"}}
+	defer capture.Close(ctx)
+	c.Assert(s.client.PutTaskStatus(ctx, "cf-1", "draining", &model.TaskStatus{
+		TableInfos: rebalanceTables(1),
+	}), check.IsNil)
+	// the tasks of the stopped changefeeds are ignored
+	c.Assert(s.client.PutTaskStatus(ctx, "cf-2", "draining", &model.TaskStatus{
+		TableInfos:   rebalanceTables(2),
+		AdminJobType: model.AdminStop,
+	}), check.IsNil)
+
+	cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err := capture.Drain(cctx)
+	c.Assert(err, check.ErrorMatches, ".*drain capture.*")
+	info, err := s.client.GetCaptureInfo(ctx, "draining")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Draining, check.IsTrue)
+
+	// the table is removed but the removal isn't confirmed
+	lock := &model.TableLock{Ts: 1}
+	c.Assert(s.client.PutTaskStatus(ctx, "cf-1", "draining", &model.TaskStatus{TablePLock: lock}), check.IsNil)
+	drained, err := capture.drained(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(drained, check.IsFalse)
+
+	c.Assert(s.client.PutTaskStatus(ctx, "cf-1", "draining", &model.TaskStatus{
+		TablePLock: lock,
+		TableCLock: lock,
+	}), check.IsNil)
+	c.Assert(capture.Drain(ctx), check.IsNil)
+}
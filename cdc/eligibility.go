@@ -0,0 +1,108 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"go.uber.org/zap"
+)
+
+// eligibilityTracker tracks whether the tables have a unique key, so the rows
+// of them are identified correctly in the downstream. A table is evaluated
+// again after a DDL replaces its info.
+type eligibilityTracker struct {
+	tables map[int64]tableEligibility
+}
+
+type tableEligibility struct {
+	info     *schema.TableInfo
+	eligible bool
+	reason   string
+}
+
+func newEligibilityTracker() *eligibilityTracker {
+	return &eligibilityTracker{tables: make(map[int64]tableEligibility)}
+}
+
+// check returns whether the table is eligible, changed is true if the
+// eligibility differs from the last check. A table never checked is taken as
+// eligible.
+func (t *eligibilityTracker) check(info *schema.TableInfo) (eligible bool, changed bool) {
+	last, ok := t.tables[info.ID]
+	if ok && last.info == info {
+		return last.eligible, false
+	}
+	eligible, reason := info.Replicable()
+	t.tables[info.ID] = tableEligibility{info: info, eligible: eligible, reason: reason}
+	return eligible, eligible != (!ok || last.eligible)
+}
+
+// reason returns why the table is ineligible at the last check.
+func (t *eligibilityTracker) reason(id int64) string {
+	return t.tables[id].reason
+}
+
+// checkEligibility evaluates the eligibility of the tables of the DMLs at the
+// ts of the transaction. The DMLs of the ineligible tables are dropped by the
+// skip policy, or the tables are paused by the pause policy when they become
+// ineligible. A paused table resumed by users is replicated anyway.
+func (p *processor) checkEligibility(txn *model.Txn) {
+	dmls := make([]*model.DML, 0, len(txn.DMLs))
+	for _, dml := range txn.DMLs {
+		info, ok := p.schemaStorage.GetTableByName(dml.Database, dml.Table)
+		if !ok {
+			dmls = append(dmls, dml)
+			continue
+		}
+		eligible, changed := p.eligibility.check(info)
+		if changed {
+			p.onEligibilityChanged(dml, info, eligible, txn.Ts)
+		}
+		if !eligible && p.ineligiblePolicy == model.IneligibleTableSkip {
+			continue
+		}
+		dmls = append(dmls, dml)
+	}
+	txn.DMLs = dmls
+}
+
+func (p *processor) onEligibilityChanged(dml *model.DML, info *schema.TableInfo, eligible bool, ts uint64) {
+	event := "lost"
+	if eligible {
+		event = "gained"
+	}
+	tableEligibilityCounter.WithLabelValues(event, p.changefeedID, p.captureID).Inc()
+	log.Warn("the unique key of table is changed", zap.String("changefeed", p.changefeedID), labelsField(p.changefeed.Labels),
+		zap.String("table", dml.TableName()), zap.Int64("tableID", info.ID),
+		zap.String("event", event), zap.String("policy", p.ineligiblePolicy), zap.Uint64("ts", ts))
+	if eligible || p.ineligiblePolicy != model.IneligibleTablePause {
+		return
+	}
+
+	p.pausedMu.Lock()
+	defer p.pausedMu.Unlock()
+	name := dml.TableName()
+	if _, ok := p.pausedTables[name]; ok {
+		return
+	}
+	p.pausedTables[name] = &model.PausedTable{
+		ID:     info.ID,
+		Schema: dml.Database,
+		Table:  dml.Table,
+		Ts:     ts,
+		Error:  p.eligibility.reason(info.ID) + ", the rows can't be identified in the downstream",
+	}
+}
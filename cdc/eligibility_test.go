@@ -0,0 +1,124 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/tidb/types"
+)
+
+type eligibilitySuite struct{}
+
+var _ = check.Suite(&eligibilitySuite{})
+
+// eligibilityTestTable returns table t1 with a unique key on column a if
+// unique is set.
+func eligibilityTestTable(unique bool) *timodel.TableInfo {
+	ft := types.NewFieldType(mysql.TypeLonglong)
+	ft.Flag = mysql.NotNullFlag
+	table := &timodel.TableInfo{
+		ID:   47,
+		Name: timodel.NewCIStr("t1"),
+		Columns: []*timodel.ColumnInfo{
+			{ID: 1, Name: timodel.NewCIStr("a"), FieldType: *ft, State: timodel.StatePublic},
+		},
+	}
+	if unique {
+		table.Indices = []*timodel.IndexInfo{{
+			ID:      1,
+			Name:    timodel.NewCIStr("uk"),
+			Unique:  true,
+			Columns: []*timodel.IndexColumn{{Name: timodel.NewCIStr("a"), Offset: 0}},
+			State:   timodel.StatePublic,
+		}}
+	}
+	return table
+}
+
+func newEligibilityTestProcessor(c *check.C, policy string) *processor {
+	schemaStorage, err := schema.NewStorage(nil)
+	c.Assert(err, check.IsNil)
+	db := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	c.Assert(schemaStorage.CreateSchema(db), check.IsNil)
+	c.Assert(schemaStorage.CreateTable(db, eligibilityTestTable(true)), check.IsNil)
+	return &processor{
+		schemaStorage:    schemaStorage,
+		pausedTables:     make(map[string]*model.PausedTable),
+		eligibility:      newEligibilityTracker(),
+		ineligiblePolicy: policy,
+	}
+}
+
+func eligibilityTestTxn(ts uint64) *model.Txn {
+	return &model.Txn{Ts: ts, DMLs: []*model.DML{
+		{Database: "test", Table: "t1"},
+		{Database: "test", Table: "t2"},
+	}}
+}
+
+func (s *eligibilitySuite) TestSkip(c *check.C) {
+	proc := newEligibilityTestProcessor(c, model.IneligibleTableSkip)
+	txn := eligibilityTestTxn(10)
+	proc.checkEligibility(txn)
+	c.Assert(txn.DMLs, check.HasLen, 2)
+
+	// the unique key is dropped
+	c.Assert(proc.schemaStorage.ReplaceTable(eligibilityTestTable(false)), check.IsNil)
+	txn = eligibilityTestTxn(20)
+	proc.checkEligibility(txn)
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	c.Assert(txn.DMLs[0].Table, check.Equals, "t2")
+
+	// the table is replicated again after the unique key is added
+	c.Assert(proc.schemaStorage.ReplaceTable(eligibilityTestTable(true)), check.IsNil)
+	txn = eligibilityTestTxn(30)
+	proc.checkEligibility(txn)
+	c.Assert(txn.DMLs, check.HasLen, 2)
+	c.Assert(proc.pausedTableList(), check.IsNil)
+}
+
+func (s *eligibilitySuite) TestPause(c *check.C) {
+	proc := newEligibilityTestProcessor(c, model.IneligibleTablePause)
+	c.Assert(proc.schemaStorage.ReplaceTable(eligibilityTestTable(false)), check.IsNil)
+	txn := eligibilityTestTxn(20)
+	proc.checkEligibility(txn)
+	proc.dropPausedDMLs(txn)
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	paused := proc.pausedTableList()
+	c.Assert(paused, check.HasLen, 1)
+	c.Assert(paused[0].ID, check.Equals, int64(47))
+	c.Assert(paused[0].Ts, check.Equals, uint64(20))
+
+	// the table resumed by users is replicated anyway
+	proc.unpauseTable(47)
+	txn = eligibilityTestTxn(30)
+	proc.checkEligibility(txn)
+	proc.dropPausedDMLs(txn)
+	c.Assert(txn.DMLs, check.HasLen, 2)
+	c.Assert(proc.pausedTableList(), check.IsNil)
+}
+
+func (s *eligibilitySuite) TestReplicate(c *check.C) {
+	proc := newEligibilityTestProcessor(c, model.IneligibleTableReplicate)
+	c.Assert(proc.schemaStorage.ReplaceTable(eligibilityTestTable(false)), check.IsNil)
+	txn := eligibilityTestTxn(20)
+	proc.checkEligibility(txn)
+	proc.dropPausedDMLs(txn)
+	c.Assert(txn.DMLs, check.HasLen, 2)
+	c.Assert(proc.pausedTableList(), check.IsNil)
+}
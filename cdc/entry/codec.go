@@ -193,10 +193,29 @@ func decodeRow(b []byte, recordID int64, tableInfo *schema.TableInfo) (map[int64
 		}
 		return map[int64]types.Datum{}, nil
 	}
-	if rowcodec.IsNewFormat(b) {
+	switch {
+	case rowcodec.IsNewFormat(b):
 		return decodeRowV2(b, recordID, tableInfo)
+	case isRowV1(b):
+		return decodeRowV1(b, recordID, tableInfo)
 	}
-	return decodeRowV1(b, recordID, tableInfo)
+	unknownRowFormatCounter.Inc()
+	return nil, errors.Annotatef(errUnknownRowFormat, "version %d, TiCDC needs an upgrade", b[0])
+}
+
+// errUnknownRowFormat is the error of the rows encoded by the newer versions of
+// the row codec of TiDB.
+var errUnknownRowFormat = errors.New("unknown row format")
+
+// the flags of the column IDs leading the rows of the old format, the row of
+// no columns is a single nil flag
+const (
+	rowV1IntFlag    byte = 3
+	rowV1VarintFlag byte = 8
+)
+
+func isRowV1(b []byte) bool {
+	return b[0] == codec.NilFlag || b[0] == rowV1IntFlag || b[0] == rowV1VarintFlag
 }
 
 // decodeRowV1 decodes value data using old encoding format.
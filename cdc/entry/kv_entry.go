@@ -38,6 +38,9 @@ type rowKVEntry struct {
 	RecordID int64
 	Delete   bool
 	Row      map[int64]types.Datum
+	// OldRow is the row before the change if the old value is enabled, it's
+	// nil if the row doesn't exist before.
+	OldRow map[int64]types.Datum
 }
 
 type indexKVEntry struct {
@@ -120,7 +123,7 @@ func (m *Mounter) unmarshalTableKVEntry(raw *model.RawKVEntry) (kvEntry, error)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	tableInfo, exist := m.schemaStorage.TableByID(tableID)
+	tableInfo, exist := m.schemaStorage.TableByIDAt(tableID, raw.Ts)
 	if !exist {
 		if m.schemaStorage.IsTruncateTableID(tableID) {
 			log.Debug("skip the DML of truncated table", zap.Uint64("ts", raw.Ts), zap.Int64("tableID", tableID))
@@ -141,14 +144,25 @@ func (m *Mounter) unmarshalTableKVEntry(raw *model.RawKVEntry) (kvEntry, error)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		return &rowKVEntry{
+		entry := &rowKVEntry{
 			Ts:       raw.Ts,
 			TableID:  tableID,
 			RecordID: recordID,
 			Delete:   raw.OpType == model.OpTypeDelete,
 			Row:      row,
-		}, nil
+		}
+		if m.oldValueReader != nil {
+			if entry.OldRow, err = m.readOldRow(raw.Key, raw.Ts, recordID, tableInfo); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		return entry, nil
 	case bytes.HasPrefix(key, indexPrefix):
+		// the changes of the unique keys are told by the old values of the
+		// rows
+		if m.oldValueReader != nil {
+			return nil, nil
+		}
 		indexID, indexValue, err := decodeIndexKey(key)
 		if err != nil {
 			return nil, errors.Trace(err)
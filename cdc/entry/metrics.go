@@ -0,0 +1,29 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var unknownRowFormatCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ticdc",
+		Subsystem: "mounter",
+		Name:      "unknown_row_format_count",
+		Help:      "rows of unknown formats written by the newer TiDB, they need an upgrade of TiCDC",
+	})
+
+// InitMetrics registers all metrics in this file
+func InitMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(unknownRowFormatCounter)
+}
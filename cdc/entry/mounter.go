@@ -3,18 +3,17 @@ package entry
 import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
-	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/schema"
-	"github.com/pingcap/tidb/table"
 	"github.com/pingcap/tidb/types"
 	"go.uber.org/zap"
 )
 
 // Mounter is used to parse SQL events from KV events
 type Mounter struct {
-	schemaStorage *schema.Storage
+	schemaStorage  *schema.Storage
+	oldValueReader RowReader
 }
 
 // NewTxnMounter creates a mounter
@@ -27,7 +26,9 @@ func (m *Mounter) Mount(rawTxn model.RawTxn) (model.Txn, error) {
 	t := model.Txn{
 		Ts: rawTxn.Ts,
 	}
-	var replaceDMLs, deleteDMLs []*model.DML
+	// the updates with the old values are written after the deletes, so the
+	// unique keys deleted can be taken by them
+	var replaceDMLs, updateDMLs, deleteDMLs []*model.DML
 	for _, raw := range rawTxn.Entries {
 		kvEntry, err := m.unmarshal(raw)
 		if err != nil {
@@ -41,9 +42,12 @@ func (m *Mounter) Mount(rawTxn model.RawTxn) (model.Txn, error) {
 				return model.Txn{}, errors.Trace(err)
 			}
 			if dml != nil {
-				if dml.Tp == model.InsertDMLType {
+				switch dml.Tp {
+				case model.InsertDMLType:
 					replaceDMLs = append(replaceDMLs, dml)
-				} else {
+				case model.UpdateDMLType:
+					updateDMLs = append(updateDMLs, dml)
+				default:
 					deleteDMLs = append(deleteDMLs, dml)
 				}
 			}
@@ -65,47 +69,32 @@ func (m *Mounter) Mount(rawTxn model.RawTxn) (model.Txn, error) {
 			log.Debug("Found unknown kv entry", zap.Binary("unknownKey", e.Key))
 		}
 	}
-	t.DMLs = append(deleteDMLs, replaceDMLs...)
+	t.DMLs = append(append(deleteDMLs, updateDMLs...), replaceDMLs...)
 	return t, nil
 }
 
 func (m *Mounter) mountRowKVEntry(row *rowKVEntry) (*model.DML, error) {
-	tableInfo, tableName, exist := m.fetchTableInfo(row.TableID)
+	tableInfo, tableName, exist := m.fetchTableInfo(row.TableID, row.Ts)
 	if !exist {
 		return nil, errors.NotFoundf("table in schema storage, id: %d", row.TableID)
 	}
 
+	if m.oldValueReader != nil {
+		return mountRowWithOldValue(row, tableInfo, tableName)
+	}
+
 	if row.Delete && !tableInfo.PKIsHandle {
 		return nil, nil
 	}
 
-	datumsNum := 1
-	if !row.Delete {
-		datumsNum = len(tableInfo.Columns)
-	}
-	values := make(map[string]types.Datum, datumsNum)
-	for index, colValue := range row.Row {
-		colInfo, exist := tableInfo.GetColumnInfo(index)
-		if !exist {
-			return nil, errors.NotFoundf("column info, colID: %d", index)
-		}
-		colName := colInfo.Name.O
-		values[colName] = colValue
+	values, err := rowValues(row.Row, tableInfo, !row.Delete)
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
-
-	var tp model.DMLType
+	tp := model.InsertDMLType
 	if row.Delete {
 		tp = model.DeleteDMLType
-	} else {
-		tp = model.InsertDMLType
-		for _, col := range tableInfo.Columns {
-			_, ok := values[col.Name.O]
-			if !ok {
-				values[col.Name.O] = getDefaultOrZeroValue(col)
-			}
-		}
 	}
-
 	return &model.DML{
 		Database: tableName.Schema,
 		Table:    tableName.Table,
@@ -114,12 +103,74 @@ func (m *Mounter) mountRowKVEntry(row *rowKVEntry) (*model.DML, error) {
 	}, nil
 }
 
+// mountRowWithOldValue mounts the row change with its old value, the deletes
+// of the rows not existing before are ignored.
+func mountRowWithOldValue(row *rowKVEntry, tableInfo *schema.TableInfo, tableName schema.TableName) (*model.DML, error) {
+	dml := &model.DML{
+		Database: tableName.Schema,
+		Table:    tableName.Table,
+	}
+	var err error
+	if row.OldRow != nil {
+		if dml.OldValues, err = rowValues(row.OldRow, tableInfo, true); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	switch {
+	case row.Delete:
+		if dml.OldValues == nil {
+			log.Warn("the deleted row doesn't exist before", zap.Uint64("ts", row.Ts),
+				zap.Int64("tableID", row.TableID), zap.Int64("recordID", row.RecordID))
+			return nil, nil
+		}
+		dml.Tp = model.DeleteDMLType
+		dml.Values, dml.OldValues = dml.OldValues, nil
+		return dml, nil
+	case dml.OldValues == nil:
+		dml.Tp = model.InsertDMLType
+	default:
+		dml.Tp = model.UpdateDMLType
+	}
+	dml.Values, err = rowValues(row.Row, tableInfo, true)
+	return dml, errors.Trace(err)
+}
+
+// rowValues returns the values of the row by the column names, the values of
+// the columns not in the row are filled by their defaults if fill is set.
+func rowValues(row map[int64]types.Datum, tableInfo *schema.TableInfo, fill bool) (map[string]types.Datum, error) {
+	values := make(map[string]types.Datum, len(tableInfo.Columns))
+	for index, colValue := range row {
+		colInfo, exist := tableInfo.GetColumnInfo(index)
+		if !exist {
+			return nil, errors.NotFoundf("column info, colID: %d", index)
+		}
+		values[colInfo.Name.O] = colValue
+	}
+	if !fill {
+		return values, nil
+	}
+	// the rows written before the columns are added have no values of them
+	for _, col := range tableInfo.Columns {
+		if _, ok := values[col.Name.O]; ok {
+			continue
+		}
+		// the virtual generated columns are never in the rows
+		if tableInfo.ColumnGenerated(col.Name.O) == schema.GeneratedVirtual {
+			continue
+		}
+		if d, ok := tableInfo.ColumnDefault(col.ID); ok {
+			values[col.Name.O] = d.Backfill
+		}
+	}
+	return values, nil
+}
+
 func (m *Mounter) mountIndexKVEntry(idx *indexKVEntry) (*model.DML, error) {
 	// skip set index KV
 	if !idx.Delete {
 		return nil, nil
 	}
-	tableInfo, tableName, exist := m.fetchTableInfo(idx.TableID)
+	tableInfo, tableName, exist := m.fetchTableInfo(idx.TableID, idx.Ts)
 	if !exist {
 		if m.schemaStorage.IsTruncateTableID(idx.TableID) {
 			log.Debug("skip the DML of truncated table", zap.Uint64("ts", idx.Ts), zap.Int64("tableID", idx.TableID))
@@ -153,33 +204,13 @@ func (m *Mounter) mountIndexKVEntry(idx *indexKVEntry) (*model.DML, error) {
 	}, nil
 }
 
-func getDefaultOrZeroValue(col *timodel.ColumnInfo) types.Datum {
-	// see https://github.com/pingcap/tidb/issues/9304
-	// must use null if TiDB not write the column value when default value is null
-	// and the value is null
-	if !mysql.HasNotNullFlag(col.Flag) {
-		return types.NewDatum(nil)
-	}
-
-	if col.GetDefaultValue() != nil {
-		return types.NewDatum(col.GetDefaultValue())
-	}
-
-	if col.Tp == mysql.TypeEnum {
-		// For enum type, if no default value and not null is set,
-		// the default value is the first element of the enum list
-		return types.NewDatum(col.FieldType.Elems[0])
-	}
-
-	return table.GetZeroValue(col)
-}
-
-func (m *Mounter) fetchTableInfo(tableID int64) (tableInfo *schema.TableInfo, tableName schema.TableName, exist bool) {
-	tableInfo, exist = m.schemaStorage.TableByID(tableID)
+// fetchTableInfo returns the table at the commit ts of the row change.
+func (m *Mounter) fetchTableInfo(tableID int64, ts uint64) (tableInfo *schema.TableInfo, tableName schema.TableName, exist bool) {
+	tableInfo, exist = m.schemaStorage.TableByIDAt(tableID, ts)
 	if !exist {
 		return
 	}
-	tableName, exist = m.schemaStorage.GetTableNameByID(tableID)
+	tableName, exist = m.schemaStorage.TableNameByIDAt(tableID, ts)
 	return
 }
 
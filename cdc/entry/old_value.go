@@ -0,0 +1,51 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/schema"
+	tidbkv "github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/types"
+)
+
+// EnableOldValue enables the old values of the rows, they are read by the
+// reader at the ts just before the changes are committed. The puts of the
+// existing rows are mounted as the updates with the old values, and the
+// deletes are mounted with the whole old rows instead of the handles or the
+// unique keys.
+func (m *Mounter) EnableOldValue(reader RowReader) {
+	m.oldValueReader = reader
+}
+
+// readOldRow reads the row before the change committed at ts, it returns nil
+// if the row doesn't exist before. No other transaction commits the row
+// between the start ts and the commit ts of the change, so the row read at
+// ts-1 is the old value of the change.
+func (m *Mounter) readOldRow(key []byte, ts uint64, recordID int64, tableInfo *schema.TableInfo) (map[int64]types.Datum, error) {
+	value, err := m.oldValueReader.ReadRow(context.Background(), key, ts-1)
+	if tidbkv.IsErrNotFound(errors.Cause(err)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "read the old value at %d", ts-1)
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+	row, err := decodeRow(value, recordID, tableInfo)
+	return row, errors.Annotatef(err, "decode the old value at %d", ts-1)
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+)
+
+type oldValueSuite struct{}
+
+var _ = check.Suite(&oldValueSuite{})
+
+// mapRowReader reads the rows by their keys, the rows not in it don't exist.
+type mapRowReader struct {
+	rows map[string][]byte
+	ts   []uint64
+}
+
+func (r *mapRowReader) ReadRow(ctx context.Context, key []byte, ts uint64) ([]byte, error) {
+	r.ts = append(r.ts, ts)
+	return r.rows[string(key)], nil
+}
+
+func encodeTestRow(c *check.C, a int64) []byte {
+	value, err := tablecodec.EncodeOldRow(&stmtctx.StatementContext{}, []types.Datum{types.NewIntDatum(a)}, []int64{2}, nil, nil)
+	c.Assert(err, check.IsNil)
+	return value
+}
+
+func datumInt64(d types.Datum) int64 {
+	return d.GetInt64()
+}
+
+func (s *oldValueSuite) TestMountWithOldValue(c *check.C) {
+	m := newTestMounter(c)
+	// t2 has no integer primary key, its rows are identified by the unique
+	// indexes
+	db, ok := m.schemaStorage.SchemaByID(1)
+	c.Assert(ok, check.IsTrue)
+	a := &timodel.ColumnInfo{ID: 2, Name: timodel.NewCIStr("a"), Offset: 0,
+		FieldType: *types.NewFieldType(mysql.TypeLonglong), State: timodel.StatePublic}
+	c.Assert(m.schemaStorage.CreateTable(db, &timodel.TableInfo{ID: 11, Name: timodel.NewCIStr("t2"),
+		Columns: []*timodel.ColumnInfo{a}}), check.IsNil)
+
+	updated := tablecodec.EncodeRowKeyWithHandle(10, 1)
+	deleted := tablecodec.EncodeRowKeyWithHandle(11, 5)
+	reader := &mapRowReader{rows: map[string][]byte{
+		string(updated): encodeTestRow(c, 1),
+		string(deleted): encodeTestRow(c, 7),
+	}}
+	m.EnableOldValue(reader)
+
+	txn, err := m.Mount(model.RawTxn{Ts: 100, Entries: []*model.RawKVEntry{
+		{OpType: model.OpTypePut, Key: updated, Value: encodeTestRow(c, 2), Ts: 100},
+		{OpType: model.OpTypePut, Key: tablecodec.EncodeRowKeyWithHandle(10, 2), Value: encodeTestRow(c, 3), Ts: 100},
+		{OpType: model.OpTypeDelete, Key: deleted, Ts: 100},
+		// the unique index of the deleted row is ignored
+		{OpType: model.OpTypeDelete, Key: tablecodec.EncodeIndexSeekKey(11, 1, []byte{1}), Ts: 100},
+		// the row not existing before is ignored
+		{OpType: model.OpTypeDelete, Key: tablecodec.EncodeRowKeyWithHandle(11, 6), Ts: 100},
+	}})
+	c.Assert(err, check.IsNil)
+	// the old values are read just before the commit ts
+	c.Assert(reader.ts, check.DeepEquals, []uint64{99, 99, 99, 99})
+
+	// the deletes are written before the updates and the inserts
+	c.Assert(txn.DMLs, check.HasLen, 3)
+	del, update, insert := txn.DMLs[0], txn.DMLs[1], txn.DMLs[2]
+	c.Assert(del.Tp, check.Equals, model.DeleteDMLType)
+	c.Assert(del.Table, check.Equals, "t2")
+	c.Assert(datumInt64(del.Values["a"]), check.Equals, int64(7))
+	c.Assert(del.OldValues, check.IsNil)
+
+	c.Assert(update.Tp, check.Equals, model.UpdateDMLType)
+	c.Assert(datumInt64(update.Values["id"]), check.Equals, int64(1))
+	c.Assert(datumInt64(update.Values["a"]), check.Equals, int64(2))
+	c.Assert(datumInt64(update.OldValues["id"]), check.Equals, int64(1))
+	c.Assert(datumInt64(update.OldValues["a"]), check.Equals, int64(1))
+
+	c.Assert(insert.Tp, check.Equals, model.InsertDMLType)
+	c.Assert(datumInt64(insert.Values["id"]), check.Equals, int64(2))
+	c.Assert(insert.OldValues, check.IsNil)
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+)
+
+type rowFormatSuite struct{}
+
+var _ = check.Suite(&rowFormatSuite{})
+
+func newTestMounter(c *check.C) *Mounter {
+	storage, err := schema.NewStorage(nil)
+	c.Assert(err, check.IsNil)
+	db := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	c.Assert(storage.CreateSchema(db), check.IsNil)
+	id := &timodel.ColumnInfo{ID: 1, Name: timodel.NewCIStr("id"), Offset: 0,
+		FieldType: *types.NewFieldType(mysql.TypeLonglong), State: timodel.StatePublic}
+	id.Flag = mysql.PriKeyFlag | mysql.NotNullFlag
+	a := &timodel.ColumnInfo{ID: 2, Name: timodel.NewCIStr("a"), Offset: 1,
+		FieldType: *types.NewFieldType(mysql.TypeLonglong), State: timodel.StatePublic}
+	c.Assert(storage.CreateTable(db, &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("t"),
+		PKIsHandle: true, Columns: []*timodel.ColumnInfo{id, a}}), check.IsNil)
+	return NewTxnMounter(storage)
+}
+
+func (s *rowFormatSuite) TestUnknownRowFormat(c *check.C) {
+	m := newTestMounter(c)
+	raw := &model.RawKVEntry{
+		OpType: model.OpTypePut,
+		Key:    tablecodec.EncodeRowKeyWithHandle(10, 7),
+		Value:  []byte{200, 1, 2, 3},
+		Ts:     100,
+	}
+	_, err := m.unmarshal(raw)
+	c.Assert(errors.Cause(err), check.Equals, errUnknownRowFormat)
+	c.Assert(err, check.ErrorMatches, "version 200, TiCDC needs an upgrade: unknown row format")
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	tidbkv "github.com/pingcap/tidb/kv"
+)
+
+// RowReader reads the value of a row at a ts.
+type RowReader interface {
+	ReadRow(ctx context.Context, key []byte, ts uint64) ([]byte, error)
+}
+
+type snapshotRowReader struct {
+	store tidbkv.Storage
+}
+
+// NewSnapshotRowReader returns a RowReader reading the rows by the snapshot
+// reads of TiKV.
+func NewSnapshotRowReader(store tidbkv.Storage) RowReader {
+	return &snapshotRowReader{store: store}
+}
+
+func (r *snapshotRowReader) ReadRow(ctx context.Context, key []byte, ts uint64) ([]byte, error) {
+	snap, err := r.store.GetSnapshot(tidbkv.NewVersion(ts))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	value, err := snap.Get(ctx, key)
+	return value, errors.Trace(err)
+}
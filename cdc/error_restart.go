@@ -0,0 +1,128 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// errorRestartResetInterval is how long a changefeed runs without errors
+// before its restarts are counted from zero again.
+const errorRestartResetInterval = 30 * time.Minute
+
+// ErrorRestartConfig is the config of restarting the changefeeds stopped by
+// the errors of the processors or the downstream.
+type ErrorRestartConfig struct {
+	// Limit is the max number of the restarts, the changefeed fails after the
+	// next error. Zero disables the restarts, the changefeed is left stopped.
+	Limit int
+	// Backoff is the delay of the first restart, it's doubled after each
+	// restart up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultErrorRestartConfig is the default config of the error restarts.
+var DefaultErrorRestartConfig = ErrorRestartConfig{
+	Limit:      5,
+	Backoff:    10 * time.Second,
+	MaxBackoff: 10 * time.Minute,
+}
+
+// errorRestartConfig is the config of the error restarts of the owner.
+var errorRestartConfig = DefaultErrorRestartConfig
+
+func (cfg ErrorRestartConfig) validate() error {
+	if cfg.Limit < 0 {
+		return errors.Errorf("invalid error-restart-limit: %d", cfg.Limit)
+	}
+	if cfg.Limit > 0 && (cfg.Backoff <= 0 || cfg.MaxBackoff < cfg.Backoff) {
+		return errors.Errorf("invalid error-restart-backoff %s and error-restart-max-backoff %s", cfg.Backoff, cfg.MaxBackoff)
+	}
+	return nil
+}
+
+// backoff returns the delay of the restart after the count restarts.
+func (cfg ErrorRestartConfig) backoff(count int) time.Duration {
+	backoff := cfg.Backoff
+	for i := 0; i < count && backoff < cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > cfg.MaxBackoff {
+		backoff = cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// recordError records the error stopping the changefeed in its info, and
+// returns the type of the admin job to stop it. The changefeed is restarted
+// after a backoff, or it fails if it has been restarted for the limited times.
+func (c *changeFeed) recordError(cfg ErrorRestartConfig, err *model.RunningError, now time.Time) model.AdminJobType {
+	c.info.Error = err
+	if cfg.Limit <= 0 {
+		return model.AdminStop
+	}
+	restart := c.info.Restart
+	if restart == nil || now.Sub(restart.LastError) >= errorRestartResetInterval {
+		restart = &model.ErrorRestart{}
+	}
+	restart.LastError = now
+	c.info.Restart = restart
+	if restart.Count >= cfg.Limit {
+		restart.NextRestart = time.Time{}
+		log.Error("changefeed fails after the limited restarts", zap.String("changefeed", c.id),
+			labelsField(c.labels()), zap.Int("restarts", restart.Count), zap.String("error", err.Message))
+		return model.AdminFail
+	}
+	restart.NextRestart = now.Add(cfg.backoff(restart.Count))
+	log.Warn("changefeed is stopped by an error, restart it later", zap.String("changefeed", c.id),
+		labelsField(c.labels()), zap.Int("restarts", restart.Count),
+		zap.Time("next restart", restart.NextRestart), zap.String("error", err.Message))
+	return model.AdminStop
+}
+
+// restartOnError resumes the changefeeds stopped by the errors once their
+// backoffs pass, they're left stopped while the cluster is paused.
+func (o *ownerImpl) restartOnError(ctx context.Context, now time.Time) error {
+	var due []model.ChangeFeedID
+	for id, restartAt := range o.pendingRestarts {
+		if !now.Before(restartAt) {
+			due = append(due, id)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	pause, err := o.etcdClient.GetClusterPause(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if pause != nil {
+		return nil
+	}
+	for _, id := range due {
+		delete(o.pendingRestarts, id)
+		err := o.enqueueJob(model.AdminJob{CfID: id, Type: model.AdminResume, Restart: true})
+		if err != nil {
+			log.Warn("failed to restart the changefeed", zap.String("changefeed", id), zap.Error(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type errorRestartSuite struct{}
+
+var _ = check.Suite(&errorRestartSuite{})
+
+func (s *errorRestartSuite) TestValidate(c *check.C) {
+	c.Assert(DefaultErrorRestartConfig.validate(), check.IsNil)
+	c.Assert(ErrorRestartConfig{}.validate(), check.IsNil)
+	c.Assert(ErrorRestartConfig{Limit: -1}.validate(), check.NotNil)
+	c.Assert(ErrorRestartConfig{Limit: 1}.validate(), check.NotNil)
+	c.Assert(ErrorRestartConfig{Limit: 1, Backoff: time.Minute, MaxBackoff: time.Second}.validate(), check.NotNil)
+}
+
+func (s *errorRestartSuite) TestBackoff(c *check.C) {
+	cfg := ErrorRestartConfig{Limit: 10, Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	c.Assert(cfg.backoff(0), check.Equals, 10*time.Second)
+	c.Assert(cfg.backoff(1), check.Equals, 20*time.Second)
+	c.Assert(cfg.backoff(2), check.Equals, 40*time.Second)
+	c.Assert(cfg.backoff(3), check.Equals, time.Minute)
+	c.Assert(cfg.backoff(100), check.Equals, time.Minute)
+}
+
+func (s *errorRestartSuite) TestRecordError(c *check.C) {
+	cfg := ErrorRestartConfig{Limit: 2, Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	cf := &changeFeed{id: "test-cf", info: &model.ChangeFeedInfo{}}
+	runErr := &model.RunningError{Message: "sink error"}
+	now := time.Now()
+
+	c.Assert(cf.recordError(cfg, runErr, now), check.Equals, model.AdminStop)
+	c.Assert(cf.info.Error, check.Equals, runErr)
+	c.Assert(cf.info.Restart.Count, check.Equals, 0)
+	c.Assert(cf.info.Restart.NextRestart, check.Equals, now.Add(10*time.Second))
+
+	// the restarts are counted by the owner resuming the changefeed
+	cf.info.Restart.Count = 1
+	now = now.Add(time.Minute)
+	c.Assert(cf.recordError(cfg, runErr, now), check.Equals, model.AdminStop)
+	c.Assert(cf.info.Restart.NextRestart, check.Equals, now.Add(20*time.Second))
+
+	cf.info.Restart.Count = 2
+	now = now.Add(time.Minute)
+	c.Assert(cf.recordError(cfg, runErr, now), check.Equals, model.AdminFail)
+	c.Assert(cf.info.Restart.NextRestart.IsZero(), check.IsTrue)
+
+	// the count is reset after the changefeed runs long enough without errors
+	now = now.Add(errorRestartResetInterval)
+	c.Assert(cf.recordError(cfg, runErr, now), check.Equals, model.AdminStop)
+	c.Assert(cf.info.Restart.Count, check.Equals, 0)
+
+	// the changefeed is left stopped if the restarts are disabled
+	cf = &changeFeed{id: "test-cf", info: &model.ChangeFeedInfo{}}
+	c.Assert(cf.recordError(ErrorRestartConfig{}, runErr, now), check.Equals, model.AdminStop)
+	c.Assert(cf.info.Restart, check.IsNil)
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+// SetChangeFeedFeature turns a feature flag of a stopped changefeed on or off,
+// the flag takes effect after the changefeed is resumed. The warning of the
+// downstream implication is returned if there is. The info is written only if
+// it's not modified since read, and it's read again if it is, so the changes
+// of the owner and the other writers are not lost.
+func SetChangeFeedFeature(ctx context.Context, cli kv.CDCEtcdClient, id, feature string, enabled bool) (string, error) {
+	if id == "" {
+		return "", errors.New("changefeed id must be specified")
+	}
+	key := kv.GetEtcdKeyChangeFeedInfo(id)
+	var warning string
+	err := retry.Run(func() error {
+		resp, err := cli.Client.Get(ctx, key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if resp.Count == 0 {
+			return backoff.Permanent(errors.Annotatef(model.ErrChangeFeedNotExists, "query detail id %s", id))
+		}
+		info := &model.ChangeFeedInfo{}
+		if err := info.Unmarshal(resp.Kvs[0].Value); err != nil {
+			return backoff.Permanent(errors.Trace(err))
+		}
+		warning, err = info.SetFeature(feature, enabled)
+		if err != nil {
+			return backoff.Permanent(errors.Trace(err))
+		}
+		value, err := info.Marshal()
+		if err != nil {
+			return backoff.Permanent(errors.Trace(err))
+		}
+		txnResp, err := cli.Client.KV.Txn(ctx).If(
+			clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision),
+		).Then(
+			clientv3.OpPut(key, value),
+		).Commit()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !txnResp.Succeeded {
+			return errors.Annotatef(model.ErrWriteTsConflict, "key: %s", key)
+		}
+		return nil
+	}, 3)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	log.Info("changefeed feature changed", zap.String("changefeed", id),
+		zap.String("feature", feature), zap.Bool("enabled", enabled), zap.String("warning", warning))
+	return warning, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type featureSuite struct{}
+
+var _ = check.Suite(&featureSuite{})
+
+func (s *featureSuite) TestSetChangeFeedFeature(c *check.C) {
+	etcdURL, server, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	defer server.Close()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{etcdURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	defer client.Close()
+	cli := kv.NewCDCEtcdClient(client)
+	ctx := context.Background()
+
+	_, err = SetChangeFeedFeature(ctx, cli, "cf", model.FeatureBatchDML, true)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+
+	info := &model.ChangeFeedInfo{SinkURI: "root@tcp(127.0.0.1:3306)/", AdminJobType: model.AdminNone}
+	c.Assert(cli.SaveChangeFeedInfo(ctx, info, "cf"), check.IsNil)
+	_, err = SetChangeFeedFeature(ctx, cli, "cf", model.FeatureBatchDML, true)
+	c.Assert(err, check.ErrorMatches, ".*must be stopped.*")
+
+	info.AdminJobType = model.AdminStop
+	c.Assert(cli.SaveChangeFeedInfo(ctx, info, "cf"), check.IsNil)
+	warning, err := SetChangeFeedFeature(ctx, cli, "cf", model.FeatureSafeMode, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(warning, check.Not(check.Equals), "")
+	_, err = SetChangeFeedFeature(ctx, cli, "cf", model.FeatureBatchDML, true)
+	c.Assert(err, check.IsNil)
+	saved, err := cli.GetChangeFeedInfo(ctx, "cf")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Features, check.DeepEquals, map[string]bool{
+		model.FeatureSafeMode: false,
+		model.FeatureBatchDML: true,
+	})
+	c.Assert(saved.AdminJobType, check.Equals, model.AdminStop)
+}
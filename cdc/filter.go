@@ -3,6 +3,8 @@ package cdc
 import (
 	"strings"
 
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/tidb-tools/pkg/filter"
 )
@@ -10,6 +12,7 @@ import (
 type txnFilter struct {
 	filter            *filter.Filter
 	ignoreTxnCommitTs []uint64
+	skipDDLTypes      map[timodel.ActionType]struct{}
 }
 
 func newTxnFilter(config *model.ReplicaConfig) (*txnFilter, error) {
@@ -17,12 +20,31 @@ func newTxnFilter(config *model.ReplicaConfig) (*txnFilter, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := config.DDL.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	skipDDLTypes := make(map[timodel.ActionType]struct{}, len(config.DDL.SkipTypes))
+	for _, name := range config.DDL.SkipTypes {
+		tp, err := model.ParseDDLType(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		skipDDLTypes[tp] = struct{}{}
+	}
 	return &txnFilter{
 		filter:            filter,
 		ignoreTxnCommitTs: config.IgnoreTxnCommitTs,
+		skipDDLTypes:      skipDDLTypes,
 	}, nil
 }
 
+// ShouldSkipDDL returns true if the DDLs of the type shouldn't be executed in
+// the downstream.
+func (f *txnFilter) ShouldSkipDDL(tp timodel.ActionType) bool {
+	_, ok := f.skipDDLTypes[tp]
+	return ok
+}
+
 // ShouldIgnoreTxn returns true is the given txn should be ignored
 func (f *txnFilter) ShouldIgnoreTxn(t *model.Txn) bool {
 	for _, ignoreTs := range f.ignoreTxnCommitTs {
@@ -15,6 +15,7 @@ package cdc
 
 import (
 	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/tidb-tools/pkg/filter"
 )
@@ -95,3 +96,18 @@ func (s *filterSuite) TestShouldIgnoreTxn(c *check.C) {
 		c.Assert(filter.ShouldIgnoreTxn(tc.txn), check.Equals, tc.ignore)
 	}
 }
+
+func (s *filterSuite) TestShouldSkipDDL(c *check.C) {
+	filter, err := newTxnFilter(&model.ReplicaConfig{
+		DDL: model.DDLConfig{SkipTypes: []string{"drop table", "Truncate Table"}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(filter.ShouldSkipDDL(timodel.ActionDropTable), check.IsTrue)
+	c.Assert(filter.ShouldSkipDDL(timodel.ActionTruncateTable), check.IsTrue)
+	c.Assert(filter.ShouldSkipDDL(timodel.ActionCreateTable), check.IsFalse)
+
+	_, err = newTxnFilter(&model.ReplicaConfig{
+		DDL: model.DDLConfig{SkipTypes: []string{"drop everything"}},
+	})
+	c.Assert(err, check.ErrorMatches, ".*unknown ddl type: drop everything.*")
+}
@@ -14,19 +14,39 @@
 package cdc
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
 	"go.etcd.io/etcd/clientv3/concurrency"
 )
 
 const (
 	opVarAdminJob     = "admin-job"
 	opVarChangefeedID = "cf-id"
+	opVarFeature      = "feature"
+	opVarEnabled      = "enabled"
+	opVarTableID      = "table-id"
+	opVarCaptureID    = "capture-id"
+	opVarBalanceBy    = "balance-by"
+	opVarTs           = "ts"
+	opVarTimeZone     = "time-zone"
+
+	opVarChangefeedFilter = "cf-filter"
+	opVarAbortOnFailure   = "abort-on-failure"
 )
 
+// tableProfilesResp is the profiles of the tables replicated by a processor.
+type tableProfilesResp struct {
+	CaptureID    string               `json:"capture-id"`
+	ChangefeedID string               `json:"changefeed-id"`
+	Tables       []*sink.TableProfile `json:"tables"`
+}
+
 type commonResp struct {
 	Status  bool   `json:"status"`
 	Message string `json:"message"`
@@ -53,6 +73,20 @@ func (s *Server) handleResignOwner(w http.ResponseWriter, req *http.Request) {
 	handleOwnerResp(w, err)
 }
 
+// handleDrainCapture hands off the tables of the capture to the other captures
+// and returns after the capture is drained, the capture can be shut down then.
+func (s *Server) handleDrainCapture(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	if err := s.capture.Drain(req.Context()); err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, commonResp{Status: true})
+}
+
 func (s *Server) handleChangefeedAdmin(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
@@ -76,3 +110,397 @@ func (s *Server) handleChangefeedAdmin(w http.ResponseWriter, req *http.Request)
 	err = s.capture.ownerWorker.EnqueueJob(job)
 	handleOwnerResp(w, err)
 }
+
+// handleMoveTable moves a table of a changefeed to the target capture through
+// the owner.
+func (s *Server) handleMoveTable(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	tableIDStr := req.Form.Get(opVarTableID)
+	tableID, err := strconv.ParseUint(tableIDStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf("invalid table id: %s", tableIDStr))
+		return
+	}
+	job := model.AdminJob{
+		CfID:            req.Form.Get(opVarChangefeedID),
+		Type:            model.AdminMoveTable,
+		TableID:         tableID,
+		TargetCaptureID: req.Form.Get(opVarCaptureID),
+	}
+	err = s.capture.ownerWorker.EnqueueJob(job)
+	handleOwnerResp(w, err)
+}
+
+// handleRebalance rebalances the tables of a changefeed among the captures
+// through the owner.
+func (s *Server) handleRebalance(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	by, err := ParseBalanceStrategy(req.Form.Get(opVarBalanceBy))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job := model.AdminJob{
+		CfID:      req.Form.Get(opVarChangefeedID),
+		Type:      model.AdminRebalance,
+		BalanceBy: by,
+	}
+	err = s.capture.ownerWorker.EnqueueJob(job)
+	handleOwnerResp(w, err)
+}
+
+// handlePlanRebalance returns the moves a rebalance of the changefeed would
+// plan without moving any table, all the changefeeds are planned if the
+// changefeed isn't specified.
+func (s *Server) handlePlanRebalance(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports GET method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	by, err := ParseBalanceStrategy(req.Form.Get(opVarBalanceBy))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, err := s.capture.ownerWorker.PlanRebalance(req.Form.Get(opVarChangefeedID), by)
+	writePlanResp(w, plan, err)
+}
+
+// handlePlanCaptureRemoval returns the moves of the tables in the capture to
+// the other captures if the capture were removed, without moving any table.
+func (s *Server) handlePlanCaptureRemoval(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports GET method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	plan, err := s.capture.ownerWorker.PlanCaptureRemoval(req.Form.Get(opVarCaptureID))
+	writePlanResp(w, plan, err)
+}
+
+func writePlanResp(w http.ResponseWriter, plan *SchedulePlan, err error) {
+	switch errors.Cause(err) {
+	case nil:
+		writeData(w, plan)
+	case model.ErrChangeFeedNotExists, model.ErrCaptureNotExist:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		handleOwnerResp(w, err)
+	}
+}
+
+// handleChangefeedBatchAdmin applies an admin job to the changefeeds specified
+// by the IDs or matching the filter, and returns the result of each changefeed.
+func (s *Server) handleChangefeedBatchAdmin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	typ, err := ParseAdminJobType(req.Form.Get(opVarAdminJob))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	abortOnFailure := false
+	if abortStr := req.Form.Get(opVarAbortOnFailure); abortStr != "" {
+		abortOnFailure, err = strconv.ParseBool(abortStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.Errorf("invalid abort-on-failure: %s", abortStr))
+			return
+		}
+	}
+	ids := req.Form[opVarChangefeedID]
+	if pattern := req.Form.Get(opVarChangefeedFilter); pattern != "" {
+		matched, err := MatchChangeFeeds(req.Context(), s.capture.etcdClient, pattern)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ids = append(ids, matched...)
+	}
+
+	var jobs []model.AdminJob
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || id == "" {
+			continue
+		}
+		seen[id] = struct{}{}
+		jobs = append(jobs, model.AdminJob{CfID: id, Type: typ})
+	}
+	if len(jobs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no changefeed is specified or matched"))
+		return
+	}
+	results, err := s.capture.ownerWorker.EnqueueJobs(jobs, abortOnFailure)
+	if err != nil {
+		handleOwnerResp(w, err)
+		return
+	}
+	writeData(w, results)
+}
+
+func (s *Server) handleClusterAdmin(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		pause, err := s.capture.etcdClient.GetClusterPause(req.Context())
+		if err != nil {
+			writeInternalServerError(w, err)
+			return
+		}
+		writeData(w, &ClusterAdminResult{Pause: pause})
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports GET and POST method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	typ, err := ParseAdminJobType(req.Form.Get(opVarAdminJob))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var result *ClusterAdminResult
+	switch typ {
+	case model.AdminStop:
+		result, err = s.capture.ownerWorker.PauseCluster(req.Context())
+	case model.AdminResume:
+		result, err = s.capture.ownerWorker.ResumeCluster(req.Context())
+	default:
+		writeError(w, http.StatusBadRequest, errors.Errorf("unsupported admin job of the cluster: %s", typ))
+		return
+	}
+	switch errors.Cause(err) {
+	case nil:
+		writeData(w, result)
+	case model.ErrClusterPaused, model.ErrClusterNotPaused:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		handleOwnerResp(w, err)
+	}
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports GET method"))
+		return
+	}
+	writeData(w, s.Config())
+}
+
+func (s *Server) handleReloadConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	cfg, err := s.ReloadConfig()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeData(w, cfg)
+}
+
+func (s *Server) handleChangefeedFeature(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	enabledStr := req.Form.Get(opVarEnabled)
+	enabled, err := strconv.ParseBool(enabledStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf("invalid enabled: %s", enabledStr))
+		return
+	}
+	warning, err := SetChangeFeedFeature(req.Context(), s.capture.etcdClient,
+		req.Form.Get(opVarChangefeedID), req.Form.Get(opVarFeature), enabled)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeData(w, commonResp{Status: true, Message: warning})
+}
+
+func (s *Server) handleResumePausedTable(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	tableIDStr := req.Form.Get(opVarTableID)
+	tableID, err := strconv.ParseInt(tableIDStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf("invalid table id: %s", tableIDStr))
+		return
+	}
+	err = ResumePausedTable(req.Context(), s.capture.etcdClient, s.capture.ownerWorker.pdClient, req.Form.Get(opVarChangefeedID), tableID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, commonResp{Status: true})
+}
+
+// parseTsForm parses the ts and the time zone in the query of a GET request.
+func parseTsForm(req *http.Request) (uint64, *time.Location, error) {
+	if req.Method != http.MethodGet {
+		return 0, nil, errors.New("this api only supports GET method")
+	}
+	if err := req.ParseForm(); err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	timeZone, err := LoadTimeZone(req.Form.Get(opVarTimeZone))
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	ts, err := ParseTs(req.Form.Get(opVarTs), timeZone)
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	return ts, timeZone, nil
+}
+
+// handleTableProfiles returns the profiles of the tables replicated by the
+// processor of the changefeed in this capture.
+func (s *Server) handleTableProfiles(w http.ResponseWriter, req *http.Request) {
+	id := req.URL.Query().Get(opVarChangefeedID)
+	s.capture.procLock.Lock()
+	p, ok := s.capture.processors[id]
+	s.capture.procLock.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, errors.Errorf("changefeed [%s] is not replicated by this capture", id))
+		return
+	}
+	if p.profiler == nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf("profiler of changefeed [%s] is disabled, set profile-sample-rate to enable it", id))
+		return
+	}
+	writeData(w, &tableProfilesResp{
+		CaptureID:    p.captureID,
+		ChangefeedID: id,
+		Tables:       p.profiler.Profiles(),
+	})
+}
+
+func (s *Server) handleConvertTs(w http.ResponseWriter, req *http.Request) {
+	ts, timeZone, err := parseTsForm(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeData(w, NewTsInfo(ts, timeZone))
+}
+
+func (s *Server) handleCheckTs(w http.ResponseWriter, req *http.Request) {
+	ts, timeZone, err := parseTsForm(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := CheckTs(req.Context(), s.capture.ownerWorker.pdClient, ts, timeZone)
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, result)
+}
+
+// handleValidateChangefeed checks the changefeed definition in the JSON body
+// like a dry run of creating it, no changefeed is created.
+func (s *Server) handleValidateChangefeed(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports POST method"))
+		return
+	}
+	draft := &ChangefeedDraft{}
+	if err := json.NewDecoder(req.Body).Decode(draft); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Annotate(err, "invalid changefeed definition"))
+		return
+	}
+	if _, err := draft.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := CheckChangefeed(req.Context(), s.capture.pdEndpoints, s.capture.ownerWorker.pdClient, draft)
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, result)
+}
+
+// handleChangefeedPositions returns the checkpoint ts and the resolved ts of
+// the changefeeds, or the one specified by cf-id, for the external systems
+// waiting for the data replicated downstream.
+func (s *Server) handleChangefeedPositions(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, errors.New("this api only supports GET method"))
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	timeZone, err := LoadTimeZone(req.Form.Get(opVarTimeZone))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	positions, err := GetChangefeedPositions(req.Context(), s.capture.etcdClient, req.Form.Get(opVarChangefeedID), timeZone)
+	if err != nil {
+		if errors.Cause(err) == model.ErrChangeFeedNotExists {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, positions)
+}
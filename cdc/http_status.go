@@ -44,7 +44,23 @@ func (s *Server) startStatusHTTP() {
 	serverMux.HandleFunc("/status", s.handleStatus)
 	serverMux.HandleFunc("/debug/info", s.handleDebugInfo)
 	serverMux.HandleFunc("/capture/owner/resign", s.handleResignOwner)
+	serverMux.HandleFunc("/capture/drain", s.handleDrainCapture)
 	serverMux.HandleFunc("/capture/owner/admin", s.handleChangefeedAdmin)
+	serverMux.HandleFunc("/capture/owner/admin/batch", s.handleChangefeedBatchAdmin)
+	serverMux.HandleFunc("/capture/owner/admin/cluster", s.handleClusterAdmin)
+	serverMux.HandleFunc("/capture/owner/move-table", s.handleMoveTable)
+	serverMux.HandleFunc("/capture/owner/rebalance", s.handleRebalance)
+	serverMux.HandleFunc("/capture/owner/plan/rebalance", s.handlePlanRebalance)
+	serverMux.HandleFunc("/capture/owner/plan/remove-capture", s.handlePlanCaptureRemoval)
+	serverMux.HandleFunc("/changefeed/feature", s.handleChangefeedFeature)
+	serverMux.HandleFunc("/changefeed/table/resume", s.handleResumePausedTable)
+	serverMux.HandleFunc("/changefeed/profile", s.handleTableProfiles)
+	serverMux.HandleFunc("/changefeed/validate", s.handleValidateChangefeed)
+	serverMux.HandleFunc("/changefeed/positions", s.handleChangefeedPositions)
+	serverMux.HandleFunc("/config", s.handleConfig)
+	serverMux.HandleFunc("/config/reload", s.handleReloadConfig)
+	serverMux.HandleFunc("/tso/convert", s.handleConvertTs)
+	serverMux.HandleFunc("/tso/check", s.handleCheckTs)
 
 	prometheus.DefaultGatherer = registry
 	serverMux.Handle("/metrics", promhttp.Handler())
@@ -0,0 +1,425 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+const (
+	// AuditKeyPrefix is the prefix of the audit entries saved in etcd
+	AuditKeyPrefix = EtcdKeyBase + "/audit"
+
+	// the mutations of the keys with the prefix are audited
+	auditedKeyPrefix = EtcdKeyBase + "/changefeed/"
+)
+
+// AuditConfig is the config of the audit log of the metadata mutations.
+type AuditConfig struct {
+	// File is the config of the rotating local audit log, leave the filename
+	// empty to disable it.
+	File log.FileLogConfig
+	// EtcdEnabled enables saving the audit entries under AuditKeyPrefix in etcd.
+	EtcdEnabled bool
+	// EtcdTTL is the retention of the audit entries in etcd, zero means the
+	// entries are kept until removed manually.
+	EtcdTTL time.Duration
+}
+
+// Enabled returns whether the audit log is enabled.
+func (cfg AuditConfig) Enabled() bool {
+	return cfg.File.Filename != "" || cfg.EtcdEnabled
+}
+
+// AuditEntry records a mutation of a metadata key.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Revision int64     `json:"revision"`
+	Type     string    `json:"type"`
+	Key      string    `json:"key"`
+	// Diff contains the changed fields of the json encoded value, the whole
+	// value is recorded with an empty field name if it's not a json object.
+	Diff map[string]*AuditDiff `json:"diff,omitempty"`
+}
+
+// AuditDiff is the old and the new value of a field.
+type AuditDiff struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+type auditor struct {
+	cfg    AuditConfig
+	logger *zap.Logger
+
+	leaseMu struct {
+		sync.Mutex
+		id        clientv3.LeaseID
+		grantedAt time.Time
+	}
+}
+
+var globalAuditor struct {
+	sync.RWMutex
+	a *auditor
+}
+
+// InitAudit initializes the audit log, the etcd clients created by
+// NewCDCEtcdClient afterwards record their mutations once EnableAudit is called.
+func InitAudit(cfg AuditConfig) error {
+	if !cfg.Enabled() {
+		globalAuditor.Lock()
+		globalAuditor.a = nil
+		globalAuditor.Unlock()
+		return nil
+	}
+	a := &auditor{cfg: cfg}
+	if cfg.File.Filename != "" {
+		logger, _, err := log.InitLogger(&log.Config{Level: "info", File: cfg.File})
+		if err != nil {
+			return errors.Annotate(err, "init audit logger")
+		}
+		a.logger = logger
+	}
+	globalAuditor.Lock()
+	globalAuditor.a = a
+	globalAuditor.Unlock()
+	return nil
+}
+
+func getAuditor() *auditor {
+	globalAuditor.RLock()
+	defer globalAuditor.RUnlock()
+	return globalAuditor.a
+}
+
+// EnableAudit records the mutations made by the client if the audit log is
+// initialized, actor returns who makes the mutation, such as the capture ID.
+func (c CDCEtcdClient) EnableAudit(actor func() string) {
+	a := getAuditor()
+	if a == nil {
+		return
+	}
+	if _, ok := c.Client.KV.(*auditKV); ok {
+		return
+	}
+	c.Client.KV = &auditKV{KV: c.Client.KV, lease: c.Client.Lease, auditor: a, actor: actor}
+}
+
+func isAuditedKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(auditedKeyPrefix))
+}
+
+// isAuditedOp returns whether the key or the key range of the operation
+// overlaps with the audited keys.
+func isAuditedOp(op clientv3.Op) bool {
+	key, end := op.KeyBytes(), op.RangeBytes()
+	if len(end) == 0 {
+		return isAuditedKey(key)
+	}
+	prefix := []byte(auditedKeyPrefix)
+	prefixEnd := []byte(clientv3.GetPrefixRangeEnd(auditedKeyPrefix))
+	// "\x00" as the end means all the keys not less than the key
+	return bytes.Compare(key, prefixEnd) < 0 && (bytes.Equal(end, []byte{0}) || bytes.Compare(end, prefix) > 0)
+}
+
+// auditKV records the mutations of the metadata keys after they succeed.
+type auditKV struct {
+	clientv3.KV
+	lease   clientv3.Lease
+	auditor *auditor
+	actor   func() string
+}
+
+// Put implements clientv3.KV interface.
+func (kv *auditKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	resp, err := kv.KV.Put(ctx, key, val, opts...)
+	if err == nil && isAuditedKey([]byte(key)) {
+		kv.record(ctx, resp.Header.Revision, []clientv3.Op{clientv3.OpPut(key, val)})
+	}
+	return resp, err
+}
+
+// Delete implements clientv3.KV interface.
+func (kv *auditKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp, err := kv.KV.Delete(ctx, key, opts...)
+	if err == nil && resp.Deleted > 0 {
+		// the range of the operation is checked in record
+		kv.record(ctx, resp.Header.Revision, []clientv3.Op{clientv3.OpDelete(key, opts...)})
+	}
+	return resp, err
+}
+
+// Do implements clientv3.KV interface.
+func (kv *auditKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	resp, err := kv.KV.Do(ctx, op)
+	if err != nil {
+		return resp, err
+	}
+	switch {
+	case op.IsPut():
+		kv.record(ctx, resp.Put().Header.Revision, []clientv3.Op{op})
+	case op.IsDelete():
+		kv.record(ctx, resp.Del().Header.Revision, []clientv3.Op{op})
+	case op.IsTxn():
+		_, thenOps, elseOps := op.Txn()
+		if resp.Txn().Succeeded {
+			kv.record(ctx, resp.Txn().Header.Revision, thenOps)
+		} else {
+			kv.record(ctx, resp.Txn().Header.Revision, elseOps)
+		}
+	}
+	return resp, nil
+}
+
+// Txn implements clientv3.KV interface.
+func (kv *auditKV) Txn(ctx context.Context) clientv3.Txn {
+	return &auditTxn{Txn: kv.KV.Txn(ctx), ctx: ctx, kv: kv}
+}
+
+type auditTxn struct {
+	clientv3.Txn
+	ctx     context.Context
+	kv      *auditKV
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+func (txn *auditTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	txn.Txn = txn.Txn.If(cs...)
+	return txn
+}
+
+func (txn *auditTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	txn.thenOps = append(txn.thenOps, ops...)
+	txn.Txn = txn.Txn.Then(ops...)
+	return txn
+}
+
+func (txn *auditTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	txn.elseOps = append(txn.elseOps, ops...)
+	txn.Txn = txn.Txn.Else(ops...)
+	return txn
+}
+
+func (txn *auditTxn) Commit() (*clientv3.TxnResponse, error) {
+	resp, err := txn.Txn.Commit()
+	if err != nil {
+		return resp, err
+	}
+	if resp.Succeeded {
+		txn.kv.record(txn.ctx, resp.Header.Revision, txn.thenOps)
+	} else {
+		txn.kv.record(txn.ctx, resp.Header.Revision, txn.elseOps)
+	}
+	return resp, nil
+}
+
+// record builds the audit entries of the write operations committed at the
+// revision. The old values are read at the previous revision, so the entries
+// are accurate as long as the previous revision is not compacted.
+func (kv *auditKV) record(ctx context.Context, revision int64, ops []clientv3.Op) {
+	var entries []*AuditEntry
+	now := time.Now()
+	for _, op := range ops {
+		if op.IsTxn() {
+			// nested transactions are not used by CDC
+			continue
+		}
+		if !op.IsPut() && !op.IsDelete() {
+			continue
+		}
+		if !isAuditedOp(op) {
+			continue
+		}
+		key := op.KeyBytes()
+
+		getOpts := []clientv3.OpOption{clientv3.WithRev(revision - 1)}
+		if end := op.RangeBytes(); len(end) > 0 {
+			getOpts = append(getOpts, clientv3.WithRange(string(end)))
+		}
+		olds, err := kv.KV.Get(ctx, string(key), getOpts...)
+		if err != nil {
+			log.Warn("get the old value for audit log failed", zap.ByteString("key", key), zap.Error(err))
+		}
+
+		if op.IsPut() {
+			var old []byte
+			if err == nil && len(olds.Kvs) > 0 {
+				old = olds.Kvs[0].Value
+			}
+			entries = append(entries, &AuditEntry{
+				Time:     now,
+				Actor:    kv.actor(),
+				Revision: revision,
+				Type:     "put",
+				Key:      string(key),
+				Diff:     diffValues(string(key), old, op.ValueBytes()),
+			})
+			continue
+		}
+		if err != nil {
+			entries = append(entries, &AuditEntry{
+				Time: now, Actor: kv.actor(), Revision: revision, Type: "delete", Key: string(key),
+			})
+			continue
+		}
+		for _, old := range olds.Kvs {
+			if !isAuditedKey(old.Key) {
+				continue
+			}
+			entries = append(entries, &AuditEntry{
+				Time:     now,
+				Actor:    kv.actor(),
+				Revision: revision,
+				Type:     "delete",
+				Key:      string(old.Key),
+				Diff:     diffValues(string(old.Key), old.Value, nil),
+			})
+		}
+	}
+	for i, entry := range entries {
+		kv.auditor.save(ctx, kv.KV, kv.lease, entry, i)
+	}
+}
+
+func (a *auditor) save(ctx context.Context, etcdKV clientv3.KV, lease clientv3.Lease, entry *AuditEntry, index int) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Warn("marshal audit entry failed", zap.Error(err))
+		return
+	}
+	if a.logger != nil {
+		a.logger.Info("etcd mutation", zap.ByteString("entry", data))
+	}
+	if !a.cfg.EtcdEnabled {
+		return
+	}
+
+	var opts []clientv3.OpOption
+	if a.cfg.EtcdTTL > 0 {
+		leaseID, err := a.getLease(ctx, lease)
+		if err != nil {
+			log.Warn("grant lease for audit entry failed", zap.Error(err))
+			return
+		}
+		opts = append(opts, clientv3.WithLease(leaseID))
+	}
+	key := fmt.Sprintf("%s/%020d/%d", AuditKeyPrefix, entry.Revision, index)
+	if _, err := etcdKV.Put(ctx, key, string(data), opts...); err != nil {
+		log.Warn("save audit entry to etcd failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// getLease returns the lease of the audit entries, a lease is shared by the
+// entries written in a tenth of the TTL to reduce the number of leases.
+func (a *auditor) getLease(ctx context.Context, lease clientv3.Lease) (clientv3.LeaseID, error) {
+	a.leaseMu.Lock()
+	defer a.leaseMu.Unlock()
+	if a.leaseMu.id != clientv3.NoLease && time.Since(a.leaseMu.grantedAt) < a.cfg.EtcdTTL/10 {
+		return a.leaseMu.id, nil
+	}
+	resp, err := lease.Grant(ctx, int64(a.cfg.EtcdTTL/time.Second))
+	if err != nil {
+		return clientv3.NoLease, errors.Trace(err)
+	}
+	a.leaseMu.id = resp.ID
+	a.leaseMu.grantedAt = time.Now()
+	return resp.ID, nil
+}
+
+// diffValues returns the changed top-level fields of two json objects, the
+// compact task status is decoded before comparing.
+func diffValues(key string, old, new []byte) map[string]*AuditDiff {
+	old, new = normalizeValue(key, old), normalizeValue(key, new)
+	var oldFields, newFields map[string]json.RawMessage
+	if (old != nil && json.Unmarshal(old, &oldFields) != nil) ||
+		(new != nil && json.Unmarshal(new, &newFields) != nil) {
+		return map[string]*AuditDiff{"": {Old: rawJSON(old), New: rawJSON(new)}}
+	}
+
+	diff := make(map[string]*AuditDiff)
+	for name, oldValue := range oldFields {
+		newValue, ok := newFields[name]
+		if !ok || !bytes.Equal(oldValue, newValue) {
+			diff[name] = &AuditDiff{Old: oldValue, New: newValue}
+		}
+	}
+	for name, newValue := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			diff[name] = &AuditDiff{New: newValue}
+		}
+	}
+	return diff
+}
+
+func normalizeValue(key string, value []byte) []byte {
+	if value != nil && strings.HasPrefix(key, GetEtcdKeyChangeFeedInfo("")) {
+		return redactChangeFeedInfo(value)
+	}
+	if value == nil || json.Valid(value) || !strings.HasPrefix(key, GetEtcdKeyTaskList("")) {
+		return value
+	}
+	status := new(model.TaskStatus)
+	if err := status.Unmarshal(value); err != nil {
+		return value
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return value
+	}
+	return data
+}
+
+// redactChangeFeedInfo redacts the sink uri of the changefeed info, so the
+// credentials are not saved in the audit entries.
+func redactChangeFeedInfo(value []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return value
+	}
+	var sinkURI string
+	if err := json.Unmarshal(fields["sink-uri"], &sinkURI); err != nil {
+		return value
+	}
+	fields["sink-uri"], _ = json.Marshal(model.RedactSinkURI(sinkURI))
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return value
+	}
+	return data
+}
+
+// rawJSON returns the value as a json value, non-json values are encoded as
+// json strings.
+func rawJSON(value []byte) json.RawMessage {
+	if value == nil || json.Valid(value) {
+		return value
+	}
+	data, _ := json.Marshal(string(value))
+	return data
+}
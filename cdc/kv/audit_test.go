@@ -0,0 +1,106 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3"
+)
+
+func (s *etcdSuite) TestAuditMutations(c *check.C) {
+	logFile := filepath.Join(c.MkDir(), "audit.log")
+	err := InitAudit(AuditConfig{
+		File:        log.FileLogConfig{Filename: logFile},
+		EtcdEnabled: true,
+		EtcdTTL:     time.Hour,
+	})
+	c.Assert(err, check.IsNil)
+	defer func() {
+		c.Assert(InitAudit(AuditConfig{}), check.IsNil)
+	}()
+	s.client.EnableAudit(func() string { return "capture/test" })
+
+	ctx := context.Background()
+	err = s.client.PutChangeFeedStatus(ctx, "cf", &model.ChangeFeedStatus{ResolvedTs: 1, CheckpointTs: 1})
+	c.Assert(err, check.IsNil)
+	err = s.client.PutChangeFeedStatus(ctx, "cf", &model.ChangeFeedStatus{ResolvedTs: 2, CheckpointTs: 1})
+	c.Assert(err, check.IsNil)
+	err = s.client.ImportChangeFeed(ctx, &model.ChangeFeedExport{
+		ID:     "cf",
+		Info:   &model.ChangeFeedInfo{SinkURI: "sink"},
+		Status: &model.ChangeFeedStatus{ResolvedTs: 2, CheckpointTs: 2},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.client.DeleteChangeFeedInfo(ctx, "cf")
+	c.Assert(err, check.IsNil)
+	// mutations of the other keys are not audited
+	err = s.client.PutCaptureInfo(ctx, &model.CaptureInfo{ID: "test"})
+	c.Assert(err, check.IsNil)
+
+	resp, err := s.client.Client.Get(ctx, AuditKeyPrefix, clientv3.WithPrefix())
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Kvs, check.HasLen, 5)
+	entries := make([]*AuditEntry, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		c.Assert(kv.Lease, check.Not(check.Equals), int64(0))
+		entry := new(AuditEntry)
+		c.Assert(json.Unmarshal(kv.Value, entry), check.IsNil)
+		c.Assert(entry.Actor, check.Equals, "capture/test")
+		entries = append(entries, entry)
+	}
+
+	statusKey := GetEtcdKeyChangeFeedStatus("cf")
+	infoKey := GetEtcdKeyChangeFeedInfo("cf")
+	c.Assert(entries[0].Key, check.Equals, statusKey)
+	c.Assert(entries[0].Diff, check.HasLen, 3)
+	c.Assert(entries[1].Key, check.Equals, statusKey)
+	c.Assert(entries[1].Diff, check.DeepEquals, map[string]*AuditDiff{
+		"resolved-ts": {Old: json.RawMessage("1"), New: json.RawMessage("2")},
+	})
+	c.Assert(entries[3].Diff, check.DeepEquals, map[string]*AuditDiff{
+		"checkpoint-ts": {Old: json.RawMessage("1"), New: json.RawMessage("2")},
+	})
+	c.Assert(entries[2].Type, check.Equals, "put")
+	c.Assert(entries[3].Type, check.Equals, "put")
+	c.Assert([]string{entries[2].Key, entries[3].Key}, check.DeepEquals, []string{infoKey, statusKey})
+	c.Assert(entries[4].Type, check.Equals, "delete")
+	c.Assert(entries[4].Key, check.Equals, infoKey)
+	c.Assert(string(entries[4].Diff["sink-uri"].Old), check.Equals, `"sink"`)
+	c.Assert(entries[4].Diff["sink-uri"].New, check.IsNil)
+
+	data, err := ioutil.ReadFile(logFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Count(string(data), "etcd mutation"), check.Equals, 5)
+}
+
+func (s *etcdSuite) TestAuditRedactsSinkURI(c *check.C) {
+	key := GetEtcdKeyChangeFeedInfo("cf")
+	oldValue := []byte(`{"sink-uri":"root:old@tcp(127.0.0.1:3306)/","start-ts":1}`)
+	newValue := []byte(`{"sink-uri":"root:new@tcp(127.0.0.1:3306)/","start-ts":2}`)
+	diff := diffValues(key, oldValue, newValue)
+	c.Assert(diff, check.DeepEquals, map[string]*AuditDiff{
+		"start-ts": {Old: json.RawMessage("1"), New: json.RawMessage("2")},
+	})
+	diff = diffValues(key, nil, newValue)
+	c.Assert(string(diff["sink-uri"].New), check.Equals, `"root:******@tcp(127.0.0.1:3306)/"`)
+}
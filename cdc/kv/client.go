@@ -15,6 +15,7 @@ package kv
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
@@ -41,8 +42,90 @@ import (
 const (
 	dialTimeout = 10 * time.Second
 	maxRetry    = 10
+
+	// the interval of checking whether the stores in use are removed from PD.
+	storeCheckInterval = 10 * time.Second
+
+	// the minimum window size accepted by gRPC, smaller values are ignored.
+	minGrpcWindowSize = 64 * 1024
 )
 
+// GrpcConfig contains the tuning parameters of the gRPC connections to TiKV.
+// The zero value of the window sizes and the max receive message size means
+// the default values of gRPC.
+type GrpcConfig struct {
+	KeepaliveTime         time.Duration
+	KeepaliveTimeout      time.Duration
+	InitialWindowSize     int32
+	InitialConnWindowSize int32
+	MaxRecvMsgSize        int
+}
+
+// DefaultGrpcConfig is the default gRPC config of CDCClient.
+var DefaultGrpcConfig = GrpcConfig{
+	KeepaliveTime:    10 * time.Second,
+	KeepaliveTimeout: 3 * time.Second,
+}
+
+// Validate checks whether the config is valid.
+func (cfg GrpcConfig) Validate() error {
+	if cfg.KeepaliveTime <= 0 {
+		return errors.Errorf("invalid grpc keepalive time: %s", cfg.KeepaliveTime)
+	}
+	if cfg.KeepaliveTimeout <= 0 {
+		return errors.Errorf("invalid grpc keepalive timeout: %s", cfg.KeepaliveTimeout)
+	}
+	if cfg.InitialWindowSize != 0 && cfg.InitialWindowSize < minGrpcWindowSize {
+		return errors.Errorf("grpc initial window size should be at least %d, got %d", minGrpcWindowSize, cfg.InitialWindowSize)
+	}
+	if cfg.InitialConnWindowSize != 0 && cfg.InitialConnWindowSize < minGrpcWindowSize {
+		return errors.Errorf("grpc initial connection window size should be at least %d, got %d", minGrpcWindowSize, cfg.InitialConnWindowSize)
+	}
+	if cfg.MaxRecvMsgSize < 0 {
+		return errors.Errorf("invalid grpc max receive message size: %d", cfg.MaxRecvMsgSize)
+	}
+	return nil
+}
+
+func (cfg GrpcConfig) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(cfg.MaxRecvMsgSize)))
+	}
+	return opts
+}
+
+var grpcConfig = struct {
+	sync.RWMutex
+	cfg GrpcConfig
+}{cfg: DefaultGrpcConfig}
+
+// SetGrpcConfig sets the gRPC config used by the CDCClients created afterwards.
+func SetGrpcConfig(cfg GrpcConfig) {
+	grpcConfig.Lock()
+	grpcConfig.cfg = cfg
+	grpcConfig.Unlock()
+}
+
+// GetGrpcConfig returns the gRPC config of CDCClient.
+func GetGrpcConfig() GrpcConfig {
+	grpcConfig.RLock()
+	defer grpcConfig.RUnlock()
+	return grpcConfig.cfg
+}
+
 type singleRegionInfo struct {
 	meta *metapb.Region
 	span util.Span
@@ -54,6 +137,7 @@ type CDCClient struct {
 	pd pd.Client
 
 	clusterID uint64
+	grpcCfg   GrpcConfig
 
 	mu struct {
 		sync.Mutex
@@ -63,9 +147,15 @@ type CDCClient struct {
 	storeMu struct {
 		sync.Mutex
 		stores map[uint64]*metapb.Store
+		// streams maps store ID to the cancel functions of the streams to the store.
+		streams map[uint64]map[*streamCanceler]struct{}
 	}
 }
 
+type streamCanceler struct {
+	cancel context.CancelFunc
+}
+
 // NewCDCClient creates a CDCClient instance
 func NewCDCClient(pd pd.Client) (c *CDCClient, err error) {
 	clusterID := pd.GetClusterID(context.Background())
@@ -74,6 +164,7 @@ func NewCDCClient(pd pd.Client) (c *CDCClient, err error) {
 	c = &CDCClient{
 		clusterID: clusterID,
 		pd:        pd,
+		grpcCfg:   GetGrpcConfig(),
 		mu: struct {
 			sync.Mutex
 			conns map[string]*grpc.ClientConn
@@ -82,9 +173,11 @@ func NewCDCClient(pd pd.Client) (c *CDCClient, err error) {
 		},
 		storeMu: struct {
 			sync.Mutex
-			stores map[uint64]*metapb.Store
+			stores  map[uint64]*metapb.Store
+			streams map[uint64]map[*streamCanceler]struct{}
 		}{
-			stores: make(map[uint64]*metapb.Store),
+			stores:  make(map[uint64]*metapb.Store),
+			streams: make(map[uint64]map[*streamCanceler]struct{}),
 		},
 	}
 
@@ -114,9 +207,7 @@ func (c *CDCClient) getConn(
 
 	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
 
-	conn, err = grpc.DialContext(
-		ctx,
-		addr,
+	opts := append([]grpc.DialOption{
 		grpc.WithInsecure(),
 		grpc.WithConnectParams(grpc.ConnectParams{
 			Backoff: gbackoff.Config{
@@ -127,12 +218,8 @@ func (c *CDCClient) getConn(
 			},
 			MinConnectTimeout: 3 * time.Second,
 		}),
-		grpc.WithKeepaliveParams(keepalive.ClientParameters{
-			Time:                10 * time.Second,
-			Timeout:             3 * time.Second,
-			PermitWithoutStream: true,
-		}),
-	)
+	}, c.grpcCfg.dialOptions()...)
+	conn, err = grpc.DialContext(ctx, addr, opts...)
 	cancel()
 
 	if err != nil {
@@ -146,9 +233,9 @@ func (c *CDCClient) getConn(
 
 func (c *CDCClient) getConnByMeta(
 	ctx context.Context, meta *metapb.Region,
-) (conn *grpc.ClientConn, err error) {
+) (conn *grpc.ClientConn, storeID uint64, err error) {
 	if len(meta.Peers) == 0 {
-		return nil, errors.New("no peer")
+		return nil, 0, errors.New("no peer")
 	}
 
 	// the first is leader in Peers?
@@ -156,10 +243,11 @@ func (c *CDCClient) getConnByMeta(
 
 	store, err := c.getStore(ctx, peer.GetStoreId())
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return c.getConn(ctx, store.Address)
+	conn, err = c.getConn(ctx, store.Address)
+	return conn, store.GetId(), err
 }
 
 func (c *CDCClient) getStore(
@@ -176,12 +264,116 @@ func (c *CDCClient) getStore(
 	if err != nil {
 		return nil, errors.Annotatef(err, "get store %d failed", id)
 	}
+	if isStoreRemoved(store) {
+		return nil, errors.Trace(&storeRemovedError{storeID: id})
+	}
 
 	c.storeMu.stores[id] = store
 
 	return
 }
 
+// forgetStore drops the cached meta of the store, so that the address and the
+// state of the store are fetched from PD again in the next connection.
+func (c *CDCClient) forgetStore(id uint64) {
+	c.storeMu.Lock()
+	delete(c.storeMu.stores, id)
+	c.storeMu.Unlock()
+}
+
+// registerStream records the cancel function of a stream to the store, the
+// returned function must be called once the stream quits.
+func (c *CDCClient) registerStream(storeID uint64, cancel context.CancelFunc) (unregister func()) {
+	canceler := &streamCanceler{cancel: cancel}
+	c.storeMu.Lock()
+	streams, ok := c.storeMu.streams[storeID]
+	if !ok {
+		streams = make(map[*streamCanceler]struct{})
+		c.storeMu.streams[storeID] = streams
+	}
+	streams[canceler] = struct{}{}
+	c.storeMu.Unlock()
+
+	return func() {
+		c.storeMu.Lock()
+		delete(c.storeMu.streams[storeID], canceler)
+		if len(c.storeMu.streams[storeID]) == 0 {
+			delete(c.storeMu.streams, storeID)
+		}
+		c.storeMu.Unlock()
+	}
+}
+
+// removeStore cancels all the streams to the store and closes the connection,
+// the regions of the canceled streams will be resolved from PD again.
+func (c *CDCClient) removeStore(id uint64) {
+	c.storeMu.Lock()
+	store := c.storeMu.stores[id]
+	streams := c.storeMu.streams[id]
+	delete(c.storeMu.stores, id)
+	delete(c.storeMu.streams, id)
+	c.storeMu.Unlock()
+
+	log.Info("store is removed, cancel the streams to it",
+		zap.Uint64("store", id), zap.Int("streams", len(streams)))
+	for canceler := range streams {
+		canceler.cancel()
+	}
+	if store == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if conn, ok := c.mu.conns[store.Address]; ok {
+		if err := conn.Close(); err != nil {
+			log.Warn("close connection failed", zap.String("addr", store.Address), zap.Error(err))
+		}
+		delete(c.mu.conns, store.Address)
+	}
+	c.mu.Unlock()
+}
+
+// checkRemovedStores checks the state of the stores in use with PD periodically,
+// and removes the tombstone stores.
+func (c *CDCClient) checkRemovedStores(ctx context.Context) error {
+	ticker := time.NewTicker(storeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.removeTombstoneStores(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *CDCClient) removeTombstoneStores(ctx context.Context) {
+	c.storeMu.Lock()
+	ids := make([]uint64, 0, len(c.storeMu.stores))
+	for id := range c.storeMu.stores {
+		ids = append(ids, id)
+	}
+	c.storeMu.Unlock()
+
+	for _, id := range ids {
+		store, err := c.pd.GetStore(ctx, id)
+		if err != nil {
+			log.Warn("get store failed", zap.Uint64("store", id), zap.Error(err))
+			continue
+		}
+		if isStoreRemoved(store) {
+			c.removeStore(id)
+		}
+	}
+}
+
+// isStoreRemoved returns whether the store is tombstone, PD client returns a
+// nil store for the tombstone store.
+func isStoreRemoved(store *metapb.Store) bool {
+	return store == nil || store.GetState() == metapb.StoreState_Tombstone
+}
+
 // EventFeed divides a EventFeed request on range boundaries and establishes
 // a EventFeed to each of the individual region. It streams back result on the
 // provided channel.
@@ -212,6 +404,10 @@ func (c *CDCClient) EventFeed(
 		return c.divideAndSendEventFeedToRegions(ctx, span, ts, regionCh)
 	})
 
+	g.Go(func() error {
+		return c.checkRemovedStores(ctx)
+	})
+
 	return g.Wait()
 }
 
@@ -226,6 +422,10 @@ func (c *CDCClient) partialRegionFeed(
 	eventCh chan<- *model.RegionFeedEvent,
 ) error {
 	ts := regionInfo.ts
+	// The events emitted since the last resolved ts are kept, so the EventFeed
+	// can resume from the resolved ts instead of the start ts of the region
+	// without emitting the events again.
+	cache := newReplayCache(defaultReplayCacheSize)
 
 	berr := retry.Run(func() error {
 		var err error
@@ -239,12 +439,13 @@ func (c *CDCClient) partialRegionFeed(
 			return errors.Trace(err)
 		}
 
-		maxTs, err := c.singleEventFeed(ctx, regionInfo.span, regionInfo.ts, regionInfo.meta, eventCh)
+		maxTs, err := c.singleEventFeed(ctx, regionInfo.span, ts, regionInfo.meta, cache, eventCh)
 		log.Debug("singleEventFeed quit")
 
 		if maxTs > ts {
 			ts = maxTs
 		}
+		cache.resolve(ts)
 
 		if err != nil {
 			log.Info("EventFeed disconnected",
@@ -253,6 +454,10 @@ func (c *CDCClient) partialRegionFeed(
 				zap.Error(err))
 
 			switch eerr := errors.Cause(err).(type) {
+			case *storeRemovedError:
+				eventFeedErrorCounter.WithLabelValues("StoreRemoved").Inc()
+				regionInfo.meta = nil
+				return errors.Trace(err)
 			case *eventError:
 				if eerr.GetNotLeader() != nil {
 					eventFeedErrorCounter.WithLabelValues("NotLeader").Inc()
@@ -272,6 +477,10 @@ func (c *CDCClient) partialRegionFeed(
 				}
 			default:
 				if status.Code(err) == codes.Unavailable {
+					// The store may be down or removed, check it with PD in the next retry.
+					if len(regionInfo.meta.GetPeers()) > 0 {
+						c.forgetStore(regionInfo.meta.Peers[0].GetStoreId())
+					}
 					regionInfo.meta = nil
 					return errors.Trace(err)
 				}
@@ -357,12 +566,15 @@ func (c *CDCClient) divideAndSendEventFeedToRegions(
 // Results will be send to eventCh
 // EventFeed RPC will not return checkpoint event directly
 // Resolved event is generate while there's not non-match pre-write
+// The committed events found in the replay cache are emitted by the previous
+// EventFeed of the region and are skipped
 // Return the maximum checkpoint
 func (c *CDCClient) singleEventFeed(
 	ctx context.Context,
 	span util.Span,
 	ts uint64,
 	meta *metapb.Region,
+	cache *replayCache,
 	eventCh chan<- *model.RegionFeedEvent,
 ) (checkpointTs uint64, err error) {
 	req := &cdcpb.ChangeDataRequest{
@@ -378,19 +590,42 @@ func (c *CDCClient) singleEventFeed(
 
 	var initialized uint32
 
-	conn, err := c.getConnByMeta(ctx, meta)
+	conn, storeID, err := c.getConnByMeta(ctx, meta)
 	if err != nil {
 		return req.CheckpointTs, err
 	}
 
+	// The region is scanned by TiKV until the INITIALIZED event, the scans
+	// running at the same time are limited by the quota of the capture.
+	if err := regionScanLimiter.acquire(ctx); err != nil {
+		return req.CheckpointTs, errors.Trace(err)
+	}
+	scanning := true
+	finishScan := func() {
+		if scanning {
+			scanning = false
+			regionScanLimiter.release()
+		}
+	}
+	defer finishScan()
+
+	// The stream is canceled if the store is removed.
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	unregister := c.registerStream(storeID, cancel)
+	defer unregister()
+
 	client := cdcpb.NewChangeDataClient(conn)
 	matcher := newMatcher()
 
 	log.Debug("start new request", zap.Reflect("request", req))
-	stream, err := client.EventFeed(ctx, req)
+	stream, err := client.EventFeed(streamCtx, req)
 
 	if err != nil {
 		log.Error("RPC error", zap.Error(err))
+		if ctx.Err() == nil && streamCtx.Err() != nil {
+			err = &storeRemovedError{storeID: storeID}
+		}
 		return req.CheckpointTs, errors.Trace(err)
 	}
 
@@ -425,6 +660,9 @@ func (c *CDCClient) singleEventFeed(
 		}
 
 		if err != nil {
+			if ctx.Err() == nil && streamCtx.Err() != nil {
+				err = &storeRemovedError{storeID: storeID}
+			}
 			return atomic.LoadUint64(&req.CheckpointTs), errors.Trace(err)
 		}
 
@@ -439,6 +677,7 @@ func (c *CDCClient) singleEventFeed(
 					switch row.Type {
 					case cdcpb.Event_INITIALIZED:
 						atomic.StoreUint32(&initialized, 1)
+						finishScan()
 					case cdcpb.Event_COMMITTED:
 						var opType model.OpType
 						switch row.GetOpType() {
@@ -458,10 +697,8 @@ func (c *CDCClient) singleEventFeed(
 								Ts:     row.CommitTs,
 							},
 						}
-						select {
-						case eventCh <- revent:
-						case <-ctx.Done():
-							return atomic.LoadUint64(&req.CheckpointTs), errors.Trace(ctx.Err())
+						if err := emitCommitted(ctx, revent, cache, atomic.LoadUint64(&req.CheckpointTs), eventCh); err != nil {
+							return atomic.LoadUint64(&req.CheckpointTs), errors.Trace(err)
 						}
 					case cdcpb.Event_PREWRITE:
 						matcher.putPrewriteRow(row)
@@ -495,11 +732,8 @@ func (c *CDCClient) singleEventFeed(
 								Ts:     row.CommitTs,
 							},
 						}
-
-						select {
-						case eventCh <- revent:
-						case <-ctx.Done():
-							return atomic.LoadUint64(&req.CheckpointTs), errors.Trace(ctx.Err())
+						if err := emitCommitted(ctx, revent, cache, atomic.LoadUint64(&req.CheckpointTs), eventCh); err != nil {
+							return atomic.LoadUint64(&req.CheckpointTs), errors.Trace(err)
 						}
 						sorter.pushTsItem(sortItem{
 							start:  row.GetStartTs(),
@@ -542,6 +776,30 @@ func (c *CDCClient) singleEventFeed(
 	}
 }
 
+// emitCommitted sends a committed event to eventCh unless it's found in the
+// replay cache, the events no later than the checkpoint are dropped from the
+// cache first.
+func emitCommitted(
+	ctx context.Context,
+	revent *model.RegionFeedEvent,
+	cache *replayCache,
+	checkpointTs uint64,
+	eventCh chan<- *model.RegionFeedEvent,
+) error {
+	cache.resolve(checkpointTs)
+	if cache.emitted(revent.Val) {
+		replayedEventCounter.WithLabelValues(util.CaptureIDFromCtx(ctx)).Inc()
+		return nil
+	}
+	select {
+	case eventCh <- revent:
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+	cache.add(revent.Val)
+	return nil
+}
+
 func updateCheckpointTS(checkpointTs *uint64, newValue uint64) {
 	for {
 		oldValue := atomic.LoadUint64(checkpointTs)
@@ -551,6 +809,16 @@ func updateCheckpointTS(checkpointTs *uint64, newValue uint64) {
 	}
 }
 
+// storeRemovedError is returned when the store is tombstone.
+type storeRemovedError struct {
+	storeID uint64
+}
+
+// Error implement error interface.
+func (e *storeRemovedError) Error() string {
+	return fmt.Sprintf("store %d is removed", e.storeID)
+}
+
 // eventError wrap cdcpb.Event_Error to implements error interface.
 type eventError struct {
 	*cdcpb.Event_Error
@@ -1,11 +1,13 @@
 package kv
 
 import (
+	"context"
 	"math/rand"
 	"sync"
 	"testing"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/store/mockstore/mocktikv"
 )
 
@@ -27,6 +29,71 @@ func (s *clientSuite) TestNewClose(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *clientSuite) TestGrpcConfig(c *check.C) {
+	c.Assert(DefaultGrpcConfig.Validate(), check.IsNil)
+	c.Assert(DefaultGrpcConfig.dialOptions(), check.HasLen, 1)
+
+	cfg := DefaultGrpcConfig
+	cfg.InitialWindowSize = 1 << 20
+	cfg.InitialConnWindowSize = 1 << 24
+	cfg.MaxRecvMsgSize = 1 << 30
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert(cfg.dialOptions(), check.HasLen, 4)
+
+	SetGrpcConfig(cfg)
+	defer SetGrpcConfig(DefaultGrpcConfig)
+	cli, err := NewCDCClient(mocktikv.NewPDClient(mocktikv.NewCluster()))
+	c.Assert(err, check.IsNil)
+	c.Assert(cli.grpcCfg, check.DeepEquals, cfg)
+	c.Assert(cli.Close(), check.IsNil)
+
+	invalid := DefaultGrpcConfig
+	invalid.KeepaliveTime = 0
+	c.Assert(invalid.Validate(), check.ErrorMatches, ".*keepalive time.*")
+	invalid = DefaultGrpcConfig
+	invalid.InitialWindowSize = 1024
+	c.Assert(invalid.Validate(), check.ErrorMatches, ".*initial window size.*")
+	invalid = DefaultGrpcConfig
+	invalid.MaxRecvMsgSize = -1
+	c.Assert(invalid.Validate(), check.ErrorMatches, ".*max receive message size.*")
+}
+
+func (s *clientSuite) TestRemoveTombstoneStore(c *check.C) {
+	cluster := mocktikv.NewCluster()
+	cluster.AddStore(1, "127.0.0.1:20160")
+	cluster.AddStore(2, "127.0.0.1:20161")
+	cli, err := NewCDCClient(mocktikv.NewPDClient(cluster))
+	c.Assert(err, check.IsNil)
+	defer cli.Close()
+
+	ctx := context.Background()
+	for _, id := range []uint64{1, 2} {
+		_, err = cli.getStore(ctx, id)
+		c.Assert(err, check.IsNil)
+	}
+	streamCtx1, cancel1 := context.WithCancel(ctx)
+	unregister1 := cli.registerStream(1, cancel1)
+	defer unregister1()
+	streamCtx2, cancel2 := context.WithCancel(ctx)
+	unregister2 := cli.registerStream(2, cancel2)
+	defer unregister2()
+
+	cluster.RemoveStore(1)
+	cli.removeTombstoneStores(ctx)
+
+	c.Assert(streamCtx1.Err(), check.Equals, context.Canceled)
+	c.Assert(streamCtx2.Err(), check.IsNil)
+	c.Assert(cli.storeMu.stores, check.HasLen, 1)
+	c.Assert(cli.storeMu.streams, check.HasLen, 1)
+
+	_, err = cli.getStore(ctx, 1)
+	_, ok := errors.Cause(err).(*storeRemovedError)
+	c.Assert(ok, check.IsTrue)
+
+	unregister2()
+	c.Assert(cli.storeMu.streams, check.HasLen, 0)
+}
+
 func (s *clientSuite) TestUpdateCheckpointTS(c *check.C) {
 	var checkpointTS uint64
 	var g sync.WaitGroup
@@ -16,9 +16,11 @@ package kv
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
 	"github.com/pingcap/ticdc/pkg/util"
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/mvcc/mvccpb"
@@ -31,8 +33,24 @@ const (
 	CaptureOwnerKey = EtcdKeyBase + "/capture/owner"
 	// CaptureInfoKeyPrefix is the capture info path that is saved to etcd
 	CaptureInfoKeyPrefix = EtcdKeyBase + "/capture/info"
+	// ScanLimitKey is the key of the cluster-level limit of the incremental
+	// scans
+	ScanLimitKey = EtcdKeyBase + "/scan/limit"
+	// ScanQuotaKey is the key of the quotas of the incremental scans assigned
+	// to the captures by the owner
+	ScanQuotaKey = EtcdKeyBase + "/scan/quota"
+	// SchemaSnapshotKey is the key of the snapshot of the upstream schemas
+	// saved by the owner
+	SchemaSnapshotKey = EtcdKeyBase + "/schema/snapshot"
+	// ClusterPauseKey is the key of the changefeeds paused by pausing the
+	// whole cluster
+	ClusterPauseKey = EtcdKeyBase + "/cluster/pause"
 )
 
+// maxSchemaSnapshotSize is the max size in bytes of the encoded schema
+// snapshot, it's kept under the default request size limit of etcd.
+const maxSchemaSnapshotSize = 1 << 20
+
 // GetEtcdKeyChangeFeedList returns the prefix key of all changefeed config
 func GetEtcdKeyChangeFeedList() string {
 	return fmt.Sprintf("%s/changefeed/info", EtcdKeyBase)
@@ -48,9 +66,14 @@ func GetEtcdKeyChangeFeedStatus(changefeedID string) string {
 	return fmt.Sprintf("%s/changefeed/status/%s", EtcdKeyBase, changefeedID)
 }
 
+// GetEtcdKeyAllTasks returns the prefix key of the task status of all changefeeds
+func GetEtcdKeyAllTasks() string {
+	return fmt.Sprintf("%s/changefeed/task", EtcdKeyBase)
+}
+
 // GetEtcdKeyTaskList returns the key of a task status without captureID part
 func GetEtcdKeyTaskList(changefeedID string) string {
-	return fmt.Sprintf("%s/changefeed/task/%s", EtcdKeyBase, changefeedID)
+	return fmt.Sprintf("%s/%s", GetEtcdKeyAllTasks(), changefeedID)
 }
 
 // GetEtcdKeyTask returns the key of a task status
@@ -121,6 +144,24 @@ func (c CDCEtcdClient) DeleteChangeFeedInfo(ctx context.Context, id string, opts
 	return errors.Trace(err)
 }
 
+// DeleteChangeFeedStatus deletes the status of a changefeed from etcd
+func (c CDCEtcdClient) DeleteChangeFeedStatus(ctx context.Context, id string, opts ...clientv3.OpOption) error {
+	key := GetEtcdKeyChangeFeedStatus(id)
+	_, err := c.Client.Delete(ctx, key, opts...)
+	return errors.Trace(err)
+}
+
+// DeleteChangeFeed deletes the info, the status and the task status of a
+// changefeed from etcd in a transaction.
+func (c CDCEtcdClient) DeleteChangeFeed(ctx context.Context, id string) error {
+	_, err := c.Client.Txn(ctx).Then(
+		clientv3.OpDelete(GetEtcdKeyChangeFeedInfo(id)),
+		clientv3.OpDelete(GetEtcdKeyChangeFeedStatus(id)),
+		clientv3.OpDelete(GetEtcdKeyTaskList(id)+"/", clientv3.WithPrefix()),
+	).Commit()
+	return errors.Trace(err)
+}
+
 // GetChangeFeedStatus queries the checkpointTs and resovledTs of a given changefeed
 func (c CDCEtcdClient) GetChangeFeedStatus(ctx context.Context, id string, opts ...clientv3.OpOption) (*model.ChangeFeedStatus, error) {
 	key := GetEtcdKeyChangeFeedStatus(id)
@@ -136,11 +177,62 @@ func (c CDCEtcdClient) GetChangeFeedStatus(ctx context.Context, id string, opts
 	return info, errors.Trace(err)
 }
 
+// ExportChangeFeed reads the config and the replication status of a changefeed,
+// the status is nil if the changefeed has not been scheduled.
+func (c CDCEtcdClient) ExportChangeFeed(ctx context.Context, id string) (*model.ChangeFeedExport, error) {
+	info, err := c.GetChangeFeedInfo(ctx, id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	status, err := c.GetChangeFeedStatus(ctx, id)
+	if err != nil && errors.Cause(err) != model.ErrChangeFeedNotExists {
+		return nil, errors.Trace(err)
+	}
+	return &model.ChangeFeedExport{ID: id, Info: info, Status: status}, nil
+}
+
+// ImportChangeFeed creates a changefeed from an export, the changefeed starts
+// from the exported checkpoint. Admin jobs of the export are reset so that the
+// imported changefeed runs immediately. It fails if the changefeed exists.
+func (c CDCEtcdClient) ImportChangeFeed(ctx context.Context, export *model.ChangeFeedExport) error {
+	if err := model.ValidateChangeFeedID(export.ID); err != nil {
+		return errors.Trace(err)
+	}
+	info := *export.Info
+	info.AdminJobType = model.AdminNone
+	infoValue, err := info.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	infoKey := GetEtcdKeyChangeFeedInfo(export.ID)
+	ops := []clientv3.Op{clientv3.OpPut(infoKey, infoValue)}
+	if export.Status != nil {
+		status := *export.Status
+		status.AdminJobType = model.AdminNone
+		statusValue, err := status.Marshal()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		ops = append(ops, clientv3.OpPut(GetEtcdKeyChangeFeedStatus(export.ID), statusValue))
+	}
+
+	resp, err := c.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(infoKey), "=", 0),
+	).Then(ops...).Commit()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !resp.Succeeded {
+		return errors.Annotatef(model.ErrChangeFeedExists, "import changefeed %s", export.ID)
+	}
+	return nil
+}
+
 // GetCaptures returns kv revision and CaptureInfo list
 func (c CDCEtcdClient) GetCaptures(ctx context.Context, opts ...clientv3.OpOption) (int64, []*model.CaptureInfo, error) {
 	key := CaptureInfoKeyPrefix
 
-	resp, err := c.Client.Get(ctx, key, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, key, append([]clientv3.OpOption{clientv3.WithPrefix()}, opts...)...)
 	if err != nil {
 		return 0, nil, errors.Trace(err)
 	}
@@ -194,6 +286,37 @@ func (c CDCEtcdClient) GetAllTaskStatus(ctx context.Context, changefeedID string
 	return pinfo, nil
 }
 
+// GetAllTaskStatuses queries the task status of all changefeeds, and returns
+// the kv revision and a map mapping from changefeedID to the task status of
+// its captures.
+func (c CDCEtcdClient) GetAllTaskStatuses(ctx context.Context, opts ...clientv3.OpOption) (int64, map[string]model.ProcessorsInfos, error) {
+	prefix := GetEtcdKeyAllTasks() + "/"
+	resp, err := c.Client.Get(ctx, prefix, append([]clientv3.OpOption{clientv3.WithPrefix()}, opts...)...)
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	infos := make(map[string]model.ProcessorsInfos)
+	for _, rawKv := range resp.Kvs {
+		key := strings.TrimPrefix(string(rawKv.Key), prefix)
+		i := strings.LastIndex(key, "/")
+		if i <= 0 {
+			return 0, nil, errors.Errorf("invalid task status key: %s", rawKv.Key)
+		}
+		changefeedID, captureID := key[:i], key[i+1:]
+		info := &model.TaskStatus{}
+		err = info.Unmarshal(rawKv.Value)
+		if err != nil {
+			return 0, nil, errors.Trace(err)
+		}
+		info.ModRevision = rawKv.ModRevision
+		if _, ok := infos[changefeedID]; !ok {
+			infos[changefeedID] = make(model.ProcessorsInfos)
+		}
+		infos[changefeedID][captureID] = info
+	}
+	return resp.Header.Revision, infos, nil
+}
+
 // GetTaskStatus queries task status from etcd, returns
 //  - ModRevision of the given key
 //  - *model.TaskStatus unmarshaled from the value
@@ -268,6 +391,24 @@ func (c CDCEtcdClient) DeleteTaskStatus(
 	return errors.Trace(err)
 }
 
+// DeleteTaskStatusIfNotModified deletes the task status from etcd if it's not
+// modified since modRevision, it returns false if the task status is modified.
+func (c CDCEtcdClient) DeleteTaskStatusIfNotModified(
+	ctx context.Context,
+	cfID string,
+	captureID string,
+	modRevision int64,
+) (bool, error) {
+	key := GetEtcdKeyTask(cfID, captureID)
+	resp, err := c.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(key), "=", modRevision),
+	).Then(clientv3.OpDelete(key)).Commit()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return resp.Succeeded, nil
+}
+
 // PutCaptureInfo put capture info into etcd.
 func (c CDCEtcdClient) PutCaptureInfo(ctx context.Context, info *model.CaptureInfo, opts ...clientv3.OpOption) error {
 	data, err := info.Marshal()
@@ -309,3 +450,132 @@ func (c CDCEtcdClient) GetCaptureInfo(ctx context.Context, id string, opts ...cl
 
 	return
 }
+
+// GetScanLimit gets the limit of the incremental scans, the limit is disabled
+// if it's not set.
+func (c CDCEtcdClient) GetScanLimit(ctx context.Context) (*model.ScanLimit, error) {
+	resp, err := c.Client.Get(ctx, ScanLimitKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	limit := &model.ScanLimit{}
+	if len(resp.Kvs) == 0 {
+		return limit, nil
+	}
+	err = limit.Unmarshal(resp.Kvs[0].Value)
+	return limit, errors.Trace(err)
+}
+
+// PutScanLimit puts the limit of the incremental scans into etcd.
+func (c CDCEtcdClient) PutScanLimit(ctx context.Context, limit *model.ScanLimit) error {
+	data, err := limit.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = c.Client.Put(ctx, ScanLimitKey, string(data))
+	return errors.Trace(err)
+}
+
+// GetScanQuota gets the quotas of the incremental scans of the captures, it's
+// nil if the scans are not limited.
+func (c CDCEtcdClient) GetScanQuota(ctx context.Context) (model.ScanQuota, error) {
+	resp, err := c.Client.Get(ctx, ScanQuotaKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	var quota model.ScanQuota
+	err = quota.Unmarshal(resp.Kvs[0].Value)
+	return quota, errors.Trace(err)
+}
+
+// PutScanQuota puts the quotas of the incremental scans of the captures into
+// etcd, the quotas are deleted if it's nil.
+func (c CDCEtcdClient) PutScanQuota(ctx context.Context, quota model.ScanQuota) error {
+	if quota == nil {
+		_, err := c.Client.Delete(ctx, ScanQuotaKey)
+		return errors.Trace(err)
+	}
+	data, err := quota.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = c.Client.Put(ctx, ScanQuotaKey, string(data))
+	return errors.Trace(err)
+}
+
+// GetSchemaSnapshot gets the snapshot of the upstream schemas, it's nil if no
+// snapshot is saved.
+func (c CDCEtcdClient) GetSchemaSnapshot(ctx context.Context) (*schema.Snapshot, error) {
+	resp, err := c.Client.Get(ctx, SchemaSnapshotKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	snap := &schema.Snapshot{}
+	if err := snap.Unmarshal(resp.Kvs[0].Value); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return snap, nil
+}
+
+// PutSchemaSnapshot puts the snapshot of the upstream schemas into etcd, it
+// fails if the encoded snapshot is larger than maxSchemaSnapshotSize.
+func (c CDCEtcdClient) PutSchemaSnapshot(ctx context.Context, snap *schema.Snapshot) error {
+	data, err := snap.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(data) > maxSchemaSnapshotSize {
+		return errors.Errorf("the schema snapshot of %d bytes exceeds the limit %d bytes", len(data), maxSchemaSnapshotSize)
+	}
+	_, err = c.Client.Put(ctx, SchemaSnapshotKey, string(data))
+	return errors.Trace(err)
+}
+
+// GetClusterPause gets the changefeeds paused by pausing the cluster, it's nil
+// if the cluster isn't paused.
+func (c CDCEtcdClient) GetClusterPause(ctx context.Context) (*model.ClusterPause, error) {
+	resp, err := c.Client.Get(ctx, ClusterPauseKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	pause := &model.ClusterPause{}
+	if err := pause.Unmarshal(resp.Kvs[0].Value); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return pause, nil
+}
+
+// CreateClusterPause puts the changefeeds paused by pausing the cluster into
+// etcd, it fails with ErrClusterPaused if the cluster is already paused.
+func (c CDCEtcdClient) CreateClusterPause(ctx context.Context, pause *model.ClusterPause) error {
+	data, err := pause.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp, err := c.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(ClusterPauseKey), "=", 0),
+	).Then(clientv3.OpPut(ClusterPauseKey, string(data))).Commit()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !resp.Succeeded {
+		return errors.Trace(model.ErrClusterPaused)
+	}
+	return nil
+}
+
+// DeleteClusterPause deletes the changefeeds paused by pausing the cluster
+// after they are resumed.
+func (c CDCEtcdClient) DeleteClusterPause(ctx context.Context) error {
+	_, err := c.Client.Delete(ctx, ClusterPauseKey)
+	return errors.Trace(err)
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
 	"github.com/pingcap/ticdc/pkg/etcd"
 	"github.com/pingcap/ticdc/pkg/util"
 	"go.etcd.io/etcd/clientv3"
@@ -145,6 +146,42 @@ func (s *etcdSuite) TestDeleteTaskStatus(c *check.C) {
 	c.Assert(errors.Cause(err), check.Equals, model.ErrTaskStatusNotExists)
 }
 
+func (s *etcdSuite) TestGetAllTaskStatuses(c *check.C) {
+	ctx := context.Background()
+	info := &model.TaskStatus{
+		CheckPointTs: 100,
+		ResolvedTs:   200,
+		TableInfos: []*model.ProcessTableInfo{
+			{ID: 1, StartTs: 100},
+		},
+	}
+	for _, key := range [][2]string{{"feed1", "capture1"}, {"feed1", "capture2"}, {"feed2", "capture1"}} {
+		err := s.client.PutTaskStatus(ctx, key[0], key[1], info)
+		c.Assert(err, check.IsNil)
+	}
+
+	_, infos, err := s.client.GetAllTaskStatuses(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(infos, check.HasLen, 2)
+	c.Assert(infos["feed1"], check.HasLen, 2)
+	c.Assert(infos["feed2"], check.HasLen, 1)
+	c.Assert(infos["feed2"]["capture1"].TableInfos, check.DeepEquals, info.TableInfos)
+
+	// the task status modified after it's read is not deleted
+	modRevision := infos["feed1"]["capture1"].ModRevision
+	err = s.client.PutTaskStatus(ctx, "feed1", "capture1", info)
+	c.Assert(err, check.IsNil)
+	deleted, err := s.client.DeleteTaskStatusIfNotModified(ctx, "feed1", "capture1", modRevision)
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.IsFalse)
+
+	deleted, err = s.client.DeleteTaskStatusIfNotModified(ctx, "feed2", "capture1", infos["feed2"]["capture1"].ModRevision)
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.IsTrue)
+	_, _, err = s.client.GetTaskStatus(ctx, "feed2", "capture1")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrTaskStatusNotExists)
+}
+
 func (s *etcdSuite) TestOpChangeFeedDetail(c *check.C) {
 	ctx := context.Background()
 	detail := &model.ChangeFeedInfo{
@@ -165,3 +202,135 @@ func (s *etcdSuite) TestOpChangeFeedDetail(c *check.C) {
 	_, err = s.client.GetChangeFeedInfo(ctx, cfID)
 	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
 }
+
+func (s *etcdSuite) TestDeleteChangeFeed(c *check.C) {
+	ctx := context.Background()
+	for _, cfID := range []string{"test-cf-1", "test-cf-2"} {
+		err := s.client.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{}, cfID)
+		c.Assert(err, check.IsNil)
+		err = s.client.PutChangeFeedStatus(ctx, cfID, &model.ChangeFeedStatus{CheckpointTs: 10})
+		c.Assert(err, check.IsNil)
+		err = s.client.PutTaskStatus(ctx, cfID, "capture-1", &model.TaskStatus{})
+		c.Assert(err, check.IsNil)
+	}
+
+	err := s.client.DeleteChangeFeed(ctx, "test-cf-1")
+	c.Assert(err, check.IsNil)
+	_, err = s.client.GetChangeFeedInfo(ctx, "test-cf-1")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+	_, err = s.client.GetChangeFeedStatus(ctx, "test-cf-1")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+	tasks, err := s.client.GetAllTaskStatus(ctx, "test-cf-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks, check.HasLen, 0)
+
+	// the other changefeed is kept
+	_, err = s.client.GetChangeFeedInfo(ctx, "test-cf-2")
+	c.Assert(err, check.IsNil)
+	tasks, err = s.client.GetAllTaskStatus(ctx, "test-cf-2")
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks, check.HasLen, 1)
+
+	err = s.client.DeleteChangeFeedStatus(ctx, "test-cf-2")
+	c.Assert(err, check.IsNil)
+	_, err = s.client.GetChangeFeedStatus(ctx, "test-cf-2")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+}
+
+func (s *etcdSuite) TestExportImportChangeFeed(c *check.C) {
+	ctx := context.Background()
+	id := "test-export"
+	info := &model.ChangeFeedInfo{SinkURI: "root@tcp(127.0.0.1:3306)/", StartTs: 10, Opts: map[string]string{}}
+	err := s.client.SaveChangeFeedInfo(ctx, info, id)
+	c.Assert(err, check.IsNil)
+
+	export, err := s.client.ExportChangeFeed(ctx, id)
+	c.Assert(err, check.IsNil)
+	c.Assert(export.Status, check.IsNil)
+	c.Assert(export.CheckpointTs(), check.Equals, uint64(10))
+
+	status := &model.ChangeFeedStatus{ResolvedTs: 200, CheckpointTs: 100, AdminJobType: model.AdminStop}
+	err = s.client.PutChangeFeedStatus(ctx, id, status)
+	c.Assert(err, check.IsNil)
+	export, err = s.client.ExportChangeFeed(ctx, id)
+	c.Assert(err, check.IsNil)
+	c.Assert(export.Status, check.DeepEquals, status)
+	c.Assert(export.CheckpointTs(), check.Equals, uint64(100))
+
+	err = s.client.ImportChangeFeed(ctx, export)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedExists)
+
+	export.ID = "test-import"
+	err = s.client.ImportChangeFeed(ctx, export)
+	c.Assert(err, check.IsNil)
+	imported, err := s.client.GetChangeFeedStatus(ctx, export.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(imported.CheckpointTs, check.Equals, uint64(100))
+	c.Assert(imported.AdminJobType, check.Equals, model.AdminNone)
+	importedInfo, err := s.client.GetChangeFeedInfo(ctx, export.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(importedInfo.SinkURI, check.Equals, info.SinkURI)
+}
+
+func (s *etcdSuite) TestGetPutScanLimit(c *check.C) {
+	ctx := context.Background()
+	limit, err := s.client.GetScanLimit(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, &model.ScanLimit{})
+	quota, err := s.client.GetScanQuota(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(quota, check.IsNil)
+
+	err = s.client.PutScanLimit(ctx, &model.ScanLimit{Global: 10, PerCapture: 4})
+	c.Assert(err, check.IsNil)
+	limit, err = s.client.GetScanLimit(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, &model.ScanLimit{Global: 10, PerCapture: 4})
+
+	err = s.client.PutScanQuota(ctx, model.ScanQuota{"a": 4, "b": 4})
+	c.Assert(err, check.IsNil)
+	quota, err = s.client.GetScanQuota(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(quota, check.DeepEquals, model.ScanQuota{"a": 4, "b": 4})
+	err = s.client.PutScanQuota(ctx, nil)
+	c.Assert(err, check.IsNil)
+	quota, err = s.client.GetScanQuota(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(quota, check.IsNil)
+}
+
+func (s *etcdSuite) TestGetPutSchemaSnapshot(c *check.C) {
+	ctx := context.Background()
+	snap, err := s.client.GetSchemaSnapshot(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(snap, check.IsNil)
+
+	err = s.client.PutSchemaSnapshot(ctx, &schema.Snapshot{Ts: 100, SchemaVersion: 3, TruncateTableIDs: []int64{1}})
+	c.Assert(err, check.IsNil)
+	snap, err = s.client.GetSchemaSnapshot(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(snap, check.DeepEquals, &schema.Snapshot{Ts: 100, SchemaVersion: 3, TruncateTableIDs: []int64{1}})
+}
+
+func (s *etcdSuite) TestCreateDeleteClusterPause(c *check.C) {
+	ctx := context.Background()
+	pause, err := s.client.GetClusterPause(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(pause, check.IsNil)
+
+	pausedAt := time.Date(2020, 3, 13, 16, 43, 0, 0, time.UTC)
+	err = s.client.CreateClusterPause(ctx, &model.ClusterPause{PausedAt: pausedAt, Changefeeds: []string{"a", "b"}})
+	c.Assert(err, check.IsNil)
+	err = s.client.CreateClusterPause(ctx, &model.ClusterPause{PausedAt: pausedAt})
+	c.Assert(errors.Cause(err), check.Equals, model.ErrClusterPaused)
+	pause, err = s.client.GetClusterPause(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(pause.PausedAt.Equal(pausedAt), check.IsTrue)
+	c.Assert(pause.Changefeeds, check.DeepEquals, []string{"a", "b"})
+
+	err = s.client.DeleteClusterPause(ctx)
+	c.Assert(err, check.IsNil)
+	pause, err = s.client.GetClusterPause(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(pause, check.IsNil)
+}
@@ -30,6 +30,13 @@ var (
 			Name:      "event_feed_count",
 			Help:      "The number of event feed running",
 		})
+	scanningRegionGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "kvclient",
+			Name:      "scanning_region_count",
+			Help:      "The number of regions in the incremental scan",
+		})
 	scanRegionsDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "ticdc",
@@ -46,6 +53,13 @@ var (
 			Help:      "Size of KV events.",
 			Buckets:   prometheus.ExponentialBuckets(16, 2, 25),
 		}, []string{"captureID"})
+	replayedEventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "kvclient",
+			Name:      "replayed_event_count",
+			Help:      "The number of KV events replayed by TiKV after a stream error and skipped.",
+		}, []string{"captureID"})
 )
 
 // InitMetrics registers all metrics in the kv package
@@ -54,4 +68,6 @@ func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(scanRegionsDuration)
 	registry.MustRegister(eventSize)
 	registry.MustRegister(eventFeedGauge)
+	registry.MustRegister(replayedEventCounter)
+	registry.MustRegister(scanningRegionGauge)
 }
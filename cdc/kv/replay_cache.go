@@ -0,0 +1,90 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// defaultReplayCacheSize is the number of the recent events kept for each
+// region.
+const defaultReplayCacheSize = 256
+
+type replayKey struct {
+	key      string
+	commitTs uint64
+	opType   model.OpType
+}
+
+// replayCache is a ring buffer of the recent committed events emitted by the
+// EventFeed of a region. After a transient stream error the EventFeed resumes
+// from the last resolved ts, and the events replayed by the incremental scan
+// of TiKV are found in the cache and not emitted again.
+type replayCache struct {
+	ring  []replayKey
+	head  int
+	size  int
+	index map[replayKey]int
+}
+
+func newReplayCache(capacity int) *replayCache {
+	return &replayCache{
+		ring:  make([]replayKey, capacity),
+		index: make(map[replayKey]int),
+	}
+}
+
+// add records an emitted event, the oldest event is dropped if the cache is full.
+func (c *replayCache) add(entry *model.RawKVEntry) {
+	if len(c.ring) == 0 {
+		return
+	}
+	if c.size == len(c.ring) {
+		c.pop()
+	}
+	key := replayKey{key: string(entry.Key), commitTs: entry.Ts, opType: entry.OpType}
+	c.ring[(c.head+c.size)%len(c.ring)] = key
+	c.size++
+	c.index[key]++
+}
+
+// emitted tells whether the event has been emitted since the last resolved ts.
+func (c *replayCache) emitted(entry *model.RawKVEntry) bool {
+	_, ok := c.index[replayKey{key: string(entry.Key), commitTs: entry.Ts, opType: entry.OpType}]
+	return ok
+}
+
+// resolve drops the events no later than the resolved ts, they are not
+// replayed by an EventFeed starting from the resolved ts.
+func (c *replayCache) resolve(ts uint64) {
+	for c.size > 0 && c.ring[c.head].commitTs <= ts {
+		c.pop()
+	}
+}
+
+func (c *replayCache) len() int {
+	return c.size
+}
+
+func (c *replayCache) pop() {
+	key := c.ring[c.head]
+	if c.index[key] <= 1 {
+		delete(c.index, key)
+	} else {
+		c.index[key]--
+	}
+	c.ring[c.head] = replayKey{}
+	c.head = (c.head + 1) % len(c.ring)
+	c.size--
+}
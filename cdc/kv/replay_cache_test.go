@@ -0,0 +1,79 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type replayCacheSuite struct{}
+
+var _ = check.Suite(&replayCacheSuite{})
+
+func newReplayEntry(key string, ts uint64) *model.RawKVEntry {
+	return &model.RawKVEntry{OpType: model.OpTypePut, Key: []byte(key), Ts: ts}
+}
+
+func (s *replayCacheSuite) TestReplayCache(c *check.C) {
+	cache := newReplayCache(3)
+	cache.add(newReplayEntry("k1", 1))
+	cache.add(newReplayEntry("k2", 2))
+	cache.add(newReplayEntry("k3", 3))
+	c.Assert(cache.len(), check.Equals, 3)
+	c.Assert(cache.emitted(newReplayEntry("k1", 1)), check.IsTrue)
+	c.Assert(cache.emitted(newReplayEntry("k1", 2)), check.IsFalse)
+	c.Assert(cache.emitted(&model.RawKVEntry{OpType: model.OpTypeDelete, Key: []byte("k1"), Ts: 1}), check.IsFalse)
+
+	// the oldest event is dropped if the cache is full
+	cache.add(newReplayEntry("k4", 4))
+	c.Assert(cache.len(), check.Equals, 3)
+	c.Assert(cache.emitted(newReplayEntry("k1", 1)), check.IsFalse)
+	c.Assert(cache.emitted(newReplayEntry("k4", 4)), check.IsTrue)
+
+	cache.resolve(3)
+	c.Assert(cache.len(), check.Equals, 1)
+	c.Assert(cache.emitted(newReplayEntry("k3", 3)), check.IsFalse)
+	c.Assert(cache.emitted(newReplayEntry("k4", 4)), check.IsTrue)
+	cache.resolve(4)
+	c.Assert(cache.len(), check.Equals, 0)
+
+	disabled := newReplayCache(0)
+	disabled.add(newReplayEntry("k1", 1))
+	c.Assert(disabled.emitted(newReplayEntry("k1", 1)), check.IsFalse)
+}
+
+func (s *replayCacheSuite) TestEmitCommitted(c *check.C) {
+	ctx := context.Background()
+	cache := newReplayCache(10)
+	eventCh := make(chan *model.RegionFeedEvent, 10)
+	for _, ts := range []uint64{5, 6} {
+		err := emitCommitted(ctx, &model.RegionFeedEvent{Val: newReplayEntry("k", ts)}, cache, 4, eventCh)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(eventCh, check.HasLen, 2)
+
+	// the EventFeed resumes from the checkpoint 5, the event at 6 is replayed
+	for _, ts := range []uint64{6, 7} {
+		err := emitCommitted(ctx, &model.RegionFeedEvent{Val: newReplayEntry("k", ts)}, cache, 5, eventCh)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(eventCh, check.HasLen, 3)
+	<-eventCh
+	<-eventCh
+	c.Assert((<-eventCh).Val.Ts, check.Equals, uint64(7))
+	c.Assert(cache.len(), check.Equals, 2)
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// scanLimiter limits the number of the incremental scans of the regions
+// running in the process. The limit can be changed while the scans are
+// waiting, and the scans are not limited if it isn't positive.
+type scanLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	// changed is closed and replaced when a scan finishes or the limit
+	// changes, so the waiting scans check the limit again.
+	changed chan struct{}
+}
+
+func newScanLimiter() *scanLimiter {
+	return &scanLimiter{changed: make(chan struct{})}
+}
+
+// regionScanLimiter limits the scans of all the EventFeeds of the capture.
+var regionScanLimiter = newScanLimiter()
+
+// SetScanQuota sets the max number of the incremental scans of the regions
+// running in the capture, the scans are not limited if it isn't positive.
+func SetScanQuota(quota int) {
+	regionScanLimiter.setLimit(quota)
+}
+
+// acquire waits until the scan can start.
+func (l *scanLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.limit <= 0 || l.running < l.limit {
+			l.running++
+			l.mu.Unlock()
+			scanningRegionGauge.Inc()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// release is called when a scan acquired finishes.
+func (l *scanLimiter) release() {
+	scanningRegionGauge.Dec()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.notify()
+}
+
+func (l *scanLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit == limit {
+		return
+	}
+	l.limit = limit
+	l.notify()
+}
+
+func (l *scanLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type scanLimiterSuite struct{}
+
+var _ = check.Suite(&scanLimiterSuite{})
+
+func (s *scanLimiterSuite) TestAcquire(c *check.C) {
+	ctx := context.Background()
+	l := newScanLimiter()
+	// the scans are not limited by default
+	for i := 0; i < 3; i++ {
+		c.Assert(l.acquire(ctx), check.IsNil)
+	}
+	l.setLimit(3)
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("the scan starts beyond the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release()
+	c.Assert(<-acquired, check.IsNil)
+
+	// raising the limit wakes up the waiting scans
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	l.setLimit(4)
+	c.Assert(<-acquired, check.IsNil)
+
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		acquired <- l.acquire(cctx)
+	}()
+	cancel()
+	c.Assert(<-acquired, check.ErrorMatches, "context canceled")
+	c.Assert(l.running, check.Equals, 4)
+}
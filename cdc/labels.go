@@ -0,0 +1,54 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// labelsField attaches the labels of a changefeed to a log entry, it's skipped
+// if the changefeed has no labels.
+func labelsField(labels map[string]string) zap.Field {
+	if len(labels) == 0 {
+		return zap.Skip()
+	}
+	return zap.String("labels", model.LabelsString(labels))
+}
+
+// changefeedLabels returns the labels of the changefeed run by the owner, it's
+// nil if the changefeed isn't running.
+func (o *ownerImpl) changefeedLabels(id model.ChangeFeedID) map[string]string {
+	if cf, ok := o.changeFeeds[id]; ok {
+		return cf.labels()
+	}
+	return nil
+}
+
+// setChangefeedLabelMetrics exports the labels of the changefeed as an info
+// metric, the metrics of the changefeed are attributed to its labels by
+// joining on the changefeed label.
+func setChangefeedLabelMetrics(id model.ChangeFeedID, labels map[string]string) {
+	for key, value := range labels {
+		changefeedLabelGauge.WithLabelValues(id, key, value).Set(1)
+	}
+}
+
+// deleteChangefeedLabelMetrics deletes the info metric of the labels of the
+// changefeed once it's not run by the owner.
+func deleteChangefeedLabelMetrics(id model.ChangeFeedID, labels map[string]string) {
+	for key, value := range labels {
+		changefeedLabelGauge.DeleteLabelValues(id, key, value)
+	}
+}
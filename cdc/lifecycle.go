@@ -0,0 +1,142 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// the types of the lifecycle events of the changefeeds
+const (
+	// the changefeed is started by the owner for the first time
+	LifecycleCreated = "created"
+	// the changefeed is stopped by users or by an error
+	LifecyclePaused = "paused"
+	// the changefeed meets an error, it's paused then
+	LifecycleErrored = "errored"
+	LifecycleResumed = "resumed"
+	LifecycleRemoved = "removed"
+	// the checkpoint of the changefeed reaches the target ts
+	LifecycleFinished = "finished"
+	// the changefeed meets an error after it's restarted for the limited
+	// times, it's left stopped until users resume it
+	LifecycleFailed = "failed"
+	// the tables of the changefeed are dispatched to the captures
+	LifecycleRebalanced = "rebalanced"
+)
+
+// the codes of the errors of the errored events
+const (
+	// a processor of the changefeed fails
+	LifecycleErrProcessor = "processor-error"
+	// a DDL fails in the downstream or isn't replicated by the policy
+	LifecycleErrDDL = "ddl-failed"
+)
+
+// lifecycleQueueSize is the number of the events pending in the notifier, the
+// new events are dropped if the webhook can't catch up.
+const lifecycleQueueSize = 1024
+
+// lifecycleWebhook is the webhook the owner publishes the lifecycle events of
+// all the changefeeds to, it's empty if the events are not published.
+var lifecycleWebhook string
+
+// LifecycleEvent is the body POSTed to the lifecycle webhook when the state of
+// a changefeed changes.
+type LifecycleEvent struct {
+	Changefeed   string    `json:"changefeed"`
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	CheckpointTs uint64    `json:"checkpoint-ts,omitempty"`
+	// Code and Message describe the error of an errored event.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	Capture string `json:"capture,omitempty"`
+	// Tables is the number of the tables dispatched by a rebalanced event.
+	Tables int `json:"tables,omitempty"`
+}
+
+// lifecycleNotifier publishes the lifecycle events of the changefeeds to the
+// webhook in the background, so a slow webhook doesn't block the owner. The
+// events are published in order. A nil notifier drops all the events.
+type lifecycleNotifier struct {
+	url    string
+	client *http.Client
+
+	queue  chan *LifecycleEvent
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newLifecycleNotifier(url string) *lifecycleNotifier {
+	if url == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &lifecycleNotifier{
+		url:    url,
+		client: &http.Client{Timeout: ddlNotifyTimeout},
+		queue:  make(chan *LifecycleEvent, lifecycleQueueSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go n.run(ctx)
+	return n
+}
+
+// publish queues the event of the changefeed.
+func (n *lifecycleNotifier) publish(id model.ChangeFeedID, typ string, event LifecycleEvent) {
+	if n == nil {
+		return
+	}
+	event.Changefeed = id
+	event.Type = typ
+	event.Time = time.Now()
+	select {
+	case n.queue <- &event:
+	default:
+		log.Warn("too many pending lifecycle events, drop it",
+			zap.String("changefeed", id), zap.String("type", typ))
+	}
+}
+
+func (n *lifecycleNotifier) run(ctx context.Context) {
+	defer close(n.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-n.queue:
+			if err := postWebhook(ctx, n.client, n.url, event); err != nil {
+				log.Warn("publish lifecycle event failed", zap.String("changefeed", event.Changefeed),
+					zap.String("type", event.Type), zap.String("url", n.url), zap.Error(err))
+			}
+		}
+	}
+}
+
+// close stops the notifier, the pending events are dropped.
+func (n *lifecycleNotifier) close() {
+	if n == nil {
+		return
+	}
+	n.cancel()
+	<-n.done
+}
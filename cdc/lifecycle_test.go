@@ -0,0 +1,73 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type lifecycleSuite struct{}
+
+var _ = check.Suite(&lifecycleSuite{})
+
+func (s *lifecycleSuite) TestPublish(c *check.C) {
+	received := make(chan *LifecycleEvent, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.Method, check.Equals, http.MethodPost)
+		event := new(LifecycleEvent)
+		c.Assert(json.NewDecoder(req.Body).Decode(event), check.IsNil)
+		received <- event
+	}))
+	defer server.Close()
+
+	notifier := newLifecycleNotifier(server.URL)
+	defer notifier.close()
+	notifier.publish("cf", LifecycleCreated, LifecycleEvent{CheckpointTs: 100})
+	notifier.publish("cf", LifecycleErrored, LifecycleEvent{
+		CheckpointTs: 110,
+		Code:         LifecycleErrProcessor,
+		Message:      "sink failed",
+		Capture:      "capture-1",
+	})
+	notifier.publish("cf", LifecycleRebalanced, LifecycleEvent{CheckpointTs: 120, Tables: 2})
+
+	expected := []LifecycleEvent{
+		{Type: LifecycleCreated, CheckpointTs: 100},
+		{Type: LifecycleErrored, CheckpointTs: 110, Code: LifecycleErrProcessor, Message: "sink failed", Capture: "capture-1"},
+		{Type: LifecycleRebalanced, CheckpointTs: 120, Tables: 2},
+	}
+	for _, exp := range expected {
+		select {
+		case event := <-received:
+			c.Assert(event.Changefeed, check.Equals, "cf")
+			c.Assert(event.Time.IsZero(), check.IsFalse)
+			event.Changefeed, event.Time = "", time.Time{}
+			c.Assert(*event, check.DeepEquals, exp)
+		case <-time.After(10 * time.Second):
+			c.Fatal("event not received")
+		}
+	}
+}
+
+func (s *lifecycleSuite) TestNilNotifier(c *check.C) {
+	notifier := newLifecycleNotifier("")
+	c.Assert(notifier, check.IsNil)
+	notifier.publish("cf", LifecycleCreated, LifecycleEvent{})
+	notifier.close()
+}
@@ -14,8 +14,10 @@
 package cdc
 
 import (
+	"github.com/pingcap/ticdc/cdc/entry"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -25,7 +27,10 @@ func init() {
 	registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 	registry.MustRegister(prometheus.NewGoCollector())
 
+	entry.InitMetrics(registry)
 	kv.InitMetrics(registry)
 	puller.InitMetrics(registry)
+	sink.InitMetrics(registry)
 	initProcessorMetrics(registry)
+	initOwnerMetrics(registry)
 }
@@ -0,0 +1,57 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	autoResumeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "auto_resume_count",
+			Help:      "The number of paused changefeeds resumed or given up by the owner after probing the downstream.",
+		}, []string{"changefeed", "result"})
+	changefeedLabelGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "changefeed_label",
+			Help:      "The labels of the changefeeds run by the owner, the value is always 1.",
+		}, []string{"changefeed", "label", "value"})
+	ownerTakeoverCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "takeover_count",
+			Help:      "The number of the times the capture takes over the owner.",
+		})
+	orphanTaskCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "orphan_task_cleaned_count",
+			Help:      "The number of task status of the dead captures cleaned by the owner.",
+		}, []string{"changefeed", "action"})
+)
+
+// initOwnerMetrics registers all metrics used in owner
+func initOwnerMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(autoResumeCounter)
+	registry.MustRegister(changefeedLabelGauge)
+	registry.MustRegister(ownerTakeoverCounter)
+	registry.MustRegister(orphanTaskCounter)
+}
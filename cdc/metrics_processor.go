@@ -53,6 +53,34 @@ var (
 			Name:      "txn_count",
 			Help:      "txn count received/executed by this processor",
 		}, []string{"type", "changefeed", "capture"})
+	duplicateEventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "duplicate_event_count",
+			Help:      "row events redelivered by the puller and suppressed by this processor",
+		}, []string{"changefeed", "capture"})
+	tableEligibilityCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "table_eligibility_change_count",
+			Help:      "tables losing or gaining their unique keys by the DDLs",
+		}, []string{"type", "changefeed", "capture"})
+	memoryQuotaUsedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "memory_quota_used_bytes",
+			Help:      "bytes of the changes buffered by the processor in the sorters, the tables and the sink",
+		}, []string{"changefeed", "capture", "stage"})
+	memoryQuotaWaitDuration = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "memory_quota_wait_seconds",
+			Help:      "seconds the tables stop pulling the changes to wait for the memory quota",
+		}, []string{"changefeed", "capture"})
 	updateInfoDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "ticdc",
@@ -70,5 +98,9 @@ func initProcessorMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(checkpointTsGauge)
 	registry.MustRegister(syncTableNumGauge)
 	registry.MustRegister(txnCounter)
+	registry.MustRegister(duplicateEventCounter)
+	registry.MustRegister(tableEligibilityCounter)
+	registry.MustRegister(memoryQuotaUsedGauge)
+	registry.MustRegister(memoryQuotaWaitDuration)
 	registry.MustRegister(updateInfoDuration)
 }
@@ -22,6 +22,18 @@ import (
 // CaptureInfo store in etcd.
 type CaptureInfo struct {
 	ID string `json:"id"`
+	// Draining is set by the capture before it shuts down, the owner moves
+	// its tables to the other captures and dispatches no table to it.
+	Draining bool `json:"draining,omitempty"`
+	// Labels are the key=value pairs of the capture like zone=z1, the
+	// placement rules of the changefeeds select the captures by them.
+	Labels map[string]string `json:"labels,omitempty"`
+	// MaxTables is the max number of the tables of all the changefeeds in the
+	// capture, zero means no limit.
+	MaxTables int `json:"max-tables,omitempty"`
+	// Dedicated is set if the capture only takes the changefeeds whose
+	// placement rules select it.
+	Dedicated bool `json:"dedicated,omitempty"`
 }
 
 // Marshal using json.Marshal.
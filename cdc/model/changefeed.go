@@ -16,6 +16,7 @@ package model
 import (
 	"encoding/json"
 	"math"
+	"regexp"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -35,6 +36,53 @@ type ChangeFeedInfo struct {
 	AdminJobType AdminJobType `json:"admin-job-type"`
 
 	Config *ReplicaConfig `json:"config"`
+	// Features are the feature flags set on the changefeed, the flags not set
+	// follow the sink uri or the defaults.
+	Features map[string]bool `json:"features,omitempty"`
+	// Labels are the key=value pairs attributing the changefeed to its owning
+	// team or service, they are attached to its logs and metrics.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Error is the fatal error stopping the changefeed, it's cleared when the
+	// changefeed is resumed.
+	Error *RunningError `json:"error,omitempty"`
+	// Restart is the state of restarting the changefeed stopped by errors,
+	// it's cleared when the changefeed is resumed by users.
+	Restart *ErrorRestart `json:"restart,omitempty"`
+	// Placement constrains the captures the tables are placed to.
+	Placement *PlacementRule `json:"placement,omitempty"`
+}
+
+// PlacementRule constrains the captures the tables of a changefeed are placed
+// to.
+type PlacementRule struct {
+	// CaptureLabels are the labels the captures must have.
+	CaptureLabels map[string]string `json:"capture-labels,omitempty"`
+}
+
+// Allows returns whether the tables can be placed to the capture. A dedicated
+// capture only takes the changefeeds whose rules select it by the labels.
+func (r *PlacementRule) Allows(capture *CaptureInfo) bool {
+	if r == nil || len(r.CaptureLabels) == 0 {
+		return !capture.Dedicated
+	}
+	for key, value := range r.CaptureLabels {
+		if capture.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrorRestart is the state of restarting a changefeed stopped by errors.
+type ErrorRestart struct {
+	// Count is the number of the restarts after the errors, the changefeed
+	// fails once it reaches the limit.
+	Count int `json:"count"`
+	// LastError is when the last error stopped the changefeed.
+	LastError time.Time `json:"last-error"`
+	// NextRestart is when the changefeed is restarted, it's zero if the
+	// changefeed is running or failed.
+	NextRestart time.Time `json:"next-restart"`
 }
 
 // GetConfig returns ReplicaConfig.
@@ -81,3 +129,47 @@ func (info *ChangeFeedInfo) Unmarshal(data []byte) error {
 	err := json.Unmarshal(data, &info)
 	return errors.Annotatef(err, "Unmarshal data: %v", data)
 }
+
+var changeFeedIDRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ValidateChangeFeedID checks the changefeed ID, it's a part of the etcd keys
+// and the paths of the spilled files.
+func ValidateChangeFeedID(id ChangeFeedID) error {
+	if !changeFeedIDRe.MatchString(id) {
+		return errors.Errorf("invalid changefeed ID %q, it should only contain letters, digits, '_' and '-'", id)
+	}
+	return nil
+}
+
+// ChangeFeedExport contains the full definition and the replication position of
+// a changefeed, it is used to migrate a changefeed to another TiCDC cluster
+// attached to the same upstream.
+type ChangeFeedExport struct {
+	ID ChangeFeedID `json:"id"`
+	// ClusterID is the cluster ID of the upstream PD
+	ClusterID uint64            `json:"cluster-id"`
+	Info      *ChangeFeedInfo   `json:"info"`
+	Status    *ChangeFeedStatus `json:"status"`
+}
+
+// CheckpointTs returns the position the imported changefeed starts from.
+func (e *ChangeFeedExport) CheckpointTs() uint64 {
+	return e.Info.GetCheckpointTs(e.Status)
+}
+
+// Marshal returns the json marshal format of a ChangeFeedExport
+func (e *ChangeFeedExport) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(e, "", "  ")
+	return data, errors.Trace(err)
+}
+
+// Unmarshal unmarshals into *ChangeFeedExport from json marshal byte slice
+func (e *ChangeFeedExport) Unmarshal(data []byte) error {
+	if err := json.Unmarshal(data, e); err != nil {
+		return errors.Annotatef(err, "Unmarshal data: %s", data)
+	}
+	if e.ID == "" || e.Info == nil {
+		return errors.New("invalid changefeed export, id or info is missing")
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "github.com/pingcap/check"
+
+type changeFeedSuite struct{}
+
+var _ = check.Suite(&changeFeedSuite{})
+
+func (s *changeFeedSuite) TestValidateChangeFeedID(c *check.C) {
+	for _, id := range []string{"cf1", "order_sync-2", "9f3c1a2e-4b5d-4c6e-8f70-1a2b3c4d5e6f"} {
+		c.Assert(ValidateChangeFeedID(id), check.IsNil)
+	}
+	for _, id := range []string{"", ".", "..", "../cf1", "cf/1", "cf 1", "cf.1"} {
+		c.Assert(ValidateChangeFeedID(id), check.ErrorMatches, "invalid changefeed ID.*")
+	}
+}
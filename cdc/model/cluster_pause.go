@@ -0,0 +1,41 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// ClusterPause records the changefeeds paused by pausing the whole cluster,
+// only they are resumed by resuming the cluster, so the changefeeds stopped
+// before are left stopped.
+type ClusterPause struct {
+	PausedAt    time.Time      `json:"paused-at"`
+	Changefeeds []ChangeFeedID `json:"changefeeds"`
+}
+
+// Marshal using json.Marshal.
+func (p *ClusterPause) Marshal() ([]byte, error) {
+	data, err := json.Marshal(p)
+	return data, errors.Trace(err)
+}
+
+// Unmarshal from binary data.
+func (p *ClusterPause) Unmarshal(data []byte) error {
+	err := json.Unmarshal(data, p)
+	return errors.Annotatef(err, "Unmarshal data: %v", data)
+}
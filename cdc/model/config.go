@@ -14,6 +14,13 @@
 package model
 
 import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-tools/pkg/filter"
 )
 
@@ -22,4 +29,560 @@ type ReplicaConfig struct {
 	FilterCaseSensitive bool          `toml:"filter-case-sensitive" json:"filter-case-sensitive"`
 	FilterRules         *filter.Rules `toml:"filter-rules" json:"filter-rules"`
 	IgnoreTxnCommitTs   []uint64      `toml:"ignore-txn-commit-ts" json:"ignore-txn-commit-ts"`
+	DDL                 DDLConfig     `toml:"ddl" json:"ddl"`
+	// IsolateTableErrors pauses only the table instead of the changefeed if
+	// the sink fails with an error of a single table, like the downstream
+	// table is dropped.
+	IsolateTableErrors bool `toml:"isolate-table-errors" json:"isolate-table-errors"`
+	// SinkBufferSize is the max number of the transactions buffered by the
+	// sink of a processor, the transactions are flushed asynchronously and
+	// the checkpoint advances with the flushed ts if it's positive.
+	SinkBufferSize int `toml:"sink-buffer-size" json:"sink-buffer-size,omitempty"`
+	// RateLimit limits the rate of the changes written by the sink, so that a
+	// changefeed catching up can't saturate a shared downstream.
+	RateLimit RateLimitConfig `toml:"rate-limit" json:"rate-limit"`
+	// ProfileSampleRate enables the profiler of the row sizes and the event
+	// rates of the tables if it's positive, the size of one of every
+	// ProfileSampleRate rows is sampled.
+	ProfileSampleRate int `toml:"profile-sample-rate" json:"profile-sample-rate,omitempty"`
+	// CompactDMLs merges the changes of the same row in a batch of the sink,
+	// so only the last state of the row is written. The upstream transactions
+	// are not atomic in the downstream if it's set.
+	CompactDMLs bool `toml:"compact-dmls" json:"compact-dmls,omitempty"`
+	// CheckpointStepTxns advances the checkpoint in steps of about
+	// CheckpointStepTxns transactions between the global resolved ts if it's
+	// positive, instead of jumping to the global resolved ts, so the lag goes
+	// down smoothly and the sink flushes the checkpoint more often.
+	CheckpointStepTxns int `toml:"checkpoint-step-txns" json:"checkpoint-step-txns,omitempty"`
+	// Masking masks the values of the columns, like the emails and the phone
+	// numbers, before they are written to the sink.
+	Masking []MaskingRule `toml:"masking" json:"masking,omitempty"`
+	// CircuitBreaker stops writing to the downstream for a while after the
+	// sink fails again and again, so a struggling downstream can recover.
+	CircuitBreaker CircuitBreakerConfig `toml:"circuit-breaker" json:"circuit-breaker"`
+	// VerifyOrder verifies the order of the events written to the sink, the
+	// commit ts of the changes of a row never goes backward, and no event is
+	// at or before the flushed checkpoint. A violation fails the changefeed
+	// if it's "error", or crashes the capture if it's "panic".
+	VerifyOrder string `toml:"verify-order" json:"verify-order,omitempty"`
+	// Routes route the upstream tables to the tables of other names in the
+	// downstream, the first rule matching a table wins.
+	Routes []RouteRule `toml:"routes" json:"routes,omitempty"`
+	// SchemaGCRetentionSeconds is how long the history of the schemas, like
+	// the replaced versions of the tables and the handled DDL jobs, is
+	// retained below the checkpoint. The default retention is used if it's 0.
+	SchemaGCRetentionSeconds int `toml:"schema-gc-retention-seconds" json:"schema-gc-retention-seconds,omitempty"`
+	// IneligibleTables is the policy of the tables without a unique key, the
+	// rows of them are identified by all the columns in the downstream, which
+	// may update or delete the wrong rows. The eligibility of a table is
+	// evaluated again after a DDL adds or drops its unique key.
+	IneligibleTables string `toml:"ineligible-tables" json:"ineligible-tables,omitempty"`
+	// SnapshotIntervalSeconds applies the changes to the downstream only at
+	// the resolved ts about every SnapshotIntervalSeconds seconds if it's
+	// positive. The changes in between are buffered and compacted, and then
+	// applied in one transaction, so the downstream is always consistent at
+	// the checkpoint ts, at the cost of the freshness.
+	SnapshotIntervalSeconds int `toml:"snapshot-interval-seconds" json:"snapshot-interval-seconds,omitempty"`
+	// ConvertCharsets are the charsets of the text columns whose values are
+	// converted into utf8mb4 for the downstream, like "gbk", the values are
+	// written as they are otherwise.
+	ConvertCharsets []string `toml:"convert-charsets" json:"convert-charsets,omitempty"`
+	// Sorter sorts the changes of the tables pulled from TiKV by their commit
+	// ts before they are mounted, it spills them to the local disk if there
+	// are too many of them in memory.
+	Sorter SorterConfig `toml:"sorter" json:"sorter"`
+	// MemoryQuota limits the bytes of the changes buffered by a processor,
+	// the tables stop pulling the changes from TiKV while the quota is
+	// exceeded.
+	MemoryQuota MemoryQuotaConfig `toml:"memory-quota" json:"memory-quota"`
+	// EnableOldValue reads the old values of the changed rows from the
+	// snapshots of TiKV, so the updates are written with the old values, like
+	// the UPDATEs of the MySQL sink identifying the rows by the old values,
+	// and the deletes are written with the whole rows. Each change is read
+	// again from TiKV if it's set.
+	EnableOldValue bool `toml:"enable-old-value" json:"enable-old-value,omitempty"`
+}
+
+// ConvertibleCharsets are the charsets whose values can be converted into
+// utf8mb4. Only the TiDB versions supporting gbk write the raw bytes of the
+// other charsets, the values of latin1 columns are written in utf8 already.
+var ConvertibleCharsets = []string{"gbk"}
+
+// the policies of the tables without a unique key
+const (
+	// IneligibleTableReplicate replicates the tables anyway, it's the default
+	// policy.
+	IneligibleTableReplicate = "replicate"
+	// IneligibleTableSkip drops the changes of the tables until they have a
+	// unique key again.
+	IneligibleTableSkip = "skip"
+	// IneligibleTablePause pauses the tables like the tables paused by their
+	// sink errors, they are replicated again after resumed by users.
+	IneligibleTablePause = "pause"
+)
+
+// IneligibleTablePolicy returns the policy of the tables without a unique key.
+func (c *ReplicaConfig) IneligibleTablePolicy() string {
+	if c.IneligibleTables == "" {
+		return IneligibleTableReplicate
+	}
+	return c.IneligibleTables
+}
+
+// SnapshotInterval returns the interval of the snapshots applied to the
+// downstream, it's 0 if the changes are applied as they come.
+func (c *ReplicaConfig) SnapshotInterval() time.Duration {
+	if c.SnapshotIntervalSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(c.SnapshotIntervalSeconds) * time.Second
+}
+
+// DefaultSchemaGCRetentionSeconds is the default retention of the history of
+// the schemas below the checkpoint.
+const DefaultSchemaGCRetentionSeconds = 600
+
+// SchemaGCRetention returns the retention of the history of the schemas below
+// the checkpoint.
+func (c *ReplicaConfig) SchemaGCRetention() time.Duration {
+	if c.SchemaGCRetentionSeconds <= 0 {
+		return DefaultSchemaGCRetentionSeconds * time.Second
+	}
+	return time.Duration(c.SchemaGCRetentionSeconds) * time.Second
+}
+
+// Validate checks the replica config.
+func (c *ReplicaConfig) Validate() error {
+	if err := c.DDL.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	for i := range c.Masking {
+		if err := c.Masking[i].Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := c.CircuitBreaker.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.Sorter.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if c.MemoryQuota.ChangefeedBytes < 0 || c.MemoryQuota.TableBytes < 0 {
+		return errors.New("the options of memory-quota should not be negative")
+	}
+	for i := range c.Routes {
+		if err := c.Routes[i].Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if c.SchemaGCRetentionSeconds < 0 {
+		return errors.New("schema-gc-retention-seconds should not be negative")
+	}
+	if c.SnapshotIntervalSeconds < 0 {
+		return errors.New("snapshot-interval-seconds should not be negative")
+	}
+	if c.SnapshotIntervalSeconds > 0 && c.SinkBufferSize > 0 {
+		return errors.New("snapshot-interval-seconds is not supported with sink-buffer-size")
+	}
+	for _, cs := range c.ConvertCharsets {
+		if !isConvertibleCharset(cs) {
+			return errors.Errorf("invalid convert-charsets: %s, it should be one of %s", cs, strings.Join(ConvertibleCharsets, ", "))
+		}
+	}
+	switch c.IneligibleTables {
+	case "", IneligibleTableReplicate, IneligibleTableSkip, IneligibleTablePause:
+	default:
+		return errors.Errorf("invalid ineligible-tables: %s, it should be one of %s, %s, %s",
+			c.IneligibleTables, IneligibleTableReplicate, IneligibleTableSkip, IneligibleTablePause)
+	}
+	switch c.VerifyOrder {
+	case "", VerifyOrderError, VerifyOrderPanic:
+	default:
+		return errors.Errorf("invalid verify-order: %s, it should be %s or %s", c.VerifyOrder, VerifyOrderError, VerifyOrderPanic)
+	}
+	return nil
+}
+
+func isConvertibleCharset(cs string) bool {
+	for _, convertible := range ConvertibleCharsets {
+		if strings.EqualFold(cs, convertible) {
+			return true
+		}
+	}
+	return false
+}
+
+// the actions on the order violations found by verify-order
+const (
+	// VerifyOrderError fails the changefeed with the violation.
+	VerifyOrderError = "error"
+	// VerifyOrderPanic crashes the capture, so the state is kept for
+	// debugging.
+	VerifyOrderPanic = "panic"
+)
+
+// the types of the masking rules
+const (
+	// MaskEmail masks the local part of an email address except its first
+	// character, like "a****@example.com".
+	MaskEmail = "email"
+	// MaskPhone masks the digits of a phone number except the last 4 ones,
+	// like "+* (***) ***-4567".
+	MaskPhone = "phone"
+	// MaskHash replaces the value with the hex SHA-256 of the salt and the
+	// value, like the credit card numbers.
+	MaskHash = "hash"
+	// MaskPartial masks the characters except the KeepPrefix leading ones and
+	// the KeepSuffix trailing ones.
+	MaskPartial = "partial"
+)
+
+// MaskingRule masks the values of the columns of the tables, the values are
+// masked in the same way wherever they are, so the masked rows are still
+// identified by the masked values in the downstream. Only the string columns
+// are masked, and the columns of the primary key and the unique keys can only
+// be masked by hash.
+type MaskingRule struct {
+	// Table is the pattern of the tables like "db.users" or "db.*", it's
+	// matched case-insensitively.
+	Table   string   `toml:"table" json:"table"`
+	Columns []string `toml:"columns" json:"columns"`
+	Type    string   `toml:"type" json:"type"`
+	// Salt is prepended to the values hashed by the hash masking.
+	Salt       string `toml:"salt" json:"salt,omitempty"`
+	KeepPrefix int    `toml:"keep-prefix" json:"keep-prefix,omitempty"`
+	KeepSuffix int    `toml:"keep-suffix" json:"keep-suffix,omitempty"`
+}
+
+// Validate checks the masking rule.
+func (r *MaskingRule) Validate() error {
+	parts := strings.Split(r.Table, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.Errorf("invalid masking table: %s, it should be like schema.table", r.Table)
+	}
+	if _, err := path.Match(r.Table, ""); err != nil {
+		return errors.Errorf("invalid masking table: %s, %s", r.Table, err)
+	}
+	if len(r.Columns) == 0 {
+		return errors.Errorf("no columns are masked for table %s", r.Table)
+	}
+	switch r.Type {
+	case MaskEmail, MaskPhone, MaskPartial:
+	case MaskHash:
+		if r.Salt == "" {
+			return errors.Errorf("the salt of the hash masking for table %s is empty", r.Table)
+		}
+	default:
+		return errors.Errorf("unsupported masking type: %s, it should be one of %s, %s, %s, %s",
+			r.Type, MaskEmail, MaskPhone, MaskHash, MaskPartial)
+	}
+	if r.KeepPrefix < 0 || r.KeepSuffix < 0 {
+		return errors.Errorf("invalid keep-prefix or keep-suffix of the masking for table %s", r.Table)
+	}
+	return nil
+}
+
+// RouteRule routes the tables matched by Table to the table Target in the
+// downstream, like "test.t" to "test_shadow.t". The target may refer to the
+// upstream names by {schema} and {table}, like "{schema}_shadow.{table}".
+type RouteRule struct {
+	// Table is the pattern of the tables like "db.users" or "db.*", it's
+	// matched case-insensitively.
+	Table  string `toml:"table" json:"table"`
+	Target string `toml:"target" json:"target"`
+}
+
+// Validate checks the route rule.
+func (r *RouteRule) Validate() error {
+	parts := strings.Split(r.Table, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.Errorf("invalid route table: %s, it should be like schema.table", r.Table)
+	}
+	if _, err := path.Match(r.Table, ""); err != nil {
+		return errors.Errorf("invalid route table: %s, %s", r.Table, err)
+	}
+	parts = strings.Split(r.Target, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.Errorf("invalid route target: %s, it should be like schema.table", r.Target)
+	}
+	return nil
+}
+
+// Route returns the downstream name of the table if the rule matches it.
+func (r *RouteRule) Route(schema, table string) (string, string, bool) {
+	ok, _ := path.Match(strings.ToLower(r.Table), strings.ToLower(schema+"."+table))
+	if !ok {
+		return "", "", false
+	}
+	replacer := strings.NewReplacer("{schema}", schema, "{table}", table)
+	parts := strings.SplitN(r.Target, ".", 2)
+	return replacer.Replace(parts[0]), replacer.Replace(parts[1]), true
+}
+
+// RouteSchema returns the downstream name of the schema if the rule routes
+// all the tables of the schema to another schema by their own names, like
+// "test.*" to "test_shadow.{table}".
+func (r *RouteRule) RouteSchema(schema string) (string, bool) {
+	parts := strings.SplitN(r.Table, ".", 2)
+	targets := strings.SplitN(r.Target, ".", 2)
+	if parts[1] != "*" || targets[1] != "{table}" || strings.Contains(targets[0], "{table}") {
+		return "", false
+	}
+	ok, _ := path.Match(strings.ToLower(parts[0]), strings.ToLower(schema))
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(targets[0], "{schema}", schema, -1), true
+}
+
+// MatchTable tells whether the rule masks the columns of the table.
+func (r *MaskingRule) MatchTable(schema, table string) bool {
+	ok, _ := path.Match(strings.ToLower(r.Table), strings.ToLower(schema+"."+table))
+	return ok
+}
+
+// RateLimitConfig is the rate limit of a sink, the limits are enforced by each
+// processor of the changefeed, and a limit is disabled if it isn't positive.
+type RateLimitConfig struct {
+	// RowsPerSecond is the max number of rows written per second.
+	RowsPerSecond int `toml:"rows-per-second" json:"rows-per-second,omitempty"`
+	// BytesPerSecond is the max estimated size of rows written per second.
+	BytesPerSecond int `toml:"bytes-per-second" json:"bytes-per-second,omitempty"`
+}
+
+// Enabled returns true if any of the limits is set.
+func (c *RateLimitConfig) Enabled() bool {
+	return c.RowsPerSecond > 0 || c.BytesPerSecond > 0
+}
+
+// the default open time of the circuit breaker
+const (
+	DefaultCircuitBreakerOpenSeconds    = 10
+	DefaultCircuitBreakerMaxOpenSeconds = 300
+)
+
+// CircuitBreakerConfig is the circuit breaker of a sink. The breaker opens
+// after the sink fails FailureThreshold times in a row, and the sink isn't
+// written until the breaker has been open for OpenSeconds. Then a probe write
+// is let through, the breaker closes if it succeeds, or opens again for twice
+// as long up to MaxOpenSeconds. The breaker is disabled if FailureThreshold
+// isn't positive.
+type CircuitBreakerConfig struct {
+	FailureThreshold int `toml:"failure-threshold" json:"failure-threshold,omitempty"`
+	OpenSeconds      int `toml:"open-seconds" json:"open-seconds,omitempty"`
+	MaxOpenSeconds   int `toml:"max-open-seconds" json:"max-open-seconds,omitempty"`
+}
+
+// Enabled returns true if the circuit breaker is enabled.
+func (c *CircuitBreakerConfig) Enabled() bool {
+	return c.FailureThreshold > 0
+}
+
+// OpenDuration returns the time the breaker is open for the first time.
+func (c *CircuitBreakerConfig) OpenDuration() time.Duration {
+	if c.OpenSeconds <= 0 {
+		return DefaultCircuitBreakerOpenSeconds * time.Second
+	}
+	return time.Duration(c.OpenSeconds) * time.Second
+}
+
+// MaxOpenDuration returns the max time the breaker is open.
+func (c *CircuitBreakerConfig) MaxOpenDuration() time.Duration {
+	if c.MaxOpenSeconds <= 0 {
+		return DefaultCircuitBreakerMaxOpenSeconds * time.Second
+	}
+	return time.Duration(c.MaxOpenSeconds) * time.Second
+}
+
+// Validate checks the circuit breaker config.
+func (c *CircuitBreakerConfig) Validate() error {
+	if c.FailureThreshold < 0 || c.OpenSeconds < 0 || c.MaxOpenSeconds < 0 {
+		return errors.New("the options of circuit-breaker should not be negative")
+	}
+	if c.OpenDuration() > c.MaxOpenDuration() {
+		return errors.Errorf("the open time %s of circuit-breaker is greater than the max open time %s", c.OpenDuration(), c.MaxOpenDuration())
+	}
+	return nil
+}
+
+// SorterConfig is the config of the sorter of the changes pulled from TiKV.
+// The changes not resolved yet are kept in memory up to MaxMemoryBytes, then
+// they are sorted and spilled to a file in Dir, and the files are merged when
+// the changes are resolved. The changes are only kept in memory if
+// MaxMemoryBytes isn't positive.
+type SorterConfig struct {
+	MaxMemoryBytes int `toml:"max-memory-bytes" json:"max-memory-bytes,omitempty"`
+	// Dir is the directory of the spilled files, a directory of the
+	// changefeed under the data dir of the capture is used if it's empty,
+	// which is cleared when the processor starts.
+	Dir string `toml:"dir" json:"dir,omitempty"`
+	// MaxTxnEntries splits the transactions of more entries into parts of at
+	// most MaxTxnEntries entries when they are resolved, the parts are mounted
+	// and written one after another, so a huge transaction spilled by the
+	// sorter is never held in memory as a whole. The parts may be written in
+	// different downstream transactions, so it trades the atomicity of the
+	// transactions for the memory, and it's disabled if it isn't positive.
+	MaxTxnEntries int `toml:"max-txn-entries" json:"max-txn-entries,omitempty"`
+}
+
+// SpillEnabled returns true if the changes are spilled to the local disk.
+func (c *SorterConfig) SpillEnabled() bool {
+	return c.MaxMemoryBytes > 0
+}
+
+// Validate checks the sorter config.
+func (c *SorterConfig) Validate() error {
+	if c.MaxMemoryBytes < 0 {
+		return errors.New("max-memory-bytes of sorter should not be negative")
+	}
+	if c.MaxTxnEntries < 0 {
+		return errors.New("max-txn-entries of sorter should not be negative")
+	}
+	return nil
+}
+
+// MemoryQuotaConfig is the memory quota of the changes buffered by each
+// processor of a changefeed, and a quota is disabled if it isn't positive.
+// The changes are accounted from they are pulled until they are written by
+// the sink, including the ones not resolved yet in the sorters, which are
+// spilled to the local disk first if the sorter spills.
+type MemoryQuotaConfig struct {
+	// ChangefeedBytes is the max bytes buffered by all the tables of the
+	// processor.
+	ChangefeedBytes int64 `toml:"changefeed-bytes" json:"changefeed-bytes,omitempty"`
+	// TableBytes is the max bytes of the resolved changes of a table waiting
+	// to be written by the sink.
+	TableBytes int64 `toml:"table-bytes" json:"table-bytes,omitempty"`
+}
+
+// the policies of the DDLs failed in the downstream
+const (
+	// DDLOnErrorPause pauses the changefeed, it's the default policy.
+	DDLOnErrorPause = "pause"
+	// DDLOnErrorSkip skips the failed DDL and goes on replicating.
+	DDLOnErrorSkip = "skip"
+)
+
+// the policies of replicating the DDLs of the views and sequences
+const (
+	// DDLPolicyReplicate executes the DDLs in the downstream.
+	DDLPolicyReplicate = "replicate"
+	// DDLPolicySkip skips the DDLs.
+	DDLPolicySkip = "skip"
+	// DDLPolicyError stops the changefeed at the DDLs.
+	DDLPolicyError = "error"
+)
+
+// the policies of the DDLs of the types unsupported by TiCDC, like the types
+// introduced by the newer TiDB
+const (
+	// DDLUnsupportedPause pauses the changefeed at the DDL, it's the default
+	// policy.
+	DDLUnsupportedPause = "pause"
+	// DDLUnsupportedSkip skips the DDL with a warning, the schemas in TiCDC
+	// are not changed by it.
+	DDLUnsupportedSkip = "skip"
+	// DDLUnsupportedError fails the owner and the processors with the error.
+	DDLUnsupportedError = "error"
+)
+
+// DDLConfig is the config of executing the DDLs in the downstream.
+type DDLConfig struct {
+	// SkipTypes are the types of the DDLs not executed, like "drop table".
+	SkipTypes []string `toml:"skip-types" json:"skip-types,omitempty"`
+	// OnError is the policy of the DDLs failed in the downstream.
+	OnError string `toml:"on-error" json:"on-error,omitempty"`
+	// TrackTable is the table in the downstream recording the executed DDLs,
+	// like "tidb_cdc.ddl_history", it's only supported by the MySQL sink.
+	TrackTable string `toml:"track-table" json:"track-table,omitempty"`
+	// NotifyURL is the webhook notified of the replicated DDLs.
+	NotifyURL string `toml:"notify-url" json:"notify-url,omitempty"`
+	// View is the policy of the DDLs of the views, they are replicated by
+	// default.
+	View string `toml:"view" json:"view,omitempty"`
+	// Sequence is the policy of the DDLs of the sequences, the changefeed is
+	// stopped at them by default since MySQL doesn't support sequences.
+	Sequence string `toml:"sequence" json:"sequence,omitempty"`
+	// Unsupported is the policy of the DDLs of the types unsupported by
+	// TiCDC, the changefeed is paused at them by default.
+	Unsupported string `toml:"unsupported" json:"unsupported,omitempty"`
+}
+
+// UnsupportedPolicy returns the policy of the DDLs of the unsupported types.
+func (c *DDLConfig) UnsupportedPolicy() string {
+	if c.Unsupported == "" {
+		return DDLUnsupportedPause
+	}
+	return c.Unsupported
+}
+
+// ObjectPolicy returns the kind of the object changed by the DDL of the type,
+// view or sequence, and the policy of replicating the DDL. The kind is empty
+// for the DDLs of the other objects, which are always replicated.
+func (c *DDLConfig) ObjectPolicy(tp timodel.ActionType) (kind string, policy string) {
+	switch tp {
+	case timodel.ActionCreateView, timodel.ActionDropView:
+		if c.View == "" {
+			return "view", DDLPolicyReplicate
+		}
+		return "view", c.View
+	case timodel.ActionCreateSequence, timodel.ActionAlterSequence, timodel.ActionDropSequence:
+		if c.Sequence == "" {
+			return "sequence", DDLPolicyError
+		}
+		return "sequence", c.Sequence
+	}
+	return "", DDLPolicyReplicate
+}
+
+// Validate checks the DDL config.
+func (c *DDLConfig) Validate() error {
+	for _, name := range c.SkipTypes {
+		if _, err := ParseDDLType(name); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	switch c.OnError {
+	case "", DDLOnErrorPause, DDLOnErrorSkip:
+	default:
+		return errors.Errorf("invalid ddl on-error policy: %s", c.OnError)
+	}
+	for kind, policy := range map[string]string{"view": c.View, "sequence": c.Sequence} {
+		switch policy {
+		case "", DDLPolicyReplicate, DDLPolicySkip, DDLPolicyError:
+		default:
+			return errors.Errorf("invalid ddl %s policy: %s, it should be replicate, skip or error", kind, policy)
+		}
+	}
+	switch c.Unsupported {
+	case "", DDLUnsupportedPause, DDLUnsupportedSkip, DDLUnsupportedError:
+	default:
+		return errors.Errorf("invalid ddl unsupported policy: %s, it should be pause, skip or error", c.Unsupported)
+	}
+	if c.TrackTable != "" {
+		if parts := strings.Split(c.TrackTable, "."); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("invalid ddl track-table: %s, it should be like schema.table", c.TrackTable)
+		}
+	}
+	if c.NotifyURL != "" {
+		u, err := url.Parse(c.NotifyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid ddl notify-url: %s", c.NotifyURL)
+		}
+	}
+	return nil
+}
+
+// ParseDDLType returns the DDL type of the name, like "drop table".
+func ParseDDLType(name string) (timodel.ActionType, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	// the String of the unknown types is the same as ActionNone
+	if name != timodel.ActionNone.String() {
+		for i := 1; i <= 255; i++ {
+			if tp := timodel.ActionType(i); tp.String() == name {
+				return tp, nil
+			}
+		}
+	}
+	return timodel.ActionNone, errors.Errorf("unknown ddl type: %s", name)
 }
@@ -0,0 +1,234 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+)
+
+type configSuite struct{}
+
+var _ = check.Suite(&configSuite{})
+
+func (s *configSuite) TestValidateDDLConfig(c *check.C) {
+	cfg := &DDLConfig{
+		SkipTypes:  []string{"drop table", " ADD COLUMN "},
+		OnError:    DDLOnErrorSkip,
+		TrackTable: "tidb_cdc.ddl_history",
+		NotifyURL:  "http://127.0.0.1:8080/ddl",
+	}
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert((&DDLConfig{}).Validate(), check.IsNil)
+
+	tp, err := ParseDDLType(" ADD COLUMN ")
+	c.Assert(err, check.IsNil)
+	c.Assert(tp, check.Equals, timodel.ActionAddColumn)
+
+	for _, tc := range []struct {
+		cfg *DDLConfig
+		err string
+	}{
+		{&DDLConfig{SkipTypes: []string{"none"}}, "unknown ddl type: none"},
+		{&DDLConfig{OnError: "ignore"}, "invalid ddl on-error policy: ignore"},
+		{&DDLConfig{TrackTable: "ddl_history"}, "invalid ddl track-table: ddl_history.*"},
+		{&DDLConfig{TrackTable: "a.b.c"}, "invalid ddl track-table: a.b.c.*"},
+		{&DDLConfig{NotifyURL: "ftp://127.0.0.1/"}, "invalid ddl notify-url: ftp://127.0.0.1/"},
+		{&DDLConfig{View: "ignore"}, "invalid ddl view policy: ignore.*"},
+		{&DDLConfig{Sequence: "pause"}, "invalid ddl sequence policy: pause.*"},
+		{&DDLConfig{Unsupported: "replicate"}, "invalid ddl unsupported policy: replicate.*"},
+	} {
+		c.Assert(tc.cfg.Validate(), check.ErrorMatches, tc.err)
+	}
+}
+
+func (s *configSuite) TestDDLObjectPolicy(c *check.C) {
+	cfg := &DDLConfig{}
+	for _, tc := range []struct {
+		tp     timodel.ActionType
+		kind   string
+		policy string
+	}{
+		{timodel.ActionCreateTable, "", DDLPolicyReplicate},
+		{timodel.ActionCreateView, "view", DDLPolicyReplicate},
+		{timodel.ActionDropView, "view", DDLPolicyReplicate},
+		{timodel.ActionCreateSequence, "sequence", DDLPolicyError},
+		{timodel.ActionAlterSequence, "sequence", DDLPolicyError},
+	} {
+		kind, policy := cfg.ObjectPolicy(tc.tp)
+		c.Assert(kind, check.Equals, tc.kind)
+		c.Assert(policy, check.Equals, tc.policy)
+	}
+
+	cfg = &DDLConfig{View: DDLPolicyError, Sequence: DDLPolicySkip}
+	c.Assert(cfg.Validate(), check.IsNil)
+	_, policy := cfg.ObjectPolicy(timodel.ActionCreateView)
+	c.Assert(policy, check.Equals, DDLPolicyError)
+	_, policy = cfg.ObjectPolicy(timodel.ActionDropSequence)
+	c.Assert(policy, check.Equals, DDLPolicySkip)
+}
+
+func (s *configSuite) TestDDLUnsupportedPolicy(c *check.C) {
+	cfg := &DDLConfig{}
+	c.Assert(cfg.UnsupportedPolicy(), check.Equals, DDLUnsupportedPause)
+	cfg.Unsupported = DDLUnsupportedSkip
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert(cfg.UnsupportedPolicy(), check.Equals, DDLUnsupportedSkip)
+}
+
+func (s *configSuite) TestValidateMaskingRules(c *check.C) {
+	cfg := &ReplicaConfig{Masking: []MaskingRule{
+		{Table: "test.users", Columns: []string{"email"}, Type: MaskEmail},
+		{Table: "test.*", Columns: []string{"card_no"}, Type: MaskHash, Salt: "s"},
+	}}
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert(cfg.Masking[0].MatchTable("Test", "Users"), check.IsTrue)
+	c.Assert(cfg.Masking[0].MatchTable("test", "users2"), check.IsFalse)
+	c.Assert(cfg.Masking[1].MatchTable("test", "orders"), check.IsTrue)
+
+	for _, tc := range []struct {
+		rule MaskingRule
+		err  string
+	}{
+		{MaskingRule{Table: "users", Columns: []string{"a"}, Type: MaskEmail}, "invalid masking table: users.*"},
+		{MaskingRule{Table: "test.[", Columns: []string{"a"}, Type: MaskEmail}, "invalid masking table: test.\\[, syntax error.*"},
+		{MaskingRule{Table: "test.t", Type: MaskEmail}, "no columns are masked for table test.t"},
+		{MaskingRule{Table: "test.t", Columns: []string{"a"}, Type: "shuffle"}, "unsupported masking type: shuffle.*"},
+		{MaskingRule{Table: "test.t", Columns: []string{"a"}, Type: MaskHash}, "the salt of the hash masking for table test.t is empty"},
+		{MaskingRule{Table: "test.t", Columns: []string{"a"}, Type: MaskPartial, KeepPrefix: -1}, "invalid keep-prefix or keep-suffix.*"},
+	} {
+		cfg := &ReplicaConfig{Masking: []MaskingRule{tc.rule}}
+		c.Assert(cfg.Validate(), check.ErrorMatches, tc.err)
+	}
+	c.Assert((&ReplicaConfig{DDL: DDLConfig{OnError: "ignore"}}).Validate(), check.ErrorMatches, "invalid ddl on-error policy: ignore")
+}
+
+func (s *configSuite) TestValidateCircuitBreaker(c *check.C) {
+	cfg := &CircuitBreakerConfig{}
+	c.Assert(cfg.Enabled(), check.IsFalse)
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert(cfg.OpenDuration(), check.Equals, 10*time.Second)
+	c.Assert(cfg.MaxOpenDuration(), check.Equals, 5*time.Minute)
+
+	cfg = &CircuitBreakerConfig{FailureThreshold: 3, OpenSeconds: 5, MaxOpenSeconds: 60}
+	c.Assert(cfg.Enabled(), check.IsTrue)
+	c.Assert(cfg.Validate(), check.IsNil)
+
+	cfg = &CircuitBreakerConfig{FailureThreshold: -1}
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*should not be negative")
+	cfg = &CircuitBreakerConfig{FailureThreshold: 3, MaxOpenSeconds: 5}
+	c.Assert(cfg.Validate(), check.ErrorMatches, "the open time 10s of circuit-breaker is greater than the max open time 5s")
+}
+
+func (s *configSuite) TestValidateVerifyOrder(c *check.C) {
+	cfg := &ReplicaConfig{VerifyOrder: VerifyOrderPanic}
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.VerifyOrder = "warn"
+	c.Assert(cfg.Validate(), check.ErrorMatches, "invalid verify-order: warn, it should be error or panic")
+}
+
+func (s *configSuite) TestValidateSorter(c *check.C) {
+	cfg := &ReplicaConfig{}
+	c.Assert(cfg.Sorter.SpillEnabled(), check.IsFalse)
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.Sorter.MaxMemoryBytes = 64 << 20
+	c.Assert(cfg.Sorter.SpillEnabled(), check.IsTrue)
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.Sorter.MaxMemoryBytes = -1
+	c.Assert(cfg.Validate(), check.ErrorMatches, "max-memory-bytes of sorter should not be negative")
+	cfg.Sorter.MaxMemoryBytes = 0
+	cfg.Sorter.MaxTxnEntries = -1
+	c.Assert(cfg.Validate(), check.ErrorMatches, "max-txn-entries of sorter should not be negative")
+}
+
+func (s *configSuite) TestValidateMemoryQuota(c *check.C) {
+	cfg := &ReplicaConfig{MemoryQuota: MemoryQuotaConfig{ChangefeedBytes: 1 << 30, TableBytes: 64 << 20}}
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.MemoryQuota.TableBytes = -1
+	c.Assert(cfg.Validate(), check.ErrorMatches, "the options of memory-quota should not be negative")
+}
+
+func (s *configSuite) TestRouteRule(c *check.C) {
+	rule := &RouteRule{Table: "app.*", Target: "{schema}_shadow.{table}"}
+	c.Assert(rule.Validate(), check.IsNil)
+	schema, table, ok := rule.Route("App", "users")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(schema+"."+table, check.Equals, "App_shadow.users")
+	_, _, ok = rule.Route("test", "users")
+	c.Assert(ok, check.IsFalse)
+	schema, ok = rule.RouteSchema("app")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(schema, check.Equals, "app_shadow")
+	// the tables of the schema are merged, the schema isn't routed
+	_, ok = (&RouteRule{Table: "app.*", Target: "app_shadow.all"}).RouteSchema("app")
+	c.Assert(ok, check.IsFalse)
+	_, ok = (&RouteRule{Table: "app.t", Target: "app_shadow.{table}"}).RouteSchema("app")
+	c.Assert(ok, check.IsFalse)
+
+	for _, tc := range []struct {
+		rule *RouteRule
+		err  string
+	}{
+		{&RouteRule{Table: "app", Target: "a.b"}, "invalid route table: app.*"},
+		{&RouteRule{Table: "app.[", Target: "a.b"}, "invalid route table: app.\\[.*"},
+		{&RouteRule{Table: "app.t", Target: "a"}, "invalid route target: a.*"},
+		{&RouteRule{Table: "app.t", Target: "a.b.c"}, "invalid route target: a.b.c.*"},
+	} {
+		c.Assert(tc.rule.Validate(), check.ErrorMatches, tc.err)
+	}
+	c.Assert((&ReplicaConfig{Routes: []RouteRule{{Table: "app.t"}}}).Validate(), check.ErrorMatches, "invalid route target.*")
+}
+
+func (s *configSuite) TestSchemaGCRetention(c *check.C) {
+	cfg := &ReplicaConfig{}
+	c.Assert(cfg.SchemaGCRetention(), check.Equals, DefaultSchemaGCRetentionSeconds*time.Second)
+	cfg.SchemaGCRetentionSeconds = 60
+	c.Assert(cfg.SchemaGCRetention(), check.Equals, time.Minute)
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.SchemaGCRetentionSeconds = -1
+	c.Assert(cfg.Validate(), check.ErrorMatches, "schema-gc-retention-seconds should not be negative")
+}
+
+func (s *configSuite) TestSnapshotInterval(c *check.C) {
+	cfg := &ReplicaConfig{}
+	c.Assert(cfg.SnapshotInterval(), check.Equals, time.Duration(0))
+	cfg.SnapshotIntervalSeconds = 30
+	c.Assert(cfg.SnapshotInterval(), check.Equals, 30*time.Second)
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.SinkBufferSize = 16
+	c.Assert(cfg.Validate(), check.ErrorMatches, "snapshot-interval-seconds is not supported with sink-buffer-size")
+	cfg.SnapshotIntervalSeconds = -1
+	c.Assert(cfg.Validate(), check.ErrorMatches, "snapshot-interval-seconds should not be negative")
+}
+
+func (s *configSuite) TestConvertCharsets(c *check.C) {
+	cfg := &ReplicaConfig{ConvertCharsets: []string{"GBK"}}
+	c.Assert(cfg.Validate(), check.IsNil)
+	for _, cs := range []string{"utf8mb4", "latin1", "big5"} {
+		cfg.ConvertCharsets = []string{"gbk", cs}
+		c.Assert(cfg.Validate(), check.ErrorMatches, "invalid convert-charsets: "+cs+".*")
+	}
+}
+
+func (s *configSuite) TestIneligibleTablePolicy(c *check.C) {
+	cfg := &ReplicaConfig{}
+	c.Assert(cfg.IneligibleTablePolicy(), check.Equals, IneligibleTableReplicate)
+	cfg.IneligibleTables = IneligibleTablePause
+	c.Assert(cfg.IneligibleTablePolicy(), check.Equals, IneligibleTablePause)
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.IneligibleTables = "error"
+	c.Assert(cfg.Validate(), check.ErrorMatches, "invalid ineligible-tables: error.*")
+}
@@ -22,10 +22,14 @@ import (
 var (
 	ErrWriteTsConflict        = errors.New("write ts conflict")
 	ErrChangeFeedNotExists    = errors.New("changefeed not exists")
+	ErrChangeFeedExists       = errors.New("changefeed already exists")
 	ErrTaskStatusNotExists    = errors.New("task not exists")
 	ErrWriteTaskStatusConlict = errors.New("write task status conflict")
 	ErrFindPLockNotCommit     = errors.New("task status has p-lock not committed")
 	ErrAdminStopProcessor     = errors.New("stop processor by admin command")
 	ErrExecDDLFailed          = errors.New("exec DDL failed")
 	ErrCaptureNotExist        = errors.New("capture not exists")
+	ErrClusterPaused          = errors.New("cluster is already paused")
+	ErrClusterNotPaused       = errors.New("cluster is not paused")
+	ErrCaptureSessionDone     = errors.New("capture session is done, the capture info has expired")
 )
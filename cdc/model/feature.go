@@ -0,0 +1,106 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// the feature flags of changefeeds
+const (
+	// FeatureBatchDML writes the consecutive inserts or deletes of a table
+	// with multi-row statements in the MySQL sink.
+	FeatureBatchDML = "batch-dml"
+	// FeatureSafeMode writes the inserts as REPLACE in the MySQL sink.
+	FeatureSafeMode = "safe-mode"
+	// FeatureTxnMarker wraps the rows of a transaction with the begin and
+	// commit markers in the message queue sinks.
+	FeatureTxnMarker = "txn-marker"
+)
+
+// FeatureOptPrefix is the prefix of the sink options carrying the feature flags.
+const FeatureOptPrefix = "feature."
+
+type featureSpec struct {
+	// schemes are the schemes of the sinks supporting the feature, the MySQL
+	// sink has no scheme.
+	schemes []string
+	// disableWarning is the implication of disabling the feature.
+	disableWarning string
+}
+
+var featureSpecs = map[string]featureSpec{
+	FeatureBatchDML: {schemes: []string{""}},
+	FeatureSafeMode: {
+		schemes: []string{""},
+		disableWarning: "the row changes of TiKV are inserts even if they update existing rows, " +
+			"the changefeed fails with duplicated keys if the upstream updates rows",
+	},
+	FeatureTxnMarker: {schemes: []string{"kinesis", "nats", "pubsub"}},
+}
+
+// Features returns the names of all feature flags.
+func Features() []string {
+	names := make([]string, 0, len(featureSpecs))
+	for name := range featureSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sinkScheme(sinkURI string) string {
+	if i := strings.Index(sinkURI, "://"); i > 0 {
+		return strings.ToLower(sinkURI[:i])
+	}
+	return ""
+}
+
+// SetFeature turns a feature flag of the changefeed on or off. The changefeed
+// should be stopped and the feature should be supported by its sink. The
+// warning of the downstream implication is returned if there is.
+func (info *ChangeFeedInfo) SetFeature(name string, enabled bool) (warning string, err error) {
+	spec, ok := featureSpecs[name]
+	if !ok {
+		return "", errors.Errorf("unknown feature %s, the features are %s", name, strings.Join(Features(), ", "))
+	}
+	if info.AdminJobType != AdminStop {
+		return "", errors.New("changefeed must be stopped before changing its features")
+	}
+	scheme := sinkScheme(info.SinkURI)
+	supported := false
+	for _, s := range spec.schemes {
+		if s == scheme {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		if scheme == "" {
+			scheme = "mysql"
+		}
+		return "", errors.Errorf("feature %s is not supported by the %s sink", name, scheme)
+	}
+	if info.Features == nil {
+		info.Features = make(map[string]bool)
+	}
+	info.Features[name] = enabled
+	if !enabled {
+		warning = spec.disableWarning
+	}
+	return warning, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/pingcap/check"
+)
+
+type featureSuite struct{}
+
+var _ = check.Suite(&featureSuite{})
+
+func (s *featureSuite) TestSetFeature(c *check.C) {
+	info := &ChangeFeedInfo{SinkURI: "root@tcp(127.0.0.1:3306)/", AdminJobType: AdminStop}
+	warning, err := info.SetFeature(FeatureBatchDML, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(warning, check.Equals, "")
+	warning, err = info.SetFeature(FeatureSafeMode, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(warning, check.Matches, ".*duplicated keys.*")
+	c.Assert(info.Features, check.DeepEquals, map[string]bool{FeatureBatchDML: false, FeatureSafeMode: false})
+
+	_, err = info.SetFeature(FeatureTxnMarker, true)
+	c.Assert(err, check.ErrorMatches, "feature txn-marker is not supported by the mysql sink")
+	_, err = info.SetFeature("claim-check", true)
+	c.Assert(err, check.ErrorMatches, "unknown feature claim-check.*")
+
+	info = &ChangeFeedInfo{SinkURI: "NATS://127.0.0.1:4222/", AdminJobType: AdminStop}
+	_, err = info.SetFeature(FeatureTxnMarker, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Features[FeatureTxnMarker], check.IsTrue)
+
+	info.AdminJobType = AdminResume
+	_, err = info.SetFeature(FeatureTxnMarker, false)
+	c.Assert(err, check.ErrorMatches, ".*must be stopped.*")
+	c.Assert(info.Features[FeatureTxnMarker], check.IsTrue)
+}
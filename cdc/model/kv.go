@@ -50,6 +50,15 @@ type RawKVEntry struct {
 	Ts    uint64
 }
 
+// rawKVEntryOverhead is the estimated size of an entry in memory besides its
+// key and value.
+const rawKVEntryOverhead = 64
+
+// Size returns the estimated size of the entry in memory.
+func (v *RawKVEntry) Size() int64 {
+	return int64(len(v.Key) + len(v.Value) + rawKVEntryOverhead)
+}
+
 func (v *RawKVEntry) String() string {
 	return fmt.Sprintf("OpType: %v, Key: %s, Value: %s, ts: %d", v.OpType, string(v.Key), string(v.Value), v.Ts)
 }
@@ -0,0 +1,91 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// the limits of the labels of a changefeed, the labels are exported as the
+// values of the metrics so their number and lengths are bounded.
+const (
+	MaxChangeFeedLabels      = 8
+	MaxChangeFeedLabelKey    = 32
+	MaxChangeFeedLabelValues = 64
+)
+
+var labelKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ValidateLabels checks the labels of a changefeed, a key starts with a lower
+// case letter followed by the lower case letters, digits or underscores, and
+// a value is not empty.
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxChangeFeedLabels {
+		return errors.Errorf("too many labels %d, at most %d labels are allowed", len(labels), MaxChangeFeedLabels)
+	}
+	for key, value := range labels {
+		if len(key) > MaxChangeFeedLabelKey || !labelKeyRe.MatchString(key) {
+			return errors.Errorf("invalid label key %q, it should match %s and be at most %d bytes",
+				key, labelKeyRe, MaxChangeFeedLabelKey)
+		}
+		if value == "" || len(value) > MaxChangeFeedLabelValues {
+			return errors.Errorf("invalid value of label %s, it should be 1 to %d bytes", key, MaxChangeFeedLabelValues)
+		}
+	}
+	return nil
+}
+
+// ParseLabels parses the labels like key=value, the later one wins if a key
+// is given more than once. The labels are validated.
+func ParseLabels(items []string) (map[string]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(items))
+	for _, item := range items {
+		i := strings.Index(item, "=")
+		if i < 0 {
+			return nil, errors.Errorf("invalid label %q, it should be like key=value", item)
+		}
+		labels[strings.TrimSpace(item[:i])] = strings.TrimSpace(item[i+1:])
+	}
+	if err := ValidateLabels(labels); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return labels, nil
+}
+
+// LabelsString returns the labels like key1=value1,key2=value2 sorted by the
+// keys.
+func LabelsString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(labels[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+
+	"github.com/pingcap/check"
+)
+
+type labelsSuite struct{}
+
+var _ = check.Suite(&labelsSuite{})
+
+func (s *labelsSuite) TestParseLabels(c *check.C) {
+	labels, err := ParseLabels(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(labels, check.IsNil)
+
+	labels, err = ParseLabels([]string{"team=dba", " env = prod ", "service=order=v2", "team=infra"})
+	c.Assert(err, check.IsNil)
+	c.Assert(labels, check.DeepEquals, map[string]string{"team": "infra", "env": "prod", "service": "order=v2"})
+	c.Assert(LabelsString(labels), check.Equals, "env=prod,service=order=v2,team=infra")
+	c.Assert(LabelsString(nil), check.Equals, "")
+
+	_, err = ParseLabels([]string{"team"})
+	c.Assert(err, check.ErrorMatches, `invalid label "team", it should be like key=value`)
+	_, err = ParseLabels([]string{"Team=dba"})
+	c.Assert(err, check.ErrorMatches, `invalid label key "Team".*`)
+	_, err = ParseLabels([]string{"1team=dba"})
+	c.Assert(err, check.ErrorMatches, `invalid label key "1team".*`)
+	_, err = ParseLabels([]string{"team="})
+	c.Assert(err, check.ErrorMatches, "invalid value of label team.*")
+	_, err = ParseLabels([]string{"team=" + strings.Repeat("a", MaxChangeFeedLabelValues+1)})
+	c.Assert(err, check.ErrorMatches, "invalid value of label team.*")
+}
+
+func (s *labelsSuite) TestValidateLabels(c *check.C) {
+	labels := make(map[string]string)
+	for i := 0; i < MaxChangeFeedLabels; i++ {
+		labels[string(rune('a'+i))] = "v"
+	}
+	c.Assert(ValidateLabels(labels), check.IsNil)
+	labels["z"] = "v"
+	c.Assert(ValidateLabels(labels), check.ErrorMatches, "too many labels 9, at most 8 labels are allowed")
+	c.Assert(ValidateLabels(map[string]string{strings.Repeat("a", MaxChangeFeedLabelKey+1): "v"}), check.ErrorMatches, "invalid label key.*")
+}
+
+func (s *labelsSuite) TestPlacementRuleAllows(c *check.C) {
+	zone1 := &CaptureInfo{ID: "zone-1", Labels: map[string]string{"zone": "z1"}}
+	dedicated := &CaptureInfo{ID: "heavy", Labels: map[string]string{"zone": "z1", "pool": "heavy"}, Dedicated: true}
+
+	var rule *PlacementRule
+	c.Assert(rule.Allows(zone1), check.IsTrue)
+	c.Assert(rule.Allows(dedicated), check.IsFalse)
+	c.Assert((&PlacementRule{}).Allows(dedicated), check.IsFalse)
+
+	rule = &PlacementRule{CaptureLabels: map[string]string{"zone": "z1"}}
+	c.Assert(rule.Allows(zone1), check.IsTrue)
+	c.Assert(rule.Allows(dedicated), check.IsTrue)
+	c.Assert(rule.Allows(&CaptureInfo{ID: "zone-2", Labels: map[string]string{"zone": "z2"}}), check.IsFalse)
+	c.Assert(rule.Allows(&CaptureInfo{ID: "no-labels"}), check.IsFalse)
+
+	rule = &PlacementRule{CaptureLabels: map[string]string{"pool": "heavy"}}
+	c.Assert(rule.Allows(zone1), check.IsFalse)
+	c.Assert(rule.Allows(dedicated), check.IsTrue)
+}
@@ -57,14 +57,43 @@ type AdminJobType int
 type AdminJob struct {
 	CfID string
 	Type AdminJobType
+	// TableID and TargetCaptureID are used by AdminMoveTable only, the table
+	// is moved to the target capture.
+	TableID         uint64
+	TargetCaptureID string
+	// BalanceBy is used by AdminRebalance only.
+	BalanceBy BalanceStrategy
+	// Restart is used by AdminResume only, it's set if the changefeed stopped
+	// by an error is resumed by the owner.
+	Restart bool
+	// AutoResume is used by AdminResume only, it's set if the changefeed
+	// paused by an unavailable downstream is resumed by the owner once the
+	// downstream recovers.
+	AutoResume bool
 }
 
+// BalanceStrategy is the measure of the loads of the captures when the tables
+// are rebalanced.
+type BalanceStrategy string
+
+// All balance strategies
+const (
+	// BalanceByCount balances the number of the tables in the captures.
+	BalanceByCount BalanceStrategy = "count"
+	// BalanceByTraffic balances the rows per second reported by the captures.
+	BalanceByTraffic BalanceStrategy = "traffic"
+)
+
 // All AdminJob types
 const (
 	AdminNone AdminJobType = iota
 	AdminStop
 	AdminResume
 	AdminRemove
+	AdminMoveTable
+	AdminRebalance
+	AdminFinish
+	AdminFail
 )
 
 // String implements fmt.Stringer interface.
@@ -78,10 +107,50 @@ func (t AdminJobType) String() string {
 		return "resume changefeed"
 	case AdminRemove:
 		return "remove changefeed"
+	case AdminMoveTable:
+		return "move table"
+	case AdminRebalance:
+		return "rebalance tables"
+	case AdminFinish:
+		return "finish changefeed"
+	case AdminFail:
+		return "fail changefeed"
 	}
 	return "unknown"
 }
 
+// IsStopState returns whether the changefeed is stopped by the admin job, the
+// processors of the changefeed exit after they see it.
+func (t AdminJobType) IsStopState() bool {
+	switch t {
+	case AdminStop, AdminRemove, AdminFinish, AdminFail:
+		return true
+	}
+	return false
+}
+
+// RunningError is a fatal error met by a processor, such an error stops the
+// changefeed until users fix the cause and resume it.
+type RunningError struct {
+	CaptureID string `json:"capture-id"`
+	Message   string `json:"message"`
+}
+
+// PausedTable is a table whose changes are not written to the downstream since
+// the sink failed with an error of the table, the other tables go on.
+type PausedTable struct {
+	ID     int64  `json:"id"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Ts is the commit ts of the first transaction not written, the table is
+	// replicated again from it after resumed.
+	Ts    uint64 `json:"ts"`
+	Error string `json:"error"`
+	// Resume is set by users to resume the table, the processor clears the
+	// table from the paused list after it's resumed.
+	Resume bool `json:"resume,omitempty"`
+}
+
 // TaskStatus records the process information of a capture
 type TaskStatus struct {
 	// The maximum event CommitTs that has been synchronized. This is updated by corresponding processor.
@@ -94,12 +163,22 @@ type TaskStatus struct {
 	TablePLock   *TableLock          `json:"table-p-lock"`
 	TableCLock   *TableLock          `json:"table-c-lock"`
 	AdminJobType AdminJobType        `json:"admin-job-type"`
-	ModRevision  int64               `json:"-"`
+	// Error is the fatal error stopping the processor, set by processor.
+	Error *RunningError `json:"error,omitempty"`
+	// PausedTables are the tables paused by their sink errors, set by processor.
+	PausedTables []*PausedTable `json:"paused-tables,omitempty"`
+	// TableTraffic is the rows per second of the tables in the recent
+	// interval, set by processor.
+	TableTraffic map[uint64]float64 `json:"table-traffic,omitempty"`
+	// TableRegions is the number of the regions of the tables, set by
+	// processor.
+	TableRegions map[uint64]int `json:"table-regions,omitempty"`
+	ModRevision  int64          `json:"-"`
 }
 
 // String implements fmt.Stringer interface.
 func (ts *TaskStatus) String() string {
-	data, _ := ts.Marshal()
+	data, _ := json.Marshal(ts)
 	return string(data)
 }
 
@@ -140,14 +219,26 @@ func (ts *TaskStatus) Snapshot(cfID ChangeFeedID, captureID CaptureID) *ProcInfo
 	return snap
 }
 
-// Marshal returns the json marshal format of a TaskStatus
+// Marshal returns the json marshal format of a TaskStatus, large task status
+// is delta encoded and compressed if the compression is enabled.
 func (ts *TaskStatus) Marshal() (string, error) {
 	data, err := json.Marshal(ts)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	threshold := GetTaskStatusCompressThreshold()
+	if threshold > 0 && len(data) >= threshold {
+		data, err = encodeCompactTaskStatus(ts)
+	}
 	return string(data), errors.Trace(err)
 }
 
-// Unmarshal unmarshals into *TaskStatus from json marshal byte slice
+// Unmarshal unmarshals into *TaskStatus from json marshal byte slice or
+// the compressed format.
 func (ts *TaskStatus) Unmarshal(data []byte) error {
+	if isCompactTaskStatus(data) {
+		return errors.Trace(decodeCompactTaskStatus(data, ts))
+	}
 	err := json.Unmarshal(data, ts)
 	return errors.Annotatef(err, "Unmarshal data: %v", data)
 }
@@ -169,6 +260,32 @@ func (ts *TaskStatus) Clone() *TaskStatus {
 		cLock := *ts.TableCLock
 		clone.TableCLock = &cLock
 	}
+	if ts.Error != nil {
+		runningErr := *ts.Error
+		clone.Error = &runningErr
+	}
+	if ts.PausedTables != nil {
+		paused := make([]*PausedTable, 0, len(ts.PausedTables))
+		for _, t := range ts.PausedTables {
+			c := *t
+			paused = append(paused, &c)
+		}
+		clone.PausedTables = paused
+	}
+	if ts.TableTraffic != nil {
+		traffic := make(map[uint64]float64, len(ts.TableTraffic))
+		for id, rows := range ts.TableTraffic {
+			traffic[id] = rows
+		}
+		clone.TableTraffic = traffic
+	}
+	if ts.TableRegions != nil {
+		regions := make(map[uint64]int, len(ts.TableRegions))
+		for id, count := range ts.TableRegions {
+			regions[id] = count
+		}
+		clone.TableRegions = regions
+	}
 	return &clone
 }
 
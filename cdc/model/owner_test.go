@@ -34,7 +34,9 @@ func (s *cloneTaskStatusSuite) TestShouldBeDeepCopy(c *check.C) {
 			{ID: 2},
 			{ID: 3},
 		},
-		TablePLock: &TableLock{Ts: 11},
+		TablePLock:   &TableLock{Ts: 11},
+		PausedTables: []*PausedTable{{ID: 2, Ts: 10}},
+		TableRegions: map[uint64]int{1: 3},
 	}
 
 	clone := info.Clone()
@@ -47,6 +49,9 @@ func (s *cloneTaskStatusSuite) TestShouldBeDeepCopy(c *check.C) {
 		}
 		c.Assert(clone.TablePLock.Ts, check.Equals, uint64(11))
 		c.Assert(clone.TableCLock, check.IsNil)
+		c.Assert(clone.PausedTables, check.HasLen, 1)
+		c.Assert(clone.PausedTables[0].Resume, check.IsFalse)
+		c.Assert(clone.TableRegions, check.DeepEquals, map[uint64]int{1: 3})
 	}
 
 	assertIsSnapshot()
@@ -55,6 +60,8 @@ func (s *cloneTaskStatusSuite) TestShouldBeDeepCopy(c *check.C) {
 	info.TableInfos[2] = &ProcessTableInfo{ID: 1212}
 	info.TablePLock.Ts = 100
 	info.TableCLock = &TableLock{Ts: 100}
+	info.PausedTables[0].Resume = true
+	info.TableRegions[1] = 5
 
 	assertIsSnapshot()
 }
@@ -100,3 +107,59 @@ func (s *removeTableSuite) TestShouldHandleTableNotFoundCorrectly(c *check.C) {
 	c.Assert(found, check.IsFalse)
 	c.Assert(t, check.IsNil)
 }
+
+type taskStatusCodecSuite struct{}
+
+var _ = check.Suite(&taskStatusCodecSuite{})
+
+func (s *taskStatusCodecSuite) TestCompressLargeTaskStatus(c *check.C) {
+	defer SetTaskStatusCompressThreshold(GetTaskStatusCompressThreshold())
+
+	info := &TaskStatus{
+		CheckPointTs: 1000,
+		ResolvedTs:   2000,
+		TablePLock:   &TableLock{Ts: 11, CreatorID: "owner"},
+		AdminJobType: AdminStop,
+	}
+	for i := 1000; i > 0; i-- {
+		info.TableInfos = append(info.TableInfos, &ProcessTableInfo{ID: uint64(i * 2), StartTs: uint64(400000 + i%3)})
+	}
+
+	SetTaskStatusCompressThreshold(0)
+	plain, err := info.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(isCompactTaskStatus([]byte(plain)), check.IsFalse)
+
+	SetTaskStatusCompressThreshold(1024)
+	compact, err := info.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(isCompactTaskStatus([]byte(compact)), check.IsTrue)
+	c.Assert(len(compact)*10, check.Less, len(plain))
+
+	for _, data := range []string{plain, compact} {
+		decoded := &TaskStatus{}
+		c.Assert(decoded.Unmarshal([]byte(data)), check.IsNil)
+		c.Assert(decoded.CheckPointTs, check.Equals, info.CheckPointTs)
+		c.Assert(decoded.ResolvedTs, check.Equals, info.ResolvedTs)
+		c.Assert(decoded.AdminJobType, check.Equals, AdminStop)
+		c.Assert(decoded.TablePLock, check.DeepEquals, info.TablePLock)
+		c.Assert(decoded.TableInfos, check.HasLen, len(info.TableInfos))
+		tables := make(map[uint64]uint64)
+		for _, table := range decoded.TableInfos {
+			tables[table.ID] = table.StartTs
+		}
+		for _, table := range info.TableInfos {
+			c.Assert(tables[table.ID], check.Equals, table.StartTs)
+		}
+	}
+}
+
+func (s *taskStatusCodecSuite) TestSmallTaskStatusIsNotCompressed(c *check.C) {
+	defer SetTaskStatusCompressThreshold(GetTaskStatusCompressThreshold())
+	SetTaskStatusCompressThreshold(1024)
+
+	info := &TaskStatus{TableInfos: []*ProcessTableInfo{{ID: 1, StartTs: 1}}}
+	data, err := info.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(isCompactTaskStatus([]byte(data)), check.IsFalse)
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+)
+
+// RedactedSecret replaces the secrets in the redacted sink uri.
+const RedactedSecret = "******"
+
+// RedactSinkURI replaces the password in the user info and the values of the
+// secret parameters of the sink uri, the other parts are kept as they are. The
+// sink uri is a URL or a MySQL DSN without the scheme.
+func RedactSinkURI(sinkURI string) string {
+	// the password of a DSN may contain '?', the parameters of a DSN are after
+	// the last '/'
+	query := ""
+	queryFrom := 0
+	if !strings.Contains(sinkURI, "://") {
+		if i := strings.LastIndex(sinkURI, "/"); i >= 0 {
+			queryFrom = i
+		}
+	}
+	if i := strings.Index(sinkURI[queryFrom:], "?"); i >= 0 {
+		sinkURI, query = sinkURI[:queryFrom+i], sinkURI[queryFrom+i+1:]
+	}
+
+	// the user info is before the last '@' of the authority of a URL, or
+	// before the last '@' before the last '/' of a DSN
+	start, end := 0, -1
+	if i := strings.Index(sinkURI, "://"); i > 0 {
+		start = i + 3
+		authority := sinkURI[start:]
+		if j := strings.Index(authority, "/"); j >= 0 {
+			authority = authority[:j]
+		}
+		if j := strings.LastIndex(authority, "@"); j >= 0 {
+			end = start + j
+		}
+	} else {
+		slash := strings.LastIndex(sinkURI, "/")
+		if slash < 0 {
+			slash = len(sinkURI)
+		}
+		end = strings.LastIndex(sinkURI[:slash], "@")
+	}
+	if end >= 0 {
+		if j := strings.Index(sinkURI[start:end], ":"); j >= 0 {
+			sinkURI = sinkURI[:start+j+1] + RedactedSecret + sinkURI[end:]
+		}
+	}
+
+	if query == "" {
+		return sinkURI
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name := param
+		if j := strings.Index(param, "="); j >= 0 {
+			name = param[:j]
+		}
+		if isSecretParam(name) {
+			params[i] = name + "=" + RedactedSecret
+		}
+	}
+	return sinkURI + "?" + strings.Join(params, "&")
+}
+
+// isSecretParam tells whether the value of the parameter is a secret, the
+// parameters referring to the secrets like `password-file` are not secrets.
+func isSecretParam(name string) bool {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, "-file") || strings.HasSuffix(name, "-env") {
+		return false
+	}
+	for _, s := range []string{"password", "passwd", "secret", "token"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the changefeed info with the redacted sink uri,
+// it should be used wherever the info is logged or shown.
+func (info *ChangeFeedInfo) Redacted() *ChangeFeedInfo {
+	redacted := *info
+	redacted.SinkURI = RedactSinkURI(info.SinkURI)
+	return &redacted
+}
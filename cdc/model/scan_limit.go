@@ -0,0 +1,91 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pingcap/errors"
+)
+
+// ScanLimit is the cluster-level limit of the incremental scans of the regions
+// run by the captures, the owner divides the global limit into the quotas of
+// the captures. A limit is disabled if it isn't positive.
+type ScanLimit struct {
+	// Global is the max number of the scans running in all the captures.
+	Global int `json:"global"`
+	// PerCapture is the max number of the scans running in a capture.
+	PerCapture int `json:"per-capture"`
+}
+
+// ScanQuota is the max number of the scans running in each capture, a capture
+// not in the quota runs as many scans as it needs.
+type ScanQuota map[CaptureID]int
+
+// Marshal using json.Marshal.
+func (l *ScanLimit) Marshal() ([]byte, error) {
+	data, err := json.Marshal(l)
+	return data, errors.Trace(err)
+}
+
+// Unmarshal from binary data.
+func (l *ScanLimit) Unmarshal(data []byte) error {
+	err := json.Unmarshal(data, l)
+	return errors.Annotatef(err, "Unmarshal data: %v", data)
+}
+
+// Quotas divides the global limit into the quotas of the captures evenly, a
+// capture always gets at least one scan so its tables can start, so the scans
+// may exceed the global limit if there are more captures than the limit. The
+// quota of a capture never exceeds the per-capture limit. It returns nil if
+// both limits are disabled.
+func (l *ScanLimit) Quotas(captureIDs []CaptureID) ScanQuota {
+	if l.Global <= 0 && l.PerCapture <= 0 {
+		return nil
+	}
+	ids := append([]CaptureID(nil), captureIDs...)
+	sort.Strings(ids)
+	quota := make(ScanQuota, len(ids))
+	for i, id := range ids {
+		n := l.PerCapture
+		if l.Global > 0 {
+			share := l.Global / len(ids)
+			// the remainder goes to the first captures
+			if i < l.Global%len(ids) {
+				share++
+			}
+			if share < 1 {
+				share = 1
+			}
+			if n <= 0 || share < n {
+				n = share
+			}
+		}
+		quota[id] = n
+	}
+	return quota
+}
+
+// Marshal using json.Marshal.
+func (q ScanQuota) Marshal() ([]byte, error) {
+	data, err := json.Marshal(q)
+	return data, errors.Trace(err)
+}
+
+// Unmarshal from binary data.
+func (q *ScanQuota) Unmarshal(data []byte) error {
+	err := json.Unmarshal(data, q)
+	return errors.Annotatef(err, "Unmarshal data: %v", data)
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/pingcap/check"
+)
+
+type scanLimitSuite struct{}
+
+var _ = check.Suite(&scanLimitSuite{})
+
+func (s *scanLimitSuite) TestQuotas(c *check.C) {
+	ids := []CaptureID{"c", "a", "b"}
+	for _, tc := range []struct {
+		limit ScanLimit
+		quota ScanQuota
+	}{
+		{ScanLimit{}, nil},
+		// the remainder goes to the first captures in order
+		{ScanLimit{Global: 10}, ScanQuota{"a": 4, "b": 3, "c": 3}},
+		{ScanLimit{Global: 10, PerCapture: 2}, ScanQuota{"a": 2, "b": 2, "c": 2}},
+		// a capture gets at least one scan
+		{ScanLimit{Global: 2}, ScanQuota{"a": 1, "b": 1, "c": 1}},
+		{ScanLimit{PerCapture: 5}, ScanQuota{"a": 5, "b": 5, "c": 5}},
+	} {
+		c.Assert(tc.limit.Quotas(ids), check.DeepEquals, tc.quota, check.Commentf("%+v", tc.limit))
+	}
+	c.Assert(ids, check.DeepEquals, []CaptureID{"c", "a", "b"})
+	c.Assert((&ScanLimit{Global: 10}).Quotas(nil), check.HasLen, 0)
+
+	quota := ScanQuota{"a": 4, "b": 3}
+	data, err := quota.Marshal()
+	c.Assert(err, check.IsNil)
+	var decoded ScanQuota
+	c.Assert(decoded.Unmarshal(data), check.IsNil)
+	c.Assert(decoded, check.DeepEquals, quota)
+}
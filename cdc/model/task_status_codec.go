@@ -0,0 +1,129 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"github.com/pingcap/errors"
+)
+
+// compactTaskStatusMagic is the header of a compressed task status, it never
+// appears at the beginning of a json encoded value.
+var compactTaskStatusMagic = []byte{0xff, 'c', 't', 's', 1}
+
+// taskStatusCompressThreshold is the minimum size in bytes of the json encoded
+// task status to be stored in the compact format, zero disables compression.
+var taskStatusCompressThreshold int64
+
+// SetTaskStatusCompressThreshold sets the minimum size in bytes of a task status
+// to be compressed before written into etcd, zero disables compression.
+// All captures in a cluster must be able to decode the compact format before
+// enabling it.
+func SetTaskStatusCompressThreshold(threshold int) {
+	atomic.StoreInt64(&taskStatusCompressThreshold, int64(threshold))
+}
+
+// GetTaskStatusCompressThreshold returns the compress threshold of task status.
+func GetTaskStatusCompressThreshold() int {
+	return int(atomic.LoadInt64(&taskStatusCompressThreshold))
+}
+
+// compactTableInfos stores the table list sorted by table ID, both the IDs and
+// start ts are delta encoded, so that the values are small and repetitive.
+// The deltas are within a single value, every revision written to etcd still
+// holds the whole table list, so the watchers receive the whole list on each
+// update, only smaller.
+type compactTableInfos struct {
+	IDDeltas      []uint64 `json:"id"`
+	StartTsDeltas []uint64 `json:"start-ts"`
+}
+
+type taskStatusAlias TaskStatus
+
+// compactTaskStatus shadows the TableInfos of the TaskStatus with the delta
+// encoded table list.
+type compactTaskStatus struct {
+	*taskStatusAlias
+	TableInfos    []*ProcessTableInfo `json:"table-infos,omitempty"`
+	CompactTables *compactTableInfos  `json:"compact-tables"`
+}
+
+func isCompactTaskStatus(data []byte) bool {
+	return bytes.HasPrefix(data, compactTaskStatusMagic)
+}
+
+func encodeCompactTaskStatus(ts *TaskStatus) ([]byte, error) {
+	tables := make([]*ProcessTableInfo, len(ts.TableInfos))
+	copy(tables, ts.TableInfos)
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].ID < tables[j].ID
+	})
+
+	compact := &compactTableInfos{
+		IDDeltas:      make([]uint64, len(tables)),
+		StartTsDeltas: make([]uint64, len(tables)),
+	}
+	var lastID, lastStartTs uint64
+	for i, table := range tables {
+		// The start ts is not ordered, the subtraction may wrap around and
+		// is restored by the wrapping addition in decoding.
+		compact.IDDeltas[i] = table.ID - lastID
+		compact.StartTsDeltas[i] = table.StartTs - lastStartTs
+		lastID, lastStartTs = table.ID, table.StartTs
+	}
+
+	data, err := json.Marshal(&compactTaskStatus{
+		taskStatusAlias: (*taskStatusAlias)(ts),
+		CompactTables:   compact,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	encoded := make([]byte, len(compactTaskStatusMagic), len(compactTaskStatusMagic)+snappy.MaxEncodedLen(len(data)))
+	copy(encoded, compactTaskStatusMagic)
+	return append(encoded, snappy.Encode(nil, data)...), nil
+}
+
+func decodeCompactTaskStatus(data []byte, ts *TaskStatus) error {
+	raw, err := snappy.Decode(nil, data[len(compactTaskStatusMagic):])
+	if err != nil {
+		return errors.Annotate(err, "decompress task status")
+	}
+	status := &compactTaskStatus{taskStatusAlias: (*taskStatusAlias)(ts)}
+	if err := json.Unmarshal(raw, status); err != nil {
+		return errors.Annotatef(err, "Unmarshal data: %s", raw)
+	}
+
+	ts.TableInfos = nil
+	if status.CompactTables == nil {
+		return nil
+	}
+	ids, startTss := status.CompactTables.IDDeltas, status.CompactTables.StartTsDeltas
+	if len(ids) != len(startTss) {
+		return errors.Errorf("corrupted task status, %d table ids and %d start ts", len(ids), len(startTss))
+	}
+	ts.TableInfos = make([]*ProcessTableInfo, len(ids))
+	var id, startTs uint64
+	for i := range ids {
+		id += ids[i]
+		startTs += startTss[i]
+		ts.TableInfos[i] = &ProcessTableInfo{ID: id, StartTs: startTs}
+	}
+	return nil
+}
@@ -18,6 +18,15 @@ func (r RawTxn) IsFake() bool {
 	return len(r.Entries) == 0
 }
 
+// Size returns the estimated size of the entries of the txn in memory.
+func (r RawTxn) Size() int64 {
+	var size int64
+	for _, e := range r.Entries {
+		size += e.Size()
+	}
+	return size
+}
+
 // DMLType represents the dml type
 type DMLType int
 
@@ -37,6 +46,11 @@ type DML struct {
 	Values   map[string]types.Datum
 	// only set when Tp = UpdateDMLType
 	OldValues map[string]types.Datum
+	// TargetDatabase and TargetTable are the downstream name of the table if
+	// it's routed by the route rules, the table info is still looked up by
+	// the upstream name.
+	TargetDatabase string
+	TargetTable    string
 }
 
 // TableName returns the fully qualified name of the DML's table
@@ -44,6 +58,20 @@ func (dml *DML) TableName() string {
 	return util.QuoteSchema(dml.Database, dml.Table)
 }
 
+// TargetName returns the downstream schema and table of the DML, which are
+// the upstream names if the table isn't routed.
+func (dml *DML) TargetName() (string, string) {
+	if dml.TargetTable == "" {
+		return dml.Database, dml.Table
+	}
+	return dml.TargetDatabase, dml.TargetTable
+}
+
+// TargetTableName returns the fully qualified downstream name of the DML's table
+func (dml *DML) TargetTableName() string {
+	return util.QuoteSchema(dml.TargetName())
+}
+
 // DDL holds the ddl info
 type DDL struct {
 	Database string
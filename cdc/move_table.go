@@ -0,0 +1,166 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// movingTable is a table being moved from the source capture to the target
+// capture by the admin. The move has two phases coordinated by the table
+// locks in etcd: the table is removed from the task of the source with a
+// P-lock, and it's added to the task of the target after the source commits
+// the lock with a C-lock, which confirms the table is stopped in the source.
+type movingTable struct {
+	source string
+	target string
+	// removed is set after the table is removed from the source, lockTs is
+	// the ts of the P-lock written with the removal. startTs is the ts the
+	// table starts from in the target, it's lifted to the checkpoint in the
+	// C-lock after the source confirms.
+	removed bool
+	lockTs  uint64
+	startTs uint64
+}
+
+// startMovingTable records the move of a table, the table is moved in the
+// following balances.
+func (c *changeFeed) startMovingTable(tableID uint64, source, target string) {
+	if c.movingTables == nil {
+		c.movingTables = make(map[uint64]*movingTable)
+	}
+	c.movingTables[tableID] = &movingTable{source: source, target: target}
+	log.Info("start moving table", zap.String("changefeed", c.id),
+		zap.Uint64("table id", tableID), zap.String("source", source), zap.String("target", target))
+}
+
+// moveTables pushes the moves of the tables forward, the checkpoint of the
+// changefeed doesn't go beyond the start ts of a removed table until it's
+// added to the target.
+func (c *changeFeed) moveTables(ctx context.Context, captures map[string]*model.CaptureInfo) {
+	c.startPlannedMoves(captures)
+	for tableID, move := range c.movingTables {
+		var ok bool
+		if move.removed {
+			ok = c.addMovedTable(ctx, tableID, move, captures)
+		} else {
+			ok = c.removeMovingTable(ctx, tableID, move)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// removeMovingTable removes the moving table from the task of the source with
+// a P-lock, it returns false if the task status fails to be written.
+func (c *changeFeed) removeMovingTable(ctx context.Context, tableID uint64, move *movingTable) bool {
+	taskStatus, ok := c.processorInfos[move.source]
+	var infoClone *model.TaskStatus
+	if ok {
+		infoClone = taskStatus.Clone()
+		_, ok = taskStatus.RemoveTable(tableID)
+	}
+	if !ok {
+		// the source has gone or the table has been dropped, the table is
+		// reclaimed or cleaned as usual.
+		log.Warn("moving table not found in the source, give up the move",
+			zap.String("changefeed", c.id), zap.Uint64("table id", tableID), zap.String("source", move.source))
+		delete(c.movingTables, tableID)
+		return true
+	}
+
+	newInfo, err := c.infoWriter.Write(ctx, c.id, move.source, taskStatus, true)
+	switch errors.Cause(err) {
+	case model.ErrFindPLockNotCommit:
+		c.restoreTableInfos(infoClone, move.source)
+		log.Info("write table info delay, wait plock resolve",
+			zap.String("changefeed", c.id), labelsField(c.labels()),
+			zap.String("capture", move.source))
+		return true
+	case nil:
+		c.processorInfos[move.source] = newInfo
+		move.removed = true
+		move.lockTs = newInfo.TablePLock.Ts
+		move.startTs = infoClone.CheckPointTs
+		log.Info("moving table removed from the source",
+			zap.String("changefeed", c.id), zap.Uint64("table id", tableID), zap.String("source", move.source))
+		return true
+	default:
+		c.restoreTableInfos(infoClone, move.source)
+		log.Error("fail to put sub changefeed info", zap.Error(err))
+		return false
+	}
+}
+
+// addMovedTable adds the moving table to the task of the target after the
+// source confirms the table is stopped, it returns false if the task status
+// fails to be written.
+func (c *changeFeed) addMovedTable(ctx context.Context, tableID uint64, move *movingTable, captures map[string]*model.CaptureInfo) bool {
+	if source, ok := c.processorInfos[move.source]; ok {
+		if lock := source.TableCLock; lock != nil && lock.Ts == move.lockTs {
+			if lock.CheckpointTs > move.startTs {
+				move.startTs = lock.CheckpointTs
+			}
+		} else if lock := source.TablePLock; lock != nil && lock.Ts == move.lockTs {
+			// the source hasn't confirmed the removal yet
+			return true
+		}
+	}
+
+	if _, ok := captures[move.target]; !ok {
+		log.Warn("target of the moving table has gone, dispatch it as an orphan",
+			zap.String("changefeed", c.id), zap.Uint64("table id", tableID), zap.String("target", move.target))
+		c.reAddTable(tableID, move.startTs)
+		delete(c.movingTables, tableID)
+		return true
+	}
+
+	info := c.processorInfos[move.target]
+	if info == nil {
+		info = new(model.TaskStatus)
+	}
+	infoClone := info.Clone()
+	info.TableInfos = append(info.TableInfos, &model.ProcessTableInfo{
+		ID:      tableID,
+		StartTs: move.startTs,
+	})
+	c.attachPausedTable(info, tableID)
+	newInfo, err := c.infoWriter.Write(ctx, c.id, move.target, info, false)
+	switch errors.Cause(err) {
+	case model.ErrFindPLockNotCommit:
+		c.restoreTableInfos(infoClone, move.target)
+		log.Info("write table info delay, wait plock resolve",
+			zap.String("changefeed", c.id), labelsField(c.labels()),
+			zap.String("capture", move.target))
+		return true
+	case nil:
+		c.processorInfos[move.target] = newInfo
+		delete(c.movingTables, tableID)
+		log.Info("move table success",
+			zap.String("changefeed", c.id), zap.Uint64("table id", tableID),
+			zap.Uint64("start ts", move.startTs),
+			zap.String("source", move.source), zap.String("target", move.target))
+		return true
+	default:
+		c.restoreTableInfos(infoClone, move.target)
+		log.Error("fail to put sub changefeed info", zap.Error(err))
+		return false
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+// orphanTaskCheckInterval is the interval to check the task status of the
+// dead captures.
+const orphanTaskCheckInterval = time.Minute
+
+const (
+	// orphanTaskReassigned means the tables of the task are dispatched again.
+	orphanTaskReassigned = "reassigned"
+	// orphanTaskDeleted means the task belongs to a changefeed not run by the
+	// owner, so only the task status is deleted.
+	orphanTaskDeleted = "deleted"
+)
+
+// cleanOrphanTasks deletes the task status whose capture is not alive
+// periodically. They are left if the capture dies while there is no owner to
+// see its capture info deleted. The tables of the tasks of the changefeeds run
+// by the owner are dispatched to the alive captures again. The task status and
+// the status of the removed changefeeds are deleted too. The errors are only
+// logged.
+func (o *ownerImpl) cleanOrphanTasks(ctx context.Context) {
+	// the captures haven't been loaded yet
+	if len(o.captures) == 0 {
+		return
+	}
+	if time.Since(o.lastOrphanTaskCheckTime) < orphanTaskCheckInterval {
+		return
+	}
+	o.lastOrphanTaskCheckTime = time.Now()
+
+	revision, tasks, err := o.etcdClient.GetAllTaskStatuses(ctx)
+	if err != nil {
+		log.Warn("get task status failed", zap.Error(err))
+		return
+	}
+	// the captures are read at the same revision, so a task status written by
+	// a capture started after the scan is not taken as orphaned.
+	_, captures, err := o.etcdClient.GetCaptures(ctx, clientv3.WithRev(revision))
+	if err != nil {
+		log.Warn("get captures failed", zap.Error(err))
+		return
+	}
+	_, changefeeds, err := o.etcdClient.GetChangeFeeds(ctx, clientv3.WithRev(revision))
+	if err != nil {
+		log.Warn("get changefeeds failed", zap.Error(err))
+		return
+	}
+	alive := make(map[string]struct{}, len(captures))
+	for _, c := range captures {
+		alive[c.ID] = struct{}{}
+	}
+
+	for cfID, infos := range tasks {
+		if _, ok := changefeeds[cfID]; !ok && removedTasks(infos) {
+			o.cleanRemovedTasks(ctx, cfID, infos)
+			continue
+		}
+		for captureID, info := range infos {
+			if _, ok := alive[captureID]; ok {
+				continue
+			}
+			o.cleanOrphanTask(ctx, cfID, captureID, info)
+		}
+	}
+}
+
+// removedTasks returns whether all the processors of the changefeed are told
+// to stop, the changefeed is removed if its info is deleted too.
+func removedTasks(infos model.ProcessorsInfos) bool {
+	for _, info := range infos {
+		if !info.AdminJobType.IsStopState() {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanRemovedTasks deletes the status and the task status of a removed
+// changefeed, the task status modified after it's read is deleted next time.
+func (o *ownerImpl) cleanRemovedTasks(ctx context.Context, cfID string, infos model.ProcessorsInfos) {
+	if err := o.etcdClient.DeleteChangeFeedStatus(ctx, cfID); err != nil {
+		log.Warn("delete the status of the removed changefeed failed",
+			zap.String("changefeedID", cfID), zap.Error(err))
+		return
+	}
+	for captureID, info := range infos {
+		_, err := o.etcdClient.DeleteTaskStatusIfNotModified(ctx, cfID, captureID, info.ModRevision)
+		if err != nil {
+			log.Warn("delete the task status of the removed changefeed failed",
+				zap.String("changefeedID", cfID),
+				zap.String("captureID", captureID),
+				zap.Error(err))
+			return
+		}
+	}
+	log.Info("clean the removed changefeed", zap.String("changefeedID", cfID), zap.Int("tasks", len(infos)))
+}
+
+// cleanOrphanTask deletes the task status if it's not modified since it's read.
+func (o *ownerImpl) cleanOrphanTask(ctx context.Context, cfID, captureID string, info *model.TaskStatus) {
+	deleted, err := o.etcdClient.DeleteTaskStatusIfNotModified(ctx, cfID, captureID, info.ModRevision)
+	if err != nil {
+		log.Warn("delete orphaned task status failed",
+			zap.String("changefeedID", cfID),
+			zap.String("captureID", captureID),
+			zap.Error(err))
+		return
+	}
+	if !deleted {
+		// it's modified after the scan, check it again next time
+		return
+	}
+
+	action := orphanTaskDeleted
+	if cf, ok := o.changeFeeds[cfID]; ok {
+		cf.reclaimTaskTables(info)
+		delete(cf.processorInfos, captureID)
+		// the tables are dispatched again, so the processor is not marked
+		// down any more
+		remainProcs := o.markDownProcessor[:0]
+		for _, snap := range o.markDownProcessor {
+			if snap.CfID != cfID || snap.CaptureID != captureID {
+				remainProcs = append(remainProcs, snap)
+			}
+		}
+		o.markDownProcessor = remainProcs
+		action = orphanTaskReassigned
+	}
+	orphanTaskCounter.WithLabelValues(cfID, action).Inc()
+	log.Info("clean orphaned task status",
+		zap.String("changefeedID", cfID),
+		zap.String("captureID", captureID),
+		zap.Int("tables", len(info.TableInfos)),
+		zap.String("action", action))
+}
@@ -17,7 +17,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"math"
 	"sync"
 	"time"
 
@@ -30,6 +29,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/roles"
 	"github.com/pingcap/ticdc/cdc/roles/storage"
 	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/pingcap/ticdc/pkg/util"
 	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.etcd.io/etcd/mvcc"
@@ -40,6 +40,8 @@ import (
 const (
 	markProcessorDownTime      = time.Minute
 	captureInfoWatchRetryDelay = time.Millisecond * 500
+	// schemaSnapshotInterval is the interval to save the schema snapshot
+	schemaSnapshotInterval = time.Minute * 10
 )
 
 type tableIDMap = map[uint64]struct{}
@@ -51,7 +53,7 @@ type OwnerDDLHandler interface {
 	PullDDL() (resolvedTs uint64, jobs []*model.DDL, err error)
 
 	// ExecDDL executes the ddl job
-	ExecDDL(ctx context.Context, sinkURI string, txn model.Txn) error
+	ExecDDL(ctx context.Context, sinkURI string, opts map[string]string, txn model.Txn) error
 
 	// Close cancels the executing of OwnerDDLHandler and releases resource
 	Close() error
@@ -65,6 +67,13 @@ type ChangeFeedRWriter interface {
 	Write(ctx context.Context, infos map[model.ChangeFeedID]*model.ChangeFeedStatus) error
 }
 
+// OwnerTaskStatusWriter defines the Writer of the task status dispatched by owner
+type OwnerTaskStatusWriter interface {
+	// Write persists the task status of a capture and returns the written one,
+	// a p-lock is written with the task status if writePLock is true.
+	Write(ctx context.Context, changefeedID, captureID string, info *model.TaskStatus, writePLock bool) (*model.TaskStatus, error)
+}
+
 type changeFeed struct {
 	id     string
 	info   *model.ChangeFeedInfo
@@ -81,12 +90,34 @@ type changeFeed struct {
 	ddlHandler    OwnerDDLHandler
 	ddlResolvedTs uint64
 	ddlJobHistory []*model.DDL
+	// ddlNotifier notifies the webhook of the replicated DDLs, it's nil if
+	// the webhook isn't configured.
+	ddlNotifier *ddlNotifier
+	// router routes the DDLs to the downstream tables, it's nil if no route
+	// rule is configured.
+	router *sink.Router
+	// lifecycle publishes the lifecycle events, finished is set after the
+	// finished event is published.
+	lifecycle *lifecycleNotifier
+	finished  bool
 
 	schemas       map[uint64]tableIDMap
 	tables        map[uint64]schema.TableName
 	orphanTables  map[uint64]model.ProcessTableInfo
+	pausedTables  map[string]*model.PausedTable
 	toCleanTables map[uint64]struct{}
-	infoWriter    *storage.OwnerTaskStatusEtcdWriter
+	movingTables  map[uint64]*movingTable
+	plannedMoves  []*plannedMove
+	// workloads are the last reported workloads of the tables.
+	workloads map[uint64]tableWorkload
+	// captureRoom is the number of the tables the captures with max tables
+	// can take, it's set by the owner before the tables are placed.
+	captureRoom map[string]int
+	infoWriter  OwnerTaskStatusWriter
+
+	// clock returns the current time, it's nil unless it's replaced by a
+	// virtual clock in tests.
+	clock func() time.Time
 }
 
 // String implements fmt.Stringer interface.
@@ -104,20 +135,74 @@ func (c *changeFeed) String() string {
 	return s
 }
 
+// labels returns the labels of the changefeed.
+func (c *changeFeed) labels() map[string]string {
+	if c.info == nil {
+		return nil
+	}
+	return c.info.Labels
+}
+
+func (c *changeFeed) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
 func (c *changeFeed) updateProcessorInfos(processInfos model.ProcessorsInfos) {
 	for cid, pinfo := range processInfos {
 		if _, ok := c.processorLastUpdateTime[cid]; !ok {
-			c.processorLastUpdateTime[cid] = time.Now()
+			c.processorLastUpdateTime[cid] = c.now()
 			continue
 		}
 
 		oldPinfo, ok := c.processorInfos[cid]
 		if !ok || oldPinfo.ResolvedTs != pinfo.ResolvedTs || oldPinfo.CheckPointTs != pinfo.CheckPointTs {
-			c.processorLastUpdateTime[cid] = time.Now()
+			c.processorLastUpdateTime[cid] = c.now()
 		}
 	}
 
 	c.processorInfos = processInfos
+	c.recordWorkloads(processInfos)
+	c.updatePausedTables(processInfos)
+}
+
+// downProcessors returns the snapshots of the processors which haven't
+// updated their ts for markProcessorDownTime.
+func (c *changeFeed) downProcessors() []*model.ProcInfoSnap {
+	var snaps []*model.ProcInfoSnap
+	for id, info := range c.processorInfos {
+		lastUpdateTime := c.processorLastUpdateTime[id]
+		if c.now().Sub(lastUpdateTime) > markProcessorDownTime {
+			snaps = append(snaps, info.Snapshot(c.id, id))
+			log.Info("markdown processor", zap.String("id", id),
+				zap.Reflect("info", info), zap.Time("update time", lastUpdateTime))
+		}
+	}
+	return snaps
+}
+
+// reclaimTables makes the tables of a removed capture orphans, it returns
+// false if the capture has no task of the changefeed.
+func (c *changeFeed) reclaimTables(captureID string) bool {
+	pinfo, ok := c.processorInfos[captureID]
+	if !ok {
+		return false
+	}
+	c.reclaimTaskTables(pinfo)
+	return true
+}
+
+// reclaimTaskTables adds the tables in the task status to the orphan tables,
+// they start from the checkpoint of the task.
+func (c *changeFeed) reclaimTaskTables(pinfo *model.TaskStatus) {
+	for _, table := range pinfo.TableInfos {
+		c.orphanTables[table.ID] = model.ProcessTableInfo{
+			ID:      table.ID,
+			StartTs: pinfo.CheckPointTs,
+		}
+	}
 }
 
 func (c *changeFeed) addSchema(schemaID uint64) {
@@ -165,11 +250,42 @@ func (c *changeFeed) addTable(sid, tid, startTs uint64, table schema.TableName)
 	}
 }
 
+// renameTable updates the name of a renamed table. The tables created or
+// recovered are added at the finished ts of their jobs by applyJob already, a
+// rename is the only way a table enters or leaves the filter without a new ID.
+func (c *changeFeed) renameTable(sid, tid, startTs uint64, table schema.TableName) {
+	_, replicated := c.tables[tid]
+	if replicated {
+		// the table may be renamed to another schema
+		for _, tables := range c.schemas {
+			delete(tables, tid)
+		}
+	}
+	switch {
+	case !replicated:
+		if !c.filter.ShouldIgnoreTable(table.Schema, table.Table) {
+			log.Info("table renamed into the filter", zap.Uint64("tableID", tid), zap.Stringer("table", table))
+		}
+		c.addTable(sid, tid, startTs, table)
+	case c.filter.ShouldIgnoreTable(table.Schema, table.Table):
+		log.Info("table renamed out of the filter", zap.Uint64("tableID", tid), zap.Stringer("table", table))
+		c.removeTable(sid, tid)
+	default:
+		if _, ok := c.schemas[sid]; !ok {
+			c.schemas[sid] = make(tableIDMap)
+		}
+		c.schemas[sid][tid] = struct{}{}
+		c.tables[tid] = table
+	}
+}
+
 func (c *changeFeed) removeTable(sid, tid uint64) {
 	if _, ok := c.schemas[sid]; ok {
 		delete(c.schemas[sid], tid)
 	}
 	delete(c.tables, tid)
+	delete(c.movingTables, tid)
+	delete(c.workloads, tid)
 
 	if _, ok := c.orphanTables[tid]; ok {
 		delete(c.orphanTables, tid)
@@ -178,42 +294,24 @@ func (c *changeFeed) removeTable(sid, tid uint64) {
 	}
 }
 
+// selectCapture returns the capture with the least workload of the
+// changefeed.
 func (c *changeFeed) selectCapture(captures map[string]*model.CaptureInfo) string {
-	return c.minimumTablesCapture(captures)
-}
-
-func (c *changeFeed) minimumTablesCapture(captures map[string]*model.CaptureInfo) string {
-	if len(captures) == 0 {
-		return ""
-	}
-
-	for id := range captures {
-		// We have not dispatch any table to this capture yet.
-		if _, ok := c.processorInfos[id]; !ok {
-			return id
-		}
-	}
-
-	var minCount int = math.MaxInt64
-	var minID string
-
-	for id, pinfo := range c.processorInfos {
-		if len(pinfo.TableInfos) < minCount {
-			minID = id
-			minCount = len(pinfo.TableInfos)
-		}
-	}
-
-	return minID
+	return lightestCapture(c.captureLoads(captures))
 }
 
 func (c *changeFeed) tryBalance(ctx context.Context, captures map[string]*model.CaptureInfo) {
 	c.cleanTables(ctx)
+	c.moveTables(ctx, captures)
 	c.banlanceOrphanTables(ctx, captures)
 }
 
 func (c *changeFeed) restoreTableInfos(infoSnapshot *model.TaskStatus, captureID string) {
-	c.processorInfos[captureID].TableInfos = infoSnapshot.TableInfos
+	// the capture has no task status if the first write to it failed
+	if info, ok := c.processorInfos[captureID]; ok {
+		info.TableInfos = infoSnapshot.TableInfos
+		info.PausedTables = infoSnapshot.PausedTables
+	}
 }
 
 func (c *changeFeed) cleanTables(ctx context.Context) {
@@ -239,17 +337,19 @@ cleanLoop:
 		case model.ErrFindPLockNotCommit:
 			c.restoreTableInfos(infoClone, captureID)
 			log.Info("write table info delay, wait plock resolve",
-				zap.String("changefeed", c.id),
+				zap.String("changefeed", c.id), labelsField(c.labels()),
 				zap.String("capture", captureID))
 		case nil:
 			log.Info("cleanup table success",
+				zap.String("changefeed", c.id), labelsField(c.labels()),
 				zap.Uint64("table id", id),
 				zap.String("capture id", captureID))
 			log.Debug("after remove", zap.Stringer("task status", taskStatus))
 			cleanIDs = append(cleanIDs, id)
 		default:
 			c.restoreTableInfos(infoClone, captureID)
-			log.Error("fail to put sub changefeed info", zap.Error(err))
+			log.Error("fail to put sub changefeed info",
+				zap.String("changefeed", c.id), labelsField(c.labels()), zap.Error(err))
 			break cleanLoop
 		}
 	}
@@ -275,9 +375,25 @@ func (c *changeFeed) banlanceOrphanTables(ctx context.Context, captures map[stri
 	if len(captures) == 0 {
 		return
 	}
+	dispatched := 0
+	defer func() {
+		if dispatched > 0 && c.lifecycle != nil {
+			c.lifecycle.publish(c.id, LifecycleRebalanced, LifecycleEvent{
+				CheckpointTs: c.status.CheckpointTs,
+				Tables:       dispatched,
+			})
+		}
+	}()
 
-	for tableID, orphan := range c.orphanTables {
-		captureID := c.selectCapture(captures)
+	loads := c.captureLoads(captures)
+	for id := range loads {
+		if !c.hasRoom(id) {
+			delete(loads, id)
+		}
+	}
+	for _, tableID := range c.sortedOrphanTables() {
+		orphan := c.orphanTables[tableID]
+		captureID := lightestCapture(loads)
 		if len(captureID) == 0 {
 			return
 		}
@@ -291,6 +407,7 @@ func (c *changeFeed) banlanceOrphanTables(ctx context.Context, captures map[stri
 			ID:      tableID,
 			StartTs: orphan.StartTs,
 		})
+		c.attachPausedTable(info, tableID)
 
 		newInfo, err := c.infoWriter.Write(ctx, c.id, captureID, info, false)
 		if err == nil {
@@ -300,29 +417,50 @@ func (c *changeFeed) banlanceOrphanTables(ctx context.Context, captures map[stri
 		case model.ErrFindPLockNotCommit:
 			c.restoreTableInfos(infoClone, captureID)
 			log.Info("write table info delay, wait plock resolve",
-				zap.String("changefeed", c.id),
+				zap.String("changefeed", c.id), labelsField(c.labels()),
 				zap.String("capture", captureID))
 		case nil:
 			log.Info("dispatch table success",
+				zap.String("changefeed", c.id), labelsField(c.labels()),
 				zap.Uint64("table id", tableID),
 				zap.Uint64("start ts", orphan.StartTs),
 				zap.String("capture", captureID))
 			delete(c.orphanTables, tableID)
+			loads[captureID].add(c.workloads[tableID])
+			c.takeRoom(captureID)
+			if !c.hasRoom(captureID) {
+				delete(loads, captureID)
+			}
+			dispatched++
 		default:
 			c.restoreTableInfos(infoClone, captureID)
-			log.Error("fail to put sub changefeed info", zap.Error(err))
+			log.Error("fail to put sub changefeed info",
+				zap.String("changefeed", c.id), labelsField(c.labels()), zap.Error(err))
 			return
 		}
 	}
 }
 
 func (c *changeFeed) applyJob(job *pmodel.Job) error {
-	log.Info("apply job", zap.String("sql", job.Query), zap.Int64("job id", job.ID))
+	log.Info("apply job", zap.String("changefeed", c.id), labelsField(c.labels()),
+		zap.String("sql", job.Query), zap.Int64("job id", job.ID))
+
+	// the tables are replicated by the physical IDs, the partitions of a
+	// partitioned table are added and removed like the tables
+	var oldIDs []int64
+	switch job.Type {
+	case pmodel.ActionDropTable, pmodel.ActionRenameTable, pmodel.ActionTruncateTable,
+		pmodel.ActionAddTablePartition, pmodel.ActionDropTablePartition, pmodel.ActionTruncateTablePartition:
+		if old, ok := c.schema.TableByID(job.TableID); ok {
+			oldIDs = old.PhysicalIDs()
+		}
+	}
 
 	schamaName, tableName, _, err := c.schema.HandleDDL(job)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	name := schema.TableName{Schema: schamaName, Table: tableName}
 
 	schemaID := uint64(job.SchemaID)
 	// case table id set may change
@@ -332,26 +470,65 @@ func (c *changeFeed) applyJob(job *pmodel.Job) error {
 	case pmodel.ActionDropSchema:
 		c.dropSchema(schemaID)
 	case pmodel.ActionCreateTable, pmodel.ActionRecoverTable:
-		addID := uint64(job.BinlogInfo.TableInfo.ID)
-		c.addTable(schemaID, addID, job.BinlogInfo.FinishedTS, schema.TableName{Schema: schamaName, Table: tableName})
+		for _, addID := range schema.PhysicalTableIDs(job.BinlogInfo.TableInfo) {
+			c.addTable(schemaID, uint64(addID), job.BinlogInfo.FinishedTS, name)
+		}
 	case pmodel.ActionDropTable:
-		dropID := uint64(job.TableID)
-		c.removeTable(schemaID, dropID)
+		for _, dropID := range physicalIDsOr(oldIDs, job.TableID) {
+			c.removeTable(schemaID, uint64(dropID))
+		}
 	case pmodel.ActionRenameTable:
-		// no id change just update name
-		c.tables[uint64(job.TableID)] = schema.TableName{Schema: schamaName, Table: tableName}
+		// no id change just update name, unless the table is renamed into or
+		// out of the filter, then it's discovered or dropped like a new or
+		// dropped table
+		for _, id := range physicalIDsOr(oldIDs, job.TableID) {
+			c.renameTable(schemaID, uint64(id), job.BinlogInfo.FinishedTS, name)
+		}
 	case pmodel.ActionTruncateTable:
-		dropID := uint64(job.TableID)
-		c.removeTable(schemaID, dropID)
+		for _, dropID := range physicalIDsOr(oldIDs, job.TableID) {
+			c.removeTable(schemaID, uint64(dropID))
+		}
 
-		addID := uint64(job.BinlogInfo.TableInfo.ID)
-		c.addTable(schemaID, addID, job.BinlogInfo.FinishedTS, schema.TableName{Schema: schamaName, Table: tableName})
+		for _, addID := range schema.PhysicalTableIDs(job.BinlogInfo.TableInfo) {
+			c.addTable(schemaID, uint64(addID), job.BinlogInfo.FinishedTS, name)
+		}
+	case pmodel.ActionAddTablePartition, pmodel.ActionDropTablePartition, pmodel.ActionTruncateTablePartition:
+		newIDs := schema.PhysicalTableIDs(job.BinlogInfo.TableInfo)
+		for _, dropID := range subtractIDs(oldIDs, newIDs) {
+			c.removeTable(schemaID, uint64(dropID))
+		}
+		for _, addID := range subtractIDs(newIDs, oldIDs) {
+			c.addTable(schemaID, uint64(addID), job.BinlogInfo.FinishedTS, name)
+		}
 	default:
 	}
 
 	return nil
 }
 
+// physicalIDsOr returns ids, or the table ID if the table wasn't known.
+func physicalIDsOr(ids []int64, tableID int64) []int64 {
+	if len(ids) == 0 {
+		return []int64{tableID}
+	}
+	return ids
+}
+
+// subtractIDs returns the IDs in a but not in b.
+func subtractIDs(a, b []int64) []int64 {
+	set := make(map[int64]struct{}, len(b))
+	for _, id := range b {
+		set[id] = struct{}{}
+	}
+	var ids []int64
+	for _, id := range a {
+		if _, ok := set[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 type ownerImpl struct {
 	changeFeeds       map[model.ChangeFeedID]*changeFeed
 	markDownProcessor []*model.ProcInfoSnap
@@ -371,6 +548,32 @@ type ownerImpl struct {
 
 	adminJobs     []model.AdminJob
 	adminJobsLock sync.Mutex
+
+	resumer *autoResumer
+	// lifecycle publishes the lifecycle events of the changefeeds, it's nil
+	// if the events are not published.
+	lifecycle *lifecycleNotifier
+
+	// scanQuota is the quotas of the incremental scans last assigned to the
+	// captures, they are assigned again after the owner changes.
+	scanQuota         model.ScanQuota
+	scanQuotaAssigned bool
+
+	lastSchemaSnapshotTime time.Time
+	lastSchemaSnapshotTs   uint64
+
+	lastOrphanTaskCheckTime time.Time
+
+	// adminStates are the admin job types recorded in the infos of all the
+	// changefeeds, they're reloaded in every tick and updated after an admin
+	// job is handled.
+	adminStates map[model.ChangeFeedID]model.AdminJobType
+	// pendingRestarts are the next restart times of the changefeeds stopped
+	// by errors, they're reloaded in every tick.
+	pendingRestarts map[model.ChangeFeedID]time.Time
+
+	// owning is set in a term of the ownership of the capture.
+	owning bool
 }
 
 // NewOwner creates a new ownerImpl instance
@@ -403,6 +606,8 @@ func NewOwner(pdEndpoints []string, cli kv.CDCEtcdClient, manager roles.Manager)
 		captureWatchC:      watchC,
 		captures:           captures,
 		cancelWatchCapture: cancel,
+		resumer:            newAutoResumer(getAutoResumeConfig()),
+		lifecycle:          newLifecycleNotifier(lifecycleWebhook),
 	}
 
 	return owner, nil
@@ -430,7 +635,7 @@ func (o *ownerImpl) handleMarkdownProcessor(ctx context.Context) {
 		err := o.etcdClient.DeleteTaskStatus(ctx, snap.CfID, snap.CaptureID)
 		if err != nil {
 			log.Warn("failed to delete processor info",
-				zap.String("changefeedID", snap.CfID),
+				zap.String("changefeedID", snap.CfID), labelsField(changefeed.labels()),
 				zap.String("captureID", snap.CaptureID),
 				zap.Error(err),
 			)
@@ -454,20 +659,13 @@ func (o *ownerImpl) removeCapture(info *model.CaptureInfo) {
 	defer o.l.Unlock()
 
 	delete(o.captures, info.ID)
+	log.Info("capture is gone, reclaim its tables", zap.String("captureID", info.ID))
 
 	for _, feed := range o.changeFeeds {
-		pinfo, ok := feed.processorInfos[info.ID]
-		if !ok {
+		if !feed.reclaimTables(info.ID) {
 			continue
 		}
 
-		for _, table := range pinfo.TableInfos {
-			feed.orphanTables[table.ID] = model.ProcessTableInfo{
-				ID:      table.ID,
-				StartTs: pinfo.CheckPointTs,
-			}
-		}
-
 		key := kv.GetEtcdKeyTask(feed.id, info.ID)
 		if _, err := o.etcdClient.Client.Delete(context.Background(), key); err != nil {
 			log.Warn("failed to delete key", zap.Error(err))
@@ -505,19 +703,21 @@ func (o *ownerImpl) handleWatchCapture() error {
 	return nil
 }
 
-func (o *ownerImpl) newChangeFeed(id model.ChangeFeedID, processorsInfos model.ProcessorsInfos, info *model.ChangeFeedInfo, checkpointTs uint64) (*changeFeed, error) {
-	log.Info("Find new changefeed", zap.Reflect("info", info),
+func (o *ownerImpl) newChangeFeed(ctx context.Context, id model.ChangeFeedID, processorsInfos model.ProcessorsInfos, info *model.ChangeFeedInfo, checkpointTs uint64) (*changeFeed, error) {
+	log.Info("Find new changefeed", zap.Reflect("info", info.Redacted()),
 		zap.String("id", id), zap.Uint64("checkpoint ts", checkpointTs))
 
-	schemaStorage, err := createSchemaStore(o.pdEndpoints)
+	schemaStorage, err := createSchemaStore(o.pdEndpoints, loadSchemaSnapshot(ctx, o.etcdClient, checkpointTs))
 	if err != nil {
 		return nil, errors.Annotate(err, "create schema store failed")
 	}
 
+	schemaStorage.SetSkipUnsupportedDDL(info.GetConfig().DDL.UnsupportedPolicy() == model.DDLUnsupportedSkip)
 	err = schemaStorage.HandlePreviousDDLJobIfNeed(checkpointTs)
 	if err != nil {
 		return nil, errors.Annotate(err, "handle ddl job failed")
 	}
+	schemaStorage.SetGCRetention(info.GetConfig().SchemaGCRetention())
 
 	ddlHandler := newDDLHandler(o.pdClient, checkpointTs)
 
@@ -536,7 +736,8 @@ func (o *ownerImpl) newChangeFeed(id model.ChangeFeedID, processorsInfos model.P
 	schemas := make(map[uint64]tableIDMap)
 	tables := make(map[uint64]schema.TableName)
 	orphanTables := make(map[uint64]model.ProcessTableInfo)
-	for tid, table := range schemaStorage.CloneTables() {
+	// the partitions of a partitioned table are replicated as the tables
+	for tid, table := range schemaStorage.ClonePhysicalTables() {
 		if filter.ShouldIgnoreTable(table.Schema, table.Table) {
 			continue
 		}
@@ -571,7 +772,9 @@ func (o *ownerImpl) newChangeFeed(id model.ChangeFeedID, processorsInfos model.P
 		schemas:                 schemas,
 		tables:                  tables,
 		orphanTables:            orphanTables,
+		pausedTables:            make(map[string]*model.PausedTable),
 		toCleanTables:           make(map[uint64]struct{}),
+		movingTables:            make(map[uint64]*movingTable),
 		processorLastUpdateTime: make(map[string]time.Time),
 		status: &model.ChangeFeedStatus{
 			ResolvedTs:   0,
@@ -582,6 +785,15 @@ func (o *ownerImpl) newChangeFeed(id model.ChangeFeedID, processorsInfos model.P
 		processorInfos: processorsInfos,
 		infoWriter:     storage.NewOwnerTaskStatusEtcdWriter(o.etcdClient),
 		filter:         filter,
+		lifecycle:      o.lifecycle,
+	}
+	if url := info.GetConfig().DDL.NotifyURL; url != "" {
+		cf.ddlNotifier = newDDLNotifier(id, url)
+	}
+	if routes := info.GetConfig().Routes; len(routes) > 0 {
+		if cf.router, err = sink.NewRouter(routes); err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
 	return cf, nil
 }
@@ -592,18 +804,24 @@ func (o *ownerImpl) loadChangeFeeds(ctx context.Context) error {
 		return errors.Trace(err)
 	}
 
+	adminStates := make(map[model.ChangeFeedID]model.AdminJobType, len(cfInfo))
+	pendingRestarts := make(map[model.ChangeFeedID]time.Time)
+	for id, info := range cfInfo {
+		adminStates[id] = info.AdminJobType
+		if info.AdminJobType == model.AdminStop && info.Restart != nil && !info.Restart.NextRestart.IsZero() {
+			pendingRestarts[id] = info.Restart.NextRestart
+		}
+	}
+	o.adminStates = adminStates
+	o.pendingRestarts = pendingRestarts
+
 	for changeFeedID, procInfos := range pinfos {
 		if cf, exist := o.changeFeeds[changeFeedID]; exist {
 			cf.updateProcessorInfos(procInfos)
-			for id, info := range cf.processorInfos {
-				lastUpdateTime := cf.processorLastUpdateTime[id]
-				if time.Since(lastUpdateTime) > markProcessorDownTime {
-					snap := info.Snapshot(changeFeedID, id)
-					o.markDownProcessor = append(o.markDownProcessor, snap)
-					log.Info("markdown processor", zap.String("id", id),
-						zap.Reflect("info", info), zap.Time("update time", lastUpdateTime))
-				}
+			if err := o.stopOnProcessorError(cf); err != nil {
+				return errors.Trace(err)
 			}
+			o.markDownProcessor = append(o.markDownProcessor, cf.downProcessors()...)
 			continue
 		}
 
@@ -614,25 +832,66 @@ func (o *ownerImpl) loadChangeFeeds(ctx context.Context) error {
 		}
 		status := cfStatus[changeFeedID]
 
-		if status != nil && (status.AdminJobType == model.AdminStop || status.AdminJobType == model.AdminRemove) {
+		if status != nil && status.AdminJobType.IsStopState() {
 			continue
 		}
 		checkpointTs := info.GetCheckpointTs(status)
 
-		newCf, err := o.newChangeFeed(changeFeedID, procInfos, info, checkpointTs)
+		newCf, err := o.newChangeFeed(ctx, changeFeedID, procInfos, info, checkpointTs)
 		if err != nil {
 			return errors.Annotatef(err, "create change feed %s", changeFeedID)
 		}
 		o.changeFeeds[changeFeedID] = newCf
+		setChangefeedLabelMetrics(changeFeedID, info.Labels)
+		// the changefeeds without status have never run
+		if status == nil {
+			o.lifecycle.publish(changeFeedID, LifecycleCreated, LifecycleEvent{CheckpointTs: checkpointTs})
+		}
 	}
 
+	captures, draining := o.schedulableCaptures()
 	for _, changefeed := range o.changeFeeds {
-		changefeed.tryBalance(ctx, o.captures)
+		placeable := o.placeableCaptures(changefeed, captures)
+		for _, move := range changefeed.drainTables(misplacedCaptures(draining, captures, placeable), placeable) {
+			log.Info("plan to move the table of the draining capture",
+				zap.String("changefeed", changefeed.id), labelsField(changefeed.labels()),
+				zap.Uint64("table id", move.tableID), zap.String("source", move.source), zap.String("target", move.target))
+		}
+		changefeed.tryBalance(ctx, placeable)
 	}
 
 	return nil
 }
 
+// stopOnProcessorError stops the changefeed if any of its processors meets a
+// fatal error, the error is recorded in the changefeed info.
+func (o *ownerImpl) stopOnProcessorError(cf *changeFeed) error {
+	if cf.info.Error != nil {
+		return nil
+	}
+	for _, pinfo := range cf.processorInfos {
+		if pinfo.Error == nil {
+			continue
+		}
+		log.Warn("stop changefeed for the processor error", zap.String("changefeed", cf.id), labelsField(cf.labels()),
+			zap.String("capture", pinfo.Error.CaptureID), zap.String("error", pinfo.Error.Message))
+		typ := cf.recordError(errorRestartConfig, pinfo.Error, time.Now())
+		if o.lifecycle != nil {
+			o.lifecycle.publish(cf.id, LifecycleErrored, LifecycleEvent{
+				CheckpointTs: cf.status.CheckpointTs,
+				Code:         LifecycleErrProcessor,
+				Message:      pinfo.Error.Message,
+				Capture:      pinfo.Error.CaptureID,
+			})
+		}
+		return errors.Trace(o.enqueueJob(model.AdminJob{
+			CfID: cf.id,
+			Type: typ,
+		}))
+	}
+	return nil
+}
+
 func (o *ownerImpl) flushChangeFeedInfos(ctx context.Context) error {
 	snapshot := make(map[model.ChangeFeedID]*model.ChangeFeedStatus, len(o.changeFeeds))
 	for id, changefeed := range o.changeFeeds {
@@ -678,6 +937,19 @@ func (c *changeFeed) calcResolvedTs() error {
 				minCheckpointTs = pStatus.CheckPointTs
 			}
 		}
+		// the moving tables removed from the sources are in no processor,
+		// they start from their start ts in the targets.
+		for _, move := range c.movingTables {
+			if !move.removed {
+				continue
+			}
+			if minResolvedTs > move.startTs {
+				minResolvedTs = move.startTs
+			}
+			if minCheckpointTs > move.startTs {
+				minCheckpointTs = move.startTs
+			}
+		}
 	}
 
 	// if minResolvedTs is greater than ddlResolvedTs,
@@ -708,9 +980,18 @@ func (c *changeFeed) calcResolvedTs() error {
 		tsUpdated = true
 	}
 
+	// the paused tables are replicated again from the first transactions not
+	// written after resumed
+	if ts := c.pausedCheckpointTs(); ts != 0 && minCheckpointTs > ts {
+		minCheckpointTs = ts
+	}
+
 	if minCheckpointTs > c.status.CheckpointTs {
 		c.status.CheckpointTs = minCheckpointTs
 		tsUpdated = true
+		if c.schema != nil {
+			c.schema.DoGC(minCheckpointTs)
+		}
 	}
 
 	if tsUpdated {
@@ -718,34 +999,56 @@ func (c *changeFeed) calcResolvedTs() error {
 			zap.Uint64("checkpoint ts", minCheckpointTs),
 			zap.Uint64("resolved ts", minResolvedTs))
 	}
+	if !c.finished && c.status.CheckpointTs >= c.targetTs {
+		c.finished = true
+		c.lifecycle.publish(c.id, LifecycleFinished, LifecycleEvent{CheckpointTs: c.status.CheckpointTs})
+	}
 	return nil
 }
 
 // calcResolvedTs call calcResolvedTs of every changefeeds
 func (o *ownerImpl) calcResolvedTs() error {
 	for _, cf := range o.changeFeeds {
+		finished := cf.finished
 		if err := cf.calcResolvedTs(); err != nil {
 			return errors.Trace(err)
 		}
+		// the processors of a finished changefeed are stopped
+		if !finished && cf.finished {
+			o.adminJobsLock.Lock()
+			o.adminJobs = append(o.adminJobs, model.AdminJob{CfID: cf.id, Type: model.AdminFinish})
+			o.adminJobsLock.Unlock()
+		}
 	}
 	return nil
 }
 
 // handleDDL call handleDDL of every changefeeds
 func (o *ownerImpl) handleDDL(ctx context.Context) error {
+	captures, _ := o.schedulableCaptures()
 	for _, cf := range o.changeFeeds {
-		err := cf.handleDDL(ctx, o.captures)
+		err := cf.handleDDL(ctx, o.placeableCaptures(cf, captures))
 		switch errors.Cause(err) {
 		case nil:
 			continue
 		case model.ErrExecDDLFailed:
-			err = o.EnqueueJob(model.AdminJob{
+			o.lifecycle.publish(cf.id, LifecycleErrored, LifecycleEvent{
+				CheckpointTs: cf.status.CheckpointTs,
+				Code:         LifecycleErrDDL,
+				Message:      err.Error(),
+			})
+			typ := cf.recordError(errorRestartConfig, &model.RunningError{Message: err.Error()}, time.Now())
+			err = o.enqueueJob(model.AdminJob{
 				CfID: cf.id,
-				Type: model.AdminStop,
+				Type: typ,
 			})
 			if err != nil {
 				return errors.Trace(err)
 			}
+			// the failed changefeeds are only resumed by users
+			if o.resumer != nil && typ == model.AdminStop {
+				o.resumer.track(cf.id, cf.info.SinkURI, time.Now())
+			}
 		default:
 			return errors.Trace(err)
 		}
@@ -776,6 +1079,20 @@ func (c *changeFeed) handleDDL(ctx context.Context, captures map[string]*model.C
 		}
 	}
 
+	// the changefeed is paused at the DDL of an unsupported type by default,
+	// it's replicated again after TiCDC is upgraded to support it. The jobs
+	// not done are skipped by the schema storage whatever their types are.
+	job := todoDDLJob.Job
+	unsupported := (job.IsSynced() || job.IsDone()) && !schema.IsDDLSupported(job.Type)
+	if unsupported && c.info.GetConfig().DDL.UnsupportedPolicy() == model.DDLUnsupportedPause {
+		c.ddlState = model.ChangeFeedDDLExecuteFailed
+		log.Error("DDL of the unsupported type",
+			zap.String("ChangeFeedID", c.id), labelsField(c.labels()),
+			zap.Int("type", int(todoDDLJob.Job.Type)),
+			zap.Reflect("ddlJob", todoDDLJob))
+		return errors.Annotatef(model.ErrExecDDLFailed, "type %d of DDL %s is unsupported", todoDDLJob.Job.Type, todoDDLJob.Job.Query)
+	}
+
 	// Execute DDL Job asynchronously
 	c.ddlState = model.ChangeFeedExecDDL
 	log.Debug("apply job", zap.Stringer("job", todoDDLJob.Job),
@@ -792,34 +1109,100 @@ func (c *changeFeed) handleDDL(ctx context.Context, captures map[string]*model.C
 	if c.filter.ShouldIgnoreTxn(&ddlTxn) {
 		log.Info(
 			"DDL txn ignored",
+			zap.String("changefeed", c.id), labelsField(c.labels()),
 			zap.Int64("ID", todoDDLJob.Job.ID),
 			zap.String("query", todoDDLJob.Job.Query),
 			zap.Uint64("ts", ddlTxn.Ts),
 		)
+	} else if unsupported {
+		// applyJob fails at the DDL of an unsupported type unless it is
+		// skipped by the policy
+		log.Warn(
+			"DDL of the unsupported type skipped",
+			zap.String("changefeed", c.id), labelsField(c.labels()),
+			zap.Int64("ID", todoDDLJob.Job.ID),
+			zap.String("query", todoDDLJob.Job.Query),
+			zap.Int("type", int(todoDDLJob.Job.Type)),
+		)
+	} else if schema.IsDDLInternal(todoDDLJob.Job.Type) {
+		log.Info(
+			"internal DDL of the upstream not executed",
+			zap.String("changefeed", c.id), labelsField(c.labels()),
+			zap.Int64("ID", todoDDLJob.Job.ID),
+			zap.String("query", todoDDLJob.Job.Query),
+			zap.Stringer("type", todoDDLJob.Job.Type),
+		)
+	} else if c.filter.ShouldSkipDDL(todoDDLJob.Job.Type) {
+		log.Info(
+			"DDL skipped by the type",
+			zap.String("changefeed", c.id), labelsField(c.labels()),
+			zap.Int64("ID", todoDDLJob.Job.ID),
+			zap.String("query", todoDDLJob.Job.Query),
+			zap.Stringer("type", todoDDLJob.Job.Type),
+		)
 	} else {
 		c.filter.FilterTxn(&ddlTxn)
+		kind, policy := c.info.GetConfig().DDL.ObjectPolicy(todoDDLJob.Job.Type)
 		if ddlTxn.DDL == nil {
 			log.Warn(
 				"DDL ignored",
+				zap.String("changefeed", c.id), labelsField(c.labels()),
 				zap.Int64("ID", todoDDLJob.Job.ID),
 				zap.String("query", todoDDLJob.Job.Query),
 				zap.Uint64("ts", todoDDLJob.Job.BinlogInfo.FinishedTS),
 			)
+		} else if policy == model.DDLPolicySkip {
+			log.Info(
+				"DDL skipped by the policy",
+				zap.String("changefeed", c.id), labelsField(c.labels()),
+				zap.Int64("ID", todoDDLJob.Job.ID),
+				zap.String("query", todoDDLJob.Job.Query),
+				zap.String("object", kind),
+			)
+		} else if policy == model.DDLPolicyError {
+			c.ddlState = model.ChangeFeedDDLExecuteFailed
+			log.Error("DDL is not replicated by the policy",
+				zap.String("ChangeFeedID", c.id), labelsField(c.labels()),
+				zap.String("object", kind),
+				zap.Reflect("ddlJob", todoDDLJob))
+			return errors.Annotatef(model.ErrExecDDLFailed, "%s DDL is not replicated by the ddl %s policy", kind, kind)
 		} else {
-			err = c.ddlHandler.ExecDDL(ctx, c.info.SinkURI, ddlTxn)
-			// If DDL executing failed, pause the changefeed and print log, rather
-			// than return an error and break the running of this owner.
-			if err != nil {
+			if c.router != nil {
+				routed, err := c.router.RouteDDL(ddlTxn.DDL)
+				if err != nil {
+					c.ddlState = model.ChangeFeedDDLExecuteFailed
+					log.Error("Route DDL failed",
+						zap.String("ChangeFeedID", c.id), labelsField(c.labels()),
+						zap.Error(err),
+						zap.Reflect("ddlJob", todoDDLJob))
+					return errors.Annotate(model.ErrExecDDLFailed, err.Error())
+				}
+				ddlTxn.DDL = routed
+			}
+			err = c.ddlHandler.ExecDDL(ctx, c.info.SinkURI, sinkOptions(c.id, c.info), ddlTxn)
+			switch {
+			case err == nil:
+				log.Info("Execute DDL succeeded",
+					zap.String("ChangeFeedID", c.id), labelsField(c.labels()),
+					zap.Reflect("ddlJob", todoDDLJob))
+				if c.ddlNotifier != nil {
+					c.ddlNotifier.notify(ddlTxn.DDL)
+				}
+			case c.info.GetConfig().DDL.OnError == model.DDLOnErrorSkip:
+				log.Warn("Execute DDL failed, skip it",
+					zap.String("ChangeFeedID", c.id), labelsField(c.labels()),
+					zap.Error(err),
+					zap.Reflect("ddlJob", todoDDLJob))
+			default:
+				// If DDL executing failed, pause the changefeed and print log, rather
+				// than return an error and break the running of this owner.
 				c.ddlState = model.ChangeFeedDDLExecuteFailed
 				log.Error("Execute DDL failed",
-					zap.String("ChangeFeedID", c.id),
+					zap.String("ChangeFeedID", c.id), labelsField(c.labels()),
 					zap.Error(err),
 					zap.Reflect("ddlJob", todoDDLJob))
 				return errors.Trace(model.ErrExecDDLFailed)
 			}
-			log.Info("Execute DDL succeeded",
-				zap.String("ChangeFeedID", c.id),
-				zap.Reflect("ddlJob", todoDDLJob))
 		}
 	}
 	if c.ddlState != model.ChangeFeedExecDDL {
@@ -842,6 +1225,7 @@ func (o *ownerImpl) dispatchJob(ctx context.Context, job model.AdminJob) error {
 		pinfo.TablePLock = nil
 		pinfo.TableCLock = nil
 		pinfo.AdminJobType = job.Type
+		pinfo.Error = nil
 		_, err := cf.infoWriter.Write(ctx, cf.id, captureID, pinfo, false)
 		if err != nil {
 			return errors.Trace(err)
@@ -854,12 +1238,22 @@ func (o *ownerImpl) dispatchJob(ctx context.Context, job model.AdminJob) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-	err = cf.ddlHandler.Close()
-	log.Info("stop changefeed ddl handler", zap.String("changefeed id", job.CfID), util.ZapErrorFilter(err, context.Canceled))
-	delete(o.changeFeeds, job.CfID)
+	o.closeChangeFeed(cf)
 	return nil
 }
 
+// closeChangeFeed stops the DDL handler of the changefeed and removes it from
+// the owner.
+func (o *ownerImpl) closeChangeFeed(cf *changeFeed) {
+	err := cf.ddlHandler.Close()
+	log.Info("stop changefeed ddl handler", zap.String("changefeed id", cf.id), util.ZapErrorFilter(err, context.Canceled))
+	if cf.ddlNotifier != nil {
+		cf.ddlNotifier.close()
+	}
+	deleteChangefeedLabelMetrics(cf.id, cf.labels())
+	delete(o.changeFeeds, cf.id)
+}
+
 func (o *ownerImpl) handleAdminJob(ctx context.Context) error {
 	removeIdx := 0
 	o.adminJobsLock.Lock()
@@ -868,41 +1262,107 @@ func (o *ownerImpl) handleAdminJob(ctx context.Context) error {
 		o.adminJobsLock.Unlock()
 	}()
 	for i, job := range o.adminJobs {
-		log.Info("handle admin job", zap.String("changefeed", job.CfID), zap.Stringer("type", job.Type))
+		log.Info("handle admin job", zap.String("changefeed", job.CfID), labelsField(o.changefeedLabels(job.CfID)),
+			zap.Stringer("type", job.Type))
+		// the changefeed may be changed by the jobs handled after the job is
+		// enqueued
+		if err := o.checkAdminJob(job); err != nil {
+			log.Warn("ignore the invalid admin job", zap.String("changefeed", job.CfID),
+				labelsField(o.changefeedLabels(job.CfID)), zap.Stringer("type", job.Type), zap.Error(err))
+			removeIdx = i + 1
+			continue
+		}
 		switch job.Type {
-		case model.AdminStop:
+		case model.AdminStop, model.AdminFinish, model.AdminFail:
 			// update ChangeFeedDetail to tell capture ChangeFeedDetail watcher to cleanup
 			cf, ok := o.changeFeeds[job.CfID]
 			if !ok {
 				return errors.Errorf("changefeed %s not found in owner cache", job.CfID)
 			}
-			cf.info.AdminJobType = model.AdminStop
+			cf.info.AdminJobType = job.Type
 			err := o.etcdClient.SaveChangeFeedInfo(ctx, cf.info, job.CfID)
 			if err != nil {
 				return errors.Trace(err)
 			}
 
+			// the changefeed is resumed from the checkpoint recorded in its
+			// status by dispatchJob
+			checkpointTs := cf.status.CheckpointTs
 			err = o.dispatchJob(ctx, job)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			o.setAdminState(job.CfID, job.Type)
+			switch job.Type {
+			case model.AdminStop:
+				o.lifecycle.publish(job.CfID, LifecyclePaused, LifecycleEvent{CheckpointTs: checkpointTs})
+			case model.AdminFail:
+				event := LifecycleEvent{CheckpointTs: checkpointTs}
+				if cf.info.Error != nil {
+					event.Message = cf.info.Error.Message
+				}
+				o.lifecycle.publish(job.CfID, LifecycleFailed, event)
+			}
 		case model.AdminRemove:
-			err := o.dispatchJob(ctx, job)
-			if err != nil {
-				return errors.Trace(err)
+			if o.resumer != nil {
+				o.resumer.untrack(job.CfID)
 			}
-
-			// remove changefeed info
-			err = o.etcdClient.DeleteChangeFeedInfo(ctx, job.CfID)
-			if err != nil {
-				return errors.Trace(err)
+			if _, ok := o.changeFeeds[job.CfID]; ok {
+				err := o.dispatchJob(ctx, job)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				// remove changefeed info, the task status and the status are
+				// deleted by cleanOrphanTasks after the processors exit
+				err = o.etcdClient.DeleteChangeFeedInfo(ctx, job.CfID)
+				if err != nil {
+					return errors.Trace(err)
+				}
+			} else {
+				// the processors of a stopped changefeed have exited
+				err := o.etcdClient.DeleteChangeFeed(ctx, job.CfID)
+				if err != nil {
+					return errors.Trace(err)
+				}
 			}
+			delete(o.adminStates, job.CfID)
+			o.lifecycle.publish(job.CfID, LifecycleRemoved, LifecycleEvent{})
 		case model.AdminResume:
-			cfStatus, err := o.etcdClient.GetChangeFeedStatus(ctx, job.CfID)
+			if o.resumer != nil {
+				o.resumer.untrack(job.CfID)
+			}
+			cfInfo, err := o.etcdClient.GetChangeFeedInfo(ctx, job.CfID)
 			if err != nil {
 				return errors.Trace(err)
 			}
-			cfInfo, err := o.etcdClient.GetChangeFeedInfo(ctx, job.CfID)
+			// the changefeed may be stopped by another owner
+			if err := checkAdminJobTransition(job.CfID, cfInfo.AdminJobType, job.Type); err != nil {
+				log.Warn("ignore the invalid admin job", zap.String("changefeed", job.CfID),
+					labelsField(cfInfo.Labels), zap.Stringer("type", job.Type), zap.Error(err))
+				break
+			}
+			// the changefeed is resumed by users before its restart
+			if job.Restart && (cfInfo.Restart == nil || cfInfo.Restart.NextRestart.IsZero() || cfInfo.AdminJobType != model.AdminStop) {
+				break
+			}
+			switch {
+			case job.Restart:
+				cfInfo.Restart.Count++
+				cfInfo.Restart.NextRestart = time.Time{}
+				log.Info("restart the changefeed stopped by an error", zap.String("changefeed", job.CfID),
+					labelsField(cfInfo.Labels), zap.Int("restarts", cfInfo.Restart.Count))
+			case job.AutoResume:
+				// it counts as a restart, so the errors keep failing the
+				// changefeed after the limited restarts
+				if cfInfo.Restart != nil {
+					cfInfo.Restart.Count++
+					cfInfo.Restart.NextRestart = time.Time{}
+				}
+				delete(o.pendingRestarts, job.CfID)
+			default:
+				cfInfo.Restart = nil
+			}
+			cfStatus, err := o.etcdClient.GetChangeFeedStatus(ctx, job.CfID)
 			if err != nil {
 				return errors.Trace(err)
 			}
@@ -916,10 +1376,34 @@ func (o *ownerImpl) handleAdminJob(ctx context.Context) error {
 
 			// set admin job in changefeed cfInfo to trigger each capture's changefeed list watch event
 			cfInfo.AdminJobType = model.AdminResume
+			cfInfo.Error = nil
 			err = o.etcdClient.SaveChangeFeedInfo(ctx, cfInfo, job.CfID)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			o.setAdminState(job.CfID, model.AdminResume)
+			o.lifecycle.publish(job.CfID, LifecycleResumed, LifecycleEvent{CheckpointTs: cfStatus.CheckpointTs})
+		case model.AdminMoveTable:
+			cf, ok := o.changeFeeds[job.CfID]
+			if !ok {
+				return errors.Errorf("changefeed %s not found in owner cache", job.CfID)
+			}
+			source, _, ok := findTaskStatusWithTable(cf.processorInfos, job.TableID)
+			if !ok || source == job.TargetCaptureID {
+				log.Warn("table to move not found in another capture, ignore the job",
+					zap.String("changefeed", job.CfID), labelsField(cf.labels()), zap.Uint64("table id", job.TableID))
+				break
+			}
+			cf.startMovingTable(job.TableID, source, job.TargetCaptureID)
+		case model.AdminRebalance:
+			cf, ok := o.changeFeeds[job.CfID]
+			if !ok {
+				return errors.Errorf("changefeed %s not found in owner cache", job.CfID)
+			}
+			captures, _ := o.schedulableCaptures()
+			cf.plannedMoves = cf.planRebalance(o.placeableCaptures(cf, captures), job.BalanceBy)
+			log.Info("rebalance tables", zap.String("changefeed", job.CfID), labelsField(cf.labels()),
+				zap.String("balance by", string(job.BalanceBy)), zap.Int("moves", len(cf.plannedMoves)))
 		}
 		removeIdx = i + 1
 	}
@@ -929,6 +1413,7 @@ func (o *ownerImpl) handleAdminJob(ctx context.Context) error {
 // TODO avoid this tick style, this means we get `tickTime` latency here.
 func (o *ownerImpl) Run(ctx context.Context, tickTime time.Duration) error {
 	defer o.cancelWatchCapture()
+	defer o.lifecycle.close()
 	handleWatchCaptureC := make(chan error, 1)
 	rl := rate.NewLimiter(0.1, 5)
 	go func() {
@@ -961,7 +1446,7 @@ func (o *ownerImpl) Run(ctx context.Context, tickTime time.Duration) error {
 		case err := <-handleWatchCaptureC:
 			return errors.Annotate(err, "handleWatchCapture failed")
 		case <-time.After(tickTime):
-			if !o.IsOwner(ctx) {
+			if !o.checkOwnership() {
 				continue
 			}
 			err := o.run(ctx)
@@ -973,6 +1458,53 @@ func (o *ownerImpl) Run(ctx context.Context, tickTime time.Duration) error {
 	}
 }
 
+// checkOwnership returns whether the capture is the owner. The in-memory state
+// of the changefeeds is dropped after the capture loses the ownership, so a
+// term of the ownership always starts with the state persisted in etcd by the
+// last owner, whichever capture it was.
+func (o *ownerImpl) checkOwnership() bool {
+	isOwner := o.manager.IsOwner()
+	switch {
+	case isOwner && !o.owning:
+		o.owning = true
+		ownerTakeoverCounter.Inc()
+		log.Info("take over the owner", zap.String("capture", o.manager.ID()))
+	case !isOwner && o.owning:
+		o.owning = false
+		o.resetState()
+		log.Warn("lost the owner, drop the state of the changefeeds", zap.String("capture", o.manager.ID()))
+	}
+	return isOwner
+}
+
+// resetState drops the state of the last term of the ownership, the admin
+// jobs not handled are dropped too.
+func (o *ownerImpl) resetState() {
+	o.l.Lock()
+	defer o.l.Unlock()
+	for _, cf := range o.changeFeeds {
+		o.closeChangeFeed(cf)
+	}
+	o.changeFeeds = make(map[model.ChangeFeedID]*changeFeed)
+	o.markDownProcessor = nil
+	o.adminJobsLock.Lock()
+	if len(o.adminJobs) > 0 {
+		log.Warn("drop the admin jobs not handled", zap.Int("jobs", len(o.adminJobs)))
+	}
+	o.adminJobs = nil
+	o.adminJobsLock.Unlock()
+	if o.resumer != nil {
+		o.resumer.reset()
+	}
+	o.scanQuota = nil
+	o.scanQuotaAssigned = false
+	o.lastSchemaSnapshotTime = time.Time{}
+	o.lastSchemaSnapshotTs = 0
+	o.lastOrphanTaskCheckTime = time.Time{}
+	o.adminStates = nil
+	o.pendingRestarts = nil
+}
+
 func (o *ownerImpl) run(ctx context.Context) error {
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -994,6 +1526,8 @@ func (o *ownerImpl) run(ctx context.Context) error {
 		return errors.Trace(err)
 	}
 
+	o.cleanOrphanTasks(cctx)
+
 	err = o.calcResolvedTs()
 	if err != nil {
 		return errors.Trace(err)
@@ -1004,11 +1538,28 @@ func (o *ownerImpl) run(ctx context.Context) error {
 		return errors.Trace(err)
 	}
 
+	err = o.autoResume(cctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = o.restartOnError(cctx, time.Now())
+	if err != nil {
+		return errors.Trace(err)
+	}
+
 	err = o.handleAdminJob(cctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
+	err = o.assignScanQuota(cctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	o.saveSchemaSnapshot(cctx)
+
 	err = o.flushChangeFeedInfos(cctx)
 	if err != nil {
 		return errors.Trace(err)
@@ -1016,30 +1567,235 @@ func (o *ownerImpl) run(ctx context.Context) error {
 	return nil
 }
 
+// autoResume resumes the paused changefeeds whose downstream has recovered.
+func (o *ownerImpl) autoResume(ctx context.Context) error {
+	if o.resumer == nil {
+		return nil
+	}
+	// the config may be reloaded
+	o.resumer.setConfig(getAutoResumeConfig())
+	if o.resumer.tracked() == 0 {
+		return nil
+	}
+	// the changefeeds are left stopped until the cluster is resumed
+	pause, err := o.etcdClient.GetClusterPause(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if pause != nil {
+		return nil
+	}
+	for _, id := range o.resumer.check(time.Now()) {
+		info, err := o.etcdClient.GetChangeFeedInfo(ctx, id)
+		if errors.Cause(err) == model.ErrChangeFeedNotExists {
+			continue
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// the changefeed has been resumed or removed by users
+		if info.AdminJobType != model.AdminStop {
+			continue
+		}
+		err = o.enqueueJob(model.AdminJob{CfID: id, Type: model.AdminResume, AutoResume: true})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// saveSchemaSnapshot saves the snapshot of the earliest schema storage of the
+// changefeeds periodically, so the new processors and changefeeds starting
+// after it don't replay all the history DDL jobs. The errors are only logged.
+func (o *ownerImpl) saveSchemaSnapshot(ctx context.Context) {
+	if time.Since(o.lastSchemaSnapshotTime) < schemaSnapshotInterval {
+		return
+	}
+	var snap *schema.Snapshot
+	for _, cf := range o.changeFeeds {
+		if cf.schema == nil {
+			continue
+		}
+		s := cf.schema.Snapshot()
+		if snap == nil || s.Ts < snap.Ts {
+			snap = s
+		}
+	}
+	if snap == nil || snap.Ts <= o.lastSchemaSnapshotTs {
+		return
+	}
+	o.lastSchemaSnapshotTime = time.Now()
+	if err := o.etcdClient.PutSchemaSnapshot(ctx, snap); err != nil {
+		log.Warn("save schema snapshot failed", zap.Uint64("ts", snap.Ts), zap.Error(err))
+		return
+	}
+	o.lastSchemaSnapshotTs = snap.Ts
+	log.Info("save schema snapshot", zap.Uint64("ts", snap.Ts))
+}
+
+// assignScanQuota divides the limit of the incremental scans into the quotas
+// of the alive captures, the quotas are saved only if they change.
+func (o *ownerImpl) assignScanQuota(ctx context.Context) error {
+	// the captures haven't been loaded yet
+	if len(o.captures) == 0 {
+		return nil
+	}
+	limit, err := o.etcdClient.GetScanLimit(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	captureIDs := make([]model.CaptureID, 0, len(o.captures))
+	for id := range o.captures {
+		captureIDs = append(captureIDs, id)
+	}
+	quota := limit.Quotas(captureIDs)
+	if o.scanQuotaAssigned && scanQuotaEqual(o.scanQuota, quota) {
+		return nil
+	}
+	err = o.etcdClient.PutScanQuota(ctx, quota)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("assign the scan quotas", zap.Reflect("limit", limit), zap.Reflect("quota", quota))
+	o.scanQuota = quota
+	o.scanQuotaAssigned = true
+	return nil
+}
+
+func scanQuotaEqual(a, b model.ScanQuota) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for id, n := range a {
+		if m, ok := b[id]; !ok || m != n {
+			return false
+		}
+	}
+	return true
+}
+
 func (o *ownerImpl) IsOwner(_ context.Context) bool {
 	return o.manager.IsOwner()
 }
 
+// EnqueueJob checks the admin job against the state of the owner and adds it
+// to the queue, the job is checked again when it's handled.
 func (o *ownerImpl) EnqueueJob(job model.AdminJob) error {
+	o.l.RLock()
+	defer o.l.RUnlock()
+	return errors.Trace(o.enqueueJob(job))
+}
+
+// enqueueJob adds the admin job initiated by the owner itself, it's called
+// with o.l held.
+func (o *ownerImpl) enqueueJob(job model.AdminJob) error {
 	if !o.manager.IsOwner() {
 		return errors.Trace(concurrency.ErrElectionNotLeader)
 	}
+	if err := o.checkAdminJob(job); err != nil {
+		return errors.Trace(err)
+	}
+	o.adminJobsLock.Lock()
+	o.adminJobs = append(o.adminJobs, job)
+	o.adminJobsLock.Unlock()
+	return nil
+}
+
+// checkAdminJob checks whether the admin job can be applied to the changefeed.
+// It's called with o.l held, since it reads the state of the changefeeds and
+// the captures updated by the owner.
+func (o *ownerImpl) checkAdminJob(job model.AdminJob) error {
+	state, known := o.adminStates[job.CfID]
+	_, running := o.changeFeeds[job.CfID]
 	switch job.Type {
 	case model.AdminResume:
-	case model.AdminStop, model.AdminRemove:
-		_, ok := o.changeFeeds[job.CfID]
+		// the changefeed not loaded yet is checked when the job is handled
+		if known {
+			return errors.Trace(checkAdminJobTransition(job.CfID, state, job.Type))
+		}
+	case model.AdminStop, model.AdminFinish, model.AdminFail:
+		if !running {
+			if known {
+				return errors.Trace(checkAdminJobTransition(job.CfID, state, job.Type))
+			}
+			return errors.Errorf("changefeed [%s] not found", job.CfID)
+		}
+	case model.AdminRemove:
+		if !running && !known {
+			return errors.Errorf("changefeed [%s] not found", job.CfID)
+		}
+	case model.AdminMoveTable:
+		cf, ok := o.changeFeeds[job.CfID]
 		if !ok {
 			return errors.Errorf("changefeed [%s] not found", job.CfID)
 		}
+		target, ok := o.captures[job.TargetCaptureID]
+		if !ok {
+			return errors.Errorf("capture [%s] not found", job.TargetCaptureID)
+		}
+		if target.Draining {
+			return errors.Errorf("capture [%s] is draining", job.TargetCaptureID)
+		}
+		if err := o.checkPlacement(cf, target); err != nil {
+			return errors.Trace(err)
+		}
+		if _, ok := cf.movingTables[job.TableID]; ok {
+			return errors.Errorf("table [%d] of changefeed [%s] is being moved", job.TableID, job.CfID)
+		}
+		source, _, ok := findTaskStatusWithTable(cf.processorInfos, job.TableID)
+		if !ok {
+			return errors.Errorf("table [%d] of changefeed [%s] not found in any capture", job.TableID, job.CfID)
+		}
+		if source == job.TargetCaptureID {
+			return errors.Errorf("table [%d] of changefeed [%s] is already in capture [%s]", job.TableID, job.CfID, source)
+		}
+	case model.AdminRebalance:
+		cf, ok := o.changeFeeds[job.CfID]
+		if !ok {
+			return errors.Errorf("changefeed [%s] not found", job.CfID)
+		}
+		if len(cf.plannedMoves) > 0 {
+			return errors.Errorf("changefeed [%s] is being rebalanced", job.CfID)
+		}
+		if _, err := ParseBalanceStrategy(string(job.BalanceBy)); err != nil {
+			return errors.Trace(err)
+		}
 	default:
 		return errors.Errorf("invalid admin job type: %d", job.Type)
 	}
-	o.adminJobsLock.Lock()
-	o.adminJobs = append(o.adminJobs, job)
-	o.adminJobsLock.Unlock()
 	return nil
 }
 
+// checkAdminJobTransition checks whether the changefeed in the state left by
+// the last admin job can be changed by the admin job. A running changefeed can
+// be stopped, finished or failed, only a stopped or failed changefeed can be
+// resumed, and a changefeed in any state can be removed.
+func checkAdminJobTransition(id model.ChangeFeedID, last, typ model.AdminJobType) error {
+	state := ChangefeedState(last)
+	var ok bool
+	switch typ {
+	case model.AdminResume:
+		ok = state == ChangefeedStateStopped || state == ChangefeedStateFailed
+	case model.AdminRemove:
+		ok = state != ChangefeedStateRemoved
+	default:
+		ok = state == ChangefeedStateNormal
+	}
+	if !ok {
+		return errors.Errorf("changefeed [%s] is %s, can't %s", id, state, typ)
+	}
+	return nil
+}
+
+// setAdminState records the admin job handled for the changefeed.
+func (o *ownerImpl) setAdminState(id model.ChangeFeedID, typ model.AdminJobType) {
+	if o.adminStates == nil {
+		o.adminStates = make(map[model.ChangeFeedID]model.AdminJobType)
+	}
+	o.adminStates[id] = typ
+}
+
 func (o *ownerImpl) writeDebugInfo(w io.Writer) {
 	for _, info := range o.changeFeeds {
 		// fmt.Fprintf(w, "%+v\n", *info)
@@ -15,7 +15,7 @@ package cdc
 
 import (
 	"context"
-	"database/sql"
+	"strconv"
 	"sync"
 
 	"github.com/pingcap/errors"
@@ -106,18 +106,44 @@ func (h *ddlHandler) PullDDL() (uint64, []*model.DDL, error) {
 }
 
 // ExecDDL implements roles.OwnerDDLHandler interface.
-func (h *ddlHandler) ExecDDL(ctx context.Context, sinkURI string, txn model.Txn) error {
+func (h *ddlHandler) ExecDDL(ctx context.Context, sinkURI string, opts map[string]string, txn model.Txn) error {
 	// TODO cache the sink
-	// TODO handle other target database, kile kafka, file
-	db, err := sql.Open("mysql", sinkURI)
+	s, err := sink.NewSink(sinkURI, nil, opts)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	defer db.Close()
-	s := sink.NewMySQLSinkDDLOnly(db)
+	defer s.Close()
 
 	err = s.EmitDDL(ctx, txn)
-	return errors.Trace(err)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the changefeed goes on after the DDL is durably applied
+	checkpointTs, err := s.FlushCheckpoint(ctx, txn.Ts)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if checkpointTs < txn.Ts {
+		return errors.Errorf("DDL is not applied by the sink, ts: %d, checkpoint ts: %d", txn.Ts, checkpointTs)
+	}
+	return nil
+}
+
+// sinkOptions returns the options of the sinks created for the changefeed, they
+// carry the options of the changefeed, the feature flags and the DDL config.
+func sinkOptions(id model.ChangeFeedID, info *model.ChangeFeedInfo) map[string]string {
+	opts := make(map[string]string, len(info.Opts)+len(info.Features)+2)
+	for k, v := range info.Opts {
+		opts[k] = v
+	}
+	for name, enabled := range info.Features {
+		opts[model.FeatureOptPrefix+name] = strconv.FormatBool(enabled)
+	}
+	opts[sink.OptChangefeedID] = id
+	if table := info.GetConfig().DDL.TrackTable; table != "" {
+		opts[sink.OptDDLTrackTable] = table
+	}
+	return opts
 }
 
 func (h *ddlHandler) Close() error {
@@ -2,6 +2,7 @@ package cdc
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"net/url"
 	"sync"
@@ -19,6 +20,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/schema"
 	"github.com/pingcap/ticdc/pkg/etcd"
 	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb-tools/pkg/filter"
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.etcd.io/etcd/embed"
@@ -75,7 +77,7 @@ func (h *handlerForPrueDMLTest) PullDDL() (resolvedTs uint64, ddl []*model.DDL,
 	return uint64(math.MaxUint64), nil, nil
 }
 
-func (h *handlerForPrueDMLTest) ExecDDL(context.Context, string, model.Txn) error {
+func (h *handlerForPrueDMLTest) ExecDDL(context.Context, string, map[string]string, model.Txn) error {
 	panic("unreachable")
 }
 
@@ -139,6 +141,7 @@ func (s *ownerSuite) TestPureDML(c *check.C) {
 	changeFeeds := map[model.ChangeFeedID]*changeFeed{
 		"test_change_feed": {
 			tables:                  tables,
+			info:                    &model.ChangeFeedInfo{},
 			status:                  &model.ChangeFeedStatus{},
 			processorLastUpdateTime: make(map[string]time.Time),
 			targetTs:                100,
@@ -196,7 +199,7 @@ func (h *handlerForDDLTest) PullDDL() (resolvedTs uint64, jobs []*model.DDL, err
 	return h.ddlResolvedTs[h.ddlIndex], []*model.DDL{h.ddls[h.ddlIndex]}, nil
 }
 
-func (h *handlerForDDLTest) ExecDDL(ctx context.Context, sinkURI string, txn model.Txn) error {
+func (h *handlerForDDLTest) ExecDDL(ctx context.Context, sinkURI string, opts map[string]string, txn model.Txn) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.ddlExpectIndex++
@@ -444,6 +447,89 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 	c.Assert(st.AdminJobType, check.Equals, model.AdminRemove)
 }
 
+func (s *ownerSuite) TestStopOnProcessorError(c *check.C) {
+	cfID := "test_processor_error"
+	runningErr := &model.RunningError{CaptureID: "capture_2", Message: "table not exists"}
+	cf := &changeFeed{
+		id:   cfID,
+		info: &model.ChangeFeedInfo{},
+		processorInfos: model.ProcessorsInfos{
+			"capture_1": {},
+			"capture_2": {Error: runningErr},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	owner := &ownerImpl{
+		manager:     manager,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{cfID: cf},
+	}
+
+	c.Assert(owner.stopOnProcessorError(cf), check.IsNil)
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{{CfID: cfID, Type: model.AdminStop}})
+	c.Assert(cf.info.Error, check.DeepEquals, runningErr)
+	// the changefeed is stopped only once
+	c.Assert(owner.stopOnProcessorError(cf), check.IsNil)
+	c.Assert(owner.adminJobs, check.HasLen, 1)
+}
+
+func (s *ownerSuite) TestEnqueueJobs(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	owner := &ownerImpl{
+		manager: manager,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{
+			"cf-1": {id: "cf-1"},
+			"cf-2": {id: "cf-2"},
+		},
+	}
+	jobs := []model.AdminJob{
+		{CfID: "cf-1", Type: model.AdminStop},
+		{CfID: "cf-3", Type: model.AdminStop},
+		{CfID: "cf-2", Type: model.AdminStop},
+		{CfID: "cf-1", Type: model.AdminStop},
+	}
+	_, err := owner.EnqueueJobs(jobs, false)
+	c.Assert(errors.Cause(err), check.Equals, concurrency.ErrElectionNotLeader)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+
+	// none of the jobs is enqueued if any of them fails
+	results, err := owner.EnqueueJobs(jobs, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 4)
+	c.Assert(results[0].Status, check.Equals, AdminJobAborted)
+	c.Assert(results[1].Status, check.Equals, AdminJobFailed)
+	c.Assert(results[1].Message, check.Matches, ".*not found.*")
+	c.Assert(results[2].Status, check.Equals, AdminJobAborted)
+	c.Assert(results[3].Status, check.Equals, AdminJobFailed)
+	c.Assert(results[3].Message, check.Matches, ".*duplicated.*")
+	c.Assert(owner.adminJobs, check.HasLen, 0)
+
+	// the valid jobs are enqueued regardless of the failed ones
+	results, err = owner.EnqueueJobs(jobs, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(results[0].Status, check.Equals, AdminJobQueued)
+	c.Assert(results[1].Status, check.Equals, AdminJobFailed)
+	c.Assert(results[2].Status, check.Equals, AdminJobQueued)
+	c.Assert(results[3].Status, check.Equals, AdminJobFailed)
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{
+		{CfID: "cf-1", Type: model.AdminStop},
+		{CfID: "cf-2", Type: model.AdminStop},
+	})
+
+	typ, err := ParseAdminJobType("remove")
+	c.Assert(err, check.IsNil)
+	c.Assert(typ, check.Equals, model.AdminRemove)
+	typ, err = ParseAdminJobType("2")
+	c.Assert(err, check.IsNil)
+	c.Assert(typ, check.Equals, model.AdminResume)
+	_, err = ParseAdminJobType("restart")
+	c.Assert(err, check.ErrorMatches, ".*invalid admin job type.*")
+}
+
 func (s *ownerSuite) TestChangefeedApplyDDLJob(c *check.C) {
 	var (
 		jobs = []*timodel.Job{
@@ -619,13 +705,13 @@ func (s *changefeedInfoSuite) TestMinimumTables(c *check.C) {
 	cf := &changeFeed{
 		processorInfos: map[model.CaptureID]*model.TaskStatus{
 			"c1": {
-				TableInfos: make([]*model.ProcessTableInfo, 2),
+				TableInfos: rebalanceTables(1, 2),
 			},
 			"c2": {
-				TableInfos: make([]*model.ProcessTableInfo, 1),
+				TableInfos: rebalanceTables(3),
 			},
 			"c3": {
-				TableInfos: make([]*model.ProcessTableInfo, 3),
+				TableInfos: rebalanceTables(4, 5, 6),
 			},
 		},
 	}
@@ -636,8 +722,592 @@ func (s *changefeedInfoSuite) TestMinimumTables(c *check.C) {
 		"c3": {},
 	}
 
-	c.Assert(cf.minimumTablesCapture(captures), check.Equals, "c2")
+	c.Assert(cf.selectCapture(captures), check.Equals, "c2")
 
 	captures["c4"] = &model.CaptureInfo{}
-	c.Assert(cf.minimumTablesCapture(captures), check.Equals, "c4")
+	c.Assert(cf.selectCapture(captures), check.Equals, "c4")
+}
+
+func (s *ownerSuite) TestApplyPartitionJobs(c *check.C) {
+	newTable := func(ids ...int64) *timodel.TableInfo {
+		table := &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("t"), Partition: &timodel.PartitionInfo{Enable: true}}
+		for _, id := range ids {
+			table.Partition.Definitions = append(table.Partition.Definitions, timodel.PartitionDefinition{ID: id})
+		}
+		return table
+	}
+	newJob := func(tp timodel.ActionType, ts uint64, table *timodel.TableInfo) *timodel.Job {
+		return &timodel.Job{
+			State:      timodel.JobStateSynced,
+			SchemaID:   1,
+			TableID:    10,
+			Type:       tp,
+			Query:      tp.String(),
+			BinlogInfo: &timodel.HistoryInfo{TableInfo: table, FinishedTS: ts},
+		}
+	}
+	storage, err := schema.NewStorage(nil)
+	c.Assert(err, check.IsNil)
+	createSchema := newJob(timodel.ActionCreateSchema, 1, nil)
+	createSchema.BinlogInfo.DBInfo = &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	_, _, _, err = storage.HandleDDL(createSchema)
+	c.Assert(err, check.IsNil)
+
+	filter, err := newTxnFilter(&model.ReplicaConfig{})
+	c.Assert(err, check.IsNil)
+	cf := &changeFeed{
+		schema:        storage,
+		schemas:       make(map[uint64]tableIDMap),
+		tables:        make(map[uint64]schema.TableName),
+		orphanTables:  make(map[uint64]model.ProcessTableInfo),
+		toCleanTables: make(map[uint64]struct{}),
+		filter:        filter,
+	}
+	name := schema.TableName{Schema: "test", Table: "t"}
+
+	// the partitions are replicated as the tables
+	c.Assert(cf.applyJob(newJob(timodel.ActionCreateTable, 2, newTable(101, 102))), check.IsNil)
+	c.Assert(cf.tables, check.DeepEquals, map[uint64]schema.TableName{101: name, 102: name})
+	c.Assert(cf.orphanTables[101].StartTs, check.Equals, uint64(2))
+	// the dispatched partitions are cleaned up from the processors
+	delete(cf.orphanTables, 101)
+	delete(cf.orphanTables, 102)
+
+	c.Assert(cf.applyJob(newJob(timodel.ActionTruncateTablePartition, 3, newTable(101, 103))), check.IsNil)
+	c.Assert(cf.applyJob(newJob(timodel.ActionAddTablePartition, 4, newTable(101, 103, 104))), check.IsNil)
+	c.Assert(cf.tables, check.DeepEquals, map[uint64]schema.TableName{101: name, 103: name, 104: name})
+	c.Assert(cf.toCleanTables, check.DeepEquals, map[uint64]struct{}{102: {}})
+	c.Assert(cf.orphanTables[103].StartTs, check.Equals, uint64(3))
+	c.Assert(cf.orphanTables[104].StartTs, check.Equals, uint64(4))
+
+	c.Assert(cf.applyJob(newJob(timodel.ActionDropTable, 5, nil)), check.IsNil)
+	c.Assert(cf.tables, check.HasLen, 0)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	c.Assert(cf.toCleanTables, check.DeepEquals, map[uint64]struct{}{101: {}, 102: {}})
+}
+
+func (s *ownerSuite) TestApplyRenameJobs(c *check.C) {
+	newJob := func(tp timodel.ActionType, ts uint64, name string) *timodel.Job {
+		return &timodel.Job{
+			State:      timodel.JobStateSynced,
+			SchemaID:   1,
+			TableID:    10,
+			Type:       tp,
+			Query:      tp.String(),
+			BinlogInfo: &timodel.HistoryInfo{TableInfo: &timodel.TableInfo{ID: 10, Name: timodel.NewCIStr(name)}, FinishedTS: ts},
+		}
+	}
+	storage, err := schema.NewStorage(nil)
+	c.Assert(err, check.IsNil)
+	createSchema := newJob(timodel.ActionCreateSchema, 1, "")
+	createSchema.BinlogInfo.DBInfo = &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	_, _, _, err = storage.HandleDDL(createSchema)
+	c.Assert(err, check.IsNil)
+
+	filter, err := newTxnFilter(&model.ReplicaConfig{
+		FilterRules: &filter.Rules{
+			DoDBs:        []string{"test"},
+			IgnoreTables: []*filter.Table{{Schema: "test", Name: "tmp"}},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	cf := &changeFeed{
+		schema:        storage,
+		schemas:       make(map[uint64]tableIDMap),
+		tables:        make(map[uint64]schema.TableName),
+		orphanTables:  make(map[uint64]model.ProcessTableInfo),
+		toCleanTables: make(map[uint64]struct{}),
+		filter:        filter,
+	}
+
+	// the ignored table is discovered when it's renamed into the filter
+	c.Assert(cf.applyJob(newJob(timodel.ActionCreateTable, 2, "tmp")), check.IsNil)
+	c.Assert(cf.tables, check.HasLen, 0)
+	c.Assert(cf.applyJob(newJob(timodel.ActionRenameTable, 3, "t")), check.IsNil)
+	c.Assert(cf.tables, check.DeepEquals, map[uint64]schema.TableName{10: {Schema: "test", Table: "t"}})
+	c.Assert(cf.schemas, check.DeepEquals, map[uint64]tableIDMap{1: {10: {}}})
+	c.Assert(cf.orphanTables[10].StartTs, check.Equals, uint64(3))
+	delete(cf.orphanTables, 10)
+
+	c.Assert(cf.applyJob(newJob(timodel.ActionRenameTable, 4, "t1")), check.IsNil)
+	c.Assert(cf.tables, check.DeepEquals, map[uint64]schema.TableName{10: {Schema: "test", Table: "t1"}})
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+
+	// and it's cleaned up from the processors when it's renamed out of it
+	c.Assert(cf.applyJob(newJob(timodel.ActionRenameTable, 5, "tmp")), check.IsNil)
+	c.Assert(cf.tables, check.HasLen, 0)
+	c.Assert(cf.schemas, check.DeepEquals, map[uint64]tableIDMap{1: {}})
+	c.Assert(cf.toCleanTables, check.DeepEquals, map[uint64]struct{}{10: {}})
+}
+
+func (s *ownerSuite) TestPauseResumeCluster(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	owner := &ownerImpl{
+		manager:    manager,
+		etcdClient: s.client,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{
+			"cf-1": {id: "cf-1"},
+			"cf-2": {id: "cf-2"},
+			"cf-3": {id: "cf-3"},
+		},
+	}
+	c.Assert(s.client.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{}, "cf-1"), check.IsNil)
+	c.Assert(s.client.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{AdminJobType: model.AdminStop}, "cf-2"), check.IsNil)
+	c.Assert(s.client.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{AdminJobType: model.AdminResume}, "cf-3"), check.IsNil)
+
+	_, err := owner.ResumeCluster(ctx)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrClusterNotPaused)
+
+	// only the running changefeeds are paused and recorded
+	result, err := owner.PauseCluster(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Pause.Changefeeds, check.DeepEquals, []model.ChangeFeedID{"cf-1", "cf-3"})
+	c.Assert(result.Changefeeds, check.DeepEquals, []*AdminJobResult{
+		{CfID: "cf-1", Status: AdminJobQueued},
+		{CfID: "cf-3", Status: AdminJobQueued},
+	})
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{
+		{CfID: "cf-1", Type: model.AdminStop},
+		{CfID: "cf-3", Type: model.AdminStop},
+	})
+	_, err = owner.PauseCluster(ctx)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrClusterPaused)
+
+	// cf-3 is removed while the cluster is paused
+	owner.adminJobs = nil
+	c.Assert(s.client.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{AdminJobType: model.AdminStop}, "cf-1"), check.IsNil)
+	c.Assert(s.client.DeleteChangeFeedInfo(ctx, "cf-3"), check.IsNil)
+	result, err = owner.ResumeCluster(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Changefeeds, check.HasLen, 2)
+	c.Assert(result.Changefeeds[0].Status, check.Equals, AdminJobQueued)
+	c.Assert(result.Changefeeds[1].Status, check.Equals, AdminJobSkipped)
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{{CfID: "cf-1", Type: model.AdminResume}})
+	pause, err := s.client.GetClusterPause(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(pause, check.IsNil)
+}
+
+func (s *ownerSuite) TestHandleUnsupportedDDL(c *check.C) {
+	job := &timodel.Job{
+		ID:         1,
+		Type:       timodel.ActionType(200),
+		State:      timodel.JobStateSynced,
+		Query:      "alter table t1 cache",
+		BinlogInfo: &timodel.HistoryInfo{FinishedTS: 10},
+	}
+	newChangefeed := func(policy string) *changeFeed {
+		storage, err := schema.NewStorage(nil)
+		c.Assert(err, check.IsNil)
+		cfg := &model.ReplicaConfig{DDL: model.DDLConfig{Unsupported: policy}}
+		storage.SetSkipUnsupportedDDL(cfg.DDL.UnsupportedPolicy() == model.DDLUnsupportedSkip)
+		filter, err := newTxnFilter(cfg)
+		c.Assert(err, check.IsNil)
+		return &changeFeed{
+			id:             "test",
+			info:           &model.ChangeFeedInfo{Config: cfg},
+			status:         &model.ChangeFeedStatus{},
+			schema:         storage,
+			filter:         filter,
+			ddlState:       model.ChangeFeedWaitToExecDDL,
+			ddlJobHistory:  []*model.DDL{{Job: job}},
+			processorInfos: model.ProcessorsInfos{"capture_1": {CheckPointTs: 10}},
+		}
+	}
+
+	// the changefeed is paused at the DDL by default
+	cf := newChangefeed("")
+	err := cf.handleDDL(context.Background(), nil)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrExecDDLFailed)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedDDLExecuteFailed)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+
+	// the DDL is skipped without being executed
+	cf = newChangefeed(model.DDLUnsupportedSkip)
+	c.Assert(cf.handleDDL(context.Background(), nil), check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 0)
+
+	// the owner fails with the error of the schema storage
+	cf = newChangefeed(model.DDLUnsupportedError)
+	err = cf.handleDDL(context.Background(), nil)
+	c.Assert(errors.Cause(err), check.Equals, schema.ErrUnsupportedDDL)
+}
+
+func (s *ownerSuite) TestCleanOrphanTasks(c *check.C) {
+	ctx := context.Background()
+	err := s.client.PutCaptureInfo(ctx, &model.CaptureInfo{ID: "alive"})
+	c.Assert(err, check.IsNil)
+	task := &model.TaskStatus{
+		CheckPointTs: 100,
+		TableInfos:   []*model.ProcessTableInfo{{ID: 1, StartTs: 50}, {ID: 2, StartTs: 50}},
+	}
+	for _, key := range [][2]string{{"running", "alive"}, {"running", "dead"}, {"other", "dead"}} {
+		err := s.client.PutTaskStatus(ctx, key[0], key[1], task)
+		c.Assert(err, check.IsNil)
+	}
+
+	cf := &changeFeed{
+		processorInfos: model.ProcessorsInfos{"alive": task, "dead": task},
+		orphanTables:   make(map[uint64]model.ProcessTableInfo),
+	}
+	owner := &ownerImpl{
+		etcdClient:        s.client,
+		changeFeeds:       map[model.ChangeFeedID]*changeFeed{"running": cf},
+		markDownProcessor: []*model.ProcInfoSnap{{CfID: "running", CaptureID: "dead"}},
+		captures:          map[model.CaptureID]*model.CaptureInfo{"alive": {ID: "alive"}},
+	}
+	owner.cleanOrphanTasks(ctx)
+
+	_, tasks, err := s.client.GetAllTaskStatuses(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks, check.HasLen, 1)
+	c.Assert(tasks["running"], check.HasLen, 1)
+	c.Assert(tasks["running"]["alive"], check.NotNil)
+	c.Assert(cf.processorInfos, check.HasLen, 1)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[uint64]model.ProcessTableInfo{
+		1: {ID: 1, StartTs: 100},
+		2: {ID: 2, StartTs: 100},
+	})
+	c.Assert(owner.markDownProcessor, check.HasLen, 0)
+
+	// the tasks are checked only once in the interval
+	err = s.client.PutTaskStatus(ctx, "other", "dead", task)
+	c.Assert(err, check.IsNil)
+	owner.cleanOrphanTasks(ctx)
+	_, tasks, err = s.client.GetAllTaskStatuses(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks["other"], check.HasLen, 1)
+}
+
+func (s *ownerSuite) TestMoveTable(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfID := "test_move_table"
+	loadTask := func(captureID string) *model.TaskStatus {
+		rev, task, err := s.client.GetTaskStatus(ctx, cfID, captureID)
+		c.Assert(err, check.IsNil)
+		task.ModRevision = rev
+		return task
+	}
+	source := &model.TaskStatus{
+		CheckPointTs: 120,
+		TableInfos:   []*model.ProcessTableInfo{{ID: 1, StartTs: 50}, {ID: 2, StartTs: 50}},
+	}
+	c.Assert(s.client.PutTaskStatus(ctx, cfID, "source", source), check.IsNil)
+	c.Assert(s.client.PutTaskStatus(ctx, cfID, "target", &model.TaskStatus{CheckPointTs: 140}), check.IsNil)
+
+	cf := &changeFeed{
+		id:           cfID,
+		status:       &model.ChangeFeedStatus{CheckpointTs: 100},
+		ddlState:     model.ChangeFeedSyncDML,
+		targetTs:     math.MaxUint64,
+		tables:       map[uint64]schema.TableName{1: {Table: "t1"}, 2: {Table: "t2"}},
+		orphanTables: make(map[uint64]model.ProcessTableInfo),
+		processorInfos: model.ProcessorsInfos{
+			"source": loadTask("source"),
+			"target": loadTask("target"),
+		},
+		infoWriter: storage.NewOwnerTaskStatusEtcdWriter(s.client),
+	}
+	captures := map[model.CaptureID]*model.CaptureInfo{"source": {ID: "source"}, "target": {ID: "target"}}
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	owner := &ownerImpl{
+		manager:     manager,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{cfID: cf},
+		captures:    captures,
+	}
+
+	err := owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminMoveTable, TableID: 1, TargetCaptureID: "unknown"})
+	c.Assert(err, check.ErrorMatches, ".*capture \\[unknown\\] not found.*")
+	err = owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminMoveTable, TableID: 3, TargetCaptureID: "target"})
+	c.Assert(err, check.ErrorMatches, ".*not found in any capture.*")
+	err = owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminMoveTable, TableID: 1, TargetCaptureID: "source"})
+	c.Assert(err, check.ErrorMatches, ".*already in capture.*")
+	err = owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminMoveTable, TableID: 1, TargetCaptureID: "target"})
+	c.Assert(err, check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	c.Assert(cf.movingTables, check.HasLen, 1)
+	err = owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminMoveTable, TableID: 1, TargetCaptureID: "target"})
+	c.Assert(err, check.ErrorMatches, ".*is being moved.*")
+
+	// the table is removed from the source with a P-lock
+	cf.moveTables(ctx, captures)
+	task := loadTask("source")
+	c.Assert(task.TableInfos, check.DeepEquals, []*model.ProcessTableInfo{{ID: 2, StartTs: 50}})
+	c.Assert(task.TablePLock, check.NotNil)
+	c.Assert(cf.movingTables[1].removed, check.IsTrue)
+	c.Assert(cf.movingTables[1].startTs, check.Equals, uint64(120))
+
+	// the checkpoint doesn't go beyond the start ts of the moving table
+	cf.processorInfos["source"].CheckPointTs = 150
+	c.Assert(cf.calcResolvedTs(), check.IsNil)
+	c.Assert(cf.status.CheckpointTs, check.Equals, uint64(120))
+
+	// the table isn't added to the target until the source confirms
+	cf.moveTables(ctx, captures)
+	c.Assert(loadTask("target").TableInfos, check.HasLen, 0)
+
+	task.CheckPointTs = 150
+	task.TableCLock = &model.TableLock{Ts: task.TablePLock.Ts, CheckpointTs: 130}
+	c.Assert(s.client.PutTaskStatus(ctx, cfID, "source", task), check.IsNil)
+	cf.processorInfos["source"] = loadTask("source")
+	cf.moveTables(ctx, captures)
+	c.Assert(loadTask("target").TableInfos, check.DeepEquals, []*model.ProcessTableInfo{{ID: 1, StartTs: 130}})
+	c.Assert(cf.movingTables, check.HasLen, 0)
+	c.Assert(cf.calcResolvedTs(), check.IsNil)
+	c.Assert(cf.status.CheckpointTs, check.Equals, uint64(140))
+}
+
+func (s *ownerSuite) TestEnqueueJobWithOwnerState(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cf := &changeFeed{
+		id:     "cf-1",
+		tables: map[uint64]schema.TableName{1: {Table: "t1"}},
+		processorInfos: model.ProcessorsInfos{
+			"source": {TableInfos: []*model.ProcessTableInfo{{ID: 1}}},
+		},
+		movingTables: make(map[uint64]*movingTable),
+	}
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	owner := &ownerImpl{
+		manager:     manager,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{"cf-1": cf},
+		captures:    map[model.CaptureID]*model.CaptureInfo{"source": {ID: "source"}, "target": {ID: "target"}},
+	}
+
+	// the owner updates its state with the lock held while the jobs are
+	// enqueued by the admin APIs, which is checked by the race detector
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			owner.l.Lock()
+			cf.processorInfos[fmt.Sprintf("capture-%d", i)] = &model.TaskStatus{}
+			cf.movingTables[uint64(i+2)] = &movingTable{}
+			owner.captures[fmt.Sprintf("capture-%d", i)] = &model.CaptureInfo{}
+			owner.setAdminState(fmt.Sprintf("cf-%d", i+2), model.AdminStop)
+			owner.l.Unlock()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		err := owner.EnqueueJob(model.AdminJob{CfID: "cf-1", Type: model.AdminMoveTable, TableID: 1, TargetCaptureID: "target"})
+		c.Assert(err, check.IsNil)
+		_, err = owner.EnqueueJobs([]model.AdminJob{{CfID: "cf-2", Type: model.AdminResume}}, false)
+		c.Assert(err, check.IsNil)
+	}
+	<-done
+}
+
+func (s *ownerSuite) TestCheckOwnership(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	owner := &ownerImpl{
+		manager:     manager,
+		changeFeeds: make(map[model.ChangeFeedID]*changeFeed),
+	}
+	c.Assert(owner.checkOwnership(), check.IsFalse)
+	c.Assert(owner.owning, check.IsFalse)
+
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	c.Assert(owner.checkOwnership(), check.IsTrue)
+	c.Assert(owner.owning, check.IsTrue)
+
+	owner.changeFeeds["cf-1"] = &changeFeed{id: "cf-1", ddlHandler: &handlerForDDLTest{}}
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: "cf-1", Type: model.AdminStop}), check.IsNil)
+	owner.lastSchemaSnapshotTs = 100
+	c.Assert(owner.checkOwnership(), check.IsTrue)
+	c.Assert(owner.changeFeeds, check.HasLen, 1)
+
+	// the state of the last term is dropped after the ownership is lost
+	c.Assert(manager.ResignOwner(ctx), check.IsNil)
+	c.Assert(owner.checkOwnership(), check.IsFalse)
+	c.Assert(owner.owning, check.IsFalse)
+	c.Assert(owner.changeFeeds, check.HasLen, 0)
+	c.Assert(owner.adminJobs, check.HasLen, 0)
+	c.Assert(owner.lastSchemaSnapshotTs, check.Equals, uint64(0))
+
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	c.Assert(owner.checkOwnership(), check.IsTrue)
+	c.Assert(owner.owning, check.IsTrue)
+}
+
+func (s *ownerSuite) TestAdminJobStateMachine(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newCF := func(id string) *changeFeed {
+		cf := &changeFeed{
+			id:             id,
+			info:           &model.ChangeFeedInfo{},
+			status:         &model.ChangeFeedStatus{CheckpointTs: 100},
+			ddlState:       model.ChangeFeedSyncDML,
+			ddlResolvedTs:  100,
+			targetTs:       100,
+			processorInfos: model.ProcessorsInfos{"capture-1": {CheckPointTs: 100}},
+			infoWriter:     storage.NewOwnerTaskStatusEtcdWriter(s.client),
+			ddlHandler:     &handlerForDDLTest{},
+		}
+		c.Assert(s.client.SaveChangeFeedInfo(ctx, cf.info, id), check.IsNil)
+		c.Assert(s.client.PutTaskStatus(ctx, id, "capture-1", cf.processorInfos["capture-1"]), check.IsNil)
+		return cf
+	}
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	owner := &ownerImpl{
+		manager:    manager,
+		etcdClient: s.client,
+		cfRWriter:  storage.NewChangeFeedEtcdRWriter(s.client),
+		captures:   map[model.CaptureID]*model.CaptureInfo{"capture-1": {ID: "capture-1"}},
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{
+			"finished": newCF("finished"),
+			"removed":  newCF("removed"),
+		},
+		adminStates: map[model.ChangeFeedID]model.AdminJobType{
+			"finished": model.AdminNone,
+			"removed":  model.AdminResume,
+		},
+	}
+	c.Assert(s.client.PutCaptureInfo(ctx, &model.CaptureInfo{ID: "capture-1"}), check.IsNil)
+
+	// a running changefeed can't be resumed
+	err := owner.EnqueueJob(model.AdminJob{CfID: "finished", Type: model.AdminResume})
+	c.Assert(err, check.ErrorMatches, ".*changefeed \\[finished\\] is normal, can't resume changefeed.*")
+
+	// the changefeed is finished after its checkpoint reaches the target ts
+	owner.changeFeeds["removed"].targetTs = 200
+	owner.changeFeeds["removed"].ddlResolvedTs = 200
+	c.Assert(owner.calcResolvedTs(), check.IsNil)
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{{CfID: "finished", Type: model.AdminFinish}})
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	c.Assert(owner.changeFeeds, check.HasLen, 1)
+	info, err := s.client.GetChangeFeedInfo(ctx, "finished")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.AdminJobType, check.Equals, model.AdminFinish)
+	st, err := s.client.GetChangeFeedStatus(ctx, "finished")
+	c.Assert(err, check.IsNil)
+	c.Assert(st.AdminJobType, check.Equals, model.AdminFinish)
+	c.Assert(st.CheckpointTs, check.Equals, uint64(100))
+	_, task, err := s.client.GetTaskStatus(ctx, "finished", "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(task.AdminJobType, check.Equals, model.AdminFinish)
+
+	// a finished changefeed can only be removed
+	for _, typ := range []model.AdminJobType{model.AdminResume, model.AdminStop} {
+		err = owner.EnqueueJob(model.AdminJob{CfID: "finished", Type: typ})
+		c.Assert(err, check.ErrorMatches, ".*changefeed \\[finished\\] is finished.*")
+	}
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: "finished", Type: model.AdminRemove}), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	_, err = s.client.GetChangeFeedInfo(ctx, "finished")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+	_, err = s.client.GetChangeFeedStatus(ctx, "finished")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+	tasks, err := s.client.GetAllTaskStatus(ctx, "finished")
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks, check.HasLen, 0)
+
+	// the jobs invalid when they're handled are dropped
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: "removed", Type: model.AdminRemove}), check.IsNil)
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: "removed", Type: model.AdminStop}), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	c.Assert(owner.adminJobs, check.HasLen, 0)
+	c.Assert(owner.changeFeeds, check.HasLen, 0)
+	_, err = s.client.GetChangeFeedInfo(ctx, "removed")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+	_, task, err = s.client.GetTaskStatus(ctx, "removed", "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(task.AdminJobType, check.Equals, model.AdminRemove)
+
+	// the keys of the running changefeed are deleted after the processors
+	// are told to stop
+	owner.cleanOrphanTasks(ctx)
+	_, err = s.client.GetChangeFeedStatus(ctx, "removed")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+	tasks, err = s.client.GetAllTaskStatus(ctx, "removed")
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks, check.HasLen, 0)
+}
+
+func (s *ownerSuite) TestErrorRestart(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now()
+	stopped := &model.ChangeFeedInfo{
+		AdminJobType: model.AdminStop,
+		Error:        &model.RunningError{Message: "sink error"},
+		Restart:      &model.ErrorRestart{Count: 1, LastError: now, NextRestart: now.Add(-time.Second)},
+	}
+	failed := &model.ChangeFeedInfo{
+		AdminJobType: model.AdminFail,
+		Error:        &model.RunningError{Message: "sink error"},
+		Restart:      &model.ErrorRestart{Count: 5, LastError: now},
+	}
+	paused := &model.ChangeFeedInfo{
+		AdminJobType: model.AdminStop,
+		Error:        &model.RunningError{Message: "sink error"},
+		Restart:      &model.ErrorRestart{Count: 1, LastError: now, NextRestart: now.Add(time.Hour)},
+	}
+	for id, info := range map[string]*model.ChangeFeedInfo{"stopped": stopped, "failed": failed, "paused": paused} {
+		c.Assert(s.client.SaveChangeFeedInfo(ctx, info, id), check.IsNil)
+		c.Assert(s.client.PutChangeFeedStatus(ctx, id, &model.ChangeFeedStatus{AdminJobType: info.AdminJobType}), check.IsNil)
+	}
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+	owner := &ownerImpl{
+		manager:    manager,
+		etcdClient: s.client,
+		adminStates: map[model.ChangeFeedID]model.AdminJobType{
+			"stopped": model.AdminStop,
+			"failed":  model.AdminFail,
+			"paused":  model.AdminStop,
+		},
+		pendingRestarts: map[model.ChangeFeedID]time.Time{
+			"stopped": now.Add(-time.Second),
+			"paused":  now.Add(time.Hour),
+		},
+	}
+
+	// the changefeeds are left stopped while the cluster is paused
+	c.Assert(s.client.CreateClusterPause(ctx, &model.ClusterPause{}), check.IsNil)
+	c.Assert(owner.restartOnError(ctx, now), check.IsNil)
+	c.Assert(owner.adminJobs, check.HasLen, 0)
+	c.Assert(owner.pendingRestarts, check.HasLen, 2)
+	c.Assert(s.client.DeleteClusterPause(ctx), check.IsNil)
+
+	// only the changefeeds whose backoffs pass are restarted
+	c.Assert(owner.restartOnError(ctx, now), check.IsNil)
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{{CfID: "stopped", Type: model.AdminResume, Restart: true}})
+	c.Assert(owner.pendingRestarts, check.HasLen, 1)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	info, err := s.client.GetChangeFeedInfo(ctx, "stopped")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.AdminJobType, check.Equals, model.AdminResume)
+	c.Assert(info.Error, check.IsNil)
+	c.Assert(info.Restart.Count, check.Equals, 2)
+	c.Assert(info.Restart.NextRestart.IsZero(), check.IsTrue)
+
+	// resuming the changefeed once its downstream recovers counts as a restart
+	c.Assert(owner.enqueueJob(model.AdminJob{CfID: "paused", Type: model.AdminResume, AutoResume: true}), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	info, err = s.client.GetChangeFeedInfo(ctx, "paused")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.AdminJobType, check.Equals, model.AdminResume)
+	c.Assert(info.Restart.Count, check.Equals, 2)
+	c.Assert(info.Restart.NextRestart.IsZero(), check.IsTrue)
+	c.Assert(owner.pendingRestarts, check.HasLen, 0)
+
+	// a failed changefeed can be resumed by users, its restarts start over
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: "failed", Type: model.AdminResume}), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	info, err = s.client.GetChangeFeedInfo(ctx, "failed")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.AdminJobType, check.Equals, model.AdminResume)
+	c.Assert(info.Restart, check.IsNil)
 }
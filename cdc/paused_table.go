@@ -0,0 +1,161 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+// ResumePausedTable marks a table paused by its sink error to be resumed, the
+// processor replicating the table replicates it again from the first
+// transaction not written. The cause of the error should be fixed before. The
+// table can't be resumed if the data to replicate again may have been garbage
+// collected.
+func ResumePausedTable(ctx context.Context, cli kv.CDCEtcdClient, pdCli pd.Client, id string, tableID int64) error {
+	if id == "" {
+		return errors.New("changefeed id must be specified")
+	}
+	// the safepoint is never moved backward, so it's only read with zero
+	safePoint, err := pdCli.UpdateGCSafePoint(ctx, 0)
+	if err != nil {
+		return errors.Annotate(err, "get gc safepoint")
+	}
+	return retry.Run(func() error {
+		statuses, err := cli.GetAllTaskStatus(ctx, id)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for captureID, status := range statuses {
+			for _, table := range status.PausedTables {
+				if table.ID != tableID {
+					continue
+				}
+				if table.Resume {
+					return nil
+				}
+				if table.Ts-1 < safePoint {
+					return backoff.Permanent(errors.Errorf("paused table %d of changefeed %s can't be resumed from ts %d, which is earlier than the gc safepoint %d",
+						tableID, id, table.Ts-1, safePoint))
+				}
+				table.Resume = true
+				if err := putTaskStatusIfNotModified(ctx, cli, id, captureID, status); err != nil {
+					return errors.Trace(err)
+				}
+				log.Info("paused table is marked to be resumed", zap.String("changefeed", id),
+					zap.String("capture", captureID), zap.Int64("tableID", tableID))
+				return nil
+			}
+		}
+		return backoff.Permanent(errors.NotFoundf("paused table %d of changefeed %s", tableID, id))
+	}, 3)
+}
+
+// updatePausedTables records the paused tables reported by the processors, so
+// the tables are still paused after they are moved to the other captures or
+// their captures are gone. A table is forgotten once it's marked to be
+// resumed, or the processor replicating it doesn't report it any more.
+func (c *changeFeed) updatePausedTables(processInfos model.ProcessorsInfos) {
+	if c.pausedTables == nil {
+		c.pausedTables = make(map[string]*model.PausedTable)
+	}
+	for _, pinfo := range processInfos {
+		reported := make(map[string]struct{}, len(pinfo.PausedTables))
+		for _, table := range pinfo.PausedTables {
+			name := util.QuoteSchema(table.Schema, table.Table)
+			reported[name] = struct{}{}
+			if table.Resume {
+				delete(c.pausedTables, name)
+				continue
+			}
+			paused := *table
+			c.pausedTables[name] = &paused
+		}
+		for _, table := range pinfo.TableInfos {
+			name, ok := c.tables[table.ID]
+			if !ok {
+				continue
+			}
+			quoted := util.QuoteSchema(name.Schema, name.Table)
+			if _, ok := reported[quoted]; !ok {
+				delete(c.pausedTables, quoted)
+			}
+		}
+	}
+}
+
+// attachPausedTable adds the pause of the table to the task status of the
+// capture the table is dispatched to.
+func (c *changeFeed) attachPausedTable(info *model.TaskStatus, tableID uint64) {
+	name, ok := c.tables[tableID]
+	if !ok {
+		return
+	}
+	paused, ok := c.pausedTables[util.QuoteSchema(name.Schema, name.Table)]
+	if !ok {
+		return
+	}
+	for _, table := range info.PausedTables {
+		if table.Schema == paused.Schema && table.Table == paused.Table {
+			return
+		}
+	}
+	table := *paused
+	info.PausedTables = append(info.PausedTables, &table)
+}
+
+// pausedCheckpointTs returns the ts the checkpoint is held at by the paused
+// tables, the tables are replicated again from the first transactions not
+// written after resumed. It returns 0 if no table is paused.
+func (c *changeFeed) pausedCheckpointTs() uint64 {
+	var ts uint64
+	for _, table := range c.pausedTables {
+		if ts == 0 || table.Ts-1 < ts {
+			ts = table.Ts - 1
+		}
+	}
+	return ts
+}
+
+// putTaskStatusIfNotModified writes the task status if it's not modified since
+// read, model.ErrWriteTsConflict is returned otherwise.
+func putTaskStatusIfNotModified(ctx context.Context, cli kv.CDCEtcdClient, id, captureID string, status *model.TaskStatus) error {
+	key := kv.GetEtcdKeyTask(id, captureID)
+	value, err := status.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp, err := cli.Client.KV.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(key), "=", status.ModRevision),
+	).Then(
+		clientv3.OpPut(key, value),
+	).Commit()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !resp.Succeeded {
+		return errors.Annotatef(model.ErrWriteTsConflict, "key: %s", key)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type pausedTableSuite struct{}
+
+var _ = check.Suite(&pausedTableSuite{})
+
+func (s *pausedTableSuite) TestResumePausedTable(c *check.C) {
+	etcdURL, server, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	defer server.Close()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{etcdURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	defer client.Close()
+	cli := kv.NewCDCEtcdClient(client)
+	ctx := context.Background()
+
+	err = cli.PutTaskStatus(ctx, "cf", "capture1", &model.TaskStatus{})
+	c.Assert(err, check.IsNil)
+	err = cli.PutTaskStatus(ctx, "cf", "capture2", &model.TaskStatus{
+		PausedTables: []*model.PausedTable{{ID: 47, Schema: "test", Table: "t1", Ts: 10}},
+	})
+	c.Assert(err, check.IsNil)
+
+	pdCli := &mockSafePointPDClient{safePoint: 5}
+	err = ResumePausedTable(ctx, cli, pdCli, "cf", 49)
+	c.Assert(errors.IsNotFound(err), check.IsTrue)
+
+	// the data to replicate again may have been garbage collected
+	pdCli.safePoint = 10
+	err = ResumePausedTable(ctx, cli, pdCli, "cf", 47)
+	c.Assert(err, check.ErrorMatches, ".*earlier than the gc safepoint 10.*")
+	_, status, err := cli.GetTaskStatus(ctx, "cf", "capture2")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.PausedTables[0].Resume, check.IsFalse)
+
+	pdCli.safePoint = 9
+	err = ResumePausedTable(ctx, cli, pdCli, "cf", 47)
+	c.Assert(err, check.IsNil)
+	_, status, err = cli.GetTaskStatus(ctx, "cf", "capture2")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.PausedTables, check.HasLen, 1)
+	c.Assert(status.PausedTables[0].Resume, check.IsTrue)
+	c.Assert(status.PausedTables[0].Ts, check.Equals, uint64(10))
+}
+
+func (s *pausedTableSuite) TestOwnerKeepsPausedTables(c *check.C) {
+	cf := &changeFeed{
+		tables: map[uint64]schema.TableName{
+			47: {Schema: "test", Table: "t1"},
+			48: {Schema: "test", Table: "t2"},
+		},
+	}
+	cf.updatePausedTables(model.ProcessorsInfos{
+		"capture1": {
+			TableInfos:   []*model.ProcessTableInfo{{ID: 47}, {ID: 48}},
+			PausedTables: []*model.PausedTable{{ID: 47, Schema: "test", Table: "t1", Ts: 10}},
+		},
+	})
+	c.Assert(cf.pausedCheckpointTs(), check.Equals, uint64(9))
+
+	// the pause is kept after the capture is gone, and dispatched with the
+	// table to the new capture
+	cf.updatePausedTables(model.ProcessorsInfos{})
+	info := &model.TaskStatus{TableInfos: []*model.ProcessTableInfo{{ID: 47}}}
+	cf.attachPausedTable(info, 47)
+	cf.attachPausedTable(info, 47)
+	cf.attachPausedTable(info, 48)
+	c.Assert(info.PausedTables, check.DeepEquals, []*model.PausedTable{{ID: 47, Schema: "test", Table: "t1", Ts: 10}})
+	cf.updatePausedTables(model.ProcessorsInfos{"capture2": info})
+	c.Assert(cf.pausedCheckpointTs(), check.Equals, uint64(9))
+
+	// the pause is forgotten once the table is resumed
+	info.PausedTables = nil
+	cf.updatePausedTables(model.ProcessorsInfos{"capture2": info})
+	c.Assert(cf.pausedCheckpointTs(), check.Equals, uint64(0))
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// CaptureConfig is the config of the capture used by the placement of the
+// tables.
+type CaptureConfig struct {
+	Labels    map[string]string
+	MaxTables int
+	Dedicated bool
+}
+
+func (cfg CaptureConfig) validate() error {
+	if cfg.MaxTables < 0 {
+		return errors.Errorf("invalid max-tables: %d", cfg.MaxTables)
+	}
+	if cfg.Dedicated && len(cfg.Labels) == 0 {
+		return errors.New("a dedicated capture must have labels to be selected by the changefeeds")
+	}
+	return errors.Trace(model.ValidateLabels(cfg.Labels))
+}
+
+// captureTables returns the number of the tables of all the changefeeds in
+// each capture, a table moving to a capture is counted in the target after
+// it's removed from the source. It's called in run with the lock held.
+func (o *ownerImpl) captureTables() map[string]int {
+	counts := make(map[string]int, len(o.captures))
+	for _, cf := range o.changeFeeds {
+		for id, status := range cf.processorInfos {
+			counts[id] += len(status.TableInfos)
+		}
+		for _, move := range cf.movingTables {
+			if move.removed {
+				counts[move.target]++
+			}
+		}
+	}
+	return counts
+}
+
+// placeableCaptures returns the captures allowed by the placement rule of the
+// changefeed, and sets the room of the captures with max tables for the
+// tables placed to them. It's called in run with the lock held.
+func (o *ownerImpl) placeableCaptures(cf *changeFeed, captures map[string]*model.CaptureInfo) map[string]*model.CaptureInfo {
+	var rule *model.PlacementRule
+	if cf.info != nil {
+		rule = cf.info.Placement
+	}
+	counts := o.captureTables()
+	placeable := make(map[string]*model.CaptureInfo, len(captures))
+	room := make(map[string]int)
+	for id, info := range captures {
+		if !rule.Allows(info) {
+			continue
+		}
+		placeable[id] = info
+		if info.MaxTables > 0 {
+			room[id] = info.MaxTables - counts[id]
+		}
+	}
+	cf.captureRoom = room
+	return placeable
+}
+
+// misplacedCaptures returns the draining captures and the captures not
+// allowed by the placement rule of the changefeed, the tables in them are
+// moved to the placeable captures.
+func misplacedCaptures(draining map[string]struct{}, captures, placeable map[string]*model.CaptureInfo) map[string]struct{} {
+	misplaced := make(map[string]struct{}, len(draining))
+	for id := range draining {
+		misplaced[id] = struct{}{}
+	}
+	for id := range captures {
+		if _, ok := placeable[id]; !ok {
+			misplaced[id] = struct{}{}
+		}
+	}
+	return misplaced
+}
+
+// hasRoom returns whether a table can be placed to the capture.
+func (c *changeFeed) hasRoom(captureID string) bool {
+	room, ok := c.captureRoom[captureID]
+	return !ok || room > 0
+}
+
+// takeRoom records a table placed to the capture.
+func (c *changeFeed) takeRoom(captureID string) {
+	if _, ok := c.captureRoom[captureID]; ok {
+		c.captureRoom[captureID]--
+	}
+}
+
+// freeRoom records a table planned to be moved out of the capture.
+func (c *changeFeed) freeRoom(captureID string) {
+	if _, ok := c.captureRoom[captureID]; ok {
+		c.captureRoom[captureID]++
+	}
+}
+
+// checkPlacement returns an error if the table can't be moved to the capture
+// by the placement rule of the changefeed or the max tables of the capture.
+// It's called with o.l held, by the owner handling the admin jobs or by the
+// admin APIs checking the jobs.
+func (o *ownerImpl) checkPlacement(cf *changeFeed, target *model.CaptureInfo) error {
+	var rule *model.PlacementRule
+	if cf.info != nil {
+		rule = cf.info.Placement
+	}
+	if !rule.Allows(target) {
+		return errors.Errorf("capture [%s] isn't allowed by the placement rule of changefeed [%s]", target.ID, cf.id)
+	}
+	if target.MaxTables > 0 && o.captureTables()[target.ID] >= target.MaxTables {
+		return errors.Errorf("capture [%s] has reached its max tables %d", target.ID, target.MaxTables)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type placementSuite struct{}
+
+var _ = check.Suite(&placementSuite{})
+
+func (s *placementSuite) TestPlaceableCaptures(c *check.C) {
+	captures := map[string]*model.CaptureInfo{
+		"zone-1": {ID: "zone-1", Labels: map[string]string{"zone": "z1"}, MaxTables: 4},
+		"zone-2": {ID: "zone-2", Labels: map[string]string{"zone": "z2"}},
+		"heavy":  {ID: "heavy", Labels: map[string]string{"zone": "z1", "pool": "heavy"}, Dedicated: true},
+	}
+	other := &changeFeed{
+		id:             "other",
+		processorInfos: model.ProcessorsInfos{"zone-1": {TableInfos: rebalanceTables(1, 2)}},
+	}
+	cf := &changeFeed{
+		id:             "cf",
+		info:           &model.ChangeFeedInfo{},
+		processorInfos: model.ProcessorsInfos{"zone-2": {TableInfos: rebalanceTables(3)}},
+		// the moving table is counted in the target after it's removed
+		movingTables: map[uint64]*movingTable{4: {source: "zone-2", target: "zone-1", removed: true}},
+	}
+	owner := &ownerImpl{
+		captures:    captures,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{"other": other, "cf": cf},
+	}
+	c.Assert(owner.captureTables(), check.DeepEquals, map[string]int{"zone-1": 3, "zone-2": 1})
+
+	// the dedicated capture only takes the changefeeds selecting it
+	placeable := owner.placeableCaptures(cf, captures)
+	c.Assert(placeable, check.HasLen, 2)
+	c.Assert(placeable, check.HasKey, "zone-1")
+	c.Assert(placeable, check.HasKey, "zone-2")
+	c.Assert(cf.captureRoom, check.DeepEquals, map[string]int{"zone-1": 1})
+	c.Assert(misplacedCaptures(nil, captures, placeable), check.DeepEquals, map[string]struct{}{"heavy": {}})
+
+	cf.info.Placement = &model.PlacementRule{CaptureLabels: map[string]string{"zone": "z1"}}
+	placeable = owner.placeableCaptures(cf, captures)
+	c.Assert(placeable, check.HasLen, 2)
+	c.Assert(placeable, check.HasKey, "zone-1")
+	c.Assert(placeable, check.HasKey, "heavy")
+	c.Assert(misplacedCaptures(map[string]struct{}{"zone-1": {}}, captures, placeable), check.DeepEquals,
+		map[string]struct{}{"zone-1": {}, "zone-2": {}})
+
+	cf.info.Placement = &model.PlacementRule{CaptureLabels: map[string]string{"pool": "heavy"}}
+	placeable = owner.placeableCaptures(cf, captures)
+	c.Assert(placeable, check.HasLen, 1)
+	c.Assert(placeable, check.HasKey, "heavy")
+	c.Assert(owner.checkPlacement(cf, captures["zone-1"]), check.ErrorMatches,
+		`capture \[zone-1\] isn't allowed by the placement rule of changefeed \[cf\]`)
+
+	cf.info.Placement = nil
+	c.Assert(owner.checkPlacement(cf, captures["zone-1"]), check.IsNil)
+	other.processorInfos["zone-1"].TableInfos = rebalanceTables(1, 2, 3)
+	c.Assert(owner.checkPlacement(cf, captures["zone-1"]), check.ErrorMatches,
+		`capture \[zone-1\] has reached its max tables 4`)
+	c.Assert(owner.checkPlacement(cf, captures["zone-2"]), check.IsNil)
+}
+
+func (s *placementSuite) TestPlaceTablesWithinRoom(c *check.C) {
+	captures := map[string]*model.CaptureInfo{
+		"small": {ID: "small", MaxTables: 1},
+		"big":   {ID: "big"},
+	}
+	cf := &changeFeed{
+		id:             "cf",
+		orphanTables:   make(map[uint64]model.ProcessTableInfo),
+		processorInfos: make(model.ProcessorsInfos),
+		infoWriter:     newSimTaskStore(),
+		captureRoom:    map[string]int{"small": 1},
+	}
+	for id := uint64(1); id <= 4; id++ {
+		cf.orphanTables[id] = model.ProcessTableInfo{ID: id}
+	}
+	cf.banlanceOrphanTables(context.Background(), captures)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	c.Assert(cf.processorInfos["small"].TableInfos, check.HasLen, 1)
+	c.Assert(cf.processorInfos["big"].TableInfos, check.HasLen, 3)
+	c.Assert(cf.hasRoom("small"), check.IsFalse)
+	c.Assert(cf.hasRoom("big"), check.IsTrue)
+
+	// the rebalance and the drain don't move the tables to the full capture
+	c.Assert(cf.planRebalance(captures, model.BalanceByCount), check.HasLen, 0)
+	cf.drainTables(map[string]struct{}{"big": {}}, map[string]*model.CaptureInfo{"small": captures["small"]})
+	c.Assert(cf.plannedMoves, check.HasLen, 0)
+
+	cf.captureRoom["small"] = 2
+	c.Assert(cf.planRebalance(captures, model.BalanceByCount), check.DeepEquals, []*plannedMove{
+		{tableID: 1, source: "big", target: "small"},
+	})
+	c.Assert(cf.captureRoom["small"], check.Equals, 1)
+}
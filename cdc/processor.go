@@ -17,6 +17,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -38,6 +41,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/pingcap/ticdc/pkg/retry"
 	"github.com/pingcap/ticdc/pkg/util"
+	tidbkv "github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/helper"
 	"github.com/pingcap/tidb/store/tikv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -54,6 +58,13 @@ const (
 	resolveTsInterval         = time.Millisecond * 500
 	waitGlobalResolvedTsDelay = time.Millisecond * 500
 	flushDMLsInterval         = time.Millisecond * 10
+	// the traffic of the tables is reported in the task status once an
+	// interval, the owner rebalances the tables by it.
+	trafficReportInterval = 30 * time.Second
+	// the regions of the tables are counted once an interval, the owner
+	// places the tables by the traffic and the regions.
+	regionReportInterval = time.Minute
+	regionScanLimit      = 1024
 )
 
 var (
@@ -61,44 +72,135 @@ var (
 	fNewPDCli     = pd.NewClient
 	fNewTsRWriter = createTsRWriter
 	fNewMounter   = newMounter
-	fNewMySQLSink = sink.NewMySQLSink
+	fNewSink      = sink.NewSink
 )
 
+// dataDir is the directory of the local data of the capture, the temporary
+// directory of the system is used if it's empty.
+var dataDir string
+
+// prepareSorterDir returns the directory of the files spilled by the sorters
+// of the changefeed, the files left by the previous processes are removed.
+func prepareSorterDir(changefeedID string) (string, error) {
+	sorterDir := filepath.Join(dataBaseDir(), "sorter")
+	dir := filepath.Join(sorterDir, changefeedID)
+	// the changefeeds created before the IDs are validated may escape the
+	// sorter dir, which must never be removed
+	if rel, err := filepath.Rel(sorterDir, dir); err != nil || rel != filepath.Base(dir) || rel == "." {
+		return "", errors.Errorf("invalid sorter dir %s of changefeed %s", dir, changefeedID)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", errors.Annotatef(err, "clear the sorter dir %s", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Annotatef(err, "create the sorter dir %s", dir)
+	}
+	return dir, nil
+}
+
 type mounter interface {
 	Mount(rawTxn model.RawTxn) (model.Txn, error)
 }
 
 type txnChannel struct {
-	inputTxn   <-chan model.RawTxn
-	outputTxn  chan model.RawTxn
+	inputTxn  <-chan model.RawTxn
+	outputTxn chan model.RawTxn
+	// mu serializes Forward and Drain
+	mu         sync.Mutex
 	putBackTxn *model.RawTxn
+	// dropping is set by Drain, the txns aren't forwarded once it's set
+	dropping bool
+	// rows is the number of the forwarded entries.
+	rows int64
+	// onForward is called with the size of each forwarded txn if it's set.
+	onForward func(size int64)
 }
 
-// Forward push all txn with commit ts not greater than ts into targetC.
-func (p *txnChannel) Forward(ctx context.Context, ts uint64, targetC chan<- model.RawTxn) {
+// Rows returns the number of the entries forwarded by the channel.
+func (p *txnChannel) Rows() int64 {
+	return atomic.LoadInt64(&p.rows)
+}
+
+// Forward push all txn with commit ts not greater than ts into targetC, it
+// returns the number of the pushed txns with entries.
+func (p *txnChannel) Forward(ctx context.Context, ts uint64, targetC chan<- model.RawTxn) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	count := 0
+	if p.dropping {
+		return count
+	}
 	if p.putBackTxn != nil {
 		t := *p.putBackTxn
 		if t.Ts > ts {
-			return
+			return count
 		}
 		p.putBackTxn = nil
 		pushTxn(ctx, targetC, t)
+		p.forwarded(t)
+		if len(t.Entries) > 0 {
+			count++
+			atomic.AddInt64(&p.rows, int64(len(t.Entries)))
+		}
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return count
 		case t, ok := <-p.outputTxn:
 			if !ok {
 				log.Info("Input channel of table closed")
-				return
+				return count
 			}
 			if t.Ts > ts {
 				p.putBack(t)
-				return
+				return count
 			}
 			pushTxn(ctx, targetC, t)
+			p.forwarded(t)
+			if len(t.Entries) > 0 {
+				count++
+				atomic.AddInt64(&p.rows, int64(len(t.Entries)))
+			}
+		}
+	}
+}
+
+// Passed returns true if a txn after ts is received, so all the txns not
+// after ts are forwarded.
+func (p *txnChannel) Passed(ts uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.putBackTxn != nil && p.putBackTxn.Ts > ts
+}
+
+func (p *txnChannel) forwarded(t model.RawTxn) {
+	if p.onForward != nil && len(t.Entries) > 0 {
+		p.onForward(t.Size())
+	}
+}
+
+// Drain drops the txns not forwarded until the input channel is closed or ctx
+// is done, and calls onDrop with the size of each of them. The txns aren't
+// forwarded any more once it's called, and it doesn't block Forward.
+func (p *txnChannel) Drain(ctx context.Context, onDrop func(size int64)) {
+	p.mu.Lock()
+	p.dropping = true
+	if p.putBackTxn != nil {
+		onDrop(p.putBackTxn.Size())
+		p.putBackTxn = nil
+	}
+	p.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t, ok := <-p.outputTxn:
+			if !ok {
+				return
+			}
+			onDrop(t.Size())
 		}
 	}
 }
@@ -147,9 +249,29 @@ type processor struct {
 	pdCli   pd.Client
 	etcdCli kv.CDCEtcdClient
 
+	// sorterDir is the directory of the spilled files of the sorters if the
+	// dir of the sorter config is empty.
+	sorterDir string
+
 	mounter       mounter
 	schemaStorage *schema.Storage
 	sink          sink.Sink
+	// sinkFlushedTs is the ts flushed by the asynchronous sink, the checkpoint
+	// advances with it.
+	sinkFlushedTs uint64
+	// profiler is nil if the profiling of the tables is disabled.
+	profiler *sink.TableProfiler
+	// orderVerifier is nil if the order of the events isn't verified.
+	orderVerifier *sink.OrderVerifySink
+	// committer is set if the sink supports two-phase commit, the checkpoints
+	// are persisted through checkpointCh before the transactions are
+	// committed.
+	committer    sink.TwoPhaseCommitter
+	checkpointCh chan *checkpointRequest
+
+	// checkpointStepper splits the range of the global resolved ts, it's nil
+	// if the checkpoint goes forward to the global resolved ts directly.
+	checkpointStepper *checkpointStepper
 
 	ddlPuller    puller.Puller
 	ddlJobsCh    chan model.RawTxn
@@ -164,6 +286,35 @@ type processor struct {
 	tablesMu sync.Mutex
 	tables   map[int64]*tableInfo
 
+	// lastTableRows are the rows of the tables in the last traffic report.
+	lastTrafficReport time.Time
+	lastTableRows     map[int64]int64
+	lastRegionReport  time.Time
+
+	// pausedTables are the tables paused by their sink errors keyed by the
+	// quoted table name, the tables are only paused if isolateTableErrors is
+	// set, otherwise the errors fail the processor.
+	isolateTableErrors bool
+	pausedMu           sync.Mutex
+	pausedTables       map[string]*model.PausedTable
+
+	// eligibility tracks the unique keys of the tables, ineligiblePolicy is
+	// applied to the tables without a unique key.
+	eligibility      *eligibilityTracker
+	ineligiblePolicy string
+
+	// kvStore reads the old values of the rows if enable-old-value is set
+	kvStore tidbkv.Storage
+
+	// memQuota accounts the changes buffered by the processor, from they are
+	// pulled until they are written by the sink. The resolved changes of each
+	// table are accounted by the table quota of tableQuotaBytes too until they
+	// are forwarded, and the forwarded ones by sinkQuota until they are
+	// written.
+	memQuota        *util.MemoryQuota
+	sinkQuota       *util.MemoryQuota
+	tableQuotaBytes int64
+
 	wg    *errgroup.Group
 	errCh chan<- error
 }
@@ -174,6 +325,10 @@ type tableInfo struct {
 	inputChan  *txnChannel
 	inputTxn   chan model.RawTxn
 	resolvedTS uint64
+	quota      *util.MemoryQuota
+	// holdTs is the ts the checkpoint is held at until the resumed table
+	// catches up with the others, it's 0 if the table isn't resumed.
+	holdTs uint64
 }
 
 func (t *tableInfo) loadResolvedTS() uint64 {
@@ -210,7 +365,10 @@ func NewProcessor(pdEndpoints []string, changefeed model.ChangeFeedInfo, changef
 		return nil, errors.Annotate(err, "new etcd client")
 	}
 	cdcEtcdCli := kv.NewCDCEtcdClient(etcdCli)
-	schemaStorage, err := fCreateSchema(pdEndpoints)
+	cdcEtcdCli.EnableAudit(func() string {
+		return "processor/" + captureID
+	})
+	schemaStorage, err := fCreateSchema(pdEndpoints, loadSchemaSnapshot(context.Background(), cdcEtcdCli, checkpointTs))
 	if err != nil {
 		return nil, err
 	}
@@ -225,16 +383,19 @@ func NewProcessor(pdEndpoints []string, changefeed model.ChangeFeedInfo, changef
 	ddlPuller := puller.NewPuller(pdCli, checkpointTs, []util.Span{util.GetDDLSpan()}, false)
 
 	mounter := fNewMounter(schemaStorage)
+	config := changefeed.GetConfig()
 
-	sink, err := fNewMySQLSink(changefeed.SinkURI, schemaStorage, changefeed.Opts)
+	sinker, err := fNewSink(changefeed.SinkURI, schemaStorage, sinkOptions(changefeedID, &changefeed))
 	if err != nil {
 		return nil, err
 	}
 
-	filter, err := newTxnFilter(changefeed.GetConfig())
+	filter, err := newTxnFilter(config)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	schemaStorage.SetGCRetention(config.SchemaGCRetention())
+	schemaStorage.SetSkipUnsupportedDDL(config.DDL.UnsupportedPolicy() == model.DDLUnsupportedSkip)
 
 	p := &processor{
 		captureID:     captureID,
@@ -244,7 +405,7 @@ func NewProcessor(pdEndpoints []string, changefeed model.ChangeFeedInfo, changef
 		etcdCli:       cdcEtcdCli,
 		mounter:       mounter,
 		schemaStorage: schemaStorage,
-		sink:          sink,
+		sink:          sinker,
 		ddlPuller:     ddlPuller,
 		filter:        filter,
 
@@ -254,8 +415,105 @@ func NewProcessor(pdEndpoints []string, changefeed model.ChangeFeedInfo, changef
 		executedTxns: make(chan model.RawTxn, 1),
 		ddlJobsCh:    make(chan model.RawTxn, 16),
 
+		memQuota:        util.NewMemoryQuota(config.MemoryQuota.ChangefeedBytes),
+		sinkQuota:       util.NewMemoryQuota(0),
+		tableQuotaBytes: config.MemoryQuota.TableBytes,
+
 		tables: make(map[int64]*tableInfo),
+
+		// the errors of an asynchronous sink can't be attributed to the
+		// pending transactions.
+		isolateTableErrors: config.IsolateTableErrors && config.SinkBufferSize <= 0,
+		pausedTables:       make(map[string]*model.PausedTable),
+
+		eligibility:      newEligibilityTracker(),
+		ineligiblePolicy: config.IneligibleTablePolicy(),
+
+		checkpointStepper: newCheckpointStepper(config.CheckpointStepTxns),
+	}
+	if committer, ok := sinker.(sink.TwoPhaseCommitter); ok {
+		if config.SinkBufferSize > 0 {
+			return nil, errors.New("sink-buffer-size is not supported by the sink with two-phase commit")
+		}
+		if config.SnapshotInterval() > 0 {
+			return nil, errors.New("snapshot-interval-seconds is not supported by the sink with two-phase commit")
+		}
+		// the checkpoints are prepared and committed by the backend sink
+		// directly, the wrappers flushing them never see them
+		if config.VerifyOrder != "" {
+			return nil, errors.New("verify-order is not supported by the sink with two-phase commit")
+		}
+		if config.CircuitBreaker.Enabled() {
+			return nil, errors.New("circuit-breaker is not supported by the sink with two-phase commit")
+		}
+		if err := committer.Recover(context.Background(), p.status.CheckPointTs); err != nil {
+			return nil, errors.Annotate(err, "recover the prepared transactions of the sink")
+		}
+		p.committer = committer
+		p.checkpointCh = make(chan *checkpointRequest)
+	}
+	if config.Sorter.SpillEnabled() && config.Sorter.Dir == "" {
+		if p.sorterDir, err = prepareSorterDir(changefeedID); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if config.ProfileSampleRate > 0 {
+		p.profiler = sink.NewTableProfiler(config.ProfileSampleRate)
+	}
+	// the rows are routed right before they are written to the downstream,
+	// the other sinks see the upstream tables
+	if len(config.Routes) > 0 {
+		if p.sink, err = sink.NewRouteSink(p.sink, config.Routes); err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
+	// the order of the events is verified before they are routed and written
+	// to the downstream
+	if config.VerifyOrder != "" {
+		p.orderVerifier = sink.NewOrderVerifySink(p.sink, changefeedID, schemaStorage, config.VerifyOrder)
+		p.sink = p.orderVerifier
+	}
+	// the breaker wraps the backend sink, so only the writes to the
+	// downstream are counted
+	if config.CircuitBreaker.Enabled() {
+		p.sink = sink.NewCircuitBreakerSink(p.sink, changefeedID, config.CircuitBreaker)
+	}
+	// the changes are compacted by the unmasked keys before they are masked
+	if len(config.Masking) > 0 {
+		if p.sink, err = sink.NewMaskSink(p.sink, schemaStorage, config.Masking); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	// the values are converted into utf8 before they are masked
+	if len(config.ConvertCharsets) > 0 {
+		if p.sink, err = sink.NewCharsetSink(p.sink, schemaStorage, config.ConvertCharsets); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if config.CompactDMLs {
+		p.sink = sink.NewCompactSink(p.sink, changefeedID, schemaStorage)
+	}
+	if config.RateLimit.Enabled() {
+		p.sink = sink.NewRateLimitSink(p.sink, changefeedID, config.RateLimit.RowsPerSecond, config.RateLimit.BytesPerSecond)
+	}
+	// the snapshots are compacted by themselves and are written within the
+	// rate limit
+	if interval := config.SnapshotInterval(); interval > 0 {
+		p.sink = sink.NewSnapshotSink(p.sink, changefeedID, schemaStorage, interval)
+	}
+	if config.SinkBufferSize > 0 {
+		p.sink = sink.NewAsyncSink(p.sink, config.SinkBufferSize, p.onSinkFlushed)
+	}
+	if m, ok := mounter.(*entry.Mounter); ok && config.EnableOldValue {
+		if p.kvStore, err = createTiStore(strings.Join(pdEndpoints, ",")); err != nil {
+			return nil, errors.Annotate(err, "create the store of the old value")
+		}
+		m.EnableOldValue(entry.NewSnapshotRowReader(p.kvStore))
+	}
+
+	// the tables resumed when the processor is stopped are replicated again
+	// from the start ts of the tables.
+	p.loadPausedTables()
 
 	for _, table := range p.status.TableInfos {
 		p.addTable(context.Background(), int64(table.ID), table.StartTs)
@@ -286,12 +544,41 @@ func (p *processor) Run(ctx context.Context, errCh chan<- error) {
 	})
 
 	go func() {
-		if err := wg.Wait(); err != nil {
+		err := wg.Wait()
+		if cerr := p.sink.Close(); cerr != nil {
+			log.Warn("failed to close sink", zap.String("changefeed", p.changefeedID), labelsField(p.changefeed.Labels), zap.Error(cerr))
+		}
+		if err != nil {
+			if sink.IsFatalError(err) {
+				p.reportError(err)
+			}
 			errCh <- err
 		}
 	}()
 }
 
+// reportError records the fatal error in the task status, the owner stops the
+// changefeed with the error once it finds the error.
+func (p *processor) reportError(err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	runningErr := &model.RunningError{CaptureID: p.captureID, Message: err.Error()}
+	for i := 0; i < 3; i++ {
+		p.tsRWriter.GetTaskStatus().Error = runningErr
+		werr := p.tsRWriter.WriteInfoIntoStorage(ctx)
+		if errors.Cause(werr) != model.ErrWriteTsConflict {
+			if werr != nil {
+				log.Warn("failed to report processor error", zap.String("changefeed", p.changefeedID), labelsField(p.changefeed.Labels), zap.Error(werr))
+			}
+			return
+		}
+		if _, _, werr = p.tsRWriter.UpdateInfo(ctx); werr != nil {
+			log.Warn("failed to report processor error", zap.String("changefeed", p.changefeedID), labelsField(p.changefeed.Labels), zap.Error(werr))
+			return
+		}
+	}
+}
+
 // wait blocks until all routines in processor are returned
 func (p *processor) wait() {
 	err := p.wg.Wait()
@@ -350,7 +637,9 @@ func (p *processor) localResolvedWorker(ctx context.Context) error {
 
 			minResolvedTs := atomic.LoadUint64(&p.ddlResolveTS)
 
+			var tableBytes int64
 			for _, table := range p.tables {
+				tableBytes += table.quota.Used()
 				ts := table.loadResolvedTS()
 				tableResolvedTsGauge.WithLabelValues(p.changefeedID, p.captureID, strconv.FormatInt(table.id, 10)).Set(float64(oracle.ExtractPhysical(ts)))
 
@@ -359,6 +648,7 @@ func (p *processor) localResolvedWorker(ctx context.Context) error {
 				}
 			}
 			p.tablesMu.Unlock()
+			p.reportMemoryQuota(tableBytes)
 			p.status.ResolvedTs = minResolvedTs
 			resolvedTsGauge.WithLabelValues(p.changefeedID, p.captureID).Set(float64(oracle.ExtractPhysical(minResolvedTs)))
 		case e, ok := <-p.executedTxns:
@@ -367,10 +657,18 @@ func (p *processor) localResolvedWorker(ctx context.Context) error {
 				return nil
 			}
 			if e.IsResolved {
-				p.status.CheckPointTs = e.Ts
-				checkpointTsGauge.WithLabelValues(p.changefeedID, p.captureID).Set(float64(oracle.ExtractPhysical(e.Ts)))
+				p.forwardCheckpoint(e.Ts)
+			}
+		case req := <-p.checkpointCh:
+			err := p.persistCheckpoint(ctx, req.ts)
+			req.done <- err
+			if err != nil {
+				return errors.Annotate(err, "failed to persist checkpoint")
 			}
 		case <-updateInfoTick.C:
+			p.forwardCheckpoint(atomic.LoadUint64(&p.sinkFlushedTs))
+			p.reportTraffic(time.Now())
+			p.reportRegions(ctx, time.Now())
 			t0Update := time.Now()
 			err := retry.Run(func() error {
 				inErr := p.updateInfo(ctx)
@@ -387,7 +685,162 @@ func (p *processor) localResolvedWorker(ctx context.Context) error {
 	}
 }
 
+// reportMemoryQuota sets the bytes accounted by the quota of the stages, the
+// bytes not held by the tables or the sink are held by the sorters.
+func (p *processor) reportMemoryQuota(tableBytes int64) {
+	sinkBytes := p.sinkQuota.Used()
+	sorterBytes := p.memQuota.Used() - tableBytes - sinkBytes
+	if sorterBytes < 0 {
+		sorterBytes = 0
+	}
+	memoryQuotaUsedGauge.WithLabelValues(p.changefeedID, p.captureID, "sorter").Set(float64(sorterBytes))
+	memoryQuotaUsedGauge.WithLabelValues(p.changefeedID, p.captureID, "table").Set(float64(tableBytes))
+	memoryQuotaUsedGauge.WithLabelValues(p.changefeedID, p.captureID, "sink").Set(float64(sinkBytes))
+}
+
+// forwardCheckpoint advances the checkpoint ts, an earlier ts is ignored since
+// the flushed ts may be reported by both the sink and the flushed callback.
+func (p *processor) forwardCheckpoint(ts uint64) {
+	if hold := p.checkpointHoldTs(); hold != 0 && ts > hold {
+		ts = hold
+	}
+	if ts <= p.status.CheckPointTs {
+		return
+	}
+	p.status.CheckPointTs = ts
+	checkpointTsGauge.WithLabelValues(p.changefeedID, p.captureID).Set(float64(oracle.ExtractPhysical(ts)))
+}
+
+// reportTraffic sets the rows per second of the tables since the last report
+// in the task status, the tables added after the last report are reported in
+// the next one.
+func (p *processor) reportTraffic(now time.Time) {
+	if now.Sub(p.lastTrafficReport) < trafficReportInterval {
+		return
+	}
+	elapsed := now.Sub(p.lastTrafficReport).Seconds()
+	rows := make(map[int64]int64)
+	traffic := make(map[uint64]float64)
+	p.tablesMu.Lock()
+	for id, table := range p.tables {
+		rows[id] = table.inputChan.Rows()
+		if last, ok := p.lastTableRows[id]; ok {
+			traffic[uint64(id)] = math.Round(float64(rows[id]-last)/elapsed*100) / 100
+		}
+	}
+	p.tablesMu.Unlock()
+	if !p.lastTrafficReport.IsZero() {
+		p.status.TableTraffic = traffic
+	}
+	p.lastTrafficReport = now
+	p.lastTableRows = rows
+}
+
+// reportRegions sets the number of the regions of the tables in the task
+// status, the last report is kept if the regions fail to be counted.
+func (p *processor) reportRegions(ctx context.Context, now time.Time) {
+	if now.Sub(p.lastRegionReport) < regionReportInterval {
+		return
+	}
+	p.lastRegionReport = now
+	p.tablesMu.Lock()
+	ids := make([]int64, 0, len(p.tables))
+	for id := range p.tables {
+		ids = append(ids, id)
+	}
+	p.tablesMu.Unlock()
+
+	regions := make(map[uint64]int, len(ids))
+	for _, id := range ids {
+		count, err := countRegions(ctx, p.pdCli, util.GetTableSpan(id, true))
+		if err != nil {
+			log.Warn("failed to count the regions of the table",
+				zap.String("changefeed", p.changefeedID), zap.Int64("table id", id), zap.Error(err))
+			return
+		}
+		regions[uint64(id)] = count
+	}
+	p.status.TableRegions = regions
+}
+
+// countRegions returns the number of the regions in the span.
+func countRegions(ctx context.Context, pdCli pd.Client, span util.Span) (int, error) {
+	count := 0
+	start := span.Start
+	for {
+		regions, _, err := pdCli.ScanRegions(ctx, start, span.End, regionScanLimit)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if len(regions) == 0 {
+			return count, nil
+		}
+		count += len(regions)
+		start = regions[len(regions)-1].EndKey
+		if len(start) == 0 || util.EndCompare(start, span.End) >= 0 {
+			return count, nil
+		}
+	}
+}
+
+// checkpointRequest asks the resolved worker to persist the checkpoint ts.
+type checkpointRequest struct {
+	ts   uint64
+	done chan error
+}
+
+// persistCheckpoint writes the task status with the checkpoint ts into the
+// storage, the status changed by the owner is loaded and written again.
+func (p *processor) persistCheckpoint(ctx context.Context, ts uint64) error {
+	for i := 0; ; i++ {
+		p.forwardCheckpoint(ts)
+		p.status.PausedTables = p.pausedTableList()
+		err := p.tsRWriter.WriteInfoIntoStorage(ctx)
+		if errors.Cause(err) != model.ErrWriteTsConflict || i >= 3 {
+			return errors.Trace(err)
+		}
+		if err := p.updateInfo(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// flushCheckpoint makes the transactions before ts applied by the downstream,
+// and returns the ts the checkpoint can go forward to. The transactions of a
+// two-phase commit sink are committed after the checkpoint is persisted.
+func (p *processor) flushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	if p.committer == nil {
+		checkpointTs, err := p.sink.FlushCheckpoint(ctx, ts)
+		return checkpointTs, errors.Trace(err)
+	}
+	if err := p.committer.Prepare(ctx, ts); err != nil {
+		return 0, errors.Trace(err)
+	}
+	req := &checkpointRequest{ts: ts, done: make(chan error, 1)}
+	select {
+	case p.checkpointCh <- req:
+	case <-ctx.Done():
+		return 0, errors.Trace(ctx.Err())
+	}
+	select {
+	case err := <-req.done:
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+	case <-ctx.Done():
+		return 0, errors.Trace(ctx.Err())
+	}
+	return ts, errors.Trace(p.committer.Commit(ctx, ts))
+}
+
+// onSinkFlushed is called by the asynchronous sink after the transactions
+// before ts are flushed.
+func (p *processor) onSinkFlushed(ts uint64) {
+	atomic.StoreUint64(&p.sinkFlushedTs, ts)
+}
+
 func (p *processor) updateInfo(ctx context.Context) error {
+	p.status.PausedTables = p.pausedTableList()
 	err := p.tsRWriter.WriteInfoIntoStorage(ctx)
 
 	switch errors.Cause(err) {
@@ -399,7 +852,7 @@ func (p *processor) updateInfo(ctx context.Context) error {
 
 		p.status = p.tsRWriter.GetTaskStatus()
 
-		if p.status.AdminJobType == model.AdminStop || p.status.AdminJobType == model.AdminRemove {
+		if p.status.AdminJobType.IsStopState() {
 			err = p.stop(ctx)
 			if err != nil {
 				return errors.Trace(err)
@@ -408,6 +861,9 @@ func (p *processor) updateInfo(ctx context.Context) error {
 		}
 
 		p.handleTables(ctx, oldInfo, p.status, oldInfo.CheckPointTs)
+		p.loadPausedTables()
+		p.resumeTables(ctx)
+		p.status.PausedTables = p.pausedTableList()
 		syncTableNumGauge.WithLabelValues(p.changefeedID, p.captureID).Set(float64(len(p.status.TableInfos)))
 
 		if len(oldInfo.TableInfos) > len(p.status.TableInfos) {
@@ -466,7 +922,7 @@ func diffProcessTableInfos(oldInfo, newInfo []*model.ProcessTableInfo) (removed,
 	return
 }
 
-func (p *processor) removeTable(tableID int64) {
+func (p *processor) removeTable(ctx context.Context, tableID int64) {
 	p.tablesMu.Lock()
 	defer p.tablesMu.Unlock()
 
@@ -478,7 +934,14 @@ func (p *processor) removeTable(tableID int64) {
 		return
 	}
 
+	// the puller closes the input of the table once it's canceled, and the
+	// changes of the table not forwarded are dropped with the table until
+	// then, or until the processor exits
 	table.puller.Cancel()
+	go table.inputChan.Drain(ctx, func(size int64) {
+		table.quota.Release(size)
+		p.memQuota.Release(size)
+	})
 	delete(p.tables, tableID)
 	tableResolvedTsGauge.DeleteLabelValues(p.changefeedID, p.captureID, strconv.FormatInt(tableID, 10))
 }
@@ -489,7 +952,8 @@ func (p *processor) handleTables(ctx context.Context, oldInfo, newInfo *model.Ta
 
 	// remove tables
 	for _, pinfo := range removedTables {
-		p.removeTable(int64(pinfo.ID))
+		p.removeTable(ctx, int64(pinfo.ID))
+		p.unpauseTable(int64(pinfo.ID))
 	}
 
 	// write clock if need
@@ -546,34 +1010,57 @@ func (p *processor) globalResolvedWorker(ctx context.Context) error {
 			continue
 		}
 
-		lastGlobalResolvedTs = globalResolvedTs
-
-		wg, cctx := errgroup.WithContext(ctx)
-
-		p.tablesMu.Lock()
-		for _, table := range p.tables {
-			input := table.inputChan
-			wg.Go(func() error {
-				input.Forward(cctx, globalResolvedTs, p.resolvedTxns)
-				return nil
-			})
+		// the checkpoint goes forward with each step, the steps without
+		// transactions are skipped except the last one
+		for from := lastGlobalResolvedTs; ; {
+			ts := p.checkpointStepper.next(from, globalResolvedTs)
+			txns, err := p.forwardTables(ctx, ts)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			p.checkpointStepper.observe(txns, from, ts)
+			if txns > 0 || ts == globalResolvedTs {
+				select {
+				case <-ctx.Done():
+					return errors.Trace(ctx.Err())
+				case p.resolvedTxns <- model.RawTxn{
+					Ts:         ts,
+					IsResolved: true,
+				}:
+				}
+			}
+			if ts == globalResolvedTs {
+				break
+			}
+			from = ts
 		}
-		p.tablesMu.Unlock()
+		lastGlobalResolvedTs = globalResolvedTs
+	}
+}
 
-		err = wg.Wait()
-		if err != nil {
-			return errors.Trace(err)
-		}
+// forwardTables pushes the txns of the tables with commit ts not greater than
+// ts into p.resolvedTxns, and returns the number of the pushed txns.
+func (p *processor) forwardTables(ctx context.Context, ts uint64) (int, error) {
+	wg, cctx := errgroup.WithContext(ctx)
+	var count int64
 
-		select {
-		case <-ctx.Done():
-			return errors.Trace(ctx.Err())
-		case p.resolvedTxns <- model.RawTxn{
-			Ts:         globalResolvedTs,
-			IsResolved: true,
-		}:
-		}
+	p.tablesMu.Lock()
+	for _, table := range p.tables {
+		table := table
+		wg.Go(func() error {
+			atomic.AddInt64(&count, int64(table.inputChan.Forward(cctx, ts, p.resolvedTxns)))
+			// the resumed table has caught up once all its txns not after ts
+			// are forwarded with the others
+			if atomic.LoadUint64(&table.holdTs) != 0 && table.inputChan.Passed(ts) {
+				atomic.StoreUint64(&table.holdTs, 0)
+			}
+			return nil
+		})
 	}
+	p.tablesMu.Unlock()
+
+	err := wg.Wait()
+	return int(count), errors.Trace(err)
 }
 
 // pullDDLJob push ddl job into `p.ddlJobsCh`.
@@ -606,15 +1093,39 @@ func (p *processor) pullDDLJob(ctx context.Context) error {
 func (p *processor) syncResolved(ctx context.Context) error {
 	const bulkLimit = 128
 	pendingTxns := make([]model.Txn, 0, bulkLimit)
+	// pendingBytes is the size of the raw txns of pendingTxns, they are
+	// released from the quotas once the txns are written
+	var pendingBytes int64
 	flush := func(ctx2 context.Context) error {
-		if len(pendingTxns) == 0 {
-			return nil
+		if p.profiler != nil {
+			p.profiler.Observe(pendingTxns)
 		}
-		if err := p.sink.EmitDMLs(ctx2, pendingTxns...); err != nil {
-			return errors.Trace(err)
+		defer func() {
+			if len(pendingTxns) == 0 {
+				p.releaseSinkQuota(pendingBytes)
+				pendingBytes = 0
+			}
+		}()
+		for len(pendingTxns) > 0 {
+			err := p.sink.EmitDMLs(ctx2, pendingTxns...)
+			if err == nil {
+				txnCounter.WithLabelValues("executed", p.changefeedID, p.captureID).Add(float64(len(pendingTxns)))
+				pendingTxns = pendingTxns[:0]
+				return nil
+			}
+			if !p.pauseTableOfError(err, pendingTxns) {
+				return errors.Trace(err)
+			}
+			// emit the transactions of the other tables again
+			txns := pendingTxns[:0]
+			for _, txn := range pendingTxns {
+				p.dropPausedDMLs(&txn)
+				if len(txn.DMLs) > 0 {
+					txns = append(txns, txn)
+				}
+			}
+			pendingTxns = txns
 		}
-		txnCounter.WithLabelValues("executed", p.changefeedID, p.captureID).Add(float64(len(pendingTxns)))
-		pendingTxns = pendingTxns[:0]
 		return nil
 	}
 
@@ -653,6 +1164,14 @@ func (p *processor) syncResolved(ctx context.Context) error {
 				if err := flush(ctx); err != nil {
 					return errors.Trace(err)
 				}
+				// the checkpoint only goes forward to the ts applied by the downstream
+				checkpointTs, err := p.flushCheckpoint(ctx, rawTxn.Ts)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				rawTxn.Ts = checkpointTs
+				// the rows before the checkpoint are never mounted again
+				p.schemaStorage.DoGC(checkpointTs)
 				select {
 				case p.executedTxns <- rawTxn:
 					continue
@@ -670,13 +1189,18 @@ func (p *processor) syncResolved(ctx context.Context) error {
 			}
 			if p.filter.ShouldIgnoreTxn(&txn) {
 				log.Info("DML txn ignored", zap.Uint64("ts", txn.Ts))
+				p.releaseSinkQuota(rawTxn.Size())
 				continue
 			}
 			p.filter.FilterTxn(&txn)
+			p.checkEligibility(&txn)
+			p.dropPausedDMLs(&txn)
 			if len(txn.DMLs) == 0 {
+				p.releaseSinkQuota(rawTxn.Size())
 				continue
 			}
 			pendingTxns = append(pendingTxns, txn)
+			pendingBytes += rawTxn.Size()
 			if len(pendingTxns) >= bulkLimit {
 				if err := flush(ctx); err != nil {
 					return errors.Trace(err)
@@ -701,7 +1225,224 @@ func (p *processor) syncResolved(ctx context.Context) error {
 	}
 }
 
-func createSchemaStore(pdEndpoints []string) (*schema.Storage, error) {
+// pauseTableOfError pauses the table which the sink error is attributable to,
+// the transactions of the table not written are replicated again from the
+// first one after the table is resumed. It returns false if the error should
+// fail the processor.
+func (p *processor) pauseTableOfError(err error, txns []model.Txn) bool {
+	if !p.isolateTableErrors {
+		return false
+	}
+	schemaName, tableName, ok := sink.TableErrorOf(err)
+	if !ok {
+		return false
+	}
+	id, ok := p.schemaStorage.GetTableIDByName(schemaName, tableName)
+	if !ok {
+		return false
+	}
+	name := util.QuoteSchema(schemaName, tableName)
+	var ts uint64
+	for _, txn := range txns {
+		for _, dml := range txn.DMLs {
+			if dml.TableName() == name {
+				ts = txn.Ts
+				break
+			}
+		}
+		if ts != 0 {
+			break
+		}
+	}
+	if ts == 0 {
+		return false
+	}
+
+	p.pausedMu.Lock()
+	defer p.pausedMu.Unlock()
+	if _, ok := p.pausedTables[name]; ok {
+		// the error is not fixed by dropping the changes of the table
+		return false
+	}
+	p.pausedTables[name] = &model.PausedTable{
+		ID:     id,
+		Schema: schemaName,
+		Table:  tableName,
+		Ts:     ts,
+		Error:  err.Error(),
+	}
+	log.Warn("pause table by sink error", zap.String("changefeed", p.changefeedID), labelsField(p.changefeed.Labels),
+		zap.String("table", name), zap.Int64("tableID", id), zap.Uint64("ts", ts), zap.Error(err))
+	return true
+}
+
+// dropPausedDMLs removes the DMLs of the paused tables from the transaction.
+func (p *processor) dropPausedDMLs(txn *model.Txn) {
+	p.pausedMu.Lock()
+	defer p.pausedMu.Unlock()
+	if len(p.pausedTables) == 0 {
+		return
+	}
+	dmls := make([]*model.DML, 0, len(txn.DMLs))
+	for _, dml := range txn.DMLs {
+		if _, ok := p.pausedTables[dml.TableName()]; !ok {
+			dmls = append(dmls, dml)
+		}
+	}
+	txn.DMLs = dmls
+}
+
+// pausedTableList returns the paused tables sorted by table ID.
+func (p *processor) pausedTableList() []*model.PausedTable {
+	p.pausedMu.Lock()
+	defer p.pausedMu.Unlock()
+	if len(p.pausedTables) == 0 {
+		return nil
+	}
+	tables := make([]*model.PausedTable, 0, len(p.pausedTables))
+	for _, table := range p.pausedTables {
+		tables = append(tables, table)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].ID < tables[j].ID
+	})
+	return tables
+}
+
+// loadPausedTables adds the paused tables in the task status, which are paused
+// by the processor before it restarts or by the processors replicating the
+// tables before they're moved here. The tables not replicated by the processor
+// are ignored.
+func (p *processor) loadPausedTables() {
+	replicated := make(map[int64]struct{}, len(p.status.TableInfos))
+	for _, table := range p.status.TableInfos {
+		replicated[int64(table.ID)] = struct{}{}
+	}
+	p.pausedMu.Lock()
+	defer p.pausedMu.Unlock()
+	for _, table := range p.status.PausedTables {
+		name := util.QuoteSchema(table.Schema, table.Table)
+		if _, ok := p.pausedTables[name]; ok || table.Resume {
+			continue
+		}
+		for _, id := range p.physicalIDs(table.ID) {
+			if _, ok := replicated[id]; ok {
+				paused := *table
+				p.pausedTables[name] = &paused
+				break
+			}
+		}
+	}
+}
+
+// physicalIDs returns the IDs of the tables replicated for a table, they are
+// the partitions of a partitioned table.
+func (p *processor) physicalIDs(tableID int64) []int64 {
+	if info, ok := p.schemaStorage.TableByID(tableID); ok {
+		return info.PhysicalIDs()
+	}
+	return []int64{tableID}
+}
+
+// checkpointHoldTs returns the ts the checkpoint is held at, the paused tables
+// are replicated again from the first transactions not written after resumed,
+// and the resumed tables hold the checkpoint until they catch up. It returns 0
+// if the checkpoint isn't held.
+func (p *processor) checkpointHoldTs() uint64 {
+	var hold uint64
+	p.pausedMu.Lock()
+	for _, table := range p.pausedTables {
+		if hold == 0 || table.Ts-1 < hold {
+			hold = table.Ts - 1
+		}
+	}
+	p.pausedMu.Unlock()
+	p.tablesMu.Lock()
+	for _, table := range p.tables {
+		if ts := atomic.LoadUint64(&table.holdTs); ts != 0 && (hold == 0 || ts < hold) {
+			hold = ts
+		}
+	}
+	p.tablesMu.Unlock()
+	return hold
+}
+
+// unpauseTable forgets the paused table which is not replicated by the
+// processor any more.
+func (p *processor) unpauseTable(tableID int64) {
+	p.pausedMu.Lock()
+	defer p.pausedMu.Unlock()
+	for name, table := range p.pausedTables {
+		if table.ID == tableID {
+			delete(p.pausedTables, name)
+		}
+	}
+}
+
+// resumeTables resumes the paused tables marked by users in the task status,
+// the pullers of the tables are restarted from the first transactions not
+// written.
+func (p *processor) resumeTables(ctx context.Context) {
+	for _, table := range p.status.PausedTables {
+		if !table.Resume {
+			continue
+		}
+		name := util.QuoteSchema(table.Schema, table.Table)
+		p.pausedMu.Lock()
+		paused, ok := p.pausedTables[name]
+		p.pausedMu.Unlock()
+		if !ok {
+			continue
+		}
+		log.Info("resume paused table", zap.String("changefeed", p.changefeedID), labelsField(p.changefeed.Labels),
+			zap.String("table", name), zap.Int64("tableID", paused.ID), zap.Uint64("ts", paused.Ts))
+
+		// the partitions of a partitioned table are replicated as the tables
+		var restarted []int64
+		for _, id := range p.physicalIDs(paused.ID) {
+			p.tablesMu.Lock()
+			_, running := p.tables[id]
+			p.tablesMu.Unlock()
+			if running {
+				p.removeTable(ctx, id)
+				restarted = append(restarted, id)
+			}
+		}
+		if p.orderVerifier != nil {
+			p.orderVerifier.ResetTable(paused.Schema, paused.Table, paused.Ts-1)
+		}
+		// the pause is replaced by the holds of the restarted tables at once,
+		// so the checkpoint is always held and their changes aren't dropped
+		p.pausedMu.Lock()
+		for _, id := range restarted {
+			p.addTable(ctx, id, paused.Ts-1)
+			p.tablesMu.Lock()
+			atomic.StoreUint64(&p.tables[id].holdTs, paused.Ts-1)
+			p.tablesMu.Unlock()
+		}
+		delete(p.pausedTables, name)
+		p.pausedMu.Unlock()
+	}
+}
+
+// loadSchemaSnapshot loads the schema snapshot saved by the owner, it returns
+// nil if the snapshot can't be used to build the schema at ts. The snapshot is
+// an optimization, so the errors are only logged.
+func loadSchemaSnapshot(ctx context.Context, cli kv.CDCEtcdClient, ts uint64) *schema.Snapshot {
+	snap, err := cli.GetSchemaSnapshot(ctx)
+	if err != nil {
+		log.Warn("load schema snapshot failed, replay all the history DDL jobs", zap.Error(err))
+		return nil
+	}
+	if snap == nil || snap.Ts > ts {
+		return nil
+	}
+	return snap
+}
+
+// createSchemaStore creates the schema storage from the history DDL jobs, the
+// jobs included in the snapshot are skipped if the snapshot is not nil.
+func createSchemaStore(pdEndpoints []string, snap *schema.Snapshot) (*schema.Storage, error) {
 	// here we create another pb client,we should reuse them
 	kvStore, err := createTiStore(strings.Join(pdEndpoints, ","))
 	if err != nil {
@@ -716,12 +1457,24 @@ func createSchemaStore(pdEndpoints []string) (*schema.Storage, error) {
 		if job.State != timodel.JobStateSynced && job.State != timodel.JobStateDone {
 			continue
 		}
+		// the schema versions of the jobs are ordered like the finished ts
+		if snap != nil && job.BinlogInfo.SchemaVersion <= snap.SchemaVersion {
+			continue
+		}
 		err := resetFinishedTs(kvStore.(tikv.Storage), job)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 		jobs = append(jobs, job)
 	}
+	if snap != nil {
+		schemaStorage, err := schema.NewStorageFromSnapshot(snap, jobs)
+		if err != nil {
+			return nil, errors.Annotatef(err, "restore schema snapshot at ts %d", snap.Ts)
+		}
+		log.Info("restore schema snapshot", zap.Uint64("ts", snap.Ts), zap.Int("jobs", len(jobs)))
+		return schemaStorage, nil
+	}
 	schemaStorage, err := schema.NewStorage(jobs)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -783,30 +1536,43 @@ func (p *processor) addTable(ctx context.Context, tableID int64, startTs uint64)
 	table := &tableInfo{
 		id:       tableID,
 		inputTxn: make(chan model.RawTxn, 1),
+		quota:    util.NewMemoryQuota(p.tableQuotaBytes),
 	}
 
 	tc := newTxnChannel(table.inputTxn, 64, func(resolvedTs uint64) {
 		table.storeResolvedTS(resolvedTs)
 	})
+	tc.onForward = func(size int64) {
+		table.quota.Release(size)
+		p.sinkQuota.ForceAcquire(size)
+	}
 	table.inputChan = tc
 
 	span := util.GetTableSpan(tableID, true)
 
 	ctx, cancel := context.WithCancel(ctx)
-	plr := p.startPuller(ctx, span, startTs, table.inputTxn, p.errCh)
+	plr := p.startPuller(ctx, span, startTs, table.inputTxn, table.quota, p.errCh)
 	table.puller = puller.CancellablePuller{Puller: plr, Cancel: cancel}
 
 	p.tables[tableID] = table
 }
 
 // startPuller start pull data with span and push resolved txn into txnChan in timestamp increasing order.
-func (p *processor) startPuller(ctx context.Context, span util.Span, checkpointTs uint64, txnChan chan<- model.RawTxn, errCh chan<- error) puller.Puller {
+// The pushed txns are accounted by the table quota and the processor quota, the
+// puller stops pulling while it waits for the quotas.
+func (p *processor) startPuller(ctx context.Context, span util.Span, checkpointTs uint64, txnChan chan<- model.RawTxn, quota *util.MemoryQuota, errCh chan<- error) puller.Puller {
 	// Set it up so that one failed goroutine cancels all others sharing the same ctx
 	errg, ctx := errgroup.WithContext(ctx)
 
 	// The key in DML kv pair returned from TiKV is not memcompariable encoded,
 	// so we set `needEncode` to true.
 	puller := puller.NewPuller(p.pdCli, checkpointTs, []util.Span{span}, true)
+	sorterConfig := p.changefeed.GetConfig().Sorter
+	if sorterConfig.Dir == "" {
+		sorterConfig.Dir = p.sorterDir
+	}
+	puller.SetSorterConfig(sorterConfig)
+	puller.SetMemoryQuota(p.memQuota)
 
 	errg.Go(func() error {
 		return puller.Run(ctx)
@@ -814,9 +1580,24 @@ func (p *processor) startPuller(ctx context.Context, span util.Span, checkpointT
 
 	errg.Go(func() error {
 		defer close(txnChan)
+		dedup := newDedupWindow(defaultDedupWindowSize)
 		err := puller.CollectRawTxns(ctx, func(ctxInner context.Context, rawTxn model.RawTxn) error {
+			rawTxn, dups, ok := dedup.filter(rawTxn)
+			if dups > 0 {
+				duplicateEventCounter.WithLabelValues(p.changefeedID, p.captureID).Add(float64(dups))
+				log.Debug("suppressed duplicated row events", zap.Uint64("ts", rawTxn.Ts), zap.Int("count", dups))
+			}
+			if !ok {
+				return nil
+			}
+			size := rawTxn.Size()
+			if err := p.acquireQuota(ctxInner, size, quota); err != nil {
+				return errors.Trace(err)
+			}
 			select {
 			case <-ctxInner.Done():
+				quota.Release(size)
+				p.memQuota.Release(size)
 				return ctxInner.Err()
 			case txnChan <- rawTxn:
 				txnCounter.WithLabelValues("received", p.changefeedID, p.captureID).Inc()
@@ -836,12 +1617,43 @@ func (p *processor) startPuller(ctx context.Context, span util.Span, checkpointT
 	return puller
 }
 
+// acquireQuota acquires size bytes from the processor quota and the table
+// quota, it waits while any of them is exceeded unless the table holds no
+// resolved changes. So the table of the least resolved ts, whose changes are
+// always written in time, is never blocked by the others.
+func (p *processor) acquireQuota(ctx context.Context, size int64, quota *util.MemoryQuota) error {
+	start := time.Now()
+	if err := p.memQuota.Acquire(ctx, size, quota); err != nil {
+		return errors.Trace(err)
+	}
+	if err := quota.Acquire(ctx, size, nil); err != nil {
+		p.memQuota.Release(size)
+		return errors.Trace(err)
+	}
+	if wait := time.Since(start); wait >= time.Millisecond {
+		memoryQuotaWaitDuration.WithLabelValues(p.changefeedID, p.captureID).Add(wait.Seconds())
+	}
+	return nil
+}
+
+// releaseSinkQuota releases the bytes of the txns written by the sink or
+// dropped before the sink.
+func (p *processor) releaseSinkQuota(size int64) {
+	p.sinkQuota.Release(size)
+	p.memQuota.Release(size)
+}
+
 func (p *processor) stop(ctx context.Context) error {
 	p.tablesMu.Lock()
 	for _, tbl := range p.tables {
 		tbl.puller.Cancel()
 	}
 	p.tablesMu.Unlock()
+	if p.kvStore != nil {
+		if err := p.kvStore.Close(); err != nil {
+			log.Warn("close the store of the old value failed", zap.Error(err))
+		}
+	}
 	return errors.Trace(p.etcdCli.DeleteTaskStatus(ctx, p.changefeedID, p.captureID))
 }
 
@@ -14,12 +14,20 @@
 package cdc
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	timodel "github.com/pingcap/parser/model"
 	pd "github.com/pingcap/pd/client"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
@@ -27,6 +35,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/schema"
 	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/pingcap/ticdc/pkg/etcd"
+	"github.com/pingcap/ticdc/pkg/util"
 )
 
 type processorSuite struct{}
@@ -124,7 +133,7 @@ func (p *processorSuite) TestProcessor(c *check.C) {
 
 func runCase(c *check.C, cases *processorTestCase) {
 	origFSchema := fCreateSchema
-	fCreateSchema = func(pdEndpoints []string) (*schema.Storage, error) {
+	fCreateSchema = func(pdEndpoints []string, snap *schema.Snapshot) (*schema.Storage, error) {
 		return nil, nil
 	}
 	origFNewPD := fNewPDCli
@@ -139,9 +148,9 @@ func runCase(c *check.C, cases *processorTestCase) {
 	fNewMounter = func(schema *schema.Storage) mounter {
 		return mockMounter{}
 	}
-	origFNewSink := fNewMySQLSink
+	origFNewSink := fNewSink
 	sinker := &mockSinker{}
-	fNewMySQLSink = func(sinkURI string, infoGetter sink.TableInfoGetter, opts map[string]string) (sink.Sink, error) {
+	fNewSink = func(sinkURI string, infoGetter sink.TableInfoGetter, opts map[string]string) (sink.Sink, error) {
 		return sinker, nil
 	}
 	defer func() {
@@ -149,7 +158,7 @@ func runCase(c *check.C, cases *processorTestCase) {
 		fNewPDCli = origFNewPD
 		fNewTsRWriter = origFNewTsRw
 		fNewMounter = origFNewMounter
-		fNewMySQLSink = origFNewSink
+		fNewSink = origFNewSink
 	}()
 
 	dir := c.MkDir()
@@ -235,6 +244,146 @@ func (p *processorSuite) TestDiffProcessTableInfos(c *check.C) {
 	}
 }
 
+func (p *processorSuite) TestPauseTableOfError(c *check.C) {
+	schemaStorage, err := schema.NewStorage(nil)
+	c.Assert(err, check.IsNil)
+	db := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	c.Assert(schemaStorage.CreateSchema(db), check.IsNil)
+	c.Assert(schemaStorage.CreateTable(db, &timodel.TableInfo{ID: 47, Name: timodel.NewCIStr("t1")}), check.IsNil)
+	proc := &processor{
+		schemaStorage:      schemaStorage,
+		isolateTableErrors: true,
+		pausedTables:       make(map[string]*model.PausedTable),
+	}
+	txns := []model.Txn{
+		{Ts: 10, DMLs: []*model.DML{{Database: "test", Table: "t2"}}},
+		{Ts: 11, DMLs: []*model.DML{{Database: "test", Table: "t2"}, {Database: "test", Table: "t1"}}},
+		{Ts: 12, DMLs: []*model.DML{{Database: "test", Table: "t1"}}},
+	}
+
+	// the errors not caused by a single table fail the processor
+	c.Assert(proc.pauseTableOfError(errors.New("bad connection"), txns), check.IsFalse)
+	c.Assert(proc.pauseTableOfError(sink.NewTableError("test", "t3", errors.New("no table")), txns), check.IsFalse)
+
+	tableErr := errors.Trace(sink.NewTableError("test", "t1", errors.New("no table")))
+	c.Assert(proc.pauseTableOfError(tableErr, txns), check.IsTrue)
+	paused := proc.pausedTableList()
+	c.Assert(paused, check.HasLen, 1)
+	c.Assert(paused[0].ID, check.Equals, int64(47))
+	c.Assert(paused[0].Ts, check.Equals, uint64(11))
+	c.Assert(paused[0].Error, check.Matches, ".*no table.*")
+	// the table is paused already
+	c.Assert(proc.pauseTableOfError(tableErr, txns), check.IsFalse)
+
+	for i := range txns {
+		proc.dropPausedDMLs(&txns[i])
+	}
+	c.Assert(txns[0].DMLs, check.HasLen, 1)
+	c.Assert(txns[1].DMLs, check.HasLen, 1)
+	c.Assert(txns[1].DMLs[0].Table, check.Equals, "t2")
+	c.Assert(txns[2].DMLs, check.HasLen, 0)
+
+	proc.unpauseTable(47)
+	c.Assert(proc.pausedTableList(), check.IsNil)
+
+	// the table errors fail the processor if the isolation is disabled
+	proc.isolateTableErrors = false
+	c.Assert(proc.pauseTableOfError(tableErr, txns), check.IsFalse)
+}
+
+func (p *processorSuite) TestHoldCheckpointByPausedTables(c *check.C) {
+	schemaStorage, err := schema.NewStorage(nil)
+	c.Assert(err, check.IsNil)
+	db := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	c.Assert(schemaStorage.CreateSchema(db), check.IsNil)
+	c.Assert(schemaStorage.CreateTable(db, &timodel.TableInfo{ID: 47, Name: timodel.NewCIStr("t1")}), check.IsNil)
+	proc := &processor{
+		schemaStorage: schemaStorage,
+		pausedTables:  make(map[string]*model.PausedTable),
+		tables:        make(map[int64]*tableInfo),
+		status: &model.TaskStatus{
+			CheckPointTs: 5,
+			TableInfos:   []*model.ProcessTableInfo{{ID: 47}},
+			// the table paused before it's moved here, and the one not
+			// replicated here
+			PausedTables: []*model.PausedTable{
+				{ID: 47, Schema: "test", Table: "t1", Ts: 10},
+				{ID: 49, Schema: "test", Table: "t3", Ts: 8},
+			},
+		},
+	}
+	proc.loadPausedTables()
+	paused := proc.pausedTableList()
+	c.Assert(paused, check.HasLen, 1)
+	c.Assert(paused[0].ID, check.Equals, int64(47))
+
+	// the checkpoint is held before the first transaction not written
+	proc.forwardCheckpoint(20)
+	c.Assert(proc.status.CheckPointTs, check.Equals, uint64(9))
+
+	// the resumed table holds the checkpoint until it catches up
+	proc.unpauseTable(47)
+	proc.tables[47] = &tableInfo{id: 47, inputChan: &txnChannel{}, holdTs: 9}
+	proc.forwardCheckpoint(20)
+	c.Assert(proc.status.CheckPointTs, check.Equals, uint64(9))
+	proc.tables[47].holdTs = 0
+	proc.forwardCheckpoint(20)
+	c.Assert(proc.status.CheckPointTs, check.Equals, uint64(20))
+}
+
+// mockCommitter records the calls of the two-phase commit and the checkpoint
+// persisted when the transactions are committed.
+type mockCommitter struct {
+	tsRWriter *mockTsRWriter
+	calls     []string
+}
+
+func (m *mockCommitter) Prepare(ctx context.Context, ts uint64) error {
+	m.calls = append(m.calls, fmt.Sprintf("prepare %d", ts))
+	return nil
+}
+
+func (m *mockCommitter) Commit(ctx context.Context, ts uint64) error {
+	m.calls = append(m.calls, fmt.Sprintf("commit %d at checkpoint %d", ts, m.tsRWriter.storageInfo.CheckPointTs))
+	return nil
+}
+
+func (m *mockCommitter) Recover(ctx context.Context, checkpointTs uint64) error {
+	return nil
+}
+
+func (p *processorSuite) TestTwoPhaseCommit(c *check.C) {
+	tsRWriter := &mockTsRWriter{memInfo: &model.TaskStatus{}, storageInfo: &model.TaskStatus{}}
+	committer := &mockCommitter{tsRWriter: tsRWriter}
+	proc := &processor{
+		tsRWriter:    tsRWriter,
+		status:       tsRWriter.GetTaskStatus(),
+		committer:    committer,
+		checkpointCh: make(chan *checkpointRequest),
+		tables:       make(map[int64]*tableInfo),
+		pausedTables: make(map[string]*model.PausedTable),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = proc.localResolvedWorker(ctx)
+	}()
+
+	ts, err := proc.flushCheckpoint(ctx, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(10))
+	ts, err = proc.flushCheckpoint(ctx, 20)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(20))
+	// the transactions are committed after the checkpoint is persisted
+	c.Assert(committer.calls, check.DeepEquals, []string{
+		"prepare 10", "commit 10 at checkpoint 10", "prepare 20", "commit 20 at checkpoint 20",
+	})
+	cancel()
+	<-done
+}
+
 type txnChannelSuite struct{}
 
 var _ = check.Suite(&txnChannelSuite{})
@@ -300,3 +449,169 @@ func (s *txnChannelSuite) TestShouldBeCancellable(c *check.C) {
 		c.Fatal("Not stopped in time after cancelled")
 	}
 }
+
+func (s *txnChannelSuite) TestForwardAndDrainQuota(c *check.C) {
+	input := make(chan model.RawTxn, 5)
+	tc := newTxnChannel(input, 5, func(ts uint64) {})
+	var forwarded, dropped int64
+	tc.onForward = func(size int64) {
+		forwarded += size
+	}
+	txn := func(ts uint64, key string) model.RawTxn {
+		return model.RawTxn{Ts: ts, Entries: []*model.RawKVEntry{{Key: []byte(key), Ts: ts}}}
+	}
+	for _, t := range []model.RawTxn{txn(1, "a"), {Ts: 2}, txn(3, "bb"), txn(4, "ccc")} {
+		input <- t
+	}
+	close(input)
+
+	output := make(chan model.RawTxn, 5)
+	c.Assert(tc.Forward(context.Background(), 2, output), check.Equals, 1)
+	c.Assert(forwarded, check.Equals, txn(1, "a").Size())
+	c.Assert(tc.Passed(2), check.IsTrue)
+	c.Assert(tc.Passed(3), check.IsFalse)
+	// the txns not forwarded are dropped, including the one put back
+	tc.Drain(context.Background(), func(size int64) {
+		dropped += size
+	})
+	c.Assert(tc.Forward(context.Background(), 3, output), check.Equals, 0)
+	c.Assert(forwarded, check.Equals, txn(1, "a").Size())
+	c.Assert(dropped, check.Equals, txn(3, "bb").Size()+txn(4, "ccc").Size())
+}
+
+func (s *txnChannelSuite) TestDrainUnclosedInput(c *check.C) {
+	input := make(chan model.RawTxn, 5)
+	tc := newTxnChannel(input, 5, func(ts uint64) {})
+	input <- model.RawTxn{Ts: 1, Entries: []*model.RawKVEntry{{Key: []byte("a"), Ts: 1}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dropped := make(chan int64, 5)
+	done := make(chan struct{})
+	go func() {
+		tc.Drain(ctx, func(size int64) {
+			dropped <- size
+		})
+		close(done)
+	}()
+	<-dropped
+	// the forwarding isn't blocked while the input is drained
+	c.Assert(tc.Forward(context.Background(), 10, make(chan model.RawTxn)), check.Equals, 0)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		c.Fatal("the drain isn't stopped by the context")
+	}
+}
+
+func (s *processorSuite) TestReportTraffic(c *check.C) {
+	tables := map[int64]*tableInfo{
+		1: {id: 1, inputChan: &txnChannel{rows: 100}},
+		2: {id: 2, inputChan: &txnChannel{rows: 0}},
+	}
+	p := &processor{status: &model.TaskStatus{}, tables: tables}
+	now := time.Now()
+	// the first report only records the rows
+	p.reportTraffic(now)
+	c.Assert(p.status.TableTraffic, check.IsNil)
+
+	tables[1].inputChan.rows = 400
+	tables[3] = &tableInfo{id: 3, inputChan: &txnChannel{rows: 50}}
+	p.reportTraffic(now.Add(time.Second))
+	c.Assert(p.status.TableTraffic, check.IsNil)
+	p.reportTraffic(now.Add(trafficReportInterval))
+	c.Assert(p.status.TableTraffic, check.DeepEquals, map[uint64]float64{1: 10, 2: 0})
+}
+
+// mockRegionsPDClient scans the regions split by the keys, at most maxScan
+// regions are returned by a scan.
+type mockRegionsPDClient struct {
+	pd.Client
+	keys    [][]byte
+	maxScan int
+	err     error
+}
+
+func (m *mockRegionsPDClient) ScanRegions(ctx context.Context, key, endKey []byte, limit int) ([]*metapb.Region, []*metapb.Peer, error) {
+	if m.err != nil {
+		return nil, nil, m.err
+	}
+	if limit > m.maxScan {
+		limit = m.maxScan
+	}
+	var regions []*metapb.Region
+	for i := 0; i+1 < len(m.keys) && len(regions) < limit; i++ {
+		start, end := m.keys[i], m.keys[i+1]
+		if (len(end) > 0 && bytes.Compare(end, key) <= 0) || bytes.Compare(start, endKey) >= 0 {
+			continue
+		}
+		regions = append(regions, &metapb.Region{StartKey: start, EndKey: end})
+	}
+	return regions, nil, nil
+}
+
+func (s *processorSuite) TestReportRegions(c *check.C) {
+	span1, span2 := util.GetTableSpan(1, true), util.GetTableSpan(2, true)
+	pdCli := &mockRegionsPDClient{
+		keys: [][]byte{
+			{}, span1.Start,
+			append(append([]byte{}, span1.Start...), 'a'),
+			append(append([]byte{}, span1.Start...), 'b'),
+			span1.End, span2.Start, span2.End, {},
+		},
+		maxScan: 2,
+	}
+	count, err := countRegions(context.Background(), pdCli, span1)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 3)
+
+	p := &processor{
+		status: &model.TaskStatus{},
+		pdCli:  pdCli,
+		tables: map[int64]*tableInfo{1: {id: 1}, 2: {id: 2}, 3: {id: 3}},
+	}
+	now := time.Now()
+	p.reportRegions(context.Background(), now)
+	c.Assert(p.status.TableRegions, check.DeepEquals, map[uint64]int{1: 3, 2: 1, 3: 1})
+
+	// the last report is kept if the regions fail to be counted
+	pdCli.err = errors.New("pd is unavailable")
+	delete(p.tables, 3)
+	p.reportRegions(context.Background(), now.Add(time.Second))
+	p.reportRegions(context.Background(), now.Add(regionReportInterval))
+	c.Assert(p.status.TableRegions, check.DeepEquals, map[uint64]int{1: 3, 2: 1, 3: 1})
+	pdCli.err = nil
+	p.reportRegions(context.Background(), now.Add(2*regionReportInterval))
+	c.Assert(p.status.TableRegions, check.DeepEquals, map[uint64]int{1: 3, 2: 1})
+}
+
+func (s *processorSuite) TestPrepareSorterDir(c *check.C) {
+	defer func(dir string) { dataDir = dir }(dataDir)
+	dataDir = c.MkDir()
+
+	dir, err := prepareSorterDir("cf1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dir, check.Equals, filepath.Join(dataDir, "sorter", "cf1"))
+	// the files left by a crashed process
+	stale := filepath.Join(dir, "ticdc-sorter-1")
+	c.Assert(ioutil.WriteFile(stale, []byte("stale"), 0644), check.IsNil)
+	other := filepath.Join(dataDir, "sorter", "cf2")
+	c.Assert(os.MkdirAll(other, 0755), check.IsNil)
+
+	dir, err = prepareSorterDir("cf1")
+	c.Assert(err, check.IsNil)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+	// the dirs of the other changefeeds are kept
+	_, err = os.Stat(other)
+	c.Assert(err, check.IsNil)
+
+	// the dirs out of the sorter dir are never removed
+	for _, id := range []string{"", ".", "..", "../cf1", "cf1/../../data", "cf1/sub"} {
+		_, err = prepareSorterDir(id)
+		c.Assert(err, check.ErrorMatches, "invalid sorter dir.*")
+	}
+	_, err = os.Stat(dataDir)
+	c.Assert(err, check.IsNil)
+}
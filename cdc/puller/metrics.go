@@ -31,10 +31,18 @@ var (
 			Help:      "The number of txns resolved in one go.",
 			Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
 		})
+	spilledEntryCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "puller",
+			Name:      "sorter_spilled_entry_count",
+			Help:      "The number of entries spilled to the local disk by the sorters.",
+		})
 )
 
 // InitMetrics registers all metrics in this file
 func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(eventCounter)
 	registry.MustRegister(resolvedTxnsBatchSize)
+	registry.MustRegister(spilledEntryCounter)
 }
@@ -15,7 +15,6 @@ package puller
 
 import (
 	"context"
-	"sort"
 
 	"go.uber.org/zap"
 
@@ -49,6 +48,8 @@ type pullerImpl struct {
 	spans        []util.Span
 	buf          Buffer
 	tsTracker    resolveTsTracker
+	sorter       model.SorterConfig
+	quota        *util.MemoryQuota
 	// needEncode represents whether we need to encode a key when checking it is in span
 	needEncode bool
 }
@@ -80,6 +81,17 @@ func NewPuller(
 	return p
 }
 
+// SetSorterConfig sets the config of the sorter of the entries, the entries
+// are only sorted in memory by default.
+func (p *pullerImpl) SetSorterConfig(cfg model.SorterConfig) {
+	p.sorter = cfg
+}
+
+// SetMemoryQuota sets the quota accounting the entries not resolved yet.
+func (p *pullerImpl) SetMemoryQuota(quota *util.MemoryQuota) {
+	p.quota = quota
+}
+
 func (p *pullerImpl) Output() Buffer {
 	return p.buf
 }
@@ -147,25 +159,30 @@ func (p *pullerImpl) GetResolvedTs() uint64 {
 }
 
 func (p *pullerImpl) CollectRawTxns(ctx context.Context, outputFn func(context.Context, model.RawTxn) error) error {
-	return collectRawTxns(ctx, p.buf.Get, outputFn, p.tsTracker)
+	sorter := newEntrySorter(p.sorter.Dir, p.sorter.MaxMemoryBytes, p.quota)
+	sorter.maxTxnEntries = p.sorter.MaxTxnEntries
+	defer sorter.close()
+	return collectRawTxns(ctx, p.buf.Get, outputFn, p.tsTracker, sorter)
 }
 
 // collectRawTxns collects KV events from the inputFn,
-// groups them by transactions and sends them to the outputFn.
+// groups them by transactions with the sorter and sends them to the outputFn.
 func collectRawTxns(
 	ctx context.Context,
 	inputFn func(context.Context) (model.RegionFeedEvent, error),
 	outputFn func(context.Context, model.RawTxn) error,
 	tracker resolveTsTracker,
+	sorter *entrySorter,
 ) error {
-	entryGroups := make(map[uint64][]*model.RawKVEntry)
 	for {
 		be, err := inputFn(ctx)
 		if err != nil {
 			return errors.Trace(err)
 		}
 		if be.Val != nil {
-			entryGroups[be.Val.Ts] = append(entryGroups[be.Val.Ts], be.Val)
+			if err := sorter.add(be.Val); err != nil {
+				return errors.Trace(err)
+			}
 		} else if be.Resolved != nil {
 			resolvedTs := be.Resolved.ResolvedTs
 			// 1. Forward is called in a single thread
@@ -176,24 +193,14 @@ func collectRawTxns(
 			if !forwarded {
 				continue
 			}
-			var readyTxns []model.RawTxn
-			for ts, entries := range entryGroups {
-				if ts <= resolvedTs {
-					readyTxns = append(readyTxns, model.RawTxn{Ts: ts, Entries: entries})
-					delete(entryGroups, ts)
-				}
-			}
-			sort.Slice(readyTxns, func(i, j int) bool {
-				return readyTxns[i].Ts < readyTxns[j].Ts
+			readyTxns, err := sorter.resolve(resolvedTs, func(t model.RawTxn) error {
+				return outputFn(ctx, t)
 			})
-			for _, t := range readyTxns {
-				err := outputFn(ctx, t)
-				if err != nil {
-					return errors.Trace(err)
-				}
+			if err != nil {
+				return errors.Trace(err)
 			}
-			resolvedTxnsBatchSize.Observe(float64(len(readyTxns)))
-			if len(readyTxns) == 0 {
+			resolvedTxnsBatchSize.Observe(float64(readyTxns))
+			if readyTxns == 0 {
 				log.Debug("Forwarding fake txn", zap.Uint64("ts", resolvedTs))
 				fakeTxn := model.RawTxn{
 					Ts:      resolvedTs,
@@ -0,0 +1,377 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// the spilled runs are merged into one if there are too many of them, so the
+// files opened by a sorter are bounded
+const maxSortedRuns = 16
+
+// entrySorter groups the KV entries by their commit ts, and outputs them in
+// the order of the commit ts when they are resolved. The entries are kept in
+// memory up to maxMemory bytes, then they are sorted and spilled to a run file
+// in dir, and the runs are merged with the entries in memory when they are
+// resolved. The entries are only kept in memory if maxMemory isn't positive.
+// The entries in memory are accounted by the quota, the resolved ones are
+// released from it before they are output, so the receiver accounts them
+// again without counting them twice. The transactions of more entries than
+// maxTxnEntries are output in parts if it's positive.
+type entrySorter struct {
+	dir           string
+	maxMemory     int64
+	maxTxnEntries int
+	quota         *util.MemoryQuota
+
+	entries []*model.RawKVEntry
+	memory  int64
+	runs    []*sortedRun
+}
+
+func newEntrySorter(dir string, maxMemory int, quota *util.MemoryQuota) *entrySorter {
+	return &entrySorter{
+		dir:       dir,
+		maxMemory: int64(maxMemory),
+		quota:     quota,
+	}
+}
+
+// sortEntries sorts the entries by their commit ts, the entries of the same
+// commit ts are kept in the order they are received.
+func sortEntries(entries []*model.RawKVEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Ts < entries[j].Ts
+	})
+}
+
+func (s *entrySorter) add(entry *model.RawKVEntry) error {
+	s.entries = append(s.entries, entry)
+	s.memory += entry.Size()
+	s.quota.ForceAcquire(entry.Size())
+	if s.maxMemory <= 0 || s.memory < s.maxMemory {
+		return nil
+	}
+	return errors.Trace(s.spill())
+}
+
+// spill writes the entries in memory to a new run.
+func (s *entrySorter) spill() error {
+	sortEntries(s.entries)
+	run, err := newSortedRun(s.dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, entry := range s.entries {
+		if err := run.write(entry); err != nil {
+			run.close()
+			return errors.Trace(err)
+		}
+	}
+	if err := run.finish(); err != nil {
+		run.close()
+		return errors.Trace(err)
+	}
+	log.Debug("spill the sorted entries", zap.String("file", run.file.Name()), zap.Int("count", len(s.entries)))
+	spilledEntryCounter.Add(float64(len(s.entries)))
+	s.runs = append(s.runs, run)
+	s.entries = nil
+	s.quota.Release(s.memory)
+	s.memory = 0
+	if len(s.runs) >= maxSortedRuns {
+		return errors.Trace(s.compact())
+	}
+	return nil
+}
+
+// compact merges all the runs into one.
+func (s *entrySorter) compact() error {
+	run, err := newSortedRun(s.dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sources := make([]entrySource, 0, len(s.runs))
+	for _, r := range s.runs {
+		sources = append(sources, r)
+	}
+	err = mergeEntries(sources, math.MaxUint64, run.write)
+	if err == nil {
+		err = run.finish()
+	}
+	if err != nil {
+		run.close()
+		return errors.Trace(err)
+	}
+	for _, r := range s.runs {
+		r.close()
+	}
+	s.runs = []*sortedRun{run}
+	return nil
+}
+
+// resolve outputs the entries committed at or before resolvedTs grouped by
+// their commit ts in order, and returns the number of the output txns.
+func (s *entrySorter) resolve(resolvedTs uint64, outputFn func(model.RawTxn) error) (int, error) {
+	sortEntries(s.entries)
+	// hand the resolved entries in memory over to the receiver
+	resolvedCount := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].Ts > resolvedTs
+	})
+	var resolved int64
+	for _, entry := range s.entries[:resolvedCount] {
+		resolved += entry.Size()
+	}
+	s.memory -= resolved
+	s.quota.Release(resolved)
+
+	mem := &memorySource{entries: s.entries}
+	sources := make([]entrySource, 0, len(s.runs)+1)
+	for _, r := range s.runs {
+		sources = append(sources, r)
+	}
+	// the entries in memory are received after the spilled ones
+	sources = append(sources, mem)
+
+	var txn model.RawTxn
+	count := 0
+	err := mergeEntries(sources, resolvedTs, func(entry *model.RawKVEntry) error {
+		full := s.maxTxnEntries > 0 && len(txn.Entries) >= s.maxTxnEntries
+		if len(txn.Entries) > 0 && (entry.Ts != txn.Ts || full) {
+			if err := outputFn(txn); err != nil {
+				return errors.Trace(err)
+			}
+			count++
+			txn = model.RawTxn{}
+		}
+		txn.Ts = entry.Ts
+		txn.Entries = append(txn.Entries, entry)
+		return nil
+	})
+	if err == nil && len(txn.Entries) > 0 {
+		err = outputFn(txn)
+		count++
+	}
+
+	// the entries not output because of an error are still held
+	var unresolved int64
+	for _, entry := range s.entries[mem.pos:resolvedCount] {
+		unresolved += entry.Size()
+	}
+	s.memory += unresolved
+	s.quota.ForceAcquire(unresolved)
+	s.entries = append([]*model.RawKVEntry(nil), s.entries[mem.pos:]...)
+	runs := s.runs[:0]
+	for _, r := range s.runs {
+		if r.head() == nil {
+			r.close()
+			continue
+		}
+		runs = append(runs, r)
+	}
+	s.runs = runs
+	return count, errors.Trace(err)
+}
+
+// close removes the files of the runs.
+func (s *entrySorter) close() {
+	for _, r := range s.runs {
+		r.close()
+	}
+	s.runs = nil
+	s.entries = nil
+	s.quota.Release(s.memory)
+	s.memory = 0
+}
+
+// entrySource is a source of the entries sorted by their commit ts.
+type entrySource interface {
+	// head returns the next entry of the source, it's nil if the source is
+	// drained.
+	head() *model.RawKVEntry
+	next() error
+}
+
+// mergeEntries outputs the entries committed at or before resolvedTs of the
+// sources in the order of the commit ts, the entries of the same commit ts are
+// output in the order of the sources.
+func mergeEntries(sources []entrySource, resolvedTs uint64, outputFn func(*model.RawKVEntry) error) error {
+	for {
+		var min entrySource
+		for _, src := range sources {
+			entry := src.head()
+			if entry == nil || entry.Ts > resolvedTs {
+				continue
+			}
+			if min == nil || entry.Ts < min.head().Ts {
+				min = src
+			}
+		}
+		if min == nil {
+			return nil
+		}
+		if err := outputFn(min.head()); err != nil {
+			return errors.Trace(err)
+		}
+		if err := min.next(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+type memorySource struct {
+	entries []*model.RawKVEntry
+	pos     int
+}
+
+func (m *memorySource) head() *model.RawKVEntry {
+	if m.pos >= len(m.entries) {
+		return nil
+	}
+	return m.entries[m.pos]
+}
+
+func (m *memorySource) next() error {
+	m.pos++
+	return nil
+}
+
+// sortedRun is a file of the entries sorted by their commit ts. The entries
+// are written until the run is finished, then they are read in order.
+type sortedRun struct {
+	file   *os.File
+	writer *bufio.Writer
+	reader *bufio.Reader
+	buf    [binary.MaxVarintLen64]byte
+	entry  *model.RawKVEntry
+}
+
+func newSortedRun(dir string) (*sortedRun, error) {
+	file, err := ioutil.TempFile(dir, "ticdc-sorter-")
+	if err != nil {
+		return nil, errors.Annotate(err, "create the file of the sorter")
+	}
+	return &sortedRun{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+func (r *sortedRun) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(r.buf[:], v)
+	_, err := r.writer.Write(r.buf[:n])
+	return errors.Trace(err)
+}
+
+func (r *sortedRun) writeBytes(b []byte) error {
+	if err := r.writeUvarint(uint64(len(b))); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := r.writer.Write(b)
+	return errors.Trace(err)
+}
+
+func (r *sortedRun) write(entry *model.RawKVEntry) error {
+	if err := r.writeUvarint(entry.Ts); err != nil {
+		return errors.Trace(err)
+	}
+	if err := r.writeUvarint(uint64(entry.OpType)); err != nil {
+		return errors.Trace(err)
+	}
+	if err := r.writeBytes(entry.Key); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(r.writeBytes(entry.Value))
+}
+
+// finish flushes the written entries and reads the first one of them.
+func (r *sortedRun) finish() error {
+	if err := r.writer.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	r.writer = nil
+	if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	r.reader = bufio.NewReader(r.file)
+	return errors.Trace(r.next())
+}
+
+func (r *sortedRun) head() *model.RawKVEntry {
+	return r.entry
+}
+
+func (r *sortedRun) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.reader, b)
+	return b, errors.Trace(err)
+}
+
+func (r *sortedRun) next() error {
+	ts, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		r.entry = nil
+		return nil
+	}
+	if err != nil {
+		return errors.Annotatef(err, "read the file %s of the sorter", r.file.Name())
+	}
+	entry := &model.RawKVEntry{Ts: ts}
+	op, err := binary.ReadUvarint(r.reader)
+	if err == nil {
+		entry.OpType = model.OpType(op)
+		entry.Key, err = r.readBytes()
+	}
+	if err == nil {
+		entry.Value, err = r.readBytes()
+	}
+	if err != nil {
+		if errors.Cause(err) == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return errors.Annotatef(err, "read the file %s of the sorter", r.file.Name())
+	}
+	r.entry = entry
+	return nil
+}
+
+// close closes and removes the file of the run.
+func (r *sortedRun) close() {
+	r.entry = nil
+	if err := r.file.Close(); err != nil {
+		log.Warn("close the file of the sorter failed", zap.String("file", r.file.Name()), zap.Error(err))
+	}
+	if err := os.Remove(r.file.Name()); err != nil {
+		log.Warn("remove the file of the sorter failed", zap.String("file", r.file.Name()), zap.Error(err))
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+)
+
+type sorterSuite struct{}
+
+var _ = check.Suite(&sorterSuite{})
+
+func newSortedEntry(ts uint64, key string) *model.RawKVEntry {
+	return &model.RawKVEntry{OpType: model.OpTypePut, Key: []byte(key), Value: []byte("v-" + key), Ts: ts}
+}
+
+func resolveKeys(c *check.C, s *entrySorter, resolvedTs uint64) map[uint64][]string {
+	var lastTs uint64
+	txns := make(map[uint64][]string)
+	n, err := s.resolve(resolvedTs, func(txn model.RawTxn) error {
+		c.Assert(txn.Ts, check.Greater, lastTs)
+		lastTs = txn.Ts
+		for _, e := range txn.Entries {
+			c.Assert(e.Ts, check.Equals, txn.Ts)
+			c.Assert(string(e.Value), check.Equals, "v-"+string(e.Key))
+			txns[txn.Ts] = append(txns[txn.Ts], string(e.Key))
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, len(txns))
+	return txns
+}
+
+func countFiles(c *check.C, dir string) int {
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	return len(files)
+}
+
+func (s *sorterSuite) TestSortInMemory(c *check.C) {
+	dir := c.MkDir()
+	sorter := newEntrySorter(dir, 0, nil)
+	for _, e := range []*model.RawKVEntry{
+		newSortedEntry(3, "a"), newSortedEntry(1, "b"), newSortedEntry(3, "c"), newSortedEntry(2, "d"),
+	} {
+		c.Assert(sorter.add(e), check.IsNil)
+	}
+	c.Assert(countFiles(c, dir), check.Equals, 0)
+
+	c.Assert(resolveKeys(c, sorter, 2), check.DeepEquals, map[uint64][]string{1: {"b"}, 2: {"d"}})
+	c.Assert(resolveKeys(c, sorter, 2), check.HasLen, 0)
+	c.Assert(resolveKeys(c, sorter, 3), check.DeepEquals, map[uint64][]string{3: {"a", "c"}})
+	c.Assert(sorter.memory, check.Equals, int64(0))
+}
+
+func (s *sorterSuite) TestSplitLargeTxn(c *check.C) {
+	dir := c.MkDir()
+	// spill every 2 entries, and split the txns into parts of 2 entries
+	sorter := newEntrySorter(dir, int(2*newSortedEntry(0, "k-0-0").Size()), nil)
+	sorter.maxTxnEntries = 2
+	for i := 0; i < 5; i++ {
+		c.Assert(sorter.add(newSortedEntry(2, fmt.Sprintf("k-2-%d", i))), check.IsNil)
+	}
+	c.Assert(sorter.add(newSortedEntry(1, "k-1-0")), check.IsNil)
+
+	var parts [][]string
+	n, err := sorter.resolve(2, func(txn model.RawTxn) error {
+		var keys []string
+		for _, e := range txn.Entries {
+			c.Assert(e.Ts, check.Equals, txn.Ts)
+			keys = append(keys, string(e.Key))
+		}
+		parts = append(parts, keys)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 4)
+	c.Assert(parts, check.DeepEquals, [][]string{
+		{"k-1-0"},
+		{"k-2-0", "k-2-1"},
+		{"k-2-2", "k-2-3"},
+		{"k-2-4"},
+	})
+}
+
+func (s *sorterSuite) TestSpillAndMerge(c *check.C) {
+	dir := c.MkDir()
+	// spill every 2 entries
+	sorter := newEntrySorter(dir, int(2*newSortedEntry(0, "k-0-0").Size()), nil)
+	for i := 0; i < 3; i++ {
+		for ts := uint64(5); ts > 0; ts-- {
+			c.Assert(sorter.add(newSortedEntry(ts, fmt.Sprintf("k-%d-%d", ts, i))), check.IsNil)
+		}
+	}
+	c.Assert(sorter.runs, check.HasLen, 7)
+	c.Assert(sorter.entries, check.HasLen, 1)
+	c.Assert(countFiles(c, dir), check.Equals, 7)
+
+	// the entries of a txn are output in the order they are received
+	c.Assert(resolveKeys(c, sorter, 2), check.DeepEquals, map[uint64][]string{
+		1: {"k-1-0", "k-1-1", "k-1-2"},
+		2: {"k-2-0", "k-2-1", "k-2-2"},
+	})
+	c.Assert(sorter.add(newSortedEntry(4, "k-4-3")), check.IsNil)
+	c.Assert(resolveKeys(c, sorter, 4), check.DeepEquals, map[uint64][]string{
+		3: {"k-3-0", "k-3-1", "k-3-2"},
+		4: {"k-4-0", "k-4-1", "k-4-2", "k-4-3"},
+	})
+	c.Assert(resolveKeys(c, sorter, 10), check.DeepEquals, map[uint64][]string{
+		5: {"k-5-0", "k-5-1", "k-5-2"},
+	})
+	// the drained runs are removed
+	c.Assert(sorter.runs, check.HasLen, 0)
+	c.Assert(countFiles(c, dir), check.Equals, 0)
+}
+
+func (s *sorterSuite) TestMemoryQuota(c *check.C) {
+	dir := c.MkDir()
+	size := newSortedEntry(0, "k-0").Size()
+	quota := util.NewMemoryQuota(size)
+	sorter := newEntrySorter(dir, int(4*size), quota)
+	// the quota exceeded by the others doesn't spill the entries
+	quota.ForceAcquire(2 * size)
+	for i := 0; i < 3; i++ {
+		c.Assert(sorter.add(newSortedEntry(uint64(i+1), fmt.Sprintf("k-%d", i))), check.IsNil)
+	}
+	c.Assert(sorter.runs, check.HasLen, 0)
+	c.Assert(quota.Used(), check.Equals, 5*size)
+
+	// the entries are spilled once the sorter holds maxMemory bytes
+	c.Assert(sorter.add(newSortedEntry(4, "k-3")), check.IsNil)
+	c.Assert(sorter.runs, check.HasLen, 1)
+	c.Assert(quota.Used(), check.Equals, 2*size)
+	quota.Release(2 * size)
+
+	c.Assert(sorter.add(newSortedEntry(5, "k-4")), check.IsNil)
+	c.Assert(sorter.add(newSortedEntry(6, "k-5")), check.IsNil)
+	// the resolved entries are released before they are output
+	var held []int64
+	_, err := sorter.resolve(5, func(model.RawTxn) error {
+		held = append(held, quota.Used())
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(held, check.HasLen, 5)
+	for _, used := range held {
+		c.Assert(used, check.Equals, size)
+	}
+	c.Assert(quota.Used(), check.Equals, size)
+	c.Assert(sorter.memory, check.Equals, size)
+	sorter.close()
+	c.Assert(quota.Used(), check.Equals, int64(0))
+}
+
+func (s *sorterSuite) TestCompactRuns(c *check.C) {
+	dir := c.MkDir()
+	sorter := newEntrySorter(dir, 1, nil)
+	for i := 0; i < maxSortedRuns+2; i++ {
+		c.Assert(sorter.add(newSortedEntry(uint64(maxSortedRuns+2-i), fmt.Sprintf("k-%d", i))), check.IsNil)
+	}
+	c.Assert(sorter.runs, check.HasLen, 3)
+	c.Assert(countFiles(c, dir), check.Equals, 3)
+
+	txns := resolveKeys(c, sorter, uint64(maxSortedRuns+2))
+	c.Assert(txns, check.HasLen, maxSortedRuns+2)
+	c.Assert(txns[1], check.DeepEquals, []string{fmt.Sprintf("k-%d", maxSortedRuns+1)})
+
+	c.Assert(sorter.add(newSortedEntry(100, "k")), check.IsNil)
+	sorter.close()
+	c.Assert(countFiles(c, dir), check.Equals, 0)
+}
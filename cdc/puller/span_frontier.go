@@ -217,6 +217,13 @@ func (s *spanFrontier) insert(span util.Span, ts uint64) {
 		return
 	}
 
+	// Fast path: once the region layout is stable, every resolved span covers
+	// whole tracked entries, so we only need to bump their timestamps in place
+	// instead of rebuilding the covering and re-inserting into the tree.
+	if s.updateCovered(span, ts, overlap) {
+		return
+	}
+
 	spanCov := util.Covering{{Start: span.Start, End: span.End, Payload: ts}}
 
 	overlapCov := make(util.Covering, len(overlap))
@@ -286,6 +293,26 @@ func (s *spanFrontier) insert(span util.Span, ts uint64) {
 	s.tree.AdjustRanges()
 }
 
+// updateCovered forwards the entries in overlap to ts if all of them are
+// fully covered by span, it returns false without modifying anything otherwise.
+func (s *spanFrontier) updateCovered(span util.Span, ts uint64, overlap []interval.Interface) bool {
+	for _, o := range overlap {
+		e := o.(*spanFrontierEntry)
+		if bytes.Compare(span.Start, e.span.Start) > 0 || bytes.Compare(span.End, e.span.End) < 0 {
+			return false
+		}
+	}
+
+	for _, o := range overlap {
+		e := o.(*spanFrontierEntry)
+		if e.ts < ts {
+			e.ts = ts
+			heap.Fix(&s.minHeap, e.index)
+		}
+	}
+	return true
+}
+
 // Entries visit all traced spans.
 func (s *spanFrontier) Entries(fn func(span util.Span, ts uint64)) {
 	s.tree.Do(func(i interval.Interface) bool {
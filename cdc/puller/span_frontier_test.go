@@ -211,3 +211,52 @@ func (s *spanFrontierSuite) TestSpanFrontierDisjoinSpans(c *check.C) {
 	c.Assert(f.Frontier(), check.Equals, uint64(4))
 	c.Assert(f.testStr(), check.Equals, `{a b}@4 {c d}@4 {d e}@4`)
 }
+
+func (s *spanFrontierSuite) TestForwardCoveredEntries(c *check.C) {
+	keyA := []byte("a")
+	keyB := []byte("b")
+	keyC := []byte("c")
+	keyD := []byte("d")
+
+	spAB := util.Span{Start: keyA, End: keyB}
+	spBC := util.Span{Start: keyB, End: keyC}
+	spCD := util.Span{Start: keyC, End: keyD}
+	spAD := util.Span{Start: keyA, End: keyD}
+
+	f := makeSpanFrontier(spAB, spBC, spCD)
+
+	adv := f.Forward(spBC, 2)
+	c.Assert(adv, check.IsFalse)
+	c.Assert(f.testStr(), check.Equals, `{a b}@0 {b c}@2 {c d}@0`)
+
+	adv = f.Forward(spAB, 3)
+	c.Assert(adv, check.IsFalse)
+	adv = f.Forward(spCD, 1)
+	c.Assert(adv, check.IsTrue)
+	c.Assert(f.Frontier(), check.Equals, uint64(1))
+	c.Assert(f.testStr(), check.Equals, `{a b}@3 {b c}@2 {c d}@1`)
+
+	// A span covering several entries keeps the entries apart.
+	adv = f.Forward(spAD, 2)
+	c.Assert(adv, check.IsTrue)
+	c.Assert(f.Frontier(), check.Equals, uint64(2))
+	c.Assert(f.testStr(), check.Equals, `{a b}@3 {b c}@2 {c d}@2`)
+}
+
+func benchmarkSpanFrontier(b *testing.B, n int) {
+	spans := make([]util.Span, 0, n)
+	for i := 0; i < n; i++ {
+		start := []byte(fmt.Sprintf("t_%09d", i))
+		end := []byte(fmt.Sprintf("t_%09d", i+1))
+		spans = append(spans, util.Span{Start: start, End: end})
+	}
+	f := makeSpanFrontier(spans...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Forward(spans[i%n], uint64(i))
+	}
+}
+
+func BenchmarkSpanFrontier1K(b *testing.B)   { benchmarkSpanFrontier(b, 1000) }
+func BenchmarkSpanFrontier100K(b *testing.B) { benchmarkSpanFrontier(b, 100000) }
@@ -86,7 +86,7 @@ func (cs *CollectRawTxnsSuite) TestShouldOutputTxnsInOrder(c *check.C) {
 	}
 
 	ctx := context.Background()
-	err := collectRawTxns(ctx, input, output, &mockTracker{})
+	err := collectRawTxns(ctx, input, output, &mockTracker{}, newEntrySorter("", 0, nil))
 	c.Assert(err, check.ErrorMatches, "End")
 
 	c.Assert(rawTxns, check.HasLen, 2)
@@ -154,7 +154,7 @@ func (cs *CollectRawTxnsSuite) TestShouldConsiderSpanResolvedTs(c *check.C) {
 	ctx := context.Background()
 	// Set up the tracker so that only the last resolve event forwards the global minimum Ts
 	tracker := mockTracker{forwarded: []bool{false, false, true}}
-	err := collectRawTxns(ctx, input, output, &tracker)
+	err := collectRawTxns(ctx, input, output, &tracker, newEntrySorter("", 0, nil))
 	c.Assert(err, check.ErrorMatches, "End")
 
 	c.Assert(rawTxns, check.HasLen, 1)
@@ -190,7 +190,7 @@ func (cs *CollectRawTxnsSuite) TestShouldOutputBinlogEvenWhenThereIsNoRealEvent(
 
 	ctx := context.Background()
 	tracker := mockTracker{forwarded: []bool{true, true}}
-	err := collectRawTxns(ctx, input, output, &tracker)
+	err := collectRawTxns(ctx, input, output, &tracker, newEntrySorter("", 0, nil))
 	c.Assert(err, check.ErrorMatches, "End")
 
 	c.Assert(rawTxns, check.HasLen, len(entries))
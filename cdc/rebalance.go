@@ -0,0 +1,144 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// rebalanceConcurrency is the max number of the tables moved at the same time
+// by a rebalance, the tables of the other planned moves keep replicating in
+// their sources until the moves start.
+const rebalanceConcurrency = 4
+
+// plannedMove is a move of a table planned by a rebalance.
+type plannedMove struct {
+	tableID uint64
+	source  string
+	target  string
+}
+
+// ParseBalanceStrategy parses the strategy of a rebalance, the tables are
+// balanced by count if it's empty.
+func ParseBalanceStrategy(s string) (model.BalanceStrategy, error) {
+	switch model.BalanceStrategy(s) {
+	case "", model.BalanceByCount:
+		return model.BalanceByCount, nil
+	case model.BalanceByTraffic:
+		return model.BalanceByTraffic, nil
+	}
+	return "", errors.Errorf("invalid balance strategy: %s, it should be count or traffic", s)
+}
+
+// planRebalance plans the moves of the tables which balance the loads of the
+// live captures, the load of a capture is the number or the traffic of its
+// tables. Each move takes a table from the most loaded capture to the least
+// loaded one with room for it if it narrows the gap between them, and a table
+// is moved at most once.
+func (c *changeFeed) planRebalance(captures map[string]*model.CaptureInfo, by model.BalanceStrategy) []*plannedMove {
+	if len(captures) < 2 {
+		return nil
+	}
+	weight := func(status *model.TaskStatus, tableID uint64) float64 {
+		if by == model.BalanceByTraffic {
+			return status.TableTraffic[tableID]
+		}
+		return 1
+	}
+
+	ids := make([]string, 0, len(captures))
+	loads := make(map[string]float64, len(captures))
+	tables := make(map[string]map[uint64]float64, len(captures))
+	for id := range captures {
+		ids = append(ids, id)
+		tables[id] = make(map[uint64]float64)
+		status, ok := c.processorInfos[id]
+		if !ok {
+			continue
+		}
+		for _, table := range status.TableInfos {
+			if _, ok := c.movingTables[table.ID]; ok {
+				continue
+			}
+			w := weight(status, table.ID)
+			tables[id][table.ID] = w
+			loads[id] += w
+		}
+	}
+	sort.Strings(ids)
+
+	var plan []*plannedMove
+	planned := make(map[uint64]struct{})
+	for {
+		source, target := ids[0], ""
+		for _, id := range ids {
+			if loads[id] > loads[source] {
+				source = id
+			}
+			if c.hasRoom(id) && (target == "" || loads[id] < loads[target]) {
+				target = id
+			}
+		}
+		if target == "" {
+			return plan
+		}
+		gap := loads[source] - loads[target]
+		var tableID uint64
+		var maxWeight float64
+		for id, w := range tables[source] {
+			if _, ok := planned[id]; ok || w <= 0 || w >= gap {
+				continue
+			}
+			if w > maxWeight || (w == maxWeight && id < tableID) {
+				tableID, maxWeight = id, w
+			}
+		}
+		if maxWeight == 0 {
+			return plan
+		}
+		delete(tables[source], tableID)
+		tables[target][tableID] = maxWeight
+		loads[source] -= maxWeight
+		loads[target] += maxWeight
+		planned[tableID] = struct{}{}
+		c.takeRoom(target)
+		c.freeRoom(source)
+		plan = append(plan, &plannedMove{tableID: tableID, source: source, target: target})
+	}
+}
+
+// startPlannedMoves starts the planned moves while less than
+// rebalanceConcurrency tables are being moved, a planned move is given up if
+// its table is not in the source any more or its target has gone.
+func (c *changeFeed) startPlannedMoves(captures map[string]*model.CaptureInfo) {
+	for len(c.plannedMoves) > 0 && len(c.movingTables) < rebalanceConcurrency {
+		move := c.plannedMoves[0]
+		c.plannedMoves = c.plannedMoves[1:]
+		source, _, ok := findTaskStatusWithTable(c.processorInfos, move.tableID)
+		_, moving := c.movingTables[move.tableID]
+		_, alive := captures[move.target]
+		if !ok || source != move.source || moving || !alive {
+			log.Info("give up the planned move of the table",
+				zap.String("changefeed", c.id), zap.Uint64("table id", move.tableID),
+				zap.String("source", move.source), zap.String("target", move.target))
+			continue
+		}
+		c.startMovingTable(move.tableID, move.source, move.target)
+	}
+}
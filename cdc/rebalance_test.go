@@ -0,0 +1,112 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type rebalanceSuite struct{}
+
+var _ = check.Suite(&rebalanceSuite{})
+
+func rebalanceTables(ids ...uint64) []*model.ProcessTableInfo {
+	tables := make([]*model.ProcessTableInfo, 0, len(ids))
+	for _, id := range ids {
+		tables = append(tables, &model.ProcessTableInfo{ID: id})
+	}
+	return tables
+}
+
+func (s *rebalanceSuite) TestPlanByCount(c *check.C) {
+	cf := &changeFeed{
+		processorInfos: model.ProcessorsInfos{
+			"capture-1": {TableInfos: rebalanceTables(1, 2, 3, 4, 5)},
+			"capture-2": {TableInfos: rebalanceTables(6)},
+			// the tables of the dead capture are reclaimed as orphans
+			"capture-dead": {TableInfos: rebalanceTables(7, 8, 9)},
+		},
+		movingTables: map[uint64]*movingTable{5: {source: "capture-1", target: "capture-2"}},
+	}
+	captures := map[string]*model.CaptureInfo{"capture-1": {}, "capture-2": {}, "capture-3": {}}
+	plan := cf.planRebalance(captures, model.BalanceByCount)
+	c.Assert(plan, check.DeepEquals, []*plannedMove{
+		{tableID: 1, source: "capture-1", target: "capture-3"},
+		{tableID: 2, source: "capture-1", target: "capture-2"},
+	})
+
+	// no move narrows the gap
+	delete(captures, "capture-3")
+	delete(cf.movingTables, 5)
+	cf.processorInfos["capture-1"].TableInfos = rebalanceTables(1, 2)
+	c.Assert(cf.planRebalance(captures, model.BalanceByCount), check.HasLen, 0)
+	c.Assert(cf.planRebalance(map[string]*model.CaptureInfo{"capture-1": {}}, model.BalanceByCount), check.HasLen, 0)
+}
+
+func (s *rebalanceSuite) TestPlanByTraffic(c *check.C) {
+	cf := &changeFeed{
+		processorInfos: model.ProcessorsInfos{
+			"capture-1": {
+				TableInfos:   rebalanceTables(1, 2, 3),
+				TableTraffic: map[uint64]float64{1: 100, 2: 40, 3: 30},
+			},
+			"capture-2": {
+				TableInfos:   rebalanceTables(4, 5, 6, 7),
+				TableTraffic: map[uint64]float64{4: 10, 5: 10},
+			},
+		},
+	}
+	captures := map[string]*model.CaptureInfo{"capture-1": {}, "capture-2": {}}
+	// 170 vs 20 at first, the heaviest table narrowing the gap is moved each
+	// time, the tables without traffic aren't moved.
+	plan := cf.planRebalance(captures, model.BalanceByTraffic)
+	c.Assert(plan, check.DeepEquals, []*plannedMove{
+		{tableID: 1, source: "capture-1", target: "capture-2"},
+		{tableID: 4, source: "capture-2", target: "capture-1"},
+		{tableID: 5, source: "capture-2", target: "capture-1"},
+	})
+}
+
+func (s *rebalanceSuite) TestStartPlannedMoves(c *check.C) {
+	cf := &changeFeed{
+		processorInfos: model.ProcessorsInfos{
+			"capture-1": {TableInfos: rebalanceTables(1, 2, 3, 4, 5, 6)},
+			"capture-2": {TableInfos: rebalanceTables(7)},
+		},
+		plannedMoves: []*plannedMove{
+			// the table has been moved
+			{tableID: 7, source: "capture-1", target: "capture-2"},
+			// the target has gone
+			{tableID: 1, source: "capture-1", target: "capture-3"},
+			{tableID: 2, source: "capture-1", target: "capture-2"},
+			{tableID: 3, source: "capture-1", target: "capture-2"},
+			{tableID: 4, source: "capture-1", target: "capture-2"},
+			{tableID: 5, source: "capture-1", target: "capture-2"},
+			{tableID: 6, source: "capture-1", target: "capture-2"},
+		},
+	}
+	captures := map[string]*model.CaptureInfo{"capture-1": {}, "capture-2": {}}
+	cf.startPlannedMoves(captures)
+	c.Assert(cf.movingTables, check.HasLen, rebalanceConcurrency)
+	for _, id := range []uint64{2, 3, 4, 5} {
+		c.Assert(cf.movingTables[id], check.DeepEquals, &movingTable{source: "capture-1", target: "capture-2"})
+	}
+	c.Assert(cf.plannedMoves, check.HasLen, 1)
+
+	delete(cf.movingTables, 2)
+	cf.startPlannedMoves(captures)
+	c.Assert(cf.movingTables[6], check.NotNil)
+	c.Assert(cf.plannedMoves, check.HasLen, 0)
+}
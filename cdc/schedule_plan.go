@@ -0,0 +1,148 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+// SchedulePlan is the plan of moving the tables of the changefeeds, it's
+// returned by the dry runs of the schedules without moving any table.
+type SchedulePlan struct {
+	Changefeeds []*ChangefeedPlan `json:"changefeeds"`
+}
+
+// ChangefeedPlan is the planned moves of the tables of a changefeed.
+type ChangefeedPlan struct {
+	ID    model.ChangeFeedID  `json:"id"`
+	Moves []*PlannedTableMove `json:"moves"`
+	// Unplaced are the tables of the removed capture no other capture can
+	// take by the placement rules and the max tables.
+	Unplaced []uint64 `json:"unplaced,omitempty"`
+}
+
+// PlannedTableMove is a planned move of a table.
+type PlannedTableMove struct {
+	TableID uint64 `json:"table-id"`
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+}
+
+// PlanRebalance returns the moves a rebalance of the changefeed would plan,
+// the moves of all the changefeeds are planned if the ID is empty.
+func (o *ownerImpl) PlanRebalance(id model.ChangeFeedID, by model.BalanceStrategy) (*SchedulePlan, error) {
+	if !o.manager.IsOwner() {
+		return nil, errors.Trace(concurrency.ErrElectionNotLeader)
+	}
+	o.l.Lock()
+	defer o.l.Unlock()
+	ids, err := o.planChangefeeds(id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	captures, _ := o.schedulableCaptures()
+	plan := &SchedulePlan{Changefeeds: make([]*ChangefeedPlan, 0, len(ids))}
+	for _, id := range ids {
+		cf := o.changeFeeds[id]
+		room := cf.captureRoom
+		moves := cf.planRebalance(o.placeableCaptures(cf, captures), by)
+		cf.captureRoom = room
+		plan.Changefeeds = append(plan.Changefeeds, &ChangefeedPlan{ID: id, Moves: plannedTableMoves(moves)})
+	}
+	return plan, nil
+}
+
+// PlanCaptureRemoval returns the moves of the tables in the capture to the
+// other captures if the capture were removed.
+func (o *ownerImpl) PlanCaptureRemoval(captureID string) (*SchedulePlan, error) {
+	if !o.manager.IsOwner() {
+		return nil, errors.Trace(concurrency.ErrElectionNotLeader)
+	}
+	o.l.Lock()
+	defer o.l.Unlock()
+	if _, ok := o.captures[captureID]; !ok {
+		return nil, errors.Annotatef(model.ErrCaptureNotExist, "capture [%s]", captureID)
+	}
+	ids, err := o.planChangefeeds("")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	captures, draining := o.schedulableCaptures()
+	delete(captures, captureID)
+	draining[captureID] = struct{}{}
+	plan := &SchedulePlan{Changefeeds: make([]*ChangefeedPlan, 0, len(ids))}
+	for _, id := range ids {
+		cf := o.changeFeeds[id]
+		status, ok := cf.processorInfos[captureID]
+		if !ok || len(status.TableInfos) == 0 {
+			continue
+		}
+		room, planned := cf.captureRoom, cf.plannedMoves
+		cf.plannedMoves = append([]*plannedMove(nil), planned...)
+		placeable := o.placeableCaptures(cf, captures)
+		cf.drainTables(misplacedCaptures(draining, captures, placeable), placeable)
+		var moves []*plannedMove
+		moved := make(map[uint64]struct{})
+		for _, move := range cf.plannedMoves {
+			if move.source == captureID {
+				moves = append(moves, move)
+				moved[move.tableID] = struct{}{}
+			}
+		}
+		cf.captureRoom, cf.plannedMoves = room, planned
+
+		cfPlan := &ChangefeedPlan{ID: id, Moves: plannedTableMoves(moves)}
+		for _, table := range status.TableInfos {
+			if _, ok := moved[table.ID]; ok {
+				continue
+			}
+			if move, ok := cf.movingTables[table.ID]; ok {
+				cfPlan.Moves = append(cfPlan.Moves, &PlannedTableMove{TableID: table.ID, Source: move.source, Target: move.target})
+				continue
+			}
+			cfPlan.Unplaced = append(cfPlan.Unplaced, table.ID)
+		}
+		plan.Changefeeds = append(plan.Changefeeds, cfPlan)
+	}
+	return plan, nil
+}
+
+// planChangefeeds returns the sorted IDs of the changefeeds to plan, it's all
+// the running changefeeds if the ID is empty.
+func (o *ownerImpl) planChangefeeds(id model.ChangeFeedID) ([]model.ChangeFeedID, error) {
+	if id != "" {
+		if _, ok := o.changeFeeds[id]; !ok {
+			return nil, errors.Annotatef(model.ErrChangeFeedNotExists, "changefeed [%s] is not running", id)
+		}
+		return []model.ChangeFeedID{id}, nil
+	}
+	ids := make([]model.ChangeFeedID, 0, len(o.changeFeeds))
+	for id := range o.changeFeeds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func plannedTableMoves(moves []*plannedMove) []*PlannedTableMove {
+	result := make([]*PlannedTableMove, 0, len(moves))
+	for _, move := range moves {
+		result = append(result, &PlannedTableMove{TableID: move.tableID, Source: move.source, Target: move.target})
+	}
+	return result
+}
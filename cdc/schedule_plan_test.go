@@ -0,0 +1,105 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/roles"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+type schedulePlanSuite struct{}
+
+var _ = check.Suite(&schedulePlanSuite{})
+
+func (s *schedulePlanSuite) TestPlanSchedule(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := roles.NewMockManager(uuid.New().String(), cancel)
+	pinned := &model.PlacementRule{CaptureLabels: map[string]string{"pool": "heavy"}}
+	owner := &ownerImpl{
+		manager: manager,
+		captures: map[model.CaptureID]*model.CaptureInfo{
+			"capture-1": {ID: "capture-1", Labels: map[string]string{"pool": "heavy"}},
+			"capture-2": {ID: "capture-2"},
+			"capture-3": {ID: "capture-3", MaxTables: 1},
+		},
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{
+			"cf-1": {
+				id:   "cf-1",
+				info: &model.ChangeFeedInfo{},
+				processorInfos: model.ProcessorsInfos{
+					"capture-1": {TableInfos: rebalanceTables(1, 2, 3, 4)},
+					"capture-2": {TableInfos: rebalanceTables(5)},
+				},
+				captureRoom: map[string]int{"capture-3": 1},
+			},
+			"cf-2": {
+				id:             "cf-2",
+				info:           &model.ChangeFeedInfo{Placement: pinned},
+				processorInfos: model.ProcessorsInfos{"capture-1": {TableInfos: rebalanceTables(6)}},
+			},
+		},
+	}
+
+	_, err := owner.PlanRebalance("", model.BalanceByCount)
+	c.Assert(errors.Cause(err), check.Equals, concurrency.ErrElectionNotLeader)
+	c.Assert(manager.CampaignOwner(ctx), check.IsNil)
+
+	plan, err := owner.PlanRebalance("cf-1", model.BalanceByCount)
+	c.Assert(err, check.IsNil)
+	c.Assert(plan.Changefeeds, check.DeepEquals, []*ChangefeedPlan{{
+		ID: "cf-1",
+		Moves: []*PlannedTableMove{
+			{TableID: 1, Source: "capture-1", Target: "capture-3"},
+			{TableID: 2, Source: "capture-1", Target: "capture-2"},
+		},
+	}})
+	// the dry run leaves the state of the changefeed untouched
+	cf := owner.changeFeeds["cf-1"]
+	c.Assert(cf.plannedMoves, check.HasLen, 0)
+	c.Assert(cf.captureRoom, check.DeepEquals, map[string]int{"capture-3": 1})
+
+	plan, err = owner.PlanRebalance("", model.BalanceByCount)
+	c.Assert(err, check.IsNil)
+	c.Assert(plan.Changefeeds, check.HasLen, 2)
+	c.Assert(plan.Changefeeds[1].Moves, check.HasLen, 0)
+	_, err = owner.PlanRebalance("cf-3", model.BalanceByCount)
+	c.Assert(errors.Cause(err), check.Equals, model.ErrChangeFeedNotExists)
+
+	// the table of cf-2 can only be placed in capture-1 by its placement rule
+	cf.plannedMoves = []*plannedMove{{tableID: 5, source: "capture-2", target: "capture-1"}}
+	plan, err = owner.PlanCaptureRemoval("capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(plan.Changefeeds, check.DeepEquals, []*ChangefeedPlan{
+		{
+			ID: "cf-1",
+			Moves: []*PlannedTableMove{
+				{TableID: 1, Source: "capture-1", Target: "capture-3"},
+				{TableID: 2, Source: "capture-1", Target: "capture-2"},
+				{TableID: 3, Source: "capture-1", Target: "capture-2"},
+				{TableID: 4, Source: "capture-1", Target: "capture-2"},
+			},
+		},
+		{ID: "cf-2", Moves: []*PlannedTableMove{}, Unplaced: []uint64{6}},
+	})
+	c.Assert(cf.plannedMoves, check.HasLen, 1)
+	_, err = owner.PlanCaptureRemoval("capture-4")
+	c.Assert(errors.Cause(err), check.Equals, model.ErrCaptureNotExist)
+}
@@ -19,6 +19,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cenkalti/backoff"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/log"
@@ -34,11 +35,25 @@ import (
 
 const (
 	checkTaskKeyInterval = time.Second * 1
+
+	// cfWatcherRelistTimeout bounds the time of listing the changefeeds after
+	// the watched revision is compacted.
+	cfWatcherRelistTimeout = time.Second * 10
+	// cfWatcherMaxRelists is the max number of the relists without any
+	// progress of the watch, the error is returned to the caller after it.
+	cfWatcherMaxRelists = 3
 )
 
 var (
 	runProcessorWatcher = realRunProcessorWatcher
 	runProcessor        = realRunProcessor
+
+	// the processor watcher retries reading the task key with an exponential
+	// backoff and jitter, the error is escalated after the retries.
+	processorWatcherRetryBackoff    = time.Millisecond * 100
+	processorWatcherMaxRetryBackoff = time.Second * 5
+	processorWatcherRetryJitter     = 0.5
+	processorWatcherMaxRetries      = uint64(8)
 )
 
 // ChangeFeedWatcher is a changefeed watcher
@@ -48,6 +63,11 @@ type ChangeFeedWatcher struct {
 	pdEndpoints []string
 	etcdCli     kv.CDCEtcdClient
 	infos       map[string]model.ChangeFeedInfo
+	// revision is the last etcd revision observed by the watcher, the watch
+	// is resumed after it when the watcher is restarted.
+	revision int64
+	// errCh is shared by the processor watchers run across the restarts.
+	errCh chan error
 }
 
 // NewChangeFeedWatcher creates a new changefeed watcher
@@ -57,6 +77,7 @@ func NewChangeFeedWatcher(captureID string, pdEndpoints []string, cli kv.CDCEtcd
 		pdEndpoints: pdEndpoints,
 		etcdCli:     cli,
 		infos:       make(map[string]model.ChangeFeedInfo),
+		errCh:       make(chan error, 1),
 	}
 	return w
 }
@@ -77,8 +98,9 @@ func (w *ChangeFeedWatcher) processPutKv(kv *mvccpb.KeyValue) (bool, string, mod
 	if !ok {
 		needRunWatcher = true
 	}
-	if info.AdminJobType == model.AdminStop {
-		// only handle model.AdminStop, the model.AdminRemove case will be handled in `processDeleteKv`
+	if info.AdminJobType.IsStopState() {
+		// the model.AdminRemove case is handled in `processDeleteKv` since the
+		// info is deleted
 		delete(w.infos, changefeedID)
 	} else {
 		w.infos[changefeedID] = info
@@ -99,59 +121,96 @@ func (w *ChangeFeedWatcher) processDeleteKv(kv *mvccpb.KeyValue) error {
 	return nil
 }
 
-// Watch watches changefeed key base
+// Watch watches changefeed key base. The changefeeds are listed when it's
+// called for the first time, the watch is resumed from the last observed
+// revision after that.
 func (w *ChangeFeedWatcher) Watch(ctx context.Context, cb processorCallback) error {
-	errCh := make(chan error, 1)
+	if w.revision == 0 {
+		if err := w.relist(ctx, cb); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	relists := 0
+	for {
+		revision := w.revision
+		err := w.watch(ctx, cb)
+		if errors.Cause(err) != mvcc.ErrCompacted {
+			return errors.Trace(err)
+		}
+		if w.revision != revision {
+			relists = 0
+		}
+		relists++
+		if relists > cfWatcherMaxRelists {
+			return errors.Trace(err)
+		}
+		// the events after the revision are lost, diff the changefeeds with
+		// the known ones instead of restarting the processors from scratch
+		log.Warn("changefeed watcher is compacted, relist the changefeeds",
+			zap.Int64("revision", w.revision), zap.Error(err))
+		if err := w.relist(ctx, cb); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
 
-	revision, infos, err := w.etcdCli.GetChangeFeeds(ctx)
+// relist lists the changefeeds and diffs them with the known ones. The
+// processor watchers of the new changefeeds are run, and the changefeeds
+// deleted or stopped are dropped.
+func (w *ChangeFeedWatcher) relist(ctx context.Context, cb processorCallback) error {
+	lctx, cancel := context.WithTimeout(ctx, cfWatcherRelistTimeout)
+	revision, infos, err := w.etcdCli.GetChangeFeeds(lctx)
+	cancel()
 	if err != nil {
 		return errors.Trace(err)
 	}
-	for changefeedID, kv := range infos {
-		needRunWatcher, _, info, err := w.processPutKv(kv)
-		if err != nil {
-			return errors.Trace(err)
+	w.lock.Lock()
+	for changefeedID := range w.infos {
+		if _, ok := infos[changefeedID]; !ok {
+			log.Info("changefeed is deleted while the watcher is compacted", zap.String("changefeed", changefeedID))
+			delete(w.infos, changefeedID)
 		}
-		if needRunWatcher {
-			_, err := runProcessorWatcher(ctx, changefeedID, w.captureID, w.pdEndpoints, w.etcdCli, info, errCh, cb)
-			if err != nil {
-				return errors.Trace(err)
-			}
+	}
+	w.lock.Unlock()
+	for _, kv := range infos {
+		if err := w.handlePut(ctx, kv, cb); err != nil {
+			return errors.Trace(err)
 		}
 	}
+	w.revision = revision
+	return nil
+}
 
-	watchCh := w.etcdCli.Client.Watch(ctx, kv.GetEtcdKeyChangeFeedList(), clientv3.WithPrefix(), clientv3.WithRev(revision))
+// watch watches the changefeeds after the last observed revision until an
+// error occurs.
+func (w *ChangeFeedWatcher) watch(ctx context.Context, cb processorCallback) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchCh := w.etcdCli.Client.Watch(wctx, kv.GetEtcdKeyChangeFeedList(), clientv3.WithPrefix(), clientv3.WithRev(w.revision+1))
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case err := <-errCh:
+		case err := <-w.errCh:
 			return errors.Trace(err)
 		case resp, ok := <-watchCh:
 			if !ok {
 				log.Info("watcher is closed")
 				return nil
 			}
+			respErr := resp.Err()
 			failpoint.Inject("WatchChangeFeedInfoCompactionErr", func() {
-				failpoint.Return(errors.Trace(mvcc.ErrCompacted))
+				respErr = mvcc.ErrCompacted
 			})
-			respErr := resp.Err()
 			if respErr != nil {
 				return errors.Trace(respErr)
 			}
 			for _, ev := range resp.Events {
 				switch ev.Type {
 				case mvccpb.PUT:
-					needRunWatcher, changefeedID, info, err := w.processPutKv(ev.Kv)
-					if err != nil {
+					if err := w.handlePut(ctx, ev.Kv, cb); err != nil {
 						return errors.Trace(err)
 					}
-					if needRunWatcher {
-						_, err := runProcessorWatcher(ctx, changefeedID, w.captureID, w.pdEndpoints, w.etcdCli, info, errCh, cb)
-						if err != nil {
-							return errors.Trace(err)
-						}
-					}
 				case mvccpb.DELETE:
 					err := w.processDeleteKv(ev.Kv)
 					if err != nil {
@@ -159,8 +218,27 @@ func (w *ChangeFeedWatcher) Watch(ctx context.Context, cb processorCallback) err
 					}
 				}
 			}
+			if resp.Header.Revision > w.revision {
+				w.revision = resp.Header.Revision
+			}
+		}
+	}
+}
+
+// handlePut runs the processor watcher of the changefeed if it's new to the
+// watcher.
+func (w *ChangeFeedWatcher) handlePut(ctx context.Context, kv *mvccpb.KeyValue, cb processorCallback) error {
+	needRunWatcher, changefeedID, info, err := w.processPutKv(kv)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if needRunWatcher && !info.AdminJobType.IsStopState() {
+		_, err := runProcessorWatcher(ctx, changefeedID, w.captureID, w.pdEndpoints, w.etcdCli, info, w.errCh, cb)
+		if err != nil {
+			return errors.Trace(err)
 		}
 	}
+	return nil
 }
 
 // ProcessorWatcher is a processor watcher
@@ -216,46 +294,13 @@ func (w *ProcessorWatcher) Watch(ctx context.Context, errCh chan<- error, cb pro
 	defer w.wg.Done()
 	key := kv.GetEtcdKeyTask(w.changefeedID, w.captureID)
 
-	getResp, err := w.etcdCli.Client.Get(ctx, key)
+	appeared, err := w.waitTaskKey(ctx, key)
 	if err != nil {
-		errCh <- errors.Trace(err)
+		w.escalate(ctx, errCh, err)
 		return
 	}
-	if getResp.Count == 0 {
-		rl := rate.NewLimiter(0.1, 5)
-		revision := getResp.Header.Revision
-		// wait for key to appear
-		watchCh := w.etcdCli.Client.Watch(ctx, key, clientv3.WithRev(revision))
-	waitKeyLoop:
-		for {
-			if !rl.Allow() {
-				errCh <- errors.New("task key watcher exceeds rate limit")
-				return
-			}
-			select {
-			case <-ctx.Done():
-				return
-			case resp, ok := <-watchCh:
-				if !ok {
-					log.Info("watcher is closed")
-					return
-				}
-				respErr := resp.Err()
-				if respErr != nil {
-					if respErr == mvcc.ErrCompacted {
-						continue waitKeyLoop
-					}
-					errCh <- errors.Trace(respErr)
-					return
-				}
-				for _, ev := range resp.Events {
-					switch ev.Type {
-					case mvccpb.PUT:
-						break waitKeyLoop
-					}
-				}
-			}
-		}
+	if !appeared {
+		return
 	}
 
 	cctx, cancel := context.WithCancel(ctx)
@@ -275,9 +320,11 @@ func (w *ProcessorWatcher) Watch(ctx context.Context, errCh chan<- error, cb pro
 			}
 			return
 		case <-time.After(checkTaskKeyInterval):
-			resp, err := w.etcdCli.Client.Get(ctx, key)
+			resp, err := w.getTaskKey(ctx, key)
 			if err != nil {
-				errCh <- errors.Trace(err)
+				if ctx.Err() == nil {
+					w.escalate(ctx, errCh, err)
+				}
 				return
 			}
 			// processor has been removed from this capture
@@ -288,6 +335,141 @@ func (w *ProcessorWatcher) Watch(ctx context.Context, errCh chan<- error, cb pro
 	}
 }
 
+// waitTaskKey waits for the task key to appear. The watch is reopened from a
+// new read of the key after its revision is compacted, the reopens back off
+// with jitter until the retry budget runs out. It returns false without an
+// error if the watch is closed or canceled.
+func (w *ProcessorWatcher) waitTaskKey(ctx context.Context, key string) (bool, error) {
+	rl := rate.NewLimiter(0.1, 5)
+	bo := newProcessorWatcherBackoff(ctx)
+	for {
+		getResp, err := w.getTaskKey(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			return false, errors.Trace(err)
+		}
+		if getResp.Count > 0 {
+			return true, nil
+		}
+		appeared, err := w.watchTaskKey(ctx, key, getResp.Header.Revision+1, rl)
+		if errors.Cause(err) != mvcc.ErrCompacted {
+			return appeared, errors.Trace(err)
+		}
+		backoffTime := bo.NextBackOff()
+		if backoffTime == backoff.Stop {
+			return false, errors.Annotate(err, "task key watcher exceeds the retry budget")
+		}
+		log.Warn("task key watcher is compacted, reopen it later", zap.String("changefeed", w.changefeedID),
+			zap.Duration("backoff", backoffTime), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-time.After(backoffTime):
+		}
+	}
+}
+
+// watchTaskKey watches the task key from the revision until it's put.
+func (w *ProcessorWatcher) watchTaskKey(ctx context.Context, key string, revision int64, rl *rate.Limiter) (bool, error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchCh := w.etcdCli.Client.Watch(wctx, key, clientv3.WithRev(revision))
+	for {
+		if !rl.Allow() {
+			return false, errors.New("task key watcher exceeds rate limit")
+		}
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case resp, ok := <-watchCh:
+			if !ok {
+				log.Info("watcher is closed")
+				return false, nil
+			}
+			respErr := resp.Err()
+			if respErr != nil {
+				return false, errors.Trace(respErr)
+			}
+			for _, ev := range resp.Events {
+				switch ev.Type {
+				case mvccpb.PUT:
+					return true, nil
+				}
+			}
+		}
+	}
+}
+
+// getTaskKey reads the task key, the errors are retried with the backoff.
+func (w *ProcessorWatcher) getTaskKey(ctx context.Context, key string) (*clientv3.GetResponse, error) {
+	var resp *clientv3.GetResponse
+	err := backoff.RetryNotify(func() error {
+		var err error
+		resp, err = w.etcdCli.Client.Get(ctx, key)
+		return errors.Trace(err)
+	}, newProcessorWatcherBackoff(ctx), func(err error, d time.Duration) {
+		log.Warn("failed to read the task key, retry later", zap.String("changefeed", w.changefeedID),
+			zap.Duration("backoff", d), zap.Error(err))
+	})
+	return resp, errors.Trace(err)
+}
+
+// escalate hands the error to the error handling of the changefeed by
+// reporting it in the task status. The error is sent to the capture if the
+// task status can't be written either.
+func (w *ProcessorWatcher) escalate(ctx context.Context, errCh chan<- error, err error) {
+	rerr := w.reportError(ctx, err)
+	if rerr == nil {
+		log.Warn("processor watcher reports the error to the owner", zap.String("changefeed", w.changefeedID),
+			labelsField(w.info.Labels), zap.Error(err))
+		return
+	}
+	log.Warn("failed to report the processor watcher error", zap.String("changefeed", w.changefeedID),
+		labelsField(w.info.Labels), zap.Error(rerr))
+	errCh <- err
+}
+
+// reportError records the error in the task status of the capture, the owner
+// stops the changefeed with the error once it finds the error.
+func (w *ProcessorWatcher) reportError(ctx context.Context, err error) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	modRevision, status, gerr := w.etcdCli.GetTaskStatus(ctx, w.changefeedID, w.captureID)
+	if gerr != nil {
+		return errors.Trace(gerr)
+	}
+	status.Error = &model.RunningError{CaptureID: w.captureID, Message: err.Error()}
+	data, merr := status.Marshal()
+	if merr != nil {
+		return errors.Trace(merr)
+	}
+	key := kv.GetEtcdKeyTask(w.changefeedID, w.captureID)
+	resp, terr := w.etcdCli.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(key), "=", modRevision),
+	).Then(clientv3.OpPut(key, data)).Commit()
+	if terr != nil {
+		return errors.Trace(terr)
+	}
+	if !resp.Succeeded {
+		return errors.Trace(model.ErrWriteTsConflict)
+	}
+	return nil
+}
+
+// newProcessorWatcherBackoff returns the backoff of the retries of the
+// processor watcher, it stops after processorWatcherMaxRetries retries.
+func newProcessorWatcherBackoff(ctx context.Context) backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = processorWatcherRetryBackoff
+	b.MaxInterval = processorWatcherMaxRetryBackoff
+	b.RandomizationFactor = processorWatcherRetryJitter
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return backoff.WithContext(backoff.WithMaxRetries(b, processorWatcherMaxRetries), ctx)
+}
+
 type processorCallback interface {
 	// OnRunProcessor is called when the processor is started.
 	OnRunProcessor(p *processor)
@@ -332,7 +514,7 @@ func realRunProcessor(
 		return err
 	}
 
-	log.Info("start to run processor", zap.String("changefeed id", changefeedID))
+	log.Info("start to run processor", zap.String("changefeed id", changefeedID), labelsField(info.Labels))
 
 	if cb != nil {
 		cb.OnRunProcessor(processor)
@@ -0,0 +1,401 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+)
+
+// simTickTime is the virtual time elapsed in a tick of the simulation.
+const simTickTime = time.Second
+
+var errSimWrite = errors.New("injected write failure")
+
+// virtualClock is a clock advanced by the simulation only.
+type virtualClock struct {
+	now time.Time
+}
+
+func (c *virtualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *virtualClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// simTaskStore keeps the task statuses in memory instead of etcd, it follows
+// the p-lock and mod revision rules of the etcd writer of owner.
+type simTaskStore struct {
+	revision int64
+	statuses map[string]*model.TaskStatus
+	// failures is the number of the following writes to fail of each capture.
+	failures map[string]int
+}
+
+func newSimTaskStore() *simTaskStore {
+	return &simTaskStore{
+		statuses: make(map[string]*model.TaskStatus),
+		failures: make(map[string]int),
+	}
+}
+
+// Write implements OwnerTaskStatusWriter interface.
+func (s *simTaskStore) Write(
+	ctx context.Context, changefeedID, captureID string, info *model.TaskStatus, writePLock bool,
+) (*model.TaskStatus, error) {
+	if s.failures[captureID] > 0 {
+		s.failures[captureID]--
+		return nil, errors.Trace(errSimWrite)
+	}
+	newInfo := info
+	if old, ok := s.statuses[captureID]; ok {
+		if old.TablePLock != nil {
+			if old.TableCLock == nil {
+				return nil, errors.Trace(model.ErrFindPLockNotCommit)
+			}
+			newInfo.TablePLock = nil
+			newInfo.TableCLock = nil
+		}
+		// the ts are updated by the processor since the owner read them
+		if old.ModRevision != newInfo.ModRevision {
+			newInfo.CheckPointTs = old.CheckPointTs
+			newInfo.ResolvedTs = old.ResolvedTs
+		}
+	}
+	if writePLock {
+		newInfo.TablePLock = &model.TableLock{Ts: uint64(s.revision)}
+	}
+	s.revision++
+	newInfo.ModRevision = s.revision
+	s.statuses[captureID] = newInfo.Clone()
+	return newInfo, nil
+}
+
+// advance acts as the processor of a capture, it commits the p-lock and
+// forwards the ts of the task status.
+func (s *simTaskStore) advance(captureID string, ts uint64) {
+	status, ok := s.statuses[captureID]
+	if !ok {
+		return
+	}
+	if status.TablePLock != nil && status.TableCLock == nil {
+		status.TableCLock = &model.TableLock{Ts: status.TablePLock.Ts, CheckpointTs: status.CheckPointTs}
+	}
+	status.CheckPointTs = ts
+	status.ResolvedTs = ts
+	s.revision++
+	status.ModRevision = s.revision
+}
+
+// snapshot returns the task statuses as read by owner.
+func (s *simTaskStore) snapshot() model.ProcessorsInfos {
+	infos := make(model.ProcessorsInfos, len(s.statuses))
+	for id, status := range s.statuses {
+		infos[id] = status.Clone()
+	}
+	return infos
+}
+
+// simEvent is a scripted event happening at the virtual time since the start
+// of the simulation.
+type simEvent struct {
+	at     time.Duration
+	action func(s *schedulerSim)
+}
+
+// schedulerSim simulates the scheduling of a changefeed with fake captures on
+// a virtual clock, each tick runs the processors of the live captures and then
+// the scheduling of the owner.
+type schedulerSim struct {
+	clock    *virtualClock
+	store    *simTaskStore
+	feed     *changeFeed
+	captures map[string]*model.CaptureInfo
+	stalled  map[string]bool
+	// markDown is the processors marked down in the last tick, they are
+	// handled in the next tick as owner does.
+	markDown []*model.ProcInfoSnap
+	ts       uint64
+	elapsed  time.Duration
+	events   []simEvent
+}
+
+func newSchedulerSim(tableCount int, captures ...string) *schedulerSim {
+	clock := &virtualClock{now: time.Unix(0, 0)}
+	store := newSimTaskStore()
+	s := &schedulerSim{
+		clock: clock,
+		store: store,
+		feed: &changeFeed{
+			id:                      "sim-changefeed",
+			schemas:                 map[uint64]tableIDMap{1: {}},
+			tables:                  make(map[uint64]schema.TableName),
+			orphanTables:            make(map[uint64]model.ProcessTableInfo),
+			toCleanTables:           make(map[uint64]struct{}),
+			processorInfos:          make(model.ProcessorsInfos),
+			processorLastUpdateTime: make(map[string]time.Time),
+			infoWriter:              store,
+			clock:                   clock.Now,
+		},
+		captures: make(map[string]*model.CaptureInfo),
+		stalled:  make(map[string]bool),
+	}
+	for i := 1; i <= tableCount; i++ {
+		s.createTable(uint64(i))
+	}
+	for _, id := range captures {
+		s.addCapture(id)
+	}
+	return s
+}
+
+// script schedules the events, they are applied at the start of the first
+// tick not earlier than their time.
+func (s *schedulerSim) script(events ...simEvent) {
+	s.events = append(s.events, events...)
+	sort.SliceStable(s.events, func(i, j int) bool { return s.events[i].at < s.events[j].at })
+}
+
+func (s *schedulerSim) createTable(id uint64) {
+	s.feed.schemas[1][id] = struct{}{}
+	s.feed.tables[id] = schema.TableName{Schema: "test", Table: "t"}
+	s.feed.orphanTables[id] = model.ProcessTableInfo{ID: id, StartTs: s.ts}
+}
+
+func (s *schedulerSim) dropTable(id uint64) {
+	s.feed.removeTable(1, id)
+}
+
+func (s *schedulerSim) addCapture(id string) {
+	s.captures[id] = &model.CaptureInfo{ID: id}
+}
+
+// killCapture removes the capture as owner does when its capture info is
+// deleted from etcd.
+func (s *schedulerSim) killCapture(id string) {
+	delete(s.captures, id)
+	delete(s.stalled, id)
+	s.feed.reclaimTables(id)
+	delete(s.store.statuses, id)
+}
+
+// stallCapture keeps the capture alive but stops its processor from updating
+// the task status.
+func (s *schedulerSim) stallCapture(id string) {
+	s.stalled[id] = true
+}
+
+func (s *schedulerSim) failWrites(id string, count int) {
+	s.store.failures[id] += count
+}
+
+func (s *schedulerSim) tick(ctx context.Context) {
+	for len(s.events) > 0 && s.events[0].at <= s.elapsed {
+		s.events[0].action(s)
+		s.events = s.events[1:]
+	}
+	s.elapsed += simTickTime
+	s.clock.Advance(simTickTime)
+	s.ts++
+
+	for id := range s.captures {
+		if !s.stalled[id] {
+			s.store.advance(id, s.ts)
+		}
+	}
+
+	for _, snap := range s.markDown {
+		for _, tbl := range snap.Tables {
+			s.feed.reAddTable(tbl.ID, tbl.StartTs)
+		}
+		delete(s.store.statuses, snap.CaptureID)
+		delete(s.captures, snap.CaptureID)
+		delete(s.stalled, snap.CaptureID)
+	}
+	s.feed.updateProcessorInfos(s.store.snapshot())
+	s.markDown = s.feed.downProcessors()
+	s.feed.tryBalance(ctx, s.captures)
+}
+
+func (s *schedulerSim) run(ctx context.Context, d time.Duration) {
+	for end := s.elapsed + d; s.elapsed < end; {
+		s.tick(ctx)
+	}
+}
+
+// assignment returns the capture of each dispatched table, it fails if a table
+// is dispatched to more than one capture.
+func (s *schedulerSim) assignment(c *check.C) map[uint64]string {
+	assigned := make(map[uint64]string)
+	for id, status := range s.store.statuses {
+		for _, tbl := range status.TableInfos {
+			other, ok := assigned[tbl.ID]
+			c.Assert(ok, check.IsFalse, check.Commentf("table %d is dispatched to %s and %s", tbl.ID, other, id))
+			assigned[tbl.ID] = id
+		}
+	}
+	return assigned
+}
+
+func (s *schedulerSim) tableCounts() map[string]int {
+	counts := make(map[string]int, len(s.captures))
+	for id := range s.captures {
+		counts[id] = 0
+	}
+	for id, status := range s.store.statuses {
+		counts[id] = len(status.TableInfos)
+	}
+	return counts
+}
+
+// checkDispatched checks that all the tables are dispatched to live captures
+// and the numbers of tables of the captures are within the given spread.
+func (s *schedulerSim) checkDispatched(c *check.C, spread int) {
+	assigned := s.assignment(c)
+	c.Assert(s.feed.orphanTables, check.HasLen, 0)
+	c.Assert(assigned, check.HasLen, len(s.feed.tables))
+	for tid, id := range assigned {
+		_, ok := s.captures[id]
+		c.Assert(ok, check.IsTrue, check.Commentf("table %d is dispatched to dead capture %s", tid, id))
+	}
+	min, max := len(s.feed.tables), 0
+	for _, count := range s.tableCounts() {
+		if count < min {
+			min = count
+		}
+		if count > max {
+			max = count
+		}
+	}
+	c.Assert(max-min <= spread, check.IsTrue, check.Commentf("table counts: %v", s.tableCounts()))
+}
+
+type schedulerSimSuite struct{}
+
+var _ = check.Suite(&schedulerSimSuite{})
+
+func (s *schedulerSimSuite) TestDispatchEvenly(c *check.C) {
+	sim := newSchedulerSim(10, "c1", "c2", "c3")
+	sim.run(context.Background(), 5*simTickTime)
+	sim.checkDispatched(c, 1)
+
+	// the tables created later go to the capture with the fewest tables
+	sim.script(
+		simEvent{at: 5 * simTickTime, action: func(s *schedulerSim) { s.addCapture("c4") }},
+		simEvent{at: 6 * simTickTime, action: func(s *schedulerSim) {
+			for i := 11; i <= 12; i++ {
+				s.createTable(uint64(i))
+			}
+		}},
+	)
+	sim.run(context.Background(), 5*simTickTime)
+	sim.checkDispatched(c, 2)
+	c.Assert(sim.tableCounts()["c4"], check.Equals, 2)
+}
+
+func (s *schedulerSimSuite) TestCaptureFailure(c *check.C) {
+	sim := newSchedulerSim(9, "c1", "c2", "c3")
+	sim.script(simEvent{at: 10 * simTickTime, action: func(s *schedulerSim) { s.killCapture("c2") }})
+	sim.run(context.Background(), 10*simTickTime)
+	sim.checkDispatched(c, 0)
+	checkpointTs := sim.store.statuses["c2"].CheckPointTs
+	var reclaimed []uint64
+	for tid, id := range sim.assignment(c) {
+		if id == "c2" {
+			reclaimed = append(reclaimed, tid)
+		}
+	}
+
+	sim.run(context.Background(), simTickTime)
+	sim.checkDispatched(c, 1)
+	c.Assert(sim.tableCounts(), check.HasLen, 2)
+	// the reclaimed tables are restarted from the checkpoint of the dead capture
+	startTs := make(map[uint64]uint64)
+	for _, status := range sim.store.statuses {
+		for _, tbl := range status.TableInfos {
+			startTs[tbl.ID] = tbl.StartTs
+		}
+	}
+	c.Assert(reclaimed, check.HasLen, 3)
+	for _, tid := range reclaimed {
+		c.Assert(startTs[tid], check.Equals, checkpointTs)
+	}
+}
+
+func (s *schedulerSimSuite) TestStalledProcessor(c *check.C) {
+	sim := newSchedulerSim(4, "c1", "c2")
+	sim.script(simEvent{at: 5 * simTickTime, action: func(s *schedulerSim) { s.stallCapture("c1") }})
+	sim.run(context.Background(), markProcessorDownTime)
+	_, ok := sim.captures["c1"]
+	c.Assert(ok, check.IsTrue)
+
+	// the capture is marked down after markProcessorDownTime without updates
+	sim.run(context.Background(), 10*simTickTime)
+	_, ok = sim.captures["c1"]
+	c.Assert(ok, check.IsFalse)
+	sim.checkDispatched(c, 0)
+	c.Assert(sim.tableCounts(), check.DeepEquals, map[string]int{"c2": 4})
+	for _, tbl := range sim.store.statuses["c2"].TableInfos {
+		c.Assert(tbl.StartTs, check.LessEqual, uint64(5))
+	}
+}
+
+func (s *schedulerSimSuite) TestWriteFailures(c *check.C) {
+	sim := newSchedulerSim(6, "c1")
+	sim.failWrites("c1", 3)
+	sim.run(context.Background(), simTickTime)
+	c.Assert(sim.store.statuses, check.HasLen, 0)
+	c.Assert(sim.feed.orphanTables, check.HasLen, 6)
+
+	sim.script(
+		simEvent{at: 2 * simTickTime, action: func(s *schedulerSim) { s.addCapture("c2") }},
+		simEvent{at: 2 * simTickTime, action: func(s *schedulerSim) { s.failWrites("c2", 2) }},
+	)
+	sim.run(context.Background(), 10*simTickTime)
+	sim.checkDispatched(c, 6)
+}
+
+func (s *schedulerSimSuite) TestDropTableWithLock(c *check.C) {
+	sim := newSchedulerSim(4, "c1", "c2")
+	sim.run(context.Background(), 2*simTickTime)
+	sim.checkDispatched(c, 0)
+
+	// the tables removed in a tick are cleaned one by one since the p-lock
+	// must be committed by the processor before the next write
+	owner := sim.assignment(c)[1]
+	var other uint64
+	for tid, id := range sim.assignment(c) {
+		if tid != 1 && id == owner {
+			other = tid
+		}
+	}
+	sim.dropTable(1)
+	sim.dropTable(other)
+	sim.tick(context.Background())
+	c.Assert(sim.feed.toCleanTables, check.HasLen, 1)
+	c.Assert(sim.store.statuses[owner].TablePLock, check.NotNil)
+
+	sim.tick(context.Background())
+	c.Assert(sim.feed.toCleanTables, check.HasLen, 0)
+	c.Assert(sim.assignment(c), check.HasLen, 2)
+	c.Assert(sim.tableCounts()[owner], check.Equals, 0)
+}
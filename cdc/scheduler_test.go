@@ -20,6 +20,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cenkalti/backoff"
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
@@ -301,7 +302,8 @@ func (s *schedulerSuite) TestChangeFeedWatcher(c *check.C) {
 	w.lock.RLock()
 	c.Assert(len(w.infos), check.Equals, 1)
 	w.lock.RUnlock()
-	c.Assert(atomic.LoadInt64(&watcherRetry), check.Equals, int64(1))
+	// the compaction is handled by relisting the changefeeds
+	c.Assert(atomic.LoadInt64(&watcherRetry), check.Equals, int64(0))
 
 	c.Assert(failpoint.Disable("github.com/pingcap/ticdc/cdc/WatchChangeFeedInfoCompactionErr"), check.IsNil)
 
@@ -318,3 +320,135 @@ func (s *schedulerSuite) TestChangeFeedWatcher(c *check.C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *schedulerSuite) TestChangeFeedWatcherRelist(c *check.C) {
+	oriRunProcessorWatcher := runProcessorWatcher
+	runProcessorWatcher = mockRunProcessorWatcher
+	defer func() {
+		runProcessorWatcher = oriRunProcessorWatcher
+	}()
+
+	curl := s.clientURL.String()
+	etcdCli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{curl},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	defer etcdCli.Close()
+	cli := kv.NewCDCEtcdClient(etcdCli)
+	ctx := context.Background()
+
+	w := NewChangeFeedWatcher("test-capture", []string{}, cli)
+	w.infos["relist-deleted"] = model.ChangeFeedInfo{}
+	w.infos["relist-running"] = model.ChangeFeedInfo{}
+	w.infos["relist-stopped"] = model.ChangeFeedInfo{}
+	for id, info := range map[string]*model.ChangeFeedInfo{
+		"relist-running": {},
+		"relist-stopped": {AdminJobType: model.AdminStop},
+		"relist-new":     {},
+		"relist-failed":  {AdminJobType: model.AdminFail},
+	} {
+		c.Assert(cli.SaveChangeFeedInfo(ctx, info, id), check.IsNil)
+	}
+	defer func() {
+		_, err := cli.Client.Delete(ctx, kv.GetEtcdKeyChangeFeedList(), clientv3.WithPrefix())
+		c.Assert(err, check.IsNil)
+	}()
+
+	// only the processor watcher of the new running changefeed is run
+	count := atomic.LoadInt32(&runChangeFeedWatcherCount)
+	c.Assert(w.relist(ctx, nil), check.IsNil)
+	c.Assert(atomic.LoadInt32(&runChangeFeedWatcherCount), check.Equals, count+1)
+	c.Assert(w.infos, check.HasLen, 2)
+	c.Assert(w.infos, check.HasKey, "relist-running")
+	c.Assert(w.infos, check.HasKey, "relist-new")
+	c.Assert(w.revision, check.Not(check.Equals), int64(0))
+
+	// the same changefeeds are not run again
+	c.Assert(w.relist(ctx, nil), check.IsNil)
+	c.Assert(atomic.LoadInt32(&runChangeFeedWatcherCount), check.Equals, count+1)
+}
+
+func (s *schedulerSuite) TestProcessorWatcherBackoff(c *check.C) {
+	defer func(initial, max time.Duration, retries uint64) {
+		processorWatcherRetryBackoff = initial
+		processorWatcherMaxRetryBackoff = max
+		processorWatcherMaxRetries = retries
+	}(processorWatcherRetryBackoff, processorWatcherMaxRetryBackoff, processorWatcherMaxRetries)
+	processorWatcherRetryBackoff = 100 * time.Millisecond
+	processorWatcherMaxRetryBackoff = 200 * time.Millisecond
+	processorWatcherMaxRetries = 4
+
+	// the intervals grow by the default multiplier 1.5 with 50% jitter
+	b := newProcessorWatcherBackoff(context.Background())
+	for _, interval := range []time.Duration{100, 150, 200, 200} {
+		interval *= time.Millisecond
+		d := b.NextBackOff()
+		c.Assert(d >= interval/2 && d <= interval*3/2, check.IsTrue, check.Commentf("backoff %s", d))
+	}
+	// the retry budget runs out
+	c.Assert(b.NextBackOff(), check.Equals, backoff.Stop)
+}
+
+func (s *schedulerSuite) TestProcessorWatcherEscalate(c *check.C) {
+	var (
+		changefeedID = "test-changefeed-escalate"
+		captureID    = "test-capture-escalate"
+		key          = kv.GetEtcdKeyTask(changefeedID, captureID)
+	)
+	defer func(initial time.Duration, retries uint64) {
+		processorWatcherRetryBackoff = initial
+		processorWatcherMaxRetries = retries
+	}(processorWatcherRetryBackoff, processorWatcherMaxRetries)
+	processorWatcherRetryBackoff = time.Millisecond
+	processorWatcherMaxRetries = 2
+
+	curl := s.clientURL.String()
+	etcdCli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{curl},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	defer etcdCli.Close()
+	cli := kv.NewCDCEtcdClient(etcdCli)
+	ctx := context.Background()
+
+	// the error is reported to the owner in the task status
+	c.Assert(cli.PutTaskStatus(ctx, changefeedID, captureID, &model.TaskStatus{}), check.IsNil)
+	errCh := make(chan error, 1)
+	sw := NewProcessorWatcher(changefeedID, captureID, []string{}, cli, model.ChangeFeedInfo{}, 0)
+	sw.escalate(ctx, errCh, errors.New("keyspace unreadable"))
+	c.Assert(errCh, check.HasLen, 0)
+	_, status, err := cli.GetTaskStatus(ctx, changefeedID, captureID)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Error, check.DeepEquals, &model.RunningError{CaptureID: captureID, Message: "keyspace unreadable"})
+
+	// the error is sent to the capture if the task status is missing
+	_, err = cli.Client.Delete(ctx, key)
+	c.Assert(err, check.IsNil)
+	sw.escalate(ctx, errCh, errors.New("keyspace unreadable"))
+	c.Assert(errCh, check.HasLen, 1)
+	<-errCh
+
+	// the watcher gives up reading the task key after the retries
+	etcdCli.KV = unreadableKV{KV: etcdCli.KV}
+	sw = NewProcessorWatcher(changefeedID, captureID, []string{}, cli, model.ChangeFeedInfo{}, 0)
+	sw.wg.Add(1)
+	go sw.Watch(ctx, errCh, nil)
+	select {
+	case err := <-errCh:
+		c.Assert(err, check.NotNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("processor watcher doesn't escalate the error")
+	}
+	sw.close()
+}
+
+// unreadableKV fails all the reads of the keyspace.
+type unreadableKV struct {
+	clientv3.KV
+}
+
+func (kv unreadableKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	return nil, errors.New("keyspace unreadable")
+}
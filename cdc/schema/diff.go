@@ -0,0 +1,250 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+)
+
+// TableDiff is the difference between two versions of a table, so the sinks
+// which can't execute the DDLs of TiDB can synthesize the equivalent DDLs of
+// the downstream. The columns and indices are matched by their IDs, only the
+// public ones are compared.
+type TableDiff struct {
+	// OldName and NewName are different if the table is renamed.
+	OldName string
+	NewName string
+
+	AddedColumns    []*model.ColumnInfo
+	DroppedColumns  []*model.ColumnInfo
+	ModifiedColumns []*ColumnDiff
+
+	AddedIndices   []*model.IndexInfo
+	DroppedIndices []*model.IndexInfo
+	// RenamedIndices are the indices renamed only, the indices of the other
+	// changes are dropped and added again.
+	RenamedIndices []*IndexDiff
+
+	// OldPrimaryKey and NewPrimaryKey are the columns of the primary keys,
+	// they are set only if the primary key is changed.
+	OldPrimaryKey []string
+	NewPrimaryKey []string
+}
+
+// ColumnDiff is the change of a column.
+type ColumnDiff struct {
+	Old *model.ColumnInfo
+	New *model.ColumnInfo
+
+	Renamed bool
+	// TypeChanged is true if the type, the length, the charset, the collation
+	// or the unsigned flag is changed.
+	TypeChanged    bool
+	NullChanged    bool
+	DefaultChanged bool
+	CommentChanged bool
+	// Moved is true if the column is moved to another position relative to
+	// the other columns, the columns added or dropped don't move the others.
+	Moved bool
+}
+
+// IndexDiff is the change of an index.
+type IndexDiff struct {
+	Old *model.IndexInfo
+	New *model.IndexInfo
+}
+
+// IsEmpty returns true if the two versions are the same.
+func (d *TableDiff) IsEmpty() bool {
+	return d.OldName == d.NewName &&
+		len(d.AddedColumns) == 0 && len(d.DroppedColumns) == 0 && len(d.ModifiedColumns) == 0 &&
+		len(d.AddedIndices) == 0 && len(d.DroppedIndices) == 0 && len(d.RenamedIndices) == 0 &&
+		d.OldPrimaryKey == nil && d.NewPrimaryKey == nil
+}
+
+// DiffTableInfos returns the difference from the old version of a table to
+// the new one.
+func DiffTableInfos(old, new *model.TableInfo) *TableDiff {
+	diff := &TableDiff{OldName: old.Name.O, NewName: new.Name.O}
+	diffColumns(diff, old, new)
+	diffIndices(diff, old, new)
+	oldPK, newPK := primaryKeyColumns(old), primaryKeyColumns(new)
+	if !sameColumns(oldPK, newPK) {
+		diff.OldPrimaryKey, diff.NewPrimaryKey = columnNames(oldPK), columnNames(newPK)
+	}
+	return diff
+}
+
+func publicColumns(table *model.TableInfo) []*model.ColumnInfo {
+	cols := make([]*model.ColumnInfo, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if col.State == model.StatePublic {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+func diffColumns(diff *TableDiff, old, new *model.TableInfo) {
+	oldCols, newCols := publicColumns(old), publicColumns(new)
+	oldByID := make(map[int64]*model.ColumnInfo, len(oldCols))
+	for _, col := range oldCols {
+		oldByID[col.ID] = col
+	}
+	newByID := make(map[int64]*model.ColumnInfo, len(newCols))
+	for _, col := range newCols {
+		newByID[col.ID] = col
+	}
+	for _, col := range oldCols {
+		if _, ok := newByID[col.ID]; !ok {
+			diff.DroppedColumns = append(diff.DroppedColumns, col)
+		}
+	}
+
+	// the position of a column is the column before it among the columns in
+	// both versions
+	oldPrev := make(map[int64]int64, len(oldCols))
+	var prev int64
+	for _, col := range oldCols {
+		if _, ok := newByID[col.ID]; ok {
+			oldPrev[col.ID] = prev
+			prev = col.ID
+		}
+	}
+	prev = 0
+	for _, col := range newCols {
+		oldCol, ok := oldByID[col.ID]
+		if !ok {
+			diff.AddedColumns = append(diff.AddedColumns, col)
+			continue
+		}
+		c := &ColumnDiff{
+			Old:            oldCol,
+			New:            col,
+			Renamed:        oldCol.Name.O != col.Name.O,
+			TypeChanged:    !oldCol.FieldType.Equal(&col.FieldType),
+			NullChanged:    mysql.HasNotNullFlag(oldCol.Flag) != mysql.HasNotNullFlag(col.Flag),
+			DefaultChanged: fmt.Sprint(oldCol.GetDefaultValue()) != fmt.Sprint(col.GetDefaultValue()),
+			CommentChanged: oldCol.Comment != col.Comment,
+			Moved:          oldPrev[col.ID] != prev,
+		}
+		prev = col.ID
+		if c.Renamed || c.TypeChanged || c.NullChanged || c.DefaultChanged || c.CommentChanged || c.Moved {
+			diff.ModifiedColumns = append(diff.ModifiedColumns, c)
+		}
+	}
+}
+
+func publicIndices(table *model.TableInfo) []*model.IndexInfo {
+	indices := make([]*model.IndexInfo, 0, len(table.Indices))
+	for _, idx := range table.Indices {
+		if idx.State == model.StatePublic {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+func diffIndices(diff *TableDiff, old, new *model.TableInfo) {
+	oldIndices, newIndices := publicIndices(old), publicIndices(new)
+	oldByID := make(map[int64]*model.IndexInfo, len(oldIndices))
+	for _, idx := range oldIndices {
+		oldByID[idx.ID] = idx
+	}
+	matched := make(map[int64]struct{}, len(newIndices))
+	for _, idx := range newIndices {
+		oldIdx, ok := oldByID[idx.ID]
+		if !ok || !sameIndexDefinition(old, oldIdx, new, idx) {
+			diff.AddedIndices = append(diff.AddedIndices, idx)
+			continue
+		}
+		matched[idx.ID] = struct{}{}
+		if oldIdx.Name.O != idx.Name.O {
+			diff.RenamedIndices = append(diff.RenamedIndices, &IndexDiff{Old: oldIdx, New: idx})
+		}
+	}
+	for _, idx := range oldIndices {
+		if _, ok := matched[idx.ID]; !ok {
+			diff.DroppedIndices = append(diff.DroppedIndices, idx)
+		}
+	}
+}
+
+// sameIndexDefinition returns true if the indices are the same except their
+// names. The columns are matched by their IDs, so an index isn't changed by
+// renaming its columns.
+func sameIndexDefinition(aTable *model.TableInfo, a *model.IndexInfo, bTable *model.TableInfo, b *model.IndexInfo) bool {
+	if a.Unique != b.Unique || a.Primary != b.Primary || a.Tp != b.Tp || len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i].Length != b.Columns[i].Length {
+			return false
+		}
+		aCol, bCol := model.FindColumnInfo(aTable.Columns, a.Columns[i].Name.L), model.FindColumnInfo(bTable.Columns, b.Columns[i].Name.L)
+		if aCol == nil || bCol == nil || aCol.ID != bCol.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// primaryKeyColumns returns the columns of the primary key, the handle column
+// if the primary key is the handle.
+func primaryKeyColumns(table *model.TableInfo) []*model.ColumnInfo {
+	if table.PKIsHandle {
+		for _, col := range table.Columns {
+			if mysql.HasPriKeyFlag(col.Flag) {
+				return []*model.ColumnInfo{col}
+			}
+		}
+	}
+	for _, idx := range table.Indices {
+		if idx.Primary && idx.State == model.StatePublic {
+			cols := make([]*model.ColumnInfo, 0, len(idx.Columns))
+			for _, col := range idx.Columns {
+				cols = append(cols, table.Columns[col.Offset])
+			}
+			return cols
+		}
+	}
+	return nil
+}
+
+// sameColumns returns true if the columns have the same IDs in order.
+func sameColumns(a, b []*model.ColumnInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+func columnNames(cols []*model.ColumnInfo) []string {
+	if cols == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cols))
+	for _, col := range cols {
+		names = append(names, col.Name.O)
+	}
+	return names
+}
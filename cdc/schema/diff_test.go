@@ -0,0 +1,162 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type diffSuite struct{}
+
+var _ = Suite(&diffSuite{})
+
+func diffTestColumn(id int64, name string, tp byte, flag uint) *model.ColumnInfo {
+	col := &model.ColumnInfo{
+		ID:        id,
+		Name:      model.NewCIStr(name),
+		FieldType: *types.NewFieldType(tp),
+		State:     model.StatePublic,
+	}
+	col.Flag = flag
+	return col
+}
+
+func diffTestTable(name string, cols []*model.ColumnInfo, indices ...*model.IndexInfo) *model.TableInfo {
+	for i, col := range cols {
+		col.Offset = i
+	}
+	for _, idx := range indices {
+		for _, idxCol := range idx.Columns {
+			idxCol.Offset = model.FindColumnInfo(cols, idxCol.Name.L).Offset
+		}
+	}
+	return &model.TableInfo{ID: 10, Name: model.NewCIStr(name), Columns: cols, Indices: indices}
+}
+
+func diffTestIndex(id int64, name string, unique bool, cols ...string) *model.IndexInfo {
+	idx := &model.IndexInfo{ID: id, Name: model.NewCIStr(name), Unique: unique, State: model.StatePublic}
+	for _, col := range cols {
+		idx.Columns = append(idx.Columns, &model.IndexColumn{Name: model.NewCIStr(col)})
+	}
+	return idx
+}
+
+func (s *diffSuite) TestSame(c *C) {
+	table := diffTestTable("t1", []*model.ColumnInfo{diffTestColumn(1, "id", mysql.TypeLong, mysql.PriKeyFlag)},
+		diffTestIndex(1, "k", false, "id"))
+	table.PKIsHandle = true
+	c.Assert(DiffTableInfos(table, table).IsEmpty(), IsTrue)
+}
+
+func (s *diffSuite) TestColumns(c *C) {
+	old := diffTestTable("t1", []*model.ColumnInfo{
+		diffTestColumn(1, "id", mysql.TypeLong, mysql.NotNullFlag),
+		diffTestColumn(2, "a", mysql.TypeLong, 0),
+		diffTestColumn(3, "b", mysql.TypeVarchar, 0),
+		diffTestColumn(4, "c", mysql.TypeLong, 0),
+		diffTestColumn(5, "d", mysql.TypeLong, 0),
+	}, diffTestIndex(1, "idx_a", false, "a"), diffTestIndex(2, "idx_c", true, "c"))
+	dropping := diffTestColumn(6, "e", mysql.TypeLong, 0)
+	dropping.State = model.StateWriteOnly
+	old.Columns = append(old.Columns, dropping)
+
+	bigint := diffTestColumn(3, "b", mysql.TypeLonglong, 0)
+	bigint.Comment = "the b"
+	new := diffTestTable("t2", []*model.ColumnInfo{
+		diffTestColumn(1, "id", mysql.TypeLong, mysql.NotNullFlag),
+		diffTestColumn(7, "f", mysql.TypeLong, 0),
+		// a is renamed, b is modified, d is moved before c
+		diffTestColumn(2, "a2", mysql.TypeLong, 0),
+		bigint,
+		diffTestColumn(5, "d", mysql.TypeLong, mysql.NotNullFlag),
+	}, diffTestIndex(1, "idx_a", false, "a2"), diffTestIndex(3, "idx_f", false, "f"))
+	c.Assert(new.Columns[4].SetDefaultValue("1"), IsNil)
+
+	diff := DiffTableInfos(old, new)
+	c.Assert(diff.IsEmpty(), IsFalse)
+	c.Assert(diff.OldName, Equals, "t1")
+	c.Assert(diff.NewName, Equals, "t2")
+	c.Assert(diff.AddedColumns, HasLen, 1)
+	c.Assert(diff.AddedColumns[0].Name.O, Equals, "f")
+	// the column being dropped isn't public
+	c.Assert(diff.DroppedColumns, HasLen, 1)
+	c.Assert(diff.DroppedColumns[0].Name.O, Equals, "c")
+
+	c.Assert(diff.ModifiedColumns, HasLen, 3)
+	a, b, d := diff.ModifiedColumns[0], diff.ModifiedColumns[1], diff.ModifiedColumns[2]
+	c.Assert(a.New.Name.O, Equals, "a2")
+	c.Assert(*a, DeepEquals, ColumnDiff{Old: old.Columns[1], New: new.Columns[2], Renamed: true})
+	c.Assert(*b, DeepEquals, ColumnDiff{Old: old.Columns[2], New: new.Columns[3], TypeChanged: true, CommentChanged: true})
+	c.Assert(*d, DeepEquals, ColumnDiff{Old: old.Columns[4], New: new.Columns[4], NullChanged: true, DefaultChanged: true})
+
+	// the index on the renamed column is unchanged
+	c.Assert(diff.AddedIndices, HasLen, 1)
+	c.Assert(diff.AddedIndices[0].Name.O, Equals, "idx_f")
+	c.Assert(diff.DroppedIndices, HasLen, 1)
+	c.Assert(diff.DroppedIndices[0].Name.O, Equals, "idx_c")
+	c.Assert(diff.RenamedIndices, HasLen, 0)
+	c.Assert(diff.OldPrimaryKey, IsNil)
+	c.Assert(diff.NewPrimaryKey, IsNil)
+}
+
+func (s *diffSuite) TestMoved(c *C) {
+	old := diffTestTable("t1", []*model.ColumnInfo{
+		diffTestColumn(1, "a", mysql.TypeLong, 0),
+		diffTestColumn(2, "b", mysql.TypeLong, 0),
+		diffTestColumn(3, "c", mysql.TypeLong, 0),
+	})
+	new := diffTestTable("t1", []*model.ColumnInfo{
+		diffTestColumn(3, "c", mysql.TypeLong, 0),
+		diffTestColumn(1, "a", mysql.TypeLong, 0),
+		diffTestColumn(2, "b", mysql.TypeLong, 0),
+	})
+	diff := DiffTableInfos(old, new)
+	// c is moved first, a is after c now
+	c.Assert(diff.ModifiedColumns, HasLen, 2)
+	c.Assert(diff.ModifiedColumns[0].New.Name.O, Equals, "c")
+	c.Assert(diff.ModifiedColumns[0].Moved, IsTrue)
+	c.Assert(diff.ModifiedColumns[1].New.Name.O, Equals, "a")
+	c.Assert(diff.ModifiedColumns[1].Moved, IsTrue)
+}
+
+func (s *diffSuite) TestIndices(c *C) {
+	cols := func() []*model.ColumnInfo {
+		return []*model.ColumnInfo{
+			diffTestColumn(1, "id", mysql.TypeLong, mysql.NotNullFlag|mysql.PriKeyFlag),
+			diffTestColumn(2, "a", mysql.TypeLong, mysql.NotNullFlag),
+		}
+	}
+	old := diffTestTable("t1", cols(), diffTestIndex(1, "idx_a", false, "a"), diffTestIndex(2, "uk", true, "a"))
+	old.PKIsHandle = true
+	pk := diffTestIndex(3, "PRIMARY", true, "id", "a")
+	pk.Primary = true
+	// idx_a is renamed, uk is changed to a non-unique index and the primary
+	// key is changed
+	new := diffTestTable("t1", cols(), diffTestIndex(1, "idx_a2", false, "a"), diffTestIndex(2, "uk", false, "a"), pk)
+
+	diff := DiffTableInfos(old, new)
+	c.Assert(diff.RenamedIndices, HasLen, 1)
+	c.Assert(diff.RenamedIndices[0].Old.Name.O, Equals, "idx_a")
+	c.Assert(diff.RenamedIndices[0].New.Name.O, Equals, "idx_a2")
+	c.Assert(diff.AddedIndices, HasLen, 2)
+	c.Assert(diff.AddedIndices[0].Name.O, Equals, "uk")
+	c.Assert(diff.AddedIndices[1].Name.O, Equals, "PRIMARY")
+	c.Assert(diff.DroppedIndices, HasLen, 1)
+	c.Assert(diff.DroppedIndices[0].Name.O, Equals, "uk")
+	c.Assert(diff.OldPrimaryKey, DeepEquals, []string{"id"})
+	c.Assert(diff.NewPrimaryKey, DeepEquals, []string{"id", "a"})
+}
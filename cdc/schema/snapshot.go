@@ -0,0 +1,121 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+
+	"github.com/golang/snappy"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+)
+
+// Snapshot is the schemas and tables of the Storage after handling the DDL
+// jobs finished at or before Ts. A Storage is restored from the snapshot and
+// the jobs finished after Ts, instead of replaying all the history jobs.
+type Snapshot struct {
+	Ts                uint64 `json:"ts"`
+	SchemaVersion     int64  `json:"schema-version"`
+	SchemaMetaVersion int64  `json:"schema-meta-version"`
+
+	Schemas          []*SnapshotSchema `json:"schemas"`
+	TruncateTableIDs []int64           `json:"truncate-table-ids"`
+}
+
+// SnapshotSchema is a schema and its tables in the snapshot, the tables are
+// kept aside since DBInfo.Tables is not encoded in json.
+type SnapshotSchema struct {
+	Info   *model.DBInfo      `json:"info"`
+	Tables []*model.TableInfo `json:"tables"`
+}
+
+// Snapshot returns the snapshot of the schemas and tables of the storage, the
+// snapshot shares the infos with the storage, so it should be encoded before
+// the storage handles the next DDL job.
+func (s *Storage) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		Ts:                s.lastHandledTs,
+		SchemaVersion:     s.currentVersion,
+		SchemaMetaVersion: s.schemaMetaVersion,
+		Schemas:           make([]*SnapshotSchema, 0, len(s.schemas)),
+	}
+	for _, db := range s.schemas {
+		// the tables in DBInfo.Tables are not updated by ReplaceTable, take
+		// the latest ones from the storage
+		schema := &SnapshotSchema{Info: db, Tables: make([]*model.TableInfo, 0, len(db.Tables))}
+		for _, table := range db.Tables {
+			if info, ok := s.tables[table.ID]; ok {
+				schema.Tables = append(schema.Tables, info.TableInfo)
+			}
+		}
+		snap.Schemas = append(snap.Schemas, schema)
+	}
+	for id := range s.truncateTableID {
+		snap.TruncateTableIDs = append(snap.TruncateTableIDs, id)
+	}
+	return snap
+}
+
+// NewStorageFromSnapshot restores the Storage from the snapshot, the jobs
+// finished at or before the ts of the snapshot are skipped.
+func NewStorageFromSnapshot(snap *Snapshot, jobs []*model.Job) (*Storage, error) {
+	newJobs := make([]*model.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.BinlogInfo.FinishedTS > snap.Ts {
+			newJobs = append(newJobs, job)
+		}
+	}
+	s, err := NewStorage(newJobs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, snapSchema := range snap.Schemas {
+		db := *snapSchema.Info
+		db.Tables = nil
+		if err := s.CreateSchema(&db); err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, table := range snapSchema.Tables {
+			if err := s.CreateTable(&db, table); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	}
+	for _, id := range snap.TruncateTableIDs {
+		s.truncateTableID[id] = snap.Ts
+	}
+	s.lastHandledTs = snap.Ts
+	s.currentVersion = snap.SchemaVersion
+	s.schemaMetaVersion = snap.SchemaMetaVersion
+	return s, nil
+}
+
+// Marshal encodes the snapshot in the snappy compressed json.
+func (snap *Snapshot) Marshal() ([]byte, error) {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+// Unmarshal decodes the snapshot encoded by Marshal.
+func (snap *Snapshot) Unmarshal(data []byte) error {
+	raw, err := snappy.Decode(nil, data)
+	if err != nil {
+		return errors.Annotate(err, "decompress schema snapshot")
+	}
+	err = json.Unmarshal(raw, snap)
+	return errors.Annotate(err, "unmarshal schema snapshot")
+}
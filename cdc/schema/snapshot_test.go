@@ -0,0 +1,103 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type snapshotSuite struct{}
+
+var _ = Suite(&snapshotSuite{})
+
+func snapshotTestJobs() []*model.Job {
+	db := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	newTable := func(id int64, name string, cols ...string) *model.TableInfo {
+		table := &model.TableInfo{ID: id, Name: model.NewCIStr(name), State: model.StatePublic}
+		for i, col := range cols {
+			table.Columns = append(table.Columns, &model.ColumnInfo{
+				ID:        int64(i + 1),
+				Name:      model.NewCIStr(col),
+				Offset:    i,
+				FieldType: *types.NewFieldType(mysql.TypeLonglong),
+				State:     model.StatePublic,
+			})
+		}
+		return table
+	}
+	newJob := func(tp model.ActionType, tableID int64, version int64, ts uint64, table *model.TableInfo) *model.Job {
+		job := &model.Job{
+			ID:         version,
+			State:      model.JobStateSynced,
+			SchemaID:   db.ID,
+			TableID:    tableID,
+			Type:       tp,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: version, TableInfo: table, FinishedTS: ts},
+			Query:      tp.String(),
+		}
+		if tp == model.ActionCreateSchema {
+			job.BinlogInfo.DBInfo = db
+		}
+		return job
+	}
+	return []*model.Job{
+		newJob(model.ActionCreateSchema, 0, 1, 100, nil),
+		newJob(model.ActionCreateTable, 10, 2, 110, newTable(10, "t1", "a")),
+		newJob(model.ActionAddColumn, 10, 3, 120, newTable(10, "t1", "a", "b")),
+		newJob(model.ActionTruncateTable, 10, 4, 130, newTable(11, "t1", "a", "b")),
+		newJob(model.ActionCreateTable, 12, 5, 140, newTable(12, "t2", "a")),
+	}
+}
+
+func (s *snapshotSuite) TestRestoreSnapshot(c *C) {
+	storage, err := NewStorage(snapshotTestJobs())
+	c.Assert(err, IsNil)
+	c.Assert(storage.HandlePreviousDDLJobIfNeed(135), IsNil)
+	snap := storage.Snapshot()
+	c.Assert(snap.Ts, Equals, uint64(130))
+	c.Assert(snap.SchemaVersion, Equals, int64(4))
+	data, err := snap.Marshal()
+	c.Assert(err, IsNil)
+
+	decoded := &Snapshot{}
+	c.Assert(decoded.Unmarshal(data), IsNil)
+	c.Assert(decoded.Schemas, HasLen, 1)
+	// the altered table info is saved instead of the one in DBInfo.Tables
+	c.Assert(decoded.Schemas[0].Info.Name.O, Equals, "test")
+	c.Assert(decoded.Schemas[0].Tables, HasLen, 1)
+	c.Assert(decoded.Schemas[0].Tables[0].Columns, HasLen, 2)
+
+	restored, err := NewStorageFromSnapshot(decoded, snapshotTestJobs())
+	c.Assert(err, IsNil)
+	c.Assert(restored.HandlePreviousDDLJobIfNeed(200), IsNil)
+	replayed, err := NewStorage(snapshotTestJobs())
+	c.Assert(err, IsNil)
+	c.Assert(replayed.HandlePreviousDDLJobIfNeed(200), IsNil)
+
+	c.Assert(restored.CloneTables(), DeepEquals, replayed.CloneTables())
+	c.Assert(restored.SchemaMetaVersion(), Equals, replayed.SchemaMetaVersion())
+	c.Assert(restored.IsTruncateTableID(10), IsTrue)
+	table, ok := restored.GetTableByName("test", "t1")
+	c.Assert(ok, IsTrue)
+	c.Assert(table.ID, Equals, int64(11))
+	c.Assert(table.Columns, HasLen, 2)
+	db, ok := restored.SchemaByTableID(12)
+	c.Assert(ok, IsTrue)
+	c.Assert(db.Tables, HasLen, 2)
+
+	c.Assert((&Snapshot{}).Unmarshal([]byte("{}")), ErrorMatches, "decompress schema snapshot.*")
+}
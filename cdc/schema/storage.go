@@ -17,11 +17,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser/charset"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/types"
 	"github.com/pingcap/tidb/util/rowcodec"
 	"go.uber.org/zap"
 )
@@ -29,6 +34,8 @@ import (
 // Storage stores the source TiDB all schema infomations
 // schema infomations could be changed by drainer init and ddls appear
 type Storage struct {
+	// tableNameToID and schemaNameToID are keyed by the lower case names,
+	// the names are case-insensitive in TiDB.
 	tableIDToName  map[int64]TableName
 	tableNameToID  map[TableName]int64
 	schemaNameToID map[string]int64
@@ -36,14 +43,33 @@ type Storage struct {
 	schemas map[int64]*model.DBInfo
 	tables  map[int64]*TableInfo
 
-	truncateTableID map[int64]struct{}
+	// truncateTableID maps the IDs of the truncated tables and the removed
+	// partitions to the finished ts of the jobs removing them.
+	truncateTableID map[int64]uint64
+
+	// partitions maps the physical IDs of the partitions to the IDs of their
+	// tables. The partitions removed by the DDL jobs are kept until the
+	// versions at removedPartitions are gc'ed, so the earlier row changes of
+	// them can still be decoded.
+	partitions        map[int64]int64
+	removedPartitions map[int64]uint64
 
 	schemaMetaVersion int64
 	lastHandledTs     uint64
 
-	jobs                []*model.Job
-	version2SchemaTable map[int64]TableName
-	currentVersion      int64
+	jobs           []*model.Job
+	currentVersion int64
+
+	// the recent versions of the tables and schemas, versionTs is the
+	// finished ts of the DDL job being handled
+	tableVersions  map[int64][]tableVersion
+	schemaVersions map[int64][]schemaVersion
+	versionTs      uint64
+	// gcRetention is how long the history is retained below the checkpoint
+	// passed to DoGC.
+	gcRetention time.Duration
+	// skipUnsupportedDDL skips the DDL jobs of the unsupported types.
+	skipUnsupportedDDL bool
 }
 
 // TableName specify a Schema name and Table name
@@ -57,6 +83,60 @@ func (t TableName) String() string {
 	return fmt.Sprintf("%s.%s", t.Schema, t.Table)
 }
 
+// ParseTableName parses a name like "db.table" supplied by users, the names
+// may be quoted by backticks like "`db`.`my.table`", a backtick in a quoted
+// name is doubled.
+func ParseTableName(name string) (TableName, error) {
+	var parts []string
+	rest := strings.TrimSpace(name)
+	for {
+		var part string
+		if strings.HasPrefix(rest, "`") {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest); i++ {
+				if rest[i] != '`' {
+					b.WriteByte(rest[i])
+					continue
+				}
+				if i+1 < len(rest) && rest[i+1] == '`' {
+					b.WriteByte('`')
+					i++
+					continue
+				}
+				break
+			}
+			if i >= len(rest) {
+				return TableName{}, errors.Errorf("invalid table name %s, the backtick is not closed", name)
+			}
+			part, rest = b.String(), rest[i+1:]
+		} else {
+			i := strings.IndexByte(rest, '.')
+			if i < 0 {
+				i = len(rest)
+			}
+			part, rest = rest[:i], rest[i:]
+		}
+		parts = append(parts, part)
+		if rest == "" {
+			break
+		}
+		if rest[0] != '.' {
+			return TableName{}, errors.Errorf("invalid table name %s", name)
+		}
+		rest = rest[1:]
+	}
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return TableName{}, errors.Errorf("invalid table name %s, it should be like db.table", name)
+	}
+	return TableName{Schema: parts[0], Table: parts[1]}, nil
+}
+
+// lower returns the key of the table name in the name index.
+func (t TableName) lower() TableName {
+	return TableName{Schema: strings.ToLower(t.Schema), Table: strings.ToLower(t.Table)}
+}
+
 // TableInfo provides meta data describing a DB table.
 type TableInfo struct {
 	*model.TableInfo
@@ -64,6 +144,60 @@ type TableInfo struct {
 	IndicesOffset map[int64]int
 	handleColID   int64
 	rowColInfos   []rowcodec.ColInfo
+	physicalIDs   []int64
+
+	columnDefaults map[int64]*ColumnDefault
+	// generated is the kinds of the generated columns by name.
+	generated map[string]GeneratedKind
+	// charsets is the charsets of the text columns by name.
+	charsets map[string]ColumnCharset
+}
+
+// ColumnCharset is the charset and the collation of a text column, they are
+// the ones of the table if the column doesn't have its own.
+type ColumnCharset struct {
+	Charset   string
+	Collation string
+}
+
+// GeneratedKind is the kind of a generated column.
+type GeneratedKind int
+
+// The kinds of the generated columns
+const (
+	// NotGenerated is a column not generated.
+	NotGenerated GeneratedKind = iota
+	// GeneratedStored is a generated column stored in the rows.
+	GeneratedStored
+	// GeneratedVirtual is a generated column computed when it's read, it has
+	// no value in the rows in TiKV.
+	GeneratedVirtual
+)
+
+// String implements fmt.Stringer interface.
+func (k GeneratedKind) String() string {
+	switch k {
+	case NotGenerated:
+		return "not generated"
+	case GeneratedStored:
+		return "stored"
+	case GeneratedVirtual:
+		return "virtual"
+	default:
+		return "unknown"
+	}
+}
+
+// ColumnDefault is the default values of a column.
+type ColumnDefault struct {
+	// Default is the default value of the rows inserted without the column.
+	Default interface{}
+	// OriginDefault is the default value when the column is added, the rows
+	// written before it are read with it by TiDB.
+	OriginDefault interface{}
+	// Backfill is the value of the column of the rows written before the
+	// column is added, which have no value of the column in TiKV.
+	Backfill types.Datum
 }
 
 // WrapTableInfo creates a TableInfo from a model.TableInfo
@@ -76,11 +210,113 @@ func WrapTableInfo(info *model.TableInfo) *TableInfo {
 	for i, idx := range info.Indices {
 		indicesOffset[idx.ID] = i
 	}
+	columnDefaults := make(map[int64]*ColumnDefault, len(info.Columns))
+	generated := make(map[string]GeneratedKind)
+	charsets := make(map[string]ColumnCharset)
+	for _, col := range info.Columns {
+		columnDefaults[col.ID] = &ColumnDefault{
+			Default:       col.GetDefaultValue(),
+			OriginDefault: col.OriginDefaultValue,
+			Backfill:      backfillValue(col),
+		}
+		if col.IsGenerated() {
+			if col.GeneratedStored {
+				generated[col.Name.O] = GeneratedStored
+			} else {
+				generated[col.Name.O] = GeneratedVirtual
+			}
+		}
+		if isTextColumn(col) {
+			cs := ColumnCharset{Charset: col.Charset, Collation: col.Collate}
+			if cs.Charset == "" {
+				cs = ColumnCharset{Charset: info.Charset, Collation: info.Collate}
+			}
+			charsets[col.Name.O] = cs
+		}
+	}
 	return &TableInfo{
-		TableInfo:     info,
-		ColumnsOffset: columnsOffset,
-		IndicesOffset: indicesOffset,
+		TableInfo:      info,
+		ColumnsOffset:  columnsOffset,
+		IndicesOffset:  indicesOffset,
+		physicalIDs:    PhysicalTableIDs(info),
+		columnDefaults: columnDefaults,
+		generated:      generated,
+		charsets:       charsets,
+	}
+}
+
+// isTextColumn returns whether the column is a string column of a charset
+// other than binary, the enums and the sets are not.
+func isTextColumn(col *model.ColumnInfo) bool {
+	if !types.IsTypeChar(col.Tp) && !types.IsTypeVarchar(col.Tp) && !types.IsTypeBlob(col.Tp) {
+		return false
 	}
+	return col.Charset != charset.CharsetBin
+}
+
+// backfillValue returns the value of the column of the rows without it, which
+// are written before the column is added. TiDB doesn't write a NULL value if
+// the origin default of the column is NULL either, see
+// https://github.com/pingcap/tidb/issues/9304.
+func backfillValue(col *model.ColumnInfo) types.Datum {
+	if col.OriginDefaultValue != nil {
+		return types.NewDatum(col.OriginDefaultValue)
+	}
+	if !mysql.HasNotNullFlag(col.Flag) {
+		return types.NewDatum(nil)
+	}
+	if col.GetDefaultValue() != nil {
+		return types.NewDatum(col.GetDefaultValue())
+	}
+	if col.Tp == mysql.TypeEnum && len(col.Elems) > 0 {
+		// For enum type, if no default value and not null is set,
+		// the default value is the first element of the enum list
+		return types.NewDatum(col.Elems[0])
+	}
+	return table.GetZeroValue(col)
+}
+
+// ColumnDefault returns the default values of the column by ID.
+func (ti *TableInfo) ColumnDefault(colID int64) (*ColumnDefault, bool) {
+	d, ok := ti.columnDefaults[colID]
+	return d, ok
+}
+
+// ColumnGenerated returns the kind of the column if it's generated, the values
+// of the generated columns can't be written downstream.
+func (ti *TableInfo) ColumnGenerated(name string) GeneratedKind {
+	return ti.generated[name]
+}
+
+// ColumnCharset returns the charset of the column, ok is false if the column
+// isn't a text column.
+func (ti *TableInfo) ColumnCharset(name string) (cs ColumnCharset, ok bool) {
+	cs, ok = ti.charsets[name]
+	return
+}
+
+// HasGeneratedColumns returns whether the table has any generated column.
+func (ti *TableInfo) HasGeneratedColumns() bool {
+	return len(ti.generated) > 0
+}
+
+// PhysicalTableIDs returns the IDs of the partitions of a partitioned table,
+// or the ID of the table, the rows of the table are keyed by them in TiKV.
+func PhysicalTableIDs(info *model.TableInfo) []int64 {
+	partition := info.GetPartitionInfo()
+	if partition == nil {
+		return []int64{info.ID}
+	}
+	ids := make([]int64, len(partition.Definitions))
+	for i, def := range partition.Definitions {
+		ids[i] = def.ID
+	}
+	return ids
+}
+
+// PhysicalIDs returns the IDs the rows of the table are keyed by.
+func (ti *TableInfo) PhysicalIDs() []int64 {
+	return ti.physicalIDs
 }
 
 // GetColumnInfo returns the column info by ID
@@ -139,30 +375,94 @@ func (ti *TableInfo) WritableColumns() []*model.ColumnInfo {
 	return cols
 }
 
-// GetUniqueKeys returns all unique keys of the table as a slice of column names
-func (ti *TableInfo) GetUniqueKeys() [][]string {
-	var uniqueKeys [][]string
+// UniqueKey is a unique key of a table
+type UniqueKey struct {
+	// Name is the name of the index, it's empty for the handle column.
+	Name string
+	// Columns are the names of the columns in the order of the index.
+	Columns []string
+	// Offsets are the offsets of the columns in the table, in the order of
+	// the index.
+	Offsets []int
+	// IsHandle is true if the key is the integer handle of the rows.
+	IsHandle bool
+	// Primary is true if the key is the primary key.
+	Primary bool
+	// Nullable is true if any of the columns is nullable, the rows are unique
+	// on the key only if the values aren't NULL.
+	Nullable bool
+}
+
+// UniqueKeys returns the unique keys of the table, ordered by how safe they
+// are to identify a row downstream: the handle and the primary key first,
+// then the unique keys without nullable columns, then the ones with nullable
+// columns, which are returned only if withNullable is true.
+func (ti *TableInfo) UniqueKeys(withNullable bool) []UniqueKey {
+	var primary, notNull, nullable []UniqueKey
 	if ti.PKIsHandle {
-		for _, col := range ti.Columns {
+		for i, col := range ti.Columns {
 			if mysql.HasPriKeyFlag(col.Flag) {
-				// Prepend to make sure the primary key ends up at the front
-				uniqueKeys = [][]string{{col.Name.O}}
+				primary = append(primary, UniqueKey{
+					Columns:  []string{col.Name.O},
+					Offsets:  []int{i},
+					IsHandle: true,
+					Primary:  true,
+				})
 				break
 			}
 		}
 	}
 	for _, idx := range ti.Indices {
-		if ti.IsIndexUnique(idx) {
-			colNames := make([]string, 0, len(idx.Columns))
-			for _, col := range idx.Columns {
-				colNames = append(colNames, col.Name.O)
-			}
-			if idx.Primary {
-				uniqueKeys = append([][]string{colNames}, uniqueKeys...)
-			} else {
-				uniqueKeys = append(uniqueKeys, colNames)
-			}
+		if !idx.Primary && !idx.Unique {
+			continue
 		}
+		key := UniqueKey{
+			Name:    idx.Name.O,
+			Columns: make([]string, 0, len(idx.Columns)),
+			Offsets: make([]int, 0, len(idx.Columns)),
+			Primary: idx.Primary,
+		}
+		for _, col := range idx.Columns {
+			key.Columns = append(key.Columns, col.Name.O)
+			key.Offsets = append(key.Offsets, col.Offset)
+		}
+		switch {
+		case idx.Primary:
+			// the primary key ends up at the front
+			primary = append([]UniqueKey{key}, primary...)
+		case ti.IsIndexUnique(idx):
+			notNull = append(notNull, key)
+		default:
+			key.Nullable = true
+			nullable = append(nullable, key)
+		}
+	}
+	keys := append(primary, notNull...)
+	if withNullable {
+		keys = append(keys, nullable...)
+	}
+	return keys
+}
+
+// Replicable returns whether the rows of the table can be identified in the
+// downstream, which needs the primary key or a unique key without nullable
+// columns. The reason tells why not if the table isn't replicable.
+func (ti *TableInfo) Replicable() (ok bool, reason string) {
+	if len(ti.UniqueKeys(false)) > 0 {
+		return true, ""
+	}
+	if len(ti.UniqueKeys(true)) > 0 {
+		return false, "the unique keys of table have nullable columns"
+	}
+	return false, "table has no unique key"
+}
+
+// GetUniqueKeys returns all unique keys of the table without nullable columns
+// as a slice of column names
+func (ti *TableInfo) GetUniqueKeys() [][]string {
+	var uniqueKeys [][]string
+	for _, key := range ti.UniqueKeys(false) {
+		uniqueKeys = append(uniqueKeys, key.Columns)
 	}
 	return uniqueKeys
 }
@@ -190,9 +490,13 @@ func NewStorage(jobs []*model.Job) (*Storage, error) {
 	})
 
 	s := &Storage{
-		version2SchemaTable: make(map[int64]TableName),
-		truncateTableID:     make(map[int64]struct{}),
-		jobs:                jobs,
+		truncateTableID:   make(map[int64]uint64),
+		jobs:              jobs,
+		tableVersions:     make(map[int64][]tableVersion),
+		schemaVersions:    make(map[int64][]schemaVersion),
+		partitions:        make(map[int64]int64),
+		removedPartitions: make(map[int64]uint64),
+		gcRetention:       versionRetention,
 	}
 
 	s.tableIDToName = make(map[int64]TableName)
@@ -231,38 +535,70 @@ func (s *Storage) GetTableNameByID(id int64) (TableName, bool) {
 	return name, ok
 }
 
-// GetTableIDByName returns the tableID by table schemaName and tableName
+// GetTableIDByName returns the tableID by table schemaName and tableName, the
+// names are case-insensitive.
 func (s *Storage) GetTableIDByName(schemaName string, tableName string) (int64, bool) {
 	id, ok := s.tableNameToID[TableName{
 		Schema: schemaName,
 		Table:  tableName,
-	}]
+	}.lower()]
 	return id, ok
 }
 
 // GetTableByName queries a table by name,
 // the second returned value is false if no table with the specified name is found.
 func (s *Storage) GetTableByName(schema, table string) (info *TableInfo, ok bool) {
+	return s.TableByName(schema, table)
+}
+
+// TableByName returns the TableInfo by the schema name and the table name,
+// the names are case-insensitive.
+func (s *Storage) TableByName(schema, table string) (*TableInfo, bool) {
 	id, ok := s.GetTableIDByName(schema, table)
 	if !ok {
-		return nil, ok
+		return nil, false
 	}
 	return s.TableByID(id)
 }
 
+// SchemaByName returns the DBInfo by the schema name, the name is
+// case-insensitive.
+func (s *Storage) SchemaByName(name string) (*model.DBInfo, bool) {
+	id, ok := s.schemaNameToID[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	return s.SchemaByID(id)
+}
+
+// ResolveTable returns the TableInfo of a name like "db.table" supplied by
+// users, the names may be quoted by backticks like "`db`.`table`".
+func (s *Storage) ResolveTable(name string) (*TableInfo, error) {
+	tableName, err := ParseTableName(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	info, ok := s.TableByName(tableName.Schema, tableName.Table)
+	if !ok {
+		return nil, errors.NotFoundf("table %s", tableName)
+	}
+	return info, nil
+}
+
 // SchemaByID returns the DBInfo by schema id
 func (s *Storage) SchemaByID(id int64) (val *model.DBInfo, ok bool) {
 	val, ok = s.schemas[id]
 	return
 }
 
-// SchemaByTableID returns the schema ID by table ID
+// SchemaByTableID returns the schema ID by table ID, or by the physical ID of
+// a partition.
 func (s *Storage) SchemaByTableID(tableID int64) (*model.DBInfo, bool) {
-	tn, ok := s.tableIDToName[tableID]
+	tn, ok := s.tableIDToName[s.logicalTableID(tableID)]
 	if !ok {
 		return nil, false
 	}
-	schemaID, ok := s.schemaNameToID[tn.Schema]
+	schemaID, ok := s.schemaNameToID[strings.ToLower(tn.Schema)]
 	if !ok {
 		return nil, false
 	}
@@ -275,6 +611,51 @@ func (s *Storage) TableByID(id int64) (val *TableInfo, ok bool) {
 	return
 }
 
+// IsTableReplicable returns whether the table is replicable, and the reason if
+// it's not, see TableInfo.Replicable.
+func (s *Storage) IsTableReplicable(id int64) (ok bool, reason string, err error) {
+	info, exist := s.TableByID(id)
+	if !exist {
+		return false, "", errors.NotFoundf("table %d", id)
+	}
+	ok, reason = info.Replicable()
+	return ok, reason, nil
+}
+
+// logicalTableID returns the ID of the table if id is the physical ID of a
+// partition, otherwise id itself.
+func (s *Storage) logicalTableID(id int64) int64 {
+	if tableID, ok := s.partitions[id]; ok {
+		return tableID
+	}
+	return id
+}
+
+// updatePartitions maps the partitions of table to it, and unmaps the
+// partitions of old not in table, either of them can be nil.
+func (s *Storage) updatePartitions(old, table *model.TableInfo) {
+	if table != nil && table.GetPartitionInfo() != nil {
+		for _, id := range PhysicalTableIDs(table) {
+			s.partitions[id] = table.ID
+			delete(s.removedPartitions, id)
+		}
+	}
+	if old == nil || old.GetPartitionInfo() == nil {
+		return
+	}
+	removed := PhysicalTableIDs(old)
+	if table != nil {
+		removed = removedPartitions(old, table)
+	}
+	for _, id := range removed {
+		if s.versionTs == 0 {
+			delete(s.partitions, id)
+		} else {
+			s.removedPartitions[id] = s.versionTs
+		}
+	}
+}
+
 // DropSchema deletes the given DBInfo
 func (s *Storage) DropSchema(id int64) (string, error) {
 	schema, ok := s.schemas[id]
@@ -282,15 +663,20 @@ func (s *Storage) DropSchema(id int64) (string, error) {
 		return "", errors.NotFoundf("schema %d", id)
 	}
 
+	s.seedSchemaVersion(id)
 	for _, table := range schema.Tables {
+		s.seedTableVersion(table.ID)
+		s.updatePartitions(table, nil)
 		delete(s.tables, table.ID)
-		tableName := s.tableIDToName[table.ID]
-		delete(s.tableIDToName, table.ID)
-		delete(s.tableNameToID, tableName)
+		s.removeTableName(table.ID)
+		s.saveTableVersion(table.ID)
 	}
 
 	delete(s.schemas, id)
-	delete(s.schemaNameToID, schema.Name.O)
+	if s.schemaNameToID[schema.Name.L] == id {
+		delete(s.schemaNameToID, schema.Name.L)
+	}
+	s.saveSchemaVersion(id)
 
 	return schema.Name.O, nil
 }
@@ -302,7 +688,8 @@ func (s *Storage) CreateSchema(db *model.DBInfo) error {
 	}
 
 	s.schemas[db.ID] = db
-	s.schemaNameToID[db.Name.O] = db.ID
+	s.schemaNameToID[db.Name.L] = db.ID
+	s.saveSchemaVersion(db.ID)
 
 	log.Debug("create schema failed, schema id", zap.String("name", db.Name.O), zap.Int64("id", db.ID))
 	return nil
@@ -314,15 +701,16 @@ func (s *Storage) DropTable(id int64) (string, error) {
 	if !ok {
 		return "", errors.NotFoundf("table %d", id)
 	}
+	s.seedTableVersion(id)
 	err := s.removeTable(id)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
 
+	s.updatePartitions(table.TableInfo, nil)
 	delete(s.tables, id)
-	tableName := s.tableIDToName[id]
-	delete(s.tableIDToName, id)
-	delete(s.tableNameToID, tableName)
+	s.removeTableName(id)
+	s.saveTableVersion(id)
 
 	log.Debug("drop table success", zap.String("name", table.Name.O), zap.Int64("id", id))
 	return table.Name.O, nil
@@ -336,9 +724,12 @@ func (s *Storage) CreateTable(schema *model.DBInfo, table *model.TableInfo) erro
 	}
 
 	schema.Tables = append(schema.Tables, table)
+	s.updatePartitions(nil, table)
 	s.tables[table.ID] = WrapTableInfo(table)
-	s.tableIDToName[table.ID] = TableName{Schema: schema.Name.O, Table: table.Name.O}
-	s.tableNameToID[s.tableIDToName[table.ID]] = table.ID
+	name := TableName{Schema: schema.Name.O, Table: table.Name.O}
+	s.tableIDToName[table.ID] = name
+	s.tableNameToID[name.lower()] = table.ID
+	s.saveTableVersion(table.ID)
 
 	log.Debug("create table success", zap.String("name", schema.Name.O+"."+table.Name.O), zap.Int64("id", table.ID))
 	return nil
@@ -346,16 +737,32 @@ func (s *Storage) CreateTable(schema *model.DBInfo, table *model.TableInfo) erro
 
 // ReplaceTable replace the table by new tableInfo
 func (s *Storage) ReplaceTable(table *model.TableInfo) error {
-	_, ok := s.tables[table.ID]
+	old, ok := s.tables[table.ID]
 	if !ok {
 		return errors.NotFoundf("table %s(%d)", table.Name, table.ID)
 	}
 
+	s.seedTableVersion(table.ID)
+	s.updatePartitions(old.TableInfo, table)
 	s.tables[table.ID] = WrapTableInfo(table)
+	s.saveTableVersion(table.ID)
 
 	return nil
 }
 
+// removeTableName removes the name of the table from the name index, unless
+// the name is taken by another table.
+func (s *Storage) removeTableName(tableID int64) {
+	name, ok := s.tableIDToName[tableID]
+	if !ok {
+		return
+	}
+	delete(s.tableIDToName, tableID)
+	if s.tableNameToID[name.lower()] == tableID {
+		delete(s.tableNameToID, name.lower())
+	}
+}
+
 func (s *Storage) removeTable(tableID int64) error {
 	schema, ok := s.SchemaByTableID(tableID)
 	if !ok {
@@ -411,6 +818,91 @@ func (s *Storage) HandlePreviousDDLJobIfNeed(commitTs uint64) error {
 	return nil
 }
 
+// ErrUnsupportedDDL is returned by HandleDDL for the DDL jobs of the types not
+// in the dispatch table, like the types introduced by the newer TiDB.
+var ErrUnsupportedDDL = errors.New("unsupported ddl type")
+
+// ddlHandler applies the DDL job to the storage, and returns the names of the
+// schema and the table changed by it.
+type ddlHandler func(s *Storage, job *model.Job) (schemaName string, tableName string, err error)
+
+// ddlHandlers dispatches the DDL jobs by their types, every type known by the
+// parser must be in it, the others are unsupported.
+var ddlHandlers = map[model.ActionType]ddlHandler{
+	model.ActionCreateSchema:                  (*Storage).handleCreateSchema,
+	model.ActionDropSchema:                    (*Storage).handleDropSchema,
+	model.ActionModifySchemaCharsetAndCollate: (*Storage).handleModifySchema,
+
+	model.ActionCreateTable:    (*Storage).handleCreateTable,
+	model.ActionCreateView:     (*Storage).handleCreateTable,
+	model.ActionCreateSequence: (*Storage).handleCreateTable,
+	model.ActionRecoverTable:   (*Storage).handleCreateTable,
+	model.ActionDropTable:      (*Storage).handleDropTable,
+	model.ActionDropView:       (*Storage).handleDropTable,
+	model.ActionDropSequence:   (*Storage).handleDropTable,
+	model.ActionRenameTable:    (*Storage).handleRenameTable,
+	model.ActionTruncateTable:  (*Storage).handleTruncateTable,
+
+	model.ActionDropTablePartition:     (*Storage).handleRemovePartition,
+	model.ActionTruncateTablePartition: (*Storage).handleRemovePartition,
+
+	// the DDLs changing a table in place replace the table info
+	model.ActionAddColumn:                    (*Storage).handleReplaceTable,
+	model.ActionDropColumn:                   (*Storage).handleReplaceTable,
+	model.ActionModifyColumn:                 (*Storage).handleReplaceTable,
+	model.ActionSetDefaultValue:              (*Storage).handleReplaceTable,
+	model.ActionAddIndex:                     (*Storage).handleReplaceTable,
+	model.ActionDropIndex:                    (*Storage).handleReplaceTable,
+	model.ActionRenameIndex:                  (*Storage).handleReplaceTable,
+	model.ActionAddPrimaryKey:                (*Storage).handleReplaceTable,
+	model.ActionDropPrimaryKey:               (*Storage).handleReplaceTable,
+	model.ActionAddForeignKey:                (*Storage).handleReplaceTable,
+	model.ActionDropForeignKey:               (*Storage).handleReplaceTable,
+	model.ActionRebaseAutoID:                 (*Storage).handleReplaceTable,
+	model.ActionShardRowID:                   (*Storage).handleReplaceTable,
+	model.ActionModifyTableComment:           (*Storage).handleReplaceTable,
+	model.ActionModifyTableCharsetAndCollate: (*Storage).handleReplaceTable,
+	model.ActionAddTablePartition:            (*Storage).handleReplaceTable,
+	model.ActionLockTable:                    (*Storage).handleReplaceTable,
+	model.ActionUnlockTable:                  (*Storage).handleReplaceTable,
+	model.ActionRepairTable:                  (*Storage).handleReplaceTable,
+	model.ActionSetTiFlashReplica:            (*Storage).handleReplaceTable,
+	model.ActionUpdateTiFlashReplicaStatus:   (*Storage).handleReplaceTable,
+	model.ActionAlterSequence:                (*Storage).handleReplaceTable,
+}
+
+// IsDDLSupported tells whether the DDL jobs of the type are handled by the
+// storage.
+func IsDDLSupported(tp model.ActionType) bool {
+	_, ok := ddlHandlers[tp]
+	return ok
+}
+
+// internalDDLTypes are the types of the DDL jobs only meaningful to the
+// upstream cluster, like setting the TiFlash replicas of a table. They change
+// the table infos in the storage, but they are never executed downstream, and
+// they may have no query.
+var internalDDLTypes = map[model.ActionType]struct{}{
+	model.ActionSetTiFlashReplica:          {},
+	model.ActionUpdateTiFlashReplicaStatus: {},
+	model.ActionLockTable:                  {},
+	model.ActionUnlockTable:                {},
+}
+
+// IsDDLInternal tells whether the DDL jobs of the type are internal to the
+// upstream cluster, HandleDDL returns no query for them.
+func IsDDLInternal(tp model.ActionType) bool {
+	_, ok := internalDDLTypes[tp]
+	return ok
+}
+
+// SetSkipUnsupportedDDL makes HandleDDL skip the DDL jobs of the unsupported
+// types with a warning instead of returning ErrUnsupportedDDL, the schemas are
+// not changed by them.
+func (s *Storage) SetSkipUnsupportedDDL(skip bool) {
+	s.skipUnsupportedDDL = skip
+}
+
 // HandleDDL has four return values,
 // the first value[string]: the schema name
 // the second value[string]: the table name
@@ -424,164 +916,239 @@ func (s *Storage) HandleDDL(job *model.Job) (schemaName string, tableName string
 	}
 
 	sql = job.Query
-	if sql == "" {
+	internal := IsDDLInternal(job.Type)
+	if sql == "" && !internal {
 		return "", "", "", errors.Errorf("[ddl job sql miss]%+v", job)
 	}
 
-	switch job.Type {
-	case model.ActionCreateSchema:
-		// get the DBInfo from job rawArgs
-		schema := job.BinlogInfo.DBInfo
-
-		err := s.CreateSchema(schema)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
+	handle, ok := ddlHandlers[job.Type]
+	if !ok {
+		if !s.skipUnsupportedDDL {
+			return "", "", "", errors.Annotatef(ErrUnsupportedDDL, "type %d of job %d, query: %s", job.Type, job.ID, job.Query)
 		}
+		log.Warn("skip the DDL job of the unsupported type", zap.Int("type", int(job.Type)),
+			zap.Int64("job id", job.ID), zap.String("query", job.Query))
+		s.lastHandledTs = job.BinlogInfo.FinishedTS
+		return "", "", "", nil
+	}
 
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: ""}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = schema.Name.O
+	s.versionTs = job.BinlogInfo.FinishedTS
+	defer func() {
+		s.versionTs = 0
+	}()
 
-	case model.ActionModifySchemaCharsetAndCollate:
-		db := job.BinlogInfo.DBInfo
-		if _, ok := s.schemas[db.ID]; !ok {
-			return "", "", "", errors.NotFoundf("schema %s(%d)", db.Name, db.ID)
-		}
+	schemaName, tableName, err = handle(s, job)
+	if err != nil {
+		return "", "", "", errors.Trace(err)
+	}
+	s.currentVersion = job.BinlogInfo.SchemaVersion
+	s.lastHandledTs = job.BinlogInfo.FinishedTS
+	if internal {
+		return schemaName, tableName, "", nil
+	}
+	return schemaName, tableName, sql, nil
+}
 
-		s.schemas[db.ID] = db
-		s.schemaNameToID[db.Name.O] = db.ID
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: db.Name.O, Table: ""}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = db.Name.O
+func (s *Storage) handleCreateSchema(job *model.Job) (string, string, error) {
+	// get the DBInfo from job rawArgs
+	schema := job.BinlogInfo.DBInfo
+	if err := s.CreateSchema(schema); err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return schema.Name.O, "", nil
+}
 
-	case model.ActionDropSchema:
-		schemaName, err = s.DropSchema(job.SchemaID)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
-		}
+func (s *Storage) handleModifySchema(job *model.Job) (string, string, error) {
+	db := job.BinlogInfo.DBInfo
+	if _, ok := s.schemas[db.ID]; !ok {
+		return "", "", errors.NotFoundf("schema %s(%d)", db.Name, db.ID)
+	}
 
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schemaName, Table: ""}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
+	s.seedSchemaVersion(db.ID)
+	// the tables are not in the DBInfo of the job
+	db.Tables = s.schemas[db.ID].Tables
+	s.schemas[db.ID] = db
+	s.schemaNameToID[db.Name.L] = db.ID
+	s.saveSchemaVersion(db.ID)
+	return db.Name.O, "", nil
+}
 
-	case model.ActionRenameTable:
-		// ignore schema doesn't support reanme ddl
-		_, ok := s.SchemaByTableID(job.TableID)
-		if !ok {
-			return "", "", "", errors.NotFoundf("table(%d) or it's schema", job.TableID)
-		}
-		// first drop the table
-		_, err := s.DropTable(job.TableID)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
-		}
-		// create table
-		table := job.BinlogInfo.TableInfo
-		schema, ok := s.SchemaByID(job.SchemaID)
-		if !ok {
-			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
-		}
+func (s *Storage) handleDropSchema(job *model.Job) (string, string, error) {
+	schemaName, err := s.DropSchema(job.SchemaID)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return schemaName, "", nil
+}
 
-		err = s.CreateTable(schema, table)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
-		}
+func (s *Storage) handleRenameTable(job *model.Job) (string, string, error) {
+	// ignore schema doesn't support reanme ddl
+	_, ok := s.SchemaByTableID(job.TableID)
+	if !ok {
+		return "", "", errors.NotFoundf("table(%d) or it's schema", job.TableID)
+	}
+	// first drop the table
+	_, err := s.DropTable(job.TableID)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	// create table
+	table := job.BinlogInfo.TableInfo
+	schema, ok := s.SchemaByID(job.SchemaID)
+	if !ok {
+		return "", "", errors.NotFoundf("schema %d", job.SchemaID)
+	}
 
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = schema.Name.O
-		tableName = table.Name.O
+	err = s.CreateTable(schema, table)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return schema.Name.O, table.Name.O, nil
+}
 
-	case model.ActionCreateTable, model.ActionCreateView, model.ActionRecoverTable:
-		table := job.BinlogInfo.TableInfo
-		if table == nil {
-			return "", "", "", errors.NotFoundf("table %d", job.TableID)
-		}
+func (s *Storage) handleCreateTable(job *model.Job) (string, string, error) {
+	table := job.BinlogInfo.TableInfo
+	if table == nil {
+		return "", "", errors.NotFoundf("table %d", job.TableID)
+	}
 
-		schema, ok := s.SchemaByID(job.SchemaID)
-		if !ok {
-			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
-		}
+	schema, ok := s.SchemaByID(job.SchemaID)
+	if !ok {
+		return "", "", errors.NotFoundf("schema %d", job.SchemaID)
+	}
 
-		err := s.CreateTable(schema, table)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
+	// CREATE OR REPLACE VIEW and ALTER VIEW replace the view by a new ID
+	if job.Type == model.ActionCreateView {
+		if id, ok := s.GetTableIDByName(schema.Name.O, table.Name.O); ok && id != table.ID {
+			if _, err := s.DropTable(id); err != nil {
+				return "", "", errors.Trace(err)
+			}
 		}
+	}
 
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = schema.Name.O
-		tableName = table.Name.O
+	err := s.CreateTable(schema, table)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return schema.Name.O, table.Name.O, nil
+}
 
-	case model.ActionDropTable, model.ActionDropView:
-		schema, ok := s.SchemaByID(job.SchemaID)
-		if !ok {
-			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
-		}
+func (s *Storage) handleDropTable(job *model.Job) (string, string, error) {
+	schema, ok := s.SchemaByID(job.SchemaID)
+	if !ok {
+		return "", "", errors.NotFoundf("schema %d", job.SchemaID)
+	}
 
-		tableName, err = s.DropTable(job.TableID)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
-		}
+	tableName, err := s.DropTable(job.TableID)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return schema.Name.O, tableName, nil
+}
 
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: tableName}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = schema.Name.O
+func (s *Storage) handleTruncateTable(job *model.Job) (string, string, error) {
+	schema, ok := s.SchemaByID(job.SchemaID)
+	if !ok {
+		return "", "", errors.NotFoundf("schema %d", job.SchemaID)
+	}
 
-	case model.ActionTruncateTable:
-		schema, ok := s.SchemaByID(job.SchemaID)
-		if !ok {
-			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
+	// job.TableID is the old table id, different from table.ID
+	old, ok := s.tables[job.TableID]
+	if !ok {
+		return "", "", errors.NotFoundf("table %d", job.TableID)
+	}
+	_, err := s.DropTable(job.TableID)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	if old.GetPartitionInfo() != nil {
+		for _, id := range old.PhysicalIDs() {
+			s.truncateTableID[id] = job.BinlogInfo.FinishedTS
 		}
+	}
 
-		// job.TableID is the old table id, different from table.ID
-		_, err := s.DropTable(job.TableID)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
-		}
+	table := job.BinlogInfo.TableInfo
+	if table == nil {
+		return "", "", errors.NotFoundf("table %d", job.TableID)
+	}
 
-		table := job.BinlogInfo.TableInfo
-		if table == nil {
-			return "", "", "", errors.NotFoundf("table %d", job.TableID)
-		}
+	err = s.CreateTable(schema, table)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	s.truncateTableID[job.TableID] = job.BinlogInfo.FinishedTS
+	return schema.Name.O, table.Name.O, nil
+}
 
-		err = s.CreateTable(schema, table)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
+func (s *Storage) handleRemovePartition(job *model.Job) (string, string, error) {
+	// the rows of the removed partitions are skipped like the rows of the
+	// truncated tables, the partitions are updated like the other changes
+	// of the table
+	if old, ok := s.tables[job.TableID]; ok && job.BinlogInfo != nil && job.BinlogInfo.TableInfo != nil {
+		for _, id := range removedPartitions(old.TableInfo, job.BinlogInfo.TableInfo) {
+			s.truncateTableID[id] = job.BinlogInfo.FinishedTS
 		}
+	}
+	return s.handleReplaceTable(job)
+}
 
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = schema.Name.O
-		tableName = table.Name.O
-		s.truncateTableID[job.TableID] = struct{}{}
+func (s *Storage) handleReplaceTable(job *model.Job) (string, string, error) {
+	binlogInfo := job.BinlogInfo
+	if binlogInfo == nil {
+		return "", "", errors.NotFoundf("table %d", job.TableID)
+	}
+	tbInfo := binlogInfo.TableInfo
+	if tbInfo == nil {
+		return "", "", errors.NotFoundf("table %d", job.TableID)
+	}
 
-	default:
-		binlogInfo := job.BinlogInfo
-		if binlogInfo == nil {
-			return "", "", "", errors.NotFoundf("table %d", job.TableID)
-		}
-		tbInfo := binlogInfo.TableInfo
-		if tbInfo == nil {
-			return "", "", "", errors.NotFoundf("table %d", job.TableID)
+	schema, ok := s.SchemaByID(job.SchemaID)
+	if !ok {
+		return "", "", errors.NotFoundf("schema %d", job.SchemaID)
+	}
+
+	err := s.ReplaceTable(tbInfo)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return schema.Name.O, tbInfo.Name.O, nil
+}
+
+// removedPartitions returns the physical IDs of the partitions of old not in
+// table.
+func removedPartitions(old, table *model.TableInfo) []int64 {
+	ids := make(map[int64]struct{})
+	for _, id := range PhysicalTableIDs(table) {
+		ids[id] = struct{}{}
+	}
+	var removed []int64
+	for _, id := range PhysicalTableIDs(old) {
+		if _, ok := ids[id]; !ok {
+			removed = append(removed, id)
 		}
+	}
+	return removed
+}
 
-		schema, ok := s.SchemaByID(job.SchemaID)
+// ClonePhysicalTables returns the existing tables by the IDs their rows are
+// keyed by, a partitioned table is returned by each of its partitions. The
+// views and sequences have no rows to replicate, they are not returned.
+func (s *Storage) ClonePhysicalTables() map[uint64]TableName {
+	mp := make(map[uint64]TableName, len(s.tableIDToName))
+	for id, table := range s.tableIDToName {
+		info, ok := s.tables[id]
 		if !ok {
-			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
+			mp[uint64(id)] = table
+			continue
 		}
-
-		err := s.ReplaceTable(tbInfo)
-		if err != nil {
-			return "", "", "", errors.Trace(err)
+		if info.IsView() || info.IsSequence() {
+			continue
+		}
+		for _, physicalID := range info.PhysicalIDs() {
+			mp[uint64(physicalID)] = table
 		}
-
-		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: tbInfo.Name.O}
-		s.currentVersion = job.BinlogInfo.SchemaVersion
-		schemaName = schema.Name.O
-		tableName = tbInfo.Name.O
 	}
-	s.lastHandledTs = job.BinlogInfo.FinishedTS
-	return
+	return mp
 }
 
 // CloneTables return a clone of the existing tables.
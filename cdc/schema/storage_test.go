@@ -16,6 +16,7 @@ package schema
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
@@ -486,3 +487,462 @@ func (s *getUniqueKeysSuite) TestPKShouldBeInTheFirstPlaceWhenPKIsHandle(c *C) {
 		{"uid"}, {"job"},
 	})
 }
+
+func (s *getUniqueKeysSuite) TestNullableUniqueKeys(c *C) {
+	t := model.TableInfo{
+		Columns: []*model.ColumnInfo{
+			{Name: model.CIStr{O: "id"}, FieldType: parser_types.FieldType{Flag: mysql.PriKeyFlag | mysql.NotNullFlag}},
+			{Name: model.CIStr{O: "a"}},
+			{Name: model.CIStr{O: "b"}, FieldType: parser_types.FieldType{Flag: mysql.NotNullFlag}},
+		},
+		Indices: []*model.IndexInfo{
+			{
+				Name:    model.CIStr{O: "uniq_a_b"},
+				Columns: []*model.IndexColumn{{Name: model.CIStr{O: "b"}, Offset: 2}, {Name: model.CIStr{O: "a"}, Offset: 1}},
+				Unique:  true,
+			},
+			{
+				Name:    model.CIStr{O: "uniq_b"},
+				Columns: []*model.IndexColumn{{Name: model.CIStr{O: "b"}, Offset: 2}},
+				Unique:  true,
+			},
+		},
+		PKIsHandle: true,
+	}
+	info := WrapTableInfo(&t)
+	c.Assert(info.GetUniqueKeys(), DeepEquals, [][]string{{"id"}, {"b"}})
+	c.Assert(info.UniqueKeys(false), HasLen, 2)
+	c.Assert(info.UniqueKeys(true), DeepEquals, []UniqueKey{
+		{Columns: []string{"id"}, Offsets: []int{0}, IsHandle: true, Primary: true},
+		{Name: "uniq_b", Columns: []string{"b"}, Offsets: []int{2}},
+		{Name: "uniq_a_b", Columns: []string{"b", "a"}, Offsets: []int{2, 1}, Nullable: true},
+	})
+}
+
+func (t *schemaSuite) TestColumnGenerated(c *C) {
+	info := WrapTableInfo(&model.TableInfo{
+		Columns: []*model.ColumnInfo{
+			{Name: model.NewCIStr("a"), State: model.StatePublic},
+			{Name: model.NewCIStr("b"), State: model.StatePublic, GeneratedExprString: "`a` + 1", GeneratedStored: true},
+			{Name: model.NewCIStr("c"), State: model.StatePublic, GeneratedExprString: "`a` + 2"},
+		},
+	})
+	c.Assert(info.HasGeneratedColumns(), IsTrue)
+	c.Assert(info.ColumnGenerated("a"), Equals, NotGenerated)
+	c.Assert(info.ColumnGenerated("b"), Equals, GeneratedStored)
+	c.Assert(info.ColumnGenerated("c"), Equals, GeneratedVirtual)
+	c.Assert(info.ColumnGenerated("d"), Equals, NotGenerated)
+	c.Assert(info.WritableColumns(), HasLen, 1)
+
+	info = WrapTableInfo(&model.TableInfo{Columns: []*model.ColumnInfo{{Name: model.NewCIStr("a")}}})
+	c.Assert(info.HasGeneratedColumns(), IsFalse)
+}
+
+func (t *schemaSuite) TestColumnCharset(c *C) {
+	info := WrapTableInfo(&model.TableInfo{
+		Charset: "utf8mb4",
+		Collate: "utf8mb4_bin",
+		Columns: []*model.ColumnInfo{
+			{Name: model.NewCIStr("a"), FieldType: parser_types.FieldType{Tp: mysql.TypeVarchar, Charset: "gbk", Collate: "gbk_chinese_ci"}},
+			{Name: model.NewCIStr("b"), FieldType: parser_types.FieldType{Tp: mysql.TypeBlob}},
+			{Name: model.NewCIStr("c"), FieldType: parser_types.FieldType{Tp: mysql.TypeBlob, Charset: "binary"}},
+			{Name: model.NewCIStr("d"), FieldType: parser_types.FieldType{Tp: mysql.TypeLong}},
+		},
+	})
+	cs, ok := info.ColumnCharset("a")
+	c.Assert(ok, IsTrue)
+	c.Assert(cs, Equals, ColumnCharset{Charset: "gbk", Collation: "gbk_chinese_ci"})
+	cs, ok = info.ColumnCharset("b")
+	c.Assert(ok, IsTrue)
+	c.Assert(cs, Equals, ColumnCharset{Charset: "utf8mb4", Collation: "utf8mb4_bin"})
+	for _, name := range []string{"c", "d", "e"} {
+		_, ok = info.ColumnCharset(name)
+		c.Assert(ok, IsFalse, Commentf("%s", name))
+	}
+}
+
+func (t *schemaSuite) TestIsTableReplicable(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	db := &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}
+	c.Assert(storage.CreateSchema(db), IsNil)
+
+	uniqueIndex := func(name string, offset int) *model.IndexInfo {
+		return &model.IndexInfo{
+			Name:    model.NewCIStr("uniq_" + name),
+			Columns: []*model.IndexColumn{{Name: model.NewCIStr(name), Offset: offset}},
+			Unique:  true,
+		}
+	}
+	columns := []*model.ColumnInfo{
+		{ID: 1, Name: model.NewCIStr("a"), FieldType: parser_types.FieldType{Flag: mysql.NotNullFlag}},
+		{ID: 2, Name: model.NewCIStr("b")},
+	}
+	tables := []*model.TableInfo{
+		{ID: 2, Name: model.NewCIStr("t_key"), Columns: columns, Indices: []*model.IndexInfo{uniqueIndex("a", 0)}},
+		{ID: 3, Name: model.NewCIStr("t_nullable"), Columns: columns, Indices: []*model.IndexInfo{uniqueIndex("b", 1)}},
+		{ID: 4, Name: model.NewCIStr("t_none"), Columns: columns},
+	}
+	for _, table := range tables {
+		c.Assert(storage.CreateTable(db, table), IsNil)
+	}
+
+	ok, reason, err := storage.IsTableReplicable(2)
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(reason, Equals, "")
+	ok, reason, err = storage.IsTableReplicable(3)
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsFalse)
+	c.Assert(reason, Matches, ".*nullable.*")
+	ok, reason, err = storage.IsTableReplicable(4)
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsFalse)
+	c.Assert(reason, Matches, ".*no unique key.*")
+	_, _, err = storage.IsTableReplicable(5)
+	c.Assert(errors.IsNotFound(err), IsTrue)
+}
+
+func partitionTestTable(ids ...int64) *model.TableInfo {
+	table := versionTestTable("t", "a")
+	table.Partition = &model.PartitionInfo{Enable: true}
+	for _, id := range ids {
+		table.Partition.Definitions = append(table.Partition.Definitions, model.PartitionDefinition{ID: id})
+	}
+	return table
+}
+
+func (t *schemaSuite) TestPartitions(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	for _, job := range []*model.Job{
+		versionTestJob(model.ActionCreateSchema, versionTs(1000), nil),
+		versionTestJob(model.ActionCreateTable, versionTs(2000), partitionTestTable(101, 102)),
+	} {
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	name := TableName{Schema: "test", Table: "t"}
+	c.Assert(storage.ClonePhysicalTables(), DeepEquals, map[uint64]TableName{101: name, 102: name})
+	c.Assert(storage.CloneTables(), DeepEquals, map[uint64]TableName{10: name})
+	info, ok := storage.TableByIDAt(101, versionTs(2000))
+	c.Assert(ok, IsTrue)
+	c.Assert(info.ID, Equals, int64(10))
+	c.Assert(info.PhysicalIDs(), DeepEquals, []int64{101, 102})
+	tableName, ok := storage.TableNameByIDAt(102, versionTs(2000))
+	c.Assert(ok, IsTrue)
+	c.Assert(tableName, Equals, name)
+	db, ok := storage.SchemaByTableID(102)
+	c.Assert(ok, IsTrue)
+	c.Assert(db.Name.O, Equals, "test")
+
+	for _, job := range []*model.Job{
+		versionTestJob(model.ActionTruncateTablePartition, versionTs(3000), partitionTestTable(101, 103)),
+		versionTestJob(model.ActionAddTablePartition, versionTs(4000), partitionTestTable(101, 103, 104)),
+		versionTestJob(model.ActionDropTablePartition, versionTs(5000), partitionTestTable(103, 104)),
+	} {
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(storage.ClonePhysicalTables(), DeepEquals, map[uint64]TableName{103: name, 104: name})
+	// the earlier rows of the removed partitions are still decoded, and the
+	// later rows are skipped
+	_, ok = storage.TableByIDAt(102, versionTs(2500))
+	c.Assert(ok, IsTrue)
+	c.Assert(storage.IsTruncateTableID(102), IsTrue)
+	c.Assert(storage.IsTruncateTableID(101), IsTrue)
+	c.Assert(storage.IsTruncateTableID(103), IsFalse)
+	info, ok = storage.TableByIDAt(104, versionTs(5000))
+	c.Assert(ok, IsTrue)
+	c.Assert(info.PhysicalIDs(), DeepEquals, []int64{103, 104})
+
+	// the removed partitions are forgotten after the retention
+	storage.DoGC(versionTs(5000 + int64(versionRetention/time.Millisecond)))
+	_, ok = storage.TableByIDAt(102, versionTs(2500))
+	c.Assert(ok, IsFalse)
+	c.Assert(storage.partitions, DeepEquals, map[int64]int64{103: 10, 104: 10})
+
+	_, _, _, err = storage.HandleDDL(versionTestJob(model.ActionDropTable, versionTs(700000), nil))
+	c.Assert(err, IsNil)
+	c.Assert(storage.ClonePhysicalTables(), HasLen, 0)
+	_, ok = storage.SchemaByTableID(103)
+	c.Assert(ok, IsFalse)
+}
+
+func (t *schemaSuite) TestViewsAndSequences(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	objectJob := func(tp model.ActionType, ms int64, id int64, name string) *model.Job {
+		var table *model.TableInfo
+		if name != "" {
+			table = &model.TableInfo{ID: id, Name: model.NewCIStr(name), State: model.StatePublic}
+			switch tp {
+			case model.ActionCreateView:
+				table.View = &model.ViewInfo{}
+			case model.ActionCreateSequence, model.ActionAlterSequence:
+				table.Sequence = &model.SequenceInfo{Start: 1}
+			}
+		}
+		job := versionTestJob(tp, versionTs(ms), table)
+		job.TableID = id
+		return job
+	}
+	for _, job := range []*model.Job{
+		versionTestJob(model.ActionCreateSchema, versionTs(1000), nil),
+		versionTestJob(model.ActionCreateTable, versionTs(2000), versionTestTable("t", "a")),
+		objectJob(model.ActionCreateView, 3000, 20, "v"),
+		objectJob(model.ActionCreateSequence, 4000, 30, "s"),
+		objectJob(model.ActionAlterSequence, 5000, 30, "s"),
+	} {
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	// the views and sequences are tracked but not replicated
+	c.Assert(storage.CloneTables(), HasLen, 3)
+	c.Assert(storage.ClonePhysicalTables(), DeepEquals, map[uint64]TableName{10: {Schema: "test", Table: "t"}})
+
+	// CREATE OR REPLACE VIEW replaces the view by a new ID
+	_, table, _, err := storage.HandleDDL(objectJob(model.ActionCreateView, 6000, 21, "v"))
+	c.Assert(err, IsNil)
+	c.Assert(table, Equals, "v")
+	_, ok := storage.TableByID(20)
+	c.Assert(ok, IsFalse)
+	id, ok := storage.GetTableIDByName("test", "v")
+	c.Assert(ok, IsTrue)
+	c.Assert(id, Equals, int64(21))
+
+	for _, job := range []*model.Job{
+		objectJob(model.ActionDropView, 7000, 21, ""),
+		objectJob(model.ActionDropSequence, 8000, 30, ""),
+	} {
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(storage.CloneTables(), DeepEquals, map[uint64]TableName{10: {Schema: "test", Table: "t"}})
+}
+
+func (t *schemaSuite) TestColumnDefault(c *C) {
+	newCol := func(id int64, name string, tp byte, flag uint) *model.ColumnInfo {
+		col := &model.ColumnInfo{ID: id, Name: model.NewCIStr(name), FieldType: *types.NewFieldType(tp), State: model.StatePublic}
+		col.Flag = flag
+		return col
+	}
+	nullable := newCol(1, "a", mysql.TypeLong, 0)
+	// the column is added with default 1 and the default is changed to 2
+	added := newCol(2, "b", mysql.TypeLong, 0)
+	c.Assert(added.SetDefaultValue("2"), IsNil)
+	added.OriginDefaultValue = "1"
+	notNull := newCol(3, "c", mysql.TypeLong, mysql.NotNullFlag)
+	c.Assert(notNull.SetDefaultValue("3"), IsNil)
+	enum := newCol(4, "d", mysql.TypeEnum, mysql.NotNullFlag)
+	enum.Elems = []string{"x", "y"}
+	zero := newCol(5, "e", mysql.TypeVarchar, mysql.NotNullFlag)
+	info := WrapTableInfo(&model.TableInfo{ID: 10, Name: model.NewCIStr("t"),
+		Columns: []*model.ColumnInfo{nullable, added, notNull, enum, zero}})
+
+	for _, tc := range []struct {
+		id       int64
+		dflt     interface{}
+		backfill interface{}
+	}{
+		{1, nil, nil},
+		{2, "2", "1"},
+		{3, "3", "3"},
+		{4, nil, "x"},
+		{5, nil, ""},
+	} {
+		d, ok := info.ColumnDefault(tc.id)
+		c.Assert(ok, IsTrue)
+		c.Assert(d.Default, Equals, tc.dflt, Commentf("column %d", tc.id))
+		c.Assert(d.Backfill.GetValue(), Equals, tc.backfill, Commentf("column %d", tc.id))
+	}
+	d, _ := info.ColumnDefault(2)
+	c.Assert(d.OriginDefault, Equals, "1")
+	_, ok := info.ColumnDefault(6)
+	c.Assert(ok, IsFalse)
+}
+
+func (t *schemaSuite) TestNameIndex(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	table := func(id int64, name string) *model.TableInfo {
+		return &model.TableInfo{ID: id, Name: model.NewCIStr(name), State: model.StatePublic}
+	}
+	db := &model.DBInfo{ID: 1, Name: model.NewCIStr("Test"), State: model.StatePublic}
+	jobs := []*model.Job{
+		{Type: model.ActionCreateSchema, SchemaID: 1, BinlogInfo: &model.HistoryInfo{DBInfo: db}},
+		{Type: model.ActionCreateTable, SchemaID: 1, TableID: 10, BinlogInfo: &model.HistoryInfo{TableInfo: table(10, "T1")}},
+		{Type: model.ActionCreateTable, SchemaID: 1, TableID: 11, BinlogInfo: &model.HistoryInfo{TableInfo: table(11, "t2")}},
+	}
+	for i, job := range jobs {
+		job.ID = int64(i + 1)
+		job.State = model.JobStateSynced
+		job.Query = job.Type.String()
+		job.BinlogInfo.FinishedTS = uint64(i + 1)
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+
+	// the names are case-insensitive
+	schema, ok := storage.SchemaByName("test")
+	c.Assert(ok, IsTrue)
+	c.Assert(schema.ID, Equals, int64(1))
+	info, ok := storage.TableByName("TEST", "t1")
+	c.Assert(ok, IsTrue)
+	c.Assert(info.ID, Equals, int64(10))
+	info, err = storage.ResolveTable("`test`.`T2`")
+	c.Assert(err, IsNil)
+	c.Assert(info.ID, Equals, int64(11))
+	_, err = storage.ResolveTable("test.t3")
+	c.Assert(err, ErrorMatches, "table test.t3 not found")
+
+	handle := func(job *model.Job) {
+		job.State = model.JobStateSynced
+		job.Query = job.Type.String()
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	// t1 is renamed to t3, t2 is truncated and the charset of the schema is
+	// changed
+	handle(&model.Job{ID: 4, Type: model.ActionRenameTable, SchemaID: 1, TableID: 10,
+		BinlogInfo: &model.HistoryInfo{TableInfo: table(10, "t3"), FinishedTS: 4}})
+	handle(&model.Job{ID: 5, Type: model.ActionTruncateTable, SchemaID: 1, TableID: 11,
+		BinlogInfo: &model.HistoryInfo{TableInfo: table(12, "t2"), FinishedTS: 5}})
+	handle(&model.Job{ID: 6, Type: model.ActionModifySchemaCharsetAndCollate, SchemaID: 1,
+		BinlogInfo: &model.HistoryInfo{DBInfo: &model.DBInfo{ID: 1, Name: model.NewCIStr("Test"), Charset: "utf8mb4"}, FinishedTS: 6}})
+	_, ok = storage.TableByName("test", "t1")
+	c.Assert(ok, IsFalse)
+	info, ok = storage.TableByName("test", "t3")
+	c.Assert(ok, IsTrue)
+	c.Assert(info.ID, Equals, int64(10))
+	info, ok = storage.TableByName("test", "t2")
+	c.Assert(ok, IsTrue)
+	c.Assert(info.ID, Equals, int64(12))
+	schema, ok = storage.SchemaByName("test")
+	c.Assert(ok, IsTrue)
+	c.Assert(schema.Charset, Equals, "utf8mb4")
+	c.Assert(schema.Tables, HasLen, 2)
+
+	handle(&model.Job{ID: 7, Type: model.ActionDropTable, SchemaID: 1, TableID: 10,
+		BinlogInfo: &model.HistoryInfo{FinishedTS: 7}})
+	_, ok = storage.TableByName("test", "t3")
+	c.Assert(ok, IsFalse)
+	handle(&model.Job{ID: 8, Type: model.ActionDropSchema, SchemaID: 1,
+		BinlogInfo: &model.HistoryInfo{FinishedTS: 8}})
+	_, ok = storage.SchemaByName("test")
+	c.Assert(ok, IsFalse)
+	_, ok = storage.TableByName("test", "t2")
+	c.Assert(ok, IsFalse)
+	c.Assert(storage.tableNameToID, HasLen, 0)
+	c.Assert(storage.schemaNameToID, HasLen, 0)
+}
+
+func (t *schemaSuite) TestParseTableName(c *C) {
+	for _, tc := range []struct {
+		name     string
+		expected TableName
+		err      string
+	}{
+		{name: "db.t", expected: TableName{Schema: "db", Table: "t"}},
+		{name: " `db`.`my.t` ", expected: TableName{Schema: "db", Table: "my.t"}},
+		{name: "`d``b`.t", expected: TableName{Schema: "d`b", Table: "t"}},
+		{name: "db", err: "invalid table name db, it should be like db.table"},
+		{name: "db.t.x", err: "invalid table name db.t.x, it should be like db.table"},
+		{name: "db.", err: "invalid table name db., it should be like db.table"},
+		{name: "`db.t", err: "invalid table name `db.t, the backtick is not closed"},
+		{name: "`db`x.t", err: "invalid table name `db`x.t"},
+	} {
+		name, err := ParseTableName(tc.name)
+		if tc.err != "" {
+			c.Assert(err, ErrorMatches, tc.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(name, Equals, tc.expected)
+	}
+}
+
+func (t *schemaSuite) TestDDLDispatchCoverage(c *C) {
+	// all the types known by the parser are dispatched, an unknown type has
+	// the same name as ActionNone
+	for i := 1; i <= 255; i++ {
+		tp := model.ActionType(i)
+		if tp.String() == model.ActionNone.String() {
+			continue
+		}
+		c.Assert(IsDDLSupported(tp), IsTrue, Commentf("type %d %s", i, tp))
+	}
+	c.Assert(IsDDLSupported(model.ActionNone), IsFalse)
+	c.Assert(IsDDLSupported(model.ActionType(200)), IsFalse)
+}
+
+func (t *schemaSuite) TestUnsupportedDDL(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	job := &model.Job{
+		ID:       1,
+		Type:     model.ActionType(200),
+		State:    model.JobStateSynced,
+		SchemaID: 1,
+		TableID:  10,
+		Query:    "ALTER TABLE t CACHE",
+		BinlogInfo: &model.HistoryInfo{
+			TableInfo:  &model.TableInfo{ID: 10, Name: model.NewCIStr("t")},
+			FinishedTS: 10,
+		},
+	}
+	_, _, _, err = storage.HandleDDL(job)
+	c.Assert(errors.Cause(err), Equals, ErrUnsupportedDDL)
+	c.Assert(err, ErrorMatches, "type 200 of job 1, query: ALTER TABLE t CACHE: unsupported ddl type")
+	c.Assert(storage.lastHandledTs, Equals, uint64(0))
+
+	// the skipped job doesn't change the schemas
+	storage.SetSkipUnsupportedDDL(true)
+	schemaName, tableName, sql, err := storage.HandleDDL(job)
+	c.Assert(err, IsNil)
+	c.Assert(schemaName, Equals, "")
+	c.Assert(tableName, Equals, "")
+	c.Assert(sql, Equals, "")
+	c.Assert(storage.lastHandledTs, Equals, uint64(10))
+	_, ok := storage.TableByID(10)
+	c.Assert(ok, IsFalse)
+}
+
+func (t *schemaSuite) TestInternalDDL(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	db := &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}
+	c.Assert(storage.CreateSchema(db), IsNil)
+	c.Assert(storage.CreateTable(db, &model.TableInfo{ID: 10, Name: model.NewCIStr("t")}), IsNil)
+
+	// the job updating the TiFlash replica status has no query
+	replica := &model.TiFlashReplicaInfo{Count: 1, Available: true}
+	job := &model.Job{
+		ID:       2,
+		Type:     model.ActionUpdateTiFlashReplicaStatus,
+		State:    model.JobStateSynced,
+		SchemaID: 1,
+		TableID:  10,
+		BinlogInfo: &model.HistoryInfo{
+			TableInfo:     &model.TableInfo{ID: 10, Name: model.NewCIStr("t"), TiFlashReplica: replica},
+			SchemaVersion: 5,
+			FinishedTS:    20,
+		},
+	}
+	schemaName, tableName, sql, err := storage.HandleDDL(job)
+	c.Assert(err, IsNil)
+	c.Assert(schemaName, Equals, "test")
+	c.Assert(tableName, Equals, "t")
+	c.Assert(sql, Equals, "")
+	c.Assert(storage.currentVersion, Equals, int64(5))
+	c.Assert(storage.lastHandledTs, Equals, uint64(20))
+	info, ok := storage.TableByID(10)
+	c.Assert(ok, IsTrue)
+	c.Assert(info.TiFlashReplica, DeepEquals, replica)
+
+	c.Assert(IsDDLInternal(model.ActionSetTiFlashReplica), IsTrue)
+	c.Assert(IsDDLInternal(model.ActionAddColumn), IsFalse)
+	for tp := range internalDDLTypes {
+		c.Assert(IsDDLSupported(tp), IsTrue, Commentf("%s", tp))
+	}
+}
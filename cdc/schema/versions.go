@@ -0,0 +1,222 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"time"
+
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// versionRetention is the default retention of the history below the
+// checkpoint, the row changes committed earlier than the retention are decoded
+// by the oldest version.
+const versionRetention = 10 * time.Minute
+
+// tableVersion is the table since the DDL job finished at ts, the table
+// doesn't exist if info is nil. The version at ts 0 is the table before the
+// retained versions.
+type tableVersion struct {
+	ts   uint64
+	info *TableInfo
+	name TableName
+}
+
+// schemaVersion is the schema since the DDL job finished at ts, like
+// tableVersion.
+type schemaVersion struct {
+	ts   uint64
+	info *model.DBInfo
+}
+
+// seedTableVersion saves the table before it's changed by the DDL job being
+// handled if it has no version.
+func (s *Storage) seedTableVersion(id int64) {
+	if s.versionTs == 0 || len(s.tableVersions[id]) > 0 {
+		return
+	}
+	if info, ok := s.tables[id]; ok {
+		s.tableVersions[id] = []tableVersion{{info: info, name: s.tableIDToName[id]}}
+	}
+}
+
+// saveTableVersion saves the table changed by the DDL job being handled.
+func (s *Storage) saveTableVersion(id int64) {
+	if s.versionTs == 0 {
+		return
+	}
+	v := tableVersion{ts: s.versionTs, info: s.tables[id], name: s.tableIDToName[id]}
+	versions := s.tableVersions[id]
+	// a job may change a table more than once, like renaming it
+	if n := len(versions); n > 0 && versions[n-1].ts == v.ts {
+		versions[n-1] = v
+		return
+	}
+	s.tableVersions[id] = append(versions, v)
+}
+
+func (s *Storage) seedSchemaVersion(id int64) {
+	if s.versionTs == 0 || len(s.schemaVersions[id]) > 0 {
+		return
+	}
+	if info, ok := s.schemas[id]; ok {
+		s.schemaVersions[id] = []schemaVersion{{info: info}}
+	}
+}
+
+func (s *Storage) saveSchemaVersion(id int64) {
+	if s.versionTs == 0 {
+		return
+	}
+	v := schemaVersion{ts: s.versionTs, info: s.schemas[id]}
+	versions := s.schemaVersions[id]
+	if n := len(versions); n > 0 && versions[n-1].ts == v.ts {
+		versions[n-1] = v
+		return
+	}
+	s.schemaVersions[id] = append(versions, v)
+}
+
+// tableVersionAt returns the version of the table at ts, ok is false if the
+// table has no retained versions, which means it's unchanged.
+func (s *Storage) tableVersionAt(id int64, ts uint64) (v tableVersion, ok bool) {
+	versions := s.tableVersions[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].ts <= ts {
+			return versions[i], true
+		}
+	}
+	// the table is created after ts
+	return tableVersion{}, len(versions) > 0
+}
+
+// TableByIDAt returns the TableInfo by table id at ts, so the row changes
+// committed before the handled DDL jobs can still be decoded. The physical ID
+// of a partition is looked up as its table.
+func (s *Storage) TableByIDAt(id int64, ts uint64) (*TableInfo, bool) {
+	id = s.logicalTableID(id)
+	v, ok := s.tableVersionAt(id, ts)
+	if !ok {
+		return s.TableByID(id)
+	}
+	return v.info, v.info != nil
+}
+
+// TableNameByIDAt returns the TableName by table id at ts.
+func (s *Storage) TableNameByIDAt(id int64, ts uint64) (TableName, bool) {
+	id = s.logicalTableID(id)
+	v, ok := s.tableVersionAt(id, ts)
+	if !ok {
+		return s.GetTableNameByID(id)
+	}
+	return v.name, v.info != nil
+}
+
+// SchemaByIDAt returns the DBInfo by schema id at ts, the Tables of the
+// DBInfo are not versioned.
+func (s *Storage) SchemaByIDAt(id int64, ts uint64) (*model.DBInfo, bool) {
+	versions := s.schemaVersions[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].ts <= ts {
+			return versions[i].info, versions[i].info != nil
+		}
+	}
+	if len(versions) > 0 {
+		return nil, false
+	}
+	return s.SchemaByID(id)
+}
+
+// SetGCRetention sets how long the history is retained below the checkpoint
+// passed to DoGC, the default retention is used if it's not positive.
+func (s *Storage) SetGCRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = versionRetention
+	}
+	s.gcRetention = retention
+}
+
+// DoGC drops the history no longer needed by the changefeed at checkpointTs,
+// the row changes committed within the retention below the checkpoint can
+// still be decoded. The history includes the replaced versions of the tables
+// and schemas, the removed partitions, the truncated table IDs and the handled
+// DDL jobs.
+func (s *Storage) DoGC(checkpointTs uint64) {
+	physical := oracle.ExtractPhysical(checkpointTs)
+	retention := int64(s.gcRetention / time.Millisecond)
+	if physical <= retention {
+		return
+	}
+	gcTs := oracle.ComposeTS(physical-retention, 0)
+	s.gcVersions(gcTs)
+	for id, ts := range s.truncateTableID {
+		if ts <= gcTs {
+			delete(s.truncateTableID, id)
+		}
+	}
+	// the jobs are kept until they are handled, copy the pending ones so the
+	// handled ones can be freed
+	i := 0
+	for i < len(s.jobs) && s.jobs[i].BinlogInfo.FinishedTS <= s.lastHandledTs {
+		i++
+	}
+	if i > 0 {
+		s.jobs = append([]*model.Job(nil), s.jobs[i:]...)
+	}
+}
+
+// gcVersions drops the versions replaced at or before gcTs, the last version
+// before it is kept as the version at ts 0. The versions are dropped if only
+// the current one is left.
+func (s *Storage) gcVersions(gcTs uint64) {
+	for id, versions := range s.tableVersions {
+		i := len(versions) - 1
+		for i >= 0 && versions[i].ts > gcTs {
+			i--
+		}
+		if i < 0 {
+			continue
+		}
+		if i == len(versions)-1 {
+			delete(s.tableVersions, id)
+			continue
+		}
+		versions = versions[i:]
+		versions[0].ts = 0
+		s.tableVersions[id] = versions
+	}
+	for id, versions := range s.schemaVersions {
+		i := len(versions) - 1
+		for i >= 0 && versions[i].ts > gcTs {
+			i--
+		}
+		if i < 0 {
+			continue
+		}
+		if i == len(versions)-1 {
+			delete(s.schemaVersions, id)
+			continue
+		}
+		versions = versions[i:]
+		versions[0].ts = 0
+		s.schemaVersions[id] = versions
+	}
+	for id, ts := range s.removedPartitions {
+		if ts <= gcTs {
+			delete(s.partitions, id)
+			delete(s.removedPartitions, id)
+		}
+	}
+}
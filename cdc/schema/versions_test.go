@@ -0,0 +1,156 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/pingcap/tidb/types"
+)
+
+type versionsSuite struct{}
+
+var _ = Suite(&versionsSuite{})
+
+func versionTs(ms int64) uint64 {
+	return oracle.ComposeTS(1000000+ms, 0)
+}
+
+func versionTestTable(name string, cols ...string) *model.TableInfo {
+	table := &model.TableInfo{ID: 10, Name: model.NewCIStr(name), State: model.StatePublic}
+	for i, col := range cols {
+		table.Columns = append(table.Columns, &model.ColumnInfo{
+			ID:        int64(i + 1),
+			Name:      model.NewCIStr(col),
+			Offset:    i,
+			FieldType: *types.NewFieldType(mysql.TypeLonglong),
+			State:     model.StatePublic,
+		})
+	}
+	return table
+}
+
+func versionTestJob(tp model.ActionType, ts uint64, table *model.TableInfo) *model.Job {
+	job := &model.Job{
+		State:      model.JobStateSynced,
+		SchemaID:   1,
+		TableID:    10,
+		Type:       tp,
+		BinlogInfo: &model.HistoryInfo{TableInfo: table, FinishedTS: ts},
+		Query:      tp.String(),
+	}
+	if tp == model.ActionCreateSchema {
+		job.BinlogInfo.DBInfo = &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	}
+	return job
+}
+
+func (s *versionsSuite) TestLookupAtTs(c *C) {
+	storage, err := NewStorage(nil)
+	c.Assert(err, IsNil)
+	for _, job := range []*model.Job{
+		versionTestJob(model.ActionCreateSchema, versionTs(1000), nil),
+		versionTestJob(model.ActionCreateTable, versionTs(2000), versionTestTable("t1", "a")),
+		versionTestJob(model.ActionAddColumn, versionTs(3000), versionTestTable("t1", "a", "b")),
+		versionTestJob(model.ActionRenameTable, versionTs(4000), versionTestTable("t2", "a", "b")),
+		versionTestJob(model.ActionDropTable, versionTs(5000), nil),
+	} {
+		_, _, _, err := storage.HandleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	_, ok := storage.TableByID(10)
+	c.Assert(ok, IsFalse)
+
+	for _, tc := range []struct {
+		ts    uint64
+		name  string
+		cols  int
+		exist bool
+	}{
+		{versionTs(1500), "", 0, false},
+		{versionTs(2000), "t1", 1, true},
+		{versionTs(3500), "t1", 2, true},
+		{versionTs(4500), "t2", 2, true},
+		{versionTs(5000), "", 0, false},
+	} {
+		info, ok := storage.TableByIDAt(10, tc.ts)
+		c.Assert(ok, Equals, tc.exist)
+		name, ok := storage.TableNameByIDAt(10, tc.ts)
+		c.Assert(ok, Equals, tc.exist)
+		if tc.exist {
+			c.Assert(info.Columns, HasLen, tc.cols)
+			c.Assert(name, Equals, TableName{Schema: "test", Table: tc.name})
+		}
+	}
+	_, ok = storage.SchemaByIDAt(1, versionTs(500))
+	c.Assert(ok, IsFalse)
+	db, ok := storage.SchemaByIDAt(1, versionTs(1000))
+	c.Assert(ok, IsTrue)
+	c.Assert(db.Name.O, Equals, "test")
+
+	// the last version before the retention is kept for the earlier ts
+	retention := int64(versionRetention / time.Millisecond)
+	storage.DoGC(versionTs(3500 + retention))
+	c.Assert(storage.tableVersions[10], HasLen, 3)
+	info, ok := storage.TableByIDAt(10, versionTs(2500))
+	c.Assert(ok, IsTrue)
+	c.Assert(info.Columns, HasLen, 2)
+	_, ok = storage.schemaVersions[1]
+	c.Assert(ok, IsFalse)
+
+	storage.DoGC(versionTs(5000 + retention))
+	c.Assert(storage.tableVersions, HasLen, 0)
+	_, ok = storage.TableByIDAt(10, versionTs(4500))
+	c.Assert(ok, IsFalse)
+}
+
+func (s *versionsSuite) TestGCBelowCheckpoint(c *C) {
+	jobs := []*model.Job{
+		versionTestJob(model.ActionCreateSchema, versionTs(1000), nil),
+		versionTestJob(model.ActionCreateTable, versionTs(2000), versionTestTable("t1", "a")),
+		versionTestJob(model.ActionTruncateTable, versionTs(3000), versionTestTable("t1", "a")),
+		versionTestJob(model.ActionAddColumn, versionTs(4000), versionTestTable("t1", "a", "b")),
+	}
+	// the table is recreated with a new ID by the truncation
+	jobs[2].BinlogInfo.TableInfo.ID = 11
+	jobs[3].TableID = 11
+	jobs[3].BinlogInfo.TableInfo.ID = 11
+	storage, err := NewStorage(jobs)
+	c.Assert(err, IsNil)
+	storage.SetGCRetention(time.Second)
+	c.Assert(storage.HandlePreviousDDLJobIfNeed(versionTs(3000)), IsNil)
+	c.Assert(storage.IsTruncateTableID(10), IsTrue)
+
+	// the history within the retention below the checkpoint is kept
+	storage.DoGC(versionTs(3500))
+	c.Assert(storage.IsTruncateTableID(10), IsTrue)
+	_, ok := storage.TableByIDAt(10, versionTs(2500))
+	c.Assert(ok, IsTrue)
+	c.Assert(storage.jobs, HasLen, 1)
+	c.Assert(storage.jobs[0].BinlogInfo.FinishedTS, Equals, versionTs(4000))
+
+	c.Assert(storage.HandlePreviousDDLJobIfNeed(versionTs(4000)), IsNil)
+	storage.DoGC(versionTs(4000 + 1000))
+	c.Assert(storage.IsTruncateTableID(10), IsFalse)
+	c.Assert(storage.tableVersions, HasLen, 0)
+	c.Assert(storage.schemaVersions, HasLen, 0)
+	c.Assert(storage.jobs, HasLen, 0)
+	info, ok := storage.TableByIDAt(11, versionTs(5000))
+	c.Assert(ok, IsTrue)
+	c.Assert(info.Columns, HasLen, 2)
+}
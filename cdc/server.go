@@ -16,10 +16,15 @@ package cdc
 import (
 	"context"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/util"
 	"go.uber.org/zap"
 )
@@ -28,12 +33,29 @@ type options struct {
 	pdEndpoints string
 	statusHost  string
 	statusPort  int
+	configFile  string
+	logLevel    string
+
+	taskStatusCompressThreshold int
+	grpcConfig                  kv.GrpcConfig
+	auditConfig                 kv.AuditConfig
+	autoResumeConfig            AutoResumeConfig
+	errorRestartConfig          ErrorRestartConfig
+	lifecycleWebhook            string
+	drainTimeout                time.Duration
+	captureConfig               CaptureConfig
+	dataDirs                    []string
 }
 
 var defaultServerOptions = options{
 	pdEndpoints: "127.0.0.1:2379",
 	statusHost:  "127.0.0.1",
 	statusPort:  defaultStatusPort,
+	logLevel:    "info",
+	grpcConfig:  kv.DefaultGrpcConfig,
+
+	autoResumeConfig:   DefaultAutoResumeConfig,
+	errorRestartConfig: DefaultErrorRestartConfig,
 }
 
 // PDEndpoints returns a ServerOption that sets the endpoints of PD for the server.
@@ -57,6 +79,95 @@ func StatusPort(p int) ServerOption {
 	}
 }
 
+// ConfigFile returns a ServerOption that sets the path of the config file of
+// the reloadable options
+func ConfigFile(path string) ServerOption {
+	return func(o *options) {
+		o.configFile = path
+	}
+}
+
+// LogLevel returns a ServerOption that sets the log level
+func LogLevel(level string) ServerOption {
+	return func(o *options) {
+		o.logLevel = level
+	}
+}
+
+// TaskStatusCompressThreshold returns a ServerOption that sets the minimum size
+// of a task status to be compressed before written into etcd
+func TaskStatusCompressThreshold(threshold int) ServerOption {
+	return func(o *options) {
+		o.taskStatusCompressThreshold = threshold
+	}
+}
+
+// GrpcConfig returns a ServerOption that sets the gRPC config of the
+// connections to TiKV
+func GrpcConfig(cfg kv.GrpcConfig) ServerOption {
+	return func(o *options) {
+		o.grpcConfig = cfg
+	}
+}
+
+// AuditConfig returns a ServerOption that sets the config of the audit log of
+// the metadata mutations
+func AuditConfig(cfg kv.AuditConfig) ServerOption {
+	return func(o *options) {
+		o.auditConfig = cfg
+	}
+}
+
+// AutoResume returns a ServerOption that sets the config of resuming the
+// changefeeds paused by the downstream outages
+func AutoResume(cfg AutoResumeConfig) ServerOption {
+	return func(o *options) {
+		o.autoResumeConfig = cfg
+	}
+}
+
+// ErrorRestart returns a ServerOption that sets the config of restarting the
+// changefeeds stopped by errors
+func ErrorRestart(cfg ErrorRestartConfig) ServerOption {
+	return func(o *options) {
+		o.errorRestartConfig = cfg
+	}
+}
+
+// LifecycleWebhook returns a ServerOption that sets the webhook the lifecycle
+// events of the changefeeds are published to
+func LifecycleWebhook(url string) ServerOption {
+	return func(o *options) {
+		o.lifecycleWebhook = url
+	}
+}
+
+// DrainTimeout returns a ServerOption that sets the max time to hand off the
+// tables of the capture to the others before the server exits, 0 to exit
+// without draining
+func DrainTimeout(timeout time.Duration) ServerOption {
+	return func(o *options) {
+		o.drainTimeout = timeout
+	}
+}
+
+// CapturePlacement returns a ServerOption that sets the labels, the max tables and
+// whether the capture is dedicated, which constrain the tables placed to it
+func CapturePlacement(cfg CaptureConfig) ServerOption {
+	return func(o *options) {
+		o.captureConfig = cfg
+	}
+}
+
+// DataDir returns a ServerOption that sets the candidate directories of the
+// local data of the capture, like the files spilled by the sorters, the
+// fastest one is used
+func DataDir(dirs ...string) ServerOption {
+	return func(o *options) {
+		o.dataDirs = dirs
+	}
+}
+
 // A ServerOption sets options such as the addr of PD.
 type ServerOption func(*options)
 
@@ -65,6 +176,9 @@ type Server struct {
 	opts         options
 	capture      *Capture
 	statusServer *http.Server
+
+	configMu sync.Mutex
+	config   *ReloadableConfig
 }
 
 // NewServer creates a Server instance.
@@ -76,9 +190,61 @@ func NewServer(opt ...ServerOption) (*Server, error) {
 	log.Info("creating CDC server",
 		zap.String("pd-addr", opts.pdEndpoints),
 		zap.String("status-host", opts.statusHost),
-		zap.Int("status-port", opts.statusPort))
+		zap.Int("status-port", opts.statusPort),
+		zap.String("config", opts.configFile),
+		zap.Int("task-status-compress-threshold", opts.taskStatusCompressThreshold),
+		zap.Duration("grpc-keepalive-time", opts.grpcConfig.KeepaliveTime),
+		zap.Duration("grpc-keepalive-timeout", opts.grpcConfig.KeepaliveTimeout),
+		zap.Int32("grpc-initial-window-size", opts.grpcConfig.InitialWindowSize),
+		zap.Int32("grpc-initial-conn-window-size", opts.grpcConfig.InitialConnWindowSize),
+		zap.Int("grpc-max-recv-msg-size", opts.grpcConfig.MaxRecvMsgSize),
+		zap.String("audit-log-file", opts.auditConfig.File.Filename),
+		zap.Bool("audit-etcd", opts.auditConfig.EtcdEnabled),
+		zap.Duration("auto-resume-window", opts.autoResumeConfig.Window),
+		zap.Duration("auto-resume-probe-interval", opts.autoResumeConfig.ProbeInterval),
+		zap.Int("error-restart-limit", opts.errorRestartConfig.Limit),
+		zap.Duration("error-restart-backoff", opts.errorRestartConfig.Backoff),
+		zap.Duration("error-restart-max-backoff", opts.errorRestartConfig.MaxBackoff),
+		zap.String("lifecycle-webhook", opts.lifecycleWebhook),
+		zap.Duration("drain-timeout", opts.drainTimeout),
+		zap.String("capture-labels", model.LabelsString(opts.captureConfig.Labels)),
+		zap.Int("max-tables", opts.captureConfig.MaxTables),
+		zap.Bool("dedicated", opts.captureConfig.Dedicated),
+		zap.Strings("data-dir", opts.dataDirs))
 
-	capture, err := NewCapture(strings.Split(opts.pdEndpoints, ","))
+	if err := opts.grpcConfig.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := opts.errorRestartConfig.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := opts.captureConfig.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	config := opts.reloadableConfig()
+	if opts.configFile != "" {
+		var err error
+		config, err = loadReloadableConfig(opts.configFile, &opts)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	} else if err := config.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	config.apply()
+	kv.SetGrpcConfig(opts.grpcConfig)
+	lifecycleWebhook = opts.lifecycleWebhook
+	errorRestartConfig = opts.errorRestartConfig
+	dir, err := selectDataDir(opts.dataDirs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	dataDir = dir
+	if err := kv.InitAudit(opts.auditConfig); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	capture, err := NewCapture(strings.Split(opts.pdEndpoints, ","), opts.captureConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +252,7 @@ func NewServer(opt ...ServerOption) (*Server, error) {
 	s := &Server{
 		opts:    opts,
 		capture: capture,
+		config:  config,
 	}
 	return s, nil
 }
@@ -93,10 +260,27 @@ func NewServer(opt ...ServerOption) (*Server, error) {
 // Run runs the server.
 func (s *Server) Run(ctx context.Context) error {
 	s.startStatusHTTP()
+	// the data dir in the temporary directory may not be created yet
+	spaceDir := dataDir
+	if spaceDir == "" {
+		spaceDir = os.TempDir()
+	}
+	go checkDataDirSpace(ctx, spaceDir)
 	ctx = util.PutCaptureIDInCtx(ctx, s.capture.info.ID)
 	return s.capture.Start(ctx)
 }
 
+// Drain hands off the tables of the capture to the other captures before the
+// server is closed, it's a no-op if the drain timeout is 0.
+func (s *Server) Drain(ctx context.Context) error {
+	if s.opts.drainTimeout == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.opts.drainTimeout)
+	defer cancel()
+	return errors.Trace(s.capture.Drain(ctx))
+}
+
 // Close closes the server.
 func (s *Server) Close() {
 	if s.statusServer != nil {
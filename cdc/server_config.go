@@ -0,0 +1,138 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ReloadableConfig is the part of the server config which can be changed
+// without restarting the capture. It's read from the config file given by
+// --config at the start, and read again on SIGHUP or POST /config/reload. The
+// fields missing in the file fall back to the command line flags.
+//
+// The other options of the server, the PD endpoints, the status address, the
+// gRPC config (including the flow-control windows) and the audit config, are
+// only read at the start, changing them requires restarting the capture. The
+// scan limits are saved in etcd and changed by the set-scan-limit command.
+type ReloadableConfig struct {
+	LogLevel                    string `toml:"log-level" json:"log-level"`
+	TaskStatusCompressThreshold int    `toml:"task-status-compress-threshold" json:"task-status-compress-threshold"`
+	AutoResumeWindow            string `toml:"auto-resume-window" json:"auto-resume-window"`
+	AutoResumeProbeInterval     string `toml:"auto-resume-probe-interval" json:"auto-resume-probe-interval"`
+}
+
+// reloadableConfig returns the reloadable config set by the server options.
+func (o *options) reloadableConfig() *ReloadableConfig {
+	return &ReloadableConfig{
+		LogLevel:                    o.logLevel,
+		TaskStatusCompressThreshold: o.taskStatusCompressThreshold,
+		AutoResumeWindow:            o.autoResumeConfig.Window.String(),
+		AutoResumeProbeInterval:     o.autoResumeConfig.ProbeInterval.String(),
+	}
+}
+
+// loadReloadableConfig reads the reloadable config from the file over the
+// server options. The options requiring restart are rejected in the file.
+func loadReloadableConfig(path string, opts *options) (*ReloadableConfig, error) {
+	cfg := opts.reloadableConfig()
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, errors.Annotatef(err, "decode config file %s", path)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return nil, errors.Errorf("config file %s contains the options which can't be reloaded: %s",
+			path, strings.Join(keys, ", "))
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Annotatef(err, "config file %s", path)
+	}
+	return cfg, nil
+}
+
+func (c *ReloadableConfig) validate() error {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return errors.Errorf("invalid log-level: %s", c.LogLevel)
+	}
+	if c.TaskStatusCompressThreshold < 0 {
+		return errors.Errorf("invalid task-status-compress-threshold: %d, it should not be negative", c.TaskStatusCompressThreshold)
+	}
+	_, err := c.autoResumeConfig()
+	return errors.Trace(err)
+}
+
+func (c *ReloadableConfig) autoResumeConfig() (AutoResumeConfig, error) {
+	window, err := time.ParseDuration(c.AutoResumeWindow)
+	if err != nil || window < 0 {
+		return AutoResumeConfig{}, errors.Errorf("invalid auto-resume-window: %s", c.AutoResumeWindow)
+	}
+	interval, err := time.ParseDuration(c.AutoResumeProbeInterval)
+	if err != nil || interval <= 0 {
+		return AutoResumeConfig{}, errors.Errorf("invalid auto-resume-probe-interval: %s", c.AutoResumeProbeInterval)
+	}
+	return AutoResumeConfig{Window: window, ProbeInterval: interval}, nil
+}
+
+// apply applies the validated config to the capture, the auto resume config is
+// taken by the owner on its next tick.
+func (c *ReloadableConfig) apply() {
+	var level zapcore.Level
+	_ = level.UnmarshalText([]byte(c.LogLevel))
+	log.SetLevel(level)
+	model.SetTaskStatusCompressThreshold(c.TaskStatusCompressThreshold)
+	cfg, _ := c.autoResumeConfig()
+	setAutoResumeConfig(cfg)
+	log.Info("apply server config",
+		zap.String("log-level", c.LogLevel),
+		zap.Int("task-status-compress-threshold", c.TaskStatusCompressThreshold),
+		zap.Duration("auto-resume-window", cfg.Window),
+		zap.Duration("auto-resume-probe-interval", cfg.ProbeInterval))
+}
+
+// ReloadConfig reads the config file again and applies the reloadable config.
+// Nothing is changed if the file is invalid.
+func (s *Server) ReloadConfig() (*ReloadableConfig, error) {
+	if s.opts.configFile == "" {
+		return nil, errors.New("no config file is specified by --config")
+	}
+	cfg, err := loadReloadableConfig(s.opts.configFile, &s.opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	cfg.apply()
+	s.config = cfg
+	return cfg, nil
+}
+
+// Config returns the reloadable config in effect.
+func (s *Server) Config() *ReloadableConfig {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	return s.config
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap/zapcore"
+)
+
+type serverConfigSuite struct{}
+
+var _ = check.Suite(&serverConfigSuite{})
+
+func (s *serverConfigSuite) TestReloadConfig(c *check.C) {
+	defer log.SetLevel(log.GetLevel())
+	defer model.SetTaskStatusCompressThreshold(model.GetTaskStatusCompressThreshold())
+	defer setAutoResumeConfig(getAutoResumeConfig())
+
+	path := filepath.Join(c.MkDir(), "server.toml")
+	opts := defaultServerOptions
+	server := &Server{opts: opts}
+	server.opts.configFile = path
+	_, err := server.ReloadConfig()
+	c.Assert(err, check.ErrorMatches, ".*no such file.*")
+
+	// the options missing in the file fall back to the flags
+	c.Assert(ioutil.WriteFile(path, []byte(`
+log-level = "warn"
+auto-resume-window = "10m"
+`), 0644), check.IsNil)
+	cfg, err := server.ReloadConfig()
+	c.Assert(err, check.IsNil)
+	c.Assert(cfg, check.DeepEquals, &ReloadableConfig{
+		LogLevel:                    "warn",
+		TaskStatusCompressThreshold: 0,
+		AutoResumeWindow:            "10m",
+		AutoResumeProbeInterval:     "30s",
+	})
+	c.Assert(server.Config(), check.Equals, cfg)
+	c.Assert(log.GetLevel(), check.Equals, zapcore.WarnLevel)
+	c.Assert(getAutoResumeConfig(), check.DeepEquals, AutoResumeConfig{Window: 10 * time.Minute, ProbeInterval: 30 * time.Second})
+
+	c.Assert(ioutil.WriteFile(path, []byte(`
+task-status-compress-threshold = 4096
+auto-resume-probe-interval = "1m"
+`), 0644), check.IsNil)
+	_, err = server.ReloadConfig()
+	c.Assert(err, check.IsNil)
+	c.Assert(log.GetLevel(), check.Equals, zapcore.InfoLevel)
+	c.Assert(model.GetTaskStatusCompressThreshold(), check.Equals, 4096)
+	c.Assert(getAutoResumeConfig(), check.DeepEquals, AutoResumeConfig{Window: 30 * time.Minute, ProbeInterval: time.Minute})
+
+	// nothing is changed by an invalid file
+	for _, tc := range []struct {
+		content string
+		err     string
+	}{
+		{`grpc-keepalive-time = "10s"`, ".*can't be reloaded: grpc-keepalive-time.*"},
+		{`log-level = "verbose"`, ".*invalid log-level: verbose.*"},
+		{`task-status-compress-threshold = -1`, ".*invalid task-status-compress-threshold.*"},
+		{`auto-resume-window = "1 hour"`, ".*invalid auto-resume-window.*"},
+		{`auto-resume-probe-interval = "0s"`, ".*invalid auto-resume-probe-interval.*"},
+	} {
+		c.Assert(ioutil.WriteFile(path, []byte(tc.content), 0644), check.IsNil)
+		_, err = server.ReloadConfig()
+		c.Assert(err, check.ErrorMatches, tc.err)
+	}
+	c.Assert(model.GetTaskStatusCompressThreshold(), check.Equals, 4096)
+	c.Assert(server.Config().AutoResumeProbeInterval, check.Equals, "1m")
+}
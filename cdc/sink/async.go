@@ -0,0 +1,208 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// asyncMaxBatchTxns is the max number of the buffered transactions emitted to
+// the backend sink in a call.
+const asyncMaxBatchTxns = 128
+
+var errAsyncSinkClosed = errors.New("async sink is closed")
+
+// asyncEvent is a transaction or a marker in the buffer of asyncSink.
+type asyncEvent struct {
+	txn *model.Txn
+	// resolvedTs is the ts of a checkpoint marker, the transactions before the
+	// marker are flushed by the backend sink when the marker is handled.
+	resolvedTs uint64
+	// barrier is closed after the events before it are handled.
+	barrier chan struct{}
+}
+
+// asyncSink accepts the transactions into a bounded buffer and emits them to
+// the backend sink in background, so the caller isn't blocked by the latency of
+// the downstream until the buffer is full. The error of the backend sink fails
+// the following calls.
+type asyncSink struct {
+	backend   Sink
+	events    chan *asyncEvent
+	onFlushed func(ts uint64)
+	flushedTs uint64
+
+	errMu sync.Mutex
+	err   error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ Sink = &asyncSink{}
+
+// NewAsyncSink wraps the sink to flush the transactions asynchronously, at most
+// bufferSize transactions are buffered and EmitDMLs blocks if the buffer is
+// full. onFlushed is called in background with the ts returned by
+// FlushCheckpoint of the backend sink, after the transactions before the
+// checkpoint are flushed. It can be nil.
+func NewAsyncSink(backend Sink, bufferSize int, onFlushed func(ts uint64)) Sink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &asyncSink{
+		backend:   backend,
+		events:    make(chan *asyncEvent, bufferSize),
+		onFlushed: onFlushed,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+// EmitDMLs implements Sink interface.
+// It returns after the transactions are buffered.
+func (s *asyncSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	for _, txn := range txns {
+		// the caller may reuse the slice after it returns
+		txn := txn
+		if err := s.send(ctx, &asyncEvent{txn: &txn}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// EmitDDL implements Sink interface.
+// The DDL is emitted after the buffered transactions are flushed.
+func (s *asyncSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	barrier := make(chan struct{})
+	if err := s.send(ctx, &asyncEvent{barrier: barrier}); err != nil {
+		return errors.Trace(err)
+	}
+	select {
+	case <-barrier:
+	case <-s.done:
+		return errors.Trace(s.error())
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+// It returns the last flushed ts without waiting for the flush of ts, the
+// flush of ts is notified by onFlushed.
+func (s *asyncSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	if err := s.send(ctx, &asyncEvent{resolvedTs: ts}); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return atomic.LoadUint64(&s.flushedTs), nil
+}
+
+// Close implements Sink interface.
+func (s *asyncSink) Close() error {
+	s.cancel()
+	<-s.done
+	return errors.Trace(s.backend.Close())
+}
+
+func (s *asyncSink) send(ctx context.Context, e *asyncEvent) error {
+	if err := s.error(); err != nil {
+		return errors.Trace(err)
+	}
+	select {
+	case s.events <- e:
+		return nil
+	case <-s.done:
+		return errors.Trace(s.error())
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
+
+func (s *asyncSink) error() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if s.err == nil {
+		select {
+		case <-s.done:
+			return errAsyncSinkClosed
+		default:
+		}
+	}
+	return s.err
+}
+
+func (s *asyncSink) setError(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	s.err = err
+}
+
+// run emits the buffered transactions in batches and handles the markers, it
+// exits on the first error of the backend sink.
+func (s *asyncSink) run(ctx context.Context) {
+	defer close(s.done)
+	var txns []model.Txn
+	for {
+		var e *asyncEvent
+		if len(txns) == 0 {
+			select {
+			case e = <-s.events:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			// emit the batch once no more transaction is buffered
+			select {
+			case e = <-s.events:
+			default:
+			}
+		}
+		if e != nil && e.txn != nil && len(txns) < asyncMaxBatchTxns {
+			txns = append(txns, *e.txn)
+			continue
+		}
+
+		if len(txns) > 0 {
+			if err := s.backend.EmitDMLs(ctx, txns...); err != nil {
+				s.setError(err)
+				return
+			}
+			txns = nil
+		}
+		switch {
+		case e == nil:
+		case e.txn != nil:
+			txns = append(txns, *e.txn)
+		case e.barrier != nil:
+			close(e.barrier)
+		default:
+			ts, err := s.backend.FlushCheckpoint(ctx, e.resolvedTs)
+			if err != nil {
+				s.setError(err)
+				return
+			}
+			atomic.StoreUint64(&s.flushedTs, ts)
+			if s.onFlushed != nil {
+				s.onFlushed(ts)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type asyncSuite struct{}
+
+var _ = check.Suite(&asyncSuite{})
+
+// mockBackendSink records the emitted events, the emits are blocked until
+// unblock is closed.
+type mockBackendSink struct {
+	mu      sync.Mutex
+	events  []string
+	unblock chan struct{}
+	err     error
+}
+
+func (m *mockBackendSink) record(format string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, fmt.Sprintf(format, args...))
+}
+
+func (m *mockBackendSink) recorded() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.events...)
+}
+
+func (m *mockBackendSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	<-m.unblock
+	if m.err != nil {
+		return m.err
+	}
+	for _, txn := range txns {
+		m.record("dml %d", txn.Ts)
+	}
+	return nil
+}
+
+func (m *mockBackendSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	m.record("ddl %d", txn.Ts)
+	return nil
+}
+
+func (m *mockBackendSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	m.record("checkpoint %d", ts)
+	return ts, nil
+}
+
+func (m *mockBackendSink) Close() error {
+	return nil
+}
+
+func (s *asyncSuite) TestBufferAndFlush(c *check.C) {
+	backend := &mockBackendSink{unblock: make(chan struct{})}
+	flushed := make(chan uint64, 10)
+	sink := NewAsyncSink(backend, 4, func(ts uint64) { flushed <- ts })
+	defer sink.Close()
+	ctx := context.Background()
+
+	// the emits return before the transactions are flushed
+	for i := 1; i <= 4; i++ {
+		c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: uint64(i)}), check.IsNil)
+	}
+	ts, err := sink.FlushCheckpoint(ctx, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(0))
+
+	// the emits are blocked once the buffer is full
+	ctx1, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	var txns []model.Txn
+	for i := 5; i <= 12; i++ {
+		txns = append(txns, model.Txn{Ts: uint64(i)})
+	}
+	err = sink.EmitDMLs(ctx1, txns...)
+	c.Assert(errors.Cause(err), check.Equals, context.DeadlineExceeded)
+	c.Assert(backend.recorded(), check.HasLen, 0)
+
+	close(backend.unblock)
+	select {
+	case ts := <-flushed:
+		c.Assert(ts, check.Equals, uint64(4))
+	case <-time.After(5 * time.Second):
+		c.Fatal("checkpoint is not flushed")
+	}
+	c.Assert(backend.recorded()[:5], check.DeepEquals, []string{"dml 1", "dml 2", "dml 3", "dml 4", "checkpoint 4"})
+
+	// the DDL is emitted after the buffered transactions
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 13}), check.IsNil)
+	c.Assert(sink.EmitDDL(ctx, model.Txn{Ts: 14}), check.IsNil)
+	events := backend.recorded()
+	c.Assert(events[len(events)-2:], check.DeepEquals, []string{"dml 13", "ddl 14"})
+	ts, err = sink.FlushCheckpoint(ctx, 14)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(4))
+}
+
+func (s *asyncSuite) TestBackendError(c *check.C) {
+	backend := &mockBackendSink{unblock: make(chan struct{}), err: errors.New("downstream is down")}
+	close(backend.unblock)
+	sink := NewAsyncSink(backend, 4, func(ts uint64) { c.Fatalf("unexpected flushed ts %d", ts) })
+	ctx := context.Background()
+
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 1}), check.IsNil)
+	// the error is returned by the following calls
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = sink.FlushCheckpoint(ctx, 1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(err, check.ErrorMatches, ".*downstream is down.*")
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 2}), check.ErrorMatches, ".*downstream is down.*")
+	c.Assert(sink.Close(), check.IsNil)
+
+	sink = NewAsyncSink(&mockBackendSink{}, 4, nil)
+	c.Assert(sink.Close(), check.IsNil)
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 1}), check.ErrorMatches, ".*async sink is closed.*")
+}
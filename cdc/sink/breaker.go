@@ -0,0 +1,268 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// the states of the circuit breaker, they are the values of the state metric
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var breakerStateNames = []string{"closed", "open", "half-open"}
+
+// circuitBreaker counts the failures of the sinks of a changefeed in a row.
+// The writes are held while it's open, and only one write probes the
+// downstream while it's half-open.
+type circuitBreaker struct {
+	changefeedID string
+
+	mu        sync.Mutex
+	threshold int
+	minOpen   time.Duration
+	maxOpen   time.Duration
+
+	state     int
+	failures  int
+	openFor   time.Duration
+	openUntil time.Time
+	probing   bool
+	// probed is closed and replaced when a probe finishes
+	probed chan struct{}
+	// refs is the number of the sinks sharing the breaker
+	refs int
+}
+
+// breakers holds the breakers of the changefeeds, so the failures are still
+// counted after the processor is restarted with a new sink.
+var breakers = struct {
+	sync.Mutex
+	m map[string]*circuitBreaker
+}{m: make(map[string]*circuitBreaker)}
+
+func acquireBreaker(changefeedID string, cfg model.CircuitBreakerConfig) *circuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.m[changefeedID]
+	if !ok {
+		b = &circuitBreaker{changefeedID: changefeedID, probed: make(chan struct{})}
+		breakers.m[changefeedID] = b
+		circuitBreakerStateGauge.WithLabelValues(changefeedID).Set(breakerClosed)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// the config may be updated when the changefeed is resumed
+	b.threshold = cfg.FailureThreshold
+	b.minOpen = cfg.OpenDuration()
+	b.maxOpen = cfg.MaxOpenDuration()
+	b.refs++
+	return b
+}
+
+// releaseBreaker drops the breaker when it's not used by any sink and it
+// remembers no failure.
+func releaseBreaker(b *circuitBreaker) {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refs--
+	if b.refs == 0 && b.state == breakerClosed && b.failures == 0 {
+		delete(breakers.m, b.changefeedID)
+		circuitBreakerStateGauge.DeleteLabelValues(b.changefeedID)
+	}
+}
+
+// allow waits until a write is allowed, probe is true if the write probes the
+// downstream in the half-open state.
+func (b *circuitBreaker) allow(ctx context.Context) (probe bool, err error) {
+	for {
+		b.mu.Lock()
+		var wait <-chan struct{}
+		var timer *time.Timer
+		switch b.state {
+		case breakerClosed:
+			b.mu.Unlock()
+			return false, nil
+		case breakerOpen:
+			if d := time.Until(b.openUntil); d > 0 {
+				timer = time.NewTimer(d)
+				break
+			}
+			b.transit(breakerHalfOpen)
+			fallthrough
+		case breakerHalfOpen:
+			if !b.probing {
+				b.probing = true
+				b.mu.Unlock()
+				return true, nil
+			}
+			wait = b.probed
+		}
+		b.mu.Unlock()
+
+		var timeout <-chan time.Time
+		if timer != nil {
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+		case <-wait:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return false, errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// done records the result of a write allowed by the breaker.
+func (b *circuitBreaker) done(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+		close(b.probed)
+		b.probed = make(chan struct{})
+	}
+	switch {
+	case isBreakerFailure(err):
+		if probe {
+			b.openFor *= 2
+			if b.openFor > b.maxOpen {
+				b.openFor = b.maxOpen
+			}
+			b.open(err)
+			return
+		}
+		b.failures++
+		if b.state == breakerClosed && b.failures >= b.threshold {
+			b.openFor = b.minOpen
+			b.open(err)
+		}
+	case err == nil:
+		b.failures = 0
+		if probe {
+			b.transit(breakerClosed)
+		}
+	}
+	// the breaker stays half-open if the probe is canceled, another write
+	// probes the downstream then.
+}
+
+func (b *circuitBreaker) open(err error) {
+	b.openUntil = time.Now().Add(b.openFor)
+	b.transit(breakerOpen)
+	log.Warn("the sink fails too many times, stop writing for a while",
+		zap.String("changefeed", b.changefeedID),
+		zap.Int("failures", b.failures),
+		zap.Duration("open", b.openFor),
+		zap.Error(err))
+}
+
+func (b *circuitBreaker) transit(state int) {
+	log.Info("circuit breaker of the sink changes state",
+		zap.String("changefeed", b.changefeedID),
+		zap.String("from", breakerStateNames[b.state]),
+		zap.String("to", breakerStateNames[state]))
+	b.state = state
+	circuitBreakerStateGauge.WithLabelValues(b.changefeedID).Set(float64(state))
+	circuitBreakerTransitionCounter.WithLabelValues(b.changefeedID, breakerStateNames[state]).Inc()
+}
+
+// isBreakerFailure tells whether the error shows the downstream is
+// unavailable. The canceled writes, the fatal errors and the errors of a
+// single table are not counted.
+func isBreakerFailure(err error) bool {
+	if err == nil || IsFatalError(err) {
+		return false
+	}
+	if _, _, ok := TableErrorOf(err); ok {
+		return false
+	}
+	cause := errors.Cause(err)
+	return cause != context.Canceled && cause != context.DeadlineExceeded
+}
+
+// circuitBreakerSink writes the backend sink through the circuit breaker of
+// the changefeed.
+type circuitBreakerSink struct {
+	backend Sink
+	breaker *circuitBreaker
+}
+
+var _ Sink = &circuitBreakerSink{}
+
+// NewCircuitBreakerSink wraps the sink with the circuit breaker of the
+// changefeed, the breaker is shared by the sinks of the changefeed in the
+// process.
+func NewCircuitBreakerSink(backend Sink, changefeedID string, cfg model.CircuitBreakerConfig) Sink {
+	return &circuitBreakerSink{
+		backend: backend,
+		breaker: acquireBreaker(changefeedID, cfg),
+	}
+}
+
+func (s *circuitBreakerSink) do(ctx context.Context, fn func() error) error {
+	probe, err := s.breaker.allow(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = fn()
+	s.breaker.done(probe, err)
+	return errors.Trace(err)
+}
+
+// EmitDMLs implements Sink interface.
+func (s *circuitBreakerSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	return s.do(ctx, func() error {
+		return s.backend.EmitDMLs(ctx, txns...)
+	})
+}
+
+// EmitDDL implements Sink interface.
+func (s *circuitBreakerSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	return s.do(ctx, func() error {
+		return s.backend.EmitDDL(ctx, txn)
+	})
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *circuitBreakerSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	var checkpointTs uint64
+	err := s.do(ctx, func() error {
+		var err error
+		checkpointTs, err = s.backend.FlushCheckpoint(ctx, ts)
+		return err
+	})
+	return checkpointTs, errors.Trace(err)
+}
+
+// Close implements Sink interface.
+func (s *circuitBreakerSink) Close() error {
+	releaseBreaker(s.breaker)
+	return errors.Trace(s.backend.Close())
+}
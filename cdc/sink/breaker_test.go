@@ -0,0 +1,81 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type breakerSuite struct{}
+
+var _ = check.Suite(&breakerSuite{})
+
+func (s *breakerSuite) TestCircuitBreaker(c *check.C) {
+	backend := &mockBackendSink{unblock: make(chan struct{}), err: errors.New("downstream is down")}
+	close(backend.unblock)
+	sink := NewCircuitBreakerSink(backend, "breaker-test", model.CircuitBreakerConfig{FailureThreshold: 2})
+	b := sink.(*circuitBreakerSink).breaker
+	b.minOpen, b.maxOpen = 50*time.Millisecond, 80*time.Millisecond
+	ctx := context.Background()
+
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 1}), check.ErrorMatches, "downstream is down")
+	c.Assert(b.state, check.Equals, breakerClosed)
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 1}), check.ErrorMatches, "downstream is down")
+	c.Assert(b.state, check.Equals, breakerOpen)
+
+	// the writes are held while the breaker is open
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	c.Assert(sink.EmitDDL(cctx, model.Txn{Ts: 2}), check.ErrorMatches, ".*context deadline exceeded")
+	c.Assert(backend.recorded(), check.HasLen, 0)
+
+	// the failed probe opens the breaker for twice as long up to the max
+	start := time.Now()
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 1}), check.ErrorMatches, "downstream is down")
+	c.Assert(time.Since(start) >= 30*time.Millisecond, check.IsTrue)
+	c.Assert(b.state, check.Equals, breakerOpen)
+	c.Assert(b.openFor, check.Equals, 80*time.Millisecond)
+
+	backend.err = nil
+	start = time.Now()
+	c.Assert(sink.EmitDMLs(ctx, model.Txn{Ts: 1}), check.IsNil)
+	c.Assert(time.Since(start) >= 60*time.Millisecond, check.IsTrue)
+	c.Assert(b.state, check.Equals, breakerClosed)
+	c.Assert(b.failures, check.Equals, 0)
+	ts, err := sink.FlushCheckpoint(ctx, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(1))
+	c.Assert(backend.recorded(), check.DeepEquals, []string{"dml 1", "checkpoint 1"})
+
+	// the breaker is shared by the sinks of the changefeed until they are
+	// closed
+	other := NewCircuitBreakerSink(backend, "breaker-test", model.CircuitBreakerConfig{FailureThreshold: 2})
+	c.Assert(other.(*circuitBreakerSink).breaker, check.Equals, b)
+	c.Assert(sink.Close(), check.IsNil)
+	c.Assert(other.Close(), check.IsNil)
+	c.Assert(breakers.m, check.HasLen, 0)
+}
+
+func (s *breakerSuite) TestBreakerFailure(c *check.C) {
+	c.Assert(isBreakerFailure(nil), check.IsFalse)
+	c.Assert(isBreakerFailure(errors.Trace(context.Canceled)), check.IsFalse)
+	c.Assert(isBreakerFailure(newFatalError(errors.New("bad data"))), check.IsFalse)
+	c.Assert(isBreakerFailure(NewTableError("test", "t", errors.New("table not found"))), check.IsFalse)
+	c.Assert(isBreakerFailure(errors.New("connection refused")), check.IsTrue)
+}
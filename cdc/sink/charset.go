@@ -0,0 +1,144 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/types"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// charsetEncodings are the encodings of model.ConvertibleCharsets.
+var charsetEncodings = map[string]encoding.Encoding{
+	"gbk": simplifiedchinese.GBK,
+}
+
+// charsetSink converts the values of the text columns in the non-utf8
+// charsets into utf8 before the DMLs are emitted to the backend sink, so the
+// downstream of utf8mb4 doesn't store the raw bytes of the other charsets.
+// The DMLs passed in are not modified.
+type charsetSink struct {
+	backend    Sink
+	infoGetter TableInfoGetter
+	encodings  map[string]encoding.Encoding
+}
+
+var _ Sink = &charsetSink{}
+
+// NewCharsetSink wraps the sink to convert the values of the text columns in
+// the charsets into utf8.
+func NewCharsetSink(backend Sink, infoGetter TableInfoGetter, charsets []string) (Sink, error) {
+	encodings := make(map[string]encoding.Encoding, len(charsets))
+	for _, cs := range charsets {
+		cs = strings.ToLower(cs)
+		enc, ok := charsetEncodings[cs]
+		if !ok {
+			return nil, errors.Errorf("unsupported charset to convert: %s", cs)
+		}
+		encodings[cs] = enc
+	}
+	return &charsetSink{
+		backend:    backend,
+		infoGetter: infoGetter,
+		encodings:  encodings,
+	}, nil
+}
+
+// EmitDMLs implements Sink interface.
+func (s *charsetSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	converted := make([]model.Txn, len(txns))
+	for i, txn := range txns {
+		converted[i] = txn
+		converted[i].DMLs = make([]*model.DML, len(txn.DMLs))
+		for j, dml := range txn.DMLs {
+			dml, err := s.convertDML(dml)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			converted[i].DMLs[j] = dml
+		}
+	}
+	return errors.Trace(s.backend.EmitDMLs(ctx, converted...))
+}
+
+// EmitDDL implements Sink interface.
+func (s *charsetSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *charsetSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	ts, err := s.backend.FlushCheckpoint(ctx, ts)
+	return ts, errors.Trace(err)
+}
+
+// Close implements Sink interface.
+func (s *charsetSink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
+
+func (s *charsetSink) convertDML(dml *model.DML) (*model.DML, error) {
+	info, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
+	if !ok {
+		return dml, nil
+	}
+	encodings := make(map[string]encoding.Encoding)
+	for name := range dml.Values {
+		cs, ok := info.ColumnCharset(name)
+		if !ok {
+			continue
+		}
+		if enc, ok := s.encodings[strings.ToLower(cs.Charset)]; ok {
+			encodings[name] = enc
+		}
+	}
+	if len(encodings) == 0 {
+		return dml, nil
+	}
+	converted := *dml
+	var err error
+	if converted.Values, err = convertValues(dml.Values, encodings); err != nil {
+		return nil, errors.Annotatef(err, "convert the values of %s", dml.TableName())
+	}
+	if converted.OldValues, err = convertValues(dml.OldValues, encodings); err != nil {
+		return nil, errors.Annotatef(err, "convert the old values of %s", dml.TableName())
+	}
+	return &converted, nil
+}
+
+// convertValues returns a copy of the values with the text columns decoded by
+// their encodings into utf8 strings.
+func convertValues(values map[string]types.Datum, encodings map[string]encoding.Encoding) (map[string]types.Datum, error) {
+	if values == nil {
+		return nil, nil
+	}
+	converted := make(map[string]types.Datum, len(values))
+	for name, datum := range values {
+		enc, ok := encodings[name]
+		if ok && (datum.Kind() == types.KindString || datum.Kind() == types.KindBytes) {
+			b, err := enc.NewDecoder().Bytes(datum.GetBytes())
+			if err != nil {
+				return nil, errors.Annotatef(err, "column %s", name)
+			}
+			datum = types.NewStringDatum(string(b))
+		}
+		converted[name] = datum
+	}
+	return converted, nil
+}
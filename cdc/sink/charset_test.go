@@ -0,0 +1,84 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/tidb/types"
+)
+
+type charsetSuite struct{}
+
+var _ = check.Suite(&charsetSuite{})
+
+type gbkTableHelper struct {
+	tableHelper
+}
+
+func (h *gbkTableHelper) GetTableByName(db, table string) (*schema.TableInfo, bool) {
+	info, _ := h.TableByID(42)
+	if table == "user" {
+		info.Columns[1].Charset = "gbk"
+	}
+	return schema.WrapTableInfo(info.TableInfo), true
+}
+
+func (s *charsetSuite) TestConvertibleCharsets(c *check.C) {
+	for _, cs := range model.ConvertibleCharsets {
+		_, ok := charsetEncodings[cs]
+		c.Assert(ok, check.IsTrue, check.Commentf("%s", cs))
+	}
+	_, err := NewCharsetSink(&recordingSink{}, &gbkTableHelper{}, []string{"utf16"})
+	c.Assert(err, check.ErrorMatches, "unsupported charset to convert: utf16")
+}
+
+func (s *charsetSuite) TestCharsetSink(c *check.C) {
+	backend := &recordingSink{}
+	sink, err := NewCharsetSink(backend, &gbkTableHelper{}, []string{"GBK"})
+	c.Assert(err, check.IsNil)
+
+	// "中文" in gbk
+	gbk := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	update := newTestDML(model.UpdateDMLType, "user", 1, gbk)
+	update.OldValues = map[string]types.Datum{
+		"id":   types.NewDatum(1),
+		"name": types.NewBytesDatum(gbk[:2]),
+	}
+	null := newTestDML(model.InsertDMLType, "user", 2, nil)
+	other := newTestDML(model.InsertDMLType, "order", 3, gbk)
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{update, null, other}})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(backend.txns, check.HasLen, 1)
+	dmls := backend.txns[0].DMLs
+	c.Assert(dmls, check.HasLen, 3)
+	name := dmls[0].Values["name"]
+	c.Assert(name.GetString(), check.Equals, "中文")
+	name = dmls[0].OldValues["name"]
+	c.Assert(name.GetString(), check.Equals, "中")
+	id := dmls[0].Values["id"]
+	c.Assert(id.GetInt64(), check.Equals, int64(1))
+	name = dmls[1].Values["name"]
+	c.Assert(name.IsNull(), check.IsTrue)
+	// the columns of the other charsets are not converted
+	c.Assert(dmls[2], check.Equals, other)
+
+	// the DMLs passed in are not modified
+	name = update.Values["name"]
+	c.Assert(name.GetBytes(), check.DeepEquals, gbk)
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type clickHouseSuite struct{}
+
+var _ = check.Suite(&clickHouseSuite{})
+
+func (s *clickHouseSuite) TestShouldBatchInsertByTable(c *check.C) {
+	var mu sync.Mutex
+	var queries []string
+	var bodies [][]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, _ := req.BasicAuth()
+		c.Assert(user, check.Equals, "default")
+		c.Assert(password, check.Equals, "pass")
+		data, err := ioutil.ReadAll(req.Body)
+		c.Assert(err, check.IsNil)
+		var rows []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			row := make(map[string]interface{})
+			c.Assert(json.Unmarshal([]byte(line), &row), check.IsNil)
+			rows = append(rows, row)
+		}
+		mu.Lock()
+		queries = append(queries, req.URL.Query().Get("query"))
+		bodies = append(bodies, rows)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	u, err := url.Parse("clickhouse://default:pass@" + strings.TrimPrefix(server.URL, "http://") + "/?max-batch-rows=2")
+	c.Assert(err, check.IsNil)
+	sink, err := NewClickHouseSink(u, &tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+
+	newDML := func(table string, tp model.DMLType, id int) *model.DML {
+		return &model.DML{
+			Database: "test",
+			Table:    table,
+			Tp:       tp,
+			Values: map[string]dbtypes.Datum{
+				"id":   dbtypes.NewDatum(id),
+				"name": dbtypes.NewDatum("tester"),
+			},
+		}
+	}
+	txns := []model.Txn{
+		{Ts: 10, DMLs: []*model.DML{newDML("t1", model.InsertDMLType, 1), newDML("t2", model.InsertDMLType, 1)}},
+		{Ts: 11, DMLs: []*model.DML{newDML("t1", model.InsertDMLType, 2)}},
+		{Ts: 12, DMLs: []*model.DML{newDML("t1", model.DeleteDMLType, 1)}},
+	}
+	err = sink.EmitDMLs(context.Background(), txns...)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(queries, check.DeepEquals, []string{
+		"INSERT INTO `test`.`t1` FORMAT JSONEachRow",
+		"INSERT INTO `test`.`t1` FORMAT JSONEachRow",
+		"INSERT INTO `test`.`t2` FORMAT JSONEachRow",
+	})
+	c.Assert(bodies[0], check.HasLen, 2)
+	c.Assert(bodies[1], check.HasLen, 1)
+	c.Assert(bodies[1][0]["id"], check.Equals, float64(1))
+	c.Assert(bodies[1][0]["name"], check.Equals, "tester")
+	c.Assert(bodies[1][0][defaultClickHouseVersionColumn], check.Equals, float64(12))
+	c.Assert(bodies[1][0][defaultClickHouseDeleteColumn], check.Equals, float64(1))
+	c.Assert(bodies[2][0][defaultClickHouseDeleteColumn], check.Equals, float64(0))
+}
+
+func (s *clickHouseSuite) TestShouldReturnErrorOnFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Code: 60, e.displayText() = DB::Exception: Table test.t1 doesn't exist."))
+	}))
+	defer server.Close()
+
+	u, err := url.Parse("clickhouse://" + strings.TrimPrefix(server.URL, "http://") + "/")
+	c.Assert(err, check.IsNil)
+	sink, err := NewClickHouseSink(u, nil, nil)
+	c.Assert(err, check.IsNil)
+
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{{
+		Database: "test",
+		Table:    "t1",
+		Tp:       model.InsertDMLType,
+		Values:   map[string]dbtypes.Datum{"id": dbtypes.NewDatum(1)},
+	}}})
+	c.Assert(err, check.ErrorMatches, ".*doesn't exist.*")
+}
+
+func (s *clickHouseSuite) TestNewSinkByScheme(c *check.C) {
+	sink, err := NewSink("clickhouse://127.0.0.1:8123/", nil, nil)
+	c.Assert(err, check.IsNil)
+	_, ok := sink.(*clickHouseSink)
+	c.Assert(ok, check.IsTrue)
+
+	_, err = NewSink("unknown://127.0.0.1:8123/", nil, nil)
+	c.Assert(err, check.ErrorMatches, ".*unsupported sink scheme.*")
+}
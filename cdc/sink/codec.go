@@ -0,0 +1,434 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"runtime"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/config"
+	"golang.org/x/sync/errgroup"
+)
+
+// event types of the messages
+const (
+	eventTypeInsert = "insert"
+	eventTypeUpdate = "update"
+	eventTypeDelete = "delete"
+	eventTypeDDL    = "ddl"
+	// the markers around the rows of a transaction
+	eventTypeBegin  = "begin"
+	eventTypeCommit = "commit"
+)
+
+// mqEvent is the json format of a change in the message queue sinks.
+type mqEvent struct {
+	Ts     uint64                 `json:"ts"`
+	Schema string                 `json:"schema"`
+	Table  string                 `json:"table"`
+	Type   string                 `json:"type"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	// Old is the row before the update if the old value is enabled
+	Old   map[string]interface{} `json:"old,omitempty"`
+	Query string                 `json:"query,omitempty"`
+	// the number of rows between the begin and commit markers
+	Rows int `json:"rows,omitempty"`
+	// Txn describes the whole transaction in the markers
+	Txn *mqTxnInfo `json:"txn,omitempty"`
+}
+
+// mqTxnInfo tells the consumer how a transaction is split by the partition
+// keys, the transaction is complete once the commit markers of all the
+// partitions are received, which carry the rows of the whole transaction.
+type mqTxnInfo struct {
+	// Rows is the number of the rows of the transaction
+	Rows int `json:"rows"`
+	// Partition is the index of the partition key in the transaction
+	Partition int `json:"partition"`
+	// Partitions is the number of the partition keys of the transaction
+	Partitions int `json:"partitions"`
+}
+
+// The values of the row messages larger than the compression threshold are
+// compressed if the compression is enabled. A compressed value starts with a
+// header byte telling the codec, followed by the compressed json, while an
+// uncompressed value is the plain json starting with '{', so the consumers can
+// tell them apart by the first byte.
+const (
+	mqHeaderSnappy byte = 0x01
+	mqHeaderZstd   byte = 0x02
+
+	defaultMQCompressionThreshold = 4096
+)
+
+// mqMessage is an encoded event with the partition key.
+type mqMessage struct {
+	key   string
+	value []byte
+}
+
+// truncateUTF8 truncates the key within n bytes on a rune boundary, so that the
+// key is still valid UTF-8.
+func truncateUTF8(key string, n int) string {
+	if len(key) <= n {
+		return key
+	}
+	for n > 0 && !utf8.RuneStart(key[n]) {
+		n--
+	}
+	return key[:n]
+}
+
+// mqEncoder encodes the transactions into messages for the message queue sinks.
+type mqEncoder struct {
+	infoGetter TableInfoGetter
+	dispatcher dispatcher
+	// protocol is the format of the row messages, the rows are encoded as
+	// mqEvent by default or as the Debezium change events.
+	protocol string
+	// txnMarker wraps the rows of a transaction with begin and commit markers.
+	txnMarker bool
+
+	compression          byte
+	compressionThreshold int
+	zstdEncoder          *zstd.Encoder
+
+	// concurrency is the number of workers encoding the transactions.
+	concurrency int
+	// changefeedID labels the metrics of the encoder.
+	changefeedID string
+}
+
+// defaultEncoderConcurrency returns a quarter of GOMAXPROCS, the rest is left
+// to the puller, the mounter and the other changefeeds on the capture.
+func defaultEncoderConcurrency() int {
+	n := runtime.GOMAXPROCS(0) / 4
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// the parameters of the sink uri shared by the sinks of the message queues
+var (
+	mqProtocolParam             = config.StringParam("protocol", mqProtocolDefault, mqProtocolDebezium)
+	mqTxnMarkerParam            = config.BoolParam("txn-marker")
+	mqCompressionParam          = config.StringParam("compression", "none", "snappy", "zstd")
+	mqCompressionThresholdParam = config.IntParam("compression-threshold", 0)
+	mqEncoderConcurrencyParam   = config.IntParam("encoder-concurrency", 1)
+	mqPartitionKeyParam         = config.StringParam("partition-key", "table", "pk", "ts")
+)
+
+// mqParams returns the parameters of a message queue sink, including the
+// parameters of the encoder.
+func mqParams(params ...*config.Param) []*config.Param {
+	return append([]*config.Param{mqProtocolParam, mqTxnMarkerParam, mqCompressionParam,
+		mqCompressionThresholdParam, mqEncoderConcurrencyParam}, params...)
+}
+
+// newMQEncoder creates the encoder with the parameters of the sink uri, the
+// `protocol=debezium` parameter makes the rows encoded as the Debezium change
+// events, which can be consumed by the Flink CDC connectors directly.
+func newMQEncoder(infoGetter TableInfoGetter, dispatcher dispatcher, params url.Values) (*mqEncoder, error) {
+	e := &mqEncoder{infoGetter: infoGetter, dispatcher: dispatcher}
+	var err error
+	e.protocol, err = mqProtocolParam.String(params, mqProtocolDefault)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	e.txnMarker, err = mqTxnMarkerParam.Bool(params, false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if e.txnMarker && e.protocol == mqProtocolDebezium {
+		return nil, errors.New("txn-marker is not supported by the debezium protocol")
+	}
+
+	compression, err := mqCompressionParam.String(params, "none")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch compression {
+	case "snappy":
+		e.compression = mqHeaderSnappy
+	case "zstd":
+		e.compression = mqHeaderZstd
+		e.zstdEncoder, err = zstd.NewWriter(nil)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	e.compressionThreshold, err = mqCompressionThresholdParam.Int(params, defaultMQCompressionThreshold)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	e.concurrency, err = mqEncoderConcurrencyParam.Int(params, defaultEncoderConcurrency())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return e, nil
+}
+
+// applyOpts applies the sink options set by the processor, the feature flags of
+// the changefeed override the parameters of the sink uri.
+func (e *mqEncoder) applyOpts(opts map[string]string) {
+	e.changefeedID = opts[OptChangefeedID]
+	if enabled, ok := featureOpt(opts, model.FeatureTxnMarker); ok && e.protocol != mqProtocolDebezium {
+		e.txnMarker = enabled
+	}
+}
+
+// encodeTxns encodes the transactions with a pool of workers, the messages are
+// returned in the order of the transactions.
+func (e *mqEncoder) encodeTxns(ctx context.Context, txns []model.Txn) ([]*mqMessage, error) {
+	workers := e.concurrency
+	if workers > len(txns) {
+		workers = len(txns)
+	}
+	encodeWorkerGauge.WithLabelValues(e.changefeedID).Set(float64(e.concurrency))
+	busySeconds := encodeBusySecondsCounter.WithLabelValues(e.changefeedID)
+
+	results := make([][]*mqMessage, len(txns))
+	jobs := make(chan int, len(txns))
+	for i := range txns {
+		jobs <- i
+	}
+	close(jobs)
+	errg, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < workers; i++ {
+		errg.Go(func() error {
+			start := time.Now()
+			defer func() {
+				busySeconds.Add(time.Since(start).Seconds())
+			}()
+			for idx := range jobs {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
+				msgs, err := e.encodeTxn(txns[idx])
+				if err != nil {
+					return errors.Trace(err)
+				}
+				results[idx] = msgs
+			}
+			return nil
+		})
+	}
+	if err := errg.Wait(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var count, size int
+	for _, msgs := range results {
+		count += len(msgs)
+	}
+	all := make([]*mqMessage, 0, count)
+	for _, msgs := range results {
+		for _, msg := range msgs {
+			size += len(msg.value)
+		}
+		all = append(all, msgs...)
+	}
+	encodedMessageCounter.WithLabelValues(e.changefeedID).Add(float64(count))
+	encodedBytesCounter.WithLabelValues(e.changefeedID).Add(float64(size))
+	return all, nil
+}
+
+// encodeTxn encodes every DML of the transaction into a message. If the txn
+// markers are enabled, the messages of each partition key are wrapped with the
+// begin and commit markers carrying the number of the rows of the key, along
+// with the rows and the partition keys of the whole transaction, so the
+// consumers can tell when all the parts of a transaction are received.
+func (e *mqEncoder) encodeTxn(txn model.Txn) ([]*mqMessage, error) {
+	msgs, err := e.encodeRows(txn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !e.txnMarker || len(msgs) == 0 {
+		return msgs, nil
+	}
+
+	var keys []string
+	grouped := make(map[string][]*mqMessage)
+	for _, msg := range msgs {
+		if _, ok := grouped[msg.key]; !ok {
+			keys = append(keys, msg.key)
+		}
+		grouped[msg.key] = append(grouped[msg.key], msg)
+	}
+	wrapped := make([]*mqMessage, 0, len(msgs)+2*len(keys))
+	for i, key := range keys {
+		rows := grouped[key]
+		info := &mqTxnInfo{Rows: len(msgs), Partition: i, Partitions: len(keys)}
+		begin, err := e.encodeMarker(key, eventTypeBegin, txn.Ts, len(rows), info)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		commit, err := e.encodeMarker(key, eventTypeCommit, txn.Ts, len(rows), info)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		wrapped = append(wrapped, begin)
+		wrapped = append(wrapped, rows...)
+		wrapped = append(wrapped, commit)
+	}
+	return wrapped, nil
+}
+
+func (e *mqEncoder) encodeMarker(key string, tp string, ts uint64, rows int, info *mqTxnInfo) (*mqMessage, error) {
+	value, err := json.Marshal(&mqEvent{Ts: ts, Type: tp, Rows: rows, Txn: info})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &mqMessage{key: key, value: value}, nil
+}
+
+func (e *mqEncoder) encodeRows(txn model.Txn) ([]*mqMessage, error) {
+	msgs := make([]*mqMessage, 0, len(txn.DMLs))
+	for _, dml := range txn.DMLs {
+		tableInfo, ok := e.infoGetter.GetTableByName(dml.Database, dml.Table)
+		if !ok {
+			return nil, errors.Errorf("table not found: %s", dml.TableName())
+		}
+		if err := formatValues(tableInfo, dml.Values); err != nil {
+			return nil, errors.Trace(err)
+		}
+		key := e.dispatcher.partitionKey(txn.Ts, dml, tableInfo)
+		if e.protocol == mqProtocolDebezium {
+			value, err := e.encodeDebezium(txn.Ts, dml, tableInfo)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			msgs = append(msgs, &mqMessage{key: key, value: e.compress(value)})
+			continue
+		}
+
+		schema, table := dml.TargetName()
+		event := &mqEvent{
+			Ts:     txn.Ts,
+			Schema: schema,
+			Table:  table,
+			Data:   make(map[string]interface{}, len(dml.Values)),
+		}
+		switch dml.Tp {
+		case model.InsertDMLType:
+			event.Type = eventTypeInsert
+		case model.UpdateDMLType:
+			event.Type = eventTypeUpdate
+		case model.DeleteDMLType:
+			event.Type = eventTypeDelete
+		default:
+			return nil, errors.Errorf("invalid dml type: %v", dml.Tp)
+		}
+		for name, value := range dml.Values {
+			event.Data[name] = jsonValue(value)
+		}
+		if dml.Tp == model.UpdateDMLType && dml.OldValues != nil {
+			if err := formatValues(tableInfo, dml.OldValues); err != nil {
+				return nil, errors.Trace(err)
+			}
+			event.Old = make(map[string]interface{}, len(dml.OldValues))
+			for name, value := range dml.OldValues {
+				event.Old[name] = jsonValue(value)
+			}
+		}
+
+		value, err := json.Marshal(event)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		value = e.compress(value)
+		msgs = append(msgs, &mqMessage{
+			key:   key,
+			value: value,
+		})
+	}
+	return msgs, nil
+}
+
+// encodeDDL encodes the DDL into a message, the message is partitioned by the
+// table name. No message is returned with the debezium protocol, since the
+// consumers of the Debezium change events can't parse the DDL events.
+func (e *mqEncoder) encodeDDL(txn model.Txn) (*mqMessage, error) {
+	if !txn.IsDDL() {
+		return nil, errors.New("not a DDL")
+	}
+	if e.protocol == mqProtocolDebezium {
+		return nil, nil
+	}
+	value, err := json.Marshal(&mqEvent{
+		Ts:     txn.Ts,
+		Schema: txn.DDL.Database,
+		Table:  txn.DDL.Table,
+		Type:   eventTypeDDL,
+		Query:  txn.DDL.Job.Query,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &mqMessage{
+		key:   tablePartitionKey(txn.DDL.Database, txn.DDL.Table),
+		value: value,
+	}, nil
+}
+
+// compress compresses the value if it's larger than the threshold.
+func (e *mqEncoder) compress(value []byte) []byte {
+	if e.compression == 0 || len(value) < e.compressionThreshold {
+		return value
+	}
+	switch e.compression {
+	case mqHeaderSnappy:
+		buf := make([]byte, 1+snappy.MaxEncodedLen(len(value)))
+		buf[0] = mqHeaderSnappy
+		n := len(snappy.Encode(buf[1:], value))
+		return buf[:1+n]
+	case mqHeaderZstd:
+		return e.zstdEncoder.EncodeAll(value, []byte{mqHeaderZstd})
+	}
+	return value
+}
+
+// decodeMQValue returns the json of a message value, the value is decompressed
+// by the codec in the header if it's compressed.
+func decodeMQValue(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	switch value[0] {
+	case mqHeaderSnappy:
+		data, err := snappy.Decode(nil, value[1:])
+		return data, errors.Trace(err)
+	case mqHeaderZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defer decoder.Close()
+		data, err := decoder.DecodeAll(value[1:], nil)
+		return data, errors.Trace(err)
+	default:
+		return value, nil
+	}
+}
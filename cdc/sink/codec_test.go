@@ -0,0 +1,185 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type codecSuite struct{}
+
+var _ = check.Suite(&codecSuite{})
+
+func (s *codecSuite) TestTruncateUTF8(c *check.C) {
+	for _, limit := range []int{kinesisMaxPartitionKeySize, pubSubMaxOrderingKeySize} {
+		short := "test.t1"
+		c.Assert(truncateUTF8(short, limit), check.Equals, short)
+
+		ascii := strings.Repeat("a", limit+10)
+		c.Assert(truncateUTF8(ascii, limit), check.Equals, ascii[:limit])
+
+		// the 3-byte characters don't end at the limit
+		multi := "a" + strings.Repeat("表", limit)
+		key := truncateUTF8(multi, limit)
+		c.Assert(utf8.ValidString(key), check.IsTrue)
+		c.Assert(len(key), check.Equals, 1+(limit-1)/3*3)
+		c.Assert(strings.HasPrefix(multi, key), check.IsTrue)
+	}
+}
+
+func (s *codecSuite) TestTxnMarker(c *check.C) {
+	encoder, err := newMQEncoder(&tableHelper{}, pkDispatcher{}, url.Values{})
+	c.Assert(err, check.IsNil)
+	msgs, err := encoder.encodeTxn(newTestTxn(10, "t1", 1, 2, 1))
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 3)
+
+	encoder, err = newMQEncoder(&tableHelper{}, pkDispatcher{}, url.Values{"txn-marker": {"true"}})
+	c.Assert(err, check.IsNil)
+	msgs, err = encoder.encodeTxn(newTestTxn(10, "t1", 1, 2, 1))
+	c.Assert(err, check.IsNil)
+	expected := []struct {
+		key  string
+		tp   string
+		rows int
+		txn  *mqTxnInfo
+	}{
+		{"test.t1_1_tester", eventTypeBegin, 2, &mqTxnInfo{Rows: 3, Partition: 0, Partitions: 2}},
+		{"test.t1_1_tester", eventTypeInsert, 0, nil},
+		{"test.t1_1_tester", eventTypeInsert, 0, nil},
+		{"test.t1_1_tester", eventTypeCommit, 2, &mqTxnInfo{Rows: 3, Partition: 0, Partitions: 2}},
+		{"test.t1_2_tester", eventTypeBegin, 1, &mqTxnInfo{Rows: 3, Partition: 1, Partitions: 2}},
+		{"test.t1_2_tester", eventTypeInsert, 0, nil},
+		{"test.t1_2_tester", eventTypeCommit, 1, &mqTxnInfo{Rows: 3, Partition: 1, Partitions: 2}},
+	}
+	c.Assert(msgs, check.HasLen, len(expected))
+	for i, e := range expected {
+		event := decodeEvent(c, msgs[i].value)
+		c.Assert(msgs[i].key, check.Equals, e.key)
+		c.Assert(event.Type, check.Equals, e.tp)
+		c.Assert(event.Rows, check.Equals, e.rows)
+		c.Assert(event.Txn, check.DeepEquals, e.txn)
+		c.Assert(event.Ts, check.Equals, uint64(10))
+	}
+	// the partition index 0 is encoded explicitly
+	c.Assert(string(msgs[0].value), check.Matches, `.*"txn":\{"rows":3,"partition":0,"partitions":2\}.*`)
+
+	// no markers for the empty txns
+	msgs, err = encoder.encodeTxn(newTestTxn(11, "t1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 0)
+
+	_, err = newMQEncoder(&tableHelper{}, pkDispatcher{}, url.Values{"txn-marker": {"maybe"}})
+	c.Assert(err, check.ErrorMatches, ".*invalid txn-marker.*")
+
+	// the feature flag of the changefeed overrides the parameter
+	encoder.applyOpts(map[string]string{model.FeatureOptPrefix + model.FeatureTxnMarker: "false"})
+	c.Assert(encoder.txnMarker, check.IsFalse)
+}
+
+func (s *codecSuite) TestOldValue(c *check.C) {
+	encoder, err := newMQEncoder(&tableHelper{}, pkDispatcher{}, url.Values{})
+	c.Assert(err, check.IsNil)
+	txn := newTestTxn(10, "t1", 1, 2)
+	txn.DMLs[0].Tp = model.UpdateDMLType
+	txn.DMLs[0].OldValues = map[string]dbtypes.Datum{
+		"id":   dbtypes.NewDatum(1),
+		"name": dbtypes.NewDatum("old"),
+	}
+	msgs, err := encoder.encodeTxn(txn)
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 2)
+
+	event := decodeEvent(c, msgs[0].value)
+	c.Assert(event.Type, check.Equals, eventTypeUpdate)
+	c.Assert(event.Data["name"], check.Equals, "tester")
+	c.Assert(event.Old["name"], check.Equals, "old")
+	// the old values are only encoded with the updates
+	c.Assert(decodeEvent(c, msgs[1].value).Old, check.IsNil)
+}
+
+func (s *codecSuite) TestCompression(c *check.C) {
+	txn := newTestTxn(10, "t1", 1, 2)
+	txn.DMLs[1].Values["name"] = dbtypes.NewDatum(strings.Repeat("large text ", 100))
+
+	for _, tc := range []struct {
+		compression string
+		header      byte
+	}{
+		{"snappy", mqHeaderSnappy},
+		{"ZSTD", mqHeaderZstd},
+	} {
+		encoder, err := newMQEncoder(&tableHelper{}, tableDispatcher{}, url.Values{
+			"compression":           {tc.compression},
+			"compression-threshold": {"512"},
+		})
+		c.Assert(err, check.IsNil)
+		msgs, err := encoder.encodeTxn(txn)
+		c.Assert(err, check.IsNil)
+		c.Assert(msgs, check.HasLen, 2)
+		// the small value is not compressed
+		c.Assert(msgs[0].value[0], check.Equals, byte('{'))
+		c.Assert(msgs[1].value[0], check.Equals, tc.header)
+		c.Assert(len(msgs[1].value), check.Less, 512)
+		for _, msg := range msgs {
+			value, err := decodeMQValue(msg.value)
+			c.Assert(err, check.IsNil)
+			event := decodeEvent(c, value)
+			c.Assert(event.Type, check.Equals, eventTypeInsert)
+		}
+		value, err := decodeMQValue(msgs[1].value)
+		c.Assert(err, check.IsNil)
+		c.Assert(decodeEvent(c, value).Data["name"], check.Equals, strings.Repeat("large text ", 100))
+	}
+
+	_, err := newMQEncoder(&tableHelper{}, tableDispatcher{}, url.Values{"compression": {"lz4"}})
+	c.Assert(err, check.ErrorMatches, ".*unsupported compression: lz4.*")
+}
+
+func (s *codecSuite) TestEncodeTxnsConcurrently(c *check.C) {
+	encoder, err := newMQEncoder(&tableHelper{}, tsDispatcher{}, url.Values{"encoder-concurrency": {"4"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(encoder.concurrency, check.Equals, 4)
+
+	var txns []model.Txn
+	for i := 0; i < 50; i++ {
+		txns = append(txns, newTestTxn(uint64(i), "t1", i, i+1))
+	}
+	msgs, err := encoder.encodeTxns(context.Background(), txns)
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 100)
+	for i, msg := range msgs {
+		event := decodeEvent(c, msg.value)
+		c.Assert(event.Ts, check.Equals, uint64(i/2))
+		c.Assert(event.Data["id"], check.Equals, float64(i/2+i%2))
+	}
+
+	// the error of a transaction fails the whole batch
+	txns[10].DMLs[0].Tp = model.DMLType(100)
+	_, err = encoder.encodeTxns(context.Background(), txns)
+	c.Assert(err, check.ErrorMatches, ".*invalid dml type.*")
+
+	encoder, err = newMQEncoder(&tableHelper{}, tsDispatcher{}, url.Values{})
+	c.Assert(err, check.IsNil)
+	c.Assert(encoder.concurrency, check.Equals, defaultEncoderConcurrency())
+	_, err = newMQEncoder(&tableHelper{}, tsDispatcher{}, url.Values{"encoder-concurrency": {"0"}})
+	c.Assert(err, check.ErrorMatches, ".*invalid encoder-concurrency: 0.*")
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/tidb/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// compactSink merges the changes of the same row in the transactions of an
+// EmitDMLs call into one change, so only the last state of the row is written
+// to the backend sink. The merged change takes the place of the last change of
+// the row, and the transactions left without changes are dropped, so the
+// upstream transactions are not atomic in the downstream any more.
+//
+// A row is identified by the values of the unique key of its table. The tables
+// with more than one unique key, and the tables with a change not identified
+// by the unique key, like a NULL value in the key or an update of the key, are
+// not compacted, since their changes may conflict on more than one key.
+type compactSink struct {
+	backend    Sink
+	infoGetter TableInfoGetter
+	compacted  prometheus.Counter
+}
+
+var _ Sink = &compactSink{}
+
+// NewCompactSink wraps the sink to compact the changes of the same row.
+func NewCompactSink(backend Sink, changefeedID string, infoGetter TableInfoGetter) Sink {
+	return &compactSink{
+		backend:    backend,
+		infoGetter: infoGetter,
+		compacted:  compactedDMLCounter.WithLabelValues(changefeedID),
+	}
+}
+
+// EmitDMLs implements Sink interface.
+func (s *compactSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	txns, n := compactTxns(txns, s.rowKey)
+	s.compacted.Add(float64(n))
+	if len(txns) == 0 {
+		return nil
+	}
+	return errors.Trace(s.backend.EmitDMLs(ctx, txns...))
+}
+
+// EmitDDL implements Sink interface.
+func (s *compactSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *compactSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	ts, err := s.backend.FlushCheckpoint(ctx, ts)
+	return ts, errors.Trace(err)
+}
+
+// Close implements Sink interface.
+func (s *compactSink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
+
+func (s *compactSink) rowKey(dml *model.DML) (string, bool) {
+	return compactRowKey(s.infoGetter, dml)
+}
+
+// compactRowKey returns the key of the row changed by the DML, ok is false if
+// the row isn't identified by the only unique key of the table, including the
+// ones with nullable columns.
+func compactRowKey(infoGetter TableInfoGetter, dml *model.DML) (string, bool) {
+	info, ok := infoGetter.GetTableByName(dml.Database, dml.Table)
+	if !ok || len(info.UniqueKeys(true)) != 1 {
+		return "", false
+	}
+	key, ok := compactKey(info, dml.Values)
+	if !ok {
+		return "", false
+	}
+	if dml.Tp == model.UpdateDMLType && dml.OldValues != nil {
+		oldKey, ok := compactKey(info, dml.OldValues)
+		if !ok || oldKey != key {
+			return "", false
+		}
+	}
+	return key, true
+}
+
+func compactKey(info *schema.TableInfo, values map[string]types.Datum) (string, bool) {
+	_, keyValues, ok := uniqueKeySlice(info, values)
+	if !ok {
+		return "", false
+	}
+	var b strings.Builder
+	for _, v := range keyValues {
+		fmt.Fprintf(&b, "%v\x00", v.GetValue())
+	}
+	return b.String(), true
+}
+
+type compactLocation struct {
+	txn int
+	dml int
+}
+
+// compactTxns merges the DMLs of the same row and returns the transactions
+// with the merged DMLs and the number of the removed DMLs. The transactions
+// and the DMLs passed in are not modified.
+func compactTxns(txns []model.Txn, rowKey func(dml *model.DML) (string, bool)) ([]model.Txn, int) {
+	// the tables can't be compacted if any of their DMLs has no row key
+	keys := make([][]string, len(txns))
+	skipped := make(map[string]struct{})
+	for i, txn := range txns {
+		keys[i] = make([]string, len(txn.DMLs))
+		for j, dml := range txn.DMLs {
+			key, ok := rowKey(dml)
+			if !ok {
+				skipped[dml.TableName()] = struct{}{}
+				continue
+			}
+			keys[i][j] = dml.TableName() + "\x00" + key
+		}
+	}
+
+	// merge the DMLs of a row into the location of the last one
+	merged := make(map[compactLocation]*model.DML)
+	last := make(map[string]compactLocation)
+	removed := 0
+	for i, txn := range txns {
+		for j, dml := range txn.DMLs {
+			if _, ok := skipped[dml.TableName()]; ok {
+				continue
+			}
+			loc := compactLocation{txn: i, dml: j}
+			key := keys[i][j]
+			if prevLoc, ok := last[key]; ok {
+				prev := merged[prevLoc]
+				delete(merged, prevLoc)
+				dml = mergeDML(prev, dml)
+				removed++
+			}
+			merged[loc] = dml
+			last[key] = loc
+		}
+	}
+	if removed == 0 {
+		return txns, 0
+	}
+
+	result := make([]model.Txn, 0, len(txns))
+	for i, txn := range txns {
+		dmls := make([]*model.DML, 0, len(txn.DMLs))
+		for j, dml := range txn.DMLs {
+			if _, ok := skipped[dml.TableName()]; ok {
+				dmls = append(dmls, dml)
+				continue
+			}
+			if m, ok := merged[compactLocation{txn: i, dml: j}]; ok {
+				dmls = append(dmls, m)
+			}
+		}
+		if len(dmls) == 0 {
+			continue
+		}
+		txn.DMLs = dmls
+		result = append(result, txn)
+	}
+	return result, removed
+}
+
+// mergeDML returns the change of a row equivalent to prev followed by next.
+// The inserts are written as upserts by the mounter, so an insert after an
+// insert or an update is an update of the row.
+func mergeDML(prev, next *model.DML) *model.DML {
+	if next.Tp == model.DeleteDMLType {
+		// the row may exist before prev, so it's always deleted
+		return next
+	}
+	m := *next
+	switch prev.Tp {
+	case model.InsertDMLType:
+		// the row is created by prev
+		m.Tp = model.InsertDMLType
+		m.OldValues = nil
+	case model.UpdateDMLType:
+		m.Tp = model.UpdateDMLType
+		m.OldValues = prev.OldValues
+	case model.DeleteDMLType:
+		// the row deleted by prev is replaced
+		m.Tp = model.UpdateDMLType
+		m.OldValues = nil
+	}
+	return &m
+}
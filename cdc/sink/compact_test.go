@@ -0,0 +1,127 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/tidb/types"
+)
+
+type compactSuite struct{}
+
+var _ = check.Suite(&compactSuite{})
+
+// compactTableHelper returns the table with `id` as the primary key, except
+// the table `nokey` without any unique key.
+type compactTableHelper struct {
+	pkTableHelper
+}
+
+func (h *compactTableHelper) GetTableByName(schema, table string) (*schema.TableInfo, bool) {
+	if table == "nokey" {
+		return h.TableByID(42)
+	}
+	return h.pkTableHelper.GetTableByName(schema, table)
+}
+
+// recordingSink records the emitted transactions.
+type recordingSink struct {
+	mockBackendSink
+	txns []model.Txn
+}
+
+func (r *recordingSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	r.txns = append(r.txns, txns...)
+	return nil
+}
+
+func compactTestTxn(ts uint64, dmls ...*model.DML) model.Txn {
+	return model.Txn{Ts: ts, DMLs: dmls}
+}
+
+func compactTestName(values map[string]types.Datum) string {
+	name := values["name"]
+	return name.GetString()
+}
+
+func (s *compactSuite) TestCompact(c *check.C) {
+	backend := &recordingSink{}
+	sink := NewCompactSink(backend, "test", &compactTableHelper{})
+	insert1 := newTestDML(model.InsertDMLType, "t", 1, "a")
+	update1 := newTestDML(model.UpdateDMLType, "t", 1, "b")
+	insert2 := newTestDML(model.InsertDMLType, "t", 2, "a")
+	delete2 := newTestDML(model.DeleteDMLType, "t", 2, nil)
+	insert2Again := newTestDML(model.InsertDMLType, "t", 2, "c")
+	other := newTestDML(model.InsertDMLType, "t", 3, "a")
+	noKey1 := newTestDML(model.InsertDMLType, "nokey", 1, "a")
+	noKey2 := newTestDML(model.InsertDMLType, "nokey", 1, "b")
+	txns := []model.Txn{
+		compactTestTxn(1, insert1, insert2, noKey1),
+		compactTestTxn(2, update1, delete2),
+		compactTestTxn(3, insert2Again, other, noKey2),
+	}
+	c.Assert(sink.EmitDMLs(context.Background(), txns...), check.IsNil)
+
+	// the transactions passed in are not modified
+	c.Assert(txns[0].DMLs, check.HasLen, 3)
+	c.Assert(txns[1].DMLs[0].Tp, check.Equals, model.UpdateDMLType)
+
+	c.Assert(backend.txns, check.HasLen, 3)
+	c.Assert(backend.txns[0].Ts, check.Equals, uint64(1))
+	c.Assert(backend.txns[0].DMLs, check.DeepEquals, []*model.DML{noKey1})
+	// insert + update is an insert of the new values
+	c.Assert(backend.txns[1].Ts, check.Equals, uint64(2))
+	c.Assert(backend.txns[1].DMLs, check.HasLen, 1)
+	c.Assert(backend.txns[1].DMLs[0].Tp, check.Equals, model.InsertDMLType)
+	c.Assert(compactTestName(backend.txns[1].DMLs[0].Values), check.Equals, "b")
+	// insert + delete + insert replaces the row
+	c.Assert(backend.txns[2].Ts, check.Equals, uint64(3))
+	c.Assert(backend.txns[2].DMLs, check.HasLen, 3)
+	c.Assert(backend.txns[2].DMLs[0].Tp, check.Equals, model.UpdateDMLType)
+	c.Assert(backend.txns[2].DMLs[0].OldValues, check.IsNil)
+	c.Assert(compactTestName(backend.txns[2].DMLs[0].Values), check.Equals, "c")
+	c.Assert(backend.txns[2].DMLs[1:], check.DeepEquals, []*model.DML{other, noKey2})
+}
+
+func (s *compactSuite) TestMergeDML(c *check.C) {
+	insert := newTestDML(model.InsertDMLType, "t", 1, "a")
+	update := newTestDML(model.UpdateDMLType, "t", 1, "b")
+	update.OldValues = newTestDML(model.InsertDMLType, "t", 1, "old").Values
+	del := newTestDML(model.DeleteDMLType, "t", 1, nil)
+
+	c.Assert(mergeDML(insert, del), check.Equals, del)
+	c.Assert(mergeDML(update, del), check.Equals, del)
+
+	m := mergeDML(update, insert)
+	c.Assert(m.Tp, check.Equals, model.UpdateDMLType)
+	c.Assert(compactTestName(m.OldValues), check.Equals, "old")
+	c.Assert(compactTestName(m.Values), check.Equals, "a")
+
+	m = mergeDML(insert, update)
+	c.Assert(m.Tp, check.Equals, model.InsertDMLType)
+	c.Assert(m.OldValues, check.IsNil)
+
+	// an update of the unique key isn't compacted
+	keyUpdate := newTestDML(model.UpdateDMLType, "t", 2, "b")
+	keyUpdate.OldValues = insert.Values
+	txns := []model.Txn{compactTestTxn(1, insert, keyUpdate), compactTestTxn(2, update)}
+	helper := &compactTableHelper{}
+	result, n := compactTxns(txns, (&compactSink{infoGetter: helper}).rowKey)
+	c.Assert(n, check.Equals, 0)
+	c.Assert(result, check.DeepEquals, txns)
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// Kind is the type of the value of a parameter.
+type Kind int
+
+// the kinds of the parameters
+const (
+	KindString Kind = iota
+	KindBool
+	KindInt
+	KindDuration
+)
+
+// Param declares a parameter of the sink uri, the value is decoded and
+// checked by the declaration, so the sinks and the validation of the sink uri
+// share the same rules.
+type Param struct {
+	Name string
+	Kind Kind
+	// Min is the min value of an int or a duration parameter.
+	Min int64
+	// Enum is the valid values of a string parameter, they're matched case
+	// insensitively. Any value is valid if it's empty.
+	Enum []string
+	// Multiple is set if the parameter can be specified more than once.
+	Multiple bool
+}
+
+// StringParam declares a string parameter, the value should be one of enum
+// if it's not empty.
+func StringParam(name string, enum ...string) *Param {
+	return &Param{Name: name, Kind: KindString, Enum: enum}
+}
+
+// BoolParam declares a bool parameter.
+func BoolParam(name string) *Param {
+	return &Param{Name: name, Kind: KindBool}
+}
+
+// IntParam declares an int parameter not less than min.
+func IntParam(name string, min int64) *Param {
+	return &Param{Name: name, Kind: KindInt, Min: min}
+}
+
+// DurationParam declares a duration parameter not less than min.
+func DurationParam(name string, min time.Duration) *Param {
+	return &Param{Name: name, Kind: KindDuration, Min: int64(min)}
+}
+
+// Lookup returns the value of the parameter, ok is false if it's not set.
+func (p *Param) Lookup(values url.Values) (value string, ok bool) {
+	vs, ok := values[p.Name]
+	if !ok || len(vs) == 0 {
+		return "", false
+	}
+	return vs[0], true
+}
+
+// String returns the value of a string parameter, an enum value is returned
+// in lower case.
+func (p *Param) String(values url.Values, def string) (string, error) {
+	v, ok := p.Lookup(values)
+	if !ok || v == "" {
+		return def, nil
+	}
+	if len(p.Enum) == 0 {
+		return v, nil
+	}
+	v = strings.ToLower(v)
+	for _, e := range p.Enum {
+		if v == e {
+			return v, nil
+		}
+	}
+	return "", errors.Errorf("unsupported %s: %s, %s", p.Name, v, p.hint())
+}
+
+// Bool returns the value of a bool parameter.
+func (p *Param) Bool(values url.Values, def bool) (bool, error) {
+	v, ok := p.Lookup(values)
+	if !ok {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, p.invalid(v)
+	}
+	return b, nil
+}
+
+// Int returns the value of an int parameter.
+func (p *Param) Int(values url.Values, def int) (int, error) {
+	v, ok := p.Lookup(values)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || int64(n) < p.Min {
+		return 0, p.invalid(v)
+	}
+	return n, nil
+}
+
+// Duration returns the value of a duration parameter.
+func (p *Param) Duration(values url.Values, def time.Duration) (time.Duration, error) {
+	v, ok := p.Lookup(values)
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || int64(d) < p.Min {
+		return 0, p.invalid(v)
+	}
+	return d, nil
+}
+
+// Validate checks the value of the parameter if it's set.
+func (p *Param) Validate(values url.Values) error {
+	if vs := values[p.Name]; len(vs) > 1 && !p.Multiple {
+		return errors.Errorf("%s is specified %d times, it should be specified only once", p.Name, len(vs))
+	}
+	var err error
+	switch p.Kind {
+	case KindString:
+		_, err = p.String(values, "")
+	case KindBool:
+		_, err = p.Bool(values, false)
+	case KindInt:
+		_, err = p.Int(values, 0)
+	case KindDuration:
+		_, err = p.Duration(values, 0)
+	}
+	return errors.Trace(err)
+}
+
+func (p *Param) invalid(value string) error {
+	return errors.Errorf("invalid %s: %s, %s", p.Name, value, p.hint())
+}
+
+// hint tells what the valid values look like.
+func (p *Param) hint() string {
+	switch p.Kind {
+	case KindBool:
+		return "it should be true or false"
+	case KindInt:
+		switch p.Min {
+		case 0:
+			return "it should be a non-negative integer"
+		case 1:
+			return "it should be a positive integer"
+		}
+		return fmt.Sprintf("it should be an integer not less than %d", p.Min)
+	case KindDuration:
+		switch p.Min {
+		case 0:
+			return `it should be a non-negative duration like "10s"`
+		case 1:
+			return `it should be a positive duration like "10s"`
+		}
+		return fmt.Sprintf(`it should be a duration like "10s" not less than %s`, time.Duration(p.Min))
+	default:
+		return "it should be one of " + strings.Join(p.Enum, ", ")
+	}
+}
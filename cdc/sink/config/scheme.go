@@ -0,0 +1,346 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	dmysql "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+// Scheme declares the sink uri of a kind of sink.
+type Scheme struct {
+	Name string
+	// Example is a sink uri of the scheme shown in the error messages.
+	Example string
+	Params  []*Param
+	// DSN is set if the sink uri is a MySQL DSN without the scheme, like
+	// "root@tcp(127.0.0.1:3306)/". Only one scheme can be a DSN.
+	DSN bool
+	// AllowUnknown is set if the unknown parameters are passed to the
+	// downstream, they're only warned when they look like a typo of a
+	// declared parameter.
+	AllowUnknown bool
+	// RequireHost is set if the host of the sink uri can't be empty.
+	RequireHost bool
+	// Password is set if the sink takes the password in the user info, the
+	// password can be referred by PasswordFileParam or PasswordEnvParam.
+	Password bool
+	// Check checks the sink uri after the parameters are checked.
+	Check func(uri *URI) error
+}
+
+// the parameters referring to the password of the user info, so the password
+// isn't saved in the sink uri. They're resolved on the host creating the sink.
+var (
+	PasswordFileParam = StringParam("password-file")
+	PasswordEnvParam  = StringParam("password-env")
+)
+
+// Param returns the declared parameter with the name.
+func (s *Scheme) Param(name string) (*Param, bool) {
+	for _, p := range s.allParams() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Scheme) allParams() []*Param {
+	if !s.Password {
+		return s.Params
+	}
+	return append([]*Param{PasswordFileParam, PasswordEnvParam}, s.Params...)
+}
+
+var schemes = make(map[string]*Scheme)
+
+// Register registers the scheme, it should be called in init of the sinks.
+func Register(s *Scheme) {
+	if _, ok := schemes[s.Name]; ok {
+		panic(fmt.Sprintf("sink scheme %s is registered twice", s.Name))
+	}
+	if s.DSN {
+		if dsn := dsnScheme(); dsn != nil {
+			panic(fmt.Sprintf("sink scheme %s and %s are both DSN", dsn.Name, s.Name))
+		}
+	}
+	schemes[s.Name] = s
+}
+
+// Lookup returns the registered scheme with the name.
+func Lookup(name string) (*Scheme, bool) {
+	s, ok := schemes[strings.ToLower(name)]
+	return s, ok
+}
+
+// Schemes returns the names of the registered schemes in order.
+func Schemes() []string {
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func dsnScheme() *Scheme {
+	for _, s := range schemes {
+		if s.DSN {
+			return s
+		}
+	}
+	return nil
+}
+
+// URI is a parsed sink uri.
+type URI struct {
+	Scheme *Scheme
+	// URL is nil for a DSN.
+	URL *url.URL
+	// DSN is nil if the sink uri isn't a DSN.
+	DSN    *dmysql.Config
+	Params url.Values
+}
+
+// Parse parses the sink uri by its scheme, a sink uri without the scheme is a
+// DSN. The parameters are not checked until Validate is called.
+func Parse(sinkURI string) (*URI, error) {
+	i := strings.Index(sinkURI, "://")
+	if i <= 0 {
+		s := dsnScheme()
+		if s == nil {
+			return nil, errors.Errorf("the sink uri should have a scheme, it should be one of %s",
+				strings.Join(Schemes(), ", "))
+		}
+		dsnCfg, err := dmysql.ParseDSN(sinkURI)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid %s sink uri, it looks like %s", s.Name, s.Example)
+		}
+		params := make(url.Values, len(dsnCfg.Params))
+		for k, v := range dsnCfg.Params {
+			params.Set(k, v)
+		}
+		return &URI{Scheme: s, DSN: dsnCfg, Params: params}, nil
+	}
+
+	name := strings.ToLower(sinkURI[:i])
+	s, ok := Lookup(name)
+	if !ok {
+		return nil, errors.Errorf("unsupported sink scheme: %s, it should be one of %s",
+			name, strings.Join(Schemes(), ", "))
+	}
+	if s.DSN {
+		return nil, errors.Errorf("the %s sink uri is a DSN without the scheme, like %s", s.Name, s.Example)
+	}
+	u, err := url.Parse(sinkURI)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse sink uri")
+	}
+	return &URI{Scheme: s, URL: u, Params: u.Query()}, nil
+}
+
+// Validate checks the declared parameters and the sink uri by the scheme.
+func (u *URI) Validate() error {
+	s := u.Scheme
+	if s.RequireHost && u.URL != nil && u.URL.Host == "" {
+		return errors.Errorf("the host of the %s sink uri is not specified, it looks like %s", s.Name, s.Example)
+	}
+	for _, p := range s.allParams() {
+		if err := p.Validate(u.Params); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if s.Password {
+		if err := u.checkPasswordParams(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if s.Check != nil {
+		return errors.Trace(s.Check(u))
+	}
+	return nil
+}
+
+// String returns the sink uri.
+func (u *URI) String() string {
+	if u.DSN != nil {
+		return u.DSN.FormatDSN()
+	}
+	return u.URL.String()
+}
+
+func (u *URI) userInfo() (user string, hasPassword bool) {
+	if u.DSN != nil {
+		return u.DSN.User, u.DSN.Passwd != ""
+	}
+	if u.URL.User == nil {
+		return "", false
+	}
+	_, hasPassword = u.URL.User.Password()
+	return u.URL.User.Username(), hasPassword
+}
+
+// HasInlinePassword tells whether the password is written in the sink uri.
+func (u *URI) HasInlinePassword() bool {
+	_, hasPassword := u.userInfo()
+	return hasPassword
+}
+
+func (u *URI) checkPasswordParams() error {
+	file, hasFile := PasswordFileParam.Lookup(u.Params)
+	env, hasEnv := PasswordEnvParam.Lookup(u.Params)
+	if !hasFile && !hasEnv {
+		return nil
+	}
+	if hasFile && hasEnv {
+		return errors.Errorf("%s and %s can't be both specified", PasswordFileParam.Name, PasswordEnvParam.Name)
+	}
+	if (hasFile && file == "") || (hasEnv && env == "") {
+		return errors.New("the password file or the environment variable of the password is empty")
+	}
+	user, hasPassword := u.userInfo()
+	if hasPassword {
+		return errors.New("the password is specified both in the user info and by the parameter, remove it from the user info")
+	}
+	if user == "" {
+		return errors.Errorf("the user of the %s sink uri is not specified, it looks like %s", u.Scheme.Name, u.Scheme.Example)
+	}
+	return nil
+}
+
+// ResolveSecrets reads the password referred by PasswordFileParam or
+// PasswordEnvParam into the user info, and removes the parameters from the
+// sink uri. It should be called on the host creating the sink, where the file
+// or the environment variable is.
+func (u *URI) ResolveSecrets() error {
+	if !u.Scheme.Password {
+		return nil
+	}
+	if err := u.checkPasswordParams(); err != nil {
+		return errors.Trace(err)
+	}
+	var password string
+	if file, ok := PasswordFileParam.Lookup(u.Params); ok {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.Annotatef(err, "read password file %s", file)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	} else if env, ok := PasswordEnvParam.Lookup(u.Params); ok {
+		password, ok = os.LookupEnv(env)
+		if !ok {
+			return errors.Errorf("environment variable %s of the password is not set", env)
+		}
+	} else {
+		return nil
+	}
+
+	u.Params.Del(PasswordFileParam.Name)
+	u.Params.Del(PasswordEnvParam.Name)
+	if u.DSN != nil {
+		u.DSN.Passwd = password
+		delete(u.DSN.Params, PasswordFileParam.Name)
+		delete(u.DSN.Params, PasswordEnvParam.Name)
+		return nil
+	}
+	u.URL.User = url.UserPassword(u.URL.User.Username(), password)
+	query := u.URL.Query()
+	query.Del(PasswordFileParam.Name)
+	query.Del(PasswordEnvParam.Name)
+	u.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// Warnings returns the warnings of the unknown parameters, a suggestion is
+// given if one looks like a typo of a declared parameter.
+func (u *URI) Warnings() []string {
+	s := u.Scheme
+	names := make([]string, 0, len(u.Params))
+	for name := range u.Params {
+		if _, ok := s.Param(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var warnings []string
+	for _, name := range names {
+		suggestion := u.suggest(name)
+		switch {
+		case !s.AllowUnknown && suggestion == "":
+			warnings = append(warnings, fmt.Sprintf("unknown parameter %s of the %s sink is ignored", name, s.Name))
+		case !s.AllowUnknown:
+			warnings = append(warnings, fmt.Sprintf("unknown parameter %s of the %s sink is ignored, did you mean %s?",
+				name, s.Name, suggestion))
+		case suggestion != "":
+			warnings = append(warnings, fmt.Sprintf("unknown parameter %s of the %s sink is passed to the downstream, did you mean %s?",
+				name, s.Name, suggestion))
+		}
+	}
+	return warnings
+}
+
+// suggest returns the declared parameter closest to the name, it's empty if
+// none of them looks like the name.
+func (u *URI) suggest(name string) string {
+	best, bestDist := "", 0
+	for _, p := range u.Scheme.allParams() {
+		d := editDistance(strings.ToLower(name), p.Name)
+		if d > 2 || d*2 >= len(p.Name) {
+			continue
+		}
+		if best == "" || d < bestDist {
+			best, bestDist = p.Name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance of the strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/pingcap/tidb/types"
+)
+
+// the protocols of the messages in the message queue sinks
+const (
+	mqProtocolDefault  = "default"
+	mqProtocolDebezium = "debezium"
+)
+
+// the operations of the Debezium change events
+const (
+	debeziumOpCreate = "c"
+	debeziumOpUpdate = "u"
+	debeziumOpDelete = "d"
+)
+
+const debeziumConnector = "tidb"
+
+// debeziumEvent is the envelope of a Debezium change event without the schema,
+// that is, the format of `debezium-json` in Flink with `schema-include` off and
+// the format of Debezium with the schemas of the JsonConverter disabled.
+type debeziumEvent struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Source *debeziumSource        `json:"source"`
+	Op     string                 `json:"op"`
+	// TsMs is the time the event is encoded.
+	TsMs int64 `json:"ts_ms"`
+}
+
+// debeziumSource is the source block of a Debezium change event, the fields
+// follow the MySQL connector of Debezium except the commit ts of TiDB.
+type debeziumSource struct {
+	Version   string `json:"version"`
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	// TsMs is the physical time of the commit ts.
+	TsMs     int64  `json:"ts_ms"`
+	Snapshot string `json:"snapshot"`
+	DB       string `json:"db"`
+	Table    string `json:"table"`
+	CommitTs uint64 `json:"commit_ts"`
+}
+
+// encodeDebezium encodes the DML into a Debezium change event. The updates
+// without the old values carry no before image, the Flink consumers treat them
+// as upserts by the primary key.
+func (e *mqEncoder) encodeDebezium(ts uint64, dml *model.DML, tableInfo *schema.TableInfo) ([]byte, error) {
+	db, table := dml.TargetName()
+	event := &debeziumEvent{
+		Source: &debeziumSource{
+			Version:   util.ReleaseVersion,
+			Connector: debeziumConnector,
+			Name:      e.changefeedID,
+			TsMs:      oracle.ExtractPhysical(ts),
+			Snapshot:  "false",
+			DB:        db,
+			Table:     table,
+			CommitTs:  ts,
+		},
+		TsMs: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	switch dml.Tp {
+	case model.InsertDMLType:
+		event.Op = debeziumOpCreate
+		event.After = debeziumRow(dml.Values)
+	case model.UpdateDMLType:
+		event.Op = debeziumOpUpdate
+		if len(dml.OldValues) > 0 {
+			if err := formatValues(tableInfo, dml.OldValues); err != nil {
+				return nil, errors.Trace(err)
+			}
+			event.Before = debeziumRow(dml.OldValues)
+		}
+		event.After = debeziumRow(dml.Values)
+	case model.DeleteDMLType:
+		event.Op = debeziumOpDelete
+		event.Before = debeziumRow(dml.Values)
+	default:
+		return nil, errors.Errorf("invalid dml type: %v", dml.Tp)
+	}
+	value, err := json.Marshal(event)
+	return value, errors.Trace(err)
+}
+
+func debeziumRow(values map[string]types.Datum) map[string]interface{} {
+	row := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		row[name] = jsonValue(value)
+	}
+	return row
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type debeziumSuite struct{}
+
+var _ = check.Suite(&debeziumSuite{})
+
+func newDebeziumEncoder(c *check.C) *mqEncoder {
+	encoder, err := newMQEncoder(&tableHelper{}, tableDispatcher{}, url.Values{"protocol": {"Debezium"}})
+	c.Assert(err, check.IsNil)
+	encoder.applyOpts(map[string]string{OptChangefeedID: "cf"})
+	return encoder
+}
+
+// decodeEnvelope decodes the message into the fields of the envelope.
+func decodeEnvelope(c *check.C, value []byte) map[string]json.RawMessage {
+	envelope := make(map[string]json.RawMessage)
+	c.Assert(json.Unmarshal(value, &envelope), check.IsNil)
+	return envelope
+}
+
+func (s *debeziumSuite) TestEnvelope(c *check.C) {
+	encoder := newDebeziumEncoder(c)
+	ts := oracle.ComposeTS(1577836800000, 1)
+	txn := newTestTxn(ts, "t1", 1, 2, 3)
+	txn.DMLs[1].Tp = model.UpdateDMLType
+	txn.DMLs[1].OldValues = map[string]dbtypes.Datum{
+		"id":   dbtypes.NewDatum(2),
+		"name": dbtypes.NewDatum("old"),
+	}
+	txn.DMLs[2].Tp = model.DeleteDMLType
+	msgs, err := encoder.encodeTxn(txn)
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 3)
+
+	for _, msg := range msgs {
+		// the fields required by the debezium-json format of Flink
+		envelope := decodeEnvelope(c, msg.value)
+		var fields []string
+		for field := range envelope {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		c.Assert(fields, check.DeepEquals, []string{"after", "before", "op", "source", "ts_ms"})
+		c.Assert(msg.key, check.Equals, "test.t1")
+
+		source := make(map[string]interface{})
+		c.Assert(json.Unmarshal(envelope["source"], &source), check.IsNil)
+		c.Assert(source["connector"], check.Equals, "tidb")
+		c.Assert(source["name"], check.Equals, "cf")
+		c.Assert(source["db"], check.Equals, "test")
+		c.Assert(source["table"], check.Equals, "t1")
+		c.Assert(source["snapshot"], check.Equals, "false")
+		c.Assert(source["ts_ms"], check.Equals, float64(1577836800000))
+		c.Assert(source["commit_ts"], check.Equals, float64(ts))
+	}
+
+	expected := []struct {
+		op     string
+		before string
+		after  string
+	}{
+		{"c", `null`, `{"id":1,"name":"tester"}`},
+		{"u", `{"id":2,"name":"old"}`, `{"id":2,"name":"tester"}`},
+		{"d", `{"id":3,"name":"tester"}`, `null`},
+	}
+	for i, e := range expected {
+		event := new(debeziumEvent)
+		c.Assert(json.Unmarshal(msgs[i].value, event), check.IsNil)
+		c.Assert(event.Op, check.Equals, e.op)
+		envelope := decodeEnvelope(c, msgs[i].value)
+		c.Assert(string(envelope["before"]), check.Equals, e.before)
+		c.Assert(string(envelope["after"]), check.Equals, e.after)
+	}
+}
+
+func (s *debeziumSuite) TestDDLAndTxnMarker(c *check.C) {
+	encoder := newDebeziumEncoder(c)
+	msg, err := encoder.encodeDDL(model.Txn{
+		Ts:  10,
+		DDL: &model.DDL{Database: "test", Table: "t1", Job: &timodel.Job{Query: "TRUNCATE TABLE t1"}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(msg, check.IsNil)
+
+	// the markers can't be parsed by the Debezium consumers
+	encoder.applyOpts(map[string]string{model.FeatureOptPrefix + model.FeatureTxnMarker: "true"})
+	c.Assert(encoder.txnMarker, check.IsFalse)
+	_, err = newMQEncoder(&tableHelper{}, tableDispatcher{}, url.Values{"protocol": {"debezium"}, "txn-marker": {"true"}})
+	c.Assert(err, check.ErrorMatches, ".*not supported by the debezium protocol.*")
+	_, err = newMQEncoder(&tableHelper{}, tableDispatcher{}, url.Values{"protocol": {"canal"}})
+	c.Assert(err, check.ErrorMatches, ".*unsupported protocol: canal.*")
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+)
+
+// dispatcher decides the partition key of a row change in the message queue
+// sinks, the changes with the same key are kept in order.
+type dispatcher interface {
+	partitionKey(ts uint64, dml *model.DML, tableInfo *schema.TableInfo) string
+}
+
+// newDispatcher creates a dispatcher by the rule, the supported rules are
+// `table`, `pk` and `ts`, which give the same key to the changes of a table,
+// a row and a transaction respectively.
+func newDispatcher(rule string) (dispatcher, error) {
+	switch strings.ToLower(rule) {
+	case "", "table":
+		return tableDispatcher{}, nil
+	case "pk":
+		return pkDispatcher{}, nil
+	case "ts":
+		return tsDispatcher{}, nil
+	default:
+		return nil, errors.Errorf("unsupported partition key rule: %s", rule)
+	}
+}
+
+func tablePartitionKey(schema, table string) string {
+	return schema + "." + table
+}
+
+type tableDispatcher struct{}
+
+func (tableDispatcher) partitionKey(ts uint64, dml *model.DML, tableInfo *schema.TableInfo) string {
+	return tablePartitionKey(dml.TargetName())
+}
+
+type pkDispatcher struct{}
+
+func (pkDispatcher) partitionKey(ts uint64, dml *model.DML, tableInfo *schema.TableInfo) string {
+	_, values := whereSlice(tableInfo, dml.Values)
+	keys := make([]string, 0, len(values)+1)
+	keys = append(keys, tablePartitionKey(dml.TargetName()))
+	for _, v := range values {
+		keys = append(keys, fmt.Sprintf("%v", v.GetValue()))
+	}
+	return strings.Join(keys, "_")
+}
+
+type tsDispatcher struct{}
+
+func (tsDispatcher) partitionKey(ts uint64, dml *model.DML, tableInfo *schema.TableInfo) string {
+	return strconv.FormatUint(ts, 10)
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type dispatcherSuite struct{}
+
+var _ = check.Suite(&dispatcherSuite{})
+
+func (s *dispatcherSuite) TestPartitionKey(c *check.C) {
+	tableInfo, _ := (&tableHelper{}).GetTableByName("test", "t1")
+	dml := &model.DML{
+		Database: "test",
+		Table:    "t1",
+		Tp:       model.InsertDMLType,
+		Values: map[string]dbtypes.Datum{
+			"id":   dbtypes.NewDatum(1),
+			"name": dbtypes.NewDatum("tester"),
+		},
+	}
+	testCases := []struct {
+		rule string
+		key  string
+	}{
+		{rule: "", key: "test.t1"},
+		{rule: "table", key: "test.t1"},
+		{rule: "PK", key: "test.t1_1_tester"},
+		{rule: "ts", key: "100"},
+	}
+	for _, tc := range testCases {
+		d, err := newDispatcher(tc.rule)
+		c.Assert(err, check.IsNil)
+		c.Assert(d.partitionKey(100, dml, tableInfo), check.Equals, tc.key)
+	}
+
+	_, err := newDispatcher("unknown")
+	c.Assert(err, check.ErrorMatches, ".*unsupported partition key rule.*")
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type elasticsearchSuite struct{}
+
+var _ = check.Suite(&elasticsearchSuite{})
+
+func (s *elasticsearchSuite) TestShouldBulkIndexAndDelete(c *check.C) {
+	var mu sync.Mutex
+	var bulks [][]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.URL.Path, check.Equals, "/_bulk")
+		c.Assert(req.Header.Get("Content-Type"), check.Equals, "application/x-ndjson")
+		data, err := ioutil.ReadAll(req.Body)
+		c.Assert(err, check.IsNil)
+		var lines []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			m := make(map[string]interface{})
+			c.Assert(json.Unmarshal([]byte(line), &m), check.IsNil)
+			lines = append(lines, m)
+		}
+		mu.Lock()
+		bulks = append(bulks, lines)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"took":1,"errors":true,"items":[{"delete":{"_id":"1:1_6:tester","status":404,"result":"not_found"}}]}`))
+	}))
+	defer server.Close()
+
+	u, err := url.Parse("elasticsearch://" + strings.TrimPrefix(server.URL, "http://") + "/?index=TiDB-{schema}-{table}&max-batch-rows=2")
+	c.Assert(err, check.IsNil)
+	sink, err := NewElasticsearchSink(u, &tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+
+	newDML := func(tp model.DMLType, id int) *model.DML {
+		return &model.DML{
+			Database: "test",
+			Table:    "t1",
+			Tp:       tp,
+			Values: map[string]dbtypes.Datum{
+				"id":   dbtypes.NewDatum(id),
+				"name": dbtypes.NewDatum("tester"),
+			},
+		}
+	}
+	txns := []model.Txn{
+		{Ts: 10, DMLs: []*model.DML{newDML(model.InsertDMLType, 1), newDML(model.InsertDMLType, 2)}},
+		{Ts: 11, DMLs: []*model.DML{newDML(model.DeleteDMLType, 1)}},
+	}
+	err = sink.EmitDMLs(context.Background(), txns...)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(bulks, check.HasLen, 2)
+	c.Assert(bulks[0], check.HasLen, 4)
+	c.Assert(bulks[0][0], check.DeepEquals, map[string]interface{}{
+		"index": map[string]interface{}{"_index": "tidb-test-t1", "_id": "1:1_6:tester"},
+	})
+	c.Assert(bulks[0][1], check.DeepEquals, map[string]interface{}{"id": float64(1), "name": "tester"})
+	c.Assert(bulks[1], check.DeepEquals, []map[string]interface{}{
+		{"delete": map[string]interface{}{"_index": "tidb-test-t1", "_id": "1:1_6:tester"}},
+	})
+}
+
+func (s *elasticsearchSuite) TestShouldReturnErrorOnItemFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(`{"took":1,"errors":true,"items":[{"index":{"_id":"1:1_6:tester","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`))
+	}))
+	defer server.Close()
+
+	sink, err := NewSink("elasticsearch://"+strings.TrimPrefix(server.URL, "http://")+"/", &tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+	_, ok := sink.(*elasticsearchSink)
+	c.Assert(ok, check.IsTrue)
+
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{{
+		Database: "test",
+		Table:    "t1",
+		Tp:       model.InsertDMLType,
+		Values:   map[string]dbtypes.Datum{"id": dbtypes.NewDatum(1), "name": dbtypes.NewDatum("tester")},
+	}}})
+	c.Assert(err, check.ErrorMatches, ".*mapper_parsing_exception.*")
+}
+
+func (s *elasticsearchSuite) TestDocumentID(c *check.C) {
+	c.Assert(documentID([]dbtypes.Datum{dbtypes.NewDatum(42)}), check.Equals, "42")
+	c.Assert(documentID([]dbtypes.Datum{dbtypes.NewDatum(1), dbtypes.NewDatum("tester")}), check.Equals, "1:1_6:tester")
+	// the values containing the separator don't collide
+	c.Assert(documentID([]dbtypes.Datum{dbtypes.NewDatum("a_b"), dbtypes.NewDatum("c")}), check.Not(check.Equals),
+		documentID([]dbtypes.Datum{dbtypes.NewDatum("a"), dbtypes.NewDatum("b_c")}))
+	c.Assert(documentID([]dbtypes.Datum{dbtypes.NewDatum(nil), dbtypes.NewDatum("<nil>")}), check.Equals, "-_5:<nil>")
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/config"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/proto/sinkpb"
+	"github.com/pingcap/tidb/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// grpcSink streams row changes to a user implemented server of the
+// sinkpb.Sink service, see proto/sink.proto for the contract.
+type grpcSink struct {
+	conn       *grpc.ClientConn
+	client     sinkpb.SinkClient
+	infoGetter TableInfoGetter
+}
+
+var _ Sink = &grpcSink{}
+
+func init() {
+	config.Register(&config.Scheme{
+		Name:        "grpc",
+		Example:     "grpc://127.0.0.1:9000/",
+		RequireHost: true,
+	})
+}
+
+// NewGRPCSink creates a new gRPC sink, the sink uri looks like
+// `grpc://127.0.0.1:9000/`
+func NewGRPCSink(sinkURI *url.URL, infoGetter TableInfoGetter, opts map[string]string) (Sink, error) {
+	// The connection is established in background, so that the changefeed
+	// can be created before the downstream is ready.
+	conn, err := grpc.Dial(sinkURI.Host, grpc.WithInsecure())
+	if err != nil {
+		return nil, errors.Annotatef(err, "dial %s fail", sinkURI.Host)
+	}
+	return &grpcSink{
+		conn:       conn,
+		client:     sinkpb.NewSinkClient(conn),
+		infoGetter: infoGetter,
+	}, nil
+}
+
+// EmitDDL implements Sink interface.
+func (s *grpcSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	if !txn.IsDDL() {
+		return errors.New("not a DDL")
+	}
+	ddl := &sinkpb.DDL{
+		CommitTs: txn.Ts,
+		Schema:   txn.DDL.Database,
+		Table:    txn.DDL.Table,
+		Query:    txn.DDL.Job.Query,
+	}
+	return retry.Run(func() error {
+		ack, err := s.client.EmitDDL(ctx, ddl)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return checkAck(ack, txn.Ts)
+	}, 3)
+}
+
+// FlushCheckpoint implements Sink interface.
+// The resolved ts is sent to the server, the server acknowledges it after the
+// transactions before it are applied.
+func (s *grpcSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	err := retry.Run(func() error {
+		ack, err := s.client.EmitResolvedTs(ctx, &sinkpb.ResolvedTs{Ts: ts})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return checkAck(ack, ts)
+	}, 3)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return ts, nil
+}
+
+// EmitDMLs implements Sink interface.
+// The transactions are sent in a stream and the call returns after all of them
+// are acknowledged. The whole batch is sent again on retry, so the server
+// should skip the transactions it has applied by the commit ts.
+func (s *grpcSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	pbTxns := make([]*sinkpb.Txn, 0, len(txns))
+	for _, txn := range txns {
+		pbTxn, err := s.buildTxn(txn)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		pbTxns = append(pbTxns, pbTxn)
+	}
+	return retry.Run(func() error {
+		return s.sendTxns(ctx, pbTxns)
+	}, 3)
+}
+
+// Close implements Sink interface.
+func (s *grpcSink) Close() error {
+	return errors.Trace(s.conn.Close())
+}
+
+func (s *grpcSink) sendTxns(ctx context.Context, txns []*sinkpb.Txn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.client.EmitTxn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	sendErrCh := make(chan error, 1)
+	go func() {
+		for _, txn := range txns {
+			if err := stream.Send(txn); err != nil {
+				sendErrCh <- errors.Trace(err)
+				return
+			}
+		}
+		sendErrCh <- errors.Trace(stream.CloseSend())
+	}()
+
+	for _, txn := range txns {
+		ack, err := stream.Recv()
+		if err == io.EOF {
+			return errors.Errorf("stream closed before txn %d is acknowledged", txn.CommitTs)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := checkAck(ack, txn.CommitTs); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := <-sendErrCh; err != nil {
+		return errors.Trace(err)
+	}
+	log.Debug("grpc sink emitted txns", zap.Int("count", len(txns)))
+	return nil
+}
+
+func checkAck(ack *sinkpb.Ack, ts uint64) error {
+	if ack.GetTs() != ts {
+		return errors.Errorf("unexpected ack ts %d, expect %d", ack.GetTs(), ts)
+	}
+	return nil
+}
+
+func (s *grpcSink) buildTxn(txn model.Txn) (*sinkpb.Txn, error) {
+	pbTxn := &sinkpb.Txn{
+		CommitTs: txn.Ts,
+		Rows:     make([]*sinkpb.Row, 0, len(txn.DMLs)),
+	}
+	for _, dml := range txn.DMLs {
+		if s.infoGetter != nil {
+			tableInfo, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
+			if !ok {
+				return nil, errors.Errorf("table not found: %s", dml.TableName())
+			}
+			if err := formatValues(tableInfo, dml.Values); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+
+		schema, table := dml.TargetName()
+		row := &sinkpb.Row{
+			Schema:  schema,
+			Table:   table,
+			Columns: make([]*sinkpb.Column, 0, len(dml.Values)),
+		}
+		switch dml.Tp {
+		case model.InsertDMLType:
+			row.Type = sinkpb.RowType_INSERT
+		case model.UpdateDMLType:
+			row.Type = sinkpb.RowType_UPDATE
+		case model.DeleteDMLType:
+			row.Type = sinkpb.RowType_DELETE
+		default:
+			return nil, errors.Errorf("invalid dml type: %v", dml.Tp)
+		}
+		for name, value := range dml.Values {
+			row.Columns = append(row.Columns, pbColumn(name, value))
+		}
+		sort.Slice(row.Columns, func(i, j int) bool {
+			return row.Columns[i].Name < row.Columns[j].Name
+		})
+		pbTxn.Rows = append(pbTxn.Rows, row)
+	}
+	return pbTxn, nil
+}
+
+// pbColumn converts a formatted datum to a column of the sink protocol.
+func pbColumn(name string, datum types.Datum) *sinkpb.Column {
+	col := &sinkpb.Column{Name: name}
+	switch datum.Kind() {
+	case types.KindNull:
+	case types.KindInt64:
+		col.Value = &sinkpb.Column_IntValue{IntValue: datum.GetInt64()}
+	case types.KindUint64:
+		col.Value = &sinkpb.Column_UintValue{UintValue: datum.GetUint64()}
+	case types.KindFloat32:
+		col.Value = &sinkpb.Column_FloatValue{FloatValue: float64(datum.GetFloat32())}
+	case types.KindFloat64:
+		col.Value = &sinkpb.Column_FloatValue{FloatValue: datum.GetFloat64()}
+	case types.KindString:
+		col.Value = &sinkpb.Column_StringValue{StringValue: datum.GetString()}
+	case types.KindBytes:
+		col.Value = &sinkpb.Column_BytesValue{BytesValue: datum.GetBytes()}
+	default:
+		col.Value = &sinkpb.Column_StringValue{StringValue: fmt.Sprintf("%v", datum.GetValue())}
+	}
+	return col
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	cdcmodel "github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/proto/sinkpb"
+	dbtypes "github.com/pingcap/tidb/types"
+	"google.golang.org/grpc"
+)
+
+type mockSinkServer struct {
+	mu         sync.Mutex
+	txns       []*sinkpb.Txn
+	ddls       []*sinkpb.DDL
+	resolvedTs uint64
+}
+
+func (m *mockSinkServer) EmitTxn(stream sinkpb.Sink_EmitTxnServer) error {
+	for {
+		txn, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.txns = append(m.txns, txn)
+		m.mu.Unlock()
+		if err := stream.Send(&sinkpb.Ack{Ts: txn.CommitTs}); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *mockSinkServer) EmitResolvedTs(ctx context.Context, ts *sinkpb.ResolvedTs) (*sinkpb.Ack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resolvedTs = ts.Ts
+	return &sinkpb.Ack{Ts: ts.Ts}, nil
+}
+
+func (m *mockSinkServer) EmitDDL(ctx context.Context, ddl *sinkpb.DDL) (*sinkpb.Ack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ddls = append(m.ddls, ddl)
+	return &sinkpb.Ack{Ts: ddl.CommitTs}, nil
+}
+
+type grpcSinkSuite struct{}
+
+var _ = check.Suite(&grpcSinkSuite{})
+
+func (s *grpcSinkSuite) TestEmit(c *check.C) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	server := grpc.NewServer()
+	mock := &mockSinkServer{}
+	sinkpb.RegisterSinkServer(server, mock)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	sink, err := NewSink("grpc://"+lis.Addr().String()+"/", &tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+	defer sink.Close()
+
+	ctx := context.Background()
+	txns := []cdcmodel.Txn{
+		{Ts: 10, DMLs: []*cdcmodel.DML{{
+			Database: "test",
+			Table:    "t1",
+			Tp:       cdcmodel.InsertDMLType,
+			Values: map[string]dbtypes.Datum{
+				"id":   dbtypes.NewDatum(1),
+				"name": dbtypes.NewDatum("tester"),
+			},
+		}}},
+		{Ts: 11, DMLs: []*cdcmodel.DML{{
+			Database: "test",
+			Table:    "t1",
+			Tp:       cdcmodel.DeleteDMLType,
+			Values:   map[string]dbtypes.Datum{"id": dbtypes.NewDatum(1)},
+		}}},
+	}
+	err = sink.EmitDMLs(ctx, txns...)
+	c.Assert(err, check.IsNil)
+	checkpointTs, err := sink.FlushCheckpoint(ctx, 11)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkpointTs, check.Equals, uint64(11))
+	err = sink.EmitDDL(ctx, cdcmodel.Txn{Ts: 12, DDL: &cdcmodel.DDL{
+		Database: "test",
+		Table:    "t1",
+		Job:      &model.Job{Query: "ALTER TABLE t1 ADD COLUMN a INT"},
+	}})
+	c.Assert(err, check.IsNil)
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	c.Assert(mock.txns, check.HasLen, 2)
+	c.Assert(mock.txns[0].CommitTs, check.Equals, uint64(10))
+	c.Assert(mock.txns[0].Rows[0].Type, check.Equals, sinkpb.RowType_INSERT)
+	c.Assert(mock.txns[0].Rows[0].Columns, check.HasLen, 2)
+	c.Assert(mock.txns[0].Rows[0].Columns[0].GetIntValue(), check.Equals, int64(1))
+	c.Assert(mock.txns[0].Rows[0].Columns[1].GetStringValue(), check.Equals, "tester")
+	c.Assert(mock.txns[1].Rows[0].Type, check.Equals, sinkpb.RowType_DELETE)
+	c.Assert(mock.resolvedTs, check.Equals, uint64(11))
+	c.Assert(mock.ddls, check.HasLen, 1)
+	c.Assert(mock.ddls[0].Query, check.Equals, "ALTER TABLE t1 ADD COLUMN a INT")
+}
@@ -0,0 +1,369 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"crypto/md5"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/config"
+	"go.uber.org/zap"
+)
+
+const (
+	// limits of the PutRecords API
+	kinesisMaxRecordSize       = 1024 * 1024
+	kinesisMaxRecordsPerPut    = 500
+	kinesisMaxRequestSize      = 5 * 1024 * 1024
+	kinesisMaxPartitionKeySize = 256
+
+	kinesisMinBackoff = 100 * time.Millisecond
+	kinesisMaxBackoff = 5 * time.Second
+	// the max attempts for the records failed by errors except throttling,
+	// the throttled records are retried until the context is canceled.
+	kinesisMaxRetry = 10
+
+	kinesisThrottledErrorCode = kinesis.ErrCodeProvisionedThroughputExceededException
+)
+
+// kplMagic is the header of the records aggregated in the format of Kinesis
+// Producer Library, such records can be deaggregated by Kinesis Client Library.
+var kplMagic = []byte{0xf3, 0x89, 0x9a, 0xc2}
+
+type kinesisClient interface {
+	PutRecordsWithContext(ctx aws.Context, input *kinesis.PutRecordsInput, opts ...request.Option) (*kinesis.PutRecordsOutput, error)
+}
+
+// kinesisSink writes the changes into a Kinesis data stream. The messages with
+// the same partition key are aggregated into KPL records, and the records of a
+// partition key are put one after another to keep them in order.
+type kinesisSink struct {
+	client      kinesisClient
+	streamName  string
+	encoder     *mqEncoder
+	aggregation bool
+}
+
+var _ Sink = &kinesisSink{}
+
+var (
+	kinesisRegionParam      = config.StringParam("region")
+	kinesisEndpointParam    = config.StringParam("endpoint")
+	kinesisAggregationParam = config.BoolParam("aggregation")
+)
+
+func init() {
+	config.Register(&config.Scheme{
+		Name:        "kinesis",
+		Example:     "kinesis://stream-name/?region=us-west-2",
+		Params:      mqParams(mqPartitionKeyParam, kinesisRegionParam, kinesisEndpointParam, kinesisAggregationParam),
+		RequireHost: true,
+	})
+}
+
+// NewKinesisSink creates a new Kinesis sink, the sink uri looks like
+// `kinesis://stream-name/?region=us-west-2&partition-key=pk&aggregation=true`.
+// The credentials are loaded from the default credential chain of AWS SDK.
+func NewKinesisSink(sinkURI *url.URL, infoGetter TableInfoGetter, opts map[string]string) (Sink, error) {
+	params := sinkURI.Query()
+	awsConfig := aws.NewConfig()
+	if region, _ := kinesisRegionParam.String(params, ""); region != "" {
+		awsConfig = awsConfig.WithRegion(region)
+	}
+	if endpoint, _ := kinesisEndpointParam.String(params, ""); endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(endpoint)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "create aws session")
+	}
+	s, err := newKinesisSink(kinesis.New(sess), sinkURI, infoGetter)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.encoder.applyOpts(opts)
+	return s, nil
+}
+
+func newKinesisSink(client kinesisClient, sinkURI *url.URL, infoGetter TableInfoGetter) (*kinesisSink, error) {
+	if sinkURI.Host == "" {
+		return nil, errors.New("stream name of kinesis is not specified")
+	}
+	params := sinkURI.Query()
+	rule, err := mqPartitionKeyParam.String(params, "table")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	dispatcher, err := newDispatcher(rule)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	encoder, err := newMQEncoder(infoGetter, dispatcher, params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	aggregation, err := kinesisAggregationParam.Bool(params, true)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &kinesisSink{
+		client:      client,
+		streamName:  sinkURI.Host,
+		encoder:     encoder,
+		aggregation: aggregation,
+	}, nil
+}
+
+// EmitDDL implements Sink interface.
+func (s *kinesisSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	msg, err := s.encoder.encodeDDL(txn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if msg == nil {
+		return nil
+	}
+	return errors.Trace(s.putMessages(ctx, []*mqMessage{msg}))
+}
+
+// EmitDMLs implements Sink interface.
+func (s *kinesisSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	msgs, err := s.encoder.encodeTxns(ctx, txns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.putMessages(ctx, msgs))
+}
+
+// FlushCheckpoint implements Sink interface.
+// The records are put before EmitDMLs returns.
+func (s *kinesisSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	return ts, nil
+}
+
+// Close implements Sink interface.
+func (s *kinesisSink) Close() error {
+	return nil
+}
+
+// putMessages groups the messages by partition key and puts them in order of
+// each key.
+func (s *kinesisSink) putMessages(ctx context.Context, msgs []*mqMessage) error {
+	var keys []string
+	grouped := make(map[string][][]byte)
+	for _, msg := range msgs {
+		key := truncateUTF8(msg.key, kinesisMaxPartitionKeySize)
+		if _, ok := grouped[key]; !ok {
+			keys = append(keys, key)
+		}
+		grouped[key] = append(grouped[key], msg.value)
+	}
+
+	queues := make(map[string][]*kinesis.PutRecordsRequestEntry, len(keys))
+	for _, key := range keys {
+		if s.aggregation {
+			records, err := aggregateRecords(key, grouped[key])
+			if err != nil {
+				return errors.Trace(err)
+			}
+			queues[key] = records
+		} else {
+			records := make([]*kinesis.PutRecordsRequestEntry, 0, len(grouped[key]))
+			for _, value := range grouped[key] {
+				records = append(records, &kinesis.PutRecordsRequestEntry{
+					Data:         value,
+					PartitionKey: aws.String(key),
+				})
+			}
+			queues[key] = records
+		}
+		for _, record := range queues[key] {
+			if len(record.Data)+len(key) > kinesisMaxRecordSize {
+				return errors.Errorf("kinesis record of key %s is too large, size: %d", key, len(record.Data))
+			}
+		}
+	}
+	return errors.Trace(s.putQueues(ctx, keys, queues))
+}
+
+// putQueues puts the heads of the queues in a PutRecords request repeatedly,
+// so that at most one record of a partition key is in flight.
+func (s *kinesisSink) putQueues(ctx context.Context, keys []string, queues map[string][]*kinesis.PutRecordsRequestEntry) error {
+	backoff := kinesisMinBackoff
+	failures := 0
+	for len(keys) > 0 {
+		var (
+			entries     []*kinesis.PutRecordsRequestEntry
+			entryKeys   []string
+			requestSize int
+		)
+		for _, key := range keys {
+			record := queues[key][0]
+			size := len(record.Data) + len(key)
+			if len(entries) >= kinesisMaxRecordsPerPut || requestSize+size > kinesisMaxRequestSize {
+				break
+			}
+			entries = append(entries, record)
+			entryKeys = append(entryKeys, key)
+			requestSize += size
+		}
+
+		output, err := s.client.PutRecordsWithContext(ctx, &kinesis.PutRecordsInput{
+			Records:    entries,
+			StreamName: aws.String(s.streamName),
+		})
+		if err != nil {
+			return errors.Annotatef(err, "put records to kinesis stream %s", s.streamName)
+		}
+
+		throttled := false
+		var failedErr error
+		for i, result := range output.Records {
+			key := entryKeys[i]
+			if result.ErrorCode == nil {
+				queues[key] = queues[key][1:]
+				continue
+			}
+			if *result.ErrorCode == kinesisThrottledErrorCode {
+				throttled = true
+				continue
+			}
+			failedErr = errors.Errorf("put record of key %s failed, code: %s, message: %s",
+				key, *result.ErrorCode, aws.StringValue(result.ErrorMessage))
+		}
+		if failedErr != nil {
+			failures++
+			if failures >= kinesisMaxRetry {
+				return errors.Trace(failedErr)
+			}
+			log.Warn("put records to kinesis failed, retry later", zap.Error(failedErr))
+		} else {
+			failures = 0
+		}
+
+		remaining := keys[:0]
+		for _, key := range keys {
+			if len(queues[key]) > 0 {
+				remaining = append(remaining, key)
+			}
+		}
+		keys = remaining
+
+		if !throttled && failedErr == nil {
+			backoff = kinesisMinBackoff
+			continue
+		}
+		if throttled {
+			log.Warn("put records to kinesis is throttled, retry later",
+				zap.String("stream", s.streamName), zap.Int64("failed", aws.Int64Value(output.FailedRecordCount)),
+				zap.Duration("backoff", backoff))
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+		backoff *= 2
+		if backoff > kinesisMaxBackoff {
+			backoff = kinesisMaxBackoff
+		}
+	}
+	return nil
+}
+
+// aggregateRecords aggregates the messages of a partition key into records in
+// the format of KPL, the size of each record is within the limit of Kinesis.
+// The format is the magic, an AggregatedRecord message in protobuf and the md5
+// checksum of the message, see
+// https://github.com/awslabs/amazon-kinesis-producer/blob/master/aggregation-format.md
+func aggregateRecords(key string, values [][]byte) ([]*kinesis.PutRecordsRequestEntry, error) {
+	var records []*kinesis.PutRecordsRequestEntry
+	// the size of the magic, the md5 checksum and the partition key table
+	overhead := len(kplMagic) + md5.Size + len(key) + 2*binaryVarintSize
+	buf := proto.NewBuffer(nil)
+	count := 0
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		data := make([]byte, 0, len(kplMagic)+len(buf.Bytes())+md5.Size)
+		data = append(data, kplMagic...)
+		data = append(data, buf.Bytes()...)
+		sum := md5.Sum(buf.Bytes())
+		data = append(data, sum[:]...)
+		records = append(records, &kinesis.PutRecordsRequestEntry{
+			Data:         data,
+			PartitionKey: aws.String(key),
+		})
+		buf = proto.NewBuffer(nil)
+		count = 0
+	}
+
+	for _, value := range values {
+		record := proto.NewBuffer(nil)
+		// Record.partition_key_index, it's always the only key in the table
+		if err := record.EncodeVarint(1<<3 | proto.WireVarint); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := record.EncodeVarint(0); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// Record.data
+		if err := record.EncodeVarint(3<<3 | proto.WireBytes); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := record.EncodeRawBytes(value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		size := len(record.Bytes()) + 2*binaryVarintSize
+		if count > 0 && overhead+len(buf.Bytes())+size > kinesisMaxRecordSize {
+			flush()
+		}
+		if count == 0 {
+			// AggregatedRecord.partition_key_table
+			if err := buf.EncodeVarint(1<<3 | proto.WireBytes); err != nil {
+				return nil, errors.Trace(err)
+			}
+			if err := buf.EncodeStringBytes(key); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		// AggregatedRecord.records
+		if err := buf.EncodeVarint(3<<3 | proto.WireBytes); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := buf.EncodeRawBytes(record.Bytes()); err != nil {
+			return nil, errors.Trace(err)
+		}
+		count++
+	}
+	flush()
+	return records, nil
+}
+
+// binaryVarintSize is the max size of a varint encoded length.
+const binaryVarintSize = 10
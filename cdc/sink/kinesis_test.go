@@ -0,0 +1,201 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type mockKinesisClient struct {
+	calls [][]*kinesis.PutRecordsRequestEntry
+	// throttle the first n records of the key
+	throttle map[string]int
+	// fail all the records of the calls
+	failCalls map[int]bool
+}
+
+func (m *mockKinesisClient) PutRecordsWithContext(ctx aws.Context, input *kinesis.PutRecordsInput, opts ...request.Option) (*kinesis.PutRecordsOutput, error) {
+	failed := m.failCalls[len(m.calls)]
+	m.calls = append(m.calls, input.Records)
+	output := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int64(0)}
+	for _, record := range input.Records {
+		key := aws.StringValue(record.PartitionKey)
+		result := &kinesis.PutRecordsResultEntry{}
+		if failed {
+			result.ErrorCode = aws.String(kinesis.ErrCodeInternalFailureException)
+			result.ErrorMessage = aws.String("internal failure")
+			*output.FailedRecordCount++
+		} else if m.throttle[key] > 0 {
+			m.throttle[key]--
+			result.ErrorCode = aws.String(kinesisThrottledErrorCode)
+			*output.FailedRecordCount++
+		}
+		output.Records = append(output.Records, result)
+	}
+	return output, nil
+}
+
+type kinesisSuite struct{}
+
+var _ = check.Suite(&kinesisSuite{})
+
+func newTestTxn(ts uint64, table string, ids ...int) model.Txn {
+	txn := model.Txn{Ts: ts}
+	for _, id := range ids {
+		txn.DMLs = append(txn.DMLs, &model.DML{
+			Database: "test",
+			Table:    table,
+			Tp:       model.InsertDMLType,
+			Values: map[string]dbtypes.Datum{
+				"id":   dbtypes.NewDatum(id),
+				"name": dbtypes.NewDatum("tester"),
+			},
+		})
+	}
+	return txn
+}
+
+func decodeEvent(c *check.C, data []byte) *mqEvent {
+	event := new(mqEvent)
+	c.Assert(json.Unmarshal(data, event), check.IsNil)
+	return event
+}
+
+// decodeProtoField decodes a field of protobuf, the value of a varint field is
+// returned as an empty slice if it's zero.
+func decodeProtoField(c *check.C, data []byte) (tag uint64, value []byte, rest []byte) {
+	tag, n := proto.DecodeVarint(data)
+	c.Assert(n, check.Greater, 0)
+	data = data[n:]
+	x, n := proto.DecodeVarint(data)
+	c.Assert(n, check.Greater, 0)
+	data = data[n:]
+	if tag&0x7 == proto.WireVarint {
+		return tag, make([]byte, x), data
+	}
+	return tag, data[:x], data[x:]
+}
+
+func (s *kinesisSuite) TestRetryThrottledRecordsInOrder(c *check.C) {
+	client := &mockKinesisClient{throttle: map[string]int{"test.t1": 1}}
+	u, err := url.Parse("kinesis://stream/?aggregation=false")
+	c.Assert(err, check.IsNil)
+	sink, err := newKinesisSink(client, u, &tableHelper{})
+	c.Assert(err, check.IsNil)
+
+	err = sink.EmitDMLs(context.Background(),
+		newTestTxn(1, "t1", 1, 2), newTestTxn(2, "t2", 1), newTestTxn(3, "t1", 3))
+	c.Assert(err, check.IsNil)
+
+	// the throttled record is put again before the following records of the key
+	c.Assert(client.calls, check.HasLen, 4)
+	var ids []interface{}
+	for _, call := range client.calls {
+		keys := make(map[string]bool)
+		for _, record := range call {
+			key := aws.StringValue(record.PartitionKey)
+			c.Assert(keys[key], check.IsFalse, check.Commentf("more than one record of key %s in flight", key))
+			keys[key] = true
+			if key == "test.t1" {
+				ids = append(ids, decodeEvent(c, record.Data).Data["id"])
+			}
+		}
+	}
+	c.Assert(ids, check.DeepEquals, []interface{}{float64(1), float64(1), float64(2), float64(3)})
+}
+
+func (s *kinesisSuite) TestResetFailuresAfterSuccess(c *check.C) {
+	var ids []int
+	for i := 0; i <= kinesisMaxRetry; i++ {
+		ids = append(ids, i)
+	}
+	// every other call fails, the failures are not consecutive
+	failCalls := make(map[int]bool)
+	for i := 0; i < 2*len(ids); i += 2 {
+		failCalls[i] = true
+	}
+	client := &mockKinesisClient{failCalls: failCalls}
+	u, err := url.Parse("kinesis://stream/?aggregation=false")
+	c.Assert(err, check.IsNil)
+	sink, err := newKinesisSink(client, u, &tableHelper{})
+	c.Assert(err, check.IsNil)
+
+	err = sink.EmitDMLs(context.Background(), newTestTxn(1, "t1", ids...))
+	c.Assert(err, check.IsNil)
+	c.Assert(client.calls, check.HasLen, 2*len(ids))
+}
+
+func (s *kinesisSuite) TestAggregateRecords(c *check.C) {
+	client := &mockKinesisClient{}
+	u, err := url.Parse("kinesis://stream/?partition-key=table")
+	c.Assert(err, check.IsNil)
+	sink, err := newKinesisSink(client, u, &tableHelper{})
+	c.Assert(err, check.IsNil)
+
+	err = sink.EmitDMLs(context.Background(), newTestTxn(1, "t1", 1, 2, 3))
+	c.Assert(err, check.IsNil)
+	c.Assert(client.calls, check.HasLen, 1)
+	c.Assert(client.calls[0], check.HasLen, 1)
+
+	data := client.calls[0][0].Data
+	c.Assert(bytes.HasPrefix(data, kplMagic), check.IsTrue)
+	msg := data[len(kplMagic) : len(data)-md5.Size]
+	sum := md5.Sum(msg)
+	c.Assert(data[len(data)-md5.Size:], check.DeepEquals, sum[:])
+
+	var keys []string
+	var values [][]byte
+	for len(msg) > 0 {
+		var tag uint64
+		var field []byte
+		tag, field, msg = decodeProtoField(c, msg)
+		switch tag >> 3 {
+		case 1:
+			keys = append(keys, string(field))
+		case 3:
+			_, index, record := decodeProtoField(c, field)
+			c.Assert(index, check.HasLen, 0)
+			_, value, rest := decodeProtoField(c, record)
+			c.Assert(rest, check.HasLen, 0)
+			values = append(values, value)
+		}
+	}
+	c.Assert(keys, check.DeepEquals, []string{"test.t1"})
+	c.Assert(values, check.HasLen, 3)
+	for i, value := range values {
+		c.Assert(decodeEvent(c, value).Data["id"], check.Equals, float64(i+1))
+	}
+}
+
+func (s *kinesisSuite) TestAggregateRecordsBySize(c *check.C) {
+	value := bytes.Repeat([]byte{'a'}, 300*1024)
+	records, err := aggregateRecords("key", [][]byte{value, value, value, value})
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 2)
+	for _, record := range records {
+		c.Assert(len(record.Data), check.Less, kinesisMaxRecordSize)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/types"
+)
+
+// maskSink masks the values of the columns matched by the masking rules of
+// the changefeed before the DMLs are emitted to the backend sink. The old
+// values of the updates are masked too, so the masked rows in the downstream
+// are still found by them. The DMLs passed in are not modified.
+type maskSink struct {
+	backend    Sink
+	infoGetter TableInfoGetter
+	rules      []model.MaskingRule
+	// maskers caches the maskers of the columns of a table by the quoted
+	// table name, a table without masked columns has an empty map.
+	maskers map[string]map[string]masker
+}
+
+var _ Sink = &maskSink{}
+
+type masker func(string) string
+
+// NewMaskSink wraps the sink to mask the columns with the masking rules. The
+// columns of the primary key and the unique keys can only be masked by hash,
+// the other maskers map the different keys to the same one.
+func NewMaskSink(backend Sink, infoGetter TableInfoGetter, rules []model.MaskingRule) (Sink, error) {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return &maskSink{
+		backend:    backend,
+		infoGetter: infoGetter,
+		rules:      rules,
+		maskers:    make(map[string]map[string]masker),
+	}, nil
+}
+
+// EmitDMLs implements Sink interface.
+func (s *maskSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	masked := make([]model.Txn, len(txns))
+	for i, txn := range txns {
+		masked[i] = txn
+		masked[i].DMLs = make([]*model.DML, len(txn.DMLs))
+		for j, dml := range txn.DMLs {
+			dml, err := s.maskDML(dml)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			masked[i].DMLs[j] = dml
+		}
+	}
+	return errors.Trace(s.backend.EmitDMLs(ctx, masked...))
+}
+
+// EmitDDL implements Sink interface.
+func (s *maskSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	// the keys of the tables may be changed by the DDL
+	s.maskers = make(map[string]map[string]masker)
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *maskSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	ts, err := s.backend.FlushCheckpoint(ctx, ts)
+	return ts, errors.Trace(err)
+}
+
+// Close implements Sink interface.
+func (s *maskSink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
+
+func (s *maskSink) maskDML(dml *model.DML) (*model.DML, error) {
+	maskers, err := s.tableMaskers(dml.Database, dml.Table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(maskers) == 0 {
+		return dml, nil
+	}
+	masked := *dml
+	masked.Values = maskValues(dml.Values, maskers)
+	masked.OldValues = maskValues(dml.OldValues, maskers)
+	return &masked, nil
+}
+
+func (s *maskSink) tableMaskers(schema, table string) (map[string]masker, error) {
+	name := util.QuoteSchema(schema, table)
+	if maskers, ok := s.maskers[name]; ok {
+		return maskers, nil
+	}
+	keyColumns := make(map[string]struct{})
+	if info, ok := s.infoGetter.GetTableByName(schema, table); ok {
+		for _, key := range info.UniqueKeys(true) {
+			for _, col := range key.Columns {
+				keyColumns[strings.ToLower(col)] = struct{}{}
+			}
+		}
+	}
+	maskers := make(map[string]masker)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if !rule.MatchTable(schema, table) {
+			continue
+		}
+		for _, col := range rule.Columns {
+			// the first rule of a column wins
+			col = strings.ToLower(col)
+			if _, ok := maskers[col]; ok {
+				continue
+			}
+			if _, ok := keyColumns[col]; ok && rule.Type != model.MaskHash {
+				return nil, errors.Errorf("the key column %s of table %s can only be masked by %s, not %s",
+					col, name, model.MaskHash, rule.Type)
+			}
+			maskers[col] = newMasker(rule)
+		}
+	}
+	s.maskers[name] = maskers
+	return maskers, nil
+}
+
+// maskValues returns a copy of the values with the string columns masked, the
+// column names are matched case-insensitively.
+func maskValues(values map[string]types.Datum, maskers map[string]masker) map[string]types.Datum {
+	if values == nil {
+		return nil
+	}
+	masked := make(map[string]types.Datum, len(values))
+	for name, datum := range values {
+		mask, ok := maskers[strings.ToLower(name)]
+		if ok {
+			switch datum.Kind() {
+			case types.KindString:
+				datum = types.NewStringDatum(mask(datum.GetString()))
+			case types.KindBytes:
+				datum = types.NewBytesDatum([]byte(mask(string(datum.GetBytes()))))
+			}
+		}
+		masked[name] = datum
+	}
+	return masked
+}
+
+func newMasker(rule *model.MaskingRule) masker {
+	switch rule.Type {
+	case model.MaskEmail:
+		return maskEmail
+	case model.MaskPhone:
+		return maskPhone
+	case model.MaskHash:
+		salt := rule.Salt
+		return func(value string) string {
+			sum := sha256.Sum256([]byte(salt + value))
+			return hex.EncodeToString(sum[:])
+		}
+	default:
+		prefix, suffix := rule.KeepPrefix, rule.KeepSuffix
+		return func(value string) string {
+			return maskPartial(value, prefix, suffix)
+		}
+	}
+}
+
+// maskEmail masks the local part of the email address except its first
+// character, the value is masked entirely if it isn't an email address.
+func maskEmail(value string) string {
+	at := strings.LastIndex(value, "@")
+	if at <= 0 {
+		return maskPartial(value, 0, 0)
+	}
+	return maskPartial(value[:at], 1, 0) + value[at:]
+}
+
+// maskPhone masks the digits except the last 4 ones, the other characters
+// like '+' and '-' are kept.
+func maskPhone(value string) string {
+	runes := []rune(value)
+	kept := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if kept < 4 {
+			kept++
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// maskPartial masks the characters except the leading prefix ones and the
+// trailing suffix ones, the value is masked entirely if it isn't longer than
+// prefix+suffix characters.
+func maskPartial(value string, prefix, suffix int) string {
+	runes := []rune(value)
+	if len(runes) <= prefix+suffix {
+		prefix, suffix = 0, 0
+	}
+	for i := prefix; i < len(runes)-suffix; i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/types"
+)
+
+type maskSuite struct{}
+
+var _ = check.Suite(&maskSuite{})
+
+func (s *maskSuite) TestMaskers(c *check.C) {
+	c.Assert(maskEmail("alice@example.com"), check.Equals, "a****@example.com")
+	c.Assert(maskEmail("a@example.com"), check.Equals, "*@example.com")
+	c.Assert(maskEmail("alice"), check.Equals, "*****")
+	c.Assert(maskPhone("+1 (555) 123-4567"), check.Equals, "+* (***) ***-4567")
+	c.Assert(maskPhone("123"), check.Equals, "123")
+	c.Assert(maskPartial("4111111111111111", 4, 4), check.Equals, "4111********1111")
+	c.Assert(maskPartial("张三丰", 1, 0), check.Equals, "张**")
+	c.Assert(maskPartial("abc", 2, 2), check.Equals, "***")
+
+	hash := newMasker(&model.MaskingRule{Type: model.MaskHash, Salt: "s"})
+	c.Assert(hash("4111111111111111"), check.HasLen, 64)
+	c.Assert(hash("4111111111111111"), check.Equals, hash("4111111111111111"))
+	other := newMasker(&model.MaskingRule{Type: model.MaskHash, Salt: "t"})
+	c.Assert(other("4111111111111111"), check.Not(check.Equals), hash("4111111111111111"))
+}
+
+func (s *maskSuite) TestMaskSink(c *check.C) {
+	_, err := NewMaskSink(&recordingSink{}, &tableHelper{}, []model.MaskingRule{{Table: "test", Columns: []string{"name"}, Type: model.MaskEmail}})
+	c.Assert(err, check.ErrorMatches, "invalid masking table: test.*")
+
+	backend := &recordingSink{}
+	sink, err := NewMaskSink(backend, &tableHelper{}, []model.MaskingRule{
+		{Table: "test.user*", Columns: []string{"Name"}, Type: model.MaskPartial, KeepPrefix: 1},
+		{Table: "test.*", Columns: []string{"name", "id"}, Type: model.MaskEmail},
+	})
+	c.Assert(err, check.IsNil)
+
+	update := newTestDML(model.UpdateDMLType, "user", 1, "bob")
+	update.OldValues = map[string]types.Datum{
+		"id":   types.NewDatum(1),
+		"name": types.NewDatum("alice"),
+	}
+	other := newTestDML(model.InsertDMLType, "order", 2, "carol@example.com")
+	skipped := newTestDML(model.InsertDMLType, "user", 3, nil)
+	untouched := &model.DML{Database: "other", Table: "user", Tp: model.InsertDMLType,
+		Values: map[string]types.Datum{"name": types.NewDatum("dave")}}
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{update, other, skipped, untouched}})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(backend.txns, check.HasLen, 1)
+	dmls := backend.txns[0].DMLs
+	c.Assert(dmls, check.HasLen, 4)
+	name := dmls[0].Values["name"]
+	c.Assert(name.GetString(), check.Equals, "b**")
+	name = dmls[0].OldValues["name"]
+	c.Assert(name.GetString(), check.Equals, "a****")
+	// the first rule of a column wins, and the non-string columns are kept
+	name = dmls[1].Values["name"]
+	c.Assert(name.GetString(), check.Equals, "c****@example.com")
+	id := dmls[1].Values["id"]
+	c.Assert(id.GetInt64(), check.Equals, int64(2))
+	name = dmls[2].Values["name"]
+	c.Assert(name.IsNull(), check.IsTrue)
+	c.Assert(dmls[3], check.Equals, untouched)
+
+	// the DMLs passed in are not modified
+	name = update.Values["name"]
+	c.Assert(name.GetString(), check.Equals, "bob")
+}
+
+func (s *maskSuite) TestMaskKeyColumns(c *check.C) {
+	backend := &recordingSink{}
+	sink, err := NewMaskSink(backend, &pkTableHelper{}, []model.MaskingRule{
+		{Table: "test.user", Columns: []string{"ID"}, Type: model.MaskPartial, KeepPrefix: 1},
+		{Table: "test.order", Columns: []string{"id"}, Type: model.MaskHash, Salt: "s"},
+	})
+	c.Assert(err, check.IsNil)
+
+	// the different keys would be masked to the same one
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{
+		newTestDML(model.InsertDMLType, "user", 1, "alice"),
+	}})
+	c.Assert(err, check.ErrorMatches, "the key column id of table `test`.`user` can only be masked by hash, not partial")
+	c.Assert(backend.txns, check.HasLen, 0)
+
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{
+		newTestDML(model.InsertDMLType, "order", 1, "alice"),
+	}})
+	c.Assert(err, check.IsNil)
+	c.Assert(backend.txns, check.HasLen, 1)
+}
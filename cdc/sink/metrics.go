@@ -0,0 +1,112 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	encodedMessageCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "encoded_message_count",
+			Help:      "The number of messages encoded by the message queue sinks.",
+		}, []string{"changefeed"})
+	encodedBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "encoded_bytes",
+			Help:      "The size of messages encoded by the message queue sinks.",
+		}, []string{"changefeed"})
+	encodeBusySecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "encode_busy_seconds",
+			Help:      "The CPU time spent by the encoding workers, measured by their busy time.",
+		}, []string{"changefeed"})
+	encodeWorkerGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "encode_worker_num",
+			Help:      "The number of encoding workers.",
+		}, []string{"changefeed"})
+	stmtCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "stmt_cache_count",
+			Help:      "The number of lookups of the prepared statement cache of the MySQL sink.",
+		}, []string{"changefeed", "result"})
+	rateLimitWaitSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "rate_limit_wait_seconds",
+			Help:      "The time the sink waited for the rate limit before writing the changes.",
+		}, []string{"changefeed"})
+	compactedDMLCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "compacted_dml_count",
+			Help:      "The number of DMLs merged into the later changes of the same rows.",
+		}, []string{"changefeed"})
+	snapshotTsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "snapshot_ts",
+			Help:      "The physical time of the resolved ts of the last snapshot applied to the downstream.",
+		}, []string{"changefeed"})
+	snapshotDMLHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "snapshot_dml_count",
+			Help:      "The number of the compacted DMLs of the snapshots applied to the downstream.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 12),
+		}, []string{"changefeed"})
+	circuitBreakerStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "circuit_breaker_state",
+			Help:      "The state of the circuit breaker of the sink, 0 closed, 1 open, 2 half-open.",
+		}, []string{"changefeed"})
+	circuitBreakerTransitionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "circuit_breaker_transition_count",
+			Help:      "The number of times the circuit breaker of the sink changes to the state.",
+		}, []string{"changefeed", "state"})
+)
+
+// InitMetrics registers all metrics in this file
+func InitMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(encodedMessageCounter)
+	registry.MustRegister(encodedBytesCounter)
+	registry.MustRegister(encodeBusySecondsCounter)
+	registry.MustRegister(encodeWorkerGauge)
+	registry.MustRegister(stmtCacheCounter)
+	registry.MustRegister(rateLimitWaitSecondsCounter)
+	registry.MustRegister(compactedDMLCounter)
+	registry.MustRegister(snapshotTsGauge)
+	registry.MustRegister(snapshotDMLHistogram)
+	registry.MustRegister(circuitBreakerStateGauge)
+	registry.MustRegister(circuitBreakerTransitionCounter)
+}
@@ -16,14 +16,19 @@ package sink
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/url"
 	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
-	"github.com/pingcap/ticdc/pkg/retry"
-
+	"github.com/cenkalti/backoff"
 	dmysql "github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
@@ -32,6 +37,7 @@ import (
 	"github.com/pingcap/parser/terror"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/cdc/sink/config"
 	"github.com/pingcap/ticdc/pkg/util"
 	tddl "github.com/pingcap/tidb/ddl"
 	"github.com/pingcap/tidb/infoschema"
@@ -39,31 +45,303 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	defaultWorkerCount      = 16
+	defaultMaxBatchSize     = 128
+	defaultSafeModeDuration = 5 * time.Minute
+	defaultMaxRetry         = 10
+	defaultRetryBackoff     = 500 * time.Millisecond
+	defaultMaxRetryBackoff  = 30 * time.Second
+	defaultMaxTxnRows       = 10000
+	defaultMaxTxnBytes      = 64 * 1024 * 1024
+)
+
+// the strategies of writing the rows whether they exist or not
+const (
+	upsertReplace           = "replace"
+	upsertOnDuplicateUpdate = "on-duplicate-update"
+	upsertInsertIgnore      = "insert-ignore"
+)
+
+// the parameters of the MySQL sink in the sink uri
+var (
+	workerCountParam      = config.IntParam("worker-count", 1)
+	maxBatchSizeParam     = config.IntParam("max-batch-size", 1)
+	safeModeParam         = config.BoolParam("safe-mode")
+	safeModeDurationParam = config.DurationParam("safe-mode-duration", 0)
+	maxRetryParam         = config.IntParam("max-retry", 0)
+	retryBackoffParam     = config.DurationParam("retry-backoff", 1)
+	maxRetryBackoffParam  = config.DurationParam("max-retry-backoff", 1)
+	splitTxnParam         = config.BoolParam("split-txn")
+	maxTxnRowsParam       = config.IntParam("max-txn-rows", 1)
+	maxTxnBytesParam      = config.IntParam("max-txn-bytes", 1)
+	timeZoneParam         = config.StringParam("time-zone")
+	stmtCacheSizeParam    = config.IntParam("stmt-cache-size", 0)
+	upsertStrategyParam   = config.StringParam("upsert-strategy", upsertReplace, upsertOnDuplicateUpdate, upsertInsertIgnore)
+
+	mysqlParams = []*config.Param{workerCountParam, maxBatchSizeParam, safeModeParam, safeModeDurationParam,
+		maxRetryParam, retryBackoffParam, maxRetryBackoffParam, splitTxnParam, maxTxnRowsParam, maxTxnBytesParam,
+		timeZoneParam, stmtCacheSizeParam, upsertStrategyParam}
+)
+
+func init() {
+	// the unknown parameters are the system variables of the sessions
+	config.Register(&config.Scheme{
+		Name:         "mysql",
+		Example:      `"root:password@tcp(127.0.0.1:3306)/"`,
+		Params:       mysqlParams,
+		DSN:          true,
+		AllowUnknown: true,
+		Password:     true,
+		Check: func(uri *config.URI) error {
+			_, err := parseTimeZone(uri.Params)
+			return errors.Trace(err)
+		},
+	})
+}
+
 type mysqlSink struct {
 	db         *sql.DB
 	infoGetter TableInfoGetter
 	ddlOnly    bool
+	// workerCount is the number of workers writing the DMLs concurrently.
+	workerCount int
+	// maxBatchSize is the max number of rows in a multi-row statement, the
+	// rows are written one by one if it's not greater than 1.
+	maxBatchSize int
+	// safeModeEnd is the time the safe mode ends, the safe mode never ends if
+	// it's zero.
+	safeModeEnd time.Time
+	// emitFailed is set if the last EmitDMLs failed, the DMLs of the failed
+	// call may be partially written, so the next call is in safe mode.
+	emitFailed bool
+	// maxRetry is the max number of retries of the retryable errors, the
+	// backoff between the retries starts from retryBackoff and doubles up to
+	// maxRetryBackoff.
+	maxRetry        int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	// splitTxn splits the DMLs written by a worker into the downstream
+	// transactions of at most maxTxnRows rows and maxTxnBytes bytes, the DMLs
+	// are split after all of them are formatted.
+	splitTxn    bool
+	maxTxnRows  int
+	maxTxnBytes int
+	// the executed DDLs are recorded in the table if it's set.
+	ddlTrackSchema string
+	ddlTrackTable  string
+	// timeZone is the time zone of the downstream sessions, the timestamps
+	// are converted from UTC into it.
+	timeZone *time.Location
+	// stmtCache caches the prepared statements of the DMLs, it's nil if the
+	// cache is disabled.
+	stmtCache *stmtCache
+	// upsertStrategy is how the rows are written whether they exist or not,
+	// it's REPLACE if it's empty.
+	upsertStrategy string
 }
 
 var _ Sink = &mysqlSink{}
 
-func configureSinkURI(sinkURI string) (string, error) {
+type mysqlSinkParams struct {
+	workerCount      int
+	maxBatchSize     int
+	safeMode         bool
+	safeModeDuration time.Duration
+	maxRetry         int
+	retryBackoff     time.Duration
+	maxRetryBackoff  time.Duration
+	splitTxn         bool
+	maxTxnRows       int
+	maxTxnBytes      int
+	timeZone         *time.Location
+	stmtCacheSize    int
+	upsertStrategy   string
+}
+
+// applyFeatures overrides the parameters by the feature flags of the
+// changefeed. The rows are batched by the default batch size if batch-dml is
+// enabled while the sink uri disables it with max-batch-size=1.
+func (params *mysqlSinkParams) applyFeatures(opts map[string]string) {
+	if enabled, ok := featureOpt(opts, model.FeatureBatchDML); ok {
+		if !enabled {
+			params.maxBatchSize = 1
+		} else if params.maxBatchSize <= 1 {
+			params.maxBatchSize = defaultMaxBatchSize
+		}
+	}
+	if enabled, ok := featureOpt(opts, model.FeatureSafeMode); ok {
+		params.safeMode = enabled
+	}
+}
+
+// extractSinkParams removes the parameters of the sink from the sink uri, since
+// the parameters left in the DSN are sent to the server as system variables.
+func extractSinkParams(sinkURI string) (string, *mysqlSinkParams, error) {
+	params := &mysqlSinkParams{
+		workerCount:      defaultWorkerCount,
+		maxBatchSize:     defaultMaxBatchSize,
+		safeMode:         true,
+		safeModeDuration: defaultSafeModeDuration,
+		maxRetry:         defaultMaxRetry,
+		retryBackoff:     defaultRetryBackoff,
+		maxRetryBackoff:  defaultMaxRetryBackoff,
+		maxTxnRows:       defaultMaxTxnRows,
+		maxTxnBytes:      defaultMaxTxnBytes,
+		timeZone:         time.UTC,
+		upsertStrategy:   upsertReplace,
+	}
+	dsnCfg, err := dmysql.ParseDSN(sinkURI)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	values := make(url.Values, len(dsnCfg.Params))
+	for k, v := range dsnCfg.Params {
+		values.Set(k, v)
+	}
+	if params.workerCount, err = workerCountParam.Int(values, params.workerCount); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.maxBatchSize, err = maxBatchSizeParam.Int(values, params.maxBatchSize); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.safeMode, err = safeModeParam.Bool(values, params.safeMode); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.safeModeDuration, err = safeModeDurationParam.Duration(values, params.safeModeDuration); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.maxRetry, err = maxRetryParam.Int(values, params.maxRetry); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.retryBackoff, err = retryBackoffParam.Duration(values, params.retryBackoff); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.maxRetryBackoff, err = maxRetryBackoffParam.Duration(values, params.maxRetryBackoff); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.maxRetryBackoff < params.retryBackoff {
+		params.maxRetryBackoff = params.retryBackoff
+	}
+	if params.splitTxn, err = splitTxnParam.Bool(values, params.splitTxn); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.maxTxnRows, err = maxTxnRowsParam.Int(values, params.maxTxnRows); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.maxTxnBytes, err = maxTxnBytesParam.Int(values, params.maxTxnBytes); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.timeZone, err = parseTimeZone(values); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.stmtCacheSize, err = stmtCacheSizeParam.Int(values, params.stmtCacheSize); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	if params.upsertStrategy, err = upsertStrategyParam.String(values, params.upsertStrategy); err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	found := false
+	for _, p := range mysqlParams {
+		if _, ok := dsnCfg.Params[p.Name]; ok {
+			delete(dsnCfg.Params, p.Name)
+			found = true
+		}
+	}
+	if !found {
+		return sinkURI, params, nil
+	}
+	return dsnCfg.FormatDSN(), params, nil
+}
+
+// parseTimeZone returns the time zone of the downstream sessions, it's UTC by
+// default.
+func parseTimeZone(values url.Values) (*time.Location, error) {
+	name, ok := timeZoneParam.Lookup(values)
+	if !ok {
+		return time.UTC, nil
+	}
+	// the Local location has no name known by the downstream
+	if name == "" || name == "Local" {
+		return nil, errors.Errorf("invalid %s: %s, it should be a name of the IANA time zone database like \"Asia/Shanghai\"",
+			timeZoneParam.Name, name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid %s: %s", timeZoneParam.Name, name)
+	}
+	return loc, nil
+}
+
+// configureSinkURI sets the time zone of the downstream sessions, the session
+// variable of a named time zone is quoted, and the downstream should have the
+// time zone tables loaded for it.
+func configureSinkURI(sinkURI string, timeZone *time.Location) (string, error) {
 	dsnCfg, err := dmysql.ParseDSN(sinkURI)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
-	dsnCfg.Loc = time.UTC
+	dsnCfg.Loc = timeZone
 	if dsnCfg.Params == nil {
 		dsnCfg.Params = make(map[string]string, 1)
 	}
 	dsnCfg.DBName = ""
-	dsnCfg.Params["time_zone"] = "UTC"
+	if timeZone == time.UTC {
+		dsnCfg.Params["time_zone"] = "UTC"
+	} else {
+		dsnCfg.Params["time_zone"] = "'" + timeZone.String() + "'"
+	}
 	return dsnCfg.FormatDSN(), nil
 }
 
-// NewMySQLSink creates a new MySQL sink using schema storage
+// NewMySQLSink creates a new MySQL sink using schema storage.
+// The DMLs are written by `worker-count` workers concurrently, the DMLs are
+// dispatched to the workers by the table and the primary key, so the changes of
+// a row are written in order.
+// The consecutive inserts or deletes of a table are written with multi-row
+// statements, the `max-batch-size` parameter of the sink uri limits the number
+// of rows in a statement.
+// In the safe mode, the inserts are written as REPLACE and the updates are
+// written as DELETE and REPLACE, so the changes applied again after a crash
+// don't fail with duplicated keys. The safe mode is always on by default, with
+// `safe-mode=false` it's only on for `safe-mode-duration` after the sink is
+// created, that is, after the changefeed is started or resumed. Note that the
+// row changes of TiKV are inserts even if they update existing rows, so only
+// disable the safe mode if the upstream never updates rows.
+// The deadlocks, lock wait timeouts and broken connections are retried at most
+// `max-retry` times with the exponential backoff between `retry-backoff` and
+// `max-retry-backoff`, while the errors that can't be fixed by retrying, like
+// the syntax errors and the mismatched schemas, fail the changefeed.
+// The DMLs written by a worker are in a single downstream transaction, with
+// `split-txn=true` they are split into transactions of at most `max-txn-rows`
+// rows and `max-txn-bytes` bytes, which keeps the huge upstream transactions
+// within the limits of the downstream, like `txn-total-size-limit` of TiDB, at
+// the cost of the atomicity. It only bounds the downstream transactions, the
+// huge upstream transactions are split before they are mounted by the
+// `max-txn-entries` of the sorter config of the changefeed.
+// The downstream sessions are in UTC by default, with `time-zone` they are in
+// the given time zone, like `time-zone=Asia%2FShanghai`, and the timestamps are
+// converted into it, which keeps the DDLs with timestamp literals consistent
+// with an upstream in the same time zone.
+// With `stmt-cache-size`, at most the number of prepared statements of the
+// DMLs are cached and reused, which saves the round trips of preparing and
+// closing the statements, note that the downstream limits the number of the
+// prepared statements with `max_prepared_stmt_count`, and each connection
+// prepares the statements it executes.
+// The rows written whether they exist or not, like the inserts in the safe
+// mode, are written as REPLACE by default. Since REPLACE deletes the existing
+// row before inserting the new one, which fires the delete triggers and may
+// allocate a new auto-increment id, they can be written as INSERT ... ON
+// DUPLICATE KEY UPDATE of all the columns with `upsert-strategy=on-duplicate-update`,
+// or as INSERT IGNORE with `upsert-strategy=insert-ignore`, which keeps the
+// existing rows, so only use it if the upstream never updates rows.
 func NewMySQLSink(sinkURI string, infoGetter TableInfoGetter, opts map[string]string) (Sink, error) {
-	sinkURI, err := configureSinkURI(sinkURI)
+	sinkURI, params, err := extractSinkParams(sinkURI)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	params.applyFeatures(opts)
+	sinkURI, err = configureSinkURI(sinkURI, params.timeZone)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -71,7 +349,31 @@ func NewMySQLSink(sinkURI string, infoGetter TableInfoGetter, opts map[string]st
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return newMySQLSink(db, infoGetter, false), nil
+	s := newMySQLSink(db, infoGetter, false)
+	s.timeZone = params.timeZone
+	if params.stmtCacheSize > 0 {
+		s.stmtCache = newStmtCache(db, params.stmtCacheSize, opts[OptChangefeedID])
+	}
+	s.workerCount = params.workerCount
+	s.maxBatchSize = params.maxBatchSize
+	s.maxRetry = params.maxRetry
+	s.retryBackoff = params.retryBackoff
+	s.maxRetryBackoff = params.maxRetryBackoff
+	s.splitTxn = params.splitTxn
+	s.upsertStrategy = params.upsertStrategy
+	if table := opts[OptDDLTrackTable]; table != "" {
+		parts := strings.Split(table, ".")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid ddl track table: %s", table)
+		}
+		s.ddlTrackSchema, s.ddlTrackTable = parts[0], parts[1]
+	}
+	s.maxTxnRows = params.maxTxnRows
+	s.maxTxnBytes = params.maxTxnBytes
+	if !params.safeMode {
+		s.safeModeEnd = time.Now().Add(params.safeModeDuration)
+	}
+	return s, nil
 }
 
 // NewMySQLSinkDDLOnly returns a sink that only processes DDL
@@ -79,11 +381,15 @@ func NewMySQLSinkDDLOnly(db *sql.DB) Sink {
 	return newMySQLSink(db, nil, true)
 }
 
-func newMySQLSink(db *sql.DB, infoGetter TableInfoGetter, ddlOnly bool) Sink {
+func newMySQLSink(db *sql.DB, infoGetter TableInfoGetter, ddlOnly bool) *mysqlSink {
 	return &mysqlSink{
-		db:         db,
-		infoGetter: infoGetter,
-		ddlOnly:    ddlOnly,
+		db:              db,
+		infoGetter:      infoGetter,
+		ddlOnly:         ddlOnly,
+		maxRetry:        defaultMaxRetry,
+		retryBackoff:    defaultRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+		timeZone:        time.UTC,
 	}
 }
 
@@ -91,8 +397,50 @@ func (s *mysqlSink) EmitDDL(ctx context.Context, t model.Txn) error {
 	if !t.IsDDL() {
 		return errors.New("not a DDL")
 	}
-	err := s.execDDLWithMaxRetries(ctx, t.DDL, 5)
-	return errors.Trace(err)
+	err := s.execWithRetry(ctx, func() error {
+		err := s.execDDL(ctx, t.DDL)
+		if isIgnorableDDLError(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.trackDDL(ctx, t))
+}
+
+const createDDLTrackTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+	commit_ts BIGINT UNSIGNED NOT NULL,
+	job_id BIGINT NOT NULL,
+	schema_name VARCHAR(64) NOT NULL,
+	table_name VARCHAR(64) NOT NULL,
+	ddl_type VARCHAR(64) NOT NULL,
+	query TEXT NOT NULL,
+	executed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (commit_ts, job_id)
+);`
+
+// trackDDL records the executed DDL in the tracking table. The DDL executed
+// again after a crash replaces the record, so does the DDL ignored for the
+// table or the database already existing or not existing.
+func (s *mysqlSink) trackDDL(ctx context.Context, t model.Txn) error {
+	if s.ddlTrackTable == "" {
+		return nil
+	}
+	name := util.QuoteSchema(s.ddlTrackSchema, s.ddlTrackTable)
+	return s.execWithRetry(ctx, func() error {
+		if _, err := s.db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+util.QuoteName(s.ddlTrackSchema)+";"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(createDDLTrackTableSQL, name)); err != nil {
+			return errors.Trace(err)
+		}
+		_, err := s.db.ExecContext(ctx,
+			"REPLACE INTO "+name+"(commit_ts,job_id,schema_name,table_name,ddl_type,query) VALUES (?,?,?,?,?,?);",
+			t.Ts, t.DDL.Job.ID, t.DDL.Database, t.DDL.Table, t.DDL.Job.Type.String(), t.DDL.Job.Query)
+		return errors.Trace(err)
+	})
 }
 
 func (s *mysqlSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
@@ -108,28 +456,55 @@ func (s *mysqlSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
 		allDMLs = append(allDMLs, dmls...)
 	}
 
-	dmlGroups := splitIndependentGroups(allDMLs)
-	return s.concurrentExec(ctx, dmlGroups)
+	// a snapshot is applied in one transaction, so it's never partially
+	// visible in the downstream
+	if isAtomicEmit(ctx) {
+		safeMode := s.inSafeMode() || s.emitFailed
+		err := s.execWithRetry(ctx, func() error {
+			return s.execDMLs(ctx, allDMLs, safeMode)
+		})
+		s.emitFailed = err != nil
+		return errors.Trace(err)
+	}
+
+	workerCount := s.workerCount
+	if workerCount <= 0 {
+		workerCount = defaultWorkerCount
+	}
+	dmlGroups := s.splitIndependentGroups(allDMLs, workerCount)
+	err := s.concurrentExec(ctx, dmlGroups, s.inSafeMode() || s.emitFailed)
+	s.emitFailed = err != nil
+	return err
 }
 
-func (s *mysqlSink) concurrentExec(ctx context.Context, dmlGroups [][]*model.DML) error {
+// FlushCheckpoint returns ts since the transactions are committed before
+// EmitDMLs returns.
+func (s *mysqlSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	return ts, nil
+}
+
+func (s *mysqlSink) inSafeMode() bool {
+	return s.safeModeEnd.IsZero() || time.Now().Before(s.safeModeEnd)
+}
+
+func (s *mysqlSink) concurrentExec(ctx context.Context, dmlGroups [][]*model.DML, safeMode bool) error {
 	jobs := make(chan []*model.DML, len(dmlGroups))
 	for _, dmls := range dmlGroups {
 		jobs <- dmls
 	}
 	close(jobs)
 
-	nWorkers := 16
-	if len(dmlGroups) < nWorkers {
-		nWorkers = len(dmlGroups)
-	}
 	eg, _ := errgroup.WithContext(ctx)
-	for i := 0; i < nWorkers; i++ {
+	for i := 0; i < len(dmlGroups); i++ {
 		eg.Go(func() error {
 			for dmls := range jobs {
-				// TODO: Add retry
-				if err := s.execDMLs(ctx, dmls); err != nil {
-					return errors.Trace(err)
+				for _, txnDMLs := range s.splitLargeTxn(dmls) {
+					err := s.execWithRetry(ctx, func() error {
+						return s.execDMLs(ctx, txnDMLs, safeMode)
+					})
+					if err != nil {
+						return errors.Trace(err)
+					}
 				}
 			}
 			return nil
@@ -138,18 +513,61 @@ func (s *mysqlSink) concurrentExec(ctx context.Context, dmlGroups [][]*model.DML
 	return eg.Wait()
 }
 
+// splitLargeTxn splits the DMLs into the downstream transactions bounded by the
+// number of rows and the approximate size if the splitting is enabled. The
+// DMLs are already in memory, so only the size of the downstream transactions
+// is bounded.
+func (s *mysqlSink) splitLargeTxn(dmls []*model.DML) [][]*model.DML {
+	if !s.splitTxn {
+		return [][]*model.DML{dmls}
+	}
+	var (
+		txns        [][]*model.DML
+		start, size int
+	)
+	for i, dml := range dmls {
+		rowSize := estimateDMLSize(dml)
+		if i > start && (i-start >= s.maxTxnRows || size+rowSize > s.maxTxnBytes) {
+			txns = append(txns, dmls[start:i])
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	if start < len(dmls) {
+		txns = append(txns, dmls[start:])
+	}
+	return txns
+}
+
 func (s *mysqlSink) Close() error {
-	return nil
+	if s.stmtCache != nil {
+		s.stmtCache.close()
+	}
+	return errors.Trace(s.db.Close())
 }
 
-func (s *mysqlSink) execDDLWithMaxRetries(ctx context.Context, ddl *model.DDL, maxRetries uint64) error {
-	return retry.Run(func() error {
-		err := s.execDDL(ctx, ddl)
-		if isIgnorableDDLError(err) {
-			return nil
+// execWithRetry runs f and retries the retryable errors with the exponential
+// backoff and jitter, the fatal errors are wrapped to fail the changefeed.
+func (s *mysqlSink) execWithRetry(ctx context.Context, f func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = s.retryBackoff
+	b.MaxInterval = s.maxRetryBackoff
+	b.MaxElapsedTime = 0
+	b.Reset()
+	retryCfg := backoff.WithContext(backoff.WithMaxRetries(b, uint64(s.maxRetry)), ctx)
+	err := backoff.RetryNotify(func() error {
+		err := f()
+		if err == nil || isRetryableError(err) {
+			return err
 		}
-		return err
-	}, maxRetries)
+		return backoff.Permanent(err)
+	}, retryCfg, func(err error, d time.Duration) {
+		log.Warn("write to downstream failed, retry later", zap.Error(err), zap.Duration("backoff", d))
+	})
+	if err != nil && isFatalError(err) {
+		return errors.Trace(newFatalError(err))
+	}
+	return errors.Trace(err)
 }
 
 func (s *mysqlSink) execDDL(ctx context.Context, ddl *model.DDL) error {
@@ -185,46 +603,207 @@ func (s *mysqlSink) execDDL(ctx context.Context, ddl *model.DDL) error {
 	return nil
 }
 
-func (s *mysqlSink) execDMLs(ctx context.Context, dmls []*model.DML) error {
+func (s *mysqlSink) execDMLs(ctx context.Context, dmls []*model.DML, safeMode bool) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	for _, dml := range dmls {
-		var fPrepare func(*model.DML) (string, []interface{}, error)
-		switch dml.Tp {
-		case model.InsertDMLType, model.UpdateDMLType:
-			fPrepare = s.prepareReplace
-		case model.DeleteDMLType:
-			fPrepare = s.prepareDelete
-		default:
-			return fmt.Errorf("invalid dml type: %v", dml.Tp)
-		}
-		query, args, err := fPrepare(dml)
+	count := len(dmls)
+	for len(dmls) > 0 {
+		n := s.batchLen(dmls, safeMode)
+		queries, args, err := s.prepareBatch(dmls[:n], safeMode)
 		if err != nil {
 			if rbErr := tx.Rollback(); rbErr != nil {
 				log.Error("Failed to rollback", zap.Error(err))
 			}
 			return errors.Trace(err)
 		}
-		log.Debug("exec dml", zap.String("sql", query), zap.Any("args", args))
-		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				log.Error("Failed to rollback", zap.String("sql", query), zap.Error(err))
+		for i, query := range queries {
+			log.Debug("exec dml", zap.String("sql", query), zap.Any("args", args[i]), zap.Int("rows", n))
+			if err := s.execStmt(ctx, tx, dmls[0], query, args[i]); err != nil {
+				if rbErr := tx.Rollback(); rbErr != nil {
+					log.Error("Failed to rollback", zap.String("sql", query), zap.Error(err))
+				}
+				// the statements of a batch are of the same table
+				if isTableError(err) {
+					return errors.Trace(NewTableError(dmls[0].Database, dmls[0].Table, err))
+				}
+				return errors.Trace(err)
 			}
-			return errors.Trace(err)
 		}
+		dmls = dmls[n:]
 	}
 
 	if err = tx.Commit(); err != nil {
 		return errors.Trace(err)
 	}
 
-	log.Info("Exec DML succeeded", zap.Int("num of DMLs", len(dmls)))
+	log.Info("Exec DML succeeded", zap.Int("num of DMLs", count), zap.Bool("safe mode", safeMode))
 	return nil
 }
 
+// execStmt executes the statement writing the DMLs of a table in the
+// transaction, the prepared statement is reused if the cache is enabled.
+func (s *mysqlSink) execStmt(ctx context.Context, tx *sql.Tx, dml *model.DML, query string, args []interface{}) error {
+	if s.stmtCache == nil {
+		_, err := tx.ExecContext(ctx, query, args...)
+		return errors.Trace(err)
+	}
+	schema, table := dml.TargetName()
+	key := stmtKey{schema: schema, table: table, query: query}
+	if info, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table); ok {
+		key.version = info.UpdateTS
+	}
+	cs, err := s.stmtCache.get(ctx, key)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer s.stmtCache.release(cs)
+	stmt := tx.StmtContext(ctx, cs.stmt)
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, args...)
+	return errors.Trace(err)
+}
+
+// the kinds of the statements written by the DMLs
+const (
+	stmtReplace = iota
+	stmtInsert
+	stmtUpdate
+	stmtDelete
+)
+
+// stmtKind returns the kind of the statement the DML is written with. The
+// updates without the old values can only be written as REPLACE.
+func stmtKind(dml *model.DML, safeMode bool) int {
+	switch dml.Tp {
+	case model.InsertDMLType:
+		if safeMode {
+			return stmtReplace
+		}
+		return stmtInsert
+	case model.UpdateDMLType:
+		if dml.OldValues == nil {
+			return stmtReplace
+		}
+		return stmtUpdate
+	default:
+		return stmtDelete
+	}
+}
+
+// batchLen returns the number of the leading DMLs can be written in one
+// statement. The inserts of a table are merged into a multi-row INSERT or
+// REPLACE, the deletes of a table are merged into a DELETE ... IN if the rows
+// are identified by the same unique key, the updates are never merged.
+func (s *mysqlSink) batchLen(dmls []*model.DML, safeMode bool) int {
+	first := dmls[0]
+	kind := stmtKind(first, safeMode)
+	if s.maxBatchSize <= 1 || len(dmls) == 1 || kind == stmtUpdate {
+		return 1
+	}
+	var keyCols []string
+	if kind == stmtDelete {
+		info, ok := s.infoGetter.GetTableByName(first.Database, first.Table)
+		if !ok {
+			return 1
+		}
+		if keyCols, _, ok = uniqueKeySlice(info, first.Values); !ok {
+			return 1
+		}
+	}
+	n := 1
+	for ; n < len(dmls) && n < s.maxBatchSize; n++ {
+		dml := dmls[n]
+		if dml.Database != first.Database || dml.Table != first.Table {
+			break
+		}
+		if stmtKind(dml, safeMode) != kind {
+			break
+		}
+		if kind == stmtDelete {
+			info, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
+			if !ok {
+				break
+			}
+			cols, _, ok := uniqueKeySlice(info, dml.Values)
+			if !ok || buildColumnList(cols) != buildColumnList(keyCols) {
+				break
+			}
+		}
+	}
+	return n
+}
+
+// prepareBatch builds the statements writing the DMLs, the DMLs should be
+// batched by batchLen.
+func (s *mysqlSink) prepareBatch(dmls []*model.DML, safeMode bool) ([]string, [][]interface{}, error) {
+	var (
+		query string
+		args  []interface{}
+		err   error
+	)
+	switch stmtKind(dmls[0], safeMode) {
+	case stmtReplace:
+		query, args, err = s.prepareUpsert(dmls)
+	case stmtInsert:
+		query, args, err = s.prepareInsert("INSERT", dmls, false)
+	case stmtUpdate:
+		if safeMode {
+			return s.prepareDeleteReplace(dmls[0])
+		}
+		query, args, err = s.prepareUpdate(dmls[0])
+	case stmtDelete:
+		if dmls[0].Tp != model.DeleteDMLType {
+			return nil, nil, fmt.Errorf("invalid dml type: %v", dmls[0].Tp)
+		}
+		if len(dmls) == 1 {
+			query, args, err = s.prepareDelete(dmls[0])
+		} else {
+			query, args, err = s.prepareBatchDelete(dmls)
+		}
+	}
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return []string{query}, [][]interface{}{args}, nil
+}
+
+// prepareDeleteReplace builds a DELETE of the old row and an upsert of the new
+// row for an update. The DELETE is only needed when the update changes a key of
+// the row, otherwise the upsert overwrites the old row by itself, except for
+// INSERT IGNORE which would leave it as is.
+func (s *mysqlSink) prepareDeleteReplace(dml *model.DML) ([]string, [][]interface{}, error) {
+	table, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
+	if !ok {
+		return nil, nil, fmt.Errorf("table not found: %s.%s", dml.Database, dml.Table)
+	}
+	if s.upsertStrategy != upsertInsertIgnore && !keyChanged(table, dml) {
+		query, args, err := s.prepareUpsert([]*model.DML{dml})
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		return []string{query}, [][]interface{}{args}, nil
+	}
+	deleteQuery, deleteArgs, err := s.prepareDelete(&model.DML{
+		Database:       dml.Database,
+		Table:          dml.Table,
+		Tp:             model.DeleteDMLType,
+		Values:         dml.OldValues,
+		TargetDatabase: dml.TargetDatabase,
+		TargetTable:    dml.TargetTable,
+	})
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	replaceQuery, replaceArgs, err := s.prepareUpsert([]*model.DML{dml})
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return []string{deleteQuery, replaceQuery}, [][]interface{}{deleteArgs, replaceArgs}, nil
+}
+
 func (s *mysqlSink) formatDMLs(dmls []*model.DML) ([]*model.DML, error) {
 	result := make([]*model.DML, 0, len(dmls))
 	for _, dml := range dmls {
@@ -232,16 +811,44 @@ func (s *mysqlSink) formatDMLs(dmls []*model.DML) ([]*model.DML, error) {
 		if !ok {
 			return nil, fmt.Errorf("table not found: %s.%s", dml.Database, dml.Table)
 		}
+		if err := convertTimestamps(tableInfo, dml.Values, s.timeZone); err != nil {
+			return nil, errors.Trace(err)
+		}
 		err := formatValues(tableInfo, dml.Values)
 		if err != nil {
 			return nil, err
 		}
+		if dml.OldValues != nil {
+			if err := convertTimestamps(tableInfo, dml.OldValues, s.timeZone); err != nil {
+				return nil, errors.Trace(err)
+			}
+			if err := formatValues(tableInfo, dml.OldValues); err != nil {
+				return nil, err
+			}
+		}
 		result = append(result, dml)
 	}
 	return result, nil
 }
 
-func (s *mysqlSink) prepareReplace(dml *model.DML) (string, []interface{}, error) {
+// prepareUpsert builds the statement writing the rows of the DMLs whether they
+// exist or not with the upsert strategy of the sink.
+func (s *mysqlSink) prepareUpsert(dmls []*model.DML) (string, []interface{}, error) {
+	switch s.upsertStrategy {
+	case upsertOnDuplicateUpdate:
+		return s.prepareInsert("INSERT", dmls, true)
+	case upsertInsertIgnore:
+		return s.prepareInsert("INSERT IGNORE", dmls, false)
+	default:
+		return s.prepareInsert("REPLACE", dmls, false)
+	}
+}
+
+// prepareInsert builds an INSERT or REPLACE statement writing the rows of the
+// DMLs, the DMLs should be the inserts or updates of the same table. With
+// onDuplicateUpdate, all the columns of the existing rows are updated.
+func (s *mysqlSink) prepareInsert(verb string, dmls []*model.DML, onDuplicateUpdate bool) (string, []interface{}, error) {
+	dml := dmls[0]
 	info, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
 	if !ok {
 		return "", nil, fmt.Errorf("Table not found: %s", dml.TableName())
@@ -249,18 +856,35 @@ func (s *mysqlSink) prepareReplace(dml *model.DML) (string, []interface{}, error
 	columns := getColNames(info.WritableColumns())
 	var builder strings.Builder
 	cols := "(" + buildColumnList(columns) + ")"
-	tblName := util.QuoteSchema(dml.Database, dml.Table)
-	builder.WriteString("REPLACE INTO " + tblName + cols + " VALUES ")
-	builder.WriteString("(" + util.HolderString(len(columns)) + ");")
+	tblName := dml.TargetTableName()
+	builder.WriteString(verb + " INTO " + tblName + cols + " VALUES ")
+	holder := "(" + util.HolderString(len(columns)) + ")"
 
-	args := make([]interface{}, 0, len(columns))
-	for _, name := range columns {
-		val, ok := dml.Values[name]
-		if !ok {
-			return "", nil, fmt.Errorf("missing value for column: %s", name)
+	args := make([]interface{}, 0, len(columns)*len(dmls))
+	for i, dml := range dmls {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(holder)
+		for _, name := range columns {
+			val, ok := dml.Values[name]
+			if !ok {
+				return "", nil, fmt.Errorf("missing value for column: %s", name)
+			}
+			args = append(args, val.GetValue())
 		}
-		args = append(args, val.GetValue())
 	}
+	if onDuplicateUpdate {
+		builder.WriteString(" ON DUPLICATE KEY UPDATE ")
+		for i, name := range columns {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			quoted := util.QuoteName(name)
+			builder.WriteString(quoted + "=VALUES(" + quoted + ")")
+		}
+	}
+	builder.WriteString(";")
 
 	return builder.String(), args, nil
 }
@@ -272,7 +896,7 @@ func (s *mysqlSink) prepareDelete(dml *model.DML) (string, []interface{}, error)
 	}
 
 	var builder strings.Builder
-	builder.WriteString("DELETE FROM " + dml.TableName() + " WHERE ")
+	builder.WriteString("DELETE FROM " + dml.TargetTableName() + " WHERE ")
 
 	colNames, wargs := whereSlice(info, dml.Values)
 	args := make([]interface{}, 0, len(wargs))
@@ -292,6 +916,120 @@ func (s *mysqlSink) prepareDelete(dml *model.DML) (string, []interface{}, error)
 	return sql, args, nil
 }
 
+// prepareUpdate builds an UPDATE statement of the row identified by the old
+// values.
+func (s *mysqlSink) prepareUpdate(dml *model.DML) (string, []interface{}, error) {
+	info, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
+	if !ok {
+		return "", nil, fmt.Errorf("Table not found: %s", dml.TableName())
+	}
+	columns := getColNames(info.WritableColumns())
+	var builder strings.Builder
+	builder.WriteString("UPDATE " + dml.TargetTableName() + " SET ")
+	args := make([]interface{}, 0, len(columns))
+	for i, name := range columns {
+		val, ok := dml.Values[name]
+		if !ok {
+			return "", nil, fmt.Errorf("missing value for column: %s", name)
+		}
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(util.QuoteName(name) + " = ?")
+		args = append(args, val.GetValue())
+	}
+
+	builder.WriteString(" WHERE ")
+	colNames, wargs := whereSlice(info, dml.OldValues)
+	for i := 0; i < len(colNames); i++ {
+		if i > 0 {
+			builder.WriteString(" AND ")
+		}
+		if wargs[i].IsNull() {
+			builder.WriteString(util.QuoteName(colNames[i]) + " IS NULL")
+		} else {
+			builder.WriteString(util.QuoteName(colNames[i]) + " = ?")
+			args = append(args, wargs[i].GetValue())
+		}
+	}
+	builder.WriteString(" LIMIT 1;")
+	return builder.String(), args, nil
+}
+
+// prepareBatchDelete builds a DELETE ... IN statement deleting the rows of the
+// DMLs, the rows should be identified by the same unique key.
+func (s *mysqlSink) prepareBatchDelete(dmls []*model.DML) (string, []interface{}, error) {
+	dml := dmls[0]
+	info, ok := s.infoGetter.GetTableByName(dml.Database, dml.Table)
+	if !ok {
+		return "", nil, fmt.Errorf("Table not found: %s", dml.TableName())
+	}
+
+	colNames, _, ok := uniqueKeySlice(info, dml.Values)
+	if !ok {
+		return "", nil, fmt.Errorf("no unique key to delete rows in batch: %s", dml.TableName())
+	}
+	var builder strings.Builder
+	builder.WriteString("DELETE FROM " + dml.TargetTableName() + " WHERE (" + buildColumnList(colNames) + ") IN (")
+	holder := "(" + util.HolderString(len(colNames)) + ")"
+	args := make([]interface{}, 0, len(colNames)*len(dmls))
+	for i, dml := range dmls {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(holder)
+		for _, v := range whereValues(dml.Values, colNames) {
+			if v.IsNull() {
+				return "", nil, fmt.Errorf("null value of unique key to delete rows in batch: %s", dml.TableName())
+			}
+			args = append(args, v.GetValue())
+		}
+	}
+	builder.WriteString(");")
+	return builder.String(), args, nil
+}
+
+// convertTimestamps converts the timestamps of the row from UTC, in which the
+// upstream stores them, into the time zone of the downstream sessions. The
+// values formatted already are not converted again.
+func convertTimestamps(table *schema.TableInfo, colVals map[string]types.Datum, timeZone *time.Location) error {
+	if timeZone == nil || timeZone == time.UTC {
+		return nil
+	}
+	for _, col := range table.WritableColumns() {
+		if col.Tp != mysql.TypeTimestamp {
+			continue
+		}
+		value, ok := colVals[col.Name.O]
+		if !ok || value.Kind() != types.KindMysqlTime {
+			continue
+		}
+		t := value.GetMysqlTime()
+		if err := t.ConvertTimeZone(time.UTC, timeZone); err != nil {
+			return errors.Annotatef(err, "convert timestamp of column %s", col.Name.O)
+		}
+		value.SetMysqlTime(t)
+		colVals[col.Name.O] = value
+	}
+	return nil
+}
+
+// insertableValues returns the values of the columns which can be inserted
+// downstream, the generated columns are excluded since the downstream computes
+// them.
+func insertableValues(table *schema.TableInfo, colVals map[string]types.Datum) map[string]types.Datum {
+	if !table.HasGeneratedColumns() {
+		return colVals
+	}
+	values := make(map[string]types.Datum, len(colVals))
+	for name, value := range colVals {
+		if table.ColumnGenerated(name) == schema.NotGenerated {
+			values[name] = value
+		}
+	}
+	return values
+}
+
 func formatValues(table *schema.TableInfo, colVals map[string]types.Datum) error {
 	columns := table.WritableColumns()
 	// TODO get table infos from txn for emit interface
@@ -341,9 +1079,32 @@ func whereValues(colVals map[string]types.Datum, names []string) (values []types
 	return
 }
 
-func whereSlice(table *schema.TableInfo, colVals map[string]types.Datum) (colNames []string, args []types.Datum) {
-	// Try to use unique key values when available
-	for _, idxCols := range table.GetUniqueKeys() {
+// keyChanged returns whether the update changes the values of any unique key of
+// the row, it's true if the table has no unique key at all.
+func keyChanged(table *schema.TableInfo, dml *model.DML) bool {
+	keys := table.UniqueKeys(true)
+	if len(keys) == 0 {
+		return true
+	}
+	for _, key := range keys {
+		oldValues := whereValues(dml.OldValues, key.Columns)
+		newValues := whereValues(dml.Values, key.Columns)
+		for i := range oldValues {
+			if oldValues[i].IsNull() != newValues[i].IsNull() ||
+				fmt.Sprintf("%v", oldValues[i].GetValue()) != fmt.Sprintf("%v", newValues[i].GetValue()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uniqueKeySlice returns the columns and values of the safest unique key without
+// NULL values, ok is false if there's no such a key. A unique key with nullable
+// columns identifies the row too if none of its values is NULL.
+func uniqueKeySlice(table *schema.TableInfo, colVals map[string]types.Datum) (colNames []string, args []types.Datum, ok bool) {
+	for _, key := range table.UniqueKeys(true) {
+		idxCols := key.Columns
 		values := whereValues(colVals, idxCols)
 		notAnyNil := true
 		for i := 0; i < len(values); i++ {
@@ -353,9 +1114,17 @@ func whereSlice(table *schema.TableInfo, colVals map[string]types.Datum) (colNam
 			}
 		}
 		if notAnyNil {
-			return idxCols, values
+			return idxCols, values, true
 		}
 	}
+	return nil, nil, false
+}
+
+func whereSlice(table *schema.TableInfo, colVals map[string]types.Datum) (colNames []string, args []types.Datum) {
+	// Try to use unique key values when available
+	if colNames, args, ok := uniqueKeySlice(table, colVals); ok {
+		return colNames, args
+	}
 
 	// Fallback to use all columns
 	cols := getColNames(table.WritableColumns())
@@ -382,6 +1151,67 @@ func isIgnorableDDLError(err error) bool {
 	}
 }
 
+// isRetryableError tells whether the error is transient, like the deadlocks,
+// the lock wait timeouts and the broken connections.
+func isRetryableError(err error) bool {
+	switch cause := errors.Cause(err); cause {
+	case driver.ErrBadConn, dmysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	default:
+		if _, ok := cause.(net.Error); ok {
+			return true
+		}
+		if errno, ok := cause.(syscall.Errno); ok {
+			return errno == syscall.ECONNRESET || errno == syscall.ECONNREFUSED || errno == syscall.EPIPE
+		}
+	}
+	errCode, ok := getSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	switch errCode {
+	case mysql.ErrLockDeadlock, mysql.ErrLockWaitTimeout, mysql.ErrWriteConflict, mysql.ErrInfoSchemaChanged,
+		mysql.ErrTiKVServerTimeout, mysql.ErrTiKVServerBusy, mysql.ErrRegionUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// isFatalError tells whether the error can't be fixed without the intervention
+// of users, like the syntax errors and the schemas mismatched with upstream.
+func isFatalError(err error) bool {
+	errCode, ok := getSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	switch errCode {
+	case mysql.ErrParse, mysql.ErrSyntax, mysql.ErrNoSuchTable, mysql.ErrBadDB, mysql.ErrBadField,
+		mysql.ErrWrongValueCountOnRow, mysql.ErrBadNull, mysql.ErrNoDefaultForField, mysql.ErrDataTooLong,
+		mysql.ErrTruncatedWrongValueForField, mysql.ErrWarnDataOutOfRange,
+		mysql.ErrAccessDenied, mysql.ErrTableaccessDenied:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTableError tells whether the error is caused by the downstream table of a
+// statement, the other tables may still be written.
+func isTableError(err error) bool {
+	errCode, ok := getSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	switch errCode {
+	case mysql.ErrNoSuchTable, mysql.ErrBadField, mysql.ErrWrongValueCountOnRow,
+		mysql.ErrNoDefaultForField, mysql.ErrTableaccessDenied:
+		return true
+	default:
+		return false
+	}
+}
+
 func getSQLErrCode(err error) (terror.ErrCode, bool) {
 	mysqlErr, ok := errors.Cause(err).(*dmysql.MySQLError)
 	if !ok {
@@ -412,19 +1242,44 @@ func getColNames(cols []*timodel.ColumnInfo) []string {
 	return names
 }
 
-// splitIndependentGroups splits DMLs into independent groups.
-// Two groups of DMLs are considered independent if they can be
-// executed concurrently.
-func splitIndependentGroups(dmls []*model.DML) [][]*model.DML {
-	// TODO: Detect causality of changes to achieve more fine-grain split
-	tables := make(map[string][]*model.DML)
-	for _, dml := range dmls {
-		tbl := dml.TableName()
-		tables[tbl] = append(tables[tbl], dml)
+// splitIndependentGroups splits DMLs into at most n independent groups, which
+// can be executed concurrently. The DMLs are hashed by the table and the values
+// of the unique key, so the changes of a row are kept in order in a group. The
+// DMLs of a table without a unique key or with multiple unique keys are hashed
+// by the table only, since the rows may conflict on any of the columns or keys.
+// The unique keys with nullable columns count, since the rows may conflict on
+// them if the values aren't NULL. If an update changes the key of a row, all
+// the DMLs of the table are hashed by the table only, since the old key may be
+// reused by the other rows. The tables are the downstream ones, so the rows of
+// the upstream tables routed to the same table are kept in order.
+func (s *mysqlSink) splitIndependentGroups(dmls []*model.DML, n int) [][]*model.DML {
+	keys := make([]string, len(dmls))
+	byTable := make(map[string]bool)
+	for i, dml := range dmls {
+		key, ok := compactRowKey(s.infoGetter, dml)
+		if !ok {
+			byTable[dml.TargetTableName()] = true
+		}
+		keys[i] = key
 	}
-	groups := make([][]*model.DML, 0, len(tables))
-	for _, dmls := range tables {
-		groups = append(groups, dmls)
+
+	buckets := make([][]*model.DML, n)
+	hasher := fnv.New32a()
+	for i, dml := range dmls {
+		hasher.Reset()
+		hasher.Write([]byte(dml.TargetTableName()))
+		if !byTable[dml.TargetTableName()] {
+			hasher.Write([]byte{0})
+			hasher.Write([]byte(keys[i]))
+		}
+		idx := hasher.Sum32() % uint32(n)
+		buckets[idx] = append(buckets[idx], dml)
+	}
+	groups := make([][]*model.DML, 0, n)
+	for _, dmls := range buckets {
+		if len(dmls) > 0 {
+			groups = append(groups, dmls)
+		}
 	}
 	return groups
 }
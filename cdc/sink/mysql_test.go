@@ -15,18 +15,25 @@ package sink
 
 import (
 	"context"
+	"database/sql/driver"
+	"fmt"
 	"sort"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	dmysql "github.com/go-sql-driver/mysql"
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/parser/types"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/schema"
 	"github.com/pingcap/tidb/infoschema"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
 	dbtypes "github.com/pingcap/tidb/types"
 )
 
@@ -69,6 +76,44 @@ func (s EmitSuite) TestShouldExecDDL(c *check.C) {
 	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
 }
 
+func (s EmitSuite) TestTrackDDL(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:             db,
+		ddlTrackSchema: "tidb_cdc",
+		ddlTrackTable:  "ddl_history",
+	}
+	t := model.Txn{
+		Ts: 100,
+		DDL: &model.DDL{
+			Database: "test",
+			Table:    "user",
+			Job: &timodel.Job{
+				ID:    5,
+				Type:  timodel.ActionCreateTable,
+				Query: "CREATE TABLE user (id INT PRIMARY KEY);",
+			},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("USE `test`;").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(t.DDL.Job.Query).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `tidb_cdc`;").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(fmt.Sprintf(createDDLTrackTableSQL, "`tidb_cdc`.`ddl_history`")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("REPLACE INTO `tidb_cdc`.`ddl_history`(commit_ts,job_id,schema_name,table_name,ddl_type,query) VALUES (?,?,?,?,?,?);").
+		WithArgs(100, 5, "test", "user", "create table", t.DDL.Job.Query).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = sink.EmitDDL(context.Background(), t)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
 func (s EmitSuite) TestShouldIgnoreCertainDDLError(c *check.C) {
 	// Set up
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -238,10 +283,606 @@ func (s EmitSuite) TestConfigureSinkURI(c *check.C) {
 		expected: "root@tcp(127.0.0.1:3306)/?some_option=BB&time_zone=UTC",
 	}}
 	for _, cs := range cases {
-		sink, err := configureSinkURI(cs.input)
+		sink, err := configureSinkURI(cs.input, time.UTC)
 		c.Assert(err, check.IsNil)
 		c.Assert(sink, check.Equals, cs.expected)
 	}
+
+	// the named time zone is quoted
+	sink, err := configureSinkURI("root@tcp(127.0.0.1:3306)/", time.FixedZone("Asia/Shanghai", 8*3600))
+	c.Assert(err, check.IsNil)
+	c.Assert(sink, check.Equals, "root@tcp(127.0.0.1:3306)/?loc=Asia%2FShanghai&time_zone=%27Asia%2FShanghai%27")
+}
+
+func (s EmitSuite) TestApplyFeatures(c *check.C) {
+	feature := func(name string, enabled bool) map[string]string {
+		return map[string]string{model.FeatureOptPrefix + name: fmt.Sprint(enabled)}
+	}
+	_, params, err := extractSinkParams("root@tcp(127.0.0.1:3306)/?max-batch-size=1")
+	c.Assert(err, check.IsNil)
+	params.applyFeatures(nil)
+	c.Assert(params.maxBatchSize, check.Equals, 1)
+	// the batch is enabled with the default size
+	params.applyFeatures(feature(model.FeatureBatchDML, true))
+	c.Assert(params.maxBatchSize, check.Equals, defaultMaxBatchSize)
+
+	_, params, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?max-batch-size=16")
+	c.Assert(err, check.IsNil)
+	params.applyFeatures(feature(model.FeatureBatchDML, true))
+	c.Assert(params.maxBatchSize, check.Equals, 16)
+	params.applyFeatures(feature(model.FeatureBatchDML, false))
+	c.Assert(params.maxBatchSize, check.Equals, 1)
+
+	params.applyFeatures(feature(model.FeatureSafeMode, false))
+	c.Assert(params.safeMode, check.IsFalse)
+}
+
+func (s EmitSuite) TestTimeZone(c *check.C) {
+	uri, params, err := extractSinkParams("root@tcp(127.0.0.1:3306)/?time-zone=Asia%2FShanghai")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.timeZone.String(), check.Equals, "Asia/Shanghai")
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/")
+	_, params, err = extractSinkParams("root@tcp(127.0.0.1:3306)/")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.timeZone, check.Equals, time.UTC)
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?time-zone=Local")
+	c.Assert(err, check.ErrorMatches, ".*invalid time-zone: Local.*")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?time-zone=Mars")
+	c.Assert(err, check.ErrorMatches, ".*invalid time-zone: Mars.*")
+
+	newTime := func(tp byte, value string) dbtypes.Datum {
+		t, err := dbtypes.ParseTime(&stmtctx.StatementContext{TimeZone: time.UTC}, value, tp, 0)
+		c.Assert(err, check.IsNil)
+		return dbtypes.NewTimeDatum(t)
+	}
+	tableInfo := schema.WrapTableInfo(&timodel.TableInfo{
+		Columns: []*timodel.ColumnInfo{
+			{Name: timodel.CIStr{O: "ts"}, State: timodel.StatePublic, FieldType: types.FieldType{Tp: mysql.TypeTimestamp}},
+			{Name: timodel.CIStr{O: "dt"}, State: timodel.StatePublic, FieldType: types.FieldType{Tp: mysql.TypeDatetime}},
+		},
+	})
+	values := map[string]dbtypes.Datum{
+		"ts": newTime(mysql.TypeTimestamp, "2020-03-01 20:00:00"),
+		"dt": newTime(mysql.TypeDatetime, "2020-03-01 20:00:00"),
+	}
+	err = convertTimestamps(tableInfo, values, time.FixedZone("UTC+8", 8*3600))
+	c.Assert(err, check.IsNil)
+	c.Assert(formatValues(tableInfo, values), check.IsNil)
+	// only the timestamps are in the time zone
+	ts, dt := values["ts"], values["dt"]
+	c.Assert(ts.GetValue(), check.Equals, "2020-03-02 04:00:00")
+	c.Assert(dt.GetValue(), check.Equals, "2020-03-01 20:00:00")
+	// the formatted values are not converted again
+	err = convertTimestamps(tableInfo, values, time.FixedZone("UTC+8", 8*3600))
+	c.Assert(err, check.IsNil)
+	ts = values["ts"]
+	c.Assert(ts.GetValue(), check.Equals, "2020-03-02 04:00:00")
+}
+
+func (s EmitSuite) TestExtractSinkParams(c *check.C) {
+	uri, params, err := extractSinkParams("root@tcp(127.0.0.1:3306)/?max-batch-size=16&some_option=BB&safe-mode=false&safe-mode-duration=1m&worker-count=4")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.workerCount, check.Equals, 4)
+	c.Assert(params.maxBatchSize, check.Equals, 16)
+	c.Assert(params.safeMode, check.IsFalse)
+	c.Assert(params.safeModeDuration, check.Equals, time.Minute)
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/?some_option=BB")
+
+	uri, params, err = extractSinkParams("root@tcp(127.0.0.1:3306)/")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.maxBatchSize, check.Equals, defaultMaxBatchSize)
+	c.Assert(params.safeMode, check.IsTrue)
+	c.Assert(params.safeModeDuration, check.Equals, defaultSafeModeDuration)
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/")
+
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?worker-count=0")
+	c.Assert(err, check.ErrorMatches, ".*invalid worker-count: 0.*")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?max-batch-size=0")
+	c.Assert(err, check.ErrorMatches, ".*invalid max-batch-size: 0.*")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?safe-mode=maybe")
+	c.Assert(err, check.ErrorMatches, ".*invalid safe-mode: maybe.*")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?safe-mode-duration=-1s")
+	c.Assert(err, check.ErrorMatches, ".*invalid safe-mode-duration: -1s.*")
+
+	uri, params, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?max-retry=3&retry-backoff=2s&max-retry-backoff=1s")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.maxRetry, check.Equals, 3)
+	c.Assert(params.retryBackoff, check.Equals, 2*time.Second)
+	// the max backoff is never less than the initial one
+	c.Assert(params.maxRetryBackoff, check.Equals, 2*time.Second)
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?max-retry=-1")
+	c.Assert(err, check.ErrorMatches, ".*invalid max-retry: -1.*")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?retry-backoff=0s")
+	c.Assert(err, check.ErrorMatches, ".*invalid retry-backoff: 0s.*")
+
+	uri, params, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?stmt-cache-size=64")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.stmtCacheSize, check.Equals, 64)
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?stmt-cache-size=-1")
+	c.Assert(err, check.ErrorMatches, ".*invalid stmt-cache-size: -1.*")
+
+	uri, params, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?upsert-strategy=on-duplicate-update")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.upsertStrategy, check.Equals, upsertOnDuplicateUpdate)
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?upsert-strategy=merge")
+	c.Assert(err, check.ErrorMatches, ".*unsupported upsert-strategy: merge.*")
+}
+
+func (s EmitSuite) TestSplitLargeTxn(c *check.C) {
+	_, params, err := extractSinkParams("root@tcp(127.0.0.1:3306)/")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.splitTxn, check.IsFalse)
+	c.Assert(params.maxTxnRows, check.Equals, defaultMaxTxnRows)
+	c.Assert(params.maxTxnBytes, check.Equals, defaultMaxTxnBytes)
+	uri, params, err := extractSinkParams("root@tcp(127.0.0.1:3306)/?split-txn=true&max-txn-rows=2&max-txn-bytes=100")
+	c.Assert(err, check.IsNil)
+	c.Assert(params.splitTxn, check.IsTrue)
+	c.Assert(params.maxTxnRows, check.Equals, 2)
+	c.Assert(params.maxTxnBytes, check.Equals, 100)
+	c.Assert(uri, check.Equals, "root@tcp(127.0.0.1:3306)/")
+	_, _, err = extractSinkParams("root@tcp(127.0.0.1:3306)/?max-txn-rows=0")
+	c.Assert(err, check.ErrorMatches, ".*invalid max-txn-rows: 0.*")
+
+	dmls := newTestTxn(10, "t1", 1, 2, 3, 4, 5).DMLs
+	sink := mysqlSink{maxTxnRows: 2, maxTxnBytes: 1000}
+	c.Assert(sink.splitLargeTxn(dmls), check.HasLen, 1)
+	sink.splitTxn = true
+	txns := sink.splitLargeTxn(dmls)
+	c.Assert(txns, check.HasLen, 3)
+	c.Assert(txns[0], check.DeepEquals, dmls[:2])
+	c.Assert(txns[2], check.DeepEquals, dmls[4:])
+
+	// a large row is in a transaction alone
+	dmls[1].Values["name"] = dbtypes.NewDatum(strings.Repeat("x", 1000))
+	sink.maxTxnRows = 10
+	txns = sink.splitLargeTxn(dmls)
+	c.Assert(txns, check.HasLen, 3)
+	c.Assert(txns[0], check.DeepEquals, dmls[:1])
+	c.Assert(txns[1], check.DeepEquals, dmls[1:2])
+	c.Assert(txns[2], check.DeepEquals, dmls[2:])
+}
+
+func (s EmitSuite) TestExecSplitTxns(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:          db,
+		infoGetter:  &tableHelper{},
+		workerCount: 1,
+		splitTxn:    true,
+		maxTxnRows:  2,
+		maxTxnBytes: defaultMaxTxnBytes,
+	}
+	query := "REPLACE INTO `test`.`t1`(`id`,`name`) VALUES (?,?);"
+	for _, ids := range [][]int{{1, 2}, {3}} {
+		mock.ExpectBegin()
+		for _, id := range ids {
+			mock.ExpectExec(query).WithArgs(id, "tester").WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+	}
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1, 2, 3))
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s EmitSuite) TestClassifyErrors(c *check.C) {
+	deadlock := &dmysql.MySQLError{Number: mysql.ErrLockDeadlock}
+	noTable := &dmysql.MySQLError{Number: mysql.ErrNoSuchTable}
+	c.Assert(isRetryableError(errors.Trace(deadlock)), check.IsTrue)
+	c.Assert(isRetryableError(driver.ErrBadConn), check.IsTrue)
+	c.Assert(isRetryableError(syscall.ECONNRESET), check.IsTrue)
+	c.Assert(isRetryableError(noTable), check.IsFalse)
+	c.Assert(isRetryableError(context.Canceled), check.IsFalse)
+	c.Assert(isFatalError(errors.Trace(noTable)), check.IsTrue)
+	c.Assert(isFatalError(&dmysql.MySQLError{Number: mysql.ErrParse}), check.IsTrue)
+	c.Assert(isFatalError(deadlock), check.IsFalse)
+	c.Assert(isFatalError(driver.ErrBadConn), check.IsFalse)
+	c.Assert(isTableError(noTable), check.IsTrue)
+	c.Assert(isTableError(deadlock), check.IsFalse)
+
+	// the table of the error is found through the wrappers
+	err := errors.Trace(newFatalError(errors.Trace(NewTableError("test", "t1", noTable))))
+	schema, table, ok := TableErrorOf(err)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(schema, check.Equals, "test")
+	c.Assert(table, check.Equals, "t1")
+	c.Assert(isFatalError(NewTableError("test", "t1", noTable)), check.IsTrue)
+	_, _, ok = TableErrorOf(errors.Trace(newFatalError(noTable)))
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s EmitSuite) TestRetryDMLs(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:              db,
+		infoGetter:      &tableHelper{},
+		maxRetry:        3,
+		retryBackoff:    time.Millisecond,
+		maxRetryBackoff: time.Millisecond,
+	}
+	query := "REPLACE INTO `test`.`t1`(`id`,`name`) VALUES (?,?);"
+
+	// the deadlock is retried
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(1, "tester").
+		WillReturnError(&dmysql.MySQLError{Number: mysql.ErrLockDeadlock})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(1, "tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1))
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the fatal error fails immediately
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(1, "tester").
+		WillReturnError(&dmysql.MySQLError{Number: mysql.ErrNoSuchTable})
+	mock.ExpectRollback()
+	err = sink.EmitDMLs(context.Background(), newTestTxn(11, "t1", 1))
+	c.Assert(IsFatalError(err), check.IsTrue)
+	_, table, ok := TableErrorOf(err)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(table, check.Equals, "t1")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the retryable error fails after the retries are exhausted
+	for i := 0; i <= sink.maxRetry; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(query).WithArgs(1, "tester").
+			WillReturnError(&dmysql.MySQLError{Number: mysql.ErrLockWaitTimeout})
+		mock.ExpectRollback()
+	}
+	err = sink.EmitDMLs(context.Background(), newTestTxn(12, "t1", 1))
+	c.Assert(err, check.ErrorMatches, ".*1205.*")
+	c.Assert(IsFatalError(err), check.IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s EmitSuite) TestSafeModeDuration(c *check.C) {
+	sink := mysqlSink{}
+	c.Assert(sink.inSafeMode(), check.IsTrue)
+	sink.safeModeEnd = time.Now().Add(time.Minute)
+	c.Assert(sink.inSafeMode(), check.IsTrue)
+	sink.safeModeEnd = time.Now().Add(-time.Second)
+	c.Assert(sink.inSafeMode(), check.IsFalse)
+}
+
+func (s EmitSuite) TestSafeModeAfterFailure(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:          db,
+		infoGetter:  &tableHelper{},
+		safeModeEnd: time.Now().Add(-time.Second),
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `test`.`t1`(`id`,`name`) VALUES (?,?);").WithArgs(1, "tester").
+		WillReturnError(&dmysql.MySQLError{Number: mysql.ErrParse})
+	mock.ExpectRollback()
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1))
+	c.Assert(err, check.NotNil)
+
+	// the DMLs emitted again after the failure may be written already
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`t1`(`id`,`name`) VALUES (?,?);").WithArgs(1, "tester").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1))
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.emitFailed, check.IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+// pkTableHelper returns the table of tableHelper with `id` as the primary key.
+type pkTableHelper struct {
+	tableHelper
+}
+
+func (h *pkTableHelper) GetTableByName(schema, table string) (*schema.TableInfo, bool) {
+	info, _ := h.TableByID(42)
+	info.PKIsHandle = true
+	info.Columns[0].Flag |= mysql.PriKeyFlag
+	return info, true
+}
+
+func newTestDML(tp model.DMLType, table string, id int, name interface{}) *model.DML {
+	return &model.DML{
+		Database: "test",
+		Table:    table,
+		Tp:       tp,
+		Values: map[string]dbtypes.Datum{
+			"id":   dbtypes.NewDatum(id),
+			"name": dbtypes.NewDatum(name),
+		},
+	}
+}
+
+func (s EmitSuite) TestShouldBatchDMLs(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:           db,
+		infoGetter:   &pkTableHelper{},
+		workerCount:  1,
+		maxBatchSize: 2,
+	}
+	t := model.Txn{
+		DMLs: []*model.DML{
+			newTestDML(model.InsertDMLType, "user", 1, "a"),
+			newTestDML(model.UpdateDMLType, "user", 2, "b"),
+			newTestDML(model.InsertDMLType, "user", 3, "c"),
+			newTestDML(model.DeleteDMLType, "user", 4, "d"),
+			newTestDML(model.DeleteDMLType, "user", 5, nil),
+			newTestDML(model.InsertDMLType, "user", 6, "f"),
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?),(?,?);").
+		WithArgs(1, "a", 2, "b").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?);").
+		WithArgs(3, "c").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM `test`.`user` WHERE (`id`) IN ((?),(?));").
+		WithArgs(4, 5).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?);").
+		WithArgs(6, "f").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = sink.EmitDMLs(context.Background(), t)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s EmitSuite) TestShouldNotBatchDeleteWithoutUniqueKey(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:           db,
+		infoGetter:   &tableHelper{},
+		maxBatchSize: defaultMaxBatchSize,
+	}
+	t := model.Txn{
+		DMLs: []*model.DML{
+			newTestDML(model.DeleteDMLType, "user", 1, "a"),
+			newTestDML(model.DeleteDMLType, "user", 2, "b"),
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `test`.`user` WHERE `id` = ? AND `name` = ? LIMIT 1;").
+		WithArgs(1, "a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM `test`.`user` WHERE `id` = ? AND `name` = ? LIMIT 1;").
+		WithArgs(2, "b").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = sink.EmitDMLs(context.Background(), t)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s EmitSuite) TestSafeMode(c *check.C) {
+	newTxn := func() model.Txn {
+		update := newTestDML(model.UpdateDMLType, "user", 2, "b")
+		update.OldValues = map[string]dbtypes.Datum{
+			"id":   dbtypes.NewDatum(1),
+			"name": dbtypes.NewDatum("a"),
+		}
+		return model.Txn{
+			DMLs: []*model.DML{
+				newTestDML(model.InsertDMLType, "user", 3, "c"),
+				newTestDML(model.InsertDMLType, "user", 4, "d"),
+				update,
+			},
+		}
+	}
+
+	for _, safeMode := range []bool{true, false} {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		sink := mysqlSink{
+			db:           db,
+			infoGetter:   &pkTableHelper{},
+			workerCount:  1,
+			maxBatchSize: defaultMaxBatchSize,
+		}
+		mock.ExpectBegin()
+		if safeMode {
+			mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?),(?,?);").
+				WithArgs(3, "c", 4, "d").
+				WillReturnResult(sqlmock.NewResult(2, 2))
+			mock.ExpectExec("DELETE FROM `test`.`user` WHERE `id` = ? LIMIT 1;").
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?);").
+				WithArgs(2, "b").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		} else {
+			sink.safeModeEnd = time.Now().Add(-time.Second)
+			mock.ExpectExec("INSERT INTO `test`.`user`(`id`,`name`) VALUES (?,?),(?,?);").
+				WithArgs(3, "c", 4, "d").
+				WillReturnResult(sqlmock.NewResult(2, 2))
+			mock.ExpectExec("UPDATE `test`.`user` SET `id` = ?,`name` = ? WHERE `id` = ? LIMIT 1;").
+				WithArgs(2, "b", 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+
+		err = sink.EmitDMLs(context.Background(), newTxn())
+		c.Assert(err, check.IsNil)
+		c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+		db.Close()
+	}
+}
+
+func (s EmitSuite) TestSafeModeKeyUnchanged(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	sink := mysqlSink{
+		db:           db,
+		infoGetter:   &pkTableHelper{},
+		workerCount:  1,
+		maxBatchSize: defaultMaxBatchSize,
+	}
+
+	update := newTestDML(model.UpdateDMLType, "user", 1, "b")
+	update.OldValues = map[string]dbtypes.Datum{
+		"id":   dbtypes.NewDatum(1),
+		"name": dbtypes.NewDatum("a"),
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?);").
+		WithArgs(1, "b").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = sink.EmitDMLs(context.Background(), model.Txn{DMLs: []*model.DML{update}})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s EmitSuite) TestUpsertStrategy(c *check.C) {
+	update := newTestDML(model.UpdateDMLType, "user", 2, "b")
+	update.OldValues = map[string]dbtypes.Datum{
+		"id":   dbtypes.NewDatum(1),
+		"name": dbtypes.NewDatum("a"),
+	}
+	txn := model.Txn{
+		DMLs: []*model.DML{
+			newTestDML(model.InsertDMLType, "user", 3, "c"),
+			newTestDML(model.InsertDMLType, "user", 4, "d"),
+			update,
+		},
+	}
+
+	for strategy, query := range map[string]string{
+		upsertOnDuplicateUpdate: "INSERT INTO `test`.`user`(`id`,`name`) VALUES (?,?)%s ON DUPLICATE KEY UPDATE `id`=VALUES(`id`),`name`=VALUES(`name`);",
+		upsertInsertIgnore:      "INSERT IGNORE INTO `test`.`user`(`id`,`name`) VALUES (?,?)%s;",
+	} {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		sink := mysqlSink{
+			db:             db,
+			infoGetter:     &pkTableHelper{},
+			workerCount:    1,
+			maxBatchSize:   defaultMaxBatchSize,
+			upsertStrategy: strategy,
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec(fmt.Sprintf(query, ",(?,?)")).
+			WithArgs(3, "c", 4, "d").
+			WillReturnResult(sqlmock.NewResult(2, 2))
+		mock.ExpectExec("DELETE FROM `test`.`user` WHERE `id` = ? LIMIT 1;").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(fmt.Sprintf(query, "")).
+			WithArgs(2, "b").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err = sink.EmitDMLs(context.Background(), txn)
+		c.Assert(err, check.IsNil, check.Commentf("%s", strategy))
+		c.Assert(mock.ExpectationsWereMet(), check.IsNil, check.Commentf("%s", strategy))
+		db.Close()
+	}
+}
+
+type nullableUniqueTableHelper struct {
+	tableHelper
+}
+
+func (h *nullableUniqueTableHelper) GetTableByName(schema, table string) (*schema.TableInfo, bool) {
+	info, _ := h.TableByID(42)
+	info.Indices = []*timodel.IndexInfo{{
+		Name:    timodel.NewCIStr("uniq_name"),
+		Columns: []*timodel.IndexColumn{{Name: timodel.NewCIStr("name"), Offset: 1}},
+		Unique:  true,
+	}}
+	return info, true
+}
+
+func (s EmitSuite) TestWhereNullableUniqueKey(c *check.C) {
+	info, _ := (&nullableUniqueTableHelper{}).GetTableByName("test", "user")
+	c.Assert(info.GetUniqueKeys(), check.HasLen, 0)
+
+	dml := newTestDML(model.DeleteDMLType, "user", 1, "a")
+	colNames, args := whereSlice(info, dml.Values)
+	c.Assert(colNames, check.DeepEquals, []string{"name"})
+	c.Assert(args, check.HasLen, 1)
+
+	// the rows with NULL values aren't unique on the key
+	dml = newTestDML(model.DeleteDMLType, "user", 1, nil)
+	colNames, _ = whereSlice(info, dml.Values)
+	c.Assert(colNames, check.DeepEquals, []string{"id", "name"})
+}
+
+type generatedTableHelper struct {
+	tableHelper
+}
+
+func (h *generatedTableHelper) GetTableByName(db, table string) (*schema.TableInfo, bool) {
+	info, _ := h.TableByID(42)
+	cols := append(info.Columns, &timodel.ColumnInfo{
+		Name:                timodel.NewCIStr("upper_name"),
+		State:               timodel.StatePublic,
+		GeneratedExprString: "upper(`name`)",
+		GeneratedStored:     true,
+	}, &timodel.ColumnInfo{
+		Name:                timodel.NewCIStr("id2"),
+		State:               timodel.StatePublic,
+		GeneratedExprString: "`id` * 2",
+	})
+	info.TableInfo.Columns = cols
+	return schema.WrapTableInfo(info.TableInfo), true
+}
+
+func (s EmitSuite) TestShouldExcludeGeneratedColumns(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	sink := mysqlSink{
+		db:         db,
+		infoGetter: &generatedTableHelper{},
+	}
+	dml := newTestDML(model.InsertDMLType, "user", 1, "a")
+	dml.Values["upper_name"] = dbtypes.NewDatum("A")
+
+	info, _ := sink.infoGetter.GetTableByName("test", "user")
+	c.Assert(insertableValues(info, dml.Values), check.DeepEquals, map[string]dbtypes.Datum{
+		"id":   dbtypes.NewDatum(1),
+		"name": dbtypes.NewDatum("a"),
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`user`(`id`,`name`) VALUES (?,?);").
+		WithArgs(1, "a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = sink.EmitDMLs(context.Background(), model.Txn{DMLs: []*model.DML{dml}, Ts: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
 }
 
 type splitSuite struct{}
@@ -249,7 +890,8 @@ type splitSuite struct{}
 var _ = check.Suite(&splitSuite{})
 
 func (s *splitSuite) TestCanHandleEmptyInput(c *check.C) {
-	c.Assert(splitIndependentGroups(nil), check.HasLen, 0)
+	sink := mysqlSink{infoGetter: &tableHelper{}}
+	c.Assert(sink.splitIndependentGroups(nil, defaultWorkerCount), check.HasLen, 0)
 }
 
 func (s *splitSuite) TestShouldSplitByTable(c *check.C) {
@@ -268,7 +910,8 @@ func (s *splitSuite) TestShouldSplitByTable(c *check.C) {
 	addDMLs(2, "db", "tbl1")
 	addDMLs(2, "db2", "tbl2")
 
-	groups := splitIndependentGroups(dmls)
+	sink := mysqlSink{infoGetter: &tableHelper{}}
+	groups := sink.splitIndependentGroups(dmls, defaultWorkerCount)
 
 	assertAllAreFromTbl := func(dmls []*model.DML, db, tbl string) {
 		for _, dml := range dmls {
@@ -289,3 +932,68 @@ func (s *splitSuite) TestShouldSplitByTable(c *check.C) {
 	assertAllAreFromTbl(groups[1], "db", "tbl2")
 	assertAllAreFromTbl(groups[2], "db2", "tbl2")
 }
+
+func (s *splitSuite) TestShouldSplitByPrimaryKey(c *check.C) {
+	var dmls []*model.DML
+	for i := 0; i < 100; i++ {
+		dmls = append(dmls, newTestDML(model.InsertDMLType, "user", i%10, fmt.Sprintf("v%d", i)))
+	}
+	sink := mysqlSink{infoGetter: &pkTableHelper{}}
+	groups := sink.splitIndependentGroups(dmls, 4)
+	c.Assert(len(groups) > 1, check.IsTrue)
+	c.Assert(len(groups) <= 4, check.IsTrue)
+
+	// the changes of a row are in the same group in order
+	rows := make(map[int64]int)
+	total := 0
+	for i, group := range groups {
+		last := make(map[int64]int)
+		for _, dml := range group {
+			idDatum, nameDatum := dml.Values["id"], dml.Values["name"]
+			id := idDatum.GetInt64()
+			if g, ok := rows[id]; ok {
+				c.Assert(g, check.Equals, i)
+			}
+			rows[id] = i
+			var seq int
+			_, err := fmt.Sscanf(nameDatum.GetString(), "v%d", &seq)
+			c.Assert(err, check.IsNil)
+			c.Assert(seq > last[id] || last[id] == 0, check.IsTrue)
+			last[id] = seq
+		}
+		total += len(group)
+	}
+	c.Assert(total, check.Equals, 100)
+}
+
+func (s *splitSuite) TestShouldKeepOrderOfChangedKeys(c *check.C) {
+	var dmls []*model.DML
+	for i := 0; i < 10; i++ {
+		dmls = append(dmls, newTestDML(model.InsertDMLType, "user", 100+i, "v"))
+	}
+	// the key 1 is changed to 2, then the key 1 is reused by an insert
+	update := newTestDML(model.UpdateDMLType, "user", 2, "v")
+	update.OldValues = newTestDML(model.UpdateDMLType, "user", 1, "v").Values
+	insert := newTestDML(model.InsertDMLType, "user", 1, "v")
+	dmls = append(dmls, update, insert)
+
+	sink := mysqlSink{infoGetter: &pkTableHelper{}}
+	groups := sink.splitIndependentGroups(dmls, 4)
+	c.Assert(groups, check.HasLen, 1)
+	c.Assert(groups[0], check.DeepEquals, dmls)
+
+	// the keys of the other tables are still hashed
+	var others []*model.DML
+	for i := 0; i < 10; i++ {
+		others = append(others, newTestDML(model.InsertDMLType, "other", i, "v"))
+	}
+	groups = sink.splitIndependentGroups(append(others, update, insert), 4)
+	c.Assert(len(groups) > 1, check.IsTrue)
+	for _, group := range groups {
+		for i, dml := range group {
+			if dml == insert {
+				c.Assert(i > 0 && group[i-1] == update, check.IsTrue)
+			}
+		}
+	}
+}
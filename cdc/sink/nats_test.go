@@ -0,0 +1,176 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type mockPubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *pubAck
+	err chan error
+}
+
+func (f *mockPubAckFuture) Ok() <-chan *pubAck {
+	return f.ok
+}
+
+func (f *mockPubAckFuture) Err() <-chan error {
+	return f.err
+}
+
+func (f *mockPubAckFuture) Msg() *nats.Msg {
+	return f.msg
+}
+
+type mockJetStream struct {
+	futures   []*mockPubAckFuture
+	published []*nats.Msg
+	autoAck   bool
+}
+
+func (m *mockJetStream) PublishAsync(subj string, data []byte) (pubAckFuture, error) {
+	f := &mockPubAckFuture{
+		msg: &nats.Msg{Subject: subj, Data: data},
+		ok:  make(chan *pubAck, 1),
+		err: make(chan error, 1),
+	}
+	m.published = append(m.published, f.msg)
+	if m.autoAck {
+		f.ok <- &pubAck{Stream: "tidb"}
+	} else {
+		m.futures = append(m.futures, f)
+	}
+	return f, nil
+}
+
+func (m *mockJetStream) ackAll() {
+	for _, f := range m.futures {
+		f.ok <- &pubAck{Stream: "tidb"}
+	}
+	m.futures = nil
+}
+
+type natsSuite struct{}
+
+var _ = check.Suite(&natsSuite{})
+
+func (s *natsSuite) TestPublishAndAck(c *check.C) {
+	u, err := url.Parse("nats://127.0.0.1:4222/?subject=cdc.{schema}.{table}")
+	c.Assert(err, check.IsNil)
+	js := &mockJetStream{}
+	sink, err := newNATSSink(js, u, &tableHelper{})
+	c.Assert(err, check.IsNil)
+
+	ctx := context.Background()
+	err = sink.EmitDMLs(ctx, newTestTxn(10, "t1", 1, 2), newTestTxn(11, "t.2", 3))
+	c.Assert(err, check.IsNil)
+	c.Assert(js.futures, check.HasLen, 3)
+	c.Assert(js.futures[0].msg.Subject, check.Equals, "cdc.test.t1")
+	c.Assert(js.futures[2].msg.Subject, check.Equals, "cdc.test.t_2")
+	c.Assert(decodeEvent(c, js.futures[2].msg.Data).Ts, check.Equals, uint64(11))
+	c.Assert(sink.pending, check.HasLen, 3)
+
+	// the checkpoint waits for the acknowledgments
+	ctx1, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = sink.FlushCheckpoint(ctx1, 11)
+	c.Assert(err, check.ErrorMatches, ".*context canceled.*")
+	js.ackAll()
+	checkpointTs, err := sink.FlushCheckpoint(ctx, 11)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkpointTs, check.Equals, uint64(11))
+	c.Assert(sink.pending, check.HasLen, 0)
+
+	// a failed publish fails the checkpoint
+	err = sink.EmitDMLs(ctx, newTestTxn(12, "t1", 1))
+	c.Assert(err, check.IsNil)
+	js.futures[0].err <- errors.New("no response from stream")
+	_, err = sink.FlushCheckpoint(ctx, 12)
+	c.Assert(err, check.ErrorMatches, ".*publish to subject cdc.test.t1.*no response from stream.*")
+}
+
+func (s *natsSuite) TestDDL(c *check.C) {
+	u, err := url.Parse("nats://127.0.0.1:4222/")
+	c.Assert(err, check.IsNil)
+	js := &mockJetStream{autoAck: true}
+	sink, err := newNATSSink(js, u, &tableHelper{})
+	c.Assert(err, check.IsNil)
+
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1))
+	c.Assert(err, check.IsNil)
+	err = sink.EmitDDL(context.Background(), model.Txn{Ts: 12, DDL: &model.DDL{
+		Database: "test",
+		Job:      &timodel.Job{Query: "CREATE DATABASE test"},
+	}})
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.pending, check.HasLen, 0)
+	c.Assert(js.published, check.HasLen, 2)
+	c.Assert(js.published[0].Subject, check.Equals, "tidb.test.t1")
+	c.Assert(js.published[1].Subject, check.Equals, "tidb.test._")
+	c.Assert(decodeEvent(c, js.published[1].Data).Query, check.Equals, "CREATE DATABASE test")
+}
+
+func (s *natsSuite) TestRouteByDMLType(c *check.C) {
+	params := url.Values{"route": {
+		"delete:test.t*:audit.{schema}.{table}",
+		"upsert:test.t2:main.t2",
+	}}
+	u, err := url.Parse("nats://127.0.0.1:4222/?" + params.Encode())
+	c.Assert(err, check.IsNil)
+	js := &mockJetStream{autoAck: true}
+	sink, err := newNATSSink(js, u, &tableHelper{})
+	c.Assert(err, check.IsNil)
+
+	deleteTxn := newTestTxn(11, "t1", 1)
+	deleteTxn.DMLs[0].Tp = model.DeleteDMLType
+	otherTxn := newTestTxn(12, "x1", 3)
+	otherTxn.DMLs[0].Tp = model.DeleteDMLType
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1), deleteTxn, newTestTxn(11, "t2", 2), otherTxn)
+	c.Assert(err, check.IsNil)
+	c.Assert(js.published, check.HasLen, 4)
+	c.Assert(js.published[0].Subject, check.Equals, "tidb.test.t1")
+	c.Assert(js.published[1].Subject, check.Equals, "audit.test.t1")
+	c.Assert(js.published[2].Subject, check.Equals, "main.t2")
+	c.Assert(js.published[3].Subject, check.Equals, "tidb.test.x1")
+
+	for _, route := range []string{"drop:test.t1:a", "delete:test:a", "delete:test.t1", "delete:test.[:a"} {
+		u, err := url.Parse("nats://127.0.0.1:4222/?" + url.Values{"route": {route}}.Encode())
+		c.Assert(err, check.IsNil)
+		_, err = newNATSSink(js, u, &tableHelper{})
+		c.Assert(err, check.ErrorMatches, ".*invalid.*route.*", check.Commentf("route: %s", route))
+	}
+}
+
+func (s *natsSuite) TestParsePubAck(c *check.C) {
+	ack, err := parsePubAck([]byte(`{"stream":"tidb","seq":7}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(ack.Stream, check.Equals, "tidb")
+	c.Assert(ack.Sequence, check.Equals, uint64(7))
+
+	_, err = parsePubAck([]byte(`{"error":{"code":503,"description":"storage full"}}`))
+	c.Assert(err, check.ErrorMatches, "nats error 503: storage full")
+	_, err = parsePubAck([]byte(`{}`))
+	c.Assert(err, check.ErrorMatches, ".*no stream captures the subject")
+	_, err = parsePubAck([]byte(`ok`))
+	c.Assert(err, check.ErrorMatches, "invalid acknowledgment.*")
+}
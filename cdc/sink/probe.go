@@ -0,0 +1,83 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"net"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/sink/config"
+)
+
+// ErrProbeNotSupported is returned by Probe if the availability of the sink
+// can't be checked, like the sinks of the cloud services without an address.
+var ErrProbeNotSupported = errors.New("probe not supported by the sink")
+
+// the default ports of the sinks which can be omitted in the sink uri
+var defaultProbePorts = map[string]string{
+	"nats": "4222",
+}
+
+// Probe checks whether the downstream of the sink uri is available. The MySQL
+// downstream is pinged, the address of the other sinks is dialed.
+func Probe(ctx context.Context, sinkURI string) error {
+	uri, err := config.Parse(sinkURI)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	scheme := uri.Scheme.Name
+	switch scheme {
+	case "mysql":
+		if err := uri.ResolveSecrets(); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(probeMySQL(ctx, uri.String()))
+	case "kinesis", "pubsub":
+		return errors.Trace(ErrProbeNotSupported)
+	}
+	u := uri.URL
+	host := u.Host
+	if u.Port() == "" {
+		port, ok := defaultProbePorts[scheme]
+		if !ok {
+			return errors.Trace(ErrProbeNotSupported)
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return errors.Annotatef(err, "dial %s", host)
+	}
+	return errors.Trace(conn.Close())
+}
+
+func probeMySQL(ctx context.Context, sinkURI string) error {
+	sinkURI, params, err := extractSinkParams(sinkURI)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sinkURI, err = configureSinkURI(sinkURI, params.timeZone)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	db, err := sql.Open("mysql", sinkURI)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+	return errors.Trace(db.PingContext(ctx))
+}
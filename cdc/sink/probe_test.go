@@ -0,0 +1,42 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type probeSuite struct{}
+
+var _ = check.Suite(&probeSuite{})
+
+func (s *probeSuite) TestProbe(c *check.C) {
+	ctx := context.Background()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	addr := l.Addr().String()
+	c.Assert(Probe(ctx, "clickhouse://"+addr+"/db"), check.IsNil)
+	c.Assert(l.Close(), check.IsNil)
+	c.Assert(Probe(ctx, "clickhouse://"+addr+"/db"), check.ErrorMatches, ".*dial "+addr+".*")
+
+	err = Probe(ctx, "kinesis://stream")
+	c.Assert(errors.Cause(err), check.Equals, ErrProbeNotSupported)
+	err = Probe(ctx, "elasticsearch://localhost/")
+	c.Assert(errors.Cause(err), check.Equals, ErrProbeNotSupported)
+	c.Assert(Probe(ctx, "root@tcp("+addr+")/"), check.NotNil)
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+)
+
+const (
+	// the time range of a window of the profiles
+	profileWindow = 10 * time.Second
+	// the number of the recent windows kept by a table, the older windows are
+	// overwritten in the ring buffer
+	profileWindows = 60
+)
+
+// profileSizeBuckets are the upper bounds of the buckets of the row sizes, the
+// last bucket holds the rows larger than all bounds.
+var profileSizeBuckets = []int{64, 128, 256, 512, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// ProfileWindow is the statistics of the rows of a table in a time window.
+type ProfileWindow struct {
+	Start time.Time `json:"start"`
+	// Rows is the number of all the rows in the window.
+	Rows int64 `json:"rows"`
+	// Sampled is the number of the rows whose sizes are sampled.
+	Sampled int64 `json:"sampled"`
+	// SampledBytes is the total estimated size of the sampled rows.
+	SampledBytes int64 `json:"sampled-bytes"`
+	// MaxSize is the max estimated size of the sampled rows.
+	MaxSize int `json:"max-size"`
+	// SizeHistogram counts the sampled rows by the buckets of their sizes.
+	SizeHistogram []int64 `json:"size-histogram"`
+}
+
+// TableProfile is the profile of the rows of a table in the recent windows.
+type TableProfile struct {
+	Table         string  `json:"table"`
+	RowsPerSecond float64 `json:"rows-per-second"`
+	AvgRowSize    int     `json:"avg-row-size"`
+	P50RowSize    int     `json:"p50-row-size"`
+	P99RowSize    int     `json:"p99-row-size"`
+	MaxRowSize    int     `json:"max-row-size"`
+	// SizeBuckets are the upper bounds of the buckets of SizeHistogram in
+	// the windows, the last bucket is unbounded.
+	SizeBuckets []int            `json:"size-buckets"`
+	Windows     []*ProfileWindow `json:"windows"`
+}
+
+// profileTableKey avoids building the quoted name for each row.
+type profileTableKey struct {
+	schema string
+	table  string
+}
+
+// tableProfile is a ring buffer of the windows of a table.
+type tableProfile struct {
+	windows [profileWindows]*ProfileWindow
+	// head is the index of the latest window
+	head int
+}
+
+// TableProfiler profiles the row sizes and the event rates of the tables
+// written to the sink. All the rows are counted, and the sizes of one of every
+// sampleRate rows are estimated.
+type TableProfiler struct {
+	mu         sync.Mutex
+	sampleRate int
+	count      int
+	tables     map[profileTableKey]*tableProfile
+
+	clock func() time.Time
+}
+
+// NewTableProfiler creates a profiler sampling one of every sampleRate rows.
+func NewTableProfiler(sampleRate int) *TableProfiler {
+	if sampleRate < 1 {
+		sampleRate = 1
+	}
+	return &TableProfiler{
+		sampleRate: sampleRate,
+		tables:     make(map[profileTableKey]*tableProfile),
+		clock:      time.Now,
+	}
+}
+
+// Observe records the rows of the transactions.
+func (p *TableProfiler) Observe(txns []model.Txn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := p.clock().Truncate(profileWindow)
+	for _, txn := range txns {
+		for _, dml := range txn.DMLs {
+			w := p.window(profileTableKey{schema: dml.Database, table: dml.Table}, start)
+			w.Rows++
+			p.count++
+			if p.count%p.sampleRate != 0 {
+				continue
+			}
+			size := estimateDMLSize(dml)
+			w.Sampled++
+			w.SampledBytes += int64(size)
+			if size > w.MaxSize {
+				w.MaxSize = size
+			}
+			w.SizeHistogram[profileSizeBucket(size)]++
+		}
+	}
+}
+
+// window returns the window of the table started at start.
+func (p *TableProfiler) window(table profileTableKey, start time.Time) *ProfileWindow {
+	t, ok := p.tables[table]
+	if !ok {
+		t = &tableProfile{}
+		p.tables[table] = t
+	}
+	if w := t.windows[t.head]; w != nil && w.Start.Equal(start) {
+		return w
+	}
+	if t.windows[t.head] != nil {
+		t.head = (t.head + 1) % profileWindows
+	}
+	w := &ProfileWindow{Start: start, SizeHistogram: make([]int64, len(profileSizeBuckets)+1)}
+	t.windows[t.head] = w
+	return w
+}
+
+// Profiles returns the profiles of the tables in order of the table names, the
+// windows of a profile are in time order.
+func (p *TableProfiler) Profiles() []*TableProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// the windows older than the ring buffer are expired
+	expired := p.clock().Truncate(profileWindow).Add(-profileWindow * (profileWindows - 1))
+	profiles := make([]*TableProfile, 0, len(p.tables))
+	for table, t := range p.tables {
+		profile := &TableProfile{Table: util.QuoteSchema(table.schema, table.table), SizeBuckets: profileSizeBuckets}
+		histogram := make([]int64, len(profileSizeBuckets)+1)
+		var rows, sampled, sampledBytes int64
+		for i := 1; i <= profileWindows; i++ {
+			w := t.windows[(t.head+i)%profileWindows]
+			if w == nil || w.Start.Before(expired) {
+				continue
+			}
+			copied := *w
+			copied.SizeHistogram = append([]int64(nil), w.SizeHistogram...)
+			profile.Windows = append(profile.Windows, &copied)
+			rows += w.Rows
+			sampled += w.Sampled
+			sampledBytes += w.SampledBytes
+			if w.MaxSize > profile.MaxRowSize {
+				profile.MaxRowSize = w.MaxSize
+			}
+			for j, n := range w.SizeHistogram {
+				histogram[j] += n
+			}
+		}
+		if len(profile.Windows) == 0 {
+			delete(p.tables, table)
+			continue
+		}
+		elapsed := p.clock().Sub(profile.Windows[0].Start)
+		if elapsed < profileWindow {
+			elapsed = profileWindow
+		}
+		profile.RowsPerSecond = float64(rows) / elapsed.Seconds()
+		if sampled > 0 {
+			profile.AvgRowSize = int(sampledBytes / sampled)
+			profile.P50RowSize = profileSizeQuantile(histogram, sampled, 0.5, profile.MaxRowSize)
+			profile.P99RowSize = profileSizeQuantile(histogram, sampled, 0.99, profile.MaxRowSize)
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Table < profiles[j].Table })
+	return profiles
+}
+
+func profileSizeBucket(size int) int {
+	return sort.SearchInts(profileSizeBuckets, size)
+}
+
+// profileSizeQuantile returns the upper bound of the bucket holding the
+// quantile of the sizes, it's max for the last bucket.
+func profileSizeQuantile(histogram []int64, total int64, quantile float64, max int) int {
+	rank := int64(quantile * float64(total))
+	if rank >= total {
+		rank = total - 1
+	}
+	var count int64
+	for i, n := range histogram {
+		count += n
+		if count > rank {
+			if i < len(profileSizeBuckets) && profileSizeBuckets[i] < max {
+				return profileSizeBuckets[i]
+			}
+			return max
+		}
+	}
+	return max
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/types"
+)
+
+type profilerSuite struct{}
+
+var _ = check.Suite(&profilerSuite{})
+
+func profileTxn(table string, sizes ...int) model.Txn {
+	txn := model.Txn{}
+	for _, size := range sizes {
+		// the column name is 1 byte
+		txn.DMLs = append(txn.DMLs, &model.DML{
+			Database: "test",
+			Table:    table,
+			Values:   map[string]types.Datum{"v": types.NewStringDatum(strings.Repeat("x", size-1))},
+		})
+	}
+	return txn
+}
+
+func (s *profilerSuite) TestProfiles(c *check.C) {
+	now := time.Unix(1000, 0)
+	profiler := NewTableProfiler(2)
+	profiler.clock = func() time.Time { return now }
+
+	profiler.Observe([]model.Txn{profileTxn("a", 100, 100, 100, 100), profileTxn("b", 2000, 3000)})
+	now = now.Add(profileWindow)
+	profiler.Observe([]model.Txn{profileTxn("a", 100, 100, 500, 500)})
+
+	profiles := profiler.Profiles()
+	c.Assert(profiles, check.HasLen, 2)
+	a := profiles[0]
+	c.Assert(a.Table, check.Equals, "`test`.`a`")
+	c.Assert(a.Windows, check.HasLen, 2)
+	c.Assert(a.Windows[0].Rows, check.Equals, int64(4))
+	c.Assert(a.Windows[0].Sampled, check.Equals, int64(2))
+	c.Assert(a.Windows[1].Rows, check.Equals, int64(4))
+	// 8 rows since the start of the first window
+	c.Assert(a.RowsPerSecond, check.Equals, float64(8)/profileWindow.Seconds())
+	// the sampled sizes are 100, 100, 100 and 500
+	c.Assert(a.AvgRowSize, check.Equals, 200)
+	c.Assert(a.P50RowSize, check.Equals, 128)
+	c.Assert(a.P99RowSize, check.Equals, 500)
+	c.Assert(a.MaxRowSize, check.Equals, 500)
+
+	b := profiles[1]
+	c.Assert(b.Table, check.Equals, "`test`.`b`")
+	c.Assert(b.Windows, check.HasLen, 1)
+	c.Assert(b.Windows[0].Sampled, check.Equals, int64(1))
+	c.Assert(b.MaxRowSize, check.Equals, 3000)
+
+	// the windows out of the ring buffer are overwritten or expired
+	for i := 0; i < profileWindows; i++ {
+		now = now.Add(profileWindow)
+		profiler.Observe([]model.Txn{profileTxn("a", 100)})
+	}
+	profiles = profiler.Profiles()
+	c.Assert(profiles, check.HasLen, 1)
+	c.Assert(profiles[0].Windows, check.HasLen, profileWindows)
+	c.Assert(profiles[0].Windows[0].Rows, check.Equals, int64(1))
+	c.Assert(profiles[0].MaxRowSize, check.Equals, 100)
+}
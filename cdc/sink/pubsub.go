@@ -0,0 +1,256 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/config"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	defaultPubSubEndpoint = "https://pubsub.googleapis.com"
+	pubSubScope           = "https://www.googleapis.com/auth/pubsub"
+
+	// limits of the publish API, the data is base64 encoded in the request,
+	// so the raw size of a request is limited to 3/4 of 10MB with some room
+	// for the other fields.
+	pubSubMaxMessagesPerPublish = 1000
+	pubSubMaxPublishSize        = 7 * 1024 * 1024
+	pubSubMaxOrderingKeySize    = 1024
+)
+
+// pubSubSink publishes the changes to a Google Cloud Pub/Sub topic. The
+// ordering keys are given by the dispatcher, the messages of a key are
+// delivered in order if message ordering is enabled on the subscription.
+type pubSubSink struct {
+	client   *http.Client
+	endpoint string
+	encoder  *mqEncoder
+}
+
+var _ Sink = &pubSubSink{}
+
+type pubSubMessage struct {
+	Data        []byte `json:"data"`
+	OrderingKey string `json:"orderingKey,omitempty"`
+}
+
+type pubSubPublishRequest struct {
+	Messages []*pubSubMessage `json:"messages"`
+}
+
+type pubSubPublishResponse struct {
+	MessageIds []string `json:"messageIds"`
+}
+
+var (
+	pubSubEndpointParam        = config.StringParam("endpoint")
+	pubSubCredentialsFileParam = config.StringParam("credentials-file")
+)
+
+func init() {
+	config.Register(&config.Scheme{
+		Name:    "pubsub",
+		Example: "pubsub://project/topic",
+		Params:  mqParams(mqPartitionKeyParam, pubSubEndpointParam, pubSubCredentialsFileParam),
+		Check: func(uri *config.URI) error {
+			if uri.URL.Host == "" || strings.Trim(uri.URL.Path, "/") == "" {
+				return errors.New("project or topic of pubsub is not specified, the sink uri looks like pubsub://project/topic")
+			}
+			return nil
+		},
+	})
+}
+
+// NewPubSubSink creates a new Pub/Sub sink, the sink uri looks like
+// `pubsub://project/topic?credentials-file=/path/to/key.json&partition-key=pk`.
+// The application default credentials are used if the service account key
+// file is not specified. The `endpoint` parameter points the sink to another
+// server like the emulator, no credentials are sent to it.
+func NewPubSubSink(sinkURI *url.URL, infoGetter TableInfoGetter, opts map[string]string) (Sink, error) {
+	params := sinkURI.Query()
+	ctx := context.Background()
+	endpoint, _ := pubSubEndpointParam.String(params, "")
+	var client *http.Client
+	if endpoint != "" {
+		client = &http.Client{}
+	} else {
+		endpoint = defaultPubSubEndpoint
+		var (
+			creds *google.Credentials
+			err   error
+		)
+		if file, _ := pubSubCredentialsFileParam.String(params, ""); file != "" {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, errors.Annotatef(err, "read credentials file %s", file)
+			}
+			creds, err = google.CredentialsFromJSON(ctx, data, pubSubScope)
+			if err != nil {
+				return nil, errors.Annotatef(err, "parse credentials file %s", file)
+			}
+		} else {
+			creds, err = google.FindDefaultCredentials(ctx, pubSubScope)
+			if err != nil {
+				return nil, errors.Annotate(err, "find default credentials")
+			}
+		}
+		client = oauth2.NewClient(ctx, creds.TokenSource)
+	}
+	client.Timeout = time.Minute
+	s, err := newPubSubSink(client, endpoint, sinkURI, infoGetter)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.encoder.applyOpts(opts)
+	return s, nil
+}
+
+func newPubSubSink(client *http.Client, endpoint string, sinkURI *url.URL, infoGetter TableInfoGetter) (*pubSubSink, error) {
+	project := sinkURI.Host
+	topic := strings.Trim(sinkURI.Path, "/")
+	if project == "" || topic == "" {
+		return nil, errors.Errorf("project or topic of pubsub is not specified: %s", sinkURI)
+	}
+	params := sinkURI.Query()
+	rule, err := mqPartitionKeyParam.String(params, "table")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	dispatcher, err := newDispatcher(rule)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	encoder, err := newMQEncoder(infoGetter, dispatcher, params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &pubSubSink{
+		client:   client,
+		endpoint: fmt.Sprintf("%s/v1/projects/%s/topics/%s:publish", strings.TrimRight(endpoint, "/"), project, topic),
+		encoder:  encoder,
+	}, nil
+}
+
+// EmitDDL implements Sink interface.
+func (s *pubSubSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	msg, err := s.encoder.encodeDDL(txn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if msg == nil {
+		return nil
+	}
+	return errors.Trace(s.publishMessages(ctx, []*mqMessage{msg}))
+}
+
+// EmitDMLs implements Sink interface.
+func (s *pubSubSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	msgs, err := s.encoder.encodeTxns(ctx, txns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.publishMessages(ctx, msgs))
+}
+
+// FlushCheckpoint implements Sink interface.
+// The messages are published before EmitDMLs returns.
+func (s *pubSubSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	return ts, nil
+}
+
+// Close implements Sink interface.
+func (s *pubSubSink) Close() error {
+	return nil
+}
+
+// publishMessages publishes the messages in batches one after another, so the
+// order of the messages with the same ordering key is kept.
+func (s *pubSubSink) publishMessages(ctx context.Context, msgs []*mqMessage) error {
+	var (
+		batch []*pubSubMessage
+		size  int
+	)
+	for _, msg := range msgs {
+		key := truncateUTF8(msg.key, pubSubMaxOrderingKeySize)
+		msgSize := len(msg.value) + len(key)
+		if msgSize > pubSubMaxPublishSize {
+			return errors.Errorf("pubsub message of key %s is too large, size: %d", key, len(msg.value))
+		}
+		if len(batch) >= pubSubMaxMessagesPerPublish || size+msgSize > pubSubMaxPublishSize {
+			if err := s.publish(ctx, batch); err != nil {
+				return errors.Trace(err)
+			}
+			batch, size = nil, 0
+		}
+		batch = append(batch, &pubSubMessage{Data: msg.value, OrderingKey: key})
+		size += msgSize
+	}
+	if len(batch) > 0 {
+		return errors.Trace(s.publish(ctx, batch))
+	}
+	return nil
+}
+
+func (s *pubSubSink) publish(ctx context.Context, msgs []*pubSubMessage) error {
+	body, err := json.Marshal(&pubSubPublishRequest{Messages: msgs})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return retry.Run(func() error {
+		req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("pubsub publish failed, status: %d, message: %s", resp.StatusCode, data)
+		}
+		result := new(pubSubPublishResponse)
+		if err := json.Unmarshal(data, result); err != nil {
+			return errors.Annotatef(err, "unmarshal publish response: %s", data)
+		}
+		if len(result.MessageIds) != len(msgs) {
+			return errors.Errorf("pubsub published %d messages, expect %d", len(result.MessageIds), len(msgs))
+		}
+		log.Debug("pubsub published messages", zap.Int("count", len(msgs)))
+		return nil
+	}, 3)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/pingcap/check"
+)
+
+type pubSubSuite struct{}
+
+var _ = check.Suite(&pubSubSuite{})
+
+func (s *pubSubSuite) TestPublish(c *check.C) {
+	var (
+		mu       sync.Mutex
+		requests []*pubSubPublishRequest
+		failed   bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.URL.Path, check.Equals, "/v1/projects/project/topics/topic:publish")
+		mu.Lock()
+		defer mu.Unlock()
+		// the first request fails and is retried
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		publish := new(pubSubPublishRequest)
+		c.Assert(json.NewDecoder(req.Body).Decode(publish), check.IsNil)
+		requests = append(requests, publish)
+		resp := &pubSubPublishResponse{}
+		for i := range publish.Messages {
+			resp.MessageIds = append(resp.MessageIds, fmt.Sprint(i))
+		}
+		c.Assert(json.NewEncoder(w).Encode(resp), check.IsNil)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse("pubsub://project/topic?partition-key=pk&endpoint=" + server.URL)
+	c.Assert(err, check.IsNil)
+	sink, err := NewPubSubSink(u, &tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1, 2), newTestTxn(11, "t1", 1))
+	c.Assert(err, check.IsNil)
+
+	c.Assert(requests, check.HasLen, 1)
+	msgs := requests[0].Messages
+	c.Assert(msgs, check.HasLen, 3)
+	c.Assert(msgs[0].OrderingKey, check.Equals, "test.t1_1_tester")
+	c.Assert(msgs[1].OrderingKey, check.Equals, "test.t1_2_tester")
+	c.Assert(msgs[2].OrderingKey, check.Equals, "test.t1_1_tester")
+	c.Assert(decodeEvent(c, msgs[0].Data).Ts, check.Equals, uint64(10))
+	c.Assert(decodeEvent(c, msgs[2].Data).Ts, check.Equals, uint64(11))
+}
+
+func (s *pubSubSuite) TestInvalidURI(c *check.C) {
+	u, err := url.Parse("pubsub://project/?endpoint=http://127.0.0.1:8085")
+	c.Assert(err, check.IsNil)
+	_, err = NewPubSubSink(u, &tableHelper{}, nil)
+	c.Assert(err, check.ErrorMatches, ".*project or topic of pubsub is not specified.*")
+}
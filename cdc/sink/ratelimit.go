@@ -0,0 +1,109 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitSink delays the transactions emitted to the backend sink to keep
+// the rows and bytes written per second under the limits. The DDLs are not
+// limited.
+type rateLimitSink struct {
+	backend Sink
+	rows    *rate.Limiter
+	bytes   *rate.Limiter
+
+	waitSeconds prometheus.Counter
+}
+
+var _ Sink = &rateLimitSink{}
+
+// NewRateLimitSink wraps the sink to limit the rows and the estimated bytes of
+// the transactions written per second, a limit is disabled if it isn't
+// positive. The burst of a limit is the changes of a second.
+func NewRateLimitSink(backend Sink, changefeedID string, rowsPerSecond, bytesPerSecond int) Sink {
+	s := &rateLimitSink{
+		backend:     backend,
+		waitSeconds: rateLimitWaitSecondsCounter.WithLabelValues(changefeedID),
+	}
+	if rowsPerSecond > 0 {
+		s.rows = rate.NewLimiter(rate.Limit(rowsPerSecond), rowsPerSecond)
+	}
+	if bytesPerSecond > 0 {
+		s.bytes = rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+	}
+	return s
+}
+
+// EmitDMLs implements Sink interface.
+func (s *rateLimitSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	var rows, bytes int
+	for _, txn := range txns {
+		rows += len(txn.DMLs)
+		for _, dml := range txn.DMLs {
+			bytes += estimateDMLSize(dml)
+		}
+	}
+	start := time.Now()
+	if err := waitLimiter(ctx, s.rows, rows); err != nil {
+		return errors.Trace(err)
+	}
+	if err := waitLimiter(ctx, s.bytes, bytes); err != nil {
+		return errors.Trace(err)
+	}
+	s.waitSeconds.Add(time.Since(start).Seconds())
+	return errors.Trace(s.backend.EmitDMLs(ctx, txns...))
+}
+
+// EmitDDL implements Sink interface.
+func (s *rateLimitSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *rateLimitSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	ts, err := s.backend.FlushCheckpoint(ctx, ts)
+	return ts, errors.Trace(err)
+}
+
+// Close implements Sink interface.
+func (s *rateLimitSink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
+
+// waitLimiter waits for n tokens of the limiter, n may exceed the burst of the
+// limiter, in which case the tokens are taken a burst at a time.
+func waitLimiter(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	for n > 0 {
+		m := n
+		if m > limiter.Burst() {
+			m = limiter.Burst()
+		}
+		if err := limiter.WaitN(ctx, m); err != nil {
+			return errors.Trace(err)
+		}
+		n -= m
+	}
+	return nil
+}
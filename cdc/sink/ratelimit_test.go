@@ -0,0 +1,90 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/types"
+)
+
+type rateLimitSuite struct{}
+
+var _ = check.Suite(&rateLimitSuite{})
+
+func rateLimitTxn(ts uint64, rows int, value string) model.Txn {
+	txn := model.Txn{Ts: ts}
+	for i := 0; i < rows; i++ {
+		txn.DMLs = append(txn.DMLs, &model.DML{
+			Database: "test",
+			Table:    "t",
+			Tp:       model.InsertDMLType,
+			Values:   map[string]types.Datum{"v": types.NewStringDatum(value)},
+		})
+	}
+	return txn
+}
+
+func (s *rateLimitSuite) TestRowsLimit(c *check.C) {
+	backend := &mockBackendSink{unblock: make(chan struct{})}
+	close(backend.unblock)
+	sink := NewRateLimitSink(backend, "test", 100, 0)
+	defer sink.Close()
+	ctx := context.Background()
+
+	// the burst is taken at once
+	start := time.Now()
+	c.Assert(sink.EmitDMLs(ctx, rateLimitTxn(1, 60, "a"), rateLimitTxn(2, 40, "a")), check.IsNil)
+	c.Assert(time.Since(start), check.Less, 50*time.Millisecond)
+
+	// a transaction larger than the burst waits for several bursts
+	start = time.Now()
+	c.Assert(sink.EmitDMLs(ctx, rateLimitTxn(3, 150, "a")), check.IsNil)
+	c.Assert(time.Since(start) >= 1400*time.Millisecond, check.IsTrue)
+	c.Assert(backend.recorded(), check.DeepEquals, []string{"dml 1", "dml 2", "dml 3"})
+
+	// the DDLs are not limited
+	c.Assert(sink.EmitDDL(ctx, model.Txn{Ts: 4}), check.IsNil)
+	ts, err := sink.FlushCheckpoint(ctx, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(4))
+
+	ctx1, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = sink.EmitDMLs(ctx1, rateLimitTxn(5, 100, "a"))
+	c.Assert(err, check.ErrorMatches, ".*exceed context deadline.*")
+	c.Assert(backend.recorded(), check.HasLen, 5)
+}
+
+func (s *rateLimitSuite) TestBytesLimit(c *check.C) {
+	backend := &mockBackendSink{unblock: make(chan struct{})}
+	close(backend.unblock)
+	value := strings.Repeat("x", 99)
+	// each row is estimated as 100 bytes
+	c.Assert(estimateDMLSize(rateLimitTxn(0, 1, value).DMLs[0]), check.Equals, 100)
+	c.Assert(estimateDMLSize(&model.DML{Values: map[string]types.Datum{"id": types.NewIntDatum(1)}}), check.Equals, 10)
+
+	sink := NewRateLimitSink(backend, "test", 0, 1000)
+	defer sink.Close()
+	ctx := context.Background()
+	start := time.Now()
+	c.Assert(sink.EmitDMLs(ctx, rateLimitTxn(1, 10, value)), check.IsNil)
+	c.Assert(sink.EmitDMLs(ctx, rateLimitTxn(2, 5, value)), check.IsNil)
+	c.Assert(time.Since(start) >= 400*time.Millisecond, check.IsTrue)
+	c.Assert(backend.recorded(), check.DeepEquals, []string{"dml 1", "dml 2"})
+}
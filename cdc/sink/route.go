@@ -0,0 +1,245 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+	// the parser needs the value expressions of TiDB
+	_ "github.com/pingcap/tidb/types/parser_driver"
+)
+
+// Router routes the upstream tables to the downstream tables by the route
+// rules of the changefeed. The rows are routed by the route sinks of the
+// processors, and the DDLs are routed by the owner before they are executed.
+// It's not safe for concurrent use.
+type Router struct {
+	rules []model.RouteRule
+	// names caches the routed names by the quoted upstream names
+	names  map[string]routedName
+	parser *parser.Parser
+}
+
+type routedName struct {
+	schema string
+	table  string
+}
+
+// NewRouter creates a Router with the route rules.
+func NewRouter(rules []model.RouteRule) (*Router, error) {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return &Router{
+		rules:  rules,
+		names:  make(map[string]routedName),
+		parser: parser.New(),
+	}, nil
+}
+
+// Route returns the downstream name of the table, it's the upstream name if
+// no rule matches the table.
+func (r *Router) Route(schema, table string) (string, string) {
+	if len(r.rules) == 0 {
+		return schema, table
+	}
+	key := util.QuoteSchema(schema, table)
+	if name, ok := r.names[key]; ok {
+		return name.schema, name.table
+	}
+	name := routedName{schema: schema, table: table}
+	for i := range r.rules {
+		if targetSchema, targetTable, ok := r.rules[i].Route(schema, table); ok {
+			name = routedName{schema: targetSchema, table: targetTable}
+			break
+		}
+	}
+	r.names[key] = name
+	return name.schema, name.table
+}
+
+// routeSchema returns the downstream name of the schema, it's only routed if
+// all the tables in it are routed to another schema by their own names.
+func (r *Router) routeSchema(schema string) string {
+	for i := range r.rules {
+		if target, ok := r.rules[i].RouteSchema(schema); ok {
+			return target
+		}
+	}
+	return schema
+}
+
+// RouteDDL returns the DDL with the names of the tables and schemas in the
+// query replaced by the downstream names. The DDL passed in is not modified,
+// it's returned if nothing is routed.
+func (r *Router) RouteDDL(ddl *model.DDL) (*model.DDL, error) {
+	if len(r.rules) == 0 || ddl.Job == nil {
+		return ddl, nil
+	}
+	stmt, err := r.parser.ParseOneStmt(ddl.Job.Query, "", "")
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse DDL %s", ddl.Job.Query)
+	}
+	v := &ddlRouteVisitor{router: r, schema: ddl.Database}
+	stmt.Accept(v)
+	if !v.routed {
+		return ddl, nil
+	}
+	var query strings.Builder
+	if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &query)); err != nil {
+		return nil, errors.Annotatef(err, "restore DDL %s", ddl.Job.Query)
+	}
+
+	// the job has a mutex, it's copied by encoding
+	data, err := ddl.Job.Encode(false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	job := &timodel.Job{}
+	if err := job.Decode(data); err != nil {
+		return nil, errors.Trace(err)
+	}
+	job.Query = query.String()
+	routed := &model.DDL{Job: job}
+	if ddl.Table == "" {
+		routed.Database = r.routeSchema(ddl.Database)
+	} else {
+		routed.Database, routed.Table = r.Route(ddl.Database, ddl.Table)
+	}
+	return routed, nil
+}
+
+// ddlRouteVisitor replaces the names of the tables and schemas in a DDL, the
+// tables not qualified by a schema are in the schema of the DDL.
+type ddlRouteVisitor struct {
+	router *Router
+	schema string
+	routed bool
+}
+
+// Enter implements ast.Visitor interface.
+func (v *ddlRouteVisitor) Enter(in ast.Node) (ast.Node, bool) {
+	switch node := in.(type) {
+	case *ast.TableName:
+		node.Schema, node.Name = v.routeTable(node.Schema, node.Name)
+	case *ast.ColumnName:
+		// the columns qualified only by a table may be qualified by an alias
+		if node.Schema.O != "" {
+			node.Schema, node.Table = v.routeTable(node.Schema, node.Table)
+		}
+	case *ast.CreateDatabaseStmt:
+		node.Name = v.routeSchema(node.Name)
+	case *ast.AlterDatabaseStmt:
+		node.Name = v.routeSchema(node.Name)
+	case *ast.DropDatabaseStmt:
+		node.Name = v.routeSchema(node.Name)
+	}
+	return in, false
+}
+
+// Leave implements ast.Visitor interface.
+func (v *ddlRouteVisitor) Leave(in ast.Node) (ast.Node, bool) {
+	return in, true
+}
+
+func (v *ddlRouteVisitor) routeTable(schema, table timodel.CIStr) (timodel.CIStr, timodel.CIStr) {
+	schemaName := schema.O
+	if schemaName == "" {
+		schemaName = v.schema
+	}
+	targetSchema, targetTable := v.router.Route(schemaName, table.O)
+	if targetSchema == schemaName && targetTable == table.O {
+		return schema, table
+	}
+	v.routed = true
+	return timodel.NewCIStr(targetSchema), timodel.NewCIStr(targetTable)
+}
+
+func (v *ddlRouteVisitor) routeSchema(schema string) string {
+	if schema == "" {
+		return schema
+	}
+	target := v.router.routeSchema(schema)
+	if target != schema {
+		v.routed = true
+	}
+	return target
+}
+
+// routeSink writes the rows to the downstream tables routed by the route
+// rules of the changefeed. The downstream names are set as the targets of the
+// DMLs, the backends look up the tables by the upstream names and write the
+// rows to the targets. The DDLs are routed by the owner, they are passed
+// through. The DMLs passed in are not modified.
+type routeSink struct {
+	backend Sink
+	router  *Router
+}
+
+var _ Sink = &routeSink{}
+
+// NewRouteSink wraps the sink to route the rows with the route rules.
+func NewRouteSink(backend Sink, rules []model.RouteRule) (Sink, error) {
+	router, err := NewRouter(rules)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &routeSink{backend: backend, router: router}, nil
+}
+
+// EmitDMLs implements Sink interface.
+func (s *routeSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	routed := make([]model.Txn, len(txns))
+	for i, txn := range txns {
+		routed[i] = txn
+		routed[i].DMLs = make([]*model.DML, len(txn.DMLs))
+		for j, dml := range txn.DMLs {
+			schema, table := s.router.Route(dml.Database, dml.Table)
+			if schema == dml.Database && table == dml.Table {
+				routed[i].DMLs[j] = dml
+				continue
+			}
+			routedDML := *dml
+			routedDML.TargetDatabase, routedDML.TargetTable = schema, table
+			routed[i].DMLs[j] = &routedDML
+		}
+	}
+	return errors.Trace(s.backend.EmitDMLs(ctx, routed...))
+}
+
+// EmitDDL implements Sink interface.
+func (s *routeSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *routeSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	ts, err := s.backend.FlushCheckpoint(ctx, ts)
+	return ts, errors.Trace(err)
+}
+
+// Close implements Sink interface.
+func (s *routeSink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/schema"
+)
+
+type routeSuite struct{}
+
+var _ = check.Suite(&routeSuite{})
+
+func (s *routeSuite) TestRoute(c *check.C) {
+	router, err := NewRouter([]model.RouteRule{
+		{Table: "test.t", Target: "test_shadow.t"},
+		{Table: "test.orders_*", Target: "test.orders"},
+		{Table: "app.*", Target: "{schema}_shadow.{table}"},
+	})
+	c.Assert(err, check.IsNil)
+	for _, tc := range []struct {
+		schema, table, targetSchema, targetTable string
+	}{
+		{"test", "t", "test_shadow", "t"},
+		{"TEST", "T", "test_shadow", "t"},
+		{"test", "orders_01", "test", "orders"},
+		{"app", "users", "app_shadow", "users"},
+		{"test", "t2", "test", "t2"},
+	} {
+		schema, table := router.Route(tc.schema, tc.table)
+		c.Assert(schema, check.Equals, tc.targetSchema)
+		c.Assert(table, check.Equals, tc.targetTable)
+	}
+
+	newDDL := func(schema, table, query string) *model.DDL {
+		return &model.DDL{Database: schema, Table: table, Job: &timodel.Job{ID: 1, Query: query}}
+	}
+	for _, tc := range []struct {
+		ddl          *model.DDL
+		targetSchema string
+		targetTable  string
+		query        string
+	}{
+		{
+			newDDL("test", "t", "alter table t add column c int"),
+			"test_shadow", "t", "ALTER TABLE `test_shadow`.`t` ADD COLUMN `c` INT",
+		},
+		{
+			newDDL("test", "t3", "create table t3 like test.t"),
+			"test", "t3", "CREATE TABLE `t3` LIKE `test_shadow`.`t`",
+		},
+		{
+			newDDL("app", "users", "create table `app`.`users` (id int primary key)"),
+			"app_shadow", "users", "CREATE TABLE `app_shadow`.`users` (`id` INT PRIMARY KEY)",
+		},
+		{
+			newDDL("app", "", "create database app"),
+			"app_shadow", "", "CREATE DATABASE `app_shadow`",
+		},
+		// the schemas with only some tables routed are not routed
+		{
+			newDDL("test", "", "drop database test"),
+			"test", "", "drop database test",
+		},
+		{
+			newDDL("test", "t2", "truncate table t2"),
+			"test", "t2", "truncate table t2",
+		},
+	} {
+		routed, err := router.RouteDDL(tc.ddl)
+		c.Assert(err, check.IsNil)
+		c.Assert(routed.Database, check.Equals, tc.targetSchema)
+		c.Assert(routed.Table, check.Equals, tc.targetTable)
+		c.Assert(routed.Job.Query, check.Equals, tc.query)
+		c.Assert(routed.Job.ID, check.Equals, int64(1))
+	}
+	// the DDL passed in is not modified
+	ddl := newDDL("test", "t", "drop table t")
+	routed, err := router.RouteDDL(ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(routed.Job.Query, check.Equals, "DROP TABLE `test_shadow`.`t`")
+	c.Assert(ddl.Job.Query, check.Equals, "drop table t")
+	c.Assert(ddl.Database, check.Equals, "test")
+
+	_, err = router.RouteDDL(newDDL("test", "t", "alter table"))
+	c.Assert(err, check.ErrorMatches, ".*parse DDL alter table.*")
+	_, err = NewRouter([]model.RouteRule{{Table: "test", Target: "test_shadow.t"}})
+	c.Assert(err, check.ErrorMatches, "invalid route table: test.*")
+}
+
+func (s *routeSuite) TestRouteSink(c *check.C) {
+	backend := &recordingSink{}
+	sink, err := NewRouteSink(backend, []model.RouteRule{{Table: "test.t", Target: "test_shadow.t"}})
+	c.Assert(err, check.IsNil)
+	routed := newTestDML(model.InsertDMLType, "t", 1, "a")
+	unrouted := newTestDML(model.InsertDMLType, "t2", 1, "a")
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{routed, unrouted}})
+	c.Assert(err, check.IsNil)
+	c.Assert(backend.txns, check.HasLen, 1)
+	dmls := backend.txns[0].DMLs
+	// the upstream names are kept for the lookups of the table info
+	c.Assert(dmls[0].TableName(), check.Equals, "`test`.`t`")
+	c.Assert(dmls[0].TargetTableName(), check.Equals, "`test_shadow`.`t`")
+	c.Assert(dmls[0].Values, check.DeepEquals, routed.Values)
+	c.Assert(dmls[1], check.Equals, unrouted)
+	c.Assert(dmls[1].TargetTableName(), check.Equals, "`test`.`t2`")
+	// the DMLs passed in are not modified
+	c.Assert(routed.TargetTable, check.Equals, "")
+}
+
+// upstreamTables only knows the tables by their upstream names.
+type upstreamTables struct {
+	tableHelper
+	names map[string]bool
+}
+
+func (h *upstreamTables) GetTableByName(schema, table string) (*schema.TableInfo, bool) {
+	if !h.names[schema+"."+table] {
+		return nil, false
+	}
+	return h.tableHelper.GetTableByName(schema, table)
+}
+
+func (s *routeSuite) TestRouteToMySQL(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	backend := &mysqlSink{
+		db:         db,
+		infoGetter: &upstreamTables{names: map[string]bool{"test.t": true}},
+	}
+	sink, err := NewRouteSink(backend, []model.RouteRule{{Table: "test.t", Target: "test_shadow.t"}})
+	c.Assert(err, check.IsNil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test_shadow`.`t`(`id`,`name`) VALUES (?,?);").
+		WithArgs(1, "a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 1, DMLs: []*model.DML{newTestDML(model.InsertDMLType, "t", 1, "a")}})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -15,24 +15,224 @@ package sink
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/schema"
+	"github.com/pingcap/ticdc/cdc/sink/config"
+	"github.com/pingcap/tidb/types"
 )
 
 // Sink is an abstraction for anything that a changefeed may emit into.
 type Sink interface {
 	// EmitDMLs saves the specified DMLs to the sink backend
 	EmitDMLs(ctx context.Context, txn ...model.Txn) error
-	// EmitDDL saves the specified DDL to the sink backend
+	// EmitDDL saves the specified DDL to the sink backend, it's a barrier
+	// that the DMLs emitted before it are applied before the DDL.
 	EmitDDL(ctx context.Context, txn model.Txn) error
+	// FlushCheckpoint is called after all the transactions with commit ts
+	// less than or equal to ts are emitted, it returns the max ts whose
+	// transactions are durably applied by the downstream. The checkpoint of
+	// the changefeed never goes beyond the returned ts.
+	FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error)
 	// Close does not guarantee delivery of outstanding messages.
 	Close() error
 }
 
+// TwoPhaseCommitter is implemented by the sinks backed by the transactional
+// downstreams, like an XA-capable database, to apply the transactions
+// atomically with the checkpoint. The processor calls Prepare instead of
+// FlushCheckpoint, persists ts as its checkpoint, and then calls Commit. If
+// the processor fails between them, the prepared transactions are resolved by
+// Recover when the sink is created again. The sink should identify its
+// prepared transactions by the changefeed and the capture.
+type TwoPhaseCommitter interface {
+	// Prepare writes the transactions emitted after the last prepared ts in
+	// a prepared transaction of the downstream, they are not visible until
+	// committed.
+	Prepare(ctx context.Context, ts uint64) error
+	// Commit commits the transaction prepared at ts.
+	Commit(ctx context.Context, ts uint64) error
+	// Recover commits the prepared transactions not after checkpointTs, and
+	// rolls back the others, since they are replicated again after the
+	// checkpoint.
+	Recover(ctx context.Context, checkpointTs uint64) error
+}
+
+// OptChangefeedID is the option key of the changefeed ID, it's set by the
+// processor and the owner to label the metrics of the sink.
+const OptChangefeedID = "_changefeed_id"
+
+// OptDDLTrackTable is the option key of the table recording the executed DDLs,
+// like "tidb_cdc.ddl_history".
+const OptDDLTrackTable = "_ddl_track_table"
+
+// fatalError is an error of the downstream that can't be fixed by retrying, it
+// stops the changefeed instead of the processor being restarted again and again.
+type fatalError struct {
+	err error
+}
+
+func newFatalError(err error) error {
+	return &fatalError{err: err}
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+// IsFatalError tells whether the error returned by a sink is fatal.
+func IsFatalError(err error) bool {
+	_, ok := errors.Cause(err).(*fatalError)
+	return ok
+}
+
+// tableError is an error of the downstream caused by a single table, like the
+// table is dropped or its columns are mismatched with upstream.
+type tableError struct {
+	schema string
+	table  string
+	err    error
+}
+
+// NewTableError creates an error attributable to the table, the other tables
+// may still be written.
+func NewTableError(schema, table string, err error) error {
+	return &tableError{schema: schema, table: table, err: err}
+}
+
+func (e *tableError) Error() string {
+	return fmt.Sprintf("table %s.%s: %s", e.schema, e.table, e.err.Error())
+}
+
+// Cause returns the error of the downstream, so the error can still be
+// classified by the cause.
+func (e *tableError) Cause() error {
+	return e.err
+}
+
+// TableErrorOf returns the table which the error returned by a sink is
+// attributable to, ok is false if the error is not caused by a single table.
+func TableErrorOf(err error) (schema, table string, ok bool) {
+	type causer interface {
+		Cause() error
+	}
+	for err != nil {
+		switch e := err.(type) {
+		case *tableError:
+			return e.schema, e.table, true
+		case *fatalError:
+			err = e.err
+		case causer:
+			err = e.Cause()
+		default:
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// featureOpt returns the feature flag set in the sink options, ok is false if
+// the flag is not set.
+func featureOpt(opts map[string]string, name string) (enabled bool, ok bool) {
+	v, ok := opts[model.FeatureOptPrefix+name]
+	if !ok {
+		return false, false
+	}
+	enabled, err := strconv.ParseBool(v)
+	return enabled, err == nil
+}
+
 // TableInfoGetter is used to get table info by table id of TiDB
 type TableInfoGetter interface {
 	TableByID(id int64) (info *schema.TableInfo, ok bool)
 	GetTableIDByName(schema, table string) (int64, bool)
 	GetTableByName(schema, table string) (info *schema.TableInfo, ok bool)
 }
+
+// the parameters of the sink uri shared by the sinks
+var (
+	tlsParam          = config.BoolParam("tls")
+	maxBatchRowsParam = config.IntParam("max-batch-rows", 1)
+)
+
+// ValidateSinkURI checks the sink uri and its parameters by the scheme of the
+// sink, so an invalid sink uri is rejected when the changefeed is created
+// instead of failing in the processors. The warnings are the unknown
+// parameters ignored by the sink and the password written in the sink uri.
+func ValidateSinkURI(sinkURI string) (warnings []string, err error) {
+	uri, err := config.Parse(sinkURI)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := uri.Validate(); err != nil {
+		return nil, errors.Annotatef(err, "invalid %s sink uri", uri.Scheme.Name)
+	}
+	warnings = uri.Warnings()
+	if uri.HasInlinePassword() {
+		warnings = append(warnings, fmt.Sprintf("the password is saved in the sink uri in plain text, refer to it by %s or %s instead",
+			config.PasswordFileParam.Name, config.PasswordEnvParam.Name))
+	}
+	return warnings, nil
+}
+
+// NewSink creates a new sink with the sink-uri.
+// A sink-uri without a scheme is treated as a MySQL DSN. The password can be
+// referred by the `password-file` or the `password-env` parameter instead of
+// being written in the sink-uri.
+func NewSink(sinkURI string, infoGetter TableInfoGetter, opts map[string]string) (Sink, error) {
+	uri, err := config.Parse(sinkURI)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, warning := range uri.Warnings() {
+		log.Warn(warning)
+	}
+	if err := uri.ResolveSecrets(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	u := uri.URL
+	switch uri.Scheme.Name {
+	case "mysql":
+		return NewMySQLSink(uri.String(), infoGetter, opts)
+	case "clickhouse":
+		return NewClickHouseSink(u, infoGetter, opts)
+	case "doris", "starrocks":
+		return NewStreamLoadSink(u, infoGetter, opts)
+	case "elasticsearch":
+		return NewElasticsearchSink(u, infoGetter, opts)
+	case "grpc":
+		return NewGRPCSink(u, infoGetter, opts)
+	case "kinesis":
+		return NewKinesisSink(u, infoGetter, opts)
+	case "nats":
+		return NewNATSSink(u, infoGetter, opts)
+	case "pubsub":
+		return NewPubSubSink(u, infoGetter, opts)
+	default:
+		return nil, errors.Errorf("unsupported sink scheme: %s", uri.Scheme.Name)
+	}
+}
+
+// estimateDMLSize returns the rough size of the row written by the DML, it's
+// the size of the column names and the values.
+func estimateDMLSize(dml *model.DML) int {
+	return estimateValuesSize(dml.Values) + estimateValuesSize(dml.OldValues)
+}
+
+func estimateValuesSize(values map[string]types.Datum) int {
+	size := 0
+	for name, value := range values {
+		size += len(name)
+		// the numbers are counted as 8 bytes
+		if n := len(value.GetBytes()); n > 8 {
+			size += n
+		} else {
+			size += 8
+		}
+	}
+	return size
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"github.com/pingcap/check"
+)
+
+type sinkURISuite struct{}
+
+var _ = check.Suite(&sinkURISuite{})
+
+func (s *sinkURISuite) TestValidateSinkURI(c *check.C) {
+	warnings, err := ValidateSinkURI("root@tcp(127.0.0.1:3306)/?worker-count=4&time-zone=Asia%2FShanghai&tidb_txn_mode=optimistic")
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.HasLen, 0)
+	warnings, err = ValidateSinkURI("kinesis://stream/?partition-key=pk&aggregation=false&protocol=debezium")
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.HasLen, 0)
+	warnings, err = ValidateSinkURI("nats://127.0.0.1:4222/?route=delete:test.*:audit.{table}&route=upsert:*.*:all")
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.HasLen, 0)
+
+	warnings, err = ValidateSinkURI("clickhouse://127.0.0.1:8123/?max-batch-row=100")
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.DeepEquals, []string{
+		"unknown parameter max-batch-row of the clickhouse sink is ignored, did you mean max-batch-rows?",
+	})
+
+	warnings, err = ValidateSinkURI("root:secret@tcp(127.0.0.1:3306)/")
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.DeepEquals, []string{
+		"the password is saved in the sink uri in plain text, refer to it by password-file or password-env instead",
+	})
+	warnings, err = ValidateSinkURI("elasticsearch://user@127.0.0.1:9200/?password-env=ES_PASSWORD")
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings, check.HasLen, 0)
+
+	for _, tc := range []struct {
+		uri string
+		err string
+	}{
+		{"root@tcp(127.0.0.1:3306)/?worker-count=0", ".*invalid worker-count: 0, it should be a positive integer.*"},
+		{"root@tcp(127.0.0.1:3306)/?time-zone=Local", ".*invalid time-zone: Local.*"},
+		{"mysql://127.0.0.1:3306/", ".*the mysql sink uri is a DSN without the scheme.*"},
+		{"kafka://127.0.0.1:9092/", ".*unsupported sink scheme: kafka, it should be one of.*"},
+		{"kinesis:///?region=us-west-2", ".*the host of the kinesis sink uri is not specified.*"},
+		{"kinesis://stream/?partition-key=row", ".*unsupported partition-key: row, it should be one of table, pk, ts.*"},
+		{"pubsub://project/", ".*project or topic of pubsub is not specified.*"},
+		{"pubsub://project/topic?compression=lz4", ".*unsupported compression: lz4.*"},
+		{"nats://127.0.0.1:4222/?route=insert:test.t:a", ".*invalid DML type of route.*"},
+		{"elasticsearch://127.0.0.1:9200/?tls=yes", ".*invalid tls: yes, it should be true or false.*"},
+		{"doris://127.0.0.1:8030/?max-batch-rows=0", ".*invalid max-batch-rows: 0.*"},
+		{"doris://127.0.0.1:8030/?password-file=/etc/pwd", ".*the user of the doris sink uri is not specified.*"},
+	} {
+		_, err := ValidateSinkURI(tc.uri)
+		c.Assert(err, check.ErrorMatches, tc.err, check.Commentf("%s", tc.uri))
+	}
+}
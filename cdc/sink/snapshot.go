@@ -0,0 +1,178 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// snapshotSink applies the changes to the backend sink only at the resolved ts
+// about every interval, so the downstream is always consistent at a resolved
+// ts, which is the checkpoint of the changefeed. The changes in between are
+// buffered and the changes of the same row are compacted like the compactSink,
+// then the snapshot is emitted as one transaction, which is applied in one
+// downstream transaction by the backends supporting it, like the MySQL sink.
+//
+// The checkpoint doesn't go beyond the last applied snapshot, so the buffered
+// changes are replicated again if the processor fails.
+type snapshotSink struct {
+	backend    Sink
+	infoGetter TableInfoGetter
+	interval   time.Duration
+	now        func() time.Time
+
+	// pending are the changes buffered since the last snapshot, rows is the
+	// index of the change of a row in pending, and the tables in skipped are
+	// not compacted.
+	pending []*model.DML
+	rows    map[string]int
+	skipped map[string]struct{}
+
+	appliedTs uint64
+	appliedAt time.Time
+
+	compacted  prometheus.Counter
+	snapshotTs prometheus.Gauge
+	dmlCount   prometheus.Observer
+}
+
+var _ Sink = &snapshotSink{}
+
+// NewSnapshotSink wraps the sink to apply the changes at the resolved ts about
+// every interval.
+func NewSnapshotSink(backend Sink, changefeedID string, infoGetter TableInfoGetter, interval time.Duration) Sink {
+	return newSnapshotSink(backend, changefeedID, infoGetter, interval, time.Now)
+}
+
+func newSnapshotSink(backend Sink, changefeedID string, infoGetter TableInfoGetter, interval time.Duration, now func() time.Time) *snapshotSink {
+	return &snapshotSink{
+		backend:    backend,
+		infoGetter: infoGetter,
+		interval:   interval,
+		now:        now,
+		rows:       make(map[string]int),
+		skipped:    make(map[string]struct{}),
+		appliedAt:  now(),
+		compacted:  compactedDMLCounter.WithLabelValues(changefeedID),
+		snapshotTs: snapshotTsGauge.WithLabelValues(changefeedID),
+		dmlCount:   snapshotDMLHistogram.WithLabelValues(changefeedID),
+	}
+}
+
+// EmitDMLs implements Sink interface, the changes are buffered until the next
+// snapshot.
+func (s *snapshotSink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	for _, txn := range txns {
+		for _, dml := range txn.DMLs {
+			s.add(dml)
+		}
+	}
+	return nil
+}
+
+// add buffers the change, it's merged into the buffered change of the same
+// row. A table is not compacted any more once it has a change not identified
+// by the unique key, the changes of it buffered before are still in order.
+func (s *snapshotSink) add(dml *model.DML) {
+	table := dml.TableName()
+	if _, ok := s.skipped[table]; !ok {
+		key, ok := compactRowKey(s.infoGetter, dml)
+		if !ok {
+			s.skipped[table] = struct{}{}
+		} else {
+			key = table + "\x00" + key
+			if i, ok := s.rows[key]; ok {
+				s.pending[i] = mergeDML(s.pending[i], dml)
+				s.compacted.Inc()
+				return
+			}
+			s.rows[key] = len(s.pending)
+		}
+	}
+	s.pending = append(s.pending, dml)
+}
+
+// EmitDDL implements Sink interface, the buffered changes are applied before
+// the DDL.
+func (s *snapshotSink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	if err := s.apply(ctx, txn.Ts); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface. The buffered changes are applied
+// as the snapshot at ts if the interval has passed since the last snapshot, or
+// there are no changes buffered, otherwise the ts of the last snapshot is
+// returned.
+func (s *snapshotSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	if len(s.pending) > 0 && s.now().Sub(s.appliedAt) < s.interval {
+		return s.appliedTs, nil
+	}
+	if err := s.apply(ctx, ts); err != nil {
+		return 0, errors.Trace(err)
+	}
+	checkpointTs, err := s.backend.FlushCheckpoint(ctx, ts)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if checkpointTs > s.appliedTs {
+		s.appliedTs = checkpointTs
+		s.snapshotTs.Set(float64(oracle.ExtractPhysical(checkpointTs)))
+	}
+	return s.appliedTs, nil
+}
+
+// apply emits the buffered changes as one transaction at ts.
+func (s *snapshotSink) apply(ctx context.Context, ts uint64) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	txn := model.Txn{DMLs: s.pending, Ts: ts}
+	if err := s.backend.EmitDMLs(withAtomicEmit(ctx), txn); err != nil {
+		return errors.Trace(err)
+	}
+	s.dmlCount.Observe(float64(len(s.pending)))
+	s.pending = nil
+	s.rows = make(map[string]int)
+	s.skipped = make(map[string]struct{})
+	s.appliedAt = s.now()
+	return nil
+}
+
+// Close implements Sink interface, the buffered changes are dropped.
+func (s *snapshotSink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
+
+type atomicEmitKey struct{}
+
+// withAtomicEmit asks the backend sinks to apply the transactions of the
+// EmitDMLs call in one downstream transaction if they can.
+func withAtomicEmit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, atomicEmitKey{}, true)
+}
+
+// isAtomicEmit tells whether the transactions of the EmitDMLs call should be
+// applied in one downstream transaction.
+func isAtomicEmit(ctx context.Context) bool {
+	atomic, _ := ctx.Value(atomicEmitKey{}).(bool)
+	return atomic
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type snapshotSuite struct{}
+
+var _ = check.Suite(&snapshotSuite{})
+
+// snapshotBackend records the emitted transactions and whether they are
+// emitted atomically.
+type snapshotBackend struct {
+	mockBackendSink
+	txns   []model.Txn
+	atomic []bool
+}
+
+func (b *snapshotBackend) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	b.txns = append(b.txns, txns...)
+	b.atomic = append(b.atomic, isAtomicEmit(ctx))
+	return nil
+}
+
+func (s *snapshotSuite) TestSnapshot(c *check.C) {
+	backend := &snapshotBackend{}
+	now := time.Unix(100, 0)
+	sink := newSnapshotSink(backend, "test", &compactTableHelper{}, 10*time.Second, func() time.Time { return now })
+	ctx := context.Background()
+
+	// the checkpoint goes forward with nothing buffered
+	ts, err := sink.FlushCheckpoint(ctx, 5)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(5))
+
+	insert1 := newTestDML(model.InsertDMLType, "t", 1, "a")
+	noKey1 := newTestDML(model.InsertDMLType, "nokey", 1, "a")
+	update1 := newTestDML(model.UpdateDMLType, "t", 1, "b")
+	noKey2 := newTestDML(model.InsertDMLType, "nokey", 1, "b")
+	insert2 := newTestDML(model.InsertDMLType, "t", 2, "a")
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(6, insert1, noKey1)), check.IsNil)
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(7, update1, noKey2), compactTestTxn(8, insert2)), check.IsNil)
+
+	// the changes are buffered until the interval passes
+	now = now.Add(5 * time.Second)
+	ts, err = sink.FlushCheckpoint(ctx, 8)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(5))
+	c.Assert(backend.txns, check.HasLen, 0)
+	c.Assert(backend.recorded(), check.DeepEquals, []string{"checkpoint 5"})
+
+	now = now.Add(5 * time.Second)
+	ts, err = sink.FlushCheckpoint(ctx, 9)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(9))
+	c.Assert(backend.recorded(), check.DeepEquals, []string{"checkpoint 5", "checkpoint 9"})
+	// the snapshot is one transaction at the resolved ts, the changes of a
+	// row are merged and the table without a unique key isn't compacted
+	c.Assert(backend.txns, check.HasLen, 1)
+	c.Assert(backend.atomic, check.DeepEquals, []bool{true})
+	c.Assert(backend.txns[0].Ts, check.Equals, uint64(9))
+	dmls := backend.txns[0].DMLs
+	c.Assert(dmls, check.HasLen, 4)
+	c.Assert(dmls[0].Tp, check.Equals, model.InsertDMLType)
+	c.Assert(compactTestName(dmls[0].Values), check.Equals, "b")
+	c.Assert(dmls[1:], check.DeepEquals, []*model.DML{noKey1, noKey2, insert2})
+
+	// the buffer is reset after the snapshot
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(10, newTestDML(model.DeleteDMLType, "t", 1, nil))), check.IsNil)
+	ts, err = sink.FlushCheckpoint(ctx, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(9))
+	c.Assert(backend.txns, check.HasLen, 1)
+
+	// the buffered changes are applied before a DDL
+	c.Assert(sink.EmitDDL(ctx, model.Txn{Ts: 11, DDL: &model.DDL{}}), check.IsNil)
+	c.Assert(backend.txns, check.HasLen, 2)
+	c.Assert(backend.txns[1].Ts, check.Equals, uint64(11))
+	c.Assert(backend.txns[1].DMLs[0].Tp, check.Equals, model.DeleteDMLType)
+	c.Assert(backend.recorded()[2:], check.DeepEquals, []string{"ddl 11"})
+}
+
+func (s *snapshotSuite) TestMySQLAtomicEmit(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	sink := mysqlSink{
+		db:           db,
+		infoGetter:   &pkTableHelper{},
+		workerCount:  4,
+		maxBatchSize: defaultMaxBatchSize,
+	}
+	// the changes of the tables are applied in one transaction instead of
+	// the transactions of the workers
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`t1`(`id`,`name`) VALUES (?,?);").
+		WithArgs(1, "a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("REPLACE INTO `test`.`t2`(`id`,`name`) VALUES (?,?);").
+		WithArgs(2, "b").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	txn := compactTestTxn(10,
+		newTestDML(model.InsertDMLType, "t1", 1, "a"),
+		newTestDML(model.InsertDMLType, "t2", 2, "b"))
+	c.Assert(sink.EmitDMLs(withAtomicEmit(context.Background()), txn), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
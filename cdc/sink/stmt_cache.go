@@ -0,0 +1,170 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// stmtKey identifies a prepared statement by the table, the version of the
+// table schema and the statement text, which covers the shape of the
+// statement like the columns and the number of rows.
+type stmtKey struct {
+	schema  string
+	table   string
+	version uint64
+	query   string
+}
+
+type cachedStmt struct {
+	key  stmtKey
+	stmt *sql.Stmt
+	// refs is the number of the executions using the statement, an evicted
+	// statement is closed after the executions finish.
+	refs    int
+	evicted bool
+}
+
+// stmtCache caches the prepared statements of the DMLs in the LRU order, the
+// statements of a table are invalidated once the table schema changes, that
+// is, a DDL of the table is executed.
+type stmtCache struct {
+	db         *sql.DB
+	capacity   int
+	changefeed string
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[stmtKey]*list.Element
+	versions map[[2]string]uint64
+}
+
+func newStmtCache(db *sql.DB, capacity int, changefeed string) *stmtCache {
+	return &stmtCache{
+		db:         db,
+		capacity:   capacity,
+		changefeed: changefeed,
+		lru:        list.New(),
+		entries:    make(map[stmtKey]*list.Element),
+		versions:   make(map[[2]string]uint64),
+	}
+}
+
+// get returns the prepared statement of the key, the statement is prepared if
+// it's not cached. The statement should be released after used.
+func (c *stmtCache) get(ctx context.Context, key stmtKey) (*cachedStmt, error) {
+	if cs := c.lookup(key); cs != nil {
+		stmtCacheCounter.WithLabelValues(c.changefeed, "hit").Inc()
+		return cs, nil
+	}
+	stmtCacheCounter.WithLabelValues(c.changefeed, "miss").Inc()
+	stmt, err := c.db.PrepareContext(ctx, key.query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		// prepared by another worker at the same time
+		closeStmt(stmt)
+		cs := elem.Value.(*cachedStmt)
+		cs.refs++
+		c.lru.MoveToFront(elem)
+		return cs, nil
+	}
+	cs := &cachedStmt{key: key, stmt: stmt, refs: 1}
+	c.invalidateLocked(key)
+	c.entries[key] = c.lru.PushFront(cs)
+	for c.lru.Len() > c.capacity {
+		c.evictLocked(c.lru.Back())
+	}
+	return cs, nil
+}
+
+func (c *stmtCache) lookup(key stmtKey) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	cs := elem.Value.(*cachedStmt)
+	cs.refs++
+	c.lru.MoveToFront(elem)
+	return cs
+}
+
+// release marks the execution using the statement finished.
+func (c *stmtCache) release(cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs.refs--
+	if cs.evicted && cs.refs == 0 {
+		closeStmt(cs.stmt)
+	}
+}
+
+// invalidateLocked evicts the statements of the older versions of the table.
+func (c *stmtCache) invalidateLocked(key stmtKey) {
+	table := [2]string{key.schema, key.table}
+	version, ok := c.versions[table]
+	if ok && version >= key.version {
+		return
+	}
+	c.versions[table] = key.version
+	if !ok {
+		return
+	}
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		cs := elem.Value.(*cachedStmt)
+		if cs.key.schema == key.schema && cs.key.table == key.table && cs.key.version < key.version {
+			c.evictLocked(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *stmtCache) evictLocked(elem *list.Element) {
+	cs := elem.Value.(*cachedStmt)
+	c.lru.Remove(elem)
+	delete(c.entries, cs.key)
+	cs.evicted = true
+	if cs.refs == 0 {
+		closeStmt(cs.stmt)
+	}
+}
+
+// close closes all the cached statements.
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.evictLocked(c.lru.Back())
+	}
+}
+
+func closeStmt(stmt *sql.Stmt) {
+	if err := stmt.Close(); err != nil {
+		log.Warn("close prepared statement failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+)
+
+type stmtCacheSuite struct{}
+
+var _ = check.Suite(&stmtCacheSuite{})
+
+func (s *stmtCacheSuite) TestEvict(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	ctx := context.Background()
+
+	cache := newStmtCache(db, 2, "test-cf")
+	k1 := stmtKey{schema: "test", table: "t1", version: 1, query: "q1"}
+	k2 := stmtKey{schema: "test", table: "t2", version: 1, query: "q2"}
+	k3 := stmtKey{schema: "test", table: "t2", version: 1, query: "q3"}
+	mock.ExpectPrepare("q1").WillBeClosed()
+	mock.ExpectPrepare("q2")
+	mock.ExpectPrepare("q3").WillBeClosed()
+
+	cs1, err := cache.get(ctx, k1)
+	c.Assert(err, check.IsNil)
+	cache.release(cs1)
+	// the cached statement is reused
+	cs, err := cache.get(ctx, k1)
+	c.Assert(err, check.IsNil)
+	c.Assert(cs, check.Equals, cs1)
+	cache.release(cs)
+
+	cs2, err := cache.get(ctx, k2)
+	c.Assert(err, check.IsNil)
+	cache.release(cs2)
+	// the statement in use is closed after released
+	cs3, err := cache.get(ctx, k3)
+	c.Assert(err, check.IsNil)
+	c.Assert(cs1.evicted, check.IsTrue)
+	c.Assert(cache.lru.Len(), check.Equals, 2)
+
+	// the statements of the older version are invalidated
+	mock.ExpectPrepare("q2").WillBeClosed()
+	cs, err = cache.get(ctx, stmtKey{schema: "test", table: "t2", version: 2, query: "q2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(cs2.evicted, check.IsTrue)
+	c.Assert(cs3.evicted, check.IsTrue)
+	c.Assert(cache.lru.Len(), check.Equals, 1)
+	cache.release(cs)
+	cache.release(cs3)
+
+	cache.close()
+	c.Assert(cache.lru.Len(), check.Equals, 0)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *stmtCacheSuite) TestEmitWithCache(c *check.C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	mock.MatchExpectationsInOrder(false)
+
+	sink := newMySQLSink(db, &tableHelper{}, false)
+	sink.workerCount = 1
+	sink.stmtCache = newStmtCache(db, 8, "test-cf")
+	query := "REPLACE INTO `test`.`t1`(`id`,`name`) VALUES (?,?);"
+	// the statement is prepared by the cache, and prepared again on the
+	// connection of the transaction only once
+	mock.ExpectPrepare(query)
+	mock.ExpectPrepare(query)
+	for i := 1; i <= 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(query).WithArgs(i, "tester").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err = sink.EmitDMLs(context.Background(), newTestTxn(uint64(10+i), "t1", i))
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	dbtypes "github.com/pingcap/tidb/types"
+)
+
+type streamLoadSuite struct{}
+
+var _ = check.Suite(&streamLoadSuite{})
+
+type streamLoadRequest struct {
+	path   string
+	header http.Header
+	rows   []map[string]interface{}
+}
+
+// newStreamLoadServers starts a FE redirecting the loads to a BE, the BE
+// responds with the given status.
+func newStreamLoadServers(c *check.C, status string) (fe, be *httptest.Server, requests func() []*streamLoadRequest) {
+	var (
+		mu   sync.Mutex
+		reqs []*streamLoadRequest
+	)
+	be = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, ok := req.BasicAuth()
+		c.Assert(ok, check.IsTrue)
+		c.Assert(user, check.Equals, "root")
+		c.Assert(password, check.Equals, "secret")
+		r := &streamLoadRequest{path: req.URL.Path, header: req.Header}
+		c.Assert(json.NewDecoder(req.Body).Decode(&r.rows), check.IsNil)
+		mu.Lock()
+		reqs = append(reqs, r)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(&streamLoadResponse{Status: status, ExistingJobStatus: "FINISHED"})
+	}))
+	fe = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.Method, check.Equals, http.MethodPut)
+		http.Redirect(w, req, be.URL+req.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	return fe, be, func() []*streamLoadRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return reqs
+	}
+}
+
+func (s *streamLoadSuite) TestDoris(c *check.C) {
+	fe, be, requests := newStreamLoadServers(c, streamLoadStatusSuccess)
+	defer fe.Close()
+	defer be.Close()
+
+	sink, err := NewSink("doris://root:secret@"+strings.TrimPrefix(fe.URL, "http://")+"/?max-batch-rows=1",
+		&tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+
+	deleteTxn := newTestTxn(12, "t1", 1)
+	deleteTxn.DMLs[0].Tp = model.DeleteDMLType
+	err = sink.EmitDMLs(context.Background(), newTestTxn(10, "t1", 1, 2), newTestTxn(11, "t2", 3), deleteTxn)
+	c.Assert(err, check.IsNil)
+
+	reqs := requests()
+	c.Assert(reqs, check.HasLen, 3)
+	// the insert of row 1 is overwritten by the delete
+	c.Assert(reqs[0].path, check.Equals, "/api/test/t1/_stream_load")
+	c.Assert(reqs[0].header.Get("label"), check.Equals, "ticdc_t1_10_12_0")
+	c.Assert(reqs[0].header.Get("format"), check.Equals, "json")
+	c.Assert(reqs[0].header.Get("hidden_columns"), check.Equals, dorisDeleteSignColumn)
+	c.Assert(reqs[0].rows, check.DeepEquals, []map[string]interface{}{
+		{"id": float64(1), "name": "tester", dorisDeleteSignColumn: float64(1)},
+	})
+	c.Assert(reqs[1].header.Get("label"), check.Equals, "ticdc_t1_10_12_1")
+	c.Assert(reqs[1].rows[0]["id"], check.Equals, float64(2))
+	c.Assert(reqs[1].rows[0][dorisDeleteSignColumn], check.Equals, float64(0))
+	c.Assert(reqs[2].path, check.Equals, "/api/test/t2/_stream_load")
+}
+
+func (s *streamLoadSuite) TestStarRocksLabelExists(c *check.C) {
+	fe, be, requests := newStreamLoadServers(c, streamLoadStatusLabelExists)
+	defer fe.Close()
+	defer be.Close()
+
+	sink, err := NewSink("starrocks://root:secret@"+strings.TrimPrefix(fe.URL, "http://")+"/",
+		&tableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+	txn := newTestTxn(10, "t1", 1)
+	txn.DMLs[0].Values["name"] = dbtypes.NewDatum("a b")
+	err = sink.EmitDMLs(context.Background(), txn)
+	c.Assert(err, check.IsNil)
+
+	reqs := requests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].header.Get("columns"), check.Equals, "__op,id,name")
+	c.Assert(reqs[0].header.Get("hidden_columns"), check.Equals, "")
+	c.Assert(reqs[0].rows[0][starRocksOpColumn], check.Equals, float64(0))
+}
+
+func (s *streamLoadSuite) TestUpdateKey(c *check.C) {
+	fe, be, requests := newStreamLoadServers(c, streamLoadStatusSuccess)
+	defer fe.Close()
+	defer be.Close()
+
+	sink, err := NewSink("doris://root:secret@"+strings.TrimPrefix(fe.URL, "http://")+"/",
+		&pkTableHelper{}, nil)
+	c.Assert(err, check.IsNil)
+	update := newTestDML(model.UpdateDMLType, "t1", 2, "b")
+	update.OldValues = newTestDML(model.UpdateDMLType, "t1", 1, "a").Values
+	// the update keeping the key loads the new row only
+	unchanged := newTestDML(model.UpdateDMLType, "t1", 3, "d")
+	unchanged.OldValues = newTestDML(model.UpdateDMLType, "t1", 3, "c").Values
+	err = sink.EmitDMLs(context.Background(), model.Txn{Ts: 10, DMLs: []*model.DML{update, unchanged}})
+	c.Assert(err, check.IsNil)
+
+	reqs := requests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].rows, check.DeepEquals, []map[string]interface{}{
+		{"id": float64(1), "name": "a", dorisDeleteSignColumn: float64(1)},
+		{"id": float64(2), "name": "b", dorisDeleteSignColumn: float64(0)},
+		{"id": float64(3), "name": "d", dorisDeleteSignColumn: float64(0)},
+	})
+}
+
+func (s *streamLoadSuite) TestRowKey(c *check.C) {
+	key1, err := streamLoadRowKey([]dbtypes.Datum{dbtypes.NewDatum("a_b"), dbtypes.NewDatum("c")})
+	c.Assert(err, check.IsNil)
+	key2, err := streamLoadRowKey([]dbtypes.Datum{dbtypes.NewDatum("a"), dbtypes.NewDatum("b_c")})
+	c.Assert(err, check.IsNil)
+	c.Assert(key1, check.Not(check.Equals), key2)
+	key3, err := streamLoadRowKey([]dbtypes.Datum{dbtypes.NewDatum(1)})
+	c.Assert(err, check.IsNil)
+	key4, err := streamLoadRowKey([]dbtypes.Datum{dbtypes.NewDatum("1")})
+	c.Assert(err, check.IsNil)
+	c.Assert(key3, check.Not(check.Equals), key4)
+}
+
+func (s *streamLoadSuite) TestLabel(c *check.C) {
+	batch := &streamLoadBatch{table: "t-1 测试", firstTs: 1, lastTs: 2}
+	c.Assert(streamLoadLabel(batch, 0), check.Equals, "ticdc_t-1____1_2_0")
+	batch.table = strings.Repeat("t", 200)
+	c.Assert(streamLoadLabel(batch, 3), check.HasLen, streamLoadMaxLabelLength)
+	c.Assert(strings.HasSuffix(streamLoadLabel(batch, 3), "_1_2_3"), check.IsTrue)
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// OrderVerifySink verifies the order of the events written to the backend
+// sink, it's used by the integration tests and during the upgrades. The
+// commit ts of the changes of a row, identified by the unique key of its
+// table or by the table if there is no unique key, never goes backward, and
+// no DML goes before a DDL of its table. No event is at or before the ts of
+// the last flushed checkpoint, and the backend never returns a checkpoint
+// beyond the flushed ts. The events are verified before they are written.
+type OrderVerifySink struct {
+	backend      Sink
+	changefeedID string
+	infoGetter   TableInfoGetter
+	action       string
+
+	mu sync.Mutex
+	// rows is the commit ts of the last changes of the rows by the quoted
+	// table names and the row keys
+	rows map[string]map[string]uint64
+	// ddls is the commit ts of the last DDLs of the tables
+	ddls map[string]uint64
+	// flushedTs is the ts of the last flushed checkpoint
+	flushedTs uint64
+	// replaying is the ts the resumed tables are replicated again after,
+	// until the next checkpoint is flushed
+	replaying map[string]uint64
+}
+
+var _ Sink = &OrderVerifySink{}
+
+// NewOrderVerifySink wraps the sink to verify the order of the events, the
+// action on a violation is model.VerifyOrderError or model.VerifyOrderPanic.
+func NewOrderVerifySink(backend Sink, changefeedID string, infoGetter TableInfoGetter, action string) *OrderVerifySink {
+	return &OrderVerifySink{
+		backend:      backend,
+		changefeedID: changefeedID,
+		infoGetter:   infoGetter,
+		action:       action,
+		rows:         make(map[string]map[string]uint64),
+		ddls:         make(map[string]uint64),
+		replaying:    make(map[string]uint64),
+	}
+}
+
+// EmitDMLs implements Sink interface.
+func (s *OrderVerifySink) EmitDMLs(ctx context.Context, txns ...model.Txn) error {
+	if err := s.verifyDMLs(txns); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.backend.EmitDMLs(ctx, txns...))
+}
+
+// EmitDDL implements Sink interface.
+func (s *OrderVerifySink) EmitDDL(ctx context.Context, txn model.Txn) error {
+	if err := s.verifyDDL(txn); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.backend.EmitDDL(ctx, txn))
+}
+
+// FlushCheckpoint implements Sink interface.
+func (s *OrderVerifySink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	checkpointTs, err := s.backend.FlushCheckpoint(ctx, ts)
+	if err != nil {
+		return checkpointTs, errors.Trace(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if checkpointTs > ts {
+		return 0, s.violate("the checkpoint ts returned by the sink is beyond the flushed ts",
+			zap.Uint64("checkpointTs", checkpointTs), zap.Uint64("flushedTs", ts))
+	}
+	if ts > s.flushedTs {
+		s.flushedTs = ts
+	}
+	// the state at or before the flushed ts is not needed any more, the
+	// events after it are verified against the flushed ts
+	for table, rows := range s.rows {
+		for key, rowTs := range rows {
+			if rowTs <= s.flushedTs {
+				delete(rows, key)
+			}
+		}
+		if len(rows) == 0 {
+			delete(s.rows, table)
+		}
+	}
+	for table, ddlTs := range s.ddls {
+		if ddlTs <= s.flushedTs {
+			delete(s.ddls, table)
+		}
+	}
+	s.replaying = make(map[string]uint64)
+	return checkpointTs, nil
+}
+
+// Close implements Sink interface.
+func (s *OrderVerifySink) Close() error {
+	return errors.Trace(s.backend.Close())
+}
+
+// ResetTable forgets the events of the table, and allows the events of the
+// table after ts until the next checkpoint is flushed. It's called when a
+// paused table is replicated again from ts.
+func (s *OrderVerifySink) ResetTable(schema, table string, ts uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := util.QuoteSchema(schema, table)
+	delete(s.rows, name)
+	delete(s.ddls, name)
+	s.replaying[name] = ts
+}
+
+func (s *OrderVerifySink) verifyDMLs(txns []model.Txn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, txn := range txns {
+		for _, dml := range txn.DMLs {
+			table := dml.TableName()
+			// an update of the unique key changes two rows
+			keys := []string{s.rowKey(dml.Database, dml.Table, dml.Values)}
+			if dml.Tp == model.UpdateDMLType && dml.OldValues != nil {
+				if oldKey := s.rowKey(dml.Database, dml.Table, dml.OldValues); oldKey != keys[0] {
+					keys = append(keys, oldKey)
+				}
+			}
+			if err := s.verifyFlushed(txn.Ts, table, zap.Strings("keys", keys)); err != nil {
+				return err
+			}
+			if ddlTs, ok := s.ddls[table]; ok && txn.Ts < ddlTs {
+				return s.violate("the commit ts of the dml is before the ddl of the table",
+					zap.String("table", table), zap.Strings("keys", keys),
+					zap.Uint64("commitTs", txn.Ts), zap.Uint64("ddlTs", ddlTs))
+			}
+			rows, ok := s.rows[table]
+			if !ok {
+				rows = make(map[string]uint64)
+				s.rows[table] = rows
+			}
+			for _, key := range keys {
+				if lastTs, ok := rows[key]; ok && txn.Ts < lastTs {
+					return s.violate("the commit ts of the row goes backward",
+						zap.String("table", table), zap.String("key", key),
+						zap.Uint64("commitTs", txn.Ts), zap.Uint64("lastCommitTs", lastTs))
+				}
+				rows[key] = txn.Ts
+			}
+		}
+	}
+	return nil
+}
+
+func (s *OrderVerifySink) verifyDDL(txn model.Txn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table := util.QuoteSchema(txn.DDL.Database, txn.DDL.Table)
+	query := ""
+	if txn.DDL.Job != nil {
+		query = txn.DDL.Job.Query
+	}
+	if err := s.verifyFlushed(txn.Ts, table, zap.String("ddl", query)); err != nil {
+		return err
+	}
+	lastTs := s.ddls[table]
+	for _, rowTs := range s.rows[table] {
+		if rowTs > lastTs {
+			lastTs = rowTs
+		}
+	}
+	if txn.Ts < lastTs {
+		return s.violate("the commit ts of the ddl is before the last event of the table",
+			zap.String("table", table), zap.String("ddl", query),
+			zap.Uint64("commitTs", txn.Ts), zap.Uint64("lastCommitTs", lastTs))
+	}
+	s.ddls[table] = txn.Ts
+	return nil
+}
+
+// verifyFlushed checks the event of the table is after the flushed ts, or
+// after the ts the table is replicated again from.
+func (s *OrderVerifySink) verifyFlushed(ts uint64, table string, event zap.Field) error {
+	if ts > s.flushedTs {
+		return nil
+	}
+	if replayTs, ok := s.replaying[table]; ok && ts > replayTs {
+		return nil
+	}
+	return s.violate("the commit ts of the event is at or before the flushed checkpoint",
+		zap.String("table", table), event, zap.Uint64("commitTs", ts), zap.Uint64("flushedTs", s.flushedTs))
+}
+
+// rowKey returns the values of the unique key of the row like "id=1", it's
+// empty if the row isn't identified by a unique key.
+func (s *OrderVerifySink) rowKey(schema, table string, values map[string]types.Datum) string {
+	info, ok := s.infoGetter.GetTableByName(schema, table)
+	if !ok {
+		return ""
+	}
+	names, keyValues, ok := uniqueKeySlice(info, values)
+	if !ok {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%v", name, keyValues[i].GetValue())
+	}
+	return strings.Join(parts, ",")
+}
+
+// violate logs the violation with the fields, and returns a fatal error with
+// the fields or panics by the action.
+func (s *OrderVerifySink) violate(msg string, fields ...zap.Field) error {
+	fields = append([]zap.Field{zap.String("changefeed", s.changefeedID)}, fields...)
+	if s.action == model.VerifyOrderPanic {
+		log.Panic(msg, fields...)
+	}
+	log.Error(msg, fields...)
+	enc := zapcore.NewMapObjectEncoder()
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		field.AddTo(enc)
+		parts[i] = fmt.Sprintf("%s=%v", field.Key, enc.Fields[field.Key])
+	}
+	return newFatalError(errors.Errorf("order violation: %s, %s", msg, strings.Join(parts, ", ")))
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type orderVerifySuite struct{}
+
+var _ = check.Suite(&orderVerifySuite{})
+
+func verifyTestDDL(ts uint64, table string) model.Txn {
+	return model.Txn{Ts: ts, DDL: &model.DDL{Database: "test", Table: table, Job: &timodel.Job{Query: "alter table " + table}}}
+}
+
+func (s *orderVerifySuite) TestVerifyDMLs(c *check.C) {
+	ctx := context.Background()
+	backend := &recordingSink{}
+	sink := NewOrderVerifySink(backend, "test", &compactTableHelper{}, model.VerifyOrderError)
+
+	c.Assert(sink.EmitDMLs(ctx,
+		compactTestTxn(5, newTestDML(model.InsertDMLType, "t", 1, "a")),
+		compactTestTxn(5, newTestDML(model.InsertDMLType, "nokey", 1, "a")),
+	), check.IsNil)
+	// the other rows may go before the row
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(3, newTestDML(model.InsertDMLType, "t", 2, "a"))), check.IsNil)
+	c.Assert(backend.txns, check.HasLen, 3)
+
+	err := sink.EmitDMLs(ctx, compactTestTxn(4, newTestDML(model.UpdateDMLType, "t", 1, "b")))
+	c.Assert(IsFatalError(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, "order violation: the commit ts of the row goes backward, changefeed=test, table=`test`.`t`, key=id=1, commitTs=4, lastCommitTs=5")
+	// the rows of a table without unique key are keyed by the table
+	err = sink.EmitDMLs(ctx, compactTestTxn(4, newTestDML(model.InsertDMLType, "nokey", 2, "a")))
+	c.Assert(err, check.ErrorMatches, ".*the commit ts of the row goes backward.*table=`test`.`nokey`, key=, .*")
+	// the old key of an update is verified too
+	update := newTestDML(model.UpdateDMLType, "t", 3, "a")
+	update.OldValues = newTestDML(model.InsertDMLType, "t", 1, "a").Values
+	err = sink.EmitDMLs(ctx, compactTestTxn(4, update))
+	c.Assert(err, check.ErrorMatches, ".*key=id=1, commitTs=4, lastCommitTs=5")
+	// the violations are not written
+	c.Assert(backend.txns, check.HasLen, 3)
+
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(5, update)), check.IsNil)
+	c.Assert(backend.txns, check.HasLen, 4)
+}
+
+func (s *orderVerifySuite) TestVerifyFlushed(c *check.C) {
+	ctx := context.Background()
+	sink := NewOrderVerifySink(&recordingSink{}, "test", &compactTableHelper{}, model.VerifyOrderError)
+
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(5, newTestDML(model.InsertDMLType, "t", 1, "a"))), check.IsNil)
+	ts, err := sink.FlushCheckpoint(ctx, 6)
+	c.Assert(err, check.IsNil)
+	c.Assert(ts, check.Equals, uint64(6))
+	// the rows at or before the flushed ts are forgotten
+	c.Assert(sink.rows, check.HasLen, 0)
+
+	err = sink.EmitDMLs(ctx, compactTestTxn(6, newTestDML(model.InsertDMLType, "t", 2, "a")))
+	c.Assert(err, check.ErrorMatches, ".*the commit ts of the event is at or before the flushed checkpoint.*commitTs=6, flushedTs=6")
+	err = sink.EmitDDL(ctx, verifyTestDDL(6, "t"))
+	c.Assert(err, check.ErrorMatches, ".*ddl=alter table t, commitTs=6, flushedTs=6")
+
+	// a resumed table is replicated again after the ts until the next
+	// checkpoint is flushed
+	sink.ResetTable("test", "t", 2)
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(3, newTestDML(model.InsertDMLType, "t", 1, "a"))), check.IsNil)
+	err = sink.EmitDMLs(ctx, compactTestTxn(3, newTestDML(model.InsertDMLType, "nokey", 1, "a")))
+	c.Assert(err, check.ErrorMatches, ".*at or before the flushed checkpoint.*")
+	_, err = sink.FlushCheckpoint(ctx, 8)
+	c.Assert(err, check.IsNil)
+	err = sink.EmitDMLs(ctx, compactTestTxn(7, newTestDML(model.InsertDMLType, "t", 1, "a")))
+	c.Assert(err, check.ErrorMatches, ".*at or before the flushed checkpoint.*")
+
+	beyond := NewOrderVerifySink(&beyondCheckpointSink{}, "test", &compactTableHelper{}, model.VerifyOrderError)
+	_, err = beyond.FlushCheckpoint(ctx, 10)
+	c.Assert(err, check.ErrorMatches, ".*the checkpoint ts returned by the sink is beyond the flushed ts.*checkpointTs=11, flushedTs=10")
+}
+
+// beyondCheckpointSink returns a checkpoint beyond the flushed ts.
+type beyondCheckpointSink struct {
+	recordingSink
+}
+
+func (b *beyondCheckpointSink) FlushCheckpoint(ctx context.Context, ts uint64) (uint64, error) {
+	return ts + 1, nil
+}
+
+func (s *orderVerifySuite) TestVerifyDDL(c *check.C) {
+	ctx := context.Background()
+	sink := NewOrderVerifySink(&recordingSink{}, "test", &compactTableHelper{}, model.VerifyOrderError)
+
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(5, newTestDML(model.InsertDMLType, "t", 1, "a"))), check.IsNil)
+	err := sink.EmitDDL(ctx, verifyTestDDL(4, "t"))
+	c.Assert(err, check.ErrorMatches, ".*the commit ts of the ddl is before the last event of the table.*commitTs=4, lastCommitTs=5")
+	c.Assert(sink.EmitDDL(ctx, verifyTestDDL(7, "t")), check.IsNil)
+	err = sink.EmitDMLs(ctx, compactTestTxn(6, newTestDML(model.InsertDMLType, "t", 2, "a")))
+	c.Assert(err, check.ErrorMatches, ".*the commit ts of the dml is before the ddl of the table.*commitTs=6, ddlTs=7")
+	// the other tables are not blocked by the ddl
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(6, newTestDML(model.InsertDMLType, "nokey", 2, "a"))), check.IsNil)
+}
+
+func (s *orderVerifySuite) TestVerifyPanic(c *check.C) {
+	ctx := context.Background()
+	sink := NewOrderVerifySink(&recordingSink{}, "test", &compactTableHelper{}, model.VerifyOrderPanic)
+	c.Assert(sink.EmitDMLs(ctx, compactTestTxn(5, newTestDML(model.InsertDMLType, "t", 1, "a"))), check.IsNil)
+	c.Assert(func() {
+		_ = sink.EmitDMLs(ctx, compactTestTxn(4, newTestDML(model.InsertDMLType, "t", 1, "a")))
+	}, check.PanicMatches, "the commit ts of the row goes backward")
+}
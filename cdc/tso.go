@@ -0,0 +1,116 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// the layout of the times converted from the ts
+const tsTimeLayout = "2006-01-02 15:04:05.000 -07:00"
+
+// the layouts of the times accepted by ParseTs
+var tsTimeLayouts = []string{
+	tsTimeLayout,
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+// TsInfo is a ts in the different forms, the physical part is the unix time in
+// milliseconds.
+type TsInfo struct {
+	TSO      uint64 `json:"tso"`
+	Physical int64  `json:"physical"`
+	Logical  int64  `json:"logical"`
+	Time     string `json:"time"`
+}
+
+// NewTsInfo converts the ts into the different forms, the time is shown in the
+// time zone.
+func NewTsInfo(ts uint64, timeZone *time.Location) *TsInfo {
+	physical := oracle.ExtractPhysical(ts)
+	return &TsInfo{
+		TSO:      ts,
+		Physical: physical,
+		Logical:  int64(ts - oracle.ComposeTS(physical, 0)),
+		Time:     oracle.GetTimeFromTS(ts).In(timeZone).Format(tsTimeLayout),
+	}
+}
+
+// ParseTs parses a ts given as a TSO like "415241823337054209", a unix time in
+// milliseconds like "1584088980000ms", or a time like "2020-03-13 16:43:00",
+// the time without a zone is in the given time zone.
+func ParseTs(value string, timeZone *time.Location) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if ms := strings.TrimSuffix(value, "ms"); ms != value {
+		physical, err := strconv.ParseInt(ms, 10, 64)
+		if err != nil || physical < 0 {
+			return 0, errors.Errorf("invalid physical time: %s", value)
+		}
+		return oracle.ComposeTS(physical, 0), nil
+	}
+	if ts, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return ts, nil
+	}
+	for _, layout := range tsTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, timeZone)
+		if err == nil {
+			return oracle.ComposeTS(oracle.GetPhysical(t), 0), nil
+		}
+	}
+	return 0, errors.Errorf("invalid ts: %s, it should be a TSO, a unix time in milliseconds like 1584088980000ms or a time like 2020-03-13 16:43:00", value)
+}
+
+// LoadTimeZone loads the time zone by name, the local time zone is used if the
+// name is empty.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	timeZone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid time zone: %s", name)
+	}
+	return timeZone, nil
+}
+
+// TsCheckResult tells whether a ts is still readable under the GC safepoint,
+// a changefeed can only be started at such a ts.
+type TsCheckResult struct {
+	Ts          *TsInfo `json:"ts"`
+	GCSafePoint *TsInfo `json:"gc-safe-point"`
+	Valid       bool    `json:"valid"`
+}
+
+// CheckTs checks the ts against the GC safepoint of the upstream cluster, the
+// data before the safepoint may have been garbage collected.
+func CheckTs(ctx context.Context, pdCli pd.Client, ts uint64, timeZone *time.Location) (*TsCheckResult, error) {
+	// the safepoint is never moved backward, so it's only read with zero
+	safePoint, err := pdCli.UpdateGCSafePoint(ctx, 0)
+	if err != nil {
+		return nil, errors.Annotate(err, "get gc safepoint")
+	}
+	return &TsCheckResult{
+		Ts:          NewTsInfo(ts, timeZone),
+		GCSafePoint: NewTsInfo(safePoint, timeZone),
+		Valid:       ts >= safePoint,
+	}, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type tsoSuite struct{}
+
+var _ = check.Suite(&tsoSuite{})
+
+type mockSafePointPDClient struct {
+	pd.Client
+	safePoint uint64
+}
+
+func (m *mockSafePointPDClient) UpdateGCSafePoint(ctx context.Context, safePoint uint64) (uint64, error) {
+	return m.safePoint, nil
+}
+
+func (s *tsoSuite) TestConvertTs(c *check.C) {
+	timeZone := time.FixedZone("UTC+8", 8*3600)
+	physical := int64(1584088980123)
+	ts := oracle.ComposeTS(physical, 5)
+
+	info := NewTsInfo(ts, timeZone)
+	c.Assert(info, check.DeepEquals, &TsInfo{
+		TSO:      ts,
+		Physical: physical,
+		Logical:  5,
+		Time:     "2020-03-13 16:43:00.123 +08:00",
+	})
+
+	for _, value := range []string{"1584088980123ms", info.Time, "2020-03-13 16:43:00.123", "2020-03-13T08:43:00.123Z"} {
+		parsed, err := ParseTs(value, timeZone)
+		c.Assert(err, check.IsNil)
+		c.Assert(parsed, check.Equals, oracle.ComposeTS(physical, 0), check.Commentf("%s", value))
+	}
+	parsed, err := ParseTs("2020-03-13 16:43:00", timeZone)
+	c.Assert(err, check.IsNil)
+	c.Assert(oracle.ExtractPhysical(parsed), check.Equals, int64(1584088980000))
+	parsed, err = ParseTs(" 415241823337054209 ", timeZone)
+	c.Assert(err, check.IsNil)
+	c.Assert(parsed, check.Equals, uint64(415241823337054209))
+
+	_, err = ParseTs("yesterday", timeZone)
+	c.Assert(err, check.ErrorMatches, "invalid ts: yesterday.*")
+	_, err = ParseTs("-1ms", timeZone)
+	c.Assert(err, check.ErrorMatches, "invalid physical time: -1ms")
+}
+
+func (s *tsoSuite) TestCheckTs(c *check.C) {
+	pdCli := &mockSafePointPDClient{safePoint: oracle.ComposeTS(1584088980000, 0)}
+	result, err := CheckTs(context.Background(), pdCli, oracle.ComposeTS(1584088979999, 0), time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Valid, check.IsFalse)
+	c.Assert(result.GCSafePoint.Time, check.Equals, "2020-03-13 08:43:00.000 +00:00")
+
+	result, err = CheckTs(context.Background(), pdCli, pdCli.safePoint, time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Valid, check.IsTrue)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sort"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// tableWorkload is the workload of a table reported by the processor.
+type tableWorkload struct {
+	traffic float64
+	regions int
+}
+
+// captureLoad is the workload of the tables of a changefeed in a capture.
+type captureLoad struct {
+	tables  int
+	traffic float64
+	regions int
+}
+
+func (l *captureLoad) add(w tableWorkload) {
+	l.tables++
+	l.traffic += w.traffic
+	l.regions += w.regions
+}
+
+// recordWorkloads remembers the last reported workloads of the tables, so a
+// table keeps its workload after it's reclaimed from a capture.
+func (c *changeFeed) recordWorkloads(infos model.ProcessorsInfos) {
+	if c.workloads == nil {
+		c.workloads = make(map[uint64]tableWorkload)
+	}
+	for _, status := range infos {
+		for _, table := range status.TableInfos {
+			c.workloads[table.ID] = c.tableWorkload(status, table.ID)
+		}
+	}
+}
+
+// tableWorkload returns the workload of the table in the task status, the last
+// recorded one is used if the processor hasn't reported it yet.
+func (c *changeFeed) tableWorkload(status *model.TaskStatus, tableID uint64) tableWorkload {
+	w := c.workloads[tableID]
+	if traffic, ok := status.TableTraffic[tableID]; ok {
+		w.traffic = traffic
+	}
+	if regions, ok := status.TableRegions[tableID]; ok {
+		w.regions = regions
+	}
+	return w
+}
+
+// captureLoads returns the workloads of the tables in the captures.
+func (c *changeFeed) captureLoads(captures map[string]*model.CaptureInfo) map[string]*captureLoad {
+	loads := make(map[string]*captureLoad, len(captures))
+	for id := range captures {
+		load := new(captureLoad)
+		if status, ok := c.processorInfos[id]; ok {
+			for _, table := range status.TableInfos {
+				load.add(c.tableWorkload(status, table.ID))
+			}
+		}
+		loads[id] = load
+	}
+	return loads
+}
+
+// lightestCapture returns the capture with the least load. The load of a
+// capture is the sum of its shares of the tables, the traffic and the regions
+// in all the captures, so a capture with a few heavy tables isn't taken as a
+// light one.
+func lightestCapture(loads map[string]*captureLoad) string {
+	var total captureLoad
+	ids := make([]string, 0, len(loads))
+	for id, load := range loads {
+		ids = append(ids, id)
+		total.tables += load.tables
+		total.traffic += load.traffic
+		total.regions += load.regions
+	}
+	sort.Strings(ids)
+	score := func(load *captureLoad) float64 {
+		var s float64
+		if total.tables > 0 {
+			s += float64(load.tables) / float64(total.tables)
+		}
+		if total.traffic > 0 {
+			s += load.traffic / total.traffic
+		}
+		if total.regions > 0 {
+			s += float64(load.regions) / float64(total.regions)
+		}
+		return s
+	}
+
+	var minID string
+	var minScore float64
+	for _, id := range ids {
+		if s := score(loads[id]); minID == "" || s < minScore {
+			minID, minScore = id, s
+		}
+	}
+	return minID
+}
+
+// sortedOrphanTables returns the orphan tables from the heaviest to the
+// lightest, the heavy tables are placed first while the loads of the captures
+// are still far apart.
+func (c *changeFeed) sortedOrphanTables() []uint64 {
+	ids := make([]uint64, 0, len(c.orphanTables))
+	for id := range c.orphanTables {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		wi, wj := c.workloads[ids[i]], c.workloads[ids[j]]
+		if wi.traffic != wj.traffic {
+			return wi.traffic > wj.traffic
+		}
+		if wi.regions != wj.regions {
+			return wi.regions > wj.regions
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+type workloadSuite struct{}
+
+var _ = check.Suite(&workloadSuite{})
+
+func (s *workloadSuite) TestSelectCaptureByWorkload(c *check.C) {
+	cf := &changeFeed{
+		processorInfos: model.ProcessorsInfos{
+			// a giant table
+			"capture-1": {
+				TableInfos:   rebalanceTables(1),
+				TableTraffic: map[uint64]float64{1: 1000},
+				TableRegions: map[uint64]int{1: 200},
+			},
+			"capture-2": {
+				TableInfos:   rebalanceTables(2, 3, 4),
+				TableTraffic: map[uint64]float64{2: 10, 3: 10, 4: 10},
+				TableRegions: map[uint64]int{2: 5, 3: 5, 4: 5},
+			},
+		},
+	}
+	captures := map[string]*model.CaptureInfo{"capture-1": {}, "capture-2": {}}
+	cf.recordWorkloads(cf.processorInfos)
+	c.Assert(cf.selectCapture(captures), check.Equals, "capture-2")
+
+	// the reported workloads are kept after the table is reclaimed
+	cf.orphanTables = map[uint64]model.ProcessTableInfo{5: {ID: 5}, 6: {ID: 6}}
+	cf.reclaimTables("capture-1")
+	delete(cf.processorInfos, "capture-1")
+	c.Assert(cf.workloads[1], check.Equals, tableWorkload{traffic: 1000, regions: 200})
+	c.Assert(cf.sortedOrphanTables(), check.DeepEquals, []uint64{1, 5, 6})
+
+	// the workload of a table not reported yet is the recorded one
+	cf.processorInfos["capture-1"] = &model.TaskStatus{TableInfos: rebalanceTables(1)}
+	loads := cf.captureLoads(captures)
+	c.Assert(*loads["capture-1"], check.Equals, captureLoad{tables: 1, traffic: 1000, regions: 200})
+	c.Assert(*loads["capture-2"], check.Equals, captureLoad{tables: 3, traffic: 30, regions: 15})
+
+	// a capture without tables is the lightest
+	captures["capture-3"] = &model.CaptureInfo{}
+	c.Assert(cf.selectCapture(captures), check.Equals, "capture-3")
+	c.Assert(lightestCapture(nil), check.Equals, "")
+}
@@ -11,8 +11,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/pingcap/errors"
 	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/ticdc/cdc"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/spf13/cobra"
 	"go.etcd.io/etcd/clientv3"
@@ -28,6 +30,9 @@ func init() {
 	cliCmd.Flags().Uint64Var(&startTs, "target-ts", 0, "target ts of changefeed")
 	cliCmd.Flags().StringVar(&sinkURI, "sink-uri", "root@tcp(127.0.0.1:3306)/", "sink uri")
 	cliCmd.Flags().StringVar(&configFile, "config", "", "path of the configuration file")
+	cliCmd.Flags().StringArrayVar(&labels, "label", nil, "label of changefeed like key=value, can be specified multiple times")
+	cliCmd.Flags().StringArrayVar(&placementLabels, "placement-label", nil, "label like zone=z1 the captures replicating the changefeed must have, can be specified multiple times")
+	cliCmd.Flags().BoolVar(&rejectIneligible, "reject-ineligible", false, "don't create changefeed if any table can't be replicated correctly")
 }
 
 var (
@@ -36,6 +41,11 @@ var (
 	targetTs   uint64
 	sinkURI    string
 	configFile string
+	labels     []string
+
+	placementLabels []string
+
+	rejectIneligible bool
 )
 
 var cliCmd = &cobra.Command{
@@ -43,6 +53,26 @@ var cliCmd = &cobra.Command{
 	Short: "simulate client to create changefeed",
 	Long:  ``,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cfLabels, err := model.ParseLabels(labels)
+		if err != nil {
+			return err
+		}
+		captureLabels, err := model.ParseLabels(placementLabels)
+		if err != nil {
+			return err
+		}
+		var placement *model.PlacementRule
+		if len(captureLabels) > 0 {
+			placement = &model.PlacementRule{CaptureLabels: captureLabels}
+		}
+		warnings, err := sink.ValidateSinkURI(sinkURI)
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			fmt.Printf("warning: %s\n", warning)
+		}
+
 		etcdCli, err := clientv3.New(clientv3.Config{
 			Endpoints:   []string{pdAddress},
 			DialTimeout: 5 * time.Second,
@@ -67,6 +97,9 @@ var cliCmd = &cobra.Command{
 			return err
 		}
 		id := uuid.New().String()
+		if err := model.ValidateChangeFeedID(id); err != nil {
+			return err
+		}
 		if startTs == 0 {
 			ts, logical, err := pdCli.GetTS(context.Background())
 			if err != nil {
@@ -80,6 +113,13 @@ var cliCmd = &cobra.Command{
 			if err := strictDecodeFile(configFile, "cdc", cfg); err != nil {
 				return err
 			}
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+		}
+
+		if err := checkTables(pdCli, cfg); err != nil {
+			return err
 		}
 
 		detail := &model.ChangeFeedInfo{
@@ -89,8 +129,10 @@ var cliCmd = &cobra.Command{
 			StartTs:    startTs,
 			TargetTs:   targetTs,
 			Config:     cfg,
+			Labels:     cfLabels,
+			Placement:  placement,
 		}
-		d, err := detail.Marshal()
+		d, err := detail.Redacted().Marshal()
 		if err != nil {
 			return err
 		}
@@ -99,6 +141,37 @@ var cliCmd = &cobra.Command{
 	},
 }
 
+// checkTables warns of the tables whose rows can't be identified in the
+// downstream, it fails if there are such tables and they are rejected.
+func checkTables(pdCli pd.Client, cfg *model.ReplicaConfig) error {
+	result, err := cdc.CheckChangefeed(context.Background(), []string{pdAddress}, pdCli, &cdc.ChangefeedDraft{
+		SinkURI:  sinkURI,
+		StartTs:  startTs,
+		TargetTs: targetTs,
+		Config:   cfg,
+	})
+	if err != nil {
+		if rejectIneligible {
+			return errors.Annotate(err, "check tables")
+		}
+		fmt.Printf("warning: check tables failed: %s\n", err)
+		return nil
+	}
+	var ineligible []string
+	for _, table := range result.Tables {
+		if table.Status == cdc.TableStatusFiltered || table.Reason == "" {
+			continue
+		}
+		name := table.Schema + "." + table.Table
+		fmt.Printf("warning: table %s: %s\n", name, table.Reason)
+		ineligible = append(ineligible, name)
+	}
+	if rejectIneligible && len(ineligible) > 0 {
+		return errors.Errorf("tables can't be replicated correctly: %s", strings.Join(ineligible, ", "))
+	}
+	return nil
+}
+
 // strictDecodeFile decodes the toml file strictly. If any item in confFile file is not mapped
 // into the Config struct, issue an error and stop the server from starting.
 func strictDecodeFile(path, component string, cfg interface{}) error {
@@ -17,10 +17,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pingcap/errors"
 	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/ticdc/cdc"
 	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/roles"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/spf13/cobra"
@@ -46,6 +54,40 @@ const (
 	CtrlClearAll = "clear-all"
 	// get tso from pd
 	CtrlGetTso = "get-tso"
+	// export changefeed definition and checkpoint to a file
+	CtrlExportCf = "export-cf"
+	// import changefeed from an exported file
+	CtrlImportCf = "import-cf"
+	// check how the upstream DDLs would be replicated by a changefeed
+	CtrlCheckDDL = "check-ddl"
+	// turn a feature flag of a stopped changefeed on or off
+	CtrlSetFeature = "set-feature"
+	// resume a table paused by its sink error
+	CtrlResumeTable = "resume-table"
+	// convert a ts between TSO, physical time and human-readable time
+	CtrlConvertTs = "convert-ts"
+	// check whether a ts is still readable under the GC safepoint
+	CtrlCheckTs = "check-ts"
+	// apply an admin job to many changefeeds through the owner
+	CtrlBatchAdmin = "batch-admin"
+	// set the limit of the incremental scans of the cluster
+	CtrlSetScanLimit = "set-scan-limit"
+	// query the limit of the incremental scans and the quotas of the captures
+	CtrlQueryScanLimit = "query-scan-limit"
+	// pause all the running changefeeds through the owner
+	CtrlPauseCluster = "pause-cluster"
+	// resume the changefeeds paused by pause-cluster through the owner
+	CtrlResumeCluster = "resume-cluster"
+	// query the changefeeds paused by pause-cluster
+	CtrlQueryClusterPause = "query-cluster-pause"
+	// move a table of a changefeed to another capture through the owner
+	CtrlMoveTable = "move-table"
+	// rebalance the tables of a changefeed among the captures through the owner
+	CtrlRebalance = "rebalance"
+	// show the moves a rebalance would plan without moving any table
+	CtrlPlanRebalance = "plan-rebalance"
+	// show the moves of the tables in a capture if it were removed
+	CtrlPlanRemoveCapture = "plan-remove-capture"
 )
 
 func init() {
@@ -53,8 +95,24 @@ func init() {
 
 	ctrlCmd.Flags().StringVar(&ctrlPdAddr, "pd-addr", "localhost:2379", "address of PD")
 	ctrlCmd.Flags().StringVar(&ctrlCfID, "changefeed-id", "", "changefeed ID")
-	ctrlCmd.Flags().StringVar(&ctrlCaptureID, "capture-id", "", "capture ID")
+	ctrlCmd.Flags().StringVar(&ctrlCaptureID, "capture-id", "", "capture ID, the target capture of move-table or the capture of plan-remove-capture")
 	ctrlCmd.Flags().StringVar(&ctrlCommand, "cmd", CtrlQueryCaptures, "controller command type")
+	ctrlCmd.Flags().StringVar(&ctrlFile, "file", "", "path of the changefeed export file")
+	ctrlCmd.Flags().Uint64Var(&ctrlSinceTs, "since-ts", 0, "check the DDLs finished after the ts")
+	ctrlCmd.Flags().StringVar(&ctrlConfigFile, "config", "", "path of the changefeed configuration file")
+	ctrlCmd.Flags().StringVar(&ctrlFeature, "feature", "", "feature flag of the changefeed")
+	ctrlCmd.Flags().BoolVar(&ctrlFeatureEnabled, "enabled", true, "turn the feature flag on or off")
+	ctrlCmd.Flags().Int64Var(&ctrlTableID, "table-id", 0, "ID of the paused table or the table to move")
+	ctrlCmd.Flags().StringVar(&ctrlTs, "ts", "", "ts to convert or check, a TSO, a unix time in milliseconds like 1584088980000ms or a time like \"2020-03-13 16:43:00\"")
+	ctrlCmd.Flags().StringVar(&ctrlTimeZone, "time-zone", "", "time zone of the times, the local time zone by default")
+	ctrlCmd.Flags().StringVar(&ctrlStatusAddr, "status-addr", "127.0.0.1:8300", "status address of the owner capture")
+	ctrlCmd.Flags().StringVar(&ctrlAdminJob, "admin-job", "", "admin job of the changefeeds, stop, resume or remove")
+	ctrlCmd.Flags().StringSliceVar(&ctrlCfIDs, "changefeed-ids", nil, "comma separated IDs of the changefeeds")
+	ctrlCmd.Flags().StringVar(&ctrlCfFilter, "changefeed-filter", "", "glob pattern of the changefeed IDs, like \"backup-*\"")
+	ctrlCmd.Flags().BoolVar(&ctrlAbortOnFailure, "abort-on-failure", false, "apply the admin job to none of the changefeeds if it fails on any of them")
+	ctrlCmd.Flags().IntVar(&ctrlGlobalScanLimit, "global-scan-limit", 0, "max number of the incremental scans running in all the captures, 0 means no limit")
+	ctrlCmd.Flags().StringVar(&ctrlBalanceBy, "balance-by", "count", "balance the tables of the changefeed by count or traffic")
+	ctrlCmd.Flags().IntVar(&ctrlCaptureScanLimit, "capture-scan-limit", 0, "max number of the incremental scans running in a capture, 0 means no limit")
 }
 
 var (
@@ -62,17 +120,46 @@ var (
 	ctrlCfID      string
 	ctrlCaptureID string
 	ctrlCommand   string
+	ctrlFile      string
+
+	ctrlSinceTs    uint64
+	ctrlConfigFile string
+
+	ctrlFeature        string
+	ctrlFeatureEnabled bool
+
+	ctrlTableID int64
+
+	ctrlTs       string
+	ctrlTimeZone string
+
+	ctrlStatusAddr     string
+	ctrlAdminJob       string
+	ctrlCfIDs          []string
+	ctrlCfFilter       string
+	ctrlAbortOnFailure bool
+
+	ctrlGlobalScanLimit  int
+	ctrlCaptureScanLimit int
+
+	ctrlBalanceBy string
 )
 
-// cf holds changefeed id, which is used for output only
+// cf holds changefeed id, state and the last error, which is used for output only
 type cf struct {
-	ID string `json:"id"`
+	ID    string              `json:"id"`
+	State string              `json:"state"`
+	Error *model.RunningError `json:"error,omitempty"`
 }
 
 // capture holds capture information
 type capture struct {
-	ID      string `json:"id"`
-	IsOwner bool   `json:"is-owner"`
+	ID        string            `json:"id"`
+	IsOwner   bool              `json:"is-owner"`
+	Draining  bool              `json:"draining,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	MaxTables int               `json:"max-tables,omitempty"`
+	Dedicated bool              `json:"dedicated,omitempty"`
 }
 
 func jsonPrint(v interface{}) error {
@@ -114,7 +201,7 @@ var ctrlCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
-			return jsonPrint(info)
+			return jsonPrint(info.Redacted())
 		case CtrlQueryCfStatus:
 			info, err := cli.GetChangeFeedStatus(context.Background(), ctrlCfID)
 			if err != nil {
@@ -127,8 +214,12 @@ var ctrlCmd = &cobra.Command{
 				return err
 			}
 			cfs := make([]*cf, 0, len(raw))
-			for id := range raw {
-				cfs = append(cfs, &cf{ID: id})
+			for id, kv := range raw {
+				info := &model.ChangeFeedInfo{}
+				if err := info.Unmarshal(kv.Value); err != nil {
+					return err
+				}
+				cfs = append(cfs, &cf{ID: id, State: cdc.ChangefeedState(info.AdminJobType), Error: info.Error})
 			}
 			return jsonPrint(cfs)
 		case CtrlQueryCaptures:
@@ -143,7 +234,14 @@ var ctrlCmd = &cobra.Command{
 			captures := make([]*capture, 0, len(raw))
 			for _, c := range raw {
 				isOwner := c.ID == ownerID
-				captures = append(captures, &capture{ID: c.ID, IsOwner: isOwner})
+				captures = append(captures, &capture{
+					ID:        c.ID,
+					IsOwner:   isOwner,
+					Draining:  c.Draining,
+					Labels:    c.Labels,
+					MaxTables: c.MaxTables,
+					Dedicated: c.Dedicated,
+				})
 			}
 			return jsonPrint(captures)
 		case CtrlQuerySubCf:
@@ -164,9 +262,371 @@ var ctrlCmd = &cobra.Command{
 				return err
 			}
 			fmt.Println(oracle.ComposeTS(ts, logic))
+		case CtrlExportCf:
+			return exportChangeFeed(context.Background(), cli)
+		case CtrlImportCf:
+			return importChangeFeed(context.Background(), cli)
+		case CtrlCheckDDL:
+			return checkDDL()
+		case CtrlSetFeature:
+			warning, err := cdc.SetChangeFeedFeature(context.Background(), cli, ctrlCfID, ctrlFeature, ctrlFeatureEnabled)
+			if err != nil {
+				return err
+			}
+			if warning != "" {
+				fmt.Printf("warning: %s\n", warning)
+			}
+			fmt.Printf("feature %s of changefeed %s is set to %v, resume the changefeed to take effect\n",
+				ctrlFeature, ctrlCfID, ctrlFeatureEnabled)
+		case CtrlResumeTable:
+			pdCli, err := pd.NewClient([]string{ctrlPdAddr}, pd.SecurityOption{})
+			if err != nil {
+				return err
+			}
+			defer pdCli.Close()
+			if err := cdc.ResumePausedTable(context.Background(), cli, pdCli, ctrlCfID, ctrlTableID); err != nil {
+				return err
+			}
+			fmt.Printf("table %d of changefeed %s is marked to be resumed\n", ctrlTableID, ctrlCfID)
+		case CtrlConvertTs, CtrlCheckTs:
+			return convertTs(context.Background(), ctrlCommand == CtrlCheckTs)
+		case CtrlBatchAdmin:
+			return batchAdmin(context.Background())
+		case CtrlPauseCluster:
+			return clusterAdmin(context.Background(), "pause")
+		case CtrlResumeCluster:
+			return clusterAdmin(context.Background(), "resume")
+		case CtrlMoveTable:
+			return moveTable(context.Background())
+		case CtrlRebalance:
+			return rebalance(context.Background())
+		case CtrlPlanRebalance:
+			return planSchedule(context.Background(), "rebalance", url.Values{
+				"cf-id":      {ctrlCfID},
+				"balance-by": {ctrlBalanceBy},
+			})
+		case CtrlPlanRemoveCapture:
+			if ctrlCaptureID == "" {
+				return errors.New("capture-id must be specified")
+			}
+			return planSchedule(context.Background(), "remove-capture", url.Values{"capture-id": {ctrlCaptureID}})
+		case CtrlQueryClusterPause:
+			pause, err := cli.GetClusterPause(context.Background())
+			if err != nil {
+				return err
+			}
+			if pause == nil {
+				fmt.Println("the cluster is not paused")
+				return nil
+			}
+			return jsonPrint(pause)
+		case CtrlSetScanLimit:
+			if ctrlGlobalScanLimit < 0 || ctrlCaptureScanLimit < 0 {
+				return errors.New("the scan limits should not be negative")
+			}
+			limit := &model.ScanLimit{Global: ctrlGlobalScanLimit, PerCapture: ctrlCaptureScanLimit}
+			if err := cli.PutScanLimit(context.Background(), limit); err != nil {
+				return err
+			}
+			fmt.Printf("the scan limit is set to %d in the cluster and %d per capture, the owner assigns the quotas to the captures\n",
+				limit.Global, limit.PerCapture)
+		case CtrlQueryScanLimit:
+			limit, err := cli.GetScanLimit(context.Background())
+			if err != nil {
+				return err
+			}
+			quota, err := cli.GetScanQuota(context.Background())
+			if err != nil {
+				return err
+			}
+			return jsonPrint(struct {
+				Limit *model.ScanLimit `json:"limit"`
+				Quota model.ScanQuota  `json:"quota"`
+			}{limit, quota})
 		default:
 			fmt.Printf("unknown controller command: %s\n", ctrlCommand)
 		}
 		return nil
 	},
 }
+
+func getClusterID(ctx context.Context) (uint64, error) {
+	pdCli, err := pd.NewClient([]string{ctrlPdAddr}, pd.SecurityOption{})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer pdCli.Close()
+	return pdCli.GetClusterID(ctx), nil
+}
+
+// exportChangeFeed writes the definition and the checkpoint of a changefeed to
+// a file, the changefeed should be stopped before exporting to avoid being
+// replicated by two clusters at the same time.
+func exportChangeFeed(ctx context.Context, cli kv.CDCEtcdClient) error {
+	if ctrlCfID == "" || ctrlFile == "" {
+		return errors.New("changefeed-id and file must be specified")
+	}
+	export, err := cli.ExportChangeFeed(ctx, ctrlCfID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	export.ClusterID, err = getClusterID(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	data, err := export.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(ctrlFile, data, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	if export.Status == nil || export.Status.AdminJobType != model.AdminStop {
+		fmt.Printf("warning: changefeed %s is not stopped, stop it before importing to another cluster\n", ctrlCfID)
+	}
+	fmt.Printf("export changefeed %s at checkpoint ts %d to %s\n", ctrlCfID, export.CheckpointTs(), ctrlFile)
+	return nil
+}
+
+// importChangeFeed creates a changefeed from an exported file, the changefeed
+// ID in the file can be overridden by the changefeed-id flag.
+func importChangeFeed(ctx context.Context, cli kv.CDCEtcdClient) error {
+	if ctrlFile == "" {
+		return errors.New("file must be specified")
+	}
+	data, err := ioutil.ReadFile(ctrlFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	export := new(model.ChangeFeedExport)
+	if err := export.Unmarshal(data); err != nil {
+		return errors.Trace(err)
+	}
+	clusterID, err := getClusterID(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if export.ClusterID != 0 && export.ClusterID != clusterID {
+		return errors.Errorf("changefeed is exported from upstream cluster %d, but the current upstream cluster is %d",
+			export.ClusterID, clusterID)
+	}
+	if ctrlCfID != "" {
+		export.ID = ctrlCfID
+	}
+	if err := model.ValidateChangeFeedID(export.ID); err != nil {
+		return errors.Trace(err)
+	}
+	if err := cli.ImportChangeFeed(ctx, export); err != nil {
+		return errors.Trace(err)
+	}
+	fmt.Printf("import changefeed %s at checkpoint ts %d\n", export.ID, export.CheckpointTs())
+	return nil
+}
+
+// convertTs prints the ts in the different forms, and checks it against the GC
+// safepoint if check is set.
+func convertTs(ctx context.Context, check bool) error {
+	timeZone, err := cdc.LoadTimeZone(ctrlTimeZone)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ts, err := cdc.ParseTs(ctrlTs, timeZone)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !check {
+		return jsonPrint(cdc.NewTsInfo(ts, timeZone))
+	}
+	pdCli, err := pd.NewClient([]string{ctrlPdAddr}, pd.SecurityOption{})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer pdCli.Close()
+	result, err := cdc.CheckTs(ctx, pdCli, ts, timeZone)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return jsonPrint(result)
+}
+
+// batchAdmin applies the admin job to the changefeeds through the HTTP API of
+// the owner, and prints the result of each changefeed.
+func batchAdmin(ctx context.Context) error {
+	if ctrlAdminJob == "" {
+		return errors.New("admin-job must be specified")
+	}
+	if len(ctrlCfIDs) == 0 && ctrlCfFilter == "" {
+		return errors.New("changefeed-ids or changefeed-filter must be specified")
+	}
+	form := url.Values{
+		"admin-job":        {ctrlAdminJob},
+		"cf-id":            ctrlCfIDs,
+		"abort-on-failure": {strconv.FormatBool(ctrlAbortOnFailure)},
+	}
+	if ctrlCfFilter != "" {
+		form.Set("cf-filter", ctrlCfFilter)
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("http://%s/capture/owner/admin/batch", ctrlStatusAddr), strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Annotatef(err, "request owner %s", ctrlStatusAddr)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("batch admin failed, status: %d, message: %s", resp.StatusCode, body)
+	}
+	var results []*cdc.AdminJobResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return errors.Trace(err)
+	}
+	return jsonPrint(results)
+}
+
+// clusterAdmin pauses or resumes all the changefeeds of the cluster through
+// the HTTP API of the owner, and prints the result of each changefeed.
+func clusterAdmin(ctx context.Context, job string) error {
+	form := url.Values{"admin-job": {job}}
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("http://%s/capture/owner/admin/cluster", ctrlStatusAddr), strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Annotatef(err, "request owner %s", ctrlStatusAddr)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s cluster failed, status: %d, message: %s", job, resp.StatusCode, body)
+	}
+	result := &cdc.ClusterAdminResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return errors.Trace(err)
+	}
+	return jsonPrint(result)
+}
+
+// moveTable moves a table of a changefeed to the target capture through the
+// HTTP API of the owner, the owner moves it in the background.
+func moveTable(ctx context.Context) error {
+	if ctrlCfID == "" || ctrlCaptureID == "" || ctrlTableID <= 0 {
+		return errors.New("changefeed-id, table-id and capture-id must be specified")
+	}
+	form := url.Values{
+		"cf-id":      {ctrlCfID},
+		"table-id":   {strconv.FormatInt(ctrlTableID, 10)},
+		"capture-id": {ctrlCaptureID},
+	}
+	if err := postOwnerAdmin(ctx, "move-table", form); err != nil {
+		return errors.Annotate(err, "move table failed")
+	}
+	fmt.Printf("table %d of changefeed %s is being moved to capture %s\n", ctrlTableID, ctrlCfID, ctrlCaptureID)
+	return nil
+}
+
+// rebalance rebalances the tables of a changefeed among the captures through
+// the HTTP API of the owner, the owner moves the tables in the background.
+func rebalance(ctx context.Context) error {
+	if ctrlCfID == "" {
+		return errors.New("changefeed-id must be specified")
+	}
+	form := url.Values{
+		"cf-id":      {ctrlCfID},
+		"balance-by": {ctrlBalanceBy},
+	}
+	if err := postOwnerAdmin(ctx, "rebalance", form); err != nil {
+		return errors.Annotate(err, "rebalance failed")
+	}
+	fmt.Printf("tables of changefeed %s are being rebalanced by %s\n", ctrlCfID, ctrlBalanceBy)
+	return nil
+}
+
+// planSchedule prints the plan of the schedule returned by the dry run API of
+// the owner, no table is moved.
+func planSchedule(ctx context.Context, api string, form url.Values) error {
+	req, err := http.NewRequest(http.MethodGet,
+		fmt.Sprintf("http://%s/capture/owner/plan/%s?%s", ctrlStatusAddr, api, form.Encode()), nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Annotatef(err, "request owner %s", ctrlStatusAddr)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("plan %s failed, status: %d, message: %s", api, resp.StatusCode, body)
+	}
+	plan := &cdc.SchedulePlan{}
+	if err := json.Unmarshal(body, plan); err != nil {
+		return errors.Trace(err)
+	}
+	return jsonPrint(plan)
+}
+
+// postOwnerAdmin posts the form to the admin API of the owner under
+// /capture/owner.
+func postOwnerAdmin(ctx context.Context, api string, form url.Values) error {
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("http://%s/capture/owner/%s", ctrlStatusAddr, api), strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Annotatef(err, "request owner %s", ctrlStatusAddr)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("status: %d, message: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// ddlCheckReport is the output of the check-ddl command.
+type ddlCheckReport struct {
+	Summary string                `json:"summary"`
+	DDLs    []*cdc.DDLCheckResult `json:"ddls"`
+}
+
+// checkDDL reports how the upstream DDLs finished after since-ts would be
+// handled under the changefeed config, without creating a changefeed.
+func checkDDL() error {
+	cfg := new(model.ReplicaConfig)
+	if len(ctrlConfigFile) > 0 {
+		if err := strictDecodeFile(ctrlConfigFile, "cdc", cfg); err != nil {
+			return err
+		}
+	}
+	results, err := cdc.CheckDDL(ctrlPdAddr, ctrlSinceTs, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return jsonPrint(&ddlCheckReport{
+		Summary: cdc.SummarizeDDLCheck(results),
+		DDLs:    results,
+	})
+}
@@ -7,18 +7,53 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
 var (
-	pdEndpoints string
-	statusAddr  string
+	pdEndpoints      string
+	statusAddr       string
+	serverConfigFile string
+
+	taskStatusCompressThreshold int
+
+	grpcKeepaliveTime         time.Duration
+	grpcKeepaliveTimeout      time.Duration
+	grpcInitialWindowSize     int32
+	grpcInitialConnWindowSize int32
+	grpcMaxRecvMsgSize        int
+
+	auditLogFile       string
+	auditLogMaxSize    int
+	auditLogMaxDays    int
+	auditLogMaxBackups int
+	auditEtcd          bool
+	auditEtcdTTL       time.Duration
+
+	autoResumeWindow        time.Duration
+	autoResumeProbeInterval time.Duration
+
+	errorRestartLimit      int
+	errorRestartBackoff    time.Duration
+	errorRestartMaxBackoff time.Duration
+
+	lifecycleWebhook string
+	drainTimeout     time.Duration
+
+	captureLabels    []string
+	captureMaxTables int
+	captureDedicated bool
+
+	dataDirs []string
 
 	serverCmd = &cobra.Command{
 		Use:              "server",
@@ -34,6 +69,30 @@ func init() {
 
 	serverCmd.Flags().StringVar(&pdEndpoints, "pd-endpoints", "http://127.0.0.1:2379", "endpoints of PD, separated by comma")
 	serverCmd.Flags().StringVar(&statusAddr, "status-addr", "127.0.0.1:8300", "bind address for http status server")
+	serverCmd.Flags().StringVar(&serverConfigFile, "config", "", "path of the config file of the options reloaded on SIGHUP, log-level, task-status-compress-threshold, auto-resume-window and auto-resume-probe-interval")
+	serverCmd.Flags().IntVar(&taskStatusCompressThreshold, "task-status-compress-threshold", 0, "compress task status stored in etcd if it is larger than the threshold in bytes, 0 to disable")
+	serverCmd.Flags().DurationVar(&grpcKeepaliveTime, "grpc-keepalive-time", kv.DefaultGrpcConfig.KeepaliveTime, "interval of gRPC keepalive pings sent to TiKV")
+	serverCmd.Flags().DurationVar(&grpcKeepaliveTimeout, "grpc-keepalive-timeout", kv.DefaultGrpcConfig.KeepaliveTimeout, "timeout of gRPC keepalive pings sent to TiKV")
+	serverCmd.Flags().Int32Var(&grpcInitialWindowSize, "grpc-initial-window-size", 0, "initial window size in bytes of gRPC streams to TiKV, 0 to use the gRPC default")
+	serverCmd.Flags().Int32Var(&grpcInitialConnWindowSize, "grpc-initial-conn-window-size", 0, "initial window size in bytes of gRPC connections to TiKV, 0 to use the gRPC default")
+	serverCmd.Flags().IntVar(&grpcMaxRecvMsgSize, "grpc-max-recv-msg-size", 0, "max size in bytes of gRPC messages received from TiKV, 0 to use the gRPC default")
+	serverCmd.Flags().StringVar(&auditLogFile, "audit-log-file", "", "audit log file of the changefeed and task metadata mutations, empty to disable")
+	serverCmd.Flags().IntVar(&auditLogMaxSize, "audit-log-max-size", 300, "max size in MB of an audit log file before rotated")
+	serverCmd.Flags().IntVar(&auditLogMaxDays, "audit-log-max-days", 0, "max days to keep the rotated audit log files, 0 to keep forever")
+	serverCmd.Flags().IntVar(&auditLogMaxBackups, "audit-log-max-backups", 0, "max number of the rotated audit log files to keep, 0 to keep all")
+	serverCmd.Flags().BoolVar(&auditEtcd, "audit-etcd", false, "save the audit entries of the metadata mutations in etcd")
+	serverCmd.Flags().DurationVar(&auditEtcdTTL, "audit-etcd-ttl", 7*24*time.Hour, "retention of the audit entries in etcd, 0 to keep forever")
+	serverCmd.Flags().DurationVar(&autoResumeWindow, "auto-resume-window", cdc.DefaultAutoResumeConfig.Window, "resume the changefeed paused by a downstream outage if the downstream recovers within the window, 0 to disable")
+	serverCmd.Flags().DurationVar(&autoResumeProbeInterval, "auto-resume-probe-interval", cdc.DefaultAutoResumeConfig.ProbeInterval, "interval of probing the downstream of the paused changefeeds")
+	serverCmd.Flags().IntVar(&errorRestartLimit, "error-restart-limit", cdc.DefaultErrorRestartConfig.Limit, "max number of the restarts of a changefeed stopped by errors before it fails, 0 to leave it stopped")
+	serverCmd.Flags().DurationVar(&errorRestartBackoff, "error-restart-backoff", cdc.DefaultErrorRestartConfig.Backoff, "delay of the first restart of a changefeed stopped by an error, it's doubled after each restart")
+	serverCmd.Flags().DurationVar(&errorRestartMaxBackoff, "error-restart-max-backoff", cdc.DefaultErrorRestartConfig.MaxBackoff, "max delay of the restarts of a changefeed stopped by errors")
+	serverCmd.Flags().StringVar(&lifecycleWebhook, "lifecycle-webhook", "", "URL the lifecycle events of the changefeeds are POSTed to by the owner, empty to disable")
+	serverCmd.Flags().DurationVar(&drainTimeout, "drain-timeout", 0, "max time to hand off the tables to the other captures before exiting on SIGTERM, 0 to exit without draining")
+	serverCmd.Flags().StringArrayVar(&captureLabels, "capture-label", nil, "label of the capture like zone=z1 selected by the placement rules of the changefeeds, can be specified multiple times")
+	serverCmd.Flags().IntVar(&captureMaxTables, "max-tables", 0, "max number of the tables of all the changefeeds in the capture, 0 for no limit")
+	serverCmd.Flags().BoolVar(&captureDedicated, "dedicated", false, "only take the changefeeds whose placement rules select the capture by its labels")
+	serverCmd.Flags().StringArrayVar(&dataDirs, "data-dir", nil, "directory of the local data of the capture like the files spilled by the sorters, can be specified multiple times to use the fastest one with enough free space, the temporary directory of the system is used if it's empty")
 }
 
 func preRunLogInfo(cmd *cobra.Command, args []string) {
@@ -50,8 +109,49 @@ func runEServer(cmd *cobra.Command, args []string) error {
 		return errors.Annotatef(err, "invalid status address: %s", statusAddr)
 	}
 
+	labels, err := model.ParseLabels(captureLabels)
+	if err != nil {
+		return err
+	}
+
 	var opts []cdc.ServerOption
-	opts = append(opts, cdc.PDEndpoints(pdEndpoints), cdc.StatusHost(addrs[0]), cdc.StatusPort(int(statusPort)))
+	opts = append(opts, cdc.PDEndpoints(pdEndpoints), cdc.StatusHost(addrs[0]), cdc.StatusPort(int(statusPort)),
+		cdc.ConfigFile(serverConfigFile), cdc.LogLevel(logLevel),
+		cdc.TaskStatusCompressThreshold(taskStatusCompressThreshold),
+		cdc.GrpcConfig(kv.GrpcConfig{
+			KeepaliveTime:         grpcKeepaliveTime,
+			KeepaliveTimeout:      grpcKeepaliveTimeout,
+			InitialWindowSize:     grpcInitialWindowSize,
+			InitialConnWindowSize: grpcInitialConnWindowSize,
+			MaxRecvMsgSize:        grpcMaxRecvMsgSize,
+		}),
+		cdc.AuditConfig(kv.AuditConfig{
+			File: log.FileLogConfig{
+				Filename:   auditLogFile,
+				MaxSize:    auditLogMaxSize,
+				MaxDays:    auditLogMaxDays,
+				MaxBackups: auditLogMaxBackups,
+			},
+			EtcdEnabled: auditEtcd,
+			EtcdTTL:     auditEtcdTTL,
+		}),
+		cdc.AutoResume(cdc.AutoResumeConfig{
+			Window:        autoResumeWindow,
+			ProbeInterval: autoResumeProbeInterval,
+		}),
+		cdc.ErrorRestart(cdc.ErrorRestartConfig{
+			Limit:      errorRestartLimit,
+			Backoff:    errorRestartBackoff,
+			MaxBackoff: errorRestartMaxBackoff,
+		}),
+		cdc.LifecycleWebhook(lifecycleWebhook),
+		cdc.DrainTimeout(drainTimeout),
+		cdc.CapturePlacement(cdc.CaptureConfig{
+			Labels:    labels,
+			MaxTables: captureMaxTables,
+			Dedicated: captureDedicated,
+		}),
+		cdc.DataDir(dataDirs...))
 
 	server, err := cdc.NewServer(opts...)
 	if err != nil {
@@ -67,9 +167,22 @@ func runEServer(cmd *cobra.Command, args []string) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		sig := <-sc
-		log.Info("got signal to exit", zap.Stringer("signal", sig))
-		cancel()
+		for sig := range sc {
+			if sig == syscall.SIGHUP {
+				if _, err := server.ReloadConfig(); err != nil {
+					log.Warn("reload config failed", zap.Error(err))
+				}
+				continue
+			}
+			log.Info("got signal to exit", zap.Stringer("signal", sig))
+			if sig == syscall.SIGTERM {
+				if err := server.Drain(ctx); err != nil {
+					log.Warn("drain capture failed, exit without draining", zap.Error(err))
+				}
+			}
+			cancel()
+			return
+		}
 	}()
 
 	err = server.Run(ctx)
@@ -0,0 +1,118 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryQuota tracks the bytes of the buffered events, and blocks the
+// acquirers while more than limit bytes are used. The bytes are only tracked
+// if the limit isn't positive. The methods of a nil quota do nothing.
+type MemoryQuota struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+	// released is closed and replaced once some bytes are released
+	released chan struct{}
+}
+
+// NewMemoryQuota creates a quota of limit bytes.
+func NewMemoryQuota(limit int64) *MemoryQuota {
+	return &MemoryQuota{
+		limit:    limit,
+		released: make(chan struct{}),
+	}
+}
+
+// Acquire acquires n bytes, it blocks while the quota is exceeded unless
+// nothing is held by the quota or the exempt one. So the holder of the events
+// of the least ts, which always releases them in time, is never blocked by
+// the others, and the exempt quota may be nil.
+func (q *MemoryQuota) Acquire(ctx context.Context, n int64, exempt *MemoryQuota) error {
+	if q == nil {
+		return nil
+	}
+	for {
+		q.mu.Lock()
+		if n <= 0 || q.limit <= 0 || q.used == 0 || q.used+n <= q.limit {
+			q.used += n
+			q.mu.Unlock()
+			return nil
+		}
+		released := q.released
+		q.mu.Unlock()
+
+		var exemptReleased chan struct{}
+		if exempt != nil {
+			exempt.mu.Lock()
+			if exempt.used == 0 {
+				exempt.mu.Unlock()
+				q.ForceAcquire(n)
+				return nil
+			}
+			exemptReleased = exempt.released
+			exempt.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		case <-exemptReleased:
+		}
+	}
+}
+
+// ForceAcquire acquires n bytes without blocking, the bytes still count
+// toward the limit of the other acquirers.
+func (q *MemoryQuota) ForceAcquire(n int64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	q.used += n
+	q.mu.Unlock()
+}
+
+// Release releases n bytes and wakes up the blocked acquirers.
+func (q *MemoryQuota) Release(n int64) {
+	if q == nil || n <= 0 {
+		return
+	}
+	q.mu.Lock()
+	q.used -= n
+	close(q.released)
+	q.released = make(chan struct{})
+	q.mu.Unlock()
+}
+
+// Used returns the bytes held by the quota.
+func (q *MemoryQuota) Used() int64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.used
+}
+
+// Exceeded returns true if more than limit bytes are used.
+func (q *MemoryQuota) Exceeded() bool {
+	if q == nil || q.limit <= 0 {
+		return false
+	}
+	return q.Used() > q.limit
+}
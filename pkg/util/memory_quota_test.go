@@ -0,0 +1,102 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type memoryQuotaSuite struct{}
+
+var _ = check.Suite(&memoryQuotaSuite{})
+
+func (s *memoryQuotaSuite) TestAcquireAndRelease(c *check.C) {
+	ctx := context.Background()
+	q := NewMemoryQuota(100)
+	// the acquirer holding nothing is never blocked
+	c.Assert(q.Acquire(ctx, 150, nil), check.IsNil)
+	c.Assert(q.Exceeded(), check.IsTrue)
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- q.Acquire(ctx, 40, nil)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("acquired while the quota is exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.Release(100)
+	select {
+	case err := <-acquired:
+		c.Assert(err, check.IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("not acquired after released")
+	}
+	c.Assert(q.Used(), check.Equals, int64(90))
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	c.Assert(q.Acquire(cctx, 20, nil), check.Equals, context.DeadlineExceeded)
+	c.Assert(q.Used(), check.Equals, int64(90))
+}
+
+func (s *memoryQuotaSuite) TestAcquireExempt(c *check.C) {
+	ctx := context.Background()
+	q := NewMemoryQuota(100)
+	q.ForceAcquire(200)
+	table := NewMemoryQuota(0)
+	// nothing is held by the exempt quota
+	c.Assert(q.Acquire(ctx, 10, table), check.IsNil)
+	c.Assert(q.Used(), check.Equals, int64(210))
+
+	table.ForceAcquire(10)
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- q.Acquire(ctx, 10, table)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("acquired while the quota is exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// woken up once the exempt quota holds nothing
+	table.Release(10)
+	select {
+	case err := <-acquired:
+		c.Assert(err, check.IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("not acquired after the exempt quota is released")
+	}
+	c.Assert(q.Used(), check.Equals, int64(220))
+}
+
+func (s *memoryQuotaSuite) TestUnlimitedAndNil(c *check.C) {
+	ctx := context.Background()
+	q := NewMemoryQuota(0)
+	c.Assert(q.Acquire(ctx, 100, nil), check.IsNil)
+	c.Assert(q.Acquire(ctx, 100, nil), check.IsNil)
+	c.Assert(q.Exceeded(), check.IsFalse)
+	c.Assert(q.Used(), check.Equals, int64(200))
+
+	var nilQuota *MemoryQuota
+	c.Assert(nilQuota.Acquire(ctx, 100, nil), check.IsNil)
+	nilQuota.ForceAcquire(100)
+	nilQuota.Release(100)
+	c.Assert(nilQuota.Used(), check.Equals, int64(0))
+	c.Assert(nilQuota.Exceeded(), check.IsFalse)
+}
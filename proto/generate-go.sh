@@ -0,0 +1,8 @@
+#!/usr/bin/env bash
+# Generates the go code of the protos, protoc and protoc-gen-go v1.3.2 must be
+# installed in PATH.
+
+set -euo pipefail
+
+cd "$(dirname "$0")"
+protoc --go_out=plugins=grpc,paths=source_relative:sinkpb sink.proto
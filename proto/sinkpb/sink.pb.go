@@ -0,0 +1,692 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: sink.proto
+
+// Package sinkpb defines the service implemented by the downstream of the
+// gRPC sink. TiCDC works as the client and streams the row changes to the
+// server in the order of commit ts.
+
+package sinkpb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type RowType int32
+
+const (
+	RowType_INSERT RowType = 0
+	RowType_UPDATE RowType = 1
+	RowType_DELETE RowType = 2
+)
+
+var RowType_name = map[int32]string{
+	0: "INSERT",
+	1: "UPDATE",
+	2: "DELETE",
+}
+
+var RowType_value = map[string]int32{
+	"INSERT": 0,
+	"UPDATE": 1,
+	"DELETE": 2,
+}
+
+func (x RowType) String() string {
+	return proto.EnumName(RowType_name, int32(x))
+}
+
+func (RowType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{0}
+}
+
+type Column struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The value is null if none of the fields is set. Decimal, time and other
+	// types without a native representation are formatted as strings.
+	//
+	// Types that are valid to be assigned to Value:
+	//	*Column_IntValue
+	//	*Column_UintValue
+	//	*Column_FloatValue
+	//	*Column_StringValue
+	//	*Column_BytesValue
+	Value                isColumn_Value `protobuf_oneof:"value"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *Column) Reset()         { *m = Column{} }
+func (m *Column) String() string { return proto.CompactTextString(m) }
+func (*Column) ProtoMessage()    {}
+func (*Column) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{0}
+}
+
+func (m *Column) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Column.Unmarshal(m, b)
+}
+func (m *Column) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Column.Marshal(b, m, deterministic)
+}
+func (m *Column) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Column.Merge(m, src)
+}
+func (m *Column) XXX_Size() int {
+	return xxx_messageInfo_Column.Size(m)
+}
+func (m *Column) XXX_DiscardUnknown() {
+	xxx_messageInfo_Column.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Column proto.InternalMessageInfo
+
+func (m *Column) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type isColumn_Value interface {
+	isColumn_Value()
+}
+
+type Column_IntValue struct {
+	IntValue int64 `protobuf:"varint,2,opt,name=int_value,json=intValue,proto3,oneof"`
+}
+
+type Column_UintValue struct {
+	UintValue uint64 `protobuf:"varint,3,opt,name=uint_value,json=uintValue,proto3,oneof"`
+}
+
+type Column_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,4,opt,name=float_value,json=floatValue,proto3,oneof"`
+}
+
+type Column_StringValue struct {
+	StringValue string `protobuf:"bytes,5,opt,name=string_value,json=stringValue,proto3,oneof"`
+}
+
+type Column_BytesValue struct {
+	BytesValue []byte `protobuf:"bytes,6,opt,name=bytes_value,json=bytesValue,proto3,oneof"`
+}
+
+func (*Column_IntValue) isColumn_Value() {}
+
+func (*Column_UintValue) isColumn_Value() {}
+
+func (*Column_FloatValue) isColumn_Value() {}
+
+func (*Column_StringValue) isColumn_Value() {}
+
+func (*Column_BytesValue) isColumn_Value() {}
+
+func (m *Column) GetValue() isColumn_Value {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *Column) GetIntValue() int64 {
+	if x, ok := m.GetValue().(*Column_IntValue); ok {
+		return x.IntValue
+	}
+	return 0
+}
+
+func (m *Column) GetUintValue() uint64 {
+	if x, ok := m.GetValue().(*Column_UintValue); ok {
+		return x.UintValue
+	}
+	return 0
+}
+
+func (m *Column) GetFloatValue() float64 {
+	if x, ok := m.GetValue().(*Column_FloatValue); ok {
+		return x.FloatValue
+	}
+	return 0
+}
+
+func (m *Column) GetStringValue() string {
+	if x, ok := m.GetValue().(*Column_StringValue); ok {
+		return x.StringValue
+	}
+	return ""
+}
+
+func (m *Column) GetBytesValue() []byte {
+	if x, ok := m.GetValue().(*Column_BytesValue); ok {
+		return x.BytesValue
+	}
+	return nil
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*Column) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*Column_IntValue)(nil),
+		(*Column_UintValue)(nil),
+		(*Column_FloatValue)(nil),
+		(*Column_StringValue)(nil),
+		(*Column_BytesValue)(nil),
+	}
+}
+
+type Row struct {
+	Type   RowType `protobuf:"varint,1,opt,name=type,proto3,enum=sinkpb.RowType" json:"type,omitempty"`
+	Schema string  `protobuf:"bytes,2,opt,name=schema,proto3" json:"schema,omitempty"`
+	Table  string  `protobuf:"bytes,3,opt,name=table,proto3" json:"table,omitempty"`
+	// The columns of the row after the change, only the key columns are
+	// present for DELETE.
+	Columns              []*Column `protobuf:"bytes,4,rep,name=columns,proto3" json:"columns,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *Row) Reset()         { *m = Row{} }
+func (m *Row) String() string { return proto.CompactTextString(m) }
+func (*Row) ProtoMessage()    {}
+func (*Row) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{1}
+}
+
+func (m *Row) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Row.Unmarshal(m, b)
+}
+func (m *Row) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Row.Marshal(b, m, deterministic)
+}
+func (m *Row) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Row.Merge(m, src)
+}
+func (m *Row) XXX_Size() int {
+	return xxx_messageInfo_Row.Size(m)
+}
+func (m *Row) XXX_DiscardUnknown() {
+	xxx_messageInfo_Row.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Row proto.InternalMessageInfo
+
+func (m *Row) GetType() RowType {
+	if m != nil {
+		return m.Type
+	}
+	return RowType_INSERT
+}
+
+func (m *Row) GetSchema() string {
+	if m != nil {
+		return m.Schema
+	}
+	return ""
+}
+
+func (m *Row) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *Row) GetColumns() []*Column {
+	if m != nil {
+		return m.Columns
+	}
+	return nil
+}
+
+type Txn struct {
+	CommitTs             uint64   `protobuf:"varint,1,opt,name=commit_ts,json=commitTs,proto3" json:"commit_ts,omitempty"`
+	Rows                 []*Row   `protobuf:"bytes,2,rep,name=rows,proto3" json:"rows,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Txn) Reset()         { *m = Txn{} }
+func (m *Txn) String() string { return proto.CompactTextString(m) }
+func (*Txn) ProtoMessage()    {}
+func (*Txn) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{2}
+}
+
+func (m *Txn) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Txn.Unmarshal(m, b)
+}
+func (m *Txn) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Txn.Marshal(b, m, deterministic)
+}
+func (m *Txn) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Txn.Merge(m, src)
+}
+func (m *Txn) XXX_Size() int {
+	return xxx_messageInfo_Txn.Size(m)
+}
+func (m *Txn) XXX_DiscardUnknown() {
+	xxx_messageInfo_Txn.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Txn proto.InternalMessageInfo
+
+func (m *Txn) GetCommitTs() uint64 {
+	if m != nil {
+		return m.CommitTs
+	}
+	return 0
+}
+
+func (m *Txn) GetRows() []*Row {
+	if m != nil {
+		return m.Rows
+	}
+	return nil
+}
+
+type ResolvedTs struct {
+	Ts                   uint64   `protobuf:"varint,1,opt,name=ts,proto3" json:"ts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolvedTs) Reset()         { *m = ResolvedTs{} }
+func (m *ResolvedTs) String() string { return proto.CompactTextString(m) }
+func (*ResolvedTs) ProtoMessage()    {}
+func (*ResolvedTs) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{3}
+}
+
+func (m *ResolvedTs) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolvedTs.Unmarshal(m, b)
+}
+func (m *ResolvedTs) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolvedTs.Marshal(b, m, deterministic)
+}
+func (m *ResolvedTs) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolvedTs.Merge(m, src)
+}
+func (m *ResolvedTs) XXX_Size() int {
+	return xxx_messageInfo_ResolvedTs.Size(m)
+}
+func (m *ResolvedTs) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolvedTs.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolvedTs proto.InternalMessageInfo
+
+func (m *ResolvedTs) GetTs() uint64 {
+	if m != nil {
+		return m.Ts
+	}
+	return 0
+}
+
+type DDL struct {
+	CommitTs             uint64   `protobuf:"varint,1,opt,name=commit_ts,json=commitTs,proto3" json:"commit_ts,omitempty"`
+	Schema               string   `protobuf:"bytes,2,opt,name=schema,proto3" json:"schema,omitempty"`
+	Table                string   `protobuf:"bytes,3,opt,name=table,proto3" json:"table,omitempty"`
+	Query                string   `protobuf:"bytes,4,opt,name=query,proto3" json:"query,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DDL) Reset()         { *m = DDL{} }
+func (m *DDL) String() string { return proto.CompactTextString(m) }
+func (*DDL) ProtoMessage()    {}
+func (*DDL) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{4}
+}
+
+func (m *DDL) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DDL.Unmarshal(m, b)
+}
+func (m *DDL) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DDL.Marshal(b, m, deterministic)
+}
+func (m *DDL) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DDL.Merge(m, src)
+}
+func (m *DDL) XXX_Size() int {
+	return xxx_messageInfo_DDL.Size(m)
+}
+func (m *DDL) XXX_DiscardUnknown() {
+	xxx_messageInfo_DDL.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DDL proto.InternalMessageInfo
+
+func (m *DDL) GetCommitTs() uint64 {
+	if m != nil {
+		return m.CommitTs
+	}
+	return 0
+}
+
+func (m *DDL) GetSchema() string {
+	if m != nil {
+		return m.Schema
+	}
+	return ""
+}
+
+func (m *DDL) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *DDL) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+type Ack struct {
+	// The commit ts of the acknowledged Txn or DDL, or the resolved ts.
+	Ts                   uint64   `protobuf:"varint,1,opt,name=ts,proto3" json:"ts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Ack) Reset()         { *m = Ack{} }
+func (m *Ack) String() string { return proto.CompactTextString(m) }
+func (*Ack) ProtoMessage()    {}
+func (*Ack) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de3fdc9ddbd2b26e, []int{5}
+}
+
+func (m *Ack) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Ack.Unmarshal(m, b)
+}
+func (m *Ack) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Ack.Marshal(b, m, deterministic)
+}
+func (m *Ack) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Ack.Merge(m, src)
+}
+func (m *Ack) XXX_Size() int {
+	return xxx_messageInfo_Ack.Size(m)
+}
+func (m *Ack) XXX_DiscardUnknown() {
+	xxx_messageInfo_Ack.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Ack proto.InternalMessageInfo
+
+func (m *Ack) GetTs() uint64 {
+	if m != nil {
+		return m.Ts
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterEnum("sinkpb.RowType", RowType_name, RowType_value)
+	proto.RegisterType((*Column)(nil), "sinkpb.Column")
+	proto.RegisterType((*Row)(nil), "sinkpb.Row")
+	proto.RegisterType((*Txn)(nil), "sinkpb.Txn")
+	proto.RegisterType((*ResolvedTs)(nil), "sinkpb.ResolvedTs")
+	proto.RegisterType((*DDL)(nil), "sinkpb.DDL")
+	proto.RegisterType((*Ack)(nil), "sinkpb.Ack")
+}
+
+func init() { proto.RegisterFile("sink.proto", fileDescriptor_de3fdc9ddbd2b26e) }
+
+var fileDescriptor_de3fdc9ddbd2b26e = []byte{
+	// 478 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x53, 0x4d, 0x6b, 0xdb, 0x40,
+	0x14, 0xd4, 0x4a, 0xb2, 0x1c, 0x3d, 0x07, 0xd7, 0x2c, 0x69, 0x31, 0xfd, 0x20, 0xaa, 0x42, 0xa8,
+	0x5a, 0xa8, 0x5d, 0x9c, 0x5f, 0xe0, 0x44, 0x02, 0x17, 0x4c, 0x29, 0x1b, 0xb5, 0x87, 0x5e, 0x82,
+	0xa4, 0x28, 0x8e, 0xb0, 0xb4, 0xab, 0x7a, 0x57, 0xb1, 0x7d, 0xed, 0xbd, 0xff, 0xad, 0x3f, 0xa9,
+	0xec, 0xae, 0xad, 0x06, 0x1f, 0x0a, 0xb9, 0xbd, 0x37, 0x33, 0x9e, 0x7d, 0x33, 0x46, 0x00, 0xbc,
+	0xa0, 0xcb, 0x51, 0xbd, 0x62, 0x82, 0x61, 0x47, 0xce, 0x75, 0xea, 0xff, 0x41, 0xe0, 0x5c, 0xb1,
+	0xb2, 0xa9, 0x28, 0xc6, 0x60, 0xd3, 0xa4, 0xca, 0x87, 0xc8, 0x43, 0x81, 0x4b, 0xd4, 0x8c, 0xdf,
+	0x80, 0x5b, 0x50, 0x71, 0xf3, 0x90, 0x94, 0x4d, 0x3e, 0x34, 0x3d, 0x14, 0x58, 0x33, 0x83, 0x1c,
+	0x15, 0x54, 0x7c, 0x97, 0x08, 0x3e, 0x05, 0x68, 0xfe, 0xf1, 0x96, 0x87, 0x02, 0x7b, 0x66, 0x10,
+	0xb7, 0x69, 0x05, 0x6f, 0xa1, 0x77, 0x57, 0xb2, 0x64, 0xaf, 0xb0, 0x3d, 0x14, 0xa0, 0x99, 0x41,
+	0x40, 0x81, 0x5a, 0x72, 0x06, 0xc7, 0x5c, 0xac, 0x0a, 0xba, 0xd8, 0x69, 0x3a, 0xf2, 0xf9, 0x99,
+	0x41, 0x7a, 0x1a, 0x6d, 0x7d, 0xd2, 0xad, 0xc8, 0xf9, 0x4e, 0xe3, 0x78, 0x28, 0x38, 0x96, 0x3e,
+	0x0a, 0x54, 0x92, 0xcb, 0x2e, 0x74, 0x14, 0xe9, 0xff, 0x42, 0x60, 0x11, 0xb6, 0xc6, 0x67, 0x60,
+	0x8b, 0x6d, 0xad, 0xf3, 0xf4, 0x27, 0xcf, 0x46, 0x3a, 0xf1, 0x88, 0xb0, 0x75, 0xbc, 0xad, 0x73,
+	0xa2, 0x48, 0xfc, 0x02, 0x1c, 0x9e, 0xdd, 0xe7, 0x55, 0xa2, 0xd2, 0xb9, 0x64, 0xb7, 0xe1, 0x13,
+	0xe8, 0x88, 0x24, 0x2d, 0x75, 0x28, 0x97, 0xe8, 0x05, 0x07, 0xd0, 0xcd, 0x54, 0x59, 0x7c, 0x68,
+	0x7b, 0x56, 0xd0, 0x9b, 0xf4, 0xf7, 0xae, 0xba, 0x43, 0xb2, 0xa7, 0xfd, 0x2b, 0xb0, 0xe2, 0x0d,
+	0xc5, 0xaf, 0xc0, 0xcd, 0x58, 0x55, 0x15, 0xe2, 0x46, 0x70, 0x75, 0x88, 0x4d, 0x8e, 0x34, 0x10,
+	0x73, 0x7c, 0x0a, 0xf6, 0x8a, 0xad, 0xf9, 0xd0, 0x54, 0x56, 0xbd, 0x47, 0x07, 0x12, 0x45, 0xf8,
+	0xaf, 0x01, 0x48, 0xce, 0x59, 0xf9, 0x90, 0xdf, 0xc6, 0x1c, 0xf7, 0xc1, 0x6c, 0x4d, 0x4c, 0xc1,
+	0xfd, 0x3b, 0xb0, 0xc2, 0x70, 0xfe, 0xff, 0x27, 0x9e, 0x16, 0xef, 0x04, 0x3a, 0x3f, 0x9b, 0x7c,
+	0xb5, 0x55, 0xff, 0x93, 0x4b, 0xf4, 0xe2, 0x3f, 0x07, 0x6b, 0x9a, 0x2d, 0x0f, 0x9f, 0xff, 0xf0,
+	0x11, 0xba, 0xbb, 0x2a, 0x31, 0x80, 0xf3, 0xf9, 0xcb, 0x75, 0x44, 0xe2, 0x81, 0x21, 0xe7, 0x6f,
+	0x5f, 0xc3, 0x69, 0x1c, 0x0d, 0x90, 0x9c, 0xc3, 0x68, 0x1e, 0xc5, 0xd1, 0xc0, 0x9c, 0xfc, 0x46,
+	0x60, 0x5f, 0x17, 0x74, 0x89, 0xdf, 0x43, 0x37, 0x92, 0xc7, 0x6d, 0x28, 0x6e, 0x23, 0xc7, 0x1b,
+	0xfa, 0xb2, 0x5d, 0xa6, 0xd9, 0xd2, 0x37, 0x02, 0xf4, 0x09, 0xe1, 0x0b, 0xe8, 0x4b, 0xe9, 0xa3,
+	0x0e, 0x70, 0x5b, 0x52, 0x8b, 0x1d, 0xfc, 0x10, 0x9f, 0x6b, 0x7f, 0x59, 0x4d, 0xcb, 0x84, 0xe1,
+	0xfc, 0x40, 0x76, 0xf9, 0xee, 0xc7, 0xf9, 0xa2, 0x10, 0xf7, 0x4d, 0x3a, 0xca, 0x58, 0x35, 0xae,
+	0x0b, 0xba, 0xc8, 0x92, 0x7a, 0x2c, 0x8a, 0xec, 0x36, 0x1b, 0xab, 0x4f, 0x64, 0xac, 0xe5, 0xa9,
+	0xa3, 0xb6, 0x8b, 0xbf, 0x03, 0x00, 0x71, 0xb2, 0xec, 0x6c, 0x3e, 0x03, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// SinkClient is the client API for Sink service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SinkClient interface {
+	// EmitTxn receives the transactions in the order of commit ts, the server
+	// must reply one Ack with the commit ts for every transaction after it is
+	// applied or persisted.
+	EmitTxn(ctx context.Context, opts ...grpc.CallOption) (Sink_EmitTxnClient, error)
+	// EmitResolvedTs notifies that all the transactions with commit ts less
+	// than or equal to the resolved ts have been sent.
+	EmitResolvedTs(ctx context.Context, in *ResolvedTs, opts ...grpc.CallOption) (*Ack, error)
+	// EmitDDL receives a DDL, it's sent after all the transactions before it
+	// are acknowledged.
+	EmitDDL(ctx context.Context, in *DDL, opts ...grpc.CallOption) (*Ack, error)
+}
+
+type sinkClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSinkClient(cc *grpc.ClientConn) SinkClient {
+	return &sinkClient{cc}
+}
+
+func (c *sinkClient) EmitTxn(ctx context.Context, opts ...grpc.CallOption) (Sink_EmitTxnClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Sink_serviceDesc.Streams[0], "/sinkpb.Sink/EmitTxn", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sinkEmitTxnClient{stream}
+	return x, nil
+}
+
+type Sink_EmitTxnClient interface {
+	Send(*Txn) error
+	Recv() (*Ack, error)
+	grpc.ClientStream
+}
+
+type sinkEmitTxnClient struct {
+	grpc.ClientStream
+}
+
+func (x *sinkEmitTxnClient) Send(m *Txn) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *sinkEmitTxnClient) Recv() (*Ack, error) {
+	m := new(Ack)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sinkClient) EmitResolvedTs(ctx context.Context, in *ResolvedTs, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/sinkpb.Sink/EmitResolvedTs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sinkClient) EmitDDL(ctx context.Context, in *DDL, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/sinkpb.Sink/EmitDDL", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SinkServer is the server API for Sink service.
+type SinkServer interface {
+	// EmitTxn receives the transactions in the order of commit ts, the server
+	// must reply one Ack with the commit ts for every transaction after it is
+	// applied or persisted.
+	EmitTxn(Sink_EmitTxnServer) error
+	// EmitResolvedTs notifies that all the transactions with commit ts less
+	// than or equal to the resolved ts have been sent.
+	EmitResolvedTs(context.Context, *ResolvedTs) (*Ack, error)
+	// EmitDDL receives a DDL, it's sent after all the transactions before it
+	// are acknowledged.
+	EmitDDL(context.Context, *DDL) (*Ack, error)
+}
+
+// UnimplementedSinkServer can be embedded to have forward compatible implementations.
+type UnimplementedSinkServer struct {
+}
+
+func (*UnimplementedSinkServer) EmitTxn(srv Sink_EmitTxnServer) error {
+	return status.Errorf(codes.Unimplemented, "method EmitTxn not implemented")
+}
+func (*UnimplementedSinkServer) EmitResolvedTs(ctx context.Context, req *ResolvedTs) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmitResolvedTs not implemented")
+}
+func (*UnimplementedSinkServer) EmitDDL(ctx context.Context, req *DDL) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmitDDL not implemented")
+}
+
+func RegisterSinkServer(s *grpc.Server, srv SinkServer) {
+	s.RegisterService(&_Sink_serviceDesc, srv)
+}
+
+func _Sink_EmitTxn_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SinkServer).EmitTxn(&sinkEmitTxnServer{stream})
+}
+
+type Sink_EmitTxnServer interface {
+	Send(*Ack) error
+	Recv() (*Txn, error)
+	grpc.ServerStream
+}
+
+type sinkEmitTxnServer struct {
+	grpc.ServerStream
+}
+
+func (x *sinkEmitTxnServer) Send(m *Ack) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *sinkEmitTxnServer) Recv() (*Txn, error) {
+	m := new(Txn)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Sink_EmitResolvedTs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolvedTs)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkServer).EmitResolvedTs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sinkpb.Sink/EmitResolvedTs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkServer).EmitResolvedTs(ctx, req.(*ResolvedTs))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sink_EmitDDL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DDL)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkServer).EmitDDL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sinkpb.Sink/EmitDDL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkServer).EmitDDL(ctx, req.(*DDL))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Sink_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "sinkpb.Sink",
+	HandlerType: (*SinkServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EmitResolvedTs",
+			Handler:    _Sink_EmitResolvedTs_Handler,
+		},
+		{
+			MethodName: "EmitDDL",
+			Handler:    _Sink_EmitDDL_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EmitTxn",
+			Handler:       _Sink_EmitTxn_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "sink.proto",
+}